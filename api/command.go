@@ -0,0 +1,27 @@
+package api
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrEmptyCommandName   = errors.New("empty command name")
+	ErrInvalidCommandName = errors.New("command name contains control characters")
+)
+
+// NormalizeCommandName returns upper-cased command name, the same for all APIs.
+// Empty names and names with control characters, like NUL or newline, are rejected to keep logs clean
+func NormalizeCommandName(name string) (string, error) {
+	if name == "" {
+		return "", ErrEmptyCommandName
+	}
+
+	for i := 0; i < len(name); i++ {
+		if name[i] < ' ' || name[i] == 0x7f {
+			return "", ErrInvalidCommandName
+		}
+	}
+
+	return strings.ToUpper(name), nil
+}
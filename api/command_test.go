@@ -0,0 +1,28 @@
+package api_test
+
+import (
+	"github.com/mshaverdo/radish/api"
+	"testing"
+)
+
+func TestNormalizeCommandName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{"get", "GET", nil},
+		{"HGetAll", "HGETALL", nil},
+		{"測試", "測試", nil},
+		{"", "", api.ErrEmptyCommandName},
+		{"GET\x00", "", api.ErrInvalidCommandName},
+		{"GET\r\nDEL", "", api.ErrInvalidCommandName},
+		{"\x7f", "", api.ErrInvalidCommandName},
+	}
+
+	for _, tst := range tests {
+		if got, err := api.NormalizeCommandName(tst.name); got != tst.want || err != tst.wantErr {
+			t.Errorf("NormalizeCommandName(%q): got %q, %v, want %q, %v", tst.name, got, err, tst.want, tst.wantErr)
+		}
+	}
+}
@@ -1,8 +1,57 @@
 package api
 
-import "github.com/mshaverdo/radish/message"
+import (
+	"errors"
+	"github.com/mshaverdo/radish/message"
+	"time"
+)
+
+// DefaultMaxRequestSize is a default limit of request size in bytes, the same as Redis bulk string limit
+const DefaultMaxRequestSize = 512 << 20
+
+// DefaultMaxClients is a default limit of concurrent client connections, the same as in Redis
+const DefaultMaxClients = 10000
 
 // MessageHandler processes a Request message and return a response message
 type MessageHandler interface {
 	HandleMessage(request *message.Request) message.Response
 }
+
+// TransactionHandler processes transactions, queued inside MULTI. MessageHandler may optionally implement it,
+// otherwise transactions aren't supported. HandleMessage rejects transactions, so they couldn't be forged by clients
+type TransactionHandler interface {
+	// HandleTransaction processes requests, packed by message.NewRequestTransaction, atomically
+	HandleTransaction(transaction *message.Request) message.Response
+}
+
+// HealthChecker reports, whether the server is able to serve requests. MessageHandler may optionally implement it
+type HealthChecker interface {
+	// CheckHealth returns nil if server is running and healthy, or the reason otherwise
+	CheckHealth() error
+}
+
+// TransactionChecker checks requests, queued inside MULTI, so EXEC discards a transaction with invalid requests
+// instead of executing it partially. MessageHandler may optionally implement it
+type TransactionChecker interface {
+	// CheckQueuedRequest returns error response, if the request couldn't be executed inside a transaction, or nil otherwise
+	CheckQueuedRequest(request *message.Request) message.Response
+}
+
+// ErrAsyncWriteFailed is returned to the connection, if any of pipelined writes failed since its previous check
+var ErrAsyncWriteFailed = errors.New("pipelined writes may be lost")
+
+// WalWaiter reports durability of requests in WAL, so the API server is able to track writes of a connection.
+// MessageHandler may optionally implement it
+type WalWaiter interface {
+	// IsModifyingRequest returns true, if the request could be written into WAL
+	IsModifyingRequest(request *message.Request) bool
+	// WalIssuedId returns id of the last WAL message, that covers all requests, handled before the call,
+	// and count of failed pipelined writes before it. Pipelined writes are acknowledged before writing into WAL,
+	// so the connection, that pipelined writes, should report ErrAsyncWriteFailed, if the count grew since the previous call
+	WalIssuedId() (id, failures int64, err error)
+	// WalFailures returns count of failed pipelined writes since start
+	WalFailures() int64
+	// WaitWalSynced blocks until WAL is durable up to the message with id, or timeout expires. Zero timeout means forever.
+	// It returns id of the last durable WAL message
+	WaitWalSynced(id int64, timeout time.Duration) (int64, error)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrRateLimitExceeded = errors.New("rate limit exceeded")
+
+// RateLimiter is a token bucket, that limits rate of commands of a single client connection.
+// The bucket holds at most one second of commands, so a client may send a burst of rate commands after a pause.
+// Zero value is ready to use and starts with the full bucket
+type RateLimiter struct {
+	mu      sync.Mutex
+	tokens  float64
+	updated time.Time
+}
+
+// Allow takes a token for a single command and returns true, or returns false, if the client exceeds rate commands per second.
+// Rate is passed on every call, so the limit, changed by CONFIG SET, is applied to already connected clients.
+// Zero rate disables the limit
+func (l *RateLimiter) Allow(rate int) bool {
+	if rate <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.updated.IsZero() {
+		l.tokens = float64(rate)
+	} else {
+		l.tokens += now.Sub(l.updated).Seconds() * float64(rate)
+	}
+	if l.tokens > float64(rate) {
+		l.tokens = float64(rate)
+	}
+	l.updated = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+
+	return true
+}
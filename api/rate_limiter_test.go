@@ -0,0 +1,32 @@
+package api_test
+
+import (
+	"github.com/mshaverdo/radish/api"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	var l api.RateLimiter
+
+	for i := 0; i < 10; i++ {
+		if !l.Allow(10) {
+			t.Fatalf("Allow() of burst, call %d: got false, want true", i)
+		}
+	}
+	if l.Allow(10) {
+		t.Errorf("Allow() over the limit: got true, want false")
+	}
+	if !l.Allow(0) {
+		t.Errorf("Allow() with zero rate: got false, want true")
+	}
+
+	// 10 per second refill a token in 100ms
+	time.Sleep(120 * time.Millisecond)
+	if !l.Allow(10) {
+		t.Errorf("Allow() after refill: got false, want true")
+	}
+	if l.Allow(10) {
+		t.Errorf("Allow() after refill: got true, want false")
+	}
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"github.com/mshaverdo/radish/log"
+	"github.com/mshaverdo/radish/message"
+	"sync/atomic"
+)
+
+// lastCorrelationId is the id of the last received request
+var lastCorrelationId uint64
+
+// RequestLog logs debug messages about lifecycle of a single request: received, handling, sending response.
+// Every message has a correlation_id field, unique within the process, to trace the request among concurrent ones,
+// and request_id field with WAL message id, once it's assigned to a modifying request.
+// nil RequestLog logs nothing, so the hot path doesn't allocate, while debug logging is disabled
+type RequestLog struct {
+	correlationId uint64
+}
+
+// NewRequestLog returns RequestLog with a new correlation id, or nil, if debug logging is disabled
+func NewRequestLog() *RequestLog {
+	if !log.IsEnabledFor(log.DEBUG) {
+		return nil
+	}
+
+	return &RequestLog{correlationId: atomic.AddUint64(&lastCorrelationId, 1)}
+}
+
+// Debugf logs a debug message with correlation id and, if request isn't nil, its command and WAL message id.
+// Request MUST NOT be written into WAL concurrently, i.e. pipelined requests are logged without WAL message id
+func (l *RequestLog) Debugf(request *message.Request, format string, args ...interface{}) {
+	if l == nil {
+		return
+	}
+
+	fields := log.Fields{"correlation_id": l.correlationId}
+	if request != nil {
+		fields["cmd"] = request.Cmd
+		if !request.Unreliable && request.Id != 0 {
+			fields["request_id"] = request.Id
+		}
+	}
+
+	log.WithFields(fields).Debugf(format, args...)
+}
@@ -0,0 +1,65 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mshaverdo/radish/api"
+	"github.com/mshaverdo/radish/log"
+	"github.com/mshaverdo/radish/message"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRequestLog(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf, log.FormatJSON)
+	defer log.SetOutput(os.Stderr, "")
+	log.SetLevel(log.DEBUG)
+
+	first, second := api.NewRequestLog(), api.NewRequestLog()
+	request := message.NewRequest("SET", [][]byte{[]byte("k"), []byte("v")})
+	pipelined := message.NewRequest("SET", [][]byte{[]byte("k"), []byte("v")})
+	pipelined.Unreliable = true
+
+	first.Debugf(nil, "Received request")
+	second.Debugf(nil, "Received request")
+	request.Id = 42
+	first.Debugf(request, "Sending response")
+	pipelined.Id = 43
+	second.Debugf(pipelined, "Sending response")
+
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %q: %s", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("got %d log lines, want 4: %q", len(entries), buf.String())
+	}
+
+	if entries[0]["correlation_id"] == entries[1]["correlation_id"] {
+		t.Errorf("different requests got the same correlation id %v", entries[0]["correlation_id"])
+	}
+	if entries[0]["correlation_id"] != entries[2]["correlation_id"] || entries[1]["correlation_id"] != entries[3]["correlation_id"] {
+		t.Errorf("lines of the same request got different correlation ids: %q", buf.String())
+	}
+	if entries[2]["cmd"] != "SET" || entries[2]["request_id"] != 42.0 {
+		t.Errorf("request fields: got %v", entries[2])
+	}
+	if _, ok := entries[3]["request_id"]; ok {
+		t.Errorf("pipelined request must be logged without request_id: got %v", entries[3])
+	}
+
+	log.SetLevel(log.NOTICE)
+	defer log.SetLevel(log.DEBUG)
+	if l := api.NewRequestLog(); l != nil {
+		t.Errorf("NewRequestLog() with disabled debug log: got %v, want nil", l)
+	}
+	// nil RequestLog is a no-op
+	var l *api.RequestLog
+	l.Debugf(request, "ignored")
+}
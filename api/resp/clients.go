@@ -0,0 +1,329 @@
+package resp
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mshaverdo/radish/api"
+	"github.com/mshaverdo/radish/log"
+	"github.com/tidwall/redcon"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idleCheckInterval is a period of checks of idle clients, every second like in Redis
+const idleCheckInterval = time.Second
+
+// clientRegistry tracks live client connections by remote address for CLIENT LIST and CLIENT KILL
+type clientRegistry struct {
+	mu      sync.RWMutex
+	lastId  int64
+	clients map[string]*connState
+	// maxClients limits count of clients, zero means unlimited
+	maxClients int
+}
+
+func newClientRegistry() *clientRegistry {
+	return &clientRegistry{clients: make(map[string]*connState), maxClients: api.DefaultMaxClients}
+}
+
+// accept registers new connection and attaches its state to the conn. It's a redcon accept callback.
+// If count of clients reached the limit, the connection is rejected with an error
+func (cr *clientRegistry) accept(conn redcon.Conn) bool {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if cr.maxClients > 0 && len(cr.clients) >= cr.maxClients {
+		// redcon flushes the error before closing rejected connection
+		conn.WriteError("ERR max number of clients reached")
+		return false
+	}
+
+	cr.lastId++
+	state := newConnState(cr.lastId, conn)
+	conn.SetContext(state)
+	cr.clients[state.addr] = state
+
+	return true
+}
+
+// closed unregisters closed connection. It's a redcon closed callback, that is invoked on detach too,
+// so subscribers are unregistered by remove() when their connections closed
+func (cr *clientRegistry) closed(conn redcon.Conn, err error) {
+	state := getConnState(conn)
+
+	state.mu.Lock()
+	isSubscriber := state.isSubscriber
+	state.mu.Unlock()
+
+	if !isSubscriber {
+		cr.remove(state)
+	}
+}
+
+// remove unregisters client
+func (cr *clientRegistry) remove(state *connState) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if cr.clients[state.addr] == state {
+		delete(cr.clients, state.addr)
+	}
+}
+
+// setMaxClients sets limit of count of clients, zero disables the limit. Already connected clients aren't closed
+func (cr *clientRegistry) setMaxClients(max int) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	cr.maxClients = max
+}
+
+// getMaxClients returns limit of count of clients, zero if unlimited
+func (cr *clientRegistry) getMaxClients() int {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	return cr.maxClients
+}
+
+// count returns count of registered clients
+func (cr *clientRegistry) count() int {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	return len(cr.clients)
+}
+
+// total returns count of clients, accepted since start
+func (cr *clientRegistry) total() int64 {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	return cr.lastId
+}
+
+// list returns all clients ordered by id
+func (cr *clientRegistry) list() []*connState {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	clients := make([]*connState, 0, len(cr.clients))
+	for _, state := range cr.clients {
+		clients = append(clients, state)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].id < clients[j].id })
+
+	return clients
+}
+
+// ConnectedClients returns count of open connections, including subscribers
+func (s *Server) ConnectedClients() int {
+	return s.clients.count()
+}
+
+// TotalConnections returns count of connections, accepted since start
+func (s *Server) TotalConnections() int64 {
+	return s.clients.total()
+}
+
+// SetMaxClients sets limit of count of open connections, including subscribers. Zero disables the limit.
+// New connections over the limit are rejected with an error
+func (s *Server) SetMaxClients(max int) {
+	s.clients.setMaxClients(max)
+}
+
+// MaxClients returns limit of count of open connections, zero if unlimited
+func (s *Server) MaxClients() int {
+	return s.clients.getMaxClients()
+}
+
+// handleClient processes CLIENT SETNAME|GETNAME|SETINFO|INFO|ID|LIST|KILL command
+func (s *Server) handleClient(conn redcon.Conn, args [][]byte) {
+	if len(args) == 0 {
+		conn.WriteError("ERR wrong number of arguments for 'client' command")
+		return
+	}
+
+	state := getConnState(conn)
+	name := string(args[0])
+	subcommand := strings.ToUpper(name)
+	args = args[1:]
+
+	switch {
+	case subcommand == "SETNAME" && len(args) == 1:
+		// like Redis, name is limited to make CLIENT LIST output parseable
+		if !isClientInfoValue(args[0]) {
+			conn.WriteError("ERR Client names cannot contain spaces, newlines or special characters.")
+			return
+		}
+		state.mu.Lock()
+		state.name = string(args[0])
+		state.mu.Unlock()
+		conn.WriteString("OK")
+	case subcommand == "GETNAME" && len(args) == 0:
+		state.mu.Lock()
+		name := state.name
+		state.mu.Unlock()
+		if name == "" {
+			conn.WriteNull()
+		} else {
+			conn.WriteBulkString(name)
+		}
+	case subcommand == "SETINFO" && len(args) == 2:
+		attr := strings.ToLower(string(args[0]))
+		if attr != "lib-name" && attr != "lib-ver" {
+			conn.WriteError(fmt.Sprintf("ERR Unrecognized option '%s'", args[0]))
+			return
+		}
+		if !isClientInfoValue(args[1]) {
+			conn.WriteError(fmt.Sprintf("ERR %s cannot contain spaces, newlines or special characters.", attr))
+			return
+		}
+		state.mu.Lock()
+		if attr == "lib-name" {
+			state.libName = string(args[1])
+		} else {
+			state.libVer = string(args[1])
+		}
+		state.mu.Unlock()
+		conn.WriteString("OK")
+	case subcommand == "INFO" && len(args) == 0:
+		conn.WriteBulkString(state.info(time.Now()) + "\n")
+	case subcommand == "ID" && len(args) == 0:
+		conn.WriteInt64(state.id)
+	case subcommand == "LIST" && len(args) == 0:
+		var buf bytes.Buffer
+		now := time.Now()
+		for _, client := range s.clients.list() {
+			buf.WriteString(client.info(now))
+			buf.WriteByte('\n')
+		}
+		conn.WriteBulk(buf.Bytes())
+	case subcommand == "KILL" && len(args) == 1:
+		// old form: CLIENT KILL addr
+		killed, killSelf := s.killClients(state, func(client *connState) bool { return client.addr == string(args[0]) })
+		if killed == 0 {
+			conn.WriteError("ERR No such client")
+			return
+		}
+
+		conn.WriteString("OK")
+		if killSelf {
+			conn.Close()
+		}
+	case subcommand == "KILL" && len(args) > 0 && len(args)%2 == 0:
+		// new form: CLIENT KILL [ID id] [ADDR addr]
+		var filters []func(client *connState) bool
+		for i := 0; i < len(args); i += 2 {
+			value := string(args[i+1])
+			switch strings.ToUpper(string(args[i])) {
+			case "ADDR":
+				filters = append(filters, func(client *connState) bool { return client.addr == value })
+			case "ID":
+				id, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					conn.WriteError("ERR client-id should be greater than 0")
+					return
+				}
+				filters = append(filters, func(client *connState) bool { return client.id == id })
+			default:
+				conn.WriteError("ERR syntax error")
+				return
+			}
+		}
+
+		killed, killSelf := s.killClients(state, func(client *connState) bool {
+			for _, filter := range filters {
+				if !filter(client) {
+					return false
+				}
+			}
+			return true
+		})
+
+		conn.WriteInt(killed)
+		if killSelf {
+			conn.Close()
+		}
+	case subcommand == "SETNAME" || subcommand == "GETNAME" || subcommand == "SETINFO" || subcommand == "INFO" ||
+		subcommand == "ID" || subcommand == "LIST" || subcommand == "KILL":
+		conn.WriteError(fmt.Sprintf("ERR wrong number of arguments for 'client|%s' command", strings.ToLower(subcommand)))
+	default:
+		conn.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'. Try CLIENT HELP.", name))
+	}
+}
+
+// killClients closes connections of clients, matched by filter, and returns count of them.
+// Own connection isn't closed to let caller send the reply first, killSelf is true, if it must be closed
+func (s *Server) killClients(self *connState, filter func(client *connState) bool) (count int, killSelf bool) {
+	for _, client := range s.clients.list() {
+		if !filter(client) {
+			continue
+		}
+
+		count++
+		if client == self {
+			killSelf = true
+		} else if client.netConn != nil {
+			// closing of net.Conn is safe from any goroutine, the connection handler gets read error and exits
+			client.netConn.Close()
+		}
+	}
+
+	return count, killSelf
+}
+
+// closeIdleClients closes connections of idle clients once per idleCheckInterval, until the server is shut down
+func (s *Server) closeIdleClients() {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case now := <-ticker.C:
+			timeout := s.ClientTimeout()
+			if timeout <= 0 {
+				continue
+			}
+
+			closed, _ := s.killClients(nil, func(client *connState) bool { return client.isIdle(now, timeout) })
+			if closed > 0 {
+				log.Debugf("Closed %d idle clients", closed)
+			}
+		}
+	}
+}
+
+// info returns client description in CLIENT LIST format
+func (cs *connState) info(now time.Time) string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	flags := "N"
+	if cs.isSubscriber {
+		flags = "P"
+	}
+
+	return fmt.Sprintf(
+		"id=%d addr=%s name=%s age=%d idle=%d flags=%s cmd=%s lib-name=%s lib-ver=%s",
+		cs.id,
+		cs.addr,
+		cs.name,
+		int(now.Sub(cs.createdAt)/time.Second),
+		int(now.Sub(cs.lastInteraction)/time.Second),
+		flags,
+		strings.ToLower(cs.lastCmd),
+		cs.libName,
+		cs.libVer,
+	)
+}
+
+// isClientInfoValue returns true, if value could be a field of CLIENT LIST output: client name, library name or version
+func isClientInfoValue(value []byte) bool {
+	return bytes.IndexFunc(value, func(r rune) bool { return r <= ' ' || r > '~' }) < 0
+}
@@ -0,0 +1,129 @@
+package resp
+
+import (
+	"github.com/mshaverdo/radish/api"
+	"github.com/mshaverdo/radish/message"
+	"github.com/tidwall/redcon"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// connState holds state of the client connection between requests
+type connState struct {
+	// isMulti is true between MULTI and EXEC/DISCARD
+	isMulti bool
+	// queue contains requests, queued by MULTI
+	queue []*message.Request
+	// isMultiFailed is true, if a request was rejected while queued by MULTI, so EXEC discards the transaction
+	isMultiFailed bool
+	// watched contains key/version pairs of keys, watched by WATCH
+	watched [][]byte
+	// resp3 is true, if the client switched to RESP3 protocol by HELLO 3
+	resp3 bool
+	// rateLimiter limits rate of commands of the client
+	rateLimiter api.RateLimiter
+	// walDirty is true, if the client sent a modifying request after walIssuedId was resolved
+	walDirty bool
+	// walIssuedId is id of the last WAL message, that covers modifying requests of the client, resolved by WAITWAL
+	walIssuedId int64
+	// walFailures is count of failed pipelined writes of all clients, seen by the client when walIssuedId was resolved.
+	// If it grew since, pipelined writes of the client may be lost. walTracked is true, once walFailures is initialized
+	walFailures int64
+	walTracked  bool
+
+	// id, addr and createdAt identify the client in CLIENT LIST
+	id        int64
+	addr      string
+	createdAt time.Time
+	// netConn is closed by CLIENT KILL, issued by another client
+	netConn net.Conn
+
+	// mu guards fields below, that are read by CLIENT LIST of other clients
+	mu sync.Mutex
+	// name is set by CLIENT SETNAME
+	name string
+	// libName and libVer are set by CLIENT SETINFO, that client libraries send on connect
+	libName, libVer string
+	// lastCmd is the last command of the client and lastInteraction is time of it
+	lastCmd         string
+	lastInteraction time.Time
+	// isSubscriber is true, if the connection is detached and served as subscriber
+	isSubscriber bool
+	// isProcessing is true, while commands of the client are processed
+	isProcessing bool
+}
+
+func newConnState(id int64, conn redcon.Conn) *connState {
+	now := time.Now()
+	return &connState{
+		id:              id,
+		addr:            conn.RemoteAddr(),
+		createdAt:       now,
+		netConn:         conn.NetConn(),
+		lastInteraction: now,
+	}
+}
+
+// getConnState returns state of the conn, creating it on the first call
+func getConnState(conn redcon.Conn) *connState {
+	if state, ok := conn.Context().(*connState); ok {
+		return state
+	}
+
+	state := &connState{addr: conn.RemoteAddr(), createdAt: time.Now()}
+	conn.SetContext(state)
+	return state
+}
+
+// touch remembers the command as the last command of the client
+func (cs *connState) touch(cmd string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.lastCmd = cmd
+	cs.lastInteraction = time.Now()
+}
+
+// setProcessing marks the client as processing commands. Idle time of the client is counted from the end of processing
+func (cs *connState) setProcessing(processing bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.isProcessing = processing
+	cs.lastInteraction = time.Now()
+}
+
+// isIdle returns true, if the client hasn't sent a command longer than timeout.
+// Like in Redis, subscribers are never idle, as well as clients, processing slow commands
+func (cs *connState) isIdle(now time.Time, timeout time.Duration) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return !cs.isSubscriber && !cs.isProcessing && now.Sub(cs.lastInteraction) > timeout
+}
+
+// resetMulti leaves MULTI mode, discards all queued requests and unwatches all keys
+func (cs *connState) resetMulti() {
+	cs.isMulti = false
+	cs.isMultiFailed = false
+	cs.queue = nil
+	cs.watched = nil
+}
+
+// reset returns the connection into the initial state by RESET command: leaves MULTI mode, unwatches all keys
+// and switches protocol back to RESP2. Client name and subscriptions aren't reset here
+func (cs *connState) reset() {
+	cs.resetMulti()
+	cs.resp3 = false
+}
+
+// writeMapHeader writes header of the map reply with count key/value pairs: native map in RESP3 or flat array in RESP2
+func writeMapHeader(conn redcon.Conn, count int) {
+	if getConnState(conn).resp3 {
+		conn.WriteRaw([]byte("%" + strconv.Itoa(count) + "\r\n"))
+	} else {
+		conn.WriteArray(2 * count)
+	}
+}
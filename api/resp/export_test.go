@@ -0,0 +1,31 @@
+package resp
+
+import (
+	"github.com/mshaverdo/radish/message"
+	"github.com/tidwall/redcon"
+)
+
+func SendResponse(response message.Response, conn redcon.Conn) error {
+	return sendResponse(response, conn)
+}
+
+type PubSub = pubSub
+
+func NewPubSub() *PubSub {
+	return newPubSub()
+}
+
+// Subscribe registers detached connection as a subscriber of the channel
+func (ps *pubSub) Subscribe(conn redcon.DetachedConn, channel string) {
+	sub := newSubscriber(conn)
+	ps.addSubscriber(sub)
+	ps.subscribe(sub, channel)
+}
+
+func (ps *pubSub) Publish(channel string, message []byte) int {
+	return ps.publish(channel, message)
+}
+
+func (ps *pubSub) CloseAll() {
+	ps.closeAll()
+}
@@ -0,0 +1,47 @@
+package resp
+
+import (
+	"fmt"
+	"github.com/tidwall/redcon"
+	"strconv"
+)
+
+// handleHello processes HELLO [protover] command: switches protocol of the connection to RESP2 or RESP3
+// and replies with server properties. In RESP3, only map replies differ from RESP2 ones
+func handleHello(conn redcon.Conn, args [][]byte) {
+	state := getConnState(conn)
+
+	protocol := 2
+	if state.resp3 {
+		protocol = 3
+	}
+
+	if len(args) > 0 {
+		version, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			conn.WriteError("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if version != 2 && version != 3 {
+			conn.WriteError("NOPROTO unsupported protocol version")
+			return
+		}
+		protocol = version
+	}
+	if len(args) > 1 {
+		conn.WriteError(fmt.Sprintf("ERR Syntax error in HELLO option '%s'", args[1]))
+		return
+	}
+
+	state.resp3 = protocol == 3
+
+	writeMapHeader(conn, 4)
+	conn.WriteBulkString("server")
+	conn.WriteBulkString("radish")
+	conn.WriteBulkString("proto")
+	conn.WriteInt(protocol)
+	conn.WriteBulkString("mode")
+	conn.WriteBulkString("standalone")
+	conn.WriteBulkString("role")
+	conn.WriteBulkString("master")
+}
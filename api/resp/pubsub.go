@@ -0,0 +1,473 @@
+package resp
+
+import (
+	"errors"
+	"github.com/mshaverdo/radish/api"
+	"github.com/mshaverdo/radish/glob"
+	"github.com/mshaverdo/radish/log"
+	"github.com/tidwall/redcon"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errSubscriberClosed = errors.New("subscriber closed")
+
+// subscriberWriteTimeout limits writing to a subscriber, so a subscriber, that stopped reading, doesn't block publishers forever.
+// Such subscriber is disconnected
+const subscriberWriteTimeout = 10 * time.Second
+
+// subscriber is a detached client connection, that may receive messages from publishers concurrently
+type subscriber struct {
+	// mu guards writes to conn. Neither pubSub nor request handlers are invoked under it
+	mu   sync.Mutex
+	conn redcon.DetachedConn
+	// closed is 1, when conn is closed, so publishers skip the subscriber. Accessed atomically
+	closed uint32
+	// channels and patterns are changed only by the goroutine, serving the connection, under pubSub.mu
+	channels map[string]bool
+	patterns map[string]bool
+}
+
+func newSubscriber(conn redcon.DetachedConn) *subscriber {
+	return &subscriber{
+		conn:     conn,
+		channels: make(map[string]bool),
+		patterns: make(map[string]bool),
+	}
+}
+
+// subscriptionsCount returns count of channels and patterns the subscriber subscribed to
+func (sub *subscriber) subscriptionsCount() int {
+	return len(sub.channels) + len(sub.patterns)
+}
+
+// close closes net.Conn of the subscriber. It doesn't wait for sub.mu, so writers, blocked by the subscriber, are released
+func (sub *subscriber) close() {
+	if atomic.CompareAndSwapUint32(&sub.closed, 0, 1) {
+		// closing of net.Conn is safe from any goroutine, the connection goroutine gets read error and exits
+		sub.conn.NetConn().Close()
+	}
+}
+
+// isClosed returns true, if conn of the subscriber is closed
+func (sub *subscriber) isClosed() bool {
+	return atomic.LoadUint32(&sub.closed) == 1
+}
+
+// flush sends written data to the subscriber and closes it on failure. MUST be invoked only while sub.mu locked!
+func (sub *subscriber) flush() error {
+	sub.conn.NetConn().SetWriteDeadline(time.Now().Add(subscriberWriteTimeout))
+	err := sub.conn.Flush()
+	if err != nil {
+		log.Debugf("Unable to write to subscriber %s: %s", sub.conn.RemoteAddr(), err)
+		sub.close()
+	}
+
+	return err
+}
+
+// writeMessage sends message to the subscriber
+func (sub *subscriber) writeMessage(channel string, message []byte) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.isClosed() {
+		return
+	}
+
+	sub.conn.WriteArray(3)
+	sub.conn.WriteBulkString("message")
+	sub.conn.WriteBulkString(channel)
+	sub.conn.WriteBulk(message)
+	sub.flush()
+}
+
+// writePatternMessage sends message, matched by pattern subscription, to the subscriber
+func (sub *subscriber) writePatternMessage(pattern, channel string, message []byte) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.isClosed() {
+		return
+	}
+
+	sub.conn.WriteArray(4)
+	sub.conn.WriteBulkString("pmessage")
+	sub.conn.WriteBulkString(pattern)
+	sub.conn.WriteBulkString(channel)
+	sub.conn.WriteBulk(message)
+	sub.flush()
+}
+
+// writeReply moves replies, buffered by reply, to the conn, after messages, already written by publishers.
+// If flush is true, they are sent to the subscriber
+func (sub *subscriber) writeReply(reply *replyConn, flush bool) error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.isClosed() {
+		return errSubscriberClosed
+	}
+
+	sub.conn.WriteRaw(reply.wr.Buffer())
+	reply.wr.SetBuffer(nil)
+	if !flush {
+		return nil
+	}
+
+	return sub.flush()
+}
+
+// replyConn buffers replies to the subscriber, so commands are processed without sub.mu, concurrently with publishers,
+// and replies are written to the conn by subscriber.writeReply
+type replyConn struct {
+	redcon.DetachedConn
+	wr *redcon.Writer
+	// closing is true, if the connection must be closed after the reply, e.g. by QUIT
+	closing bool
+}
+
+func newReplyConn(sub *subscriber) *replyConn {
+	return &replyConn{DetachedConn: sub.conn, wr: redcon.NewWriter(nil)}
+}
+
+func (c *replyConn) WriteError(msg string)       { c.wr.WriteError(msg) }
+func (c *replyConn) WriteString(str string)      { c.wr.WriteString(str) }
+func (c *replyConn) WriteBulk(bulk []byte)       { c.wr.WriteBulk(bulk) }
+func (c *replyConn) WriteBulkString(bulk string) { c.wr.WriteBulkString(bulk) }
+func (c *replyConn) WriteInt(num int)            { c.wr.WriteInt(num) }
+func (c *replyConn) WriteInt64(num int64)        { c.wr.WriteInt64(num) }
+func (c *replyConn) WriteArray(count int)        { c.wr.WriteArray(count) }
+func (c *replyConn) WriteNull()                  { c.wr.WriteNull() }
+func (c *replyConn) WriteRaw(data []byte)        { c.wr.WriteRaw(data) }
+
+// Close marks the connection to close it after the reply is sent
+func (c *replyConn) Close() error {
+	c.closing = true
+	return nil
+}
+
+// writeSubscription writes subscribe/unsubscribe confirmation with count of subscriptions after it
+func (c *replyConn) writeSubscription(kind string, channel []byte, count int) {
+	c.WriteArray(3)
+	c.WriteBulkString(kind)
+	if channel == nil {
+		c.WriteNull()
+	} else {
+		c.WriteBulk(channel)
+	}
+	c.WriteInt(count)
+}
+
+// pubSub is a registry of channels, patterns and subscribed connections
+type pubSub struct {
+	mu          sync.RWMutex
+	channels    map[string]map[*subscriber]bool
+	patterns    map[string]map[*subscriber]bool
+	subscribers map[*subscriber]bool
+}
+
+// patternReceiver is a subscriber matched to published channel by pattern
+type patternReceiver struct {
+	sub     *subscriber
+	pattern string
+}
+
+func newPubSub() *pubSub {
+	return &pubSub{
+		channels:    make(map[string]map[*subscriber]bool),
+		patterns:    make(map[string]map[*subscriber]bool),
+		subscribers: make(map[*subscriber]bool),
+	}
+}
+
+// addSubscriber registers detached connection to close it on shutdown
+func (ps *pubSub) addSubscriber(sub *subscriber) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.subscribers[sub] = true
+}
+
+// removeSubscriber unsubscribes sub from all channels and patterns and removes it from registry
+func (ps *pubSub) removeSubscriber(sub *subscriber) {
+	ps.unsubscribeAll(sub)
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	delete(ps.subscribers, sub)
+}
+
+// unsubscribeAll unsubscribes sub from all channels and patterns silently
+func (ps *pubSub) unsubscribeAll(sub *subscriber) {
+	for channel := range sub.channels {
+		ps.unsubscribe(sub, channel)
+	}
+	for pattern := range sub.patterns {
+		ps.punsubscribe(sub, pattern)
+	}
+}
+
+func (ps *pubSub) subscribe(sub *subscriber, channel string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.channels[channel] == nil {
+		ps.channels[channel] = make(map[*subscriber]bool)
+	}
+	ps.channels[channel][sub] = true
+	sub.channels[channel] = true
+}
+
+func (ps *pubSub) unsubscribe(sub *subscriber, channel string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	delete(ps.channels[channel], sub)
+	if len(ps.channels[channel]) == 0 {
+		delete(ps.channels, channel)
+	}
+	delete(sub.channels, channel)
+}
+
+func (ps *pubSub) psubscribe(sub *subscriber, pattern string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.patterns[pattern] == nil {
+		ps.patterns[pattern] = make(map[*subscriber]bool)
+	}
+	ps.patterns[pattern][sub] = true
+	sub.patterns[pattern] = true
+}
+
+func (ps *pubSub) punsubscribe(sub *subscriber, pattern string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	delete(ps.patterns[pattern], sub)
+	if len(ps.patterns[pattern]) == 0 {
+		delete(ps.patterns, pattern)
+	}
+	delete(sub.patterns, pattern)
+}
+
+// publish sends message to all subscribers of the channel and of matching patterns
+// and returns count of deliveries
+func (ps *pubSub) publish(channel string, message []byte) (count int) {
+	ps.mu.RLock()
+	receivers := make([]*subscriber, 0, len(ps.channels[channel]))
+	for sub := range ps.channels[channel] {
+		receivers = append(receivers, sub)
+	}
+	var patternReceivers []patternReceiver
+	for pattern, subs := range ps.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+		for sub := range subs {
+			patternReceivers = append(patternReceivers, patternReceiver{sub, pattern})
+		}
+	}
+	ps.mu.RUnlock()
+
+	// don't hold registry lock while writing to slow subscribers
+	for _, sub := range receivers {
+		sub.writeMessage(channel, message)
+	}
+	for _, r := range patternReceivers {
+		r.sub.writePatternMessage(r.pattern, channel, message)
+	}
+
+	return len(receivers) + len(patternReceivers)
+}
+
+// closeAll closes connections of all subscribers
+func (ps *pubSub) closeAll() {
+	ps.mu.RLock()
+	subscribers := make([]*subscriber, 0, len(ps.subscribers))
+	for sub := range ps.subscribers {
+		subscribers = append(subscribers, sub)
+	}
+	ps.mu.RUnlock()
+
+	for _, sub := range subscribers {
+		sub.close()
+	}
+}
+
+// isSubscribeCommand returns true, if the command switches connection into subscriber mode
+func isSubscribeCommand(command redcon.Command) bool {
+	if len(command.Args) == 0 {
+		return false
+	}
+
+	cmd := strings.ToUpper(string(command.Args[0]))
+	return cmd == "SUBSCRIBE" || cmd == "PSUBSCRIBE"
+}
+
+// startSubscriber detaches the connection, processes the subscribe command and rest of pipelined commands
+// and continues serving the connection in a separate goroutine
+func (s *Server) startSubscriber(conn redcon.Conn, command redcon.Command, pipelineCommands []redcon.Command) {
+	// detached connection stays in CLIENT LIST until it's closed
+	state := getConnState(conn)
+	state.mu.Lock()
+	state.isSubscriber = true
+	state.mu.Unlock()
+
+	sub := newSubscriber(conn.Detach())
+	s.pubSub.addSubscriber(sub)
+
+	reply := newReplyConn(sub)
+	s.processSubscriberCommand(sub, reply, command)
+	for _, c := range pipelineCommands {
+		if reply.closing {
+			break
+		}
+		s.processSubscriberCommand(sub, reply, c)
+	}
+
+	if err := sub.writeReply(reply, true); err != nil || reply.closing {
+		s.pubSub.removeSubscriber(sub)
+		s.clients.remove(state)
+		sub.close()
+		return
+	}
+
+	go s.serveSubscriber(sub)
+}
+
+// serveSubscriber reads and processes commands of the detached connection until it closed
+func (s *Server) serveSubscriber(sub *subscriber) {
+	defer func() {
+		s.pubSub.removeSubscriber(sub)
+		s.clients.remove(getConnState(sub.conn))
+		sub.close()
+	}()
+
+	for {
+		command, err := sub.conn.ReadCommand()
+		if err != nil {
+			return
+		}
+
+		reply := newReplyConn(sub)
+		if s.isOversized(command) {
+			reply.WriteError("ERR Protocol error: request exceeds max-request-size")
+			reply.Close()
+		} else {
+			s.processSubscriberCommand(sub, reply, command)
+		}
+
+		if err := sub.writeReply(reply, true); err != nil || reply.closing {
+			return
+		}
+	}
+}
+
+// processSubscriberCommand handles command of the detached connection and writes replies into reply.
+// MUST NOT be invoked while sub.mu locked: it locks pubSub and handles regular requests, that may block.
+// While subscriber has subscriptions, only subscription-related commands allowed, like in Redis.
+// Without subscriptions, connection works as a regular one.
+func (s *Server) processSubscriberCommand(sub *subscriber, reply *replyConn, command redcon.Command) {
+	if len(command.Args) == 0 {
+		return
+	}
+
+	cmd, err := api.NormalizeCommandName(string(command.Args[0]))
+	if err != nil {
+		reply.WriteError("ERR " + err.Error())
+		return
+	}
+	getConnState(sub.conn).touch(cmd)
+
+	switch cmd {
+	case "SUBSCRIBE":
+		if len(command.Args) < 2 {
+			reply.WriteError("ERR wrong number of arguments for 'subscribe' command")
+			return
+		}
+		for _, channel := range command.Args[1:] {
+			count := sub.subscriptionsCount()
+			if !sub.channels[string(channel)] {
+				count++
+			}
+			// confirmation must precede messages of the channel, so it's moved to the conn before subscription
+			reply.writeSubscription("subscribe", channel, count)
+			sub.writeReply(reply, false)
+			s.pubSub.subscribe(sub, string(channel))
+		}
+	case "PSUBSCRIBE":
+		if len(command.Args) < 2 {
+			reply.WriteError("ERR wrong number of arguments for 'psubscribe' command")
+			return
+		}
+		for _, pattern := range command.Args[1:] {
+			count := sub.subscriptionsCount()
+			if !sub.patterns[string(pattern)] {
+				count++
+			}
+			reply.writeSubscription("psubscribe", pattern, count)
+			sub.writeReply(reply, false)
+			s.pubSub.psubscribe(sub, string(pattern))
+		}
+	case "UNSUBSCRIBE":
+		channels := command.Args[1:]
+		if len(channels) == 0 {
+			for channel := range sub.channels {
+				channels = append(channels, []byte(channel))
+			}
+		}
+		if len(channels) == 0 {
+			reply.writeSubscription("unsubscribe", nil, sub.subscriptionsCount())
+		}
+		for _, channel := range channels {
+			s.pubSub.unsubscribe(sub, string(channel))
+			reply.writeSubscription("unsubscribe", channel, sub.subscriptionsCount())
+		}
+	case "PUNSUBSCRIBE":
+		patterns := command.Args[1:]
+		if len(patterns) == 0 {
+			for pattern := range sub.patterns {
+				patterns = append(patterns, []byte(pattern))
+			}
+		}
+		if len(patterns) == 0 {
+			reply.writeSubscription("punsubscribe", nil, sub.subscriptionsCount())
+		}
+		for _, pattern := range patterns {
+			s.pubSub.punsubscribe(sub, string(pattern))
+			reply.writeSubscription("punsubscribe", pattern, sub.subscriptionsCount())
+		}
+	case "PING":
+		if sub.subscriptionsCount() == 0 {
+			s.processRequest(reply, command, false)
+			return
+		}
+		// in subscribed mode Redis replies to PING with a push-like array
+		reply.WriteArray(2)
+		reply.WriteBulkString("pong")
+		if len(command.Args) > 1 {
+			reply.WriteBulk(command.Args[1])
+		} else {
+			reply.WriteBulkString("")
+		}
+	case "QUIT":
+		s.processRequest(reply, command, false)
+	case "RESET":
+		// like in Redis, RESET leaves subscriber mode without unsubscribe confirmations
+		if len(command.Args) == 1 {
+			s.pubSub.unsubscribeAll(sub)
+		}
+		s.processRequest(reply, command, false)
+	default:
+		if sub.subscriptionsCount() > 0 {
+			reply.WriteError("ERR only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT allowed in this context")
+			return
+		}
+		s.processRequest(reply, command, false)
+	}
+}
@@ -0,0 +1,78 @@
+package resp_test
+
+import (
+	"github.com/mshaverdo/radish/api/resp"
+	"github.com/tidwall/redcon"
+	"net"
+	"testing"
+	"time"
+)
+
+// stuckConn is a detached connection of a subscriber, that doesn't read, so Flush blocks until the connection is closed
+type stuckConn struct {
+	redcon.DetachedConn
+	wr   *redcon.Writer
+	conn net.Conn
+}
+
+func newStuckConn() *stuckConn {
+	_, conn := net.Pipe()
+	return &stuckConn{wr: redcon.NewWriter(conn), conn: conn}
+}
+
+func (c *stuckConn) WriteBulk(bulk []byte)       { c.wr.WriteBulk(bulk) }
+func (c *stuckConn) WriteBulkString(bulk string) { c.wr.WriteBulkString(bulk) }
+func (c *stuckConn) WriteArray(count int)        { c.wr.WriteArray(count) }
+func (c *stuckConn) Flush() error                { return c.wr.Flush() }
+func (c *stuckConn) NetConn() net.Conn           { return c.conn }
+func (c *stuckConn) RemoteAddr() string          { return "stuck" }
+
+func TestPubSub_CloseStuckSubscriber(t *testing.T) {
+	ps := resp.NewPubSub()
+	ps.Subscribe(newStuckConn(), "channel")
+
+	published := make(chan int)
+	go func() {
+		published <- ps.Publish("channel", []byte("message"))
+	}()
+
+	select {
+	case <-published:
+		t.Fatalf("Publish(): got return before the subscriber is closed, want blocked write")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// closing doesn't wait for the blocked publisher, but releases it
+	closed := make(chan struct{})
+	go func() {
+		ps.CloseAll()
+		close(closed)
+	}()
+	for _, done := range []<-chan struct{}{closed, receive(published)} {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("CloseAll(): blocked by the subscriber, that doesn't read")
+		}
+	}
+
+	// closed subscriber is skipped by publishers without blocking
+	go func() {
+		published <- ps.Publish("channel", []byte("message"))
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatalf("Publish(): blocked by the closed subscriber")
+	}
+}
+
+// receive returns a channel, that is closed, when a value is received from c
+func receive(c <-chan int) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		<-c
+		close(done)
+	}()
+	return done
+}
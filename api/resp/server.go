@@ -6,7 +6,9 @@ import (
 	"github.com/mshaverdo/radish/log"
 	"github.com/mshaverdo/radish/message"
 	"github.com/tidwall/redcon"
-	"strings"
+	"strconv"
+	"sync/atomic"
+	"time"
 )
 
 type Server struct {
@@ -15,6 +17,15 @@ type Server struct {
 	server         *redcon.Server
 	messageHandler api.MessageHandler
 	stopChan       chan struct{}
+	pubSub         *pubSub
+	clients        *clientRegistry
+
+	// maxRequestSize is a limit of total size of command arguments, zero means unlimited. Accessed atomically
+	maxRequestSize int64
+	// clientTimeout is a time.Duration, after which idle clients are closed, zero means never. Accessed atomically
+	clientTimeout int64
+	// clientRateLimit is a limit of commands per second of a single client, zero means unlimited. Accessed atomically
+	clientRateLimit int64
 }
 
 // NewServer Returns new instance of Server
@@ -22,6 +33,9 @@ func NewServer(host string, port int, messageHandler api.MessageHandler) *Server
 	s := Server{
 		messageHandler: messageHandler,
 		stopChan:       make(chan struct{}),
+		pubSub:         newPubSub(),
+		clients:        newClientRegistry(),
+		maxRequestSize: api.DefaultMaxRequestSize,
 		host:           host,
 		port:           port,
 	}
@@ -30,8 +44,8 @@ func NewServer(host string, port int, messageHandler api.MessageHandler) *Server
 		"tcp",
 		fmt.Sprintf("%s:%d", s.host, s.port),
 		s.handler,
-		nil, //func(conn redcon.Conn) bool { return true },
-		nil,
+		s.clients.accept,
+		s.clients.closed,
 	)
 
 	return &s
@@ -39,6 +53,8 @@ func NewServer(host string, port int, messageHandler api.MessageHandler) *Server
 
 // ListenAndServe statrs listening to incoming connections
 func (s *Server) ListenAndServe() error {
+	go s.closeIdleClients()
+
 	err := s.server.ListenAndServe()
 
 	if err == nil {
@@ -51,7 +67,10 @@ func (s *Server) ListenAndServe() error {
 
 // Stops accepting new requests by Resp server, but not causes return from ListenAndServe() until Shutdown()
 func (s *Server) Stop() error {
-	return s.server.Close()
+	err := s.server.Close()
+	// detached subscribers aren't tracked by redcon, so close them manually
+	s.pubSub.closeAll()
+	return err
 }
 
 // Shutdown gracefully shuts server down
@@ -60,12 +79,79 @@ func (s *Server) Shutdown() error {
 	return s.Stop()
 }
 
+// SetMaxRequestSize sets limit of total size of command arguments in bytes, zero disables the limit.
+// redcon has no own limit and buffers the whole command before the check, so the limit doesn't bound memory,
+// taken by a single oversized command, but such command is rejected and the connection is closed
+func (s *Server) SetMaxRequestSize(size int64) {
+	atomic.StoreInt64(&s.maxRequestSize, size)
+}
+
+// MaxRequestSize returns limit of total size of command arguments, zero if unlimited
+func (s *Server) MaxRequestSize() int64 {
+	return atomic.LoadInt64(&s.maxRequestSize)
+}
+
+// SetClientTimeout sets time, after which connections of clients, that haven't sent a command, are closed.
+// Zero disables the timeout
+func (s *Server) SetClientTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&s.clientTimeout, int64(timeout))
+}
+
+// ClientTimeout returns time, after which idle clients are closed, zero if they are never closed
+func (s *Server) ClientTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.clientTimeout))
+}
+
+// SetClientRateLimit sets limit of commands per second of a single connection, zero disables the limit.
+// Commands over the limit are rejected with an error
+func (s *Server) SetClientRateLimit(rate int) {
+	atomic.StoreInt64(&s.clientRateLimit, int64(rate))
+}
+
+// ClientRateLimit returns limit of commands per second of a single connection, zero if unlimited
+func (s *Server) ClientRateLimit() int {
+	return int(atomic.LoadInt64(&s.clientRateLimit))
+}
+
+// isOversized returns true, if total size of command arguments exceeds the limit
+func (s *Server) isOversized(command redcon.Command) bool {
+	limit := s.MaxRequestSize()
+	if limit <= 0 {
+		return false
+	}
+
+	size := int64(0)
+	for _, arg := range command.Args {
+		size += int64(len(arg))
+	}
+
+	return size > limit
+}
+
+// Publish sends message to all subscribers of the channel and returns count of receivers
+func (s *Server) Publish(channel string, message []byte) (count int) {
+	return s.pubSub.publish(channel, message)
+}
+
 func (s *Server) handler(conn redcon.Conn, command redcon.Command) {
+	state := getConnState(conn)
+	state.setProcessing(true)
+	defer state.setProcessing(false)
+
 	pipelineCommands := conn.ReadPipeline()
 	unreliable := len(pipelineCommands) > 0
 
+	if isSubscribeCommand(command) && !getConnState(conn).isMulti {
+		s.startSubscriber(conn, command, pipelineCommands)
+		return
+	}
 	s.processRequest(conn, command, unreliable)
-	for _, c := range pipelineCommands {
+
+	for i, c := range pipelineCommands {
+		if isSubscribeCommand(c) && !getConnState(conn).isMulti {
+			s.startSubscriber(conn, c, pipelineCommands[i+1:])
+			return
+		}
 		s.processRequest(conn, c, unreliable)
 	}
 }
@@ -77,33 +163,225 @@ func (s *Server) processRequest(conn redcon.Conn, command redcon.Command, unreli
 		return
 	}
 
-	cmd := strings.ToUpper(string(command.Args[0]))
+	if s.isOversized(command) {
+		// the client is likely to send more garbage, so don't wait for it
+		conn.WriteError("ERR Protocol error: request exceeds max-request-size")
+		conn.Close()
+		return
+	}
+
+	cmd, err := api.NormalizeCommandName(string(command.Args[0]))
+	if err != nil {
+		conn.WriteError("ERR " + err.Error())
+		return
+	}
+	state := getConnState(conn)
+	state.touch(cmd)
+
+	if !state.rateLimiter.Allow(s.ClientRateLimit()) {
+		conn.WriteError("ERR " + api.ErrRateLimitExceeded.Error())
+		return
+	}
+
 	// handle some RESP-level service commands here
 	switch cmd {
 	case "PING":
 		conn.WriteString("PONG")
 		return
+	case "HELLO":
+		handleHello(conn, command.Args[1:])
+		return
+	case "CLIENT":
+		s.handleClient(conn, command.Args[1:])
+		return
 	case "QUIT":
 		conn.WriteString("OK")
 		conn.Close()
 		return
+	case "RESET":
+		if argsCount != 1 {
+			conn.WriteError("ERR wrong number of arguments for 'reset' command")
+		} else {
+			getConnState(conn).reset()
+			conn.WriteString("RESET")
+		}
+		return
+	case "SELECT":
+		handleSelect(conn, command.Args[1:])
+		return
+	case "WAITWAL":
+		s.handleWaitWal(conn, command.Args[1:])
+		return
+	case "PUBLISH":
+		if argsCount != 3 {
+			conn.WriteError("ERR wrong number of arguments for 'publish' command")
+		} else {
+			conn.WriteInt(s.pubSub.publish(string(command.Args[1]), command.Args[2]))
+		}
+		return
 	}
 
-	//log.Debugf("Received request: %q", command.Args)
+	requestLog := api.NewRequestLog()
+	requestLog.Debugf(nil, "Received request: %q", command.Args)
 
 	request := message.NewRequest(cmd, command.Args[1:])
 	request.Unreliable = unreliable
 
-	//log.Debugf("Handling request: %s", request)
+	request, ok := s.processTransactionCommand(conn, request)
+	if !ok {
+		// request handled or queued
+		return
+	}
+
+	waiter, isWaiter := s.messageHandler.(api.WalWaiter)
+	if isWaiter && !state.walTracked {
+		// failures before the first request of the client aren't failures of its writes
+		state.walFailures, state.walTracked = waiter.WalFailures(), true
+	}
+	if isWaiter && request.Cmd == "WAIT" {
+		// WAIT syncs writes of all clients, but only the client, that pipelined lost writes, should get an error
+		if err := resolveWalIssuedId(state, waiter); err != nil {
+			conn.WriteError("ERR " + err.Error())
+			return
+		}
+	}
+
+	requestLog.Debugf(request, "Handling request: %q", request.Args)
 
-	response := s.messageHandler.HandleMessage(request)
+	var response message.Response
+	if request.Cmd == message.CmdExec {
+		// transactions are packed by processTransactionCommand only
+		handler, ok := s.messageHandler.(api.TransactionHandler)
+		if !ok {
+			conn.WriteError("ERR transactions aren't supported")
+			return
+		}
+		response = handler.HandleTransaction(request)
+	} else {
+		response = s.messageHandler.HandleMessage(request)
+	}
+	if isWaiter && waiter.IsModifyingRequest(request) {
+		state.walDirty = true
+	}
 
-	//log.Debugf("Sending response: %s", response)
+	requestLog.Debugf(request, "Sending response: status %d", response.Status())
 
-	err := sendResponse(response, conn)
+	err = sendResponse(response, conn)
 	if err != nil {
-		log.Errorf("Sending response failed: %s", err)
+		log.WithFields(log.Fields{"cmd": request.Cmd, "client": conn.RemoteAddr()}).Errorf("Sending response failed: %s", err)
+	}
+}
+
+// handleSelect accepts SELECT 0 as a no-op for clients, that select database on connect:
+// Radish has the only database, so any other index is out of range
+func handleSelect(conn redcon.Conn, args [][]byte) {
+	if len(args) != 1 {
+		conn.WriteError("ERR wrong number of arguments for 'select' command")
+		return
+	}
+
+	index, err := strconv.Atoi(string(args[0]))
+	switch {
+	case err != nil:
+		conn.WriteError("ERR value is not an integer or out of range")
+	case index != 0:
+		conn.WriteError("ERR DB index is out of range")
+	default:
+		conn.WriteString("OK")
+	}
+}
+
+// processTransactionCommand handles MULTI, EXEC, DISCARD, WATCH, UNWATCH and queues requests inside MULTI.
+// returns false, if request is already handled, or request to pass to messageHandler and true otherwise
+func (s *Server) processTransactionCommand(conn redcon.Conn, request *message.Request) (*message.Request, bool) {
+	state := getConnState(conn)
+
+	switch request.Cmd {
+	case "MULTI":
+		if state.isMulti {
+			conn.WriteError("ERR MULTI calls can not be nested")
+		} else {
+			state.isMulti = true
+			conn.WriteString("OK")
+		}
+		return nil, false
+	case "DISCARD":
+		if state.isMulti {
+			state.resetMulti()
+			conn.WriteString("OK")
+		} else {
+			conn.WriteError("ERR DISCARD without MULTI")
+		}
+		return nil, false
+	case message.CmdExec:
+		if !state.isMulti {
+			conn.WriteError("ERR EXEC without MULTI")
+			return nil, false
+		}
+		if state.isMultiFailed {
+			state.resetMulti()
+			conn.WriteError("EXECABORT Transaction discarded because of previous errors.")
+			return nil, false
+		}
+
+		queue := state.queue
+		if len(state.watched) > 0 {
+			queue = append([]*message.Request{message.NewRequest(message.CmdWatch, state.watched)}, queue...)
+		}
+
+		transaction, err := message.NewRequestTransaction(queue)
+		state.resetMulti()
+		if err != nil {
+			conn.WriteError("ERR " + err.Error())
+			return nil, false
+		}
+
+		transaction.Unreliable = request.Unreliable
+		return transaction, true
+	case message.CmdWatch:
+		if state.isMulti {
+			conn.WriteError("ERR WATCH inside MULTI is not allowed")
+			return nil, false
+		}
+
+		response := s.messageHandler.HandleMessage(request)
+		versions, ok := response.(*message.ResponseStringSlice)
+		if !ok || len(versions.Payload()) != len(request.Args) {
+			if err := sendResponse(response, conn); err != nil {
+				log.WithFields(log.Fields{"cmd": request.Cmd, "client": conn.RemoteAddr()}).Errorf("Sending response failed: %s", err)
+			}
+			return nil, false
+		}
+
+		for i, key := range request.Args {
+			state.watched = append(state.watched, key, versions.Payload()[i])
+		}
+		conn.WriteString("OK")
+		return nil, false
+	case "UNWATCH":
+		state.watched = nil
+		conn.WriteString("OK")
+		return nil, false
+	}
+
+	if state.isMulti {
+		if checker, ok := s.messageHandler.(api.TransactionChecker); ok {
+			if response := checker.CheckQueuedRequest(request); response != nil {
+				// like in Redis, the error is replied immediately and the whole transaction is discarded by EXEC
+				state.isMultiFailed = true
+				if err := sendResponse(response, conn); err != nil {
+					log.WithFields(log.Fields{"cmd": request.Cmd, "client": conn.RemoteAddr()}).Errorf("Sending response failed: %s", err)
+				}
+				return nil, false
+			}
+		}
+
+		state.queue = append(state.queue, request)
+		conn.WriteString("QUEUED")
+		return nil, false
 	}
+
+	return request, true
 }
 
 func sendResponse(response message.Response, conn redcon.Conn) error {
@@ -111,11 +389,19 @@ func sendResponse(response message.Response, conn redcon.Conn) error {
 	case *message.ResponseStatus:
 		switch concreteResponse.Status() {
 		case message.StatusOk:
-			conn.WriteString("OK")
+			conn.WriteString(statusPayload(concreteResponse))
 		case message.StatusNotFound:
 			conn.WriteNull()
 		case message.StatusTypeMismatch:
 			conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		case message.StatusNoScript:
+			conn.WriteError("NOSCRIPT " + concreteResponse.Payload())
+		case message.StatusReadOnly:
+			conn.WriteError("READONLY " + concreteResponse.Payload())
+		case message.StatusBusyKey:
+			conn.WriteError("BUSYKEY " + concreteResponse.Payload())
+		case message.StatusMisconf:
+			conn.WriteError("MISCONF " + concreteResponse.Payload())
 		default:
 			conn.WriteError("ERR " + concreteResponse.Payload())
 		}
@@ -126,11 +412,56 @@ func sendResponse(response message.Response, conn redcon.Conn) error {
 		for _, v := range concreteResponse.Payload() {
 			conn.WriteBulk(v)
 		}
+	case *message.ResponseStringStream:
+		concreteResponse.Stream(func(count int, forEach func(yield func(value []byte))) {
+			conn.WriteArray(count)
+			forEach(conn.WriteBulk)
+		})
+	case *message.ResponseStringMap:
+		concreteResponse.Stream(func(count int, forEach func(yield func(value []byte))) {
+			writeMapHeader(conn, count)
+			forEach(conn.WriteBulk)
+		})
+	case *message.ResponseNullableStringSlice:
+		conn.WriteArray(len(concreteResponse.Payload()))
+		for i, v := range concreteResponse.Payload() {
+			if concreteResponse.IsNull(i) {
+				conn.WriteNull()
+			} else {
+				conn.WriteBulk(v)
+			}
+		}
 	case *message.ResponseInt:
-		conn.WriteInt(concreteResponse.Payload())
+		conn.WriteInt64(concreteResponse.Payload())
+	case *message.ResponseIntSlice:
+		conn.WriteArray(len(concreteResponse.Payload()))
+		for i, v := range concreteResponse.Payload() {
+			if concreteResponse.IsNull(i) {
+				conn.WriteNull()
+			} else {
+				conn.WriteInt64(v)
+			}
+		}
+	case *message.ResponseArray:
+		conn.WriteArray(len(concreteResponse.Payload()))
+		for _, v := range concreteResponse.Payload() {
+			if err := sendResponse(v, conn); err != nil {
+				return err
+			}
+		}
 	default:
 		return fmt.Errorf("unknown response type: %T", response)
 	}
 
 	return nil
 }
+
+// statusPayload returns payload of successful status response, that should be sent as simple string reply.
+// Empty payload means just "OK"
+func statusPayload(response *message.ResponseStatus) string {
+	if response.Payload() == "" {
+		return "OK"
+	}
+
+	return response.Payload()
+}
@@ -0,0 +1,62 @@
+package resp_test
+
+import (
+	"github.com/mshaverdo/radish/api/resp"
+	"github.com/mshaverdo/radish/log"
+	"github.com/mshaverdo/radish/message"
+	"github.com/tidwall/redcon"
+	"testing"
+)
+
+func init() {
+	// set lowest log level to prevent test output pollution
+	log.SetLevel(log.CRITICAL)
+}
+
+// bufferConn is a redcon.Conn, that writes replies into the buffer
+type bufferConn struct {
+	redcon.Conn
+	*redcon.Writer
+}
+
+func (c bufferConn) WriteError(msg string)       { c.Writer.WriteError(msg) }
+func (c bufferConn) WriteString(str string)      { c.Writer.WriteString(str) }
+func (c bufferConn) WriteBulk(bulk []byte)       { c.Writer.WriteBulk(bulk) }
+func (c bufferConn) WriteBulkString(bulk string) { c.Writer.WriteBulkString(bulk) }
+func (c bufferConn) WriteInt(num int)            { c.Writer.WriteInt(num) }
+func (c bufferConn) WriteInt64(num int64)        { c.Writer.WriteInt64(num) }
+func (c bufferConn) WriteArray(count int)        { c.Writer.WriteArray(count) }
+func (c bufferConn) WriteNull()                  { c.Writer.WriteNull() }
+func (c bufferConn) WriteRaw(data []byte)        { c.Writer.WriteRaw(data) }
+func (c bufferConn) Context() interface{}        { return nil }
+
+func TestRespServer_SendResponse(t *testing.T) {
+	var tests = []struct {
+		response message.Response
+		want     string
+	}{
+		{message.NewResponseInt(message.StatusOk, 42), ":42\r\n"},
+		{message.NewResponseIntSlice(message.StatusOk, []int64{0, -1, 42}), "*3\r\n:0\r\n:-1\r\n:42\r\n"},
+		{message.NewResponseIntSlice(message.StatusOk, []int64{}), "*0\r\n"},
+		{
+			message.NewResponseStatus(message.StatusInvalidArguments, "wrong number of arguments for 'get' command"),
+			"-ERR wrong number of arguments for 'get' command\r\n",
+		},
+		{message.NewResponseNullableIntSlice(message.StatusOk, []*int64{nil, new(int64)}), "*2\r\n$-1\r\n:0\r\n"},
+		{
+			message.NewResponseNullableStringSlice(message.StatusOk, [][]byte{[]byte("a"), nil}),
+			"*2\r\n$1\r\na\r\n$-1\r\n",
+		},
+	}
+
+	for n, tst := range tests {
+		conn := bufferConn{Writer: redcon.NewWriter(nil)}
+		if err := resp.SendResponse(tst.response, conn); err != nil {
+			t.Errorf("testcase %d: SendResponse(): %s", n, err)
+			continue
+		}
+		if got := string(conn.Buffer()); got != tst.want {
+			t.Errorf("testcase %d: got %q, want %q", n, got, tst.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package resp
+
+import (
+	"github.com/mshaverdo/radish/api"
+	"github.com/tidwall/redcon"
+	"strconv"
+	"time"
+)
+
+// handleWaitWal processes WAITWAL timeout command: blocks until all previous modifying requests of the connection,
+// including pipelined ones, are synced to WAL, or timeout in milliseconds expires. Zero timeout means forever.
+// It replies with id of the last durable WAL message and id of the last WAL message, issued by the connection:
+// requests are durable, if the first id isn't less than the second one. Both ids are 0, if the server isn't persistent
+func (s *Server) handleWaitWal(conn redcon.Conn, args [][]byte) {
+	if len(args) != 1 {
+		conn.WriteError("ERR wrong number of arguments for 'waitwal' command")
+		return
+	}
+
+	timeout, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		conn.WriteError("ERR timeout is not an integer or out of range")
+		return
+	}
+	if timeout < 0 {
+		conn.WriteError("ERR timeout is negative")
+		return
+	}
+
+	waiter, ok := s.messageHandler.(api.WalWaiter)
+	if !ok {
+		conn.WriteError("ERR WAITWAL isn't supported by the server")
+		return
+	}
+
+	state := getConnState(conn)
+	if err := resolveWalIssuedId(state, waiter); err != nil {
+		conn.WriteError("ERR " + err.Error())
+		return
+	}
+
+	syncedId, err := waiter.WaitWalSynced(state.walIssuedId, time.Duration(timeout)*time.Millisecond)
+	if err != nil {
+		conn.WriteError("ERR " + err.Error())
+		return
+	}
+
+	conn.WriteArray(2)
+	conn.WriteInt64(syncedId)
+	conn.WriteInt64(state.walIssuedId)
+}
+
+// resolveWalIssuedId resolves id of the last WAL message, that covers modifying requests of the connection,
+// if it sent any since the previous call. Pipelined requests are written into WAL in background,
+// so their ids are resolved by a marker, queued after them. It returns api.ErrAsyncWriteFailed,
+// if any of pipelined writes failed since the previous call: acknowledged writes of the connection may be lost
+func resolveWalIssuedId(state *connState, waiter api.WalWaiter) error {
+	if !state.walDirty {
+		return nil
+	}
+
+	issuedId, failures, err := waiter.WalIssuedId()
+	if err != nil {
+		return err
+	}
+	state.walIssuedId, state.walDirty = issuedId, false
+
+	if failures != state.walFailures {
+		state.walFailures = failures
+		return api.ErrAsyncWriteFailed
+	}
+
+	return nil
+}
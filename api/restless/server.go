@@ -11,14 +11,29 @@ import (
 	"io"
 	"io/ioutil"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/textproto"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// idleCheckInterval is a period of checks of idle connections
+const idleCheckInterval = time.Second
+
+// maxClientsResponse is a raw HTTP response to connections over the limit, that are rejected before reading a request
+const maxClientsResponse = "HTTP/1.1 503 Service Unavailable\r\nConnection: close\r\nContent-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Length: 31\r\n\r\nmax number of clients reached\r\n"
+
 const (
 	StatusHeader = "X-Radish-Status"
+	// NullPartHeader marks part of multipart response, that represents null element, to distinguish it from empty string
+	NullPartHeader = "X-Radish-Null"
+	HealthPath     = "/health"
 )
 
 // Server is a implementation of Server interface
@@ -26,8 +41,29 @@ type Server struct {
 	http.Server
 	messageHandler api.MessageHandler
 	stopChan       chan struct{}
+
+	// maxRequestSize is a limit of request body size, zero means unlimited. Accessed atomically
+	maxRequestSize int64
+
+	// connectedClients and totalConnections are counters of HTTP connections, accessed atomically
+	connectedClients int64
+	totalConnections int64
+	// maxClients limits count of open connections, zero means unlimited. Accessed atomically
+	maxClients int64
+
+	// clientTimeout is a time.Duration, after which idle connections are closed, zero means never. Accessed atomically
+	clientTimeout int64
+	// idleConns contains idle connections with time, they became idle
+	idleConns   map[net.Conn]time.Time
+	idleConnsMu sync.Mutex
+
+	// clientRateLimit is a limit of requests per second of a single connection, zero means unlimited. Accessed atomically
+	clientRateLimit int64
 }
 
+// rateLimiterKey is a key of connection context, holding *api.RateLimiter of the connection
+type rateLimiterKey struct{}
+
 // NewServer Returns new instance of Radish HTTP server
 func NewServer(host string, port int, messageHandler api.MessageHandler) *Server {
 	// use server instance instead of http.ListenAndServe -- due to we should use graceful shutdown
@@ -37,15 +73,24 @@ func NewServer(host string, port int, messageHandler api.MessageHandler) *Server
 		Server:         http.Server{Addr: addr},
 		messageHandler: messageHandler,
 		stopChan:       make(chan struct{}),
+		maxRequestSize: api.DefaultMaxRequestSize,
+		maxClients:     api.DefaultMaxClients,
+		idleConns:      make(map[net.Conn]time.Time),
 	}
 
 	s.Server.Handler = &s
+	s.Server.ConnState = s.trackConnState
+	s.Server.ConnContext = func(ctx context.Context, conn net.Conn) context.Context {
+		return context.WithValue(ctx, rateLimiterKey{}, &api.RateLimiter{})
+	}
 
 	return &s
 }
 
 // ListenAndServe statrs listening to incoming connections
 func (s *Server) ListenAndServe() error {
+	go s.closeIdleConns()
+
 	if err := s.Server.ListenAndServe(); err == http.ErrServerClosed {
 		<-s.stopChan // wait for full shutdown
 		return nil
@@ -65,6 +110,115 @@ func (s *Server) Shutdown() error {
 	return s.Stop()
 }
 
+// SetMaxRequestSize sets limit of request body size in bytes, zero disables the limit
+func (s *Server) SetMaxRequestSize(size int64) {
+	atomic.StoreInt64(&s.maxRequestSize, size)
+}
+
+// MaxRequestSize returns limit of request body size, zero if unlimited
+func (s *Server) MaxRequestSize() int64 {
+	return atomic.LoadInt64(&s.maxRequestSize)
+}
+
+// SetClientTimeout sets time, after which keep-alive connections without requests are closed. Zero disables the timeout.
+// Unlike http.Server IdleTimeout, it could be changed while the server is running
+func (s *Server) SetClientTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&s.clientTimeout, int64(timeout))
+}
+
+// ClientTimeout returns time, after which idle connections are closed, zero if they are never closed
+func (s *Server) ClientTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.clientTimeout))
+}
+
+// closeIdleConns closes connections, that are idle longer than client timeout, once per idleCheckInterval,
+// until the server is shut down
+func (s *Server) closeIdleConns() {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case now := <-ticker.C:
+			timeout := s.ClientTimeout()
+			if timeout <= 0 {
+				continue
+			}
+
+			s.idleConnsMu.Lock()
+			for conn, since := range s.idleConns {
+				if now.Sub(since) > timeout {
+					// the connection is removed from idleConns by ConnState hook
+					conn.Close()
+				}
+			}
+			s.idleConnsMu.Unlock()
+		}
+	}
+}
+
+// SetClientRateLimit sets limit of requests per second of a single connection, zero disables the limit.
+// Requests over the limit are answered by 429 Too Many Requests
+func (s *Server) SetClientRateLimit(rate int) {
+	atomic.StoreInt64(&s.clientRateLimit, int64(rate))
+}
+
+// ClientRateLimit returns limit of requests per second of a single connection, zero if unlimited
+func (s *Server) ClientRateLimit() int {
+	return int(atomic.LoadInt64(&s.clientRateLimit))
+}
+
+// ConnectedClients returns count of open connections
+func (s *Server) ConnectedClients() int {
+	return int(atomic.LoadInt64(&s.connectedClients))
+}
+
+// TotalConnections returns count of connections, accepted since start
+func (s *Server) TotalConnections() int64 {
+	return atomic.LoadInt64(&s.totalConnections)
+}
+
+// SetMaxClients sets limit of count of open connections, zero disables the limit.
+// New connections over the limit are answered by 503 Service Unavailable and closed
+func (s *Server) SetMaxClients(max int) {
+	atomic.StoreInt64(&s.maxClients, int64(max))
+}
+
+// MaxClients returns limit of count of open connections, zero if unlimited
+func (s *Server) MaxClients() int {
+	return int(atomic.LoadInt64(&s.maxClients))
+}
+
+// trackConnState counts connections, rejects connections over the limit and tracks idle ones.
+// It's a http.Server ConnState hook
+func (s *Server) trackConnState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		// rejected connection is counted until it's closed, to keep the counter consistent with StateClosed
+		count := atomic.AddInt64(&s.connectedClients, 1)
+		if max := atomic.LoadInt64(&s.maxClients); max > 0 && count > max {
+			conn.Write([]byte(maxClientsResponse))
+			conn.Close()
+			return
+		}
+		atomic.AddInt64(&s.totalConnections, 1)
+	case http.StateHijacked, http.StateClosed:
+		atomic.AddInt64(&s.connectedClients, -1)
+	}
+
+	s.idleConnsMu.Lock()
+	defer s.idleConnsMu.Unlock()
+
+	// new connection is idle until the first request
+	if state == http.StateNew || state == http.StateIdle {
+		s.idleConns[conn] = time.Now()
+	} else {
+		delete(s.idleConns, conn)
+	}
+}
+
 // ServeHTTP handles all requests to Http API.
 // ServeHTTP transforms HTTP request into a message.Request,
 // sends it to MessageHandler, waits until message processed,
@@ -76,38 +230,79 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		response message.Response
 	)
 
-	//log.Debugf("Received request: %q", r.URL.EscapedPath())
+	requestLog := api.NewRequestLog()
+	requestLog.Debugf(nil, "Received request: %s %q", r.Method, r.URL.EscapedPath())
+
+	if r.URL.Path == HealthPath {
+		s.serveHealth(w)
+		return
+	}
+
+	if limiter, ok := r.Context().Value(rateLimiterKey{}).(*api.RateLimiter); ok && !limiter.Allow(s.ClientRateLimit()) {
+		http.Error(w, api.ErrRateLimitExceeded.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	if limit := s.MaxRequestSize(); limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
 
 	request, err := parseRequest(r)
 	if err != nil {
-		log.Debugf("Error during processing request: %s", err.Error())
-		http.Error(w, "Error during processing request: "+err.Error(), http.StatusBadRequest)
+		log.WithFields(log.Fields{"path": r.URL.EscapedPath(), "client": r.RemoteAddr}).
+			Debugf("Error during processing request: %s", err.Error())
+		status := http.StatusBadRequest
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, "Error during processing request: "+err.Error(), status)
 		return
 	}
 
-	//log.Debugf("Handling request: %s", request)
+	requestLog.Debugf(request, "Handling request: %q", request.Args)
 
 	response = s.messageHandler.HandleMessage(request)
 
-	//log.Debugf("Sending response: %s", response)
+	requestLog.Debugf(request, "Sending response: status %d", response.Status())
 
 	sendResponse(response, w)
 }
 
+// serveHealth responds 200 if message handler is healthy and 503 otherwise, without processing any command
+func (s *Server) serveHealth(w http.ResponseWriter) {
+	if checker, ok := s.messageHandler.(api.HealthChecker); ok {
+		if err := checker.CheckHealth(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "OK\n")
+}
+
 func sendResponse(response message.Response, w http.ResponseWriter) {
 	var (
-		bodyReader io.Reader
-		err        error
+		body []byte
+		err  error
 	)
 
-	if len(response.Bytes()) > 1 {
+	// slices are always sent as multipart, even for single element, to distinguish single empty element from empty slice,
+	// and single element slice from string or integer reply. Nullable slice keeps null marks this way
+	var isSlice bool
+	switch response.(type) {
+	case *message.ResponseStringSlice, *message.ResponseStringStream, *message.ResponseStringMap,
+		*message.ResponseNullableStringSlice, *message.ResponseIntSlice, *message.ResponseArray:
+		isSlice = true
+	}
+
+	if len(response.Bytes()) > 1 || isSlice && len(response.Bytes()) > 0 {
 		var contentType string
-		bodyReader, contentType, err = assembleMultipartResponse(response)
+		body, contentType, err = assembleMultipartResponse(response)
 		w.Header().Set("Content-Type", contentType)
 	} else if len(response.Bytes()) == 1 {
-		bodyReader = bytes.NewReader(response.Bytes()[0])
-	} else {
-		bodyReader = bytes.NewReader(nil)
+		body = response.Bytes()[0]
 	}
 
 	if err != nil {
@@ -116,18 +311,26 @@ func sendResponse(response message.Response, w http.ResponseWriter) {
 		return
 	}
 
+	// body is already in memory, so explicit length avoids chunked encoding of long bodies
+	// and makes an empty body distinguishable from a missing one
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
 	w.Header().Set(StatusHeader, response.Status().String())
 	w.WriteHeader(getResponseHttpStatus(response))
-	io.Copy(w, bodyReader)
+	w.Write(body)
 }
 
-func assembleMultipartResponse(response message.Response) (bodyReader io.Reader, contentType string, err error) {
+func assembleMultipartResponse(response message.Response) (body []byte, contentType string, err error) {
 	bodyBuffer := &bytes.Buffer{}
 	writer := multipart.NewWriter(bodyBuffer)
 
-	for _, val := range response.Bytes() {
+	nullable, _ := response.(interface{ IsNull(i int) bool })
+
+	for i, val := range response.Bytes() {
 		mh := make(textproto.MIMEHeader)
 		mh.Set("Content-Type", "text/plain")
+		if nullable != nil && nullable.IsNull(i) {
+			mh.Set(NullPartHeader, "1")
+		}
 		partWriter, err := writer.CreatePart(mh)
 		if err != nil {
 			return nil, "", err
@@ -142,7 +345,7 @@ func assembleMultipartResponse(response message.Response) (bodyReader io.Reader,
 	}
 
 	contentType = writer.FormDataContentType()
-	return bodyBuffer, contentType, nil
+	return bodyBuffer.Bytes(), contentType, nil
 }
 
 func getResponseHttpStatus(r message.Response) int {
@@ -153,6 +356,10 @@ func getResponseHttpStatus(r message.Response) int {
 		message.StatusInvalidCommand:   http.StatusBadRequest,
 		message.StatusTypeMismatch:     http.StatusBadRequest,
 		message.StatusInvalidArguments: http.StatusBadRequest,
+		message.StatusNoScript:         http.StatusNotFound,
+		message.StatusReadOnly:         http.StatusForbidden,
+		message.StatusBusyKey:          http.StatusConflict,
+		message.StatusMisconf:          http.StatusServiceUnavailable,
 	}
 
 	if httpStatus, ok := statusMap[r.Status()]; ok {
@@ -172,6 +379,9 @@ func getCmdArgs(r *http.Request) (cmd string, args [][]byte, err error) {
 	if err != nil {
 		return "", nil, err
 	}
+	if cmd, err = api.NormalizeCommandName(cmd); err != nil {
+		return "", nil, err
+	}
 
 	args = make([][]byte, len(urlParts[2:]))
 	for i, v := range urlParts[2:] {
@@ -195,7 +405,16 @@ func parseRequest(httpRequest *http.Request) (*message.Request, error) {
 	var payload [][]byte
 	mr, err := httpRequest.MultipartReader()
 	if err == nil {
-		for p, err := mr.NextPart(); err == nil; p, err = mr.NextPart() {
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				// e.g. body, truncated by size limit
+				return nil, err
+			}
+
 			part, err := ioutil.ReadAll(p)
 			if err != nil {
 				return nil, err
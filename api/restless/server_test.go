@@ -1,19 +1,26 @@
 package restless_test
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
+	"fmt"
 	"github.com/go-test/deep"
+	"github.com/mshaverdo/radish/api"
 	"github.com/mshaverdo/radish/api/restless"
 	"github.com/mshaverdo/radish/log"
 	"github.com/mshaverdo/radish/message"
 	"io/ioutil"
 	"mime"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/textproto"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -64,6 +71,10 @@ func TestHttpServer_SendResponse(t *testing.T) {
 			t.Errorf("testcase %d: %q Invalid status code: got %d, want %d", n, tst.response.Status(), recorder.Code, tst.wantHttpStatus)
 		}
 
+		if got, want := recorder.Header().Get("Content-Length"), strconv.Itoa(recorder.Body.Len()); got != want {
+			t.Errorf("testcase %d: Invalid Content-Length: got %q, want %q", n, got, want)
+		}
+
 		if recorder.Header().Get(restless.StatusHeader) != tst.response.Status().String() {
 			t.Errorf(
 				"testcase %d: Invalid radish status code: got %q, want %q",
@@ -97,6 +108,181 @@ func TestHttpServer_SendResponse(t *testing.T) {
 	}
 }
 
+func TestHttpServer_SendResponseNullable(t *testing.T) {
+	var tests = []struct {
+		payload   [][]byte
+		wantParts []string
+	}{
+		{[][]byte{[]byte("共産主義の幽霊"), nil, {}}, []string{`"共産主義の幽霊"`, `<nil>`, `""`}},
+		{[][]byte{nil}, []string{`<nil>`}},
+		{[][]byte{{}}, []string{`""`}},
+	}
+
+	for n, tst := range tests {
+		recorder := httptest.NewRecorder()
+		restless.SendResponse(message.NewResponseNullableStringSlice(message.StatusOk, tst.payload), recorder)
+
+		_, params, err := mime.ParseMediaType(recorder.Header().Get("Content-Type"))
+		if err != nil {
+			t.Errorf("testcase %d: Not a multipart: %s", n, err)
+			continue
+		}
+
+		var parts []string
+		reader := multipart.NewReader(recorder.Body, params["boundary"])
+		for p, err := reader.NextPart(); err == nil; p, err = reader.NextPart() {
+			payload, _ := ioutil.ReadAll(p)
+			if p.Header.Get(restless.NullPartHeader) != "" {
+				parts = append(parts, "<nil>")
+			} else {
+				parts = append(parts, fmt.Sprintf("%q", payload))
+			}
+		}
+
+		if diff := deep.Equal(parts, tst.wantParts); diff != nil {
+			t.Errorf("testcase %d: Invalid payload : %s\n\ngot: %s\n\nwant: %s", n, diff, parts, tst.wantParts)
+		}
+	}
+}
+
+func TestHttpServer_SendResponseIntSlice(t *testing.T) {
+	var tests = []struct {
+		payload   []int64
+		wantParts []string
+	}{
+		{[]int64{0, -1, 42}, []string{"0", "-1", "42"}},
+		{[]int64{7}, []string{"7"}},
+	}
+
+	for n, tst := range tests {
+		recorder := httptest.NewRecorder()
+		restless.SendResponse(message.NewResponseIntSlice(message.StatusOk, tst.payload), recorder)
+
+		parts, err := praseMultipartResponse(recorder)
+		if err != nil {
+			t.Errorf("testcase %d: Unable to parse multipart response: %s", n, err)
+			continue
+		}
+		if diff := deep.Equal(parts, tst.wantParts); diff != nil {
+			t.Errorf("testcase %d: Invalid payload : %s\n\ngot: %q\n\nwant: %q", n, diff, parts, tst.wantParts)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	restless.SendResponse(message.NewResponseIntSlice(message.StatusOk, []int64{}), recorder)
+	if recorder.Code != http.StatusOK || recorder.Body.Len() != 0 {
+		t.Errorf("empty slice: got %d %q, want %d with empty body", recorder.Code, recorder.Body.String(), http.StatusOK)
+	}
+
+	recorder = httptest.NewRecorder()
+	restless.SendResponse(message.NewResponseNullableIntSlice(message.StatusOk, []*int64{new(int64), nil}), recorder)
+	_, params, err := mime.ParseMediaType(recorder.Header().Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("nullable slice: Not a multipart: %s", err)
+	}
+	var nulls []bool
+	reader := multipart.NewReader(recorder.Body, params["boundary"])
+	for p, err := reader.NextPart(); err == nil; p, err = reader.NextPart() {
+		nulls = append(nulls, p.Header.Get(restless.NullPartHeader) != "")
+	}
+	if diff := deep.Equal(nulls, []bool{false, true}); diff != nil {
+		t.Errorf("nullable slice: Invalid nulls: %s", diff)
+	}
+}
+
+func TestHttpServer_SendResponseSingleElement(t *testing.T) {
+	tests := []struct {
+		response      message.Response
+		wantMultipart bool
+	}{
+		{message.NewResponseString(message.StatusOk, []byte{}), false},
+		{message.NewResponseStringSlice(message.StatusOk, [][]byte{{}}), true},
+		{message.NewResponseStringSlice(message.StatusOk, [][]byte{[]byte("value")}), true},
+		{message.NewResponseStringSlice(message.StatusOk, nil), false},
+	}
+
+	for n, tst := range tests {
+		recorder := httptest.NewRecorder()
+		restless.SendResponse(tst.response, recorder)
+
+		mediaType, _, _ := mime.ParseMediaType(recorder.Header().Get("Content-Type"))
+		if isMultipart := mediaType == "multipart/form-data"; isMultipart != tst.wantMultipart {
+			t.Errorf("testcase %d: got multipart %t, want %t", n, isMultipart, tst.wantMultipart)
+			continue
+		}
+
+		if tst.wantMultipart {
+			parts, err := praseMultipartResponse(recorder)
+			if diff := deep.Equal(parts, bytesSliceToStringsSlice(tst.response.Bytes())); diff != nil || err != nil {
+				t.Errorf("testcase %d: Invalid payload: %s, %v", n, diff, err)
+			}
+		} else if recorder.Body.Len() != 0 {
+			t.Errorf("testcase %d: got body %q, want empty", n, recorder.Body.String())
+		}
+	}
+}
+
+// mockValueHandler replies to any command with the value of the key, passed as the first argument
+type mockValueHandler struct {
+	values map[string][]byte
+}
+
+func (h *mockValueHandler) HandleMessage(request *message.Request) message.Response {
+	value, ok := h.values[string(request.Args[0])]
+	if !ok {
+		return message.NewResponseStatus(message.StatusNotFound, "")
+	}
+
+	return message.NewResponseString(message.StatusOk, value)
+}
+
+func TestHttpServer_SendResponseContentLength(t *testing.T) {
+	handler := &mockValueHandler{values: map[string][]byte{
+		"empty": {},
+		"short": []byte("value"),
+		// longer than net/http response buffer, that would be sent chunked without explicit Content-Length
+		"long": bytes.Repeat([]byte("0123456789"), 100000),
+	}}
+	ts := httptest.NewServer(restless.NewServer("localhost", 0, handler))
+	defer ts.Close()
+
+	tests := []struct {
+		key        string
+		wantStatus message.Status
+		wantBody   []byte
+	}{
+		{"empty", message.StatusOk, []byte{}},
+		{"short", message.StatusOk, handler.values["short"]},
+		{"long", message.StatusOk, handler.values["long"]},
+		{"404", message.StatusNotFound, []byte{}},
+	}
+
+	for _, tst := range tests {
+		response, err := http.Get(ts.URL + "/GET/" + tst.key)
+		if err != nil {
+			t.Fatalf("GET %s: %s", tst.key, err)
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+
+		if got := response.Header.Get(restless.StatusHeader); got != tst.wantStatus.String() {
+			t.Errorf("GET %s: got status %q, want %q", tst.key, got, tst.wantStatus.String())
+		}
+		if response.ContentLength != int64(len(tst.wantBody)) || len(response.TransferEncoding) != 0 {
+			t.Errorf(
+				"GET %s: got Content-Length %d, Transfer-Encoding %v, want Content-Length %d",
+				tst.key,
+				response.ContentLength,
+				response.TransferEncoding,
+				len(tst.wantBody),
+			)
+		}
+		if !bytes.Equal(body, tst.wantBody) || err != nil {
+			t.Errorf("GET %s: got body of %d bytes, %v, want %d bytes", tst.key, len(body), err, len(tst.wantBody))
+		}
+	}
+}
+
 func TestHttpServer_ParseRequest(t *testing.T) {
 	var tests = []struct {
 		usePost       bool
@@ -143,6 +329,51 @@ func TestHttpServer_ParseRequest(t *testing.T) {
 			[]string{"OK"},
 			nil,
 		},
+		{
+			false,
+			"http://localhost:6380/get/OK",
+			"",
+			nil,
+			"GET",
+			[]string{"OK"},
+			nil,
+		},
+		{
+			false,
+			"http://localhost:6380/GET%00/OK",
+			"",
+			nil,
+			"",
+			nil,
+			api.ErrInvalidCommandName,
+		},
+		{
+			false,
+			"http://localhost:6380/GET%0D%0ADEL/OK",
+			"",
+			nil,
+			"",
+			nil,
+			api.ErrInvalidCommandName,
+		},
+		{
+			false,
+			"http://localhost:6380//OK",
+			"",
+			nil,
+			"",
+			nil,
+			api.ErrEmptyCommandName,
+		},
+		{
+			false,
+			"http://localhost:6380/DEL/a%2Fb/%252F/%2F%2F/%00/%0A/./../%3Fx=1/%23f/%25/%FF%FE/+/",
+			"",
+			nil,
+			"DEL",
+			[]string{"a/b", "%2F", "//", "\x00", "\n", ".", "..", "?x=1", "#f", "%", "\xff\xfe", "+", ""},
+			nil,
+		},
 	}
 
 	for _, tst := range tests {
@@ -246,3 +477,177 @@ func bytesSliceToStringsSlice(b [][]byte) []string {
 
 	return result
 }
+
+type mockHealthHandler struct {
+	err error
+}
+
+func (h *mockHealthHandler) HandleMessage(request *message.Request) message.Response {
+	return message.NewResponseStatus(message.StatusError, "health check must not be processed as a command")
+}
+
+func (h *mockHealthHandler) CheckHealth() error {
+	return h.err
+}
+
+func TestHttpServer_Health(t *testing.T) {
+	tests := []struct {
+		err            error
+		wantHttpStatus int
+	}{
+		{nil, http.StatusOK},
+		{errors.New("server shutdown"), http.StatusServiceUnavailable},
+	}
+
+	for _, tst := range tests {
+		s := restless.NewServer("localhost", 0, &mockHealthHandler{tst.err})
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "http://localhost"+restless.HealthPath, nil))
+
+		if w.Code != tst.wantHttpStatus {
+			t.Errorf("health with err %v: got status %d, want %d", tst.err, w.Code, tst.wantHttpStatus)
+		}
+		if w.Header().Get(restless.StatusHeader) != "" {
+			t.Errorf("health with err %v: processed as a command", tst.err)
+		}
+	}
+}
+
+type mockOkHandler struct{}
+
+func (h *mockOkHandler) HandleMessage(request *message.Request) message.Response {
+	return message.NewResponseStatus(message.StatusOk, "OK")
+}
+
+func TestHttpServer_MaxRequestSize(t *testing.T) {
+	multipartBody := func(parts ...string) (*bytes.Buffer, string) {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		for _, part := range parts {
+			w, _ := mw.CreatePart(textproto.MIMEHeader{})
+			w.Write([]byte(part))
+		}
+		mw.Close()
+		return body, mw.FormDataContentType()
+	}
+
+	s := restless.NewServer("localhost", 0, &mockOkHandler{})
+	s.SetMaxRequestSize(10)
+
+	tests := []struct {
+		body           string
+		multipart      bool
+		wantHttpStatus int
+	}{
+		{"0123456789", false, http.StatusOK},
+		{"0123456789A", false, http.StatusRequestEntityTooLarge},
+		{"0123456789", true, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tst := range tests {
+		req := httptest.NewRequest("POST", "http://localhost/SET/key", bytes.NewBufferString(tst.body))
+		if tst.multipart {
+			body, contentType := multipartBody(tst.body, tst.body)
+			req = httptest.NewRequest("POST", "http://localhost/SET/key", body)
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Code != tst.wantHttpStatus {
+			t.Errorf("body %q, multipart %t: got status %d, want %d", tst.body, tst.multipart, w.Code, tst.wantHttpStatus)
+		}
+	}
+
+	s.SetMaxRequestSize(0)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("POST", "http://localhost/SET/key", bytes.NewBufferString("0123456789A")))
+	if w.Code != http.StatusOK {
+		t.Errorf("unlimited: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestHttpServer_MaxClients(t *testing.T) {
+	s := restless.NewServer("localhost", 0, &mockOkHandler{})
+	s.SetMaxClients(1)
+
+	ts := httptest.NewUnstartedServer(s)
+	ts.Config.ConnState = s.ConnState
+	ts.Start()
+	defer ts.Close()
+
+	// keep-alive connection holds the only slot
+	first, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial(): %s", err)
+	}
+	defer first.Close()
+	first.Write([]byte("GET /GET/key HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	response, err := http.ReadResponse(bufio.NewReader(first), nil)
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("first connection: got %v, %v, want status %d", response, err, http.StatusOK)
+	}
+
+	second, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial(): %s", err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	response, err = http.ReadResponse(bufio.NewReader(second), nil)
+	if err != nil || response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("second connection: got %v, %v, want status %d", response, err, http.StatusServiceUnavailable)
+	}
+	if body, _ := ioutil.ReadAll(response.Body); !strings.Contains(string(body), "max number of clients reached") {
+		t.Errorf("second connection: got body %q", body)
+	}
+}
+
+func TestHttpServer_ClientRateLimit(t *testing.T) {
+	s := restless.NewServer("localhost", 0, &mockOkHandler{})
+	s.SetClientRateLimit(3)
+
+	ts := httptest.NewUnstartedServer(s)
+	ts.Config.ConnContext = s.ConnContext
+	ts.Start()
+	defer ts.Close()
+
+	get := func(client *http.Client) int {
+		response, err := client.Get(ts.URL + "/GET/key")
+		if err != nil {
+			t.Fatalf("Get(): %s", err)
+		}
+		ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	// every client gets its own bucket, burst of rate requests is allowed
+	first := &http.Client{Transport: &http.Transport{}}
+	second := &http.Client{Transport: &http.Transport{}}
+	for i := 0; i < 3; i++ {
+		if got := get(first); got != http.StatusOK {
+			t.Errorf("first client, request %d: got status %d, want %d", i, got, http.StatusOK)
+		}
+	}
+	if got := get(first); got != http.StatusTooManyRequests {
+		t.Errorf("first client over the limit: got status %d, want %d", got, http.StatusTooManyRequests)
+	}
+	if got := get(second); got != http.StatusOK {
+		t.Errorf("second client: got status %d, want %d", got, http.StatusOK)
+	}
+
+	// bucket is refilled with rate tokens per second
+	time.Sleep(400 * time.Millisecond)
+	if got := get(first); got != http.StatusOK {
+		t.Errorf("first client after refill: got status %d, want %d", got, http.StatusOK)
+	}
+
+	s.SetClientRateLimit(0)
+	for i := 0; i < 10; i++ {
+		if got := get(first); got != http.StatusOK {
+			t.Errorf("unlimited, request %d: got status %d, want %d", i, got, http.StatusOK)
+		}
+	}
+}
@@ -3,10 +3,13 @@ package main
 import (
 	"flag"
 	"github.com/mshaverdo/assert"
+	"github.com/mshaverdo/radish/api"
 	"github.com/mshaverdo/radish/controller"
 	"github.com/mshaverdo/radish/log"
+	"io"
 	"os"
 	"os/signal"
+	"runtime"
 	"runtime/pprof"
 	"syscall"
 	"time"
@@ -20,14 +23,34 @@ func init() {
 
 func main() {
 	var (
-		host, dataDir               string
-		port                        int
-		collectInterval             int
-		mergeWalInterval            int
-		syncPolicy                  int
-		quiet, verbose, veryVerbose bool
-		cpuProfile                  string
-		useHttp                     bool
+		host, dataDir                  string
+		port                           int
+		collectInterval                int
+		mergeWalInterval               int
+		memoryPurgeInterval            int
+		syncPolicy                     int
+		quiet, verbose, veryVerbose    bool
+		cpuProfile                     string
+		useHttp, readOnly, enableDebug bool
+		sortHashFields, refuseWalGaps  bool
+		stopWritesOnError              bool
+		trackTimestamps, keysCheckTtl  bool
+		notifyKeyspaceEvents           string
+		walFormat                      string
+		importRdb                      string
+		commandTimeout, keysScanLimit  int
+		ttlJitter, clientTimeout       int
+		maxClients, replayWorkers      int
+		clientRateLimit                int
+		hotKeysSampleRate              int
+		latencyMonitorThreshold        int
+		listMaxLength                  int
+		listOverflow                   string
+		maxRequestSize                 int64
+		logFile, logFormat             string
+		logMaxSize, logMaxAge          int
+		logMaxBackups                  int
+		fileNames                      = controller.DefaultFileNames()
 	)
 
 	flag.StringVar(&host, "h", "", "The listening host.")
@@ -38,13 +61,64 @@ func main() {
 	flag.IntVar(&collectInterval, "e", 100, "Expired items collection interval in seconds")
 	flag.IntVar(&mergeWalInterval, "m", 600, "Merge WAL into snapshot interval in seconds")
 	flag.IntVar(&syncPolicy, "s", 1, "WAL sync policy: 0 - never, 1 - once per second, 2 - always")
+	flag.StringVar(&walFormat, "wal-format", "gencode", "WAL format: gencode - compact binary, resp - text, readable by standard tools")
 	flag.StringVar(&dataDir, "d", "./", "Data dir")
+	flag.StringVar(&fileNames.Storage, "storage-file", fileNames.Storage, "Storage snapshot file name, relative to data dir")
+	flag.StringVar(&fileNames.StorageDiff, "storage-diff-file", fileNames.StorageDiff, "Storage snapshot diff file name pattern, relative to data dir. Must contain %v placeholder for message id")
+	flag.StringVar(&fileNames.Wal, "wal-file", fileNames.Wal, "WAL file name pattern, relative to data dir. Must contain %v placeholder for message id")
+	flag.StringVar(&importRdb, "import-rdb", "", "Import Redis RDB file on start, if the storage is empty")
+	flag.IntVar(&commandTimeout, "command-timeout", 0, "Timeout of read-only commands in milliseconds, 0 - unlimited. Could be changed by `CONFIG SET command-timeout`")
+	flag.BoolVar(&keysCheckTtl, "keys-check-ttl", true, "Exclude expired keys, that aren't collected yet, from KEYS result at the cost of a lock per key. Could be changed by `CONFIG SET keys-check-ttl no`")
+	flag.IntVar(&keysScanLimit, "keys-scan-limit", 0, "Reject KEYS, if the storage contains more keys, 0 - unlimited. Could be changed by `CONFIG SET keys-scan-limit`")
+	flag.Int64Var(&maxRequestSize, "max-request-size", api.DefaultMaxRequestSize, "Reject requests, larger than this size in bytes, 0 - unlimited. Could be changed by `CONFIG SET max-request-size`")
+	flag.IntVar(&maxClients, "maxclients", api.DefaultMaxClients, "Reject new connections, if count of open ones reached this limit, 0 - unlimited. Could be changed by `CONFIG SET maxclients`")
+	flag.IntVar(&clientTimeout, "timeout", 0, "Close client connections after this count of idle seconds, 0 - never. Could be changed by `CONFIG SET timeout`")
+	flag.IntVar(&clientRateLimit, "client-rate-limit", 0, "Reject commands of a client connection over this count per second, 0 - unlimited. Could be changed by `CONFIG SET client-rate-limit`")
+	flag.IntVar(&listMaxLength, "list-max-length", 0, "Limit length of lists, grown by LPUSH, 0 - unlimited. Could be changed by `CONFIG SET list-max-length`")
+	flag.StringVar(&listOverflow, "list-overflow", "error", "LPUSH over -list-max-length: error - reject the push, trim - remove elements from the tail. Could be changed by `CONFIG SET list-overflow`")
+	flag.IntVar(&hotKeysSampleRate, "hotkeys-sample-rate", 0, "Count key accesses of every N-th command, replied by HOTKEYS, 0 - disabled. Could be changed by `CONFIG SET hotkeys-sample-rate`")
+	flag.IntVar(&replayWorkers, "replay-workers", runtime.NumCPU(), "Count of goroutines, replaying WAL to different keys in parallel on start and WAL merge, 1 - serial replay")
+	flag.IntVar(&memoryPurgeInterval, "memory-purge-interval", 0, "Release memory, held by the storage after removal of keys, like MEMORY PURGE, every this count of seconds, 0 - disabled")
+	flag.IntVar(&latencyMonitorThreshold, "latency-monitor-threshold", 0, "Record commands, WAL fsyncs and snapshot updates, that take this count of milliseconds or more, replied by LATENCY, 0 - disabled. Could be changed by `CONFIG SET latency-monitor-threshold`")
+	flag.IntVar(&ttlJitter, "ttl-jitter", 0, "Randomize TTL of SET, SETEX and EXPIRE within ± percent, 0 - disabled. Could be changed by `CONFIG SET ttl-jitter`")
 	flag.BoolVar(&verbose, "v", false, "Enable verbose logging.")
 	flag.BoolVar(&quiet, "q", false, "Quiet logging. Totally silent.")
 	flag.BoolVar(&veryVerbose, "vv", false, "Enable very verbose logging.")
+	flag.StringVar(&logFile, "logfile", "", "Write log into the specified file instead of stderr")
+	flag.StringVar(&logFormat, "logformat", "", "Log format: color - colorized, text - plain with date, json - JSON object per line. By default color for stderr and text for -logfile")
+	flag.IntVar(&logMaxSize, "logfile-max-size", 100, "Rotate -logfile, when it grows over this size in megabytes, 0 - never")
+	flag.IntVar(&logMaxAge, "logfile-max-age", 24, "Rotate -logfile, when it becomes older than this count of hours, 0 - never")
+	flag.IntVar(&logMaxBackups, "logfile-max-backups", 7, "Count of rotated log files to keep, 0 - keep all")
 	flag.BoolVar(&useHttp, "http", false, "Use HTTP API")
+	flag.BoolVar(&enableDebug, "enable-debug-command", false, "Allow DEBUG command. Intended for tests only")
+	flag.BoolVar(&readOnly, "read-only", false, "Start in read-only mode. Could be changed by `CONFIG SET read-only no`")
+	flag.BoolVar(&refuseWalGaps, "refuse-wal-gaps", false, "Refuse to start, if WAL misses some messages, e.g. a WAL file was removed. By default the gap is logged as a warning")
+	flag.BoolVar(&stopWritesOnError, "stop-writes-on-persistence-error", true, "Reject modifying commands, while WAL writing or snapshot updating fails. Could be changed by `CONFIG SET stop-writes-on-persistence-error no`")
+	flag.BoolVar(&trackTimestamps, "track-timestamps", false, "Keep creation and modification time of values, returned by META command. Could be changed by `CONFIG SET track-timestamps yes`")
+	flag.BoolVar(&sortHashFields, "sort-hash-fields", false, "Return HKEYS and HGETALL fields in lexicographical order. Could be changed by `CONFIG SET sort-hash-fields yes`")
+	flag.StringVar(
+		&notifyKeyspaceEvents,
+		"notify-keyspace-events",
+		"",
+		"Keyspace notifications, in Redis format: K - keyspace, E - keyevent, g - generic, $ - string, l - list, h - hash, x - expired, A - alias for g$lhx",
+	)
 	flag.Parse()
 
+	var logOutput io.Writer = os.Stderr
+	if logFile != "" {
+		f, err := log.NewRotatingFile(logFile, int64(logMaxSize)<<20, time.Duration(logMaxAge)*time.Hour, logMaxBackups)
+		if err != nil {
+			log.Criticalf("Can't open log file %s: %s", logFile, err)
+			return
+		}
+		defer f.Close()
+		logOutput = f
+	}
+	if err := log.SetOutput(logOutput, logFormat); err != nil {
+		log.Critical(err.Error())
+		return
+	}
+
 	if cpuProfile != "" {
 		if fCpu, err := os.Create(cpuProfile); err == nil {
 			pprof.StartCPUProfile(fCpu)
@@ -75,6 +149,48 @@ func main() {
 		useHttp,
 	)
 
+	format, err := controller.ParseWalFormat(walFormat)
+	if err != nil {
+		log.Critical(err.Error())
+		return
+	}
+	c.SetWalFormat(format)
+	c.SetReplayWorkers(replayWorkers)
+	c.SetRefuseWalGaps(refuseWalGaps)
+	c.SetMemoryPurgeInterval(time.Duration(memoryPurgeInterval) * time.Second)
+	if err := c.SetFileNames(fileNames); err != nil {
+		log.Critical(err.Error())
+		return
+	}
+	if err := c.SetNotifyKeyspaceEvents(notifyKeyspaceEvents); err != nil {
+		log.Critical(err.Error())
+		return
+	}
+	c.SetReadOnly(readOnly)
+	c.SetStopWritesOnError(stopWritesOnError)
+	c.SetSortHashFields(sortHashFields)
+	c.SetTrackTimestamps(trackTimestamps)
+	c.SetDebugEnabled(enableDebug)
+	c.SetImportRdb(importRdb)
+	c.SetCommandTimeout(time.Duration(commandTimeout) * time.Millisecond)
+	c.SetKeysScanLimit(keysScanLimit)
+	c.SetKeysCheckTtl(keysCheckTtl)
+	c.SetHotKeysSampleRate(hotKeysSampleRate)
+	c.SetLatencyMonitorThreshold(latencyMonitorThreshold)
+	c.SetMaxRequestSize(maxRequestSize)
+	c.SetClientTimeout(time.Duration(clientTimeout) * time.Second)
+	c.SetMaxClients(maxClients)
+	c.SetClientRateLimit(clientRateLimit)
+	c.SetListMaxLength(listMaxLength)
+	if err := c.SetListOverflow(listOverflow); err != nil {
+		log.Critical(err.Error())
+		return
+	}
+	if err := c.SetTtlJitter(ttlJitter); err != nil {
+		log.Critical(err.Error())
+		return
+	}
+
 	go handleSignals(c)
 
 	if err := c.ListenAndServe(); err != nil {
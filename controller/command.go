@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"errors"
+	"github.com/mshaverdo/radish/message"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+var ErrUnknownCommandCmd = errors.New("Unknown COMMAND subcommand")
+
+// commandInfo describes a command like Redis COMMAND reply
+type commandInfo struct {
+	name string
+	// arity is a count of arguments including command name, negative means minimal count
+	arity       int
+	isModifying bool
+	// flags are additional flags like admin or pubsub, write or readonly flag is set by isModifying
+	flags []string
+	// firstKey, lastKey and keyStep are positions of keys in arguments, lastKey -1 means keys up to the last argument
+	firstKey, lastKey, keyStep int
+	summary                    string
+	// complexity is an estimated time complexity, like in Redis docs
+	complexity string
+	// isDangerous is true for commands, that scan the whole keyspace and may block the server on large databases
+	isDangerous bool
+}
+
+// serviceCommands describes commands, handled by Controller and RESP API server, for COMMAND introspection
+var serviceCommands = []commandInfo{
+	{name: "CLIENT", arity: -2, flags: []string{"admin", "noscript", "loading", "stale"}, summary: "Manages client connections", complexity: "O(N) where N is the number of client connections for CLIENT LIST, O(1) otherwise"},
+	{name: "COMMAND", arity: -1, flags: []string{"loading", "stale"}, summary: "Returns detailed information about all commands", complexity: "O(N) where N is the number of requested commands"},
+	{name: "CONFIG", arity: -2, flags: []string{"admin", "noscript", "loading", "stale"}, summary: "Gets or sets runtime configuration parameters", complexity: "O(N) where N is the number of configuration parameters"},
+	{name: "DEBUG", arity: -2, flags: []string{"admin", "noscript", "loading", "stale"}, summary: "Debugging commands, allowed only with -enable-debug-command flag", complexity: "Depends on subcommand"},
+	{name: "DELPATTERN", arity: 2, isModifying: true, flags: []string{"admin"}, summary: "Deletes all keys matching a glob pattern", complexity: "O(N) where N is the number of keys in the database", isDangerous: true},
+	{name: "DISCARD", arity: 1, flags: []string{"noscript", "no_multi", "loading", "stale", "fast"}, summary: "Discards a transaction", complexity: "O(N) where N is the number of queued commands"},
+	{name: "EVAL", arity: -3, flags: []string{"noscript", "movablekeys"}, summary: "Executes a server-side Lua script", complexity: "Depends on the script"},
+	{name: "EVALSHA", arity: -3, flags: []string{"noscript", "movablekeys"}, summary: "Executes a server-side Lua script by SHA1 digest", complexity: "Depends on the script"},
+	{name: "EXEC", arity: 1, flags: []string{"noscript", "no_multi", "loading", "stale"}, summary: "Executes all commands in a transaction", complexity: "Depends on queued commands"},
+	{name: "EXPLAIN", arity: -2, flags: []string{"loading", "stale"}, summary: "Reports what a command would do without executing it", complexity: "O(1)"},
+	{name: "EXPORTRDB", arity: 1, flags: []string{"admin", "noscript", "no_multi"}, summary: "Writes all keys into dump.rdb in the data dir in Redis RDB format", complexity: "O(N) where N is the number of keys in the database", isDangerous: true},
+	{name: "HELLO", arity: -1, flags: []string{"noscript", "loading", "stale", "fast"}, summary: "Switches connection protocol", complexity: "O(1)"},
+	{name: "HOTKEYS", arity: -1, flags: []string{"admin", "noscript", "loading", "stale"}, summary: "Returns the most accessed keys, sampled with hotkeys-sample-rate", complexity: "O(N) where N is the number of tracked keys"},
+	{name: "HRANDFIELD", arity: -2, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns one or more random fields from a hash", complexity: "O(N) where N is the number of returned fields"},
+	{name: "INFO", arity: -1, flags: []string{"loading", "stale"}, summary: "Returns information and statistics about the server", complexity: "O(1)"},
+	{name: "KEYS", arity: 2, summary: "Returns all key names that match a pattern", complexity: "O(N) where N is the number of keys in the database", isDangerous: true},
+	{name: "LATENCY", arity: -2, flags: []string{"admin", "noscript", "loading", "stale"}, summary: "Returns latency spikes of commands, WAL fsyncs and snapshot updates", complexity: "O(N) where N is the number of recorded samples"},
+	{name: "MEMORY", arity: -2, flags: []string{"admin", "noscript"}, summary: "Releases memory, held by the storage after removal of keys", complexity: "O(N) where N is the number of keys in the database", isDangerous: true},
+	{name: "MULTI", arity: 1, flags: []string{"noscript", "no_multi", "loading", "stale", "fast"}, summary: "Starts a transaction", complexity: "O(1)"},
+	{name: "OBJECT", arity: -2, firstKey: 2, lastKey: 2, keyStep: 1, summary: "Inspects the internals of the value stored at key", complexity: "O(1)"},
+	{name: "PING", arity: -1, flags: []string{"stale", "fast"}, summary: "Returns the server's liveliness response", complexity: "O(1)"},
+	{name: "PSUBSCRIBE", arity: -2, flags: []string{"pubsub", "noscript", "no_multi", "loading", "stale"}, summary: "Listens for messages published to channels that match patterns", complexity: "O(N) where N is the number of patterns"},
+	{name: "PUBLISH", arity: 3, flags: []string{"pubsub", "loading", "stale", "fast"}, summary: "Posts a message to a channel", complexity: "O(N+M) where N is the number of channel subscribers and M is the number of pattern subscribers"},
+	{name: "PUNSUBSCRIBE", arity: -1, flags: []string{"pubsub", "noscript", "no_multi", "loading", "stale"}, summary: "Stops listening to messages published to channels that match patterns", complexity: "O(N) where N is the number of patterns"},
+	{name: "QUIT", arity: 1, flags: []string{"noscript", "loading", "stale", "fast"}, summary: "Closes the connection", complexity: "O(1)"},
+	{name: "RESET", arity: 1, flags: []string{"noscript", "loading", "stale", "fast"}, summary: "Resets the connection", complexity: "O(1)"},
+	{name: "SCRIPT", arity: -2, flags: []string{"noscript"}, summary: "Manages the server-side Lua scripts cache", complexity: "O(N) where N is the length of the script for SCRIPT LOAD or the number of scripts otherwise"},
+	{name: "SHUTDOWN", arity: -1, flags: []string{"admin", "noscript", "no_multi", "loading", "stale"}, summary: "Synchronously saves the data to disk and shuts down the server", complexity: "O(N) where N is the number of keys in the database, when the snapshot is saved"},
+	{name: "SUBSCRIBE", arity: -2, flags: []string{"pubsub", "noscript", "no_multi", "loading", "stale"}, summary: "Listens for messages published to channels", complexity: "O(N) where N is the number of channels"},
+	{name: "UNSUBSCRIBE", arity: -1, flags: []string{"pubsub", "noscript", "no_multi", "loading", "stale"}, summary: "Stops listening to messages posted to channels", complexity: "O(N) where N is the number of channels"},
+	{name: "UNWATCH", arity: 1, flags: []string{"noscript", "loading", "stale", "fast"}, summary: "Forgets about watched keys of a transaction", complexity: "O(1)"},
+	{name: "WAIT", arity: 3, flags: []string{"noscript", "no_multi"}, summary: "Blocks until previous writes are synced to WAL", complexity: "O(1)"},
+	{name: "WAITWAL", arity: 2, flags: []string{"noscript", "no_multi"}, summary: "Blocks until previous writes of the connection are synced to WAL, returns synced and issued WAL message ids", complexity: "O(1)"},
+	{name: "WATCH", arity: -2, flags: []string{"noscript", "no_multi", "loading", "stale", "fast"}, firstKey: 1, lastKey: -1, keyStep: 1, summary: "Monitors changes to keys to determine the execution of a transaction", complexity: "O(1) for every key"},
+}
+
+// commandTable is a table of all supported commands by name, sorted by name
+var commandTable, commandNames = buildCommandTable()
+
+func buildCommandTable() (map[string]commandInfo, []string) {
+	table := make(map[string]commandInfo)
+	for _, commands := range [][]commandInfo{coreCommands, serviceCommands} {
+		for _, info := range commands {
+			// commands, intercepted by Controller, are described by serviceCommands
+			table[info.name] = info
+		}
+	}
+
+	names := make([]string, 0, len(table))
+	for name := range table {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return table, names
+}
+
+// keys returns keys in arguments of the command by its key positions. Unknown commands have no keys.
+// Positions count the command name, like in Redis, that isn't in args. Non-positive keyStep is treated as 1
+func (info commandInfo) keys(args [][]byte) []string {
+	if info.firstKey <= 0 {
+		return nil
+	}
+
+	last := info.lastKey
+	if last < 0 {
+		last += len(args) + 1
+	}
+	if last > len(args) {
+		last = len(args)
+	}
+	step := info.keyStep
+	if step <= 0 {
+		step = 1
+	}
+
+	var keys []string
+	for pos := info.firstKey; pos <= last; pos += step {
+		keys = append(keys, string(args[pos-1]))
+	}
+
+	return keys
+}
+
+// hasFlag returns true, if the command has the flag
+func (info commandInfo) hasFlag(flag string) bool {
+	for _, f := range info.flags {
+		if f == flag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newCommandCalls returns zero counters of commandTable commands. The map is never modified later,
+// so counters could be updated without locking
+func newCommandCalls() map[string]*int64 {
+	calls := make(map[string]*int64, len(commandTable))
+	for name := range commandTable {
+		calls[name] = new(int64)
+	}
+
+	return calls
+}
+
+// countCommand increments counters of processed commands
+func (c *Controller) countCommand(cmd string) {
+	atomic.AddInt64(&c.totalCommands, 1)
+	if calls, ok := c.commandCalls[cmd]; ok {
+		atomic.AddInt64(calls, 1)
+	}
+}
+
+// handleCommand processes COMMAND [COUNT|INFO command-name...|DOCS [command-name...]] request
+func (c *Controller) handleCommand(request *message.Request) message.Response {
+	if len(request.Args) == 0 {
+		return getResponseCommandInfos(commandNames)
+	}
+
+	names := make([]string, len(request.Args)-1)
+	for i, arg := range request.Args[1:] {
+		names[i] = strings.ToUpper(string(arg))
+	}
+
+	switch strings.ToUpper(string(request.Args[0])) {
+	case "COUNT":
+		if len(names) != 0 {
+			return getResponseInvalidArguments(request.Cmd+"|COUNT", ErrWrongArgumentsCount)
+		}
+		return getResponseIntPayload(int64(len(commandTable)))
+	case "INFO":
+		if len(names) == 0 {
+			names = commandNames
+		}
+		return getResponseCommandInfos(names)
+	case "DOCS":
+		if len(names) == 0 {
+			names = commandNames
+		}
+		return getResponseCommandDocs(names)
+	default:
+		return getResponseInvalidArguments(request.Cmd, ErrUnknownCommandCmd)
+	}
+}
+
+// getResponseCommandInfos returns Redis 5 COMMAND reply: name, arity, flags, first key, last key and key step
+// of every command. Unknown commands are replied by nil
+func getResponseCommandInfos(names []string) message.Response {
+	result := make([]message.Response, len(names))
+	for i, name := range names {
+		info, ok := commandTable[name]
+		if !ok {
+			result[i] = message.NewResponseStatus(message.StatusNotFound, "")
+			continue
+		}
+
+		flag := "readonly"
+		if info.isModifying {
+			flag = "write"
+		}
+		flags := []message.Response{message.NewResponseStatus(message.StatusOk, flag)}
+		for _, f := range info.flags {
+			flags = append(flags, message.NewResponseStatus(message.StatusOk, f))
+		}
+
+		result[i] = message.NewResponseArray(message.StatusOk, []message.Response{
+			message.NewResponseString(message.StatusOk, []byte(strings.ToLower(info.name))),
+			message.NewResponseInt(message.StatusOk, int64(info.arity)),
+			message.NewResponseArray(message.StatusOk, flags),
+			message.NewResponseInt(message.StatusOk, int64(info.firstKey)),
+			message.NewResponseInt(message.StatusOk, int64(info.lastKey)),
+			message.NewResponseInt(message.StatusOk, int64(info.keyStep)),
+		})
+	}
+
+	return message.NewResponseArray(message.StatusOk, result)
+}
+
+// getResponseCommandDocs returns COMMAND DOCS reply: pairs of name and docs. Unknown commands are skipped, like in Redis
+func getResponseCommandDocs(names []string) message.Response {
+	var result []message.Response
+	for _, name := range names {
+		info, ok := commandTable[name]
+		if !ok {
+			continue
+		}
+
+		result = append(
+			result,
+			message.NewResponseString(message.StatusOk, []byte(strings.ToLower(info.name))),
+			message.NewResponseStringMap(message.StatusOk, [][]byte{[]byte("summary"), []byte(info.summary)}),
+		)
+	}
+
+	return message.NewResponseArray(message.StatusOk, result)
+}
@@ -0,0 +1,612 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mshaverdo/radish/core"
+	"github.com/mshaverdo/radish/glob"
+	"github.com/mshaverdo/radish/message"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrReadOnly            = errors.New("You can't write against a read only server.")
+	ErrPersistence         = errors.New("Radish is unable to persist data to disk. Commands that may modify the data set are disabled, because stop-writes-on-persistence-error is enabled. Check the logs or INFO persistence for details")
+	ErrUnknownConfigParam  = errors.New("Unsupported CONFIG parameter")
+	ErrImmutableConfig     = errors.New("can't set immutable config")
+	ErrUnknownConfigCmd    = errors.New("Unknown CONFIG subcommand")
+	ErrInvalidConfigValue  = errors.New("Invalid CONFIG parameter value")
+	ErrWrongArgumentsCount = errors.New("wrong number of arguments")
+)
+
+// configParam is a runtime configuration parameter, available via CONFIG GET/SET.
+// Parameter without set is immutable
+type configParam struct {
+	get func() string
+	set func(value string) error
+}
+
+// configParams returns all supported runtime configuration parameters by name
+func (c *Controller) configParams() map[string]configParam {
+	return map[string]configParam{
+		// save and appendonly are probed by Redis tools, e.g. redis-benchmark, on connect.
+		// Radish has no RDB save points and always writes WAL, that is an analog of AOF
+		"save": {
+			get: func() string { return "" },
+		},
+		"appendonly": {
+			get: func() string { return "yes" },
+		},
+		"read-only": {
+			get: func() string { return formatYesNo(c.IsReadOnly()) },
+			set: func(value string) error {
+				readOnly, err := parseYesNo(value)
+				if err != nil {
+					return err
+				}
+				c.SetReadOnly(readOnly)
+				return nil
+			},
+		},
+		"stop-writes-on-persistence-error": {
+			get: func() string { return formatYesNo(c.IsStopWritesOnError()) },
+			set: func(value string) error {
+				enabled, err := parseYesNo(value)
+				if err != nil {
+					return err
+				}
+				c.SetStopWritesOnError(enabled)
+				return nil
+			},
+		},
+		"notify-keyspace-events": {
+			get: func() string { return NotifyFlags(atomic.LoadUint32(&c.notifyFlags)).String() },
+			set: c.SetNotifyKeyspaceEvents,
+		},
+		"sort-hash-fields": {
+			get: func() string { return formatYesNo(c.store.core.IsSortHashFields()) },
+			set: func(value string) error {
+				enabled, err := parseYesNo(value)
+				if err != nil {
+					return err
+				}
+				c.SetSortHashFields(enabled)
+				return nil
+			},
+		},
+		"track-timestamps": {
+			get: func() string { return formatYesNo(core.IsTrackTimestamps()) },
+			set: func(value string) error {
+				enabled, err := parseYesNo(value)
+				if err != nil {
+					return err
+				}
+				c.SetTrackTimestamps(enabled)
+				return nil
+			},
+		},
+		"keys-check-ttl": {
+			get: func() string { return formatYesNo(core.IsKeysCheckTtl()) },
+			set: func(value string) error {
+				enabled, err := parseYesNo(value)
+				if err != nil {
+					return err
+				}
+				c.SetKeysCheckTtl(enabled)
+				return nil
+			},
+		},
+		"command-timeout": {
+			get: func() string { return strconv.FormatInt(int64(c.CommandTimeout()/time.Millisecond), 10) },
+			set: func(value string) error {
+				milliseconds, err := parseNonNegativeInt(value)
+				if err != nil {
+					return err
+				}
+				c.SetCommandTimeout(time.Duration(milliseconds) * time.Millisecond)
+				return nil
+			},
+		},
+		"keys-scan-limit": {
+			get: func() string { return strconv.Itoa(c.KeysScanLimit()) },
+			set: func(value string) error {
+				limit, err := parseNonNegativeInt(value)
+				if err != nil {
+					return err
+				}
+				c.SetKeysScanLimit(limit)
+				return nil
+			},
+		},
+		"hotkeys-sample-rate": {
+			get: func() string { return strconv.Itoa(c.HotKeysSampleRate()) },
+			set: func(value string) error {
+				rate, err := parseNonNegativeInt(value)
+				if err != nil {
+					return err
+				}
+				c.SetHotKeysSampleRate(rate)
+				return nil
+			},
+		},
+		"latency-monitor-threshold": {
+			get: func() string { return strconv.Itoa(c.LatencyMonitorThreshold()) },
+			set: func(value string) error {
+				milliseconds, err := parseNonNegativeInt(value)
+				if err != nil {
+					return err
+				}
+				c.SetLatencyMonitorThreshold(milliseconds)
+				return nil
+			},
+		},
+		"ttl-jitter": {
+			get: func() string { return strconv.Itoa(c.store.TtlJitter()) },
+			set: func(value string) error {
+				percent, err := parseNonNegativeInt(value)
+				if err != nil {
+					return err
+				}
+				return c.store.SetTtlJitter(percent)
+			},
+		},
+		"list-max-length": {
+			get: func() string { return strconv.Itoa(c.store.ListMaxLength()) },
+			set: func(value string) error {
+				length, err := parseNonNegativeInt(value)
+				if err != nil {
+					return err
+				}
+				c.SetListMaxLength(length)
+				return nil
+			},
+		},
+		"list-overflow": {
+			get: func() string { return c.ListOverflow() },
+			set: func(value string) error {
+				if err := c.SetListOverflow(value); err != nil {
+					return ErrInvalidConfigValue
+				}
+				return nil
+			},
+		},
+		"max-request-size": {
+			get: func() string { return strconv.FormatInt(c.MaxRequestSize(), 10) },
+			set: func(value string) error {
+				size, err := parseNonNegativeInt(value)
+				if err != nil {
+					return err
+				}
+				c.SetMaxRequestSize(int64(size))
+				return nil
+			},
+		},
+		"timeout": {
+			get: func() string { return strconv.FormatInt(int64(c.ClientTimeout()/time.Second), 10) },
+			set: func(value string) error {
+				seconds, err := parseNonNegativeInt(value)
+				if err != nil {
+					return err
+				}
+				c.SetClientTimeout(time.Duration(seconds) * time.Second)
+				return nil
+			},
+		},
+		"maxclients": {
+			get: func() string { return strconv.Itoa(c.MaxClients()) },
+			set: func(value string) error {
+				max, err := parseNonNegativeInt(value)
+				if err != nil {
+					return err
+				}
+				c.SetMaxClients(max)
+				return nil
+			},
+		},
+		"client-rate-limit": {
+			get: func() string { return strconv.Itoa(c.ClientRateLimit()) },
+			set: func(value string) error {
+				rate, err := parseNonNegativeInt(value)
+				if err != nil {
+					return err
+				}
+				c.SetClientRateLimit(rate)
+				return nil
+			},
+		},
+	}
+}
+
+// infoSection is a named group of INFO fields
+type infoSection struct {
+	name   string
+	fields func() [][2]string
+}
+
+// infoSections returns all INFO sections in output order
+func (c *Controller) infoSections() []infoSection {
+	return []infoSection{
+		{
+			name: "Server",
+			fields: func() [][2]string {
+				return [][2]string{
+					{"tcp_port", fmt.Sprint(c.port)},
+					{"read_only", formatBool(c.IsReadOnly())},
+				}
+			},
+		},
+		{
+			name: "Clients",
+			fields: func() [][2]string {
+				return [][2]string{
+					{"connected_clients", fmt.Sprint(c.srv.ConnectedClients())},
+					{"maxclients", fmt.Sprint(c.MaxClients())},
+				}
+			},
+		},
+		{
+			name: "Persistence",
+			fields: func() [][2]string {
+				walStatus, snapshotStatus := "ok", "ok"
+				var asyncFailures int64
+				if c.store.isPersistent {
+					walErr, snapshotErr := c.store.keeper.healthErrors()
+					walStatus, snapshotStatus = formatHealthStatus(walErr), formatHealthStatus(snapshotErr)
+					asyncFailures = c.store.keeper.AsyncFailures()
+				}
+				return [][2]string{
+					{"persistence_enabled", formatBool(c.store.isPersistent)},
+					{"wal_last_write_status", walStatus},
+					{"wal_async_write_failures", fmt.Sprint(asyncFailures)},
+					{"snapshot_last_update_status", snapshotStatus},
+				}
+			},
+		},
+		{
+			name: "Stats",
+			fields: func() [][2]string {
+				return [][2]string{
+					{"total_connections_received", fmt.Sprint(c.srv.TotalConnections())},
+					{"total_commands_processed", fmt.Sprint(atomic.LoadInt64(&c.totalCommands))},
+				}
+			},
+		},
+		{
+			name: "Commandstats",
+			fields: func() [][2]string {
+				// like Redis, commands that were never called are omitted
+				var fields [][2]string
+				for _, name := range commandNames {
+					if calls := atomic.LoadInt64(c.commandCalls[name]); calls > 0 {
+						fields = append(fields, [2]string{"cmdstat_" + strings.ToLower(name), fmt.Sprintf("calls=%d", calls)})
+					}
+				}
+				return fields
+			},
+		},
+		{
+			name: "Keyspace",
+			fields: func() [][2]string {
+				return [][2]string{
+					{"db0", fmt.Sprintf("keys=%d", len(c.store.core.Keys("*")))},
+				}
+			},
+		},
+	}
+}
+
+// SetReadOnly switches read-only mode: modifying commands are rejected, while reads continue to serve
+func (c *Controller) SetReadOnly(readOnly bool) {
+	var flag uint32
+	if readOnly {
+		flag = 1
+	}
+
+	atomic.StoreUint32(&c.readOnly, flag)
+}
+
+// IsReadOnly returns true, if server in read-only mode
+func (c *Controller) IsReadOnly() bool {
+	return atomic.LoadUint32(&c.readOnly) == 1
+}
+
+// SetStopWritesOnError enables rejection of modifying commands, while the store fails to write WAL or update snapshot.
+// Otherwise writes are accepted, though they could be lost. It's enabled by default
+func (c *Controller) SetStopWritesOnError(enabled bool) {
+	var flag uint32
+	if enabled {
+		flag = 1
+	}
+
+	atomic.StoreUint32(&c.stopWritesOnError, flag)
+}
+
+// IsStopWritesOnError returns true, if modifying commands are rejected on persistence errors
+func (c *Controller) IsStopWritesOnError() bool {
+	return atomic.LoadUint32(&c.stopWritesOnError) == 1
+}
+
+// SetCommandTimeout sets execution budget of read-only commands: if command isn't processed in time,
+// client gets timeout error. Zero disables timeout
+func (c *Controller) SetCommandTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&c.commandTimeout, int64(timeout))
+}
+
+// CommandTimeout returns execution budget of read-only commands, zero if disabled
+func (c *Controller) CommandTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.commandTimeout))
+}
+
+// SetKeysScanLimit limits KEYS: it's rejected, if the storage contains more than limit keys. Zero disables limit
+func (c *Controller) SetKeysScanLimit(limit int) {
+	atomic.StoreInt64(&c.keysScanLimit, int64(limit))
+}
+
+// KeysScanLimit returns max count of keys, scanned by KEYS, zero if unlimited
+func (c *Controller) KeysScanLimit() int {
+	return int(atomic.LoadInt64(&c.keysScanLimit))
+}
+
+// SetMaxRequestSize limits size of requests in bytes: oversized requests are rejected by API server. Zero disables limit
+func (c *Controller) SetMaxRequestSize(size int64) {
+	c.srv.SetMaxRequestSize(size)
+}
+
+// MaxRequestSize returns limit of request size in bytes, zero if unlimited
+func (c *Controller) MaxRequestSize() int64 {
+	return c.srv.MaxRequestSize()
+}
+
+// SetClientTimeout sets time, after which API server closes connections of clients, that haven't sent a request.
+// Zero disables the timeout
+func (c *Controller) SetClientTimeout(timeout time.Duration) {
+	c.srv.SetClientTimeout(timeout)
+}
+
+// ClientTimeout returns time, after which idle clients are closed, zero if they are never closed
+func (c *Controller) ClientTimeout() time.Duration {
+	return c.srv.ClientTimeout()
+}
+
+// SetMaxClients limits count of open client connections: new connections over the limit are rejected by API server.
+// Zero disables limit
+func (c *Controller) SetMaxClients(max int) {
+	c.srv.SetMaxClients(max)
+}
+
+// MaxClients returns limit of count of open client connections, zero if unlimited
+func (c *Controller) MaxClients() int {
+	return c.srv.MaxClients()
+}
+
+// SetClientRateLimit limits count of commands per second of a single client connection:
+// commands over the limit are rejected by API server. Zero disables limit
+func (c *Controller) SetClientRateLimit(rate int) {
+	c.srv.SetClientRateLimit(rate)
+}
+
+// ClientRateLimit returns limit of commands per second of a single client connection, zero if unlimited
+func (c *Controller) ClientRateLimit() int {
+	return c.srv.ClientRateLimit()
+}
+
+// SetTtlJitter enables randomization of relative TTL of SET, SETEX and EXPIRE within ±percent of the requested TTL.
+// Zero disables jitter
+func (c *Controller) SetTtlJitter(percent int) error {
+	return c.store.SetTtlJitter(percent)
+}
+
+// SetListMaxLength limits length of lists, grown by LPUSH. Zero disables the limit
+func (c *Controller) SetListMaxLength(length int) {
+	c.store.SetListMaxLength(length)
+}
+
+// SetListOverflow sets action of LPUSH, that would grow a list over the length limit:
+// "error" rejects the push, that is the default, and "trim" removes elements from the tail of the list
+func (c *Controller) SetListOverflow(policy string) error {
+	switch strings.ToLower(policy) {
+	case "error":
+		c.store.SetListOverflowTrim(false)
+	case "trim":
+		c.store.SetListOverflowTrim(true)
+	default:
+		return ErrInvalidOverflow
+	}
+
+	return nil
+}
+
+// ListOverflow returns action of LPUSH over the list length limit: "error" or "trim"
+func (c *Controller) ListOverflow() string {
+	if c.store.IsListOverflowTrim() {
+		return "trim"
+	}
+	return "error"
+}
+
+// SetSortHashFields enables lexicographical order of fields, returned by HKEYS and HGETALL.
+// It's disabled by default due to CPU cost of sorting
+func (c *Controller) SetSortHashFields(enabled bool) {
+	c.store.core.SetSortHashFields(enabled)
+}
+
+// SetTrackTimestamps enables tracking of creation and modification time of values, returned by META.
+// It's disabled by default due to the cost of clock reading on every write and bigger snapshots
+func (c *Controller) SetTrackTimestamps(enabled bool) {
+	core.SetTrackTimestamps(enabled)
+}
+
+// SetKeysCheckTtl enables exclusion of expired keys from KEYS result. It's enabled by default, without it KEYS
+// skips locking of every key, but may return keys, that are expired, but not collected yet
+func (c *Controller) SetKeysCheckTtl(enabled bool) {
+	core.SetKeysCheckTtl(enabled)
+}
+
+// SetHotKeysSampleRate enables counting of key accesses by every rate-th command, replied by HOTKEYS.
+// Zero disables sampling, it's disabled by default
+func (c *Controller) SetHotKeysSampleRate(rate int) {
+	c.hotKeys.setSampleRate(rate)
+}
+
+// HotKeysSampleRate returns N, if key accesses are counted by every N-th command, or zero, if sampling is disabled
+func (c *Controller) HotKeysSampleRate() int {
+	return c.hotKeys.getSampleRate()
+}
+
+// SetLatencyMonitorThreshold enables recording of commands, WAL fsyncs and snapshot updates, that take this count
+// of milliseconds or more, replied by LATENCY. Zero disables monitoring, it's disabled by default
+func (c *Controller) SetLatencyMonitorThreshold(milliseconds int) {
+	c.store.latency.setThreshold(milliseconds)
+}
+
+// LatencyMonitorThreshold returns minimal latency in milliseconds of recorded events, or zero, if monitoring is disabled
+func (c *Controller) LatencyMonitorThreshold() int {
+	return c.store.latency.getThreshold()
+}
+
+// writeRejection returns error, if request modifies storage, but server in read-only mode,
+// or the store fails to persist data and stop-writes-on-persistence-error is enabled
+func (c *Controller) writeRejection(request *message.Request) error {
+	if !c.IsReadOnly() && !c.IsStopWritesOnError() {
+		return nil
+	}
+	if !c.store.processor.IsModifyingRequest(request) {
+		return nil
+	}
+
+	if c.IsReadOnly() {
+		return ErrReadOnly
+	}
+	if c.store.PersistenceError() != nil {
+		return ErrPersistence
+	}
+
+	return nil
+}
+
+// handleConfig processes CONFIG GET|SET requests
+func (c *Controller) handleConfig(request *message.Request) message.Response {
+	if len(request.Args) == 0 {
+		return getResponseInvalidArguments(request.Cmd, ErrUnknownConfigCmd)
+	}
+
+	params := c.configParams()
+
+	switch strings.ToUpper(string(request.Args[0])) {
+	case "GET":
+		if len(request.Args) != 2 {
+			return getResponseInvalidArguments(request.Cmd+"|GET", ErrWrongArgumentsCount)
+		}
+
+		pattern := strings.ToLower(string(request.Args[1]))
+		var names []string
+		for name := range params {
+			if glob.Match(pattern, name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		result := make([][]byte, 0, len(names)*2)
+		for _, name := range names {
+			result = append(result, []byte(name), []byte(params[name].get()))
+		}
+
+		return getResponseStringSlicePayload(result)
+	case "SET":
+		if len(request.Args) != 3 {
+			return getResponseInvalidArguments(request.Cmd+"|SET", ErrWrongArgumentsCount)
+		}
+
+		param, ok := params[strings.ToLower(string(request.Args[1]))]
+		if !ok {
+			return getResponseInvalidArguments(request.Cmd, ErrUnknownConfigParam)
+		}
+		if param.set == nil {
+			return getResponseInvalidArguments(request.Cmd, ErrImmutableConfig)
+		}
+		if err := param.set(string(request.Args[2])); err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		return getResponseStatusOkPayload()
+	default:
+		return getResponseInvalidArguments(request.Cmd, ErrUnknownConfigCmd)
+	}
+}
+
+// handleInfo processes INFO [section] request
+func (c *Controller) handleInfo(request *message.Request) message.Response {
+	if len(request.Args) > 1 {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+
+	sectionName := "all"
+	if len(request.Args) == 1 {
+		sectionName = strings.ToLower(string(request.Args[0]))
+	}
+
+	var buf bytes.Buffer
+	for _, section := range c.infoSections() {
+		if sectionName != "all" && sectionName != "default" && sectionName != strings.ToLower(section.name) {
+			continue
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("# " + section.name + "\r\n")
+		for _, field := range section.fields() {
+			buf.WriteString(field[0] + ":" + field[1] + "\r\n")
+		}
+	}
+
+	return getResponseStringPayload(buf.Bytes())
+}
+
+func parseYesNo(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	default:
+		return false, ErrInvalidConfigValue
+	}
+}
+
+func parseNonNegativeInt(value string) (int, error) {
+	result, err := strconv.Atoi(value)
+	if err != nil || result < 0 {
+		return 0, ErrInvalidConfigValue
+	}
+
+	return result, nil
+}
+
+func formatYesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+func formatBool(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
+
+// formatHealthStatus formats result of background persistence operation like Redis: ok or err
+func formatHealthStatus(err error) string {
+	if err != nil {
+		return "err"
+	}
+	return "ok"
+}
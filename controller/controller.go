@@ -8,6 +8,10 @@ import (
 	"github.com/mshaverdo/radish/core"
 	"github.com/mshaverdo/radish/log"
 	"github.com/mshaverdo/radish/message"
+	"io"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -22,6 +26,36 @@ type ApiServer interface {
 
 	// Shutdown shuts Radish and leads to return from Controller.ListenAndServe() that causes application termination
 	Shutdown() error
+
+	// SetMaxRequestSize sets limit of request size in bytes, zero disables the limit
+	SetMaxRequestSize(size int64)
+
+	// MaxRequestSize returns limit of request size, zero if unlimited
+	MaxRequestSize() int64
+
+	// SetClientTimeout sets time, after which idle client connections are closed, zero disables the timeout
+	SetClientTimeout(timeout time.Duration)
+
+	// ClientTimeout returns time, after which idle client connections are closed, zero if they are never closed
+	ClientTimeout() time.Duration
+
+	// ConnectedClients returns count of open connections
+	ConnectedClients() int
+
+	// TotalConnections returns count of connections, accepted since start
+	TotalConnections() int64
+
+	// SetMaxClients sets limit of count of open connections, zero disables the limit
+	SetMaxClients(max int)
+
+	// MaxClients returns limit of count of open connections, zero if unlimited
+	MaxClients() int
+
+	// SetClientRateLimit sets limit of commands per second of a single connection, zero disables the limit
+	SetClientRateLimit(rate int)
+
+	// ClientRateLimit returns limit of commands per second of a single connection, zero if unlimited
+	ClientRateLimit() int
 }
 
 var _ ApiServer = (*restless.Server)(nil)
@@ -34,21 +68,40 @@ type Core interface {
 
 	// Keys returns all keys matching glob pattern
 	Keys(pattern string) (result []string)
+	KeysFunc(pattern string, write func(count int, forEach func(yield func(key string))))
+
+	// DbSize returns count of keys in the storage, including expired, but not collected yet
+	DbSize() int
+
+	// Compact releases memory, held by the storage after removal of items. Returns false, if it isn't supported
+	Compact() bool
 
 	// Get the value of key. If the key does not exist the special value nil is returned.
 	Get(key string) (result []byte, err error)
 
 	// Set key to hold the string value.
 	Set(key string, value []byte)
+	SetWithOptions(key string, value []byte, options []string) (err error)
+
+	// CompareAndSwap Sets key to hold the string value, only if the current value equals to expected.
+	CompareAndSwap(key string, expected, value []byte, options []string) (result int, err error)
+	Type(key string) (result string)
 
 	// Set key to hold the string value and set key to timeout after a given number of seconds.
 	SetEx(key string, seconds int, value []byte)
 
+	// IncrByFloat Increments the floating point number stored at key by the specified increment.
+	IncrByFloat(key, increment string) (result []byte, err error)
+
 	// Del Removes the specified keys, ignoring not existing and returns count of actually removed values.
-	Del(keys []string) (count int)
+	Del(keys []string) (count int64)
 
 	// DSet Sets field in the hash stored at key to value.
-	DSet(key, field string, value []byte) (count int, err error)
+	DSet(key, field string, value []byte) (count int64, err error)
+	// DSetMany Sets fields in the hash stored at key to their values atomically.
+	DSetMany(key string, fieldsValues [][]byte) (count int64, err error)
+	// DSetManyEx Sets fields in the hash stored at key to their values and sets key to timeout after a given number of seconds.
+	DSetManyEx(key string, seconds int, fieldsValues [][]byte) (count int64, err error)
 
 	// DGet Returns the value associated with field in the dict stored at key.
 	DGet(key, field string) (result []byte, err error)
@@ -59,11 +112,17 @@ type Core interface {
 	// DGetAll Returns all fields and values of the hash stored at key.
 	DGetAll(key string) (result [][]byte, err error)
 
+	// DGetAllFunc is a streaming version of DGetAll: write gets values of the locked hash without copying
+	DGetAllFunc(key string, write func(count int, forEach func(yield func(field string, value []byte)))) error
+
 	// DDel Removes the specified fields from the hash stored at key.
-	DDel(key string, fields []string) (count int, err error)
+	DDel(key string, fields []string) (count int64, err error)
+
+	// DIncrByFloat Increments the floating point number stored at field in the dict stored at key by the specified increment.
+	DIncrByFloat(key, field, increment string) (result []byte, err error)
 
 	// LLen Returns the length of the list stored at key.
-	LLen(key string) (count int, err error)
+	LLen(key string) (count int64, err error)
 
 	// LRange returns the specified elements of the list stored at key.
 	LRange(key string, start, stop int) (result [][]byte, err error)
@@ -71,24 +130,133 @@ type Core interface {
 	// LIndex Returns the element at index index in the list stored at key.
 	LIndex(key string, index int) (result []byte, err error)
 
+	// LPos Returns the index of the first element equal to element in the list stored at key.
+	LPos(key string, element []byte, options []string) (positions []int, err error)
+
 	// LSet Sets the list element at index to value.
 	LSet(key string, index int, value []byte) (err error)
 
 	// LPush Insert all the specified values at the head of the list stored at key.
-	LPush(key string, values [][]byte) (count int, err error)
+	LPush(key string, values [][]byte) (count int64, err error)
+
+	// LPushCapped Inserts values at the head of the list stored at key, keeping length of the list within maxLen
+	LPushCapped(key string, maxLen int, policy string, values [][]byte) (count int64, err error)
+
+	// LPushEx Inserts values at the head of the list stored at key and sets key to timeout after a given number of seconds.
+	LPushEx(key string, seconds int, values [][]byte) (count int64, err error)
+
+	// LPushCappedEx Inserts values at the head of the list stored at key, keeping length of the list within maxLen,
+	// and sets key to timeout after a given number of seconds
+	LPushCappedEx(key string, seconds int, maxLen int, policy string, values [][]byte) (count int64, err error)
 
 	// LPop Removes and returns the first element of the list stored at key.
 	LPop(key string) (result []byte, err error)
 
+	// Sort Returns the elements of the list stored at key, sorted as numbers in ascending order.
+	Sort(key string, options []string) (result [][]byte, err error)
+
 	// Ttl Returns the remaining time to live of a key that has a timeout.
 	Ttl(key string) (ttl int, err error)
 
+	// ExpireTime Returns the absolute Unix time in seconds, at which the key will expire.
+	ExpireTime(key string) (timestamp int64, err error)
+
+	// PExpireTime Returns the absolute Unix time in milliseconds, at which the key will expire.
+	PExpireTime(key string) (timestamp int64, err error)
+
 	// Expire Sets a timeout on key. After the timeout has expired, the key will automatically be deleted.
 	Expire(key string, seconds int) (result int)
 
 	// Persist Removes the existing timeout on key.
 	Persist(key string) (result int)
 
+	// Meta Returns metadata of the value stored at key: times of its creation and the last modification, and TTL.
+	Meta(key string) (result [][]byte, err error)
+
+	// GetRange Returns the substring of the string value stored at key, determined by the offsets start and end.
+	GetRange(key string, start, end int) (result []byte, err error)
+
+	// SetRange Overwrites part of the string stored at key, starting at the specified offset.
+	SetRange(key string, offset int, value []byte) (length int64, err error)
+
+	// SetBit Sets or clears the bit at offset in the string value stored at key.
+	SetBit(key string, offset, value int) (result int, err error)
+
+	// GetBit Returns the bit value at offset in the string value stored at key.
+	GetBit(key string, offset int) (result int, err error)
+
+	// BitCount Counts the number of set bits in the string value stored at key.
+	BitCount(key string, bounds []int) (count int64, err error)
+
+	// BitField Performs GET, SET and INCRBY operations over integers of arbitrary width, stored in the string at key.
+	BitField(key string, operations []string) (result []*int64, err error)
+
+	// BitOp Performs a bitwise operation between strings stored at keys and stores the result in destKey.
+	BitOp(operation, destKey string, keys []string) (length int64, err error)
+
+	// Dump Serializes the value stored at key in a Radish-specific format.
+	Dump(key string) (result []byte, err error)
+
+	// Restore Creates a key associated with a value, obtained by deserializing the value, produced by DUMP.
+	Restore(key string, milliseconds int, value []byte, options []string) (err error)
+
+	// ZAdd Adds all the specified members with the specified scores to the sorted set stored at key.
+	ZAdd(key string, scoreMembers []string) (count int64, err error)
+
+	// ZScore Returns the score of member in the sorted set at key.
+	ZScore(key, member string) (result []byte, err error)
+
+	// ZCard Returns the number of elements of the sorted set stored at key.
+	ZCard(key string) (count int64, err error)
+
+	// ZRank Returns the rank of member in the sorted set stored at key, with the scores ordered from low to high.
+	ZRank(key, member string) (rank int, err error)
+
+	// ZRange Returns the specified range of elements in the sorted set stored at key.
+	ZRange(key string, start, stop int, options []string) (result [][]byte, err error)
+
+	// ZIncrBy Increments the score of member in the sorted set stored at key by increment.
+	ZIncrBy(key, increment, member string) (result []byte, err error)
+
+	// ZRangeByScore Returns all the elements in the sorted set at key with a score between min and max.
+	ZRangeByScore(key, min, max string, options []string) (result [][]byte, err error)
+
+	// ZRem Removes the specified members from the sorted set stored at key.
+	ZRem(key string, members []string) (count int64, err error)
+
+	// DRandField Returns random fields, optionally followed by values, from the dict stored at key
+	DRandField(key string, count int, withValues bool) (result [][]byte, err error)
+
+	// Version returns version of the item stored at key, that changes on every modification of the item
+	Version(key string) (version uint64)
+
+	// ObjectEncoding returns name of internal representation of the value stored at key
+	ObjectEncoding(key string) (encoding string, err error)
+
+	// ObjectRefcount returns count of references to the value stored at key
+	ObjectRefcount(key string) (count int, err error)
+
+	// ObjectIdletime returns number of seconds since the last access to the value stored at key
+	ObjectIdletime(key string) (seconds int, err error)
+
+	// DebugObject returns description of the value stored at key like Redis DEBUG OBJECT does
+	DebugObject(key string) (result string, err error)
+
+	// SetExpiredHandler sets handler, invoked for every item removed by CollectExpired()
+	SetExpiredHandler(handler func(key string))
+
+	// SetSortHashFields enables lexicographical order of fields, returned by HKEYS and HGETALL
+	SetSortHashFields(enabled bool)
+
+	// ExportRDB writes all not expired items into w in Redis RDB format
+	ExportRDB(w io.Writer) error
+
+	// IsSortHashFields returns true, if HKEYS and HGETALL return fields in lexicographical order
+	IsSortHashFields() bool
+
+	// At returns the core, that processes requests at the moment now, like they were done at the moment. It's used to replay WAL
+	At(now time.Time) *core.Core
+
 	// Storage returns reference to underlying storage to persisting
 	Storage() core.Storage
 
@@ -98,35 +266,90 @@ type Core interface {
 
 var _ Core = (*core.Core)(nil)
 
+// Publisher delivers messages to pub/sub subscribers
+type Publisher interface {
+	// Publish sends message to subscribers of the channel and returns count of receivers
+	Publish(channel string, message []byte) (count int)
+}
+
+var _ Publisher = (*resp.Server)(nil)
+
 var (
-	ErrServerShutdown = errors.New("server shutdown")
+	ErrServerShutdown     = errors.New("server shutdown")
+	ErrServerNotRunning   = errors.New("server isn't running")
+	ErrTransactionAborted = errors.New("transaction aborted: watched key changed")
+	ErrExecWithoutMulti   = errors.New("EXEC without MULTI")
+	ErrInvalidTransaction = errors.New("not a transaction")
+	ErrNotAllowedInMulti  = errors.New("command not allowed inside a transaction")
+	ErrNotAllowedInScript = errors.New("this command is not allowed from script")
+	ErrInvalidWatchedKeys = errors.New("watched keys must be key/version pairs")
+	ErrNotPersistent      = errors.New("can't SAVE: persistence disabled")
+	ErrCommandTimeout     = errors.New("command execution timed out")
+	ErrTooManyKeys        = errors.New("too many keys to scan, see keys-scan-limit")
+	ErrInvalidTtlJitter   = errors.New("TTL jitter must be in range 0..100 percent")
+	ErrInvalidOverflow    = errors.New("list overflow policy must be error or trim")
+	ErrInternal           = errors.New("internal error while processing the command, see server logs")
 )
 
 //go:generate go run ../tools/gen-processor/main.go
 
 type Controller struct {
-	host                   string
-	port                   int
-	dataDir                string
-	isPersistent           bool //if true, persists data on disk
-	collectExpiredInterval time.Duration
+	host string
+	port int
 
 	srv       ApiServer
-	core      Core
-	keeper    *Keeper
-	processor *Processor
+	publisher Publisher
+	store     *Store
+	scripts   *scriptCache
 
-	// wg to wait for service storage-updating goroutines (CollectExpired(), etc)
-	serviceWg sync.WaitGroup
 	// wg to wait for request handlers
 	handlerWg sync.WaitGroup
 
+	// transactionMutex guarantees, that no other commands interleave with a transaction:
+	// regular commands hold it for read, transaction -- for write
+	transactionMutex sync.RWMutex
+
+	// notifyFlags are NotifyFlags of enabled keyspace notifications, accessed atomically
+	notifyFlags uint32
+
+	// readOnly is 1 in read-only mode, accessed atomically
+	readOnly uint32
+	// stopWritesOnError is 1, if modifying commands are rejected, while the store fails to persist data. Accessed atomically
+	stopWritesOnError uint32
+
+	// commandTimeout is a time.Duration, after which read-only command is answered by timeout error. Accessed atomically
+	commandTimeout int64
+
+	// commandCalls are counters of processed commands by name, commands of commandTable only. Counters accessed atomically
+	commandCalls map[string]*int64
+
+	// totalCommands is a count of all processed commands, including unknown ones. Accessed atomically
+	totalCommands int64
+
+	// keysScanLimit is a max count of keys in the storage, scanned by KEYS. Accessed atomically
+	keysScanLimit int64
+
+	// hotKeys counts accesses of keys of sampled commands, disabled by default
+	hotKeys hotKeys
+
+	// debugEnabled allows DEBUG command
+	debugEnabled bool
+
+	// importRdbFilename is a Redis RDB file, imported on start into the empty storage
+	importRdbFilename string
+
+	shutdownOnce sync.Once
+
 	isRunningMutex sync.Mutex
 	isRunningFlag  bool
 	stopChan       chan struct{}
 }
 
 var _ api.MessageHandler = (*Controller)(nil)
+var _ api.HealthChecker = (*Controller)(nil)
+var _ api.WalWaiter = (*Controller)(nil)
+var _ api.TransactionChecker = (*Controller)(nil)
+var _ api.TransactionHandler = (*Controller)(nil)
 
 // New Constructs new instance of Controller
 func New(
@@ -138,56 +361,99 @@ func New(
 	useHttp bool,
 ) *Controller {
 	c := Controller{
-		host:                   host,
-		port:                   port,
-		core:                   core.New(storageFactory()),
-		stopChan:               make(chan struct{}),
-		collectExpiredInterval: collectInterval,
-		dataDir:                dataDir,
-		isPersistent:           dataDir != "",
+		host:         host,
+		port:         port,
+		stopChan:     make(chan struct{}),
+		scripts:      newScriptCache(),
+		commandCalls: newCommandCalls(),
+		// like Redis stop-writes-on-bgsave-error, fail fast by default
+		stopWritesOnError: 1,
+		store: NewStore(dataDir, StoreOptions{
+			SyncPolicy:             syncPolicy,
+			CollectExpiredInterval: collectInterval,
+			MergeWalInterval:       mergeWalInterval,
+		}),
 	}
 
 	if useHttp {
 		c.srv = restless.NewServer(host, port, &c)
 	} else {
-		c.srv = resp.NewServer(host, port, &c)
+		srv := resp.NewServer(host, port, &c)
+		c.srv = srv
+		c.publisher = srv
 	}
 
-	c.processor = NewProcessor(c.core)
-
-	if c.isPersistent {
-		c.keeper = NewKeeper(
-			c.core,
-			dataDir,
-			syncPolicy,
-			mergeWalInterval,
-			storageFactory,
-		)
-	}
+	c.store.core.SetExpiredHandler(c.notifyExpired)
 
 	return &c
 }
 
+// SetFileNames configures names of snapshot and WAL files in the data dir. It must be invoked before ListenAndServe()
+func (c *Controller) SetFileNames(names FileNames) error {
+	return c.store.SetFileNames(names)
+}
+
+// SetWalFormat sets encoding of new WAL files. It must be invoked before ListenAndServe()
+func (c *Controller) SetWalFormat(format WalFormat) {
+	c.store.SetWalFormat(format)
+}
+
+// SetReplayWorkers sets a count of goroutines, replaying WAL requests in parallel. It must be invoked before ListenAndServe()
+func (c *Controller) SetReplayWorkers(count int) {
+	c.store.SetReplayWorkers(count)
+}
+
+// SetRefuseWalGaps makes missing messages in WAL a start error instead of a warning. It must be invoked before ListenAndServe()
+func (c *Controller) SetRefuseWalGaps(refuse bool) {
+	c.store.SetRefuseWalGaps(refuse)
+}
+
+// SetMemoryPurgeInterval sets an interval of periodic memory purge, like by MEMORY PURGE, zero disables it.
+// It must be invoked before ListenAndServe()
+func (c *Controller) SetMemoryPurgeInterval(interval time.Duration) {
+	c.store.SetMemoryPurgeInterval(interval)
+}
+
+// SetImportRdb sets Redis RDB file, that is imported on start, if the storage is empty.
+// It must be invoked before ListenAndServe()
+func (c *Controller) SetImportRdb(filename string) {
+	c.importRdbFilename = filename
+}
+
 // ListenAndServe starts a new radish server
 func (c *Controller) ListenAndServe() error {
-	if c.isPersistent {
-		if err := c.keeper.Start(); err != nil {
+	if err := c.store.Start(); err != nil {
+		return err
+	}
+
+	if c.importRdbFilename != "" {
+		if err := c.importRdbFile(c.importRdbFilename); err != nil {
 			return err
 		}
 	}
 
 	c.start()
 
-	// Don't forget to add all background service processes to wg!
-	c.serviceWg.Add(1)
-	go c.runCollector()
-
 	log.Notice("Radish ready to serve at %s:%d", c.host, c.port)
 	return c.srv.ListenAndServe()
 }
 
-// Shutdown gracefully shuts server down
+// Shutdown gracefully shuts server down and persists data
 func (c *Controller) Shutdown() {
+	c.shutdown(true)
+}
+
+// ShutdownNoSave gracefully shuts server down without persisting snapshot: changes are kept in WAL only
+func (c *Controller) ShutdownNoSave() {
+	c.shutdown(false)
+}
+
+// shutdown shuts server down only once, concurrent calls wait until shutdown completes
+func (c *Controller) shutdown(save bool) {
+	c.shutdownOnce.Do(func() { c.doShutdown(save) })
+}
+
+func (c *Controller) doShutdown(save bool) {
 	for !c.isRunning() {
 		//wait, while server finishes startup
 		time.Sleep(100 * time.Millisecond)
@@ -197,23 +463,80 @@ func (c *Controller) Shutdown() {
 	c.stop()
 	c.srv.Stop()
 
-	//wait other goroutines that may interact with storage
-	c.serviceWg.Wait()
+	//wait request handlers, the store waits for it's own background goroutines
 	c.handlerWg.Wait()
 
-	//OK, no more concurrent threads working with storage
-	if c.isPersistent {
-		if err := c.keeper.Shutdown(); err != nil {
-			log.Error(err.Error())
-		}
+	var err error
+	if save {
+		err = c.store.Close()
+	} else {
+		err = c.store.CloseNoSave()
+	}
+	if err != nil {
+		log.Error(err.Error())
 	}
 
 	c.srv.Shutdown()
 	log.Notice("Goodbye!")
 }
 
-// HandleMessage processes Request and return Response
+// CheckHealth returns nil, if controller is running and able to persist data
+func (c *Controller) CheckHealth() error {
+	if !c.isRunning() {
+		return ErrServerNotRunning
+	}
+
+	return c.store.CheckHealth()
+}
+
+// HandleMessage processes Request and return Response.
+// Transactions are rejected: unpacking of EXEC request isn't safe for arbitrary arguments, see HandleTransaction
 func (c *Controller) HandleMessage(request *message.Request) message.Response {
+	if request.Cmd == message.CmdExec {
+		return getResponseCommandError(request.Cmd, ErrExecWithoutMulti)
+	}
+
+	return c.handleRequest(request)
+}
+
+// HandleTransaction processes requests, queued inside MULTI and packed by message.NewRequestTransaction, atomically
+func (c *Controller) HandleTransaction(transaction *message.Request) message.Response {
+	if transaction.Cmd != message.CmdExec {
+		return getResponseInvalidArguments(transaction.Cmd, ErrInvalidTransaction)
+	}
+
+	return c.handleRequest(transaction)
+}
+
+// handleRequest is handleMessage with panic recovery and latency monitoring
+func (c *Controller) handleRequest(request *message.Request) (response message.Response) {
+	defer c.recoverPanic(request, &response)
+
+	// WAIT blocks intentionally, so it isn't a latency spike
+	if c.store.latency.isEnabled() && request.Cmd != "WAIT" {
+		defer c.store.latency.measure(latencyEventCommand, time.Now())
+	}
+
+	return c.handleMessage(request)
+}
+
+// recoverPanic converts panic, raised while processing request, into an error response and logs the stack trace,
+// so a bug in a single command doesn't take down the whole server. Locks, released by defer, are released on panic too.
+// It MUST be deferred directly
+func (c *Controller) recoverPanic(request *message.Request, response *message.Response) {
+	if r := recover(); r != nil {
+		fields := log.Fields{"cmd": request.Cmd}
+		// WAL id of pipelined request is assigned concurrently by WAL writer
+		if !request.Unreliable && request.Id != 0 {
+			fields["request_id"] = request.Id
+		}
+		log.WithFields(fields).Errorf("Panic while processing %s: %v\n%s", request.Cmd, r, debug.Stack())
+		*response = getResponseCommandError(request.Cmd, ErrInternal)
+	}
+}
+
+// handleMessage is HandleMessage without panic recovery
+func (c *Controller) handleMessage(request *message.Request) message.Response {
 	select {
 	case <-c.stopChan:
 		return getResponseCommandError(request.Cmd, ErrServerShutdown)
@@ -223,33 +546,319 @@ func (c *Controller) HandleMessage(request *message.Request) message.Response {
 
 	// It's OK to do wg.Add() inside a goroutine, due to c.stop() invoked BEFORE c.handlerWg.Wait()
 	c.handlerWg.Add(1)
+	defer c.handlerWg.Done()
+
+	return c.dispatch(request, nil)
+}
 
-	response := c.processor.Process(request)
+// dispatch routes the request to it's handler. Requests of a transaction or a script are routed the same way
+// as standalone ones, but core requests are processed by the run, that already holds c.transactionMutex
+func (c *Controller) dispatch(request *message.Request, run *atomicRun) message.Response {
+	c.countCommand(request.Cmd)
+	c.hotKeys.sample(request)
 
-	if c.isPersistent && response.Status() == message.StatusOk && c.processor.IsModifyingRequest(request) {
-		if err := c.keeper.WriteToWal(request); err != nil {
-			c.handlerWg.Done()
+	if run != nil {
+		// requests were queued before EXEC, but actually applied now
+		request.Timestamp = run.timestamp
+		if err := run.check(request); err != nil {
 			return getResponseCommandError(request.Cmd, err)
 		}
 	}
 
-	c.handlerWg.Done()
+	switch request.Cmd {
+	case message.CmdExec:
+		return c.handleTransaction(request)
+	case message.CmdWatch:
+		return c.handleWatch(request)
+	case "EVAL", "EVALSHA":
+		return c.handleEval(request, run)
+	case "SCRIPT":
+		return c.handleScript(request)
+	case "CONFIG":
+		return c.handleConfig(request)
+	case "INFO":
+		return c.handleInfo(request)
+	case "OBJECT":
+		return c.handleObject(request)
+	case "KEYS":
+		return c.handleKeys(request, run)
+	case "DELPATTERN":
+		return c.handleDelPattern(request, run)
+	case "HGETALL":
+		// streaming couldn't be timed out, so with execution budget HGETALL is processed like other commands.
+		// Inside a run the lock is already held, so the stream couldn't lock it later
+		if run == nil && c.CommandTimeout() == 0 {
+			return c.handleHGetAll(request)
+		}
+	case "HRANDFIELD":
+		return c.handleHRandField(request)
+	case "DEBUG":
+		return c.handleDebug(request, run)
+	case "WAIT":
+		return c.handleWait(request)
+	case "SHUTDOWN":
+		return c.handleShutdown(request)
+	case "EXPORTRDB":
+		return c.handleExportRdb(request)
+	case "EXPLAIN":
+		return c.handleExplain(request)
+	case "MEMORY":
+		return c.handleMemory(request)
+	case "LATENCY":
+		return c.handleLatency(request)
+	case "COMMAND":
+		return c.handleCommand(request)
+	case "HOTKEYS":
+		return c.handleHotKeys(request)
+	}
+
+	if run != nil {
+		return run.process(request)
+	}
+
+	if err := c.writeRejection(request); err != nil {
+		return getResponseCommandError(request.Cmd, err)
+	}
+
+	if timeout := c.CommandTimeout(); timeout > 0 && !c.store.processor.IsModifyingRequest(request) {
+		return c.processWithTimeout(request, timeout)
+	}
+
+	response, notifyKeys := c.processRequest(request)
+	c.notifyRequest(request, response, notifyKeys)
 	return response
 }
 
-func (c *Controller) runCollector() {
-	defer c.serviceWg.Done()
+// processRequest processes request by the store and returns keys to notify about.
+// WAL writing also guarded to keep the same order of requests in the storage and in the WAL
+func (c *Controller) processRequest(request *message.Request) (response message.Response, notifyKeys []string) {
+	c.transactionMutex.RLock()
+	defer c.transactionMutex.RUnlock()
 
-	tick := time.Tick(c.collectExpiredInterval)
-	for {
-		select {
-		case <-c.stopChan:
-			return
-		case <-tick:
-			count := c.core.CollectExpired()
-			log.Debugf("Collected %d expired items", count)
+	notifyKeys = c.keysToNotify(request)
+	return c.store.Process(request), notifyKeys
+}
+
+// processWithTimeout processes read-only request in background and returns timeout error, if it isn't processed in time.
+// Core operations couldn't be cancelled, so timed out request still runs until completion, timeout just releases the client.
+// Modifying requests aren't processed here, because they would be applied after the client got an error
+func (c *Controller) processWithTimeout(request *message.Request, timeout time.Duration) message.Response {
+	// buffered to let the processing goroutine exit after timeout
+	done := make(chan message.Response, 1)
+	// the request keeps running after timeout, so Shutdown must wait for it as well
+	c.handlerWg.Add(1)
+	go func() {
+		var response message.Response
+		defer func() { done <- response }()
+		defer c.handlerWg.Done()
+		defer c.recoverPanic(request, &response)
+
+		c.transactionMutex.RLock()
+		defer c.transactionMutex.RUnlock()
+		response = c.store.Process(request)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case response := <-done:
+		return response
+	case <-timer.C:
+		log.WithFields(log.Fields{"cmd": request.Cmd}).Warningf("%s timed out after %s", request.Cmd, timeout)
+		return getResponseCommandError(request.Cmd, ErrCommandTimeout)
+	}
+}
+
+// handleShutdown processes SHUTDOWN [NOSAVE|SAVE] request.
+// Server shuts down in background, after handlers of all current requests, including this one, finished
+func (c *Controller) handleShutdown(request *message.Request) message.Response {
+	save := true
+
+	if len(request.Args) > 1 {
+		return getResponseInvalidArguments(request.Cmd, core.ErrSyntax)
+	}
+	if len(request.Args) == 1 {
+		switch strings.ToUpper(string(request.Args[0])) {
+		case "NOSAVE":
+			save = false
+		case "SAVE":
+			if !c.store.isPersistent {
+				return getResponseCommandError(request.Cmd, ErrNotPersistent)
+			}
+		default:
+			return getResponseInvalidArguments(request.Cmd, core.ErrSyntax)
 		}
 	}
+
+	go c.shutdown(save)
+
+	return getResponseStatusOkPayload()
+}
+
+// handleTransaction processes all requests, packed into EXEC request, atomically
+// and writes successful modifying ones into WAL as a single record
+func (c *Controller) handleTransaction(request *message.Request) message.Response {
+	requests, err := request.TransactionRequests()
+	if err != nil {
+		return getResponseInvalidArguments(request.Cmd, err)
+	}
+
+	run := &atomicRun{controller: c, timestamp: request.Timestamp}
+	// publish notifications after unlocking, to not block other requests by slow subscribers
+	defer c.notifyPending(&run.notifications)
+
+	c.transactionMutex.Lock()
+	defer c.transactionMutex.Unlock()
+
+	if len(requests) > 0 && requests[0].Cmd == message.CmdWatch {
+		changed, err := c.isWatchedChanged(requests[0])
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		if changed {
+			return getResponseCommandError(request.Cmd, ErrTransactionAborted)
+		}
+
+		requests = requests[1:]
+	}
+
+	// like in Redis, transaction with modifying commands is rejected entirely
+	for _, r := range requests {
+		if err := c.writeRejection(r); err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+	}
+
+	responses := make([]message.Response, len(requests))
+	for i, r := range requests {
+		responses[i] = c.dispatch(r, run)
+	}
+
+	if err := run.writeToWal(request); err != nil {
+		return getResponseCommandError(request.Cmd, err)
+	}
+
+	return getResponseArrayPayload(responses)
+}
+
+// atomicRun is a single execution of a transaction or a script: no other commands interleave with it's requests
+// and successful modifying ones are written into WAL as a single record. MUST be used only while c.transactionMutex locked!
+type atomicRun struct {
+	controller *Controller
+	timestamp  int64
+	// isScript is true for scripts, that are restricted by noscript flag instead of no_multi one
+	isScript      bool
+	walRequests   []*message.Request
+	notifications []pendingNotification
+}
+
+// check returns error, if the command isn't allowed inside the run
+func (r *atomicRun) check(request *message.Request) error {
+	info, ok := commandTable[request.Cmd]
+	switch {
+	case !ok:
+		// unknown commands are rejected by the processor
+		return nil
+	case r.isScript && info.hasFlag("noscript"):
+		return ErrNotAllowedInScript
+	case !r.isScript && info.hasFlag("no_multi"):
+		return ErrNotAllowedInMulti
+	default:
+		return nil
+	}
+}
+
+// process processes core request and collects it for WAL and notifications
+func (r *atomicRun) process(request *message.Request) message.Response {
+	c := r.controller
+	request.Timestamp = r.timestamp
+	if err := c.writeRejection(request); err != nil {
+		return getResponseCommandError(request.Cmd, err)
+	}
+
+	notifyKeys := c.keysToNotify(request)
+	c.store.rewriteRequest(request)
+	response := c.store.processor.Process(request)
+	if response.Status() == message.StatusOk && c.store.processor.IsModifyingRequest(request) {
+		r.walRequests = append(r.walRequests, request)
+	}
+	r.notifications = append(r.notifications, pendingNotification{request, response, notifyKeys})
+
+	return response
+}
+
+// merge appends effects of the nested run, like a script inside a transaction, to the run
+func (r *atomicRun) merge(nested *atomicRun) {
+	r.walRequests = append(r.walRequests, nested.walRequests...)
+	r.notifications = append(r.notifications, nested.notifications...)
+}
+
+// writeToWal writes successful modifying requests of the run, initiated by request, into WAL as a single record
+func (r *atomicRun) writeToWal(request *message.Request) error {
+	c := r.controller
+	if !c.store.isPersistent || len(r.walRequests) == 0 {
+		return nil
+	}
+
+	walRequest, err := message.NewRequestTransaction(r.walRequests)
+	if err != nil {
+		return err
+	}
+
+	walRequest.Unreliable = request.Unreliable
+	return c.store.WriteToWal(walRequest)
+}
+
+// CheckQueuedRequest returns error response, if the request couldn't be executed inside a transaction:
+// the command is unknown, has wrong count of arguments or isn't allowed inside a transaction. Otherwise returns nil
+func (c *Controller) CheckQueuedRequest(request *message.Request) message.Response {
+	info, ok := commandTable[request.Cmd]
+	if !ok {
+		return message.NewResponseStatus(message.StatusInvalidCommand, "unknown command: "+request.Cmd)
+	}
+
+	argsCount := len(request.Args) + 1
+	if info.arity >= 0 && argsCount != info.arity || info.arity < 0 && argsCount < -info.arity {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+	if info.hasFlag("no_multi") {
+		return getResponseCommandError(request.Cmd, ErrNotAllowedInMulti)
+	}
+
+	return nil
+}
+
+// handleWatch returns current versions of requested keys.
+// Transport should pass key/version pairs as a WATCH request, leading the transaction
+func (c *Controller) handleWatch(request *message.Request) message.Response {
+	versions := make([][]byte, len(request.Args))
+	for i, key := range request.Args {
+		versions[i] = []byte(strconv.FormatUint(c.store.core.Version(string(key)), 10))
+	}
+
+	return getResponseStringSlicePayload(versions)
+}
+
+// isWatchedChanged returns true, if any of the keys of WATCH request was modified since WATCH.
+// MUST be invoked only while c.transactionMutex locked!
+func (c *Controller) isWatchedChanged(watch *message.Request) (bool, error) {
+	if len(watch.Args)%2 != 0 {
+		return false, ErrInvalidWatchedKeys
+	}
+
+	for i := 0; i < len(watch.Args); i += 2 {
+		version, err := strconv.ParseUint(string(watch.Args[i+1]), 10, 64)
+		if err != nil {
+			return false, ErrInvalidWatchedKeys
+		}
+
+		if c.store.core.Version(string(watch.Args[i])) != version {
+			return true, nil
+		}
+	}
+
+	return false, nil
 }
 
 func (c *Controller) start() {
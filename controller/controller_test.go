@@ -0,0 +1,1078 @@
+package controller_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/mshaverdo/radish/api"
+	"github.com/mshaverdo/radish/controller"
+	"github.com/mshaverdo/radish/log"
+	"github.com/mshaverdo/radish/message"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestController_HandleMessageShutdown(t *testing.T) {
+	tests := []struct {
+		args         []string
+		wantStatus   message.Status
+		wantSnapshot bool
+	}{
+		{nil, message.StatusOk, true},
+		{[]string{"save"}, message.StatusOk, true},
+		{[]string{"NOSAVE"}, message.StatusOk, false},
+		{[]string{"ABORT"}, message.StatusInvalidArguments, true},
+	}
+
+	log.SetLevel(log.CRITICAL)
+	for _, tst := range tests {
+		dataDir, err := ioutil.TempDir("", "radish")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := startTestController(t, dataDir, controller.SyncAlways, time.Hour, true)
+
+		c.HandleMessage(message.NewRequest("SET", [][]byte{[]byte("key"), []byte("value")}))
+
+		args := make([][]byte, len(tst.args))
+		for i, v := range tst.args {
+			args[i] = []byte(v)
+		}
+		response := c.HandleMessage(message.NewRequest("SHUTDOWN", args))
+		if response.Status() != tst.wantStatus {
+			t.Errorf("SHUTDOWN %v: got status %s, want %s", tst.args, response.Status(), tst.wantStatus)
+		}
+		if response.Status() != message.StatusOk {
+			c.Shutdown()
+		}
+
+		c.waitShutdown(t)
+
+		_, err = os.Stat(filepath.Join(dataDir, "storage.gob"))
+		if gotSnapshot := err == nil; gotSnapshot != tst.wantSnapshot {
+			t.Errorf("SHUTDOWN %v: snapshot exists: got %t, want %t", tst.args, gotSnapshot, tst.wantSnapshot)
+		}
+
+		// data must be restored either from snapshot or from WAL
+		s, err := controller.OpenStore(dataDir, controller.DefaultStoreOptions())
+		if err != nil {
+			t.Fatalf("SHUTDOWN %v: OpenStore(): %s", tst.args, err)
+		}
+		if got, err := s.Core().Get("key"); string(got) != "value" || err != nil {
+			t.Errorf("SHUTDOWN %v: after restart got %q, %v, want %q", tst.args, got, err, "value")
+		}
+		s.Close()
+
+		os.RemoveAll(dataDir)
+	}
+}
+
+func TestController_HandleMessageWait(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	c := startTestController(t, dataDir, controller.SyncNever, time.Hour, true)
+	defer c.Shutdown()
+
+	// pipelined requests are buffered in the userspace and written into WAL in background
+	for i := 0; i < 10; i++ {
+		request := message.NewRequest("SET", [][]byte{[]byte("key"), []byte("value")})
+		request.Unreliable = true
+		c.HandleMessage(request)
+	}
+
+	response := c.HandleMessage(message.NewRequest("WAIT", [][]byte{[]byte("0"), []byte("0")}))
+	if r, ok := response.(*message.ResponseInt); !ok || r.Payload() != 0 {
+		t.Fatalf("WAIT: got %v, want 0", response)
+	}
+
+	wals, _ := filepath.Glob(filepath.Join(dataDir, "wal_*.dat"))
+	if len(wals) != 1 {
+		t.Fatalf("WAIT: got WAL files %v, want one", wals)
+	}
+	if info, err := os.Stat(wals[0]); err != nil || info.Size() == 0 {
+		t.Errorf("WAIT: WAL is empty after sync")
+	}
+
+	for _, args := range [][]string{{"0"}, {"0", "-1"}, {"a", "0"}} {
+		request := message.NewRequest("WAIT", nil)
+		for _, arg := range args {
+			request.Args = append(request.Args, []byte(arg))
+		}
+
+		if response := c.HandleMessage(request); response.Status() != message.StatusInvalidArguments {
+			t.Errorf("WAIT %v: got status %s, want %s", args, response.Status(), message.StatusInvalidArguments)
+		}
+	}
+}
+
+func TestController_WaitWal(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	c := startTestController(t, dataDir, controller.SyncNever, time.Hour, false)
+	defer c.Shutdown()
+
+	// waitWal sends commands in a single write, so writes before WAITWAL are pipelined, and returns WAITWAL reply
+	waitWal := func(conn net.Conn, reader *bufio.Reader, writes int) (syncedId, issuedId int64) {
+		command := strings.Repeat("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n", writes) + "*2\r\n$7\r\nWAITWAL\r\n$1\r\n0\r\n"
+		if _, err := conn.Write([]byte(command)); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+
+		var lines []string
+		for len(lines) < writes+3 {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			lines = append(lines, strings.TrimSuffix(line, "\r\n"))
+		}
+		if reply := lines[writes:]; reply[0] != "*2" || reply[1][0] != ':' || reply[2][0] != ':' {
+			t.Fatalf("WAITWAL after %d writes: got %q, want array of two integers", writes, reply)
+		}
+
+		syncedId, _ = strconv.ParseInt(lines[writes+1][1:], 10, 64)
+		issuedId, _ = strconv.ParseInt(lines[writes+2][1:], 10, 64)
+		return syncedId, issuedId
+	}
+
+	writer, err := net.Dial("tcp", c.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	writerReader := bufio.NewReader(writer)
+
+	syncedId, issuedId := waitWal(writer, writerReader, 10)
+	if issuedId == 0 || syncedId < issuedId {
+		t.Errorf("WAITWAL after pipelined writes: got synced %d, issued %d, want durable writes", syncedId, issuedId)
+	}
+
+	// without new writes the connection keeps its issued id
+	if syncedId2, issuedId2 := waitWal(writer, writerReader, 0); issuedId2 != issuedId || syncedId2 < issuedId {
+		t.Errorf("WAITWAL without writes: got synced %d, issued %d, want issued %d", syncedId2, issuedId2, issuedId)
+	}
+
+	reader, err := net.Dial("tcp", c.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	// writes of other connections don't count
+	c.HandleMessage(message.NewRequest("GET", [][]byte{[]byte("key")}))
+	if _, issuedId := waitWal(reader, bufio.NewReader(reader), 0); issuedId != 0 {
+		t.Errorf("WAITWAL of connection without writes: got issued %d, want 0", issuedId)
+	}
+	writer.Close()
+	reader.Close()
+	c.waitClientsClosed(t)
+
+	for _, tst := range []struct {
+		request *message.Request
+		want    bool
+	}{
+		{message.NewRequest("SET", [][]byte{[]byte("key"), []byte("value")}), true},
+		{message.NewRequest("GET", [][]byte{[]byte("key")}), false},
+		{message.NewRequest("SORT", [][]byte{[]byte("key"), []byte("STORE"), []byte("dst")}), true},
+		{message.NewRequest("DELPATTERN", [][]byte{[]byte("*")}), true},
+		{message.NewRequest(message.CmdExec, nil), true},
+		{message.NewRequest("EVALSHA", [][]byte{[]byte("sha"), []byte("0")}), true},
+	} {
+		if got := c.IsModifyingRequest(tst.request); got != tst.want {
+			t.Errorf("IsModifyingRequest(%s %q): got %t, want %t", tst.request.Cmd, tst.request.Args, got, tst.want)
+		}
+	}
+}
+
+func TestController_WaitAsyncWriteFailure(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	c := startTestController(t, dataDir, controller.SyncNever, time.Hour, false)
+	defer c.Shutdown()
+
+	dial := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", c.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn, bufio.NewReader(conn)
+	}
+	// send sends commands in a single write, so writes are pipelined, and returns the first line of every reply
+	send := func(conn net.Conn, reader *bufio.Reader, commands ...string) []string {
+		if _, err := conn.Write([]byte(strings.Join(commands, ""))); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+
+		var lines []string
+		for len(lines) < len(commands) {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			lines = append(lines, strings.TrimSuffix(line, "\r\n"))
+		}
+		return lines
+	}
+	const (
+		set  = "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"
+		ping = "*1\r\n$4\r\nPING\r\n"
+		wait = "*3\r\n$4\r\nWAIT\r\n$1\r\n0\r\n$1\r\n0\r\n"
+	)
+
+	writer, writerReader := dial()
+	defer writer.Close()
+	other, otherReader := dial()
+	defer other.Close()
+	// the other client writes before the failure and makes sure, that its writes are durable
+	if got := send(other, otherReader, set, wait); got[1] != ":0" {
+		t.Fatalf("WAIT after durable writes: got %q, want :0", got[1])
+	}
+
+	c.FailWal(errors.New("disk full"))
+	if got := send(writer, writerReader, set, ping); got[0] != "+OK" {
+		t.Fatalf("pipelined SET: got %q, want +OK", got[0])
+	}
+	c.FailWal(nil)
+
+	// WAIT of the other client doesn't consume the failure of the writer
+	if got := send(other, otherReader, wait); got[0] != ":0" {
+		t.Errorf("WAIT of other client: got %q, want :0", got[0])
+	}
+	if got := send(writer, writerReader, wait); !strings.Contains(got[0], api.ErrAsyncWriteFailed.Error()) {
+		t.Errorf("WAIT after lost write: got %q, want %q", got[0], api.ErrAsyncWriteFailed)
+	}
+	// the failure is reported once
+	if got := send(writer, writerReader, wait); got[0] != ":0" {
+		t.Errorf("WAIT after reported failure: got %q, want :0", got[0])
+	}
+	writer.Close()
+	other.Close()
+	c.waitClientsClosed(t)
+}
+
+func TestModifyingCommands(t *testing.T) {
+	commands := make(map[string]bool)
+	for _, cmd := range message.ModifyingCommands() {
+		commands[cmd] = true
+	}
+
+	for cmd, want := range map[string]bool{
+		"SET": true, "LPUSHCAP": true, "LPUSHCAPEX": true, "BITFIELD": true, "DELPATTERN": true, "SORT": true,
+		"EVAL": true, "EVALSHA": true, "EXEC": true,
+		"GET": false, "KEYS": false, "HRANDFIELD": false,
+	} {
+		if commands[cmd] != want {
+			t.Errorf("ModifyingCommands() contains %s: got %t, want %t", cmd, commands[cmd], want)
+		}
+	}
+
+	// the list is generated for clients, that don't depend on the controller, so it must agree with the command table
+	for _, cmd := range controller.TableModifyingCommands() {
+		if !commands[cmd] {
+			t.Errorf("ModifyingCommands() doesn't contain %s, that is modifying in the command table", cmd)
+		}
+	}
+}
+
+func TestController_CheckQueuedRequest(t *testing.T) {
+	c := controller.New("localhost", 0, "", controller.SyncNever, 0, time.Hour, true)
+
+	for _, tst := range []struct {
+		request *message.Request
+		want    message.Status
+	}{
+		{message.NewRequest("SET", [][]byte{[]byte("key"), []byte("value")}), message.StatusOk},
+		{message.NewRequest("DELPATTERN", [][]byte{[]byte("*")}), message.StatusOk},
+		{message.NewRequest("EVAL", [][]byte{[]byte("return 1"), []byte("0")}), message.StatusOk},
+		{message.NewRequest("NOSUCHCOMMAND", nil), message.StatusInvalidCommand},
+		{message.NewRequest("GET", nil), message.StatusInvalidArguments},
+		{message.NewRequest("SET", [][]byte{[]byte("key")}), message.StatusInvalidArguments},
+		{message.NewRequest("WAIT", [][]byte{[]byte("0"), []byte("0")}), message.StatusError},
+		{message.NewRequest("SHUTDOWN", nil), message.StatusError},
+	} {
+		// nil response means the request is valid
+		response := c.CheckQueuedRequest(tst.request)
+		got := message.StatusOk
+		if response != nil {
+			got = response.Status()
+		}
+		if got != tst.want {
+			t.Errorf("CheckQueuedRequest(%s %q): got status %s, want %s", tst.request.Cmd, tst.request.Args, got, tst.want)
+		}
+	}
+}
+
+func TestController_HandleMessageExportRdb(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	c := startTestController(t, dataDir, controller.SyncNever, time.Hour, true)
+	defer c.Shutdown()
+
+	c.HandleMessage(message.NewRequest("SET", [][]byte{[]byte("key"), []byte("value")}))
+
+	response := c.HandleMessage(message.NewRequest("EXPORTRDB", nil))
+	if response.Status() != message.StatusOk {
+		t.Fatalf("EXPORTRDB: got status %s, want %s", response.Status(), message.StatusOk)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, "dump.rdb"))
+	if err != nil {
+		t.Fatalf("EXPORTRDB: %s", err)
+	}
+	if want := "REDIS0009\xfe\x00\x00\x03key\x05value\xff"; !strings.HasPrefix(string(data), want) {
+		t.Errorf("EXPORTRDB: got %q, want prefix %q", data, want)
+	}
+
+	response = c.HandleMessage(message.NewRequest("EXPORTRDB", [][]byte{[]byte("/tmp/dump.rdb")}))
+	if response.Status() != message.StatusInvalidArguments {
+		t.Errorf("EXPORTRDB with args: got status %s, want %s", response.Status(), message.StatusInvalidArguments)
+	}
+}
+
+func TestController_HandleMessageCommandTimeout(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+
+	c := startTestController(t, "", controller.SyncNever, time.Hour, true)
+	defer c.Shutdown()
+
+	for i := 0; i < 10000; i++ {
+		field := []byte(strconv.Itoa(i))
+		c.HandleMessage(message.NewRequest("HSET", [][]byte{[]byte("hash"), field, field}))
+	}
+	hgetall := message.NewRequest("HGETALL", [][]byte{[]byte("hash")})
+
+	c.SetCommandTimeout(time.Nanosecond)
+	if response := c.HandleMessage(hgetall); response.Status() != message.StatusError {
+		t.Errorf("HGETALL with timeout: got status %s, want %s", response.Status(), message.StatusError)
+	}
+	// modifying commands aren't timed out
+	if response := c.HandleMessage(message.NewRequest("HSET", [][]byte{[]byte("hash"), []byte("a"), []byte("b")})); response.Status() != message.StatusOk {
+		t.Errorf("HSET with timeout: got status %s, want %s", response.Status(), message.StatusOk)
+	}
+
+	if response := c.handle("CONFIG", "SET", "command-timeout", "-1"); response.Status() != message.StatusInvalidArguments {
+		t.Errorf("CONFIG SET command-timeout -1: got status %s, want %s", response.Status(), message.StatusInvalidArguments)
+	}
+	c.handle("CONFIG", "SET", "command-timeout", "0")
+	if response := c.HandleMessage(hgetall); response.Status() != message.StatusOk {
+		t.Errorf("HGETALL without timeout: got status %s, want %s", response.Status(), message.StatusOk)
+	}
+
+	c.handle("CONFIG", "SET", "keys-scan-limit", "1")
+	if got := c.handle("CONFIG", "GET", "keys-scan-limit").Bytes(); len(got) != 2 || string(got[1]) != "1" {
+		t.Errorf("CONFIG GET keys-scan-limit: got %q, want 1", got)
+	}
+	c.HandleMessage(message.NewRequest("SET", [][]byte{[]byte("key"), []byte("value")}))
+	if response := c.HandleMessage(message.NewRequest("KEYS", [][]byte{[]byte("*")})); response.Status() != message.StatusError {
+		t.Errorf("KEYS with limit 1: got status %s, want %s", response.Status(), message.StatusError)
+	}
+	c.handle("CONFIG", "SET", "keys-scan-limit", "2")
+	response := c.HandleMessage(message.NewRequest("KEYS", [][]byte{[]byte("*")}))
+	if response.Status() != message.StatusOk {
+		t.Errorf("KEYS with limit 2: got status %s, want %s", response.Status(), message.StatusOk)
+	}
+	// keys are collected before replying, so the storage isn't locked while the reply is written
+	if keys, ok := response.(*message.ResponseStringSlice); !ok || len(keys.Payload()) != 2 {
+		t.Errorf("KEYS with limit 2: got %T %v, want collected 2 keys", response, response)
+	}
+
+	// handshake probes of Redis tools
+	if got := c.handle("CONFIG", "GET", "save").Bytes(); len(got) != 2 || string(got[1]) != "" {
+		t.Errorf("CONFIG GET save: got %q, want empty value", got)
+	}
+	if got := c.handle("CONFIG", "GET", "appendonly").Bytes(); len(got) != 2 || string(got[1]) != "yes" {
+		t.Errorf("CONFIG GET appendonly: got %q, want yes", got)
+	}
+	if response := c.handle("CONFIG", "SET", "save", "900 1"); response.Status() != message.StatusInvalidArguments {
+		t.Errorf("CONFIG SET save: got status %s, want %s", response.Status(), message.StatusInvalidArguments)
+	}
+}
+
+func TestController_HandleMessageCommand(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+
+	c := startTestController(t, "", controller.SyncNever, time.Hour, true)
+	defer c.Shutdown()
+
+	all, ok := c.handle("COMMAND").(*message.ResponseArray)
+	if !ok {
+		t.Fatalf("COMMAND: got %T, want array", c.handle("COMMAND"))
+	}
+	count, ok := c.handle("COMMAND", "COUNT").(*message.ResponseInt)
+	if !ok || count.Payload() != int64(len(all.Payload())) || count.Payload() < 40 {
+		t.Errorf("COMMAND COUNT: got %v, want %d", c.handle("COMMAND", "COUNT"), len(all.Payload()))
+	}
+
+	info, ok := c.handle("COMMAND", "INFO", "get", "lpush", "unknown").(*message.ResponseArray)
+	if !ok || len(info.Payload()) != 3 {
+		t.Fatalf("COMMAND INFO: got %v, want 3 replies", info)
+	}
+	get := info.Payload()[0].(*message.ResponseArray).Payload()
+	if len(get) != 6 || string(get[0].Bytes()[0]) != "get" || get[3].(*message.ResponseInt).Payload() != 1 || get[4].(*message.ResponseInt).Payload() != 1 {
+		t.Errorf("COMMAND INFO get: got %v, want name, arity, flags and key positions 1, 1, 1", get)
+	}
+	lpush := info.Payload()[1].(*message.ResponseArray).Payload()
+	if arity := lpush[1].(*message.ResponseInt).Payload(); arity != -3 {
+		t.Errorf("COMMAND INFO lpush: got arity %d, want -3", arity)
+	}
+	if flags := lpush[2].(*message.ResponseArray).Payload(); flags[0].(*message.ResponseStatus).Payload() != "write" {
+		t.Errorf("COMMAND INFO lpush: got flags %v, want write", flags)
+	}
+	if status := info.Payload()[2].Status(); status != message.StatusNotFound {
+		t.Errorf("COMMAND INFO unknown: got status %s, want %s", status, message.StatusNotFound)
+	}
+
+	docs, ok := c.handle("COMMAND", "DOCS", "del", "unknown").(*message.ResponseArray)
+	if !ok || len(docs.Payload()) != 2 {
+		t.Fatalf("COMMAND DOCS: got %v, want name and docs of del", docs)
+	}
+	if got := docs.Payload()[1].Bytes(); len(got) != 2 || string(got[0]) != "summary" || !strings.HasPrefix(string(got[1]), "Removes the specified keys") {
+		t.Errorf("COMMAND DOCS del: got %q", got)
+	}
+
+	if status := c.handle("COMMAND", "COUNT", "x").Status(); status != message.StatusInvalidArguments {
+		t.Errorf("COMMAND COUNT x: got status %s, want %s", status, message.StatusInvalidArguments)
+	}
+	if status := c.handle("COMMAND", "LIST2").Status(); status != message.StatusInvalidArguments {
+		t.Errorf("COMMAND LIST2: got status %s, want %s", status, message.StatusInvalidArguments)
+	}
+}
+
+func TestController_HandleMessageMemoryPurge(t *testing.T) {
+	c := startTestController(t, "", controller.SyncNever, time.Hour, true)
+	defer c.Shutdown()
+
+	for i := 0; i < 100000; i++ {
+		c.HandleMessage(message.NewRequest("SET", [][]byte{[]byte("key" + strconv.Itoa(i)), []byte("value")}))
+	}
+	c.HandleMessage(message.NewRequest("DELPATTERN", [][]byte{[]byte("key1*")}))
+
+	if r, ok := c.handle("MEMORY", "purge").(*message.ResponseInt); !ok || r.Payload() < 0 {
+		t.Errorf("MEMORY PURGE: got %v, want count of released bytes", c.handle("MEMORY", "purge"))
+	}
+	if r, ok := c.HandleMessage(message.NewRequest("GET", [][]byte{[]byte("key2")})).(*message.ResponseString); !ok || string(r.Payload()) != "value" {
+		t.Errorf("GET key2 after MEMORY PURGE: got %v, want value", r)
+	}
+
+	if status := c.handle("MEMORY").Status(); status != message.StatusInvalidArguments {
+		t.Errorf("MEMORY: got status %s, want %s", status, message.StatusInvalidArguments)
+	}
+	if status := c.handle("MEMORY", "DOCTOR").Status(); status != message.StatusInvalidArguments {
+		t.Errorf("MEMORY DOCTOR: got status %s, want %s", status, message.StatusInvalidArguments)
+	}
+}
+
+func TestController_HandleMessageDebugReload(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	c := newTestController(t, dataDir, controller.SyncNever, time.Hour, true)
+	c.SetDebugEnabled(true)
+	c.start(t)
+	defer c.Shutdown()
+
+	c.handle("SETEX", "bytes", "1000", "value")
+	c.handle("LPUSH", "list", "", "a", "b")
+	c.handle("HSET", "dict", "field", "value")
+	c.handle("HSET", "dict", "empty", "")
+	c.handle("ZADD", "zset", "1.5", "a", "-2", "b")
+
+	queries := [][]string{
+		{"GET", "bytes"},
+		{"TTL", "bytes"},
+		{"LRANGE", "list", "0", "-1"},
+		{"HGET", "dict", "field"},
+		{"HGET", "dict", "empty"},
+		{"ZRANGE", "zset", "0", "-1", "WITHSCORES"},
+	}
+	query := func(args []string) string {
+		response := c.handle(args[0], args[1:]...)
+		return fmt.Sprintf("%s %q", response.Status(), response.Bytes())
+	}
+
+	want := make([]string, len(queries))
+	for i, args := range queries {
+		want[i] = query(args)
+	}
+
+	if response := c.handle("DEBUG", "RELOAD"); response.Status() != message.StatusOk {
+		t.Fatalf("DEBUG RELOAD: got %s %q, want OK", response.Status(), response.Bytes())
+	}
+
+	for i, args := range queries {
+		if got := query(args); got != want[i] {
+			t.Errorf("%v after DEBUG RELOAD: got %s, want %s", args, got, want[i])
+		}
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(dataDir, "debug_reload*")); len(files) != 0 {
+		t.Errorf("DEBUG RELOAD: got temporary files %v left in the data dir", files)
+	}
+
+	// reloaded storage is writable as usual
+	c.handle("LPUSH", "list", "c")
+	if got := c.handle("LLEN", "list").Bytes(); len(got) != 1 || string(got[0]) != "4" {
+		t.Errorf("LLEN list after DEBUG RELOAD and LPUSH: got %q, want 4", got)
+	}
+}
+
+func TestController_HandleMessageLatency(t *testing.T) {
+	c := newTestController(t, "", controller.SyncNever, time.Hour, true)
+	c.SetDebugEnabled(true)
+	c.start(t)
+	defer c.Shutdown()
+
+	// disabled by default
+	c.handle("DEBUG", "SLEEP", "0.05")
+	if got := c.handle("LATENCY", "LATEST"); len(got.(*message.ResponseArray).Payload()) != 0 {
+		t.Errorf("LATENCY LATEST with disabled monitoring: got %v, want empty array", got)
+	}
+
+	if status := c.handle("CONFIG", "SET", "latency-monitor-threshold", "20").Status(); status != message.StatusOk {
+		t.Fatalf("CONFIG SET latency-monitor-threshold 20: got status %s", status)
+	}
+	c.handle("GET", "key")
+	c.handle("DEBUG", "SLEEP", "0.05")
+
+	latest := c.handle("LATENCY", "LATEST").(*message.ResponseArray).Payload()
+	if len(latest) != 1 {
+		t.Fatalf("LATENCY LATEST: got %v, want a single event", latest)
+	}
+	event := latest[0].(*message.ResponseArray).Payload()
+	if name := string(event[0].Bytes()[0]); name != "command" {
+		t.Errorf("LATENCY LATEST: got event %q, want command", name)
+	}
+	if timestamp := event[1].(*message.ResponseInt).Payload(); timestamp < time.Now().Unix()-1 {
+		t.Errorf("LATENCY LATEST: got time %d, want about %d", timestamp, time.Now().Unix())
+	}
+	if latest, max := event[2].(*message.ResponseInt).Payload(), event[3].(*message.ResponseInt).Payload(); latest < 50 || max < latest {
+		t.Errorf("LATENCY LATEST: got latest %d and max %d, want at least 50", latest, max)
+	}
+
+	history := c.handle("LATENCY", "HISTORY", "command").(*message.ResponseArray).Payload()
+	if len(history) != 1 || len(history[0].Bytes()) != 2 {
+		t.Errorf("LATENCY HISTORY command: got %v, want a single sample", history)
+	}
+	if got := c.handle("LATENCY", "HISTORY", "wal-fsync").(*message.ResponseArray).Payload(); len(got) != 0 {
+		t.Errorf("LATENCY HISTORY wal-fsync: got %v, want empty array", got)
+	}
+
+	if got := c.handle("LATENCY", "RESET", "command", "unknown").(*message.ResponseInt).Payload(); got != 1 {
+		t.Errorf("LATENCY RESET command unknown: got %d, want 1", got)
+	}
+	if got := c.handle("LATENCY", "LATEST"); len(got.(*message.ResponseArray).Payload()) != 0 {
+		t.Errorf("LATENCY LATEST after RESET: got %v, want empty array", got)
+	}
+
+	for _, args := range [][]string{{}, {"HISTORY"}, {"LATEST", "command"}, {"DOCTOR"}} {
+		if status := c.handle("LATENCY", args...).Status(); status != message.StatusInvalidArguments {
+			t.Errorf("LATENCY %v: got status %s, want %s", args, status, message.StatusInvalidArguments)
+		}
+	}
+}
+
+func TestController_HandleMessageExplain(t *testing.T) {
+	c := startTestController(t, "", controller.SyncNever, time.Hour, true)
+	defer c.Shutdown()
+
+	c.HandleMessage(message.NewRequest("LPUSH", [][]byte{[]byte("src"), []byte("2"), []byte("1")}))
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{
+			[]string{"get", "key"},
+			[]string{"command:get", "modifying:no", "keys:key", "complexity:O(1)", "dangerous:no"},
+		},
+		{
+			[]string{"DEL", "k1", "k2"},
+			[]string{"command:del", "modifying:yes", "keys:k1,k2", "dangerous:no"},
+		},
+		{
+			[]string{"SORT", "src"},
+			[]string{"modifying:no", "keys:src"},
+		},
+		{
+			[]string{"SORT", "src", "ALPHA", "STORE", "dst"},
+			[]string{"modifying:yes", "keys:src,dst"},
+		},
+		{
+			[]string{"KEYS", "*"},
+			[]string{"command:keys", "modifying:no", "keys:\r\n", "dangerous:yes"},
+		},
+		{
+			[]string{"DELPATTERN", "user:*"},
+			[]string{"modifying:yes", "dangerous:yes"},
+		},
+	}
+
+	for _, tst := range tests {
+		resp := c.handle("EXPLAIN", tst.args...)
+		if resp.Status() != message.StatusOk {
+			t.Errorf("EXPLAIN %q: got status %s, want %s", tst.args, resp.Status(), message.StatusOk)
+			continue
+		}
+		for _, want := range tst.want {
+			if got := string(resp.Bytes()[0]); !strings.Contains(got, want) {
+				t.Errorf("EXPLAIN %q: got %q, want %q", tst.args, got, want)
+			}
+		}
+	}
+
+	if got := c.HandleMessage(message.NewRequest("LLEN", [][]byte{[]byte("dst")})); got.Status() != message.StatusOk || got.(*message.ResponseInt).Payload() != 0 {
+		t.Errorf("EXPLAIN SORT STORE: command is executed, LLEN dst: %v", got)
+	}
+
+	if status := c.handle("EXPLAIN").Status(); status != message.StatusInvalidArguments {
+		t.Errorf("EXPLAIN: got status %s, want %s", status, message.StatusInvalidArguments)
+	}
+	if status := c.handle("EXPLAIN", "GET").Status(); status != message.StatusInvalidArguments {
+		t.Errorf("EXPLAIN GET: got status %s, want %s", status, message.StatusInvalidArguments)
+	}
+	if status := c.handle("EXPLAIN", "GET", "a", "b").Status(); status != message.StatusInvalidArguments {
+		t.Errorf("EXPLAIN GET a b: got status %s, want %s", status, message.StatusInvalidArguments)
+	}
+	if status := c.handle("EXPLAIN", "NOSUCHCMD").Status(); status != message.StatusInvalidCommand {
+		t.Errorf("EXPLAIN NOSUCHCMD: got status %s, want %s", status, message.StatusInvalidCommand)
+	}
+}
+
+func TestController_HandleMessageStopWritesOnError(t *testing.T) {
+	log.SetLevel(-1)
+	defer log.SetLevel(log.CRITICAL)
+
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	c := startTestController(t, dataDir, controller.SyncAlways, 50*time.Millisecond, true)
+	defer c.Shutdown()
+
+	set := func() message.Response {
+		return c.HandleMessage(message.NewRequest("SET", [][]byte{[]byte("key"), []byte("value")}))
+	}
+	config := func(value string) {
+		request := message.NewRequest("CONFIG", [][]byte{[]byte("SET"), []byte("stop-writes-on-persistence-error"), []byte(value)})
+		if response := c.HandleMessage(request); response.Status() != message.StatusOk {
+			t.Fatalf("CONFIG SET stop-writes-on-persistence-error %s: got %s", value, response)
+		}
+	}
+	waitStatus := func(want message.Status) {
+		for i := 0; i < 100; i++ {
+			if set().Status() == want {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("SET: status %s wasn't reached", want)
+	}
+
+	// snapshot update fails to read the storage dump
+	storageFile := filepath.Join(dataDir, "storage.gob")
+	os.RemoveAll(storageFile)
+	if err := os.Mkdir(storageFile, 0755); err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(message.StatusMisconf)
+
+	if response := c.HandleMessage(message.NewRequest("GET", [][]byte{[]byte("key")})); response.Status() != message.StatusOk {
+		t.Errorf("GET on persistence error: got status %s, want %s", response.Status(), message.StatusOk)
+	}
+	info := c.HandleMessage(message.NewRequest("INFO", [][]byte{[]byte("persistence")}))
+	if !strings.Contains(info.String(), "snapshot_last_update_status:err") {
+		t.Errorf("INFO persistence: got %s, want snapshot_last_update_status:err", info)
+	}
+
+	// best-effort mode accepts writes, which could be lost
+	config("no")
+	if response := set(); response.Status() != message.StatusOk {
+		t.Errorf("SET in best-effort mode: got status %s, want %s", response.Status(), message.StatusOk)
+	}
+	config("yes")
+
+	// writes are accepted again after successful snapshot update
+	os.RemoveAll(storageFile)
+	waitStatus(message.StatusOk)
+}
+
+func TestController_HandleMessagePanic(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+
+	c := newTestController(t, "", controller.SyncNever, time.Hour, true)
+	c.SetDebugEnabled(true)
+	c.start(t)
+	// Shutdown hangs, if the panicked handler isn't marked as finished
+	defer c.Shutdown()
+
+	for i := 0; i < 2; i++ {
+		if response := c.HandleMessage(newRequest("DEBUG", "PANIC")); response.Status() != message.StatusError {
+			t.Errorf("DEBUG PANIC: got status %s, want %s", response.Status(), message.StatusError)
+		}
+	}
+
+	if response := c.HandleMessage(newRequest("SET", "key", "value")); response.Status() != message.StatusOk {
+		t.Errorf("SET after panic: got status %s, want %s", response.Status(), message.StatusOk)
+	}
+	if got := c.HandleMessage(newRequest("GET", "key")).Bytes(); len(got) != 1 || string(got[0]) != "value" {
+		t.Errorf("GET after panic: got %q, want %q", got, "value")
+	}
+
+	// transaction takes the exclusive lock, so it deadlocks, if any lock leaked
+	transaction, err := message.NewRequestTransaction([]*message.Request{newRequest("SET", "key", "tx")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := c.HandleTransaction(transaction); response.Status() != message.StatusOk {
+		t.Errorf("EXEC after panic: got status %s, want %s", response.Status(), message.StatusOk)
+	}
+}
+
+func TestController_HandleTransaction(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+
+	c := newTestController(t, "", controller.SyncNever, time.Hour, true)
+	c.start(t)
+	defer c.Shutdown()
+
+	transaction, err := message.NewRequestTransaction([]*message.Request{newRequest("SET", "key", "tx")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// transactions are packed by API servers only, clients couldn't send EXEC with arbitrary arguments
+	if response := c.HandleMessage(transaction); response.Status() != message.StatusError {
+		t.Errorf("HandleMessage(EXEC): got status %s, want %s", response.Status(), message.StatusError)
+	}
+	if response := c.HandleTransaction(newRequest("SET", "key", "value")); response.Status() != message.StatusInvalidArguments {
+		t.Errorf("HandleTransaction(SET): got status %s, want %s", response.Status(), message.StatusInvalidArguments)
+	}
+
+	// generated Unmarshal doesn't check bounds, so malformed requests must be rejected before unmarshalling
+	valid, err := newRequest("SET", "key", "value").Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hugeArgs := append(append([]byte{}, valid[:16]...), 3, 'S', 'E', 'T', 0xff, 0xff, 0xff, 0xff, 0x0f)
+	for name, arg := range map[string][]byte{
+		"short":            []byte("short"),
+		"truncated":        valid[:len(valid)-1],
+		"huge args count":  hugeArgs,
+		"huge cmd length":  append(append([]byte{}, valid[:16]...), 0xff, 0xff, 0xff, 0xff, 0x0f),
+		"truncated length": append(append([]byte{}, valid[:16]...), 0xff),
+	} {
+		response := c.HandleTransaction(message.NewRequest(message.CmdExec, [][]byte{arg}))
+		if response.Status() != message.StatusInvalidArguments {
+			t.Errorf("HandleTransaction(%s): got status %s, want %s", name, response.Status(), message.StatusInvalidArguments)
+		}
+	}
+
+	if response := c.HandleTransaction(transaction); response.Status() != message.StatusOk {
+		t.Errorf("HandleTransaction(): got status %s, want %s", response.Status(), message.StatusOk)
+	}
+	if got := c.HandleMessage(newRequest("GET", "key")).Bytes(); len(got) != 1 || string(got[0]) != "tx" {
+		t.Errorf("GET after transaction: got %q, want %q", got, "tx")
+	}
+}
+
+func TestController_HandleMessageDelPattern(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	c := startTestController(t, dataDir, controller.SyncAlways, time.Hour, true)
+
+	for _, key := range []string{"user:1", "user:2", "user:x", "session:1"} {
+		c.handle("SET", key, "value")
+	}
+
+	tests := []struct {
+		args       []string
+		wantStatus message.Status
+		wantCount  int64
+	}{
+		{[]string{"user:[0-9]*"}, message.StatusOk, 2},
+		{[]string{"user:[0-9]*"}, message.StatusOk, 0},
+		{nil, message.StatusInvalidArguments, 0},
+		{[]string{"user:*", "session:*"}, message.StatusInvalidArguments, 0},
+	}
+
+	for _, tst := range tests {
+		response := c.handle("DELPATTERN", tst.args...)
+		if response.Status() != tst.wantStatus {
+			t.Errorf("DELPATTERN %v: got status %s, want %s", tst.args, response.Status(), tst.wantStatus)
+			continue
+		}
+		if r, ok := response.(*message.ResponseInt); tst.wantStatus == message.StatusOk && (!ok || r.Payload() != tst.wantCount) {
+			t.Errorf("DELPATTERN %v: got %v, want %d", tst.args, response, tst.wantCount)
+		}
+	}
+
+	// WAL contains the resolved keys, so a key, matching the pattern after DELPATTERN, survives replay
+	c.handle("SET", "user:3", "value")
+	c.handle("SHUTDOWN", "NOSAVE")
+	c.waitShutdown(t)
+
+	s, err := controller.OpenStore(dataDir, controller.DefaultStoreOptions())
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+	defer s.Close()
+
+	for key, wantExists := range map[string]bool{"user:1": false, "user:2": false, "user:x": true, "session:1": true, "user:3": true} {
+		if _, err := s.Core().Get(key); (err == nil) != wantExists {
+			t.Errorf("after restart %s exists: got %t, want %t", key, err == nil, wantExists)
+		}
+	}
+}
+
+func TestCommandKeys(t *testing.T) {
+	for _, tst := range []struct {
+		got, want []string
+	}{
+		{controller.CommandKeys("GET", "key"), []string{"key"}},
+		{controller.CommandKeys("DEL", "a", "b"), []string{"a", "b"}},
+		{controller.CommandKeys("SET", "key", "value", "EX", "10"), []string{"key"}},
+		{controller.CommandKeys("PING"), nil},
+		{controller.CommandKeys("UNKNOWN", "key"), nil},
+		// positions beyond arguments are skipped, non-positive step is treated as 1
+		{controller.KeysAt(1, 3, 1, "a"), []string{"a"}},
+		{controller.KeysAt(1, -1, 0, "a", "b"), []string{"a", "b"}},
+		{controller.KeysAt(1, -1, 2, "a", "b", "c"), []string{"a", "c"}},
+		{controller.KeysAt(0, 0, 0, "a"), nil},
+	} {
+		if fmt.Sprintf("%q", tst.got) != fmt.Sprintf("%q", tst.want) {
+			t.Errorf("keys: got %q, want %q", tst.got, tst.want)
+		}
+	}
+}
+
+func TestController_HandleMessageHotKeys(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+
+	c := startTestController(t, "", controller.SyncNever, time.Hour, true)
+	defer c.Shutdown()
+
+	// sampling is disabled by default
+	c.HandleMessage(newRequest("GET", "hot"))
+	if got := c.HandleMessage(newRequest("HOTKEYS")).Bytes(); len(got) != 0 {
+		t.Errorf("HOTKEYS without sampling: got %q, want no keys", got)
+	}
+
+	c.SetHotKeysSampleRate(1)
+	for i := 0; i < 10; i++ {
+		c.HandleMessage(newRequest("GET", "hot"))
+	}
+	c.HandleMessage(newRequest("DEL", "warm", "hot", "warm"))
+	c.HandleMessage(newRequest("GET", "warm"))
+	// cold keys evict each other, but not the hot ones
+	for i := 0; i < 200; i++ {
+		c.HandleMessage(newRequest("SET", "cold"+strconv.Itoa(i), "value"))
+	}
+
+	want := []string{"hot", "11", "warm", "3"}
+	if got := c.HandleMessage(newRequest("HOTKEYS", "2")).Bytes(); strings.Join(bytesToStrings(got), " ") != strings.Join(want, " ") {
+		t.Errorf("HOTKEYS 2: got %q, want %q", got, want)
+	}
+	if got := c.HandleMessage(newRequest("HOTKEYS")).Bytes(); len(got) != 20 {
+		t.Errorf("HOTKEYS: got %d keys, want 10", len(got)/2)
+	}
+
+	// counts of sampled commands are scaled by the rate
+	c.HandleMessage(newRequest("HOTKEYS", "RESET"))
+	c.HandleMessage(newRequest("CONFIG", "SET", "hotkeys-sample-rate", "5"))
+	for i := 0; i < 10; i++ {
+		c.HandleMessage(newRequest("GET", "hot"))
+	}
+	if got := c.HandleMessage(newRequest("HOTKEYS", "1")).Bytes(); len(got) != 2 || string(got[0]) != "hot" || string(got[1]) != "10" {
+		t.Errorf("HOTKEYS with rate 5: got %q, want hot with estimated 10 accesses", got)
+	}
+
+	if response := c.HandleMessage(newRequest("HOTKEYS", "0")); response.Status() != message.StatusInvalidArguments {
+		t.Errorf("HOTKEYS 0: got status %s, want %s", response.Status(), message.StatusInvalidArguments)
+	}
+}
+
+func TestController_HandleMessageInvalidArguments(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+
+	c := startTestController(t, "", controller.SyncNever, time.Hour, true)
+	defer c.Shutdown()
+
+	tests := []struct {
+		cmd  string
+		args []string
+		want string
+	}{
+		{"GET", nil, "wrong number of arguments for 'get' command"},
+		{"HSET", []string{"key", "field"}, "wrong number of arguments for 'hset' command"},
+		{"HGETALL", nil, "wrong number of arguments for 'hgetall' command"},
+		{"HOTKEYS", []string{"1", "2"}, "wrong number of arguments for 'hotkeys' command"},
+		{"EVAL", []string{"return 1"}, "wrong number of arguments for 'eval' command"},
+		{"SCRIPT", []string{"LOAD"}, "wrong number of arguments for 'script|load' command"},
+		{"CONFIG", []string{"GET"}, "wrong number of arguments for 'config|get' command"},
+		{"CONFIG", []string{"SET", "timeout"}, "wrong number of arguments for 'config|set' command"},
+		{"COMMAND", []string{"COUNT", "GET"}, "wrong number of arguments for 'command|count' command"},
+		{"HOTKEYS", []string{"0"}, controller.ErrHotKeysArgument.Error()},
+		{"CONFIG", []string{"SET", "save", ""}, controller.ErrImmutableConfig.Error()},
+	}
+
+	for _, tst := range tests {
+		request := message.NewRequest(tst.cmd, nil)
+		for _, arg := range tst.args {
+			request.Args = append(request.Args, []byte(arg))
+		}
+
+		response := c.HandleMessage(request)
+		if response.Status() != message.StatusInvalidArguments {
+			t.Errorf("%s %q: got status %s, want %s", tst.cmd, tst.args, response.Status(), message.StatusInvalidArguments)
+		}
+		if got := string(response.Bytes()[0]); got != tst.want {
+			t.Errorf("%s %q: got %q, want %q", tst.cmd, tst.args, got, tst.want)
+		}
+	}
+}
+
+func bytesToStrings(s [][]byte) []string {
+	result := make([]string, len(s))
+	for i, v := range s {
+		result[i] = string(v)
+	}
+
+	return result
+}
+
+// testController is a controller, served on an ephemeral port
+type testController struct {
+	*controller.Controller
+	addr string
+	done chan error
+}
+
+// newTestController constructs a controller on a free port, that isn't started until start() call
+func newTestController(t *testing.T, dataDir string, syncPolicy controller.SyncPolicy, mergeWalInterval time.Duration, useHttp bool) *testController {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	return &testController{
+		Controller: controller.New("localhost", port, dataDir, syncPolicy, 0, mergeWalInterval, useHttp),
+		addr:       listener.Addr().String(),
+		done:       make(chan error, 1),
+	}
+}
+
+// startTestController constructs a controller on a free port and starts it
+func startTestController(t *testing.T, dataDir string, syncPolicy controller.SyncPolicy, mergeWalInterval time.Duration, useHttp bool) *testController {
+	c := newTestController(t, dataDir, syncPolicy, mergeWalInterval, useHttp)
+	c.start(t)
+	return c
+}
+
+// start starts the controller and waits until it's API server accepts connections
+func (c *testController) start(t *testing.T) {
+	go func() { c.done <- c.ListenAndServe() }()
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		select {
+		case err := <-c.done:
+			t.Fatalf("ListenAndServe(): %v", err)
+		default:
+		}
+
+		// the controller is marked as running just before it's API server starts listening
+		if conn, err := net.Dial("tcp", c.addr); err == nil {
+			conn.Close()
+			if c.CheckHealth() == nil {
+				c.waitClientsClosed(t)
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("controller isn't ready at %s", c.addr)
+		}
+	}
+}
+
+// waitClientsClosed waits until the server releases all closed connections.
+// The RESP server races with it's own handlers on shutdown, if they're still serving connections, closed by clients
+func (c *testController) waitClientsClosed(t *testing.T) {
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if strings.Contains(c.handle("INFO", "clients").String(), "connected_clients:0") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("connections to %s aren't closed", c.addr)
+		}
+	}
+}
+
+// waitShutdown waits until the controller, shut down by SHUTDOWN command, completes shutdown.
+// ListenAndServe() returns before the shutdown is logged, so returning from it isn't enough
+func (c *testController) waitShutdown(t *testing.T) {
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("SHUTDOWN: server still running")
+	}
+
+	// concurrent Shutdown waits until the running one completes
+	c.Shutdown()
+}
+
+// handle processes a request with string arguments
+func (c *testController) handle(cmd string, args ...string) message.Response {
+	return c.HandleMessage(newRequest(cmd, args...))
+}
+
+func newRequest(cmd string, args ...string) *message.Request {
+	request := message.NewRequest(cmd, nil)
+	for _, arg := range args {
+		request.Args = append(request.Args, []byte(arg))
+	}
+
+	return request
+}
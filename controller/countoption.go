@@ -0,0 +1,17 @@
+package controller
+
+import (
+	"github.com/mshaverdo/radish/message"
+	"strings"
+)
+
+// hasCountOption returns true, if `COUNT num` option presents in variadic options, starting from optionsIndex position
+func hasCountOption(request *message.Request, optionsIndex int) bool {
+	for i := optionsIndex; i+1 < len(request.Args); i++ {
+		if strings.ToUpper(string(request.Args[i])) == "COUNT" {
+			return true
+		}
+	}
+
+	return false
+}
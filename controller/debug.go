@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/mshaverdo/radish/core"
+	"github.com/mshaverdo/radish/message"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrDebugDisabled     = errors.New("DEBUG command not allowed. Start server with -enable-debug-command flag")
+	ErrUnknownDebugCmd   = errors.New("Unknown DEBUG subcommand")
+	ErrInvalidDebugValue = errors.New("Invalid DEBUG argument value")
+)
+
+// SetDebugEnabled allows DEBUG command, intended for tests only. MUST be invoked before ListenAndServe()
+func (c *Controller) SetDebugEnabled(enabled bool) {
+	c.debugEnabled = enabled
+}
+
+// handleDebug processes DEBUG SLEEP|SET-ACTIVE-EXPIRE|OBJECT|RELOAD|PANIC requests
+func (c *Controller) handleDebug(request *message.Request, run *atomicRun) message.Response {
+	if !c.debugEnabled {
+		return getResponseCommandError(request.Cmd, ErrDebugDisabled)
+	}
+
+	if len(request.Args) == 1 && strings.ToUpper(string(request.Args[0])) == "PANIC" {
+		// unlike Redis, the panic is recovered by HandleMessage, so it checks that the server survives a broken command
+		panic("DEBUG PANIC")
+	}
+
+	if len(request.Args) == 1 && strings.ToUpper(string(request.Args[0])) == "RELOAD" {
+		reload := c.reloadStorage
+		if run != nil {
+			// the storage is already locked by the transaction or the script
+			reload = c.store.reloadStorage
+		}
+		if err := reload(); err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStatusOkPayload()
+	}
+
+	if len(request.Args) != 2 {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+
+	switch strings.ToUpper(string(request.Args[0])) {
+	case "SLEEP":
+		seconds, err := strconv.ParseFloat(string(request.Args[1]), 64)
+		if err != nil || seconds < 0 {
+			return getResponseInvalidArguments(request.Cmd, ErrInvalidDebugValue)
+		}
+
+		time.Sleep(time.Duration(seconds * float64(time.Second)))
+		return getResponseStatusOkPayload()
+	case "SET-ACTIVE-EXPIRE":
+		switch string(request.Args[1]) {
+		case "0":
+			c.store.SetActiveExpire(false)
+		case "1":
+			c.store.SetActiveExpire(true)
+		default:
+			return getResponseInvalidArguments(request.Cmd, ErrInvalidDebugValue)
+		}
+
+		return getResponseStatusOkPayload()
+	case "OBJECT":
+		description, err := c.store.core.DebugObject(string(request.Args[1]))
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStatusPayload(description)
+	default:
+		return getResponseInvalidArguments(request.Cmd, ErrUnknownDebugCmd)
+	}
+}
+
+// reloadStorage round-trips the storage through persistence like Redis DEBUG RELOAD. All requests are blocked meanwhile
+func (c *Controller) reloadStorage() error {
+	c.transactionMutex.Lock()
+	defer c.transactionMutex.Unlock()
+
+	return c.store.reloadStorage()
+}
+
+// reloadStorage persists the storage into a temporary file, loads it into a new storage and replaces every item
+// by the loaded one, if it survived the round-trip unchanged. Snapshot and WAL aren't touched, because the data stays the same.
+// Modifications must be blocked by caller, but expired items could be collected meanwhile
+func (s *Store) reloadStorage() error {
+	persistable, ok := s.core.Storage().(Persister)
+	if !ok {
+		return errors.New("Store.reloadStorage(): Storage not support persistence")
+	}
+	loaded := storageFactory()
+	loadable, ok := loaded.(Loader)
+	if !ok {
+		return errors.New("Store.reloadStorage(): Storage not support loading")
+	}
+
+	// without a data dir, the storage is reloaded through the system temporary dir
+	dir := ""
+	if s.isPersistent {
+		dir = s.keeper.dataDir
+	}
+	file, err := ioutil.TempFile(dir, "debug_reload")
+	if err != nil {
+		return fmt.Errorf("Store.reloadStorage(): %s", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	err = persistable.Persist(w, 0)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		_, err = file.Seek(0, 0)
+	}
+	if err == nil {
+		_, err = loadable.Load(bufio.NewReader(file))
+	}
+	if err != nil {
+		return fmt.Errorf("Store.reloadStorage(): %s", err)
+	}
+
+	storage := s.core.Storage()
+	for _, key := range storage.Keys() {
+		if item := storage.Get(key); item != nil && !isReloaded(item, loaded.Get(key)) {
+			return fmt.Errorf("Store.reloadStorage(): key %q changed after reload", key)
+		}
+	}
+
+	loaded.ViewKeys(func(forEach core.KeyIterator) {
+		forEach(func(key string, item *core.Item) {
+			// expired items could be collected meanwhile, they mustn't be resurrected
+			if old := storage.Get(key); old != nil {
+				storage.CompareAndReplace(key, old, item)
+			}
+		})
+	})
+
+	return nil
+}
+
+// isReloaded returns true, if loaded item equals to the item
+func isReloaded(item, loaded *core.Item) bool {
+	if loaded == nil {
+		return false
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	return item.Equal(loaded)
+}
+
+// SetActiveExpire enables or disables background collection of expired items.
+// Expired items are still invisible for reads, when collection disabled
+func (s *Store) SetActiveExpire(enabled bool) {
+	var flag uint32
+	if !enabled {
+		flag = 1
+	}
+
+	atomic.StoreUint32(&s.activeExpireDisabled, flag)
+}
+
+// isActiveExpire returns true, if background collection of expired items enabled
+func (s *Store) isActiveExpire() bool {
+	return atomic.LoadUint32(&s.activeExpireDisabled) == 0
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"github.com/mshaverdo/radish/message"
+)
+
+// handleDelPattern processes DELPATTERN pattern request, a Radish-specific admin command.
+// Matching keys are resolved and deleted by a regular DEL request, so read-only mode, keyspace notifications
+// and WAL are the same as for DEL: WAL gets the resolved key list and replay doesn't depend on the data.
+// Keys are resolved and deleted under the transaction lock, so transactions don't see a partially deleted pattern.
+// Inside a transaction or a script the DEL request is processed by the run, already holding the lock
+func (c *Controller) handleDelPattern(request *message.Request, run *atomicRun) message.Response {
+	if len(request.Args) != 1 {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+
+	// like KEYS, DELPATTERN scans the whole keyspace regardless of pattern
+	if limit := c.KeysScanLimit(); limit > 0 && c.store.core.DbSize() > limit {
+		return getResponseCommandError(request.Cmd, ErrTooManyKeys)
+	}
+
+	delRequest := message.NewRequest("DEL", nil)
+	delRequest.Unreliable = request.Unreliable
+	if err := c.writeRejection(delRequest); err != nil {
+		return getResponseCommandError(request.Cmd, err)
+	}
+
+	if run != nil {
+		keys := c.store.core.Keys(string(request.Args[0]))
+		if len(keys) == 0 {
+			return getResponseIntPayload(0)
+		}
+
+		delRequest.Args = stringsSliceToBytesSlise(keys)
+		return run.process(delRequest)
+	}
+
+	c.transactionMutex.RLock()
+	keys := c.store.core.Keys(string(request.Args[0]))
+	if len(keys) == 0 {
+		c.transactionMutex.RUnlock()
+		return getResponseIntPayload(0)
+	}
+
+	delRequest.Args = stringsSliceToBytesSlise(keys)
+	notifyKeys := c.keysToNotify(delRequest)
+	response := c.store.Process(delRequest)
+	c.transactionMutex.RUnlock()
+
+	c.notifyRequest(delRequest, response, notifyKeys)
+	return response
+}
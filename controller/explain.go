@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"bytes"
+	"github.com/mshaverdo/radish/message"
+	"strings"
+)
+
+// handleExplain processes EXPLAIN command [arg ...] requests.
+// The command isn't executed: the reply describes, whether it modifies the storage, which keys it touches and its estimated cost
+func (c *Controller) handleExplain(request *message.Request) message.Response {
+	if len(request.Args) == 0 {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+
+	explained := message.NewRequest(strings.ToUpper(string(request.Args[0])), request.Args[1:])
+	info, ok := commandTable[explained.Cmd]
+	if !ok {
+		return message.NewResponseStatus(message.StatusInvalidCommand, "unknown command: "+explained.Cmd)
+	}
+
+	if !isValidArity(info.arity, len(explained.Args)+1) {
+		return getResponseInvalidArguments(explained.Cmd, ErrWrongArgumentsCount)
+	}
+
+	keys := commandTable[explained.Cmd].keys(explained.Args)
+	isModifying := info.isModifying
+	if isCoreCommand(explained.Cmd) {
+		// e.g. SORT modifies the storage only with STORE option
+		isModifying = c.store.processor.IsModifyingRequest(explained)
+	}
+	if isModifying {
+		for _, key := range affectedKeys(explained) {
+			if !containsString(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, field := range [][2]string{
+		{"command", strings.ToLower(info.name)},
+		{"modifying", formatYesNo(isModifying)},
+		{"keys", strings.Join(keys, ",")},
+		{"complexity", info.complexity},
+		{"dangerous", formatYesNo(info.isDangerous)},
+		{"summary", info.summary},
+	} {
+		buf.WriteString(field[0] + ":" + field[1] + "\r\n")
+	}
+
+	return getResponseStringPayload(buf.Bytes())
+}
+
+// isValidArity returns true, if count of arguments including command name matches arity of the command
+func isValidArity(arity, count int) bool {
+	if arity < 0 {
+		return count >= -arity
+	}
+
+	return count == arity
+}
+
+// isCoreCommand returns true, if the command is processed by Processor
+func isCoreCommand(cmd string) bool {
+	for _, info := range coreCommands {
+		if info.name == cmd {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
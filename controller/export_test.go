@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"github.com/mshaverdo/radish/message"
+	"github.com/yuin/gopher-lua"
+)
+
+type failingWalEncoder struct {
+	walEncoder
+	err error
+}
+
+func (e failingWalEncoder) Encode(request *message.Request) error {
+	return e.err
+}
+
+// FailWal makes encoding of WAL records fail with err, or restores it, if err is nil
+func (s *Store) FailWal(err error) {
+	k := s.keeper
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if failing, ok := k.walEncoder.(failingWalEncoder); ok {
+		k.walEncoder = failing.walEncoder
+	}
+	if err != nil {
+		k.walEncoder = failingWalEncoder{k.walEncoder, err}
+	}
+}
+
+// TableModifyingCommands returns names of commands, described as modifying by the command table
+func TableModifyingCommands() []string {
+	var names []string
+	for _, name := range commandNames {
+		if commandTable[name].isModifying {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// CommandKeys returns keys of the command with args by key positions, described by the command table
+func CommandKeys(cmd string, args ...string) []string {
+	return commandTable[cmd].keys(stringsSliceToBytesSlise(args))
+}
+
+// KeysAt returns keys of args by the key positions
+func KeysAt(firstKey, lastKey, keyStep int, args ...string) []string {
+	return commandInfo{firstKey: firstKey, lastKey: lastKey, keyStep: keyStep}.keys(stringsSliceToBytesSlise(args))
+}
+
+// FailWal makes encoding of WAL records of the controller's store fail with err, or restores it, if err is nil
+func (c *Controller) FailWal(err error) {
+	c.store.FailWal(err)
+}
+
+// ScriptRoundTrip converts the response into Lua value and back, like a script, returning a result of redis.call()
+func ScriptRoundTrip(response message.Response) message.Response {
+	L := lua.NewState()
+	defer L.Close()
+
+	return luaToResponse(responseToLua(L, response))
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"github.com/mshaverdo/radish/message"
+)
+
+// handleHGetAll processes HGETALL key requests.
+// Like KEYS, fields and values are streamed directly from the locked hash into the connection,
+// to avoid copying of every value of huge hashes.
+func (c *Controller) handleHGetAll(request *message.Request) message.Response {
+	if len(request.Args) != 1 {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+
+	key := string(request.Args[0])
+
+	// type is checked before streaming to reply with an error status
+	if err := c.store.core.DGetAllFunc(key, func(int, func(func(string, []byte))) {}); err != nil {
+		return getResponseCommandError(request.Cmd, err)
+	}
+
+	return message.NewResponseStringMapStream(
+		message.StatusOk,
+		func(write func(count int, forEach func(yield func(value []byte)))) {
+			// keep HGETALL atomic against transactions, like any other command
+			c.transactionMutex.RLock()
+			defer c.transactionMutex.RUnlock()
+
+			err := c.store.core.DGetAllFunc(key, func(count int, forEach func(yield func(field string, value []byte))) {
+				write(count, func(yield func(value []byte)) {
+					forEach(func(field string, value []byte) {
+						yield([]byte(field))
+						yield(value)
+					})
+				})
+			})
+			if err != nil {
+				// the key was replaced by a value of another type after the check, as if it was removed before
+				write(0, func(yield func(value []byte)) {})
+			}
+		},
+	)
+}
@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"errors"
+	"github.com/mshaverdo/radish/message"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrHotKeysArgument = errors.New("HOTKEYS argument must be a positive count or RESET")
+
+const (
+	// hotKeysCapacity is a count of keys, tracked by hot keys sampling
+	hotKeysCapacity = 128
+	// hotKeysDefaultCount is a count of keys, replied by HOTKEYS without count
+	hotKeysDefaultCount = 10
+)
+
+// hotKeys samples every sampleRate-th command and counts accesses of its keys by Space-Saving algorithm:
+// at most hotKeysCapacity keys are tracked, a new key replaces the least accessed one and inherits its count.
+// So counts of frequent keys are overestimated by at most count of the replaced key, and rare keys are evicted.
+// Zero value is ready to use, sampling is disabled
+type hotKeys struct {
+	// sampleRate is N, if every N-th command is sampled, zero disables sampling. Accessed atomically
+	sampleRate int64
+	// commands is a count of commands, seen while sampling is enabled. Accessed atomically
+	commands int64
+
+	mu sync.Mutex
+	// counts are estimated counts of accesses by key: every sampled access counts for sampleRate accesses
+	counts map[string]int64
+}
+
+// hotKey is a key with estimated count of accesses
+type hotKey struct {
+	key   string
+	count int64
+}
+
+// setSampleRate sets sampling of every rate-th command. Zero disables sampling, collected counts are kept
+func (h *hotKeys) setSampleRate(rate int) {
+	atomic.StoreInt64(&h.sampleRate, int64(rate))
+}
+
+// getSampleRate returns N, if every N-th command is sampled, or zero, if sampling is disabled
+func (h *hotKeys) getSampleRate() int {
+	return int(atomic.LoadInt64(&h.sampleRate))
+}
+
+// sample counts accesses of request keys, if the request is picked by sampling.
+// Without sampling it costs a single atomic load, and a single atomic increment for not picked requests
+func (h *hotKeys) sample(request *message.Request) {
+	rate := atomic.LoadInt64(&h.sampleRate)
+	if rate <= 0 || atomic.AddInt64(&h.commands, 1)%rate != 0 {
+		return
+	}
+
+	keys := commandTable[request.Cmd].keys(request.Args)
+	if len(keys) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.counts == nil {
+		h.counts = make(map[string]int64, hotKeysCapacity)
+	}
+	for _, key := range keys {
+		h.add(key, rate)
+	}
+}
+
+// add increments count of the key by delta, replacing the least accessed key, if there is no room for the new one
+func (h *hotKeys) add(key string, delta int64) {
+	if count, ok := h.counts[key]; ok || len(h.counts) < hotKeysCapacity {
+		h.counts[key] = count + delta
+		return
+	}
+
+	var (
+		minKey   string
+		minCount int64 = -1
+	)
+	for k, count := range h.counts {
+		if minCount < 0 || count < minCount {
+			minKey, minCount = k, count
+		}
+	}
+	delete(h.counts, minKey)
+	h.counts[key] = minCount + delta
+}
+
+// top returns at most n most accessed keys in descending order of counts
+func (h *hotKeys) top(n int) []hotKey {
+	h.mu.Lock()
+	result := make([]hotKey, 0, len(h.counts))
+	for key, count := range h.counts {
+		result = append(result, hotKey{key, count})
+	}
+	h.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].count != result[j].count {
+			return result[i].count > result[j].count
+		}
+		return result[i].key < result[j].key
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+
+	return result
+}
+
+// reset forgets all collected counts
+func (h *hotKeys) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.counts = nil
+}
+
+// handleHotKeys processes HOTKEYS [count] and HOTKEYS RESET requests.
+// The reply is an array of key and estimated count of accesses pairs, the most accessed first
+func (c *Controller) handleHotKeys(request *message.Request) message.Response {
+	if len(request.Args) > 1 {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+
+	count := hotKeysDefaultCount
+	if len(request.Args) == 1 {
+		arg := string(request.Args[0])
+		if strings.ToUpper(arg) == "RESET" {
+			c.hotKeys.reset()
+			return getResponseStatusOkPayload()
+		}
+
+		var err error
+		if count, err = strconv.Atoi(arg); err != nil || count <= 0 {
+			return getResponseInvalidArguments(request.Cmd, ErrHotKeysArgument)
+		}
+	}
+
+	top := c.hotKeys.top(count)
+	result := make([]message.Response, len(top))
+	for i, hot := range top {
+		result[i] = message.NewResponseArray(message.StatusOk, []message.Response{
+			message.NewResponseString(message.StatusOk, []byte(hot.key)),
+			message.NewResponseInt(message.StatusOk, hot.count),
+		})
+	}
+
+	return getResponseArrayPayload(result)
+}
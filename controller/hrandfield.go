@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"github.com/mshaverdo/radish/core"
+	"github.com/mshaverdo/radish/message"
+	"strings"
+)
+
+// handleHRandField processes HRANDFIELD key [count [WITHVALUES]] requests.
+// Without count, single random field or nil returned, otherwise an array of fields
+func (c *Controller) handleHRandField(request *message.Request) message.Response {
+	if len(request.Args) < 1 || len(request.Args) > 3 {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+
+	key := string(request.Args[0])
+
+	if len(request.Args) == 1 {
+		fields, err := c.store.core.DRandField(key, 1, false)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+		if len(fields) == 0 {
+			return getResponseNotFound()
+		}
+
+		return getResponseStringPayload(fields[0])
+	}
+
+	count, err := request.GetArgumentInt(1)
+	if err != nil {
+		return getResponseInvalidArguments(request.Cmd, err)
+	}
+
+	withValues := false
+	if len(request.Args) == 3 {
+		if strings.ToUpper(string(request.Args[2])) != "WITHVALUES" {
+			return getResponseCommandError(request.Cmd, core.ErrSyntax)
+		}
+		withValues = true
+	}
+
+	result, err := c.store.core.DRandField(key, count, withValues)
+	if err != nil {
+		return getResponseCommandError(request.Cmd, err)
+	}
+
+	return getResponseStringSlicePayload(result)
+}
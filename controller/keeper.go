@@ -14,7 +14,9 @@ import (
 	"path"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,33 +34,168 @@ const (
 )
 
 const (
-	walFileName     = "wal_%v.dat"
-	storageFileName = "storage.gob"
-	requestChanSize = 100000 // 100k seems OK to smooth peaks of sync() and flush()
+	walFileName         = "wal_%v.dat"
+	storageFileName     = "storage.gob"
+	storageDiffFileName = "storage_diff_%v.gob"
+	requestChanSize     = 100000 // 100k seems OK to smooth peaks of sync() and flush()
 	// users don't care about result of pipelined requests -- so, we can store them in the userspace buffer for a second
 	// but non-piplined requests will be flushed to disk immediately, so we could have really big buffer
 	// to boost performance of pipelined requests and don't worry about non-pipelined requests will be lost
 	// in this buffer in case of disaster
 	walBufferSize = 20 * 1024 * 1024
+	// count of storage diffs, after which snapshot update rewrites the whole storage instead of writing a new diff
+	maxStorageDiffs = 16
 )
 
 type Persister interface {
 	// Persist dumps storage  data into provided Writer
 	Persist(w io.Writer, lastMessageId int64) error
+	// PersistKeys dumps provided keys into Writer as a diff of the previous dump
+	PersistKeys(w io.Writer, lastMessageId int64, keys []string) error
 }
 
 type Loader interface {
 	// Restore restores storage  data from Reader
 	Load(r io.Reader) (lastMessageId int64, err error)
+	// LoadDiff applies diff, dumped by PersistKeys, to the storage
+	LoadDiff(r io.Reader) (lastMessageId int64, err error)
+}
+
+// FileNames configures names of persistence files, relative to the data dir. Names may contain subdirectories,
+// e.g. "wal/%v.dat". Empty names are replaced by defaults
+type FileNames struct {
+	// Storage is a name of storage snapshot
+	Storage string
+	// StorageDiff is a name pattern of storage snapshot diffs with %v or %d placeholder for a message id
+	StorageDiff string
+	// Wal is a name pattern of WAL files with %v or %d placeholder for a message id
+	Wal string
+}
+
+// DefaultFileNames returns file names, used by radish-server by default
+func DefaultFileNames() FileNames {
+	return FileNames{
+		Storage:     storageFileName,
+		StorageDiff: storageDiffFileName,
+		Wal:         walFileName,
+	}
+}
+
+// withDefaults returns names with empty ones replaced by defaults and placeholders normalized to %v
+func (n FileNames) withDefaults() FileNames {
+	defaults := DefaultFileNames()
+	if n.Storage == "" {
+		n.Storage = defaults.Storage
+	}
+	if n.StorageDiff == "" {
+		n.StorageDiff = defaults.StorageDiff
+	}
+	if n.Wal == "" {
+		n.Wal = defaults.Wal
+	}
+
+	n.StorageDiff = strings.Replace(n.StorageDiff, "%d", "%v", 1)
+	n.Wal = strings.Replace(n.Wal, "%d", "%v", 1)
+
+	return n
+}
+
+// Validate returns error, if names could not be used to find persistence files in the data dir
+func (n FileNames) Validate() error {
+	n = n.withDefaults()
+
+	for _, name := range []string{n.Storage, n.StorageDiff, n.Wal} {
+		if strings.ContainsAny(name, "*?[\\") {
+			return fmt.Errorf("file name %q must not contain glob pattern characters", name)
+		}
+	}
+
+	if strings.Contains(n.Storage, "%") {
+		return fmt.Errorf("storage file name %q must not contain placeholders", n.Storage)
+	}
+
+	for _, pattern := range []string{n.StorageDiff, n.Wal} {
+		if strings.Count(pattern, "%") != 1 || strings.Count(pattern, "%v") != 1 {
+			return fmt.Errorf("file name pattern %q must contain exactly one %%v or %%d placeholder", pattern)
+		}
+	}
+
+	// files of one kind must not be mistaken for files of another
+	names := []string{n.Storage, fmt.Sprintf(n.StorageDiff, 1), fmt.Sprintf(n.Wal, 1)}
+	for i, pattern := range []string{"", n.StorageDiff, n.Wal} {
+		for j, name := range names {
+			if pattern == "" || i == j {
+				continue
+			}
+			if matched, _ := filepath.Match(fmt.Sprintf(pattern, "*"), name); matched {
+				return fmt.Errorf("file name pattern %q matches %q", pattern, name)
+			}
+		}
+	}
+
+	return nil
 }
 
 var _ Persister = (*core.StorageHash)(nil)
 var _ Loader = (*core.StorageHash)(nil)
 
+// walEncoder writes requests into WAL file
+type walEncoder interface {
+	Encode(request *message.Request) error
+}
+
+// walDecoder reads requests from WAL file
+type walDecoder interface {
+	Decode(request *message.Request) error
+}
+
+// gencodeWalEncoder adapts GencodeEncoder to walEncoder
+type gencodeWalEncoder struct {
+	*GencodeEncoder
+}
+
+func (e gencodeWalEncoder) Encode(request *message.Request) error {
+	return e.GencodeEncoder.Encode(request)
+}
+
+// gencodeWalDecoder adapts GencodeDecoder to walDecoder
+type gencodeWalDecoder struct {
+	*GencodeDecoder
+}
+
+func (d gencodeWalDecoder) Decode(request *message.Request) error {
+	return d.GencodeDecoder.Decode(checkedRequest{request})
+}
+
+// checkedRequest unmarshals WAL record by UnmarshalChecked, so a corrupted record is reported instead of panic
+type checkedRequest struct {
+	*message.Request
+}
+
+func (r checkedRequest) Unmarshal(buf []byte) (uint64, error) {
+	return r.Request.UnmarshalChecked(buf)
+}
+
+// walTask is either a request to write into WAL, or a sync marker, if done isn't nil
+type walTask struct {
+	request *message.Request
+	done    chan error
+	// issued receives position of the WAL stream, when all requests, queued before, are written
+	issued chan walMark
+}
+
+// walMark is a position of the WAL stream: id of the last written message and count of failed queued requests before it
+type walMark struct {
+	id       int64
+	failures int64
+}
+
 type Keeper struct {
 	mergeWalInterval time.Duration
 	syncPolicy       SyncPolicy
+	walFormat        WalFormat
 	dataDir          string
+	fileNames        FileNames
 	core             Core
 	storageFactory   func() core.Storage
 
@@ -67,26 +204,54 @@ type Keeper struct {
 	mutex       sync.Mutex
 	messageId   int64
 	walFile     *os.File
-	walEncoder  *GencodeEncoder
+	walEncoder  walEncoder
 	walBuffer   *bufio.Writer
 	lastSync    time.Time
-	requestChan chan *message.Request
+	requestChan chan walTask
+
+	// syncMutex serializes fsyncs of SyncAlways writers: one fsync covers records of all writers, queued behind it
+	syncMutex sync.Mutex
+	// syncedId is the id of the last message, made durable by fsync of WAL. Accessed atomically
+	syncedId int64
+
+	// dirtyKeys collects keys, changed by replayed WAL requests, to dump them as a storage diff. nil disables collecting
+	dirtyKeys map[string]struct{}
+	// replayWorkers is a count of goroutines, replaying WAL requests to different keys in parallel
+	replayWorkers int
+	// refuseWalGaps makes missing message ids in WAL a replay error instead of a warning
+	refuseWalGaps bool
+	// latency records latency spikes of WAL fsyncs and snapshot updates
+	latency *latencyMonitor
 
 	// wg to wait for service storage-updating goroutines (runSnapshotter, etc)
 	serviceWg sync.WaitGroup
 	stopChan  chan struct{}
+
+	// asyncFailures counts failures of queued writes and of their background flushes. Accessed atomically.
+	// Queued requests are acknowledged before writing, so their senders detect lost writes by growth of the count
+	asyncFailures int64
+
+	// errors of background WAL writing and snapshot updating, reset by successful operation
+	healthMutex sync.Mutex
+	walErr      error
+	snapshotErr error
+	// failed is 1, if any of health errors is set, accessed atomically to check health on every write cheaply
+	failed uint32
 }
 
-func NewKeeper(core Core, dataDir string, policy SyncPolicy, mergeWalInterval time.Duration, storageFactory func() core.Storage) *Keeper {
+func NewKeeper(core Core, dataDir string, fileNames FileNames, policy SyncPolicy, walFormat WalFormat, mergeWalInterval time.Duration, storageFactory func() core.Storage) *Keeper {
 	return &Keeper{
 		core:             core,
 		dataDir:          dataDir,
+		fileNames:        fileNames.withDefaults(),
 		syncPolicy:       policy,
+		walFormat:        walFormat,
 		mergeWalInterval: mergeWalInterval,
 		processor:        NewProcessor(core),
 		stopChan:         make(chan struct{}),
-		requestChan:      make(chan *message.Request, requestChanSize),
+		requestChan:      make(chan walTask, requestChanSize),
 		storageFactory:   storageFactory,
+		latency:          &latencyMonitor{},
 	}
 }
 
@@ -95,37 +260,95 @@ func (k *Keeper) WriteToWal(request *message.Request) (err error) {
 	// if SyncAlways, we must return reliable error status
 	// or, if request was't PIPELINEd, and user waits for response, flush buffer to file
 	if !request.Unreliable || k.syncPolicy == SyncAlways {
-		return k.writeToWalWorker(request)
+		err := k.writeToWalWorker(request)
+		k.setHealth(&k.walErr, err)
+		return err
 	}
 
 	select {
 	case <-k.stopChan:
 		return errors.New("trying to write WAL on stopped keeper")
 	default:
-		k.requestChan <- request
+		k.requestChan <- walTask{request: request}
 		return nil
 	}
 }
 
+// Sync writes all previously queued requests into WAL, flushes and fsyncs WAL file.
+// It returns, when all requests passed to WriteToWal() before are durable.
+// Failed queued requests aren't reported here, see IssuedId()
+func (k *Keeper) Sync() error {
+	done := make(chan error, 1)
+
+	select {
+	case <-k.stopChan:
+		return errors.New("trying to sync WAL on stopped keeper")
+	default:
+		// sync marker is queued after pending requests, so they are written before sync
+		k.requestChan <- walTask{done: done}
+		return <-done
+	}
+}
+
+// IssuedId returns id of the last message, written into WAL after all requests, passed to WriteToWal() before,
+// and count of failed queued requests up to the message. Failed requests have no id, so a caller, that queued requests,
+// detects their loss by growth of the count since its previous call.
+// Unlike Sync(), it doesn't flush and fsync WAL, so messages up to the id may be not durable yet
+func (k *Keeper) IssuedId() (id, failures int64, err error) {
+	issued := make(chan walMark, 1)
+
+	select {
+	case <-k.stopChan:
+		return 0, 0, errors.New("trying to query WAL on stopped keeper")
+	default:
+		// the marker is queued after pending requests, like the sync marker
+		k.requestChan <- walTask{issued: issued}
+		mark := <-issued
+		return mark.id, mark.failures, nil
+	}
+}
+
+// SyncedId returns id of the last message, made durable by fsync of WAL
+func (k *Keeper) SyncedId() int64 {
+	return atomic.LoadInt64(&k.syncedId)
+}
+
 func (k *Keeper) runWalController() {
 	defer k.serviceWg.Done()
 	ticker := time.Tick(1 * time.Second)
 	for {
 		select {
-		case request, ok := <-k.requestChan:
+		case task, ok := <-k.requestChan:
 			if !ok {
 				// keeper shutting down
 				return
 			}
-			err := k.writeToWalWorker(request)
+			if task.issued != nil {
+				k.mutex.Lock()
+				task.issued <- walMark{id: k.messageId, failures: k.AsyncFailures()}
+				k.mutex.Unlock()
+				continue
+			}
+			if task.done != nil {
+				task.done <- k.syncWal()
+				continue
+			}
+			err := k.writeToWalWorker(task.request)
 			if err != nil {
 				log.Errorf("Unable to write WAL: %s", err)
+				k.failAsync()
 			}
+			k.setHealth(&k.walErr, err)
 		case <-ticker:
 			k.mutex.Lock()
 			//log.Debugf("Current WAL #: %d", k.messageId)
-			k.flushBuffers(true)
+			err := k.flushBuffers(true)
 			k.mutex.Unlock()
+			if err != nil {
+				log.Errorf("Unable to write WAL: %s", err)
+				k.failAsync()
+			}
+			k.setHealth(&k.walErr, err)
 		}
 	}
 }
@@ -144,25 +367,103 @@ func (k *Keeper) writeToWalWorker(request *message.Request) (err error) {
 	err = k.flushBuffers(!request.Unreliable)
 
 	k.mutex.Unlock()
-	return err
+	if err != nil || k.syncPolicy != SyncAlways {
+		return err
+	}
+
+	return k.groupSync(request.Id)
+}
+
+// fsync fsyncs WAL file and records its latency
+func (k *Keeper) fsync(file *os.File) error {
+	defer k.latency.measure(latencyEventWalFsync, time.Now())
+	return file.Sync()
+}
+
+// groupSync returns, when WAL is fsynced up to the message with messageId, which is already written into the file.
+// fsync runs out of k.mutex, so while it's in progress, other writers append their records
+// and then share the next fsync instead of doing one fsync per record
+func (k *Keeper) groupSync(messageId int64) error {
+	k.syncMutex.Lock()
+	defer k.syncMutex.Unlock()
+
+	if atomic.LoadInt64(&k.syncedId) >= messageId {
+		// covered by fsync of other writer
+		return nil
+	}
+
+	// all records up to k.messageId are already flushed into the file by their writers
+	k.mutex.Lock()
+	lastId, file := k.messageId, k.walFile
+	k.mutex.Unlock()
+
+	if err := k.fsync(file); err != nil {
+		// the file could be synced and closed by startNewWal() meanwhile
+		if atomic.LoadInt64(&k.syncedId) >= messageId {
+			return nil
+		}
+		return fmt.Errorf("Keeper.groupSync(): %s", err)
+	}
+	k.advanceSyncedId(lastId)
+
+	return nil
+}
+
+// advanceSyncedId sets k.syncedId to messageId, if it is greater
+func (k *Keeper) advanceSyncedId(messageId int64) {
+	for {
+		syncedId := atomic.LoadInt64(&k.syncedId)
+		if syncedId >= messageId || atomic.CompareAndSwapInt64(&k.syncedId, syncedId, messageId) {
+			return
+		}
+	}
+}
+
+// failAsync records failure of background writing of queued requests
+func (k *Keeper) failAsync() {
+	atomic.AddInt64(&k.asyncFailures, 1)
+}
+
+// AsyncFailures returns count of failed background writes of queued (pipelined) requests since start
+func (k *Keeper) AsyncFailures() int64 {
+	return atomic.LoadInt64(&k.asyncFailures)
+}
+
+// syncWal flushes WAL buffer and fsyncs WAL file regardless of sync policy
+func (k *Keeper) syncWal() error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if err := k.walBuffer.Flush(); err != nil {
+		return fmt.Errorf("Keeper.syncWal(): %s", err)
+	}
+	if err := k.fsync(k.walFile); err != nil {
+		return fmt.Errorf("Keeper.syncWal(): %s", err)
+	}
+	k.lastSync = time.Now()
+	k.advanceSyncedId(k.messageId)
+
+	return nil
 }
 
 // flushBuffers MUST be invoked only while k.mutex locked!
+// Under SyncAlways policy it doesn't fsync, writers do it by groupSync() after unlocking
 func (k *Keeper) flushBuffers(forceFlush bool) (err error) {
 	// if request was't PIPELINEd, and user waits for response, flush buffer to file for more durability
 	// if requests was pipelined, user don't care about responses, so we can flush records to disc just every second
 	if forceFlush || k.syncPolicy == SyncAlways {
-		k.walBuffer.Flush()
+		err = k.walBuffer.Flush()
 		if err != nil {
 			return fmt.Errorf("Keeper.flushBuffers(): %s", err)
 		}
 
-		if k.syncPolicy == SyncAlways || (k.syncPolicy == SyncSometimes && time.Since(k.lastSync) > 1*time.Second) {
-			err = k.walFile.Sync()
+		if k.syncPolicy == SyncSometimes && time.Since(k.lastSync) > 1*time.Second {
+			err = k.fsync(k.walFile)
 			if err != nil {
 				return fmt.Errorf("Keeper.flushBuffers(): %s", err)
 			}
 			k.lastSync = time.Now()
+			k.advanceSyncedId(k.messageId)
 		}
 	}
 
@@ -205,38 +506,86 @@ func (k *Keeper) restoreStorageState() error {
 	return nil
 }
 
+// loadStorage loads storage dump and applies storage diffs, written after it
 func (k *Keeper) loadStorage() error {
-	filename := path.Join(k.dataDir, storageFileName)
+	storage := k.storageFactory()
+	loadable, ok := storage.(Loader)
+	if !ok {
+		return fmt.Errorf("Keeper.loadStorage(): Failed to load data: Storage not support loading")
+	}
+
+	messageId, found, err := k.loadStorageFile(k.storageFileName(), loadable.Load)
+	if err != nil {
+		return err
+	}
+
+	diffs, err := k.getDataDirStorageDiffs()
+	if err != nil {
+		return err
+	}
+
+	// apply diffs from earliest to latest
+	for _, id := range diffs {
+		if id <= messageId {
+			// diff is already merged into the storage dump
+			continue
+		}
+
+		if messageId, _, err = k.loadStorageFile(k.storageDiffFileName(id), loadable.LoadDiff); err != nil {
+			return err
+		}
+		found = true
+	}
+
+	if !found {
+		return nil
+	}
+
+	k.core.SetStorage(storage)
+	k.messageId = messageId
+
+	return nil
+}
+
+// loadStorageFile loads storage data from the file by load func. If the file not exists, found is false
+func (k *Keeper) loadStorageFile(filename string, load func(r io.Reader) (int64, error)) (messageId int64, found bool, err error) {
 	file, err := os.Open(filename)
 	if os.IsNotExist(err) {
 		// no data file found, just skip
-		return nil
+		return 0, false, nil
 	} else if err != nil {
-		return fmt.Errorf("Controller.loadStorage(). Unable to open %s: %s", filename, err)
+		return 0, false, fmt.Errorf("Keeper.loadStorageFile(). Unable to open %s: %s", filename, err)
 	}
 	defer file.Close()
 
 	log.Infof("Loading storage data from %s...", filename)
 
-	storage := k.storageFactory()
-	loadable, ok := storage.(Loader)
-	if !ok {
-		return fmt.Errorf("Keeper.loadStorage(): Failed to load data: Storage not support loading")
-	}
-
-	messageId, err := loadable.Load(bufio.NewReader(file))
+	messageId, err = load(bufio.NewReader(file))
 	if err != nil {
-		return fmt.Errorf("Keeper.loadStorage(): %s", err)
+		return 0, false, fmt.Errorf("Keeper.loadStorageFile(): %s", err)
 	}
 
-	k.core.SetStorage(storage)
-	k.messageId = messageId
+	return messageId, true, nil
+}
 
+// getDataDirStorageDiffs returns message ids of storage diffs in the data dir, ordered from earliest to latest
+func (k *Keeper) getDataDirStorageDiffs() (messageIds []int64, err error) {
+	diffs, err := filepath.Glob(k.storageDiffFileName("*"))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("Keeper.getDataDirStorageDiffs(): %s", err)
 	}
 
-	return nil
+	for _, v := range diffs {
+		var id int64
+		fmt.Sscanf(v, k.storageDiffFileName("%d"), &id)
+		if id > 0 {
+			messageIds = append(messageIds, id)
+		}
+	}
+
+	sort.Slice(messageIds, func(i, j int) bool { return messageIds[i] < messageIds[j] })
+
+	return messageIds, nil
 }
 
 func (k *Keeper) getDataDirWals() (wals []string, err error) {
@@ -260,19 +609,26 @@ func (k *Keeper) processWals(wals []string) (processedWals []string, err error)
 
 	sort.Ints(messageIds)
 
+	r := newWalReplayer(k, k.replayWorkers)
+	defer r.close()
+
 	// process all WALs from earliest to latest
 	for _, messageId := range messageIds {
 		filename := k.walFileName(messageId)
-		if err := k.processWal(filename); err != nil {
+		if err := k.processWal(filename, r); err != nil {
 			return nil, err
 		}
 		processedWals = append(processedWals, filename)
 	}
 
+	if err := r.close(); err != nil {
+		return nil, fmt.Errorf("Keeper.processWals(): %s", err)
+	}
+
 	return processedWals, nil
 }
 
-func (k *Keeper) processWal(filename string) error {
+func (k *Keeper) processWal(filename string, r *walReplayer) error {
 	log.Infof("processing WAL %s...", filename)
 
 	file, err := os.Open(filename)
@@ -282,7 +638,20 @@ func (k *Keeper) processWal(filename string) error {
 	defer file.Close()
 
 	//dec := gob.NewDecoder(file)
-	dec := NewGencodeDecoder(file)
+	dec, err := newWalDecoder(file)
+	if err != nil {
+		return fmt.Errorf("Keeper.processWal(): can't read %s: %s", filename, err)
+	}
+	// the id in the WAL file name is taken by startNewWal, so the first request of the file is the next one
+	fileId := int64(0)
+	fmt.Sscanf(filename, k.walFileName("%d"), &fileId)
+	if err := k.checkWalGap(filename, fileId); err != nil {
+		return err
+	}
+	if fileId > k.messageId {
+		k.messageId = fileId
+	}
+
 	req := new(message.Request)
 	processed := 0
 	for err := dec.Decode(req); err != io.EOF; err = dec.Decode(req) {
@@ -295,15 +664,12 @@ func (k *Keeper) processWal(filename string) error {
 			continue
 		}
 
-		err = k.processor.FixRequestTtl(req)
-		if err != nil {
-			return fmt.Errorf("Keeper.processWal(): can't process %s: %s \nrequest: %s", filename, err, req)
+		if err := k.checkWalGap(filename, req.Id); err != nil {
+			return err
 		}
 
-		resp := k.processor.Process(req)
-		if resp.Status() != message.StatusOk {
-			// we got an error, but this request was successful. Something went wrong
-			return fmt.Errorf("Keeper.processWal(): can't process %s: \nrequest: %s \nresponse: %s", filename, req, resp)
+		if err := r.replay(req); err != nil {
+			return fmt.Errorf("Keeper.processWal(): can't process %s: %s", filename, err)
 		}
 
 		k.messageId = req.Id
@@ -311,42 +677,170 @@ func (k *Keeper) processWal(filename string) error {
 		processed++
 	}
 
+	// requests, scheduled to workers, could fail as well
+	if err := r.wait(); err != nil {
+		return fmt.Errorf("Keeper.processWal(): can't process %s: %s", filename, err)
+	}
+
 	log.Infof("%d requests processed if WAL %s", processed, filename)
 	return nil
 }
 
+// checkWalGap checks, that the message id follows the last replayed one.
+// Missing ids mean lost writes, e.g. a removed WAL file, so they are reported or refused by refuseWalGaps
+func (k *Keeper) checkWalGap(filename string, messageId int64) error {
+	if messageId <= k.messageId+1 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("WAL gap: messages %d-%d are missing before %s, their writes are lost", k.messageId+1, messageId-1, filename)
+	if k.refuseWalGaps {
+		return fmt.Errorf("Keeper.processWal(): %s", msg)
+	}
+
+	log.Warning(msg)
+	return nil
+}
+
+// replayRequest applies request from WAL to the storage and collects changed keys into dirtyKeys, if it isn't nil.
+// Transactions are unpacked and replayed request-by-request at the moment of EXEC, when they were executed
+func (k *Keeper) replayRequest(req *message.Request, dirtyKeys map[string]struct{}) error {
+	if req.Cmd == message.CmdExec {
+		requests, err := req.TransactionRequests()
+		if err != nil {
+			return fmt.Errorf("%s \nrequest: %s", err, req)
+		}
+
+		for _, r := range requests {
+			// queued requests keep time of queueing
+			r.Timestamp = req.Timestamp
+			if err := k.replayRequest(r, dirtyKeys); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	err := k.processor.FixRequestTtl(req)
+	if err != nil {
+		return fmt.Errorf("%s \nrequest: %s", err, req)
+	}
+
+	// the request is replayed at the moment it was done, so keys expire between requests like they originally did
+	resp := NewProcessor(k.core.At(time.Unix(req.Timestamp, 0))).Process(req)
+	if resp.Status() != message.StatusOk {
+		// we got an error, but this request was successful. Something went wrong
+		return fmt.Errorf("\nrequest: %s \nresponse: %s", req, resp)
+	}
+
+	if dirtyKeys != nil {
+		for _, key := range affectedKeys(req) {
+			dirtyKeys[key] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+// persistStorage rewrites the whole storage dump and removes storage diffs, merged into it
 func (k *Keeper) persistStorage() error {
 	//remove expired items to decrease dump size
 	k.core.CollectExpired()
 
-	file, err := ioutil.TempFile(filepath.Dir(k.storageFileName()), filepath.Base(k.storageFileName()))
-	defer file.Close()
-
+	err := k.writeStorageFile(k.storageFileName(), func(w io.Writer, persistable Persister) error {
+		return persistable.Persist(w, k.messageId)
+	})
 	if err != nil {
 		return fmt.Errorf("Keeper.persistStorage(): %s", err)
 	}
 
-	// ensure exclusive access to storage during encoding
+	diffs, err := k.getDataDirStorageDiffs()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range diffs {
+		filename := k.storageDiffFileName(id)
+		if err := os.Remove(filename); err != nil {
+			log.Warningf("Unable to remove merged storage diff %s: %s", filename, err)
+		}
+	}
+
+	return nil
+}
+
+// persistStorageDiff dumps keys, changed by replayed WAL requests, as a storage diff
+func (k *Keeper) persistStorageDiff() error {
+	keys := make([]string, 0, len(k.dirtyKeys))
+	for key := range k.dirtyKeys {
+		keys = append(keys, key)
+	}
+
+	err := k.writeStorageFile(k.storageDiffFileName(k.messageId), func(w io.Writer, persistable Persister) error {
+		return persistable.PersistKeys(w, k.messageId, keys)
+	})
+	if err != nil {
+		return fmt.Errorf("Keeper.persistStorageDiff(): %s", err)
+	}
+
+	return nil
+}
+
+// writeStorageFile writes storage data by persist func into temporary file, and then atomically renames it to filename
+func (k *Keeper) writeStorageFile(filename string, persist func(w io.Writer, persistable Persister) error) error {
 	persistable, ok := k.core.Storage().(Persister)
 	if !ok {
-		return fmt.Errorf("Keeper.persistStorage(): Failed to persist data: Storage not support persistence")
+		return errors.New("Failed to persist data: Storage not support persistence")
 	}
 
+	file, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
 	w := bufio.NewWriter(file)
-	err = persistable.Persist(w, k.messageId)
+	err = persist(w, persistable)
 	if err == nil {
 		err = w.Flush()
 	}
 	if err != nil {
-		return fmt.Errorf("Keeper.persistStorage(): %s", err)
+		return err
 	}
 
-	err = os.Rename(file.Name(), k.storageFileName())
+	return os.Rename(file.Name(), filename)
+}
+
+// needsCompaction returns true, if the next snapshot update should rewrite the whole storage:
+// there are too many storage diffs, or they became larger than the storage dump itself
+func (k *Keeper) needsCompaction() (bool, error) {
+	diffs, err := k.getDataDirStorageDiffs()
 	if err != nil {
-		return fmt.Errorf("Keeper.persistStorage(): %s", err)
+		return false, err
 	}
 
-	return nil
+	if len(diffs) >= maxStorageDiffs {
+		return true, nil
+	}
+
+	storageInfo, err := os.Stat(k.storageFileName())
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("Keeper.needsCompaction(): %s", err)
+	}
+
+	var diffsSize int64
+	for _, id := range diffs {
+		info, err := os.Stat(k.storageDiffFileName(id))
+		if err != nil {
+			return false, fmt.Errorf("Keeper.needsCompaction(): %s", err)
+		}
+		diffsSize += info.Size()
+	}
+
+	return diffsSize >= storageInfo.Size(), nil
 }
 
 // Shutdown shuts Keeper down and persists storage
@@ -371,10 +865,37 @@ func (k *Keeper) Shutdown() error {
 	return nil
 }
 
+// ShutdownNoSave shuts Keeper down without persisting storage: WAL is flushed and kept to replay on the next start
+func (k *Keeper) ShutdownNoSave() error {
+	assert.True(k.isRunning(), "Tying to shut down not running Keeper")
+
+	// wait for background updater finishes
+	close(k.stopChan)
+	close(k.requestChan)
+	k.serviceWg.Wait()
+
+	if err := k.syncWal(); err != nil {
+		return err
+	}
+
+	return k.walFile.Close()
+}
+
 // Start restores storage state and starts new WAL
 func (k *Keeper) Start() (err error) {
 	assert.True(!k.isRunning(), "Tying to start already running Keeper")
 
+	if err := k.fileNames.Validate(); err != nil {
+		return fmt.Errorf("Keeper.Start(): %s", err)
+	}
+
+	// file names may contain subdirectories
+	for _, filename := range []string{k.storageFileName(), k.storageDiffFileName(0), k.walFileName(0)} {
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return fmt.Errorf("Keeper.Start(): %s", err)
+		}
+	}
+
 	err = k.restoreStorageState()
 	if err != nil {
 		return err
@@ -415,22 +936,104 @@ func (k *Keeper) startNewWal() (oldWalFilename, newWalFilename string, err error
 	if k.walFile != nil {
 		oldWalFilename = k.walFile.Name()
 		k.walBuffer.Flush()
+		// writers of the old file could still wait for groupSync(), which can't fsync the closed file,
+		// and Sync() fsyncs the new file only, so records of the old one must be durable before closing regardless of policy
+		if err := k.fsync(k.walFile); err != nil {
+			log.Errorf("Keeper.startNewWal(): unable to sync WAL %s: %s", oldWalFilename, err)
+		} else {
+			k.advanceSyncedId(k.messageId - 1)
+		}
 		k.walFile.Close()
 	}
 
 	k.walFile = file
 	k.walBuffer = bufio.NewWriterSize(file, walBufferSize)
-	k.walEncoder = NewGencodeEncoder(k.walBuffer)
+	if k.walFormat == WalResp {
+		k.walBuffer.WriteString(respWalHeader)
+		k.walEncoder = NewRespEncoder(k.walBuffer)
+	} else {
+		k.walEncoder = gencodeWalEncoder{NewGencodeEncoder(k.walBuffer)}
+	}
 
 	return oldWalFilename, k.walFile.Name(), nil
 }
 
+// newWalDecoder constructs decoder of WAL format, detected by the file header
+func newWalDecoder(file io.Reader) (walDecoder, error) {
+	reader := bufio.NewReader(file)
+	header, err := reader.Peek(len(respWalHeader))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if string(header) == respWalHeader {
+		reader.Discard(len(respWalHeader))
+		return NewRespDecoder(reader), nil
+	}
+
+	return gencodeWalDecoder{NewGencodeDecoder(reader)}, nil
+}
+
 func (k *Keeper) walFileName(messageId interface{}) string {
-	return path.Join(k.dataDir, fmt.Sprintf(walFileName, messageId))
+	return path.Join(k.dataDir, fmt.Sprintf(k.fileNames.Wal, messageId))
 }
 
 func (k *Keeper) storageFileName() string {
-	return path.Join(k.dataDir, storageFileName)
+	return path.Join(k.dataDir, k.fileNames.Storage)
+}
+
+func (k *Keeper) storageDiffFileName(messageId interface{}) string {
+	return path.Join(k.dataDir, fmt.Sprintf(k.fileNames.StorageDiff, messageId))
+}
+
+// CheckHealth returns error, if Keeper isn't running or the last background WAL write or snapshot update failed
+func (k *Keeper) CheckHealth() error {
+	if !k.isRunning() {
+		return errors.New("keeper isn't running")
+	}
+
+	return k.PersistenceError()
+}
+
+// PersistenceError returns error, if the last background WAL write or snapshot update failed.
+// Unlike CheckHealth, it's cheap enough to be checked before every write
+func (k *Keeper) PersistenceError() error {
+	if atomic.LoadUint32(&k.failed) == 0 {
+		return nil
+	}
+
+	k.healthMutex.Lock()
+	defer k.healthMutex.Unlock()
+
+	if k.walErr != nil {
+		return fmt.Errorf("WAL writing failed: %s", k.walErr)
+	}
+	if k.snapshotErr != nil {
+		return fmt.Errorf("snapshot updating failed: %s", k.snapshotErr)
+	}
+
+	return nil
+}
+
+// healthErrors returns errors of the last background WAL write and snapshot update
+func (k *Keeper) healthErrors() (walErr, snapshotErr error) {
+	k.healthMutex.Lock()
+	defer k.healthMutex.Unlock()
+
+	return k.walErr, k.snapshotErr
+}
+
+// setHealth stores result of background operation into one of health error fields
+func (k *Keeper) setHealth(field *error, err error) {
+	k.healthMutex.Lock()
+	defer k.healthMutex.Unlock()
+	*field = err
+
+	var failed uint32
+	if k.walErr != nil || k.snapshotErr != nil {
+		failed = 1
+	}
+	atomic.StoreUint32(&k.failed, failed)
 }
 
 func (k *Keeper) isRunning() bool {
@@ -448,20 +1051,26 @@ func (k *Keeper) runSnapshotUpdater() {
 		case <-k.stopChan:
 			return
 		case <-tick:
+			start := time.Now()
 			err := k.updateSnapshot()
+			k.latency.measure(latencyEventSnapshot, start)
 			if err != nil {
 				log.Errorf("Update snapshot failed: %s", err)
 			}
+			k.setHealth(&k.snapshotErr, err)
 		}
 	}
 }
 
-// updateSnapshot starts new WAL and processes old WALs into existing storage snapshot
+// updateSnapshot starts new WAL and processes old WALs into existing storage snapshot.
+// Only keys, changed by processed WALs, are dumped as a storage diff, and the whole storage is rewritten occasionally
 // unfortunately, fork(2) in GO is unstable & unreliable under the heavy load due to scheduler in the child
 // may stall on StopTheWorld. under the heavy load, less then  1/10 of children starts correctly.
 // so, we cant use this fancy hack to save a snapshot with OS-implemented copy-on-write. Sad, but true =/
 // copy-on-write, implemented on Storage level causes more than 300 ms stalls while copying a hashmap,
 // so, merging WAL into separate copy of storage is least RPS-affecting technique.
+// Dumping the live storage bucket by bucket doesn't stall requests for long, but the dump isn't consistent
+// with any WAL position, so replaying non-idempotent commands over it would apply them twice.
 func (k *Keeper) updateSnapshot() error {
 	log.Info("Updating a snapshot")
 	_, newWal, err := k.startNewWal()
@@ -486,7 +1095,9 @@ func (k *Keeper) updateSnapshot() error {
 	snapshotKeeper := NewKeeper(
 		core.New(k.storageFactory()),
 		k.dataDir,
+		k.fileNames,
 		SyncNever,
+		k.walFormat,
 		0,
 		k.storageFactory,
 	)
@@ -495,6 +1106,9 @@ func (k *Keeper) updateSnapshot() error {
 		return err
 	}
 
+	snapshotKeeper.dirtyKeys = make(map[string]struct{})
+	snapshotKeeper.replayWorkers = k.replayWorkers
+	snapshotKeeper.refuseWalGaps = k.refuseWalGaps
 	processedWals, err = snapshotKeeper.processWals(processingWals)
 	if err != nil {
 		return err
@@ -504,8 +1118,18 @@ func (k *Keeper) updateSnapshot() error {
 		return nil
 	}
 
+	compact, err := snapshotKeeper.needsCompaction()
+	if err != nil {
+		return err
+	}
+
 	// dump storage with merged WALs to disk
-	if err := snapshotKeeper.persistStorage(); err != nil {
+	if compact {
+		err = snapshotKeeper.persistStorage()
+	} else {
+		err = snapshotKeeper.persistStorageDiff()
+	}
+	if err != nil {
 		return err
 	}
 
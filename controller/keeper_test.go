@@ -0,0 +1,1014 @@
+package controller_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mshaverdo/radish/controller"
+	"github.com/mshaverdo/radish/log"
+	"github.com/mshaverdo/radish/message"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeeper_StorageDiff(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	options := controller.DefaultStoreOptions()
+	options.SyncPolicy = controller.SyncAlways
+	options.CollectExpiredInterval = 0
+	options.MergeWalInterval = 50 * time.Millisecond
+
+	s, err := controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+
+	process := func(cmd string, args ...string) {
+		request := message.NewRequest(cmd, nil)
+		for _, v := range args {
+			request.Args = append(request.Args, []byte(v))
+		}
+		if response := s.Process(request); response.Status() != message.StatusOk {
+			t.Fatalf("%s %v: got status %s", cmd, args, response.Status())
+		}
+	}
+	waitFile := func(pattern string) {
+		for i := 0; i < 100; i++ {
+			if files, _ := filepath.Glob(filepath.Join(dataDir, pattern)); len(files) != 0 {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatalf("%s wasn't written", pattern)
+	}
+
+	// the first snapshot update rewrites the whole storage, the next ones write diffs
+	process("SET", "a", "1")
+	process("SET", "b", "2")
+	waitFile("storage.gob")
+
+	process("SET", "a", "10")
+	process("DEL", "b")
+	process("SET", "c", "3")
+	waitFile("storage_diff_*.gob")
+
+	if err := s.CloseNoSave(); err != nil {
+		t.Fatalf("CloseNoSave(): %s", err)
+	}
+
+	s, err = controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+	defer s.Close()
+
+	for key, want := range map[string]string{"a": "10", "c": "3"} {
+		if got, err := s.Core().Get(key); string(got) != want || err != nil {
+			t.Errorf("after restart got %s = %q, %v, want %q", key, got, err, want)
+		}
+	}
+	if got, err := s.Core().Get("b"); err == nil {
+		t.Errorf("after restart got b = %q, want deleted", got)
+	}
+}
+
+func TestFileNames_Validate(t *testing.T) {
+	tests := []struct {
+		names   controller.FileNames
+		wantErr bool
+	}{
+		{controller.DefaultFileNames(), false},
+		{controller.FileNames{}, false},
+		{controller.FileNames{Storage: "db/dump.gob", StorageDiff: "db/dump_%d.diff", Wal: "wal/%v.log"}, false},
+		{controller.FileNames{Wal: "wal.dat"}, true},
+		{controller.FileNames{Wal: "wal_%v_%v.dat"}, true},
+		{controller.FileNames{Wal: "wal_%s.dat"}, true},
+		{controller.FileNames{StorageDiff: "diff"}, true},
+		{controller.FileNames{Storage: "storage_%v.gob"}, true},
+		{controller.FileNames{Wal: "wal_*_%v.dat"}, true},
+		{controller.FileNames{Wal: "data_%v", StorageDiff: "data_%v"}, true},
+		{controller.FileNames{Wal: "%v", Storage: "1"}, true},
+	}
+
+	for _, tst := range tests {
+		if err := tst.names.Validate(); (err != nil) != tst.wantErr {
+			t.Errorf("Validate(%+v): got error %v, want error %t", tst.names, err, tst.wantErr)
+		}
+	}
+}
+
+func TestKeeper_FileNames(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	options := controller.DefaultStoreOptions()
+	options.FileNames = controller.FileNames{Storage: "db/dump.gob", Wal: "wal/%d.log"}
+
+	s, err := controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+	s.Process(message.NewRequest("SET", [][]byte{[]byte("key"), []byte("value")}))
+	if err := s.CloseNoSave(); err != nil {
+		t.Fatalf("CloseNoSave(): %s", err)
+	}
+
+	if wals, _ := filepath.Glob(filepath.Join(dataDir, "wal", "*.log")); len(wals) != 1 {
+		t.Errorf("got WALs %q, want exactly one", wals)
+	}
+
+	s, err = controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close(): %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dataDir, "db", "dump.gob")); err != nil {
+		t.Errorf("snapshot wasn't written: %s", err)
+	}
+
+	s, err = controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+	defer s.Close()
+
+	if got, err := s.Core().Get("key"); string(got) != "value" || err != nil {
+		t.Errorf("after restart got %q, %v, want %q", got, err, "value")
+	}
+}
+
+func TestKeeper_WalFormat(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	// WAL of any format must be replayed regardless of the format of new WALs
+	for i, format := range []controller.WalFormat{controller.WalResp, controller.WalGencode, controller.WalResp} {
+		options := controller.DefaultStoreOptions()
+		options.WalFormat = format
+
+		s, err := controller.OpenStore(dataDir, options)
+		if err != nil {
+			t.Fatalf("%s: OpenStore(): %s", format, err)
+		}
+
+		if i > 0 {
+			if got, err := s.Core().Get("key"); string(got) != "value" || err != nil {
+				t.Errorf("%s: after restart got %q, %v, want %q", format, got, err, "value")
+			}
+		}
+
+		s.Process(message.NewRequest("SET", [][]byte{[]byte("key"), []byte("value")}))
+		if err := s.CloseNoSave(); err != nil {
+			t.Fatalf("%s: CloseNoSave(): %s", format, err)
+		}
+	}
+
+	wals, _ := filepath.Glob(filepath.Join(dataDir, "wal_*.dat"))
+	if len(wals) != 1 {
+		t.Fatalf("got WALs %q, want exactly one", wals)
+	}
+	data, err := ioutil.ReadFile(wals[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"; !strings.HasSuffix(string(data), want) {
+		t.Errorf("got RESP WAL %q, want suffix %q", data, want)
+	}
+}
+
+func TestStore_ImportRDB(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	s, err := controller.OpenStore(dataDir, controller.DefaultStoreOptions())
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+
+	// string with TTL, set, that isn't supported, and list. Zero checksum means, that checksum is disabled
+	rdb := "REDIS0009\xfe\x00" +
+		"\xfc\x00\xd8\xc3\x2c\xbb\x03\x00\x00\x00\x01s\x05value" +
+		"\x02\x03set\x01\x01x" +
+		"\x01\x01l\x02\x04head\x04tail" +
+		"\xff\x00\x00\x00\x00\x00\x00\x00\x00"
+	imported, err := s.ImportRDB(strings.NewReader(rdb))
+	if imported != 2 || err != nil {
+		t.Fatalf("ImportRDB(): got %d, %v, want 2 keys imported", imported, err)
+	}
+
+	// imported keys must be persisted by WAL
+	if err := s.CloseNoSave(); err != nil {
+		t.Fatalf("CloseNoSave(): %s", err)
+	}
+	s, err = controller.OpenStore(dataDir, controller.DefaultStoreOptions())
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+	defer s.Close()
+
+	if got, err := s.Core().Get("s"); string(got) != "value" || err != nil {
+		t.Errorf("after restart got s = %q, %v, want %q", got, err, "value")
+	}
+	if ttl, err := s.Core().Ttl("s"); ttl <= 0 || err != nil {
+		t.Errorf("after restart got TTL of s = %d, %v, want positive", ttl, err)
+	}
+	if got, err := s.Core().LRange("l", 0, -1); len(got) != 2 || string(got[0]) != "head" || err != nil {
+		t.Errorf("after restart got l = %q, %v, want [head tail]", got, err)
+	}
+	if keys := s.Core().Keys("*"); len(keys) != 2 {
+		t.Errorf("after restart got keys %q, want s and l", keys)
+	}
+}
+
+func TestStore_TtlJitter(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	options := controller.DefaultStoreOptions()
+	options.TtlJitter = 50
+	s, err := controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+
+	if err := s.SetTtlJitter(101); err != controller.ErrInvalidTtlJitter {
+		t.Errorf("SetTtlJitter(101): got %v, want %v", err, controller.ErrInvalidTtlJitter)
+	}
+
+	// the key is inserted after the command
+	requests := [][]string{
+		{"SETEX", "1000", "value"},
+		{"EXPIRE", "1000"},
+		{"SET", "value", "EX", "1000"},
+		{"SET", "value", "NX", "PX", "1000000"},
+		{"LPUSHEX", "1000", "value"},
+		{"HSETEX", "1000", "field", "value"},
+	}
+	ttls := make(map[string]int)
+	distinct := make(map[int]bool)
+	for i := 0; i < 20; i++ {
+		for j, args := range requests {
+			key := fmt.Sprintf("key_%d_%d", j, i)
+			if args[0] == "EXPIRE" {
+				s.Process(message.NewRequest("SET", [][]byte{[]byte(key), []byte("value")}))
+			}
+
+			request := message.NewRequest(args[0], [][]byte{[]byte(key)})
+			for _, arg := range args[1:] {
+				request.Args = append(request.Args, []byte(arg))
+			}
+			if response := s.Process(request); response.Status() != message.StatusOk {
+				t.Fatalf("%s: got status %s", request, response.Status())
+			}
+
+			ttl, err := s.Core().Ttl(key)
+			if err != nil || ttl < 499 || ttl > 1500 {
+				t.Errorf("%s: got TTL %d, %v, want 1000 ± 50%%", request, ttl, err)
+			}
+			ttls[key] = ttl
+			distinct[ttl] = true
+		}
+	}
+	if len(distinct) < 2 {
+		t.Errorf("got the same TTL for all keys: %v", distinct)
+	}
+
+	// WAL must contain jittered TTL, so replay restores the same TTL
+	if err := s.CloseNoSave(); err != nil {
+		t.Fatalf("CloseNoSave(): %s", err)
+	}
+	s, err = controller.OpenStore(dataDir, controller.DefaultStoreOptions())
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+	defer s.Close()
+
+	for key, want := range ttls {
+		// TTL could be decreased by 1 second due to restart on the second boundary
+		if got, err := s.Core().Ttl(key); err != nil || got > want || got < want-1 {
+			t.Errorf("after restart got TTL of %s = %d, %v, want %d", key, got, err, want)
+		}
+	}
+}
+
+func TestStore_ListMaxLength(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	s, err := controller.OpenStore(dataDir, controller.DefaultStoreOptions())
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+
+	lpush := func(key string, values ...string) message.Response {
+		request := message.NewRequest("LPUSH", [][]byte{[]byte(key)})
+		for _, v := range values {
+			request.Args = append(request.Args, []byte(v))
+		}
+		return s.Process(request)
+	}
+	lrange := func(s *controller.Store, key string) string {
+		values, _ := s.Core().LRange(key, 0, -1)
+		return fmt.Sprintf("%s", values)
+	}
+
+	s.SetListMaxLength(3)
+	if response := lpush("errors", "a", "b", "c", "d"); response.Status() != message.StatusInvalidArguments {
+		t.Errorf("LPUSH over the limit: got status %s, want %s", response.Status(), message.StatusInvalidArguments)
+	}
+	lpush("errors", "a", "b", "c")
+
+	s.SetListOverflowTrim(true)
+	for i := 0; i < 10; i++ {
+		lpush("trimmed", fmt.Sprint(i))
+	}
+	if got, want := lrange(s, "trimmed"), "[9 8 7]"; got != want {
+		t.Errorf("trimmed list: got %s, want %s", got, want)
+	}
+
+	// LPUSHEX keeps its TTL under the limit
+	lpushex := message.NewRequest("LPUSHEX", [][]byte{[]byte("volatile"), []byte("1000"), []byte("a"), []byte("b"), []byte("c"), []byte("d")})
+	if response := s.Process(lpushex); response.Status() != message.StatusOk {
+		t.Errorf("LPUSHEX over the limit with trim: got status %s, want %s", response.Status(), message.StatusOk)
+	}
+	if got, want := lrange(s, "volatile"), "[d c b]"; got != want {
+		t.Errorf("LPUSHEX over the limit with trim: got %s, want %s", got, want)
+	}
+
+	// WAL contains the limit, effective at the moment of LPUSH, so replay without limit restores the same lists
+	s.SetListMaxLength(0)
+	lpush("unlimited", "a", "b", "c", "d")
+	if err := s.CloseNoSave(); err != nil {
+		t.Fatalf("CloseNoSave(): %s", err)
+	}
+	s, err = controller.OpenStore(dataDir, controller.DefaultStoreOptions())
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+	defer s.Close()
+
+	for key, want := range map[string]string{"errors": "[c b a]", "trimmed": "[9 8 7]", "unlimited": "[d c b a]", "volatile": "[d c b]"} {
+		if got := lrange(s, key); got != want {
+			t.Errorf("after restart %s: got %s, want %s", key, got, want)
+		}
+	}
+	if ttl, err := s.Core().Ttl("volatile"); ttl < 999 || ttl > 1000 || err != nil {
+		t.Errorf("after restart TTL of volatile: got %d, %v, want 1000", ttl, err)
+	}
+}
+
+func TestStore_DelWalChunks(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	options := controller.DefaultStoreOptions()
+	options.WalFormat = controller.WalResp
+	s, err := controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+
+	const count = 25000
+	keys := make([][]byte, count)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key_%d", i))
+		s.Process(message.NewRequest("SET", [][]byte{keys[i], []byte("value")}))
+	}
+	s.Process(message.NewRequest("SET", [][]byte{[]byte("kept"), []byte("value")}))
+
+	response, ok := s.Process(message.NewRequest("DEL", keys)).(*message.ResponseInt)
+	if !ok || response.Payload() != count {
+		t.Fatalf("DEL: got %v, want %d", response, count)
+	}
+	if err := s.CloseNoSave(); err != nil {
+		t.Fatalf("CloseNoSave(): %s", err)
+	}
+
+	wals, _ := filepath.Glob(filepath.Join(dataDir, "wal_*.dat"))
+	if len(wals) != 1 {
+		t.Fatalf("got WALs %q, want exactly one", wals)
+	}
+	data, err := ioutil.ReadFile(wals[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(data), "$3\r\nDEL\r\n"); got != 3 {
+		t.Errorf("got %d DEL records in WAL, want 3", got)
+	}
+
+	s, err = controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+	defer s.Close()
+
+	if keys := s.Core().Keys("*"); len(keys) != 1 || keys[0] != "kept" {
+		t.Errorf("after restart got %d keys, want only kept", len(keys))
+	}
+}
+
+func BenchmarkStore_Del1M(b *testing.B) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	options := controller.DefaultStoreOptions()
+	options.SyncPolicy = controller.SyncNever
+	options.CollectExpiredInterval = 0
+	s, err := controller.OpenStore(dataDir, options)
+	if err != nil {
+		b.Fatalf("OpenStore(): %s", err)
+	}
+	defer s.CloseNoSave()
+
+	keys := make([][]byte, 1000000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key_%d", i))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for _, key := range keys {
+			s.Core().Set(string(key), []byte("value"))
+		}
+		b.StartTimer()
+
+		s.Process(message.NewRequest("DEL", keys))
+	}
+}
+
+func TestStore_ReplayWorkers(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	options := controller.DefaultStoreOptions()
+	options.CollectExpiredInterval = 0
+	s, err := controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+
+	request := func(cmd string, args ...string) *message.Request {
+		r := message.NewRequest(cmd, nil)
+		for _, v := range args {
+			r.Args = append(r.Args, []byte(v))
+		}
+		return r
+	}
+
+	// results of SETRANGE and LPUSH depend on order of requests to the same key,
+	// DEL, BITOP and transactions affect several keys and must see all previous requests applied
+	for i := 0; i < 3000; i++ {
+		str, list := fmt.Sprintf("str_%d", i%50), fmt.Sprintf("list_%d", i%30)
+		s.Process(request("SETRANGE", str, fmt.Sprint(i%7), fmt.Sprint(i)))
+		s.Process(request("LPUSH", list, fmt.Sprint(i)))
+		s.Process(request("HSET", fmt.Sprintf("hash_%d", i%20), "field", fmt.Sprint(i)))
+
+		switch i % 500 {
+		case 100:
+			s.Process(request("DEL", str, list, "str_0"))
+		case 200:
+			s.Process(request("BITOP", "OR", "bitop", str, "str_1"))
+		case 300:
+			tx, err := message.NewRequestTransaction([]*message.Request{
+				request("SET", str, "tx"),
+				request("LPUSH", list, "tx"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.WriteToWal(tx); err != nil {
+				t.Fatalf("WriteToWal(): %s", err)
+			}
+		}
+	}
+	if err := s.CloseNoSave(); err != nil {
+		t.Fatalf("CloseNoSave(): %s", err)
+	}
+
+	wals, _ := filepath.Glob(filepath.Join(dataDir, "wal_*.dat"))
+	replay := func(workers int) map[string]string {
+		dir, err := ioutil.TempDir("", "radish")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		for _, wal := range wals {
+			data, err := ioutil.ReadFile(wal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, filepath.Base(wal)), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		options.ReplayWorkers = workers
+		s, err := controller.OpenStore(dir, options)
+		if err != nil {
+			t.Fatalf("%d workers: OpenStore(): %s", workers, err)
+		}
+		defer s.CloseNoSave()
+
+		values := make(map[string]string)
+		for _, key := range s.Core().Keys("*") {
+			value, err := s.Core().Dump(key)
+			if err != nil {
+				t.Fatalf("%d workers: Dump(%q): %s", workers, key, err)
+			}
+			values[key] = string(value)
+		}
+
+		return values
+	}
+
+	want := replay(1)
+	if len(want) != 101 {
+		t.Fatalf("serial replay: got %d keys, want 101", len(want))
+	}
+	for _, workers := range []int{2, 8} {
+		got := replay(workers)
+		if len(got) != len(want) {
+			t.Errorf("%d workers: got %d keys, want %d", workers, len(got), len(want))
+		}
+		for key, value := range want {
+			if got[key] != value {
+				t.Errorf("%d workers: got %s = %q, want %q", workers, key, got[key], value)
+			}
+		}
+	}
+}
+
+func TestStore_ReplayExpiration(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	options := controller.DefaultStoreOptions()
+	options.CollectExpiredInterval = 0
+	s, err := controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+
+	start := time.Now().Add(-time.Minute).Unix()
+	requests := []struct {
+		second int64
+		args   []string
+	}{
+		// writes, done before expiration of the key, must expire with it
+		{0, []string{"HSETEX", "hash_before", "10", "f1", "v1"}},
+		{5, []string{"HSET", "hash_before", "f2", "v2"}},
+		{0, []string{"LPUSHEX", "list_before", "10", "a"}},
+		{5, []string{"LPUSH", "list_before", "b"}},
+		{0, []string{"SET", "str_before", "a", "EX", "10"}},
+		{5, []string{"SETRANGE", "str_before", "1", "b"}},
+		// writes, done after expiration of the key, create a new persistent one
+		{0, []string{"HSETEX", "hash_after", "10", "f1", "v1"}},
+		{30, []string{"HSET", "hash_after", "f2", "v2"}},
+		{0, []string{"LPUSH", "list_after", "a"}},
+		{0, []string{"EXPIRE", "list_after", "10"}},
+		{30, []string{"LPUSH", "list_after", "b"}},
+		{0, []string{"SETEX", "str_after", "10", "a"}},
+		{30, []string{"SETRANGE", "str_after", "1", "b"}},
+		{0, []string{"SETEX", "tx_after", "10", "a"}},
+	}
+	for _, r := range requests {
+		request := &message.Request{Timestamp: start + r.second, Cmd: r.args[0]}
+		for _, arg := range r.args[1:] {
+			request.Args = append(request.Args, []byte(arg))
+		}
+		if err := s.WriteToWal(request); err != nil {
+			t.Fatalf("WriteToWal(%s): %s", r.args, err)
+		}
+	}
+	// requests of a transaction are executed at EXEC, regardless of the time, when they were queued
+	queued := &message.Request{Timestamp: start + 5, Cmd: "SETRANGE", Args: [][]byte{[]byte("tx_after"), []byte("1"), []byte("b")}}
+	transaction, err := message.NewRequestTransaction([]*message.Request{queued})
+	if err != nil {
+		t.Fatalf("NewRequestTransaction(): %s", err)
+	}
+	transaction.Timestamp = start + 30
+	if err := s.WriteToWal(transaction); err != nil {
+		t.Fatalf("WriteToWal(EXEC): %s", err)
+	}
+	if err := s.CloseNoSave(); err != nil {
+		t.Fatalf("CloseNoSave(): %s", err)
+	}
+
+	s, err = controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+	defer s.CloseNoSave()
+
+	for _, key := range []string{"hash_before", "list_before", "str_before"} {
+		if got := s.Core().Type(key); got != "none" {
+			t.Errorf("%s: got %s key, want expired one", key, got)
+		}
+	}
+
+	got := map[string]string{}
+	if value, err := s.Core().DGetAll("hash_after"); err == nil {
+		got["hash_after"] = fmt.Sprintf("%q", value)
+	}
+	if value, err := s.Core().LRange("list_after", 0, -1); err == nil {
+		got["list_after"] = fmt.Sprintf("%q", value)
+	}
+	for _, key := range []string{"str_after", "tx_after"} {
+		if value, err := s.Core().Get(key); err == nil {
+			got[key] = fmt.Sprintf("%q", value)
+		}
+	}
+	want := map[string]string{"hash_after": `["f2" "v2"]`, "list_after": `["b"]`, "str_after": `"\x00b"`, "tx_after": `"\x00b"`}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s: got %s, want %s", key, got[key], value)
+		}
+		if ttl, _ := s.Core().Ttl(key); ttl != -1 {
+			t.Errorf("%s: got TTL %d, want persistent key", key, ttl)
+		}
+	}
+}
+
+func BenchmarkStore_ReplayWal1M(b *testing.B) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	options := controller.DefaultStoreOptions()
+	options.SyncPolicy = controller.SyncNever
+	options.CollectExpiredInterval = 0
+	s, err := controller.OpenStore(dataDir, options)
+	if err != nil {
+		b.Fatalf("OpenStore(): %s", err)
+	}
+	for i := 0; i < 1000000; i++ {
+		request := message.NewRequest("SET", [][]byte{[]byte(fmt.Sprintf("key_%d", i%100000)), []byte("value")})
+		request.Unreliable = true
+		s.Process(request)
+	}
+	if err := s.CloseNoSave(); err != nil {
+		b.Fatalf("CloseNoSave(): %s", err)
+	}
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			options.ReplayWorkers = workers
+			for i := 0; i < b.N; i++ {
+				s, err := controller.OpenStore(dataDir, options)
+				if err != nil {
+					b.Fatalf("OpenStore(): %s", err)
+				}
+				b.StopTimer()
+				s.CloseNoSave()
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+func TestStore_RefuseWalGaps(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	options := controller.DefaultStoreOptions()
+	options.CollectExpiredInterval = 0
+
+	// every start merges WALs into the snapshot, so keep WALs to replay them without the snapshot
+	var names []string
+	wals := make(map[string][]byte)
+	session := func(keys ...string) {
+		s, err := controller.OpenStore(dataDir, options)
+		if err != nil {
+			t.Fatalf("OpenStore(): %s", err)
+		}
+		for _, key := range keys {
+			s.Process(message.NewRequest("SET", [][]byte{[]byte(key), []byte("value")}))
+		}
+		if err := s.CloseNoSave(); err != nil {
+			t.Fatalf("CloseNoSave(): %s", err)
+		}
+
+		files, _ := filepath.Glob(filepath.Join(dataDir, "wal_*.dat"))
+		for _, file := range files {
+			if wals[file], err = ioutil.ReadFile(file); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, file)
+		}
+	}
+	// the empty session must not make a gap before the next WAL
+	session("a", "b")
+	session()
+	session("c")
+
+	replay := func(wals map[string][]byte) (*controller.Store, error) {
+		files, _ := filepath.Glob(filepath.Join(dataDir, "*"))
+		for _, file := range files {
+			os.Remove(file)
+		}
+		for file, data := range wals {
+			if err := ioutil.WriteFile(file, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return controller.OpenStore(dataDir, options)
+	}
+
+	// all WALs form a contiguous sequence
+	options.RefuseWalGaps = true
+	s, err := replay(wals)
+	if err != nil {
+		t.Fatalf("OpenStore() with all WALs: %s", err)
+	}
+	if keys := s.Core().Keys("*"); len(keys) != 3 {
+		t.Errorf("after replay of all WALs got keys %q, want a, b and c", keys)
+	}
+	s.CloseNoSave()
+
+	// without the first WAL its writes are lost
+	delete(wals, names[0])
+	if s, err := replay(wals); err == nil || !strings.Contains(err.Error(), "WAL gap") {
+		t.Errorf("OpenStore() with missing WAL: got error %v, want WAL gap", err)
+		if err == nil {
+			s.CloseNoSave()
+		}
+	}
+
+	options.RefuseWalGaps = false
+	s, err = replay(wals)
+	if err != nil {
+		t.Fatalf("OpenStore() with missing WAL and warning: %s", err)
+	}
+	defer s.CloseNoSave()
+	if keys := s.Core().Keys("*"); len(keys) != 1 || keys[0] != "c" {
+		t.Errorf("after replay with gap got keys %q, want only c", keys)
+	}
+}
+
+func TestStore_SyncAlwaysConcurrentWriters(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	const writers, writes = 16, 100
+
+	options := controller.DefaultStoreOptions()
+	options.SyncPolicy = controller.SyncAlways
+	options.CollectExpiredInterval = 0
+	// rotate WAL while writers wait for fsync
+	options.MergeWalInterval = 10 * time.Millisecond
+
+	s, err := controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				key := fmt.Sprintf("key_%d_%d", w, i)
+				if response := s.Process(message.NewRequest("SET", [][]byte{[]byte(key), []byte(key)})); response.Status() != message.StatusOk {
+					t.Errorf("SET %s: got status %s", key, response.Status())
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if err := s.CloseNoSave(); err != nil {
+		t.Fatalf("CloseNoSave(): %s", err)
+	}
+
+	s, err = controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+	defer s.Close()
+
+	for w := 0; w < writers; w++ {
+		for i := 0; i < writes; i++ {
+			key := fmt.Sprintf("key_%d_%d", w, i)
+			if got, err := s.Core().Get(key); string(got) != key || err != nil {
+				t.Fatalf("after restart got %s = %q, %v", key, got, err)
+			}
+		}
+	}
+}
+
+func BenchmarkStore_SyncAlways(b *testing.B) {
+	log.SetLevel(log.CRITICAL)
+
+	for _, writers := range []int{1, 16, 64} {
+		b.Run(fmt.Sprintf("writers=%d", writers), func(b *testing.B) {
+			dataDir, err := ioutil.TempDir("", "radish")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer os.RemoveAll(dataDir)
+
+			options := controller.DefaultStoreOptions()
+			options.SyncPolicy = controller.SyncAlways
+			options.CollectExpiredInterval = 0
+			s, err := controller.OpenStore(dataDir, options)
+			if err != nil {
+				b.Fatalf("OpenStore(): %s", err)
+			}
+			defer s.CloseNoSave()
+
+			// RunParallel starts GOMAXPROCS*parallelism goroutines
+			b.SetParallelism(writers)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					s.Process(message.NewRequest("SET", [][]byte{[]byte("key"), []byte("value")}))
+				}
+			})
+		})
+	}
+}
+
+func TestStore_AsyncWriteFailure(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	options := controller.DefaultStoreOptions()
+	options.SyncPolicy = controller.SyncNever
+	options.CollectExpiredInterval = 0
+	options.MergeWalInterval = 0
+
+	s, err := controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+	defer s.Close()
+
+	set := func(key string) message.Response {
+		request := message.NewRequest("SET", [][]byte{[]byte(key), []byte(key)})
+		request.Unreliable = true
+		return s.Process(request)
+	}
+
+	_, startFailures, err := s.WalIssuedId()
+	if err != nil {
+		t.Fatalf("WalIssuedId(): %s", err)
+	}
+
+	s.FailWal(errors.New("disk full"))
+	if response := set("lost"); response.Status() != message.StatusOk {
+		t.Errorf("queued SET: got status %s, want %s", response.Status(), message.StatusOk)
+	}
+	// the failed write has no WAL id, so the issued id query counts it: the marker is queued after the write
+	if _, failures, err := s.WalIssuedId(); err != nil || failures != startFailures+1 {
+		t.Errorf("WalIssuedId() after failed write: got failures %d, %v, want %d", failures, err, startFailures+1)
+	}
+	// sync doesn't consume the failure, so it's reported to every caller, that tracks the count
+	if err := s.SyncWal(); err != nil {
+		t.Errorf("SyncWal() after failed write: got %v, want nil", err)
+	}
+	if response := set("lost"); response.Status() != message.StatusOk {
+		t.Errorf("queued SET: got status %s, want %s", response.Status(), message.StatusOk)
+	}
+	if _, failures, err := s.WalIssuedId(); err != nil || failures != startFailures+2 {
+		t.Errorf("WalIssuedId() after second failed write: got failures %d, %v, want %d", failures, err, startFailures+2)
+	}
+	s.FailWal(nil)
+
+	if response := set("written"); response.Status() != message.StatusOk {
+		t.Errorf("queued SET: got status %s, want %s", response.Status(), message.StatusOk)
+	}
+	// successful writes don't reset the count
+	if _, failures, err := s.WalIssuedId(); err != nil || failures != startFailures+2 {
+		t.Errorf("WalIssuedId() after recovery: got failures %d, %v, want %d", failures, err, startFailures+2)
+	}
+	if got := s.AsyncWalFailures(); got != 2 {
+		t.Errorf("AsyncWalFailures(): got %d, want 2", got)
+	}
+}
+
+func TestStore_WalIssuedId(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+	dataDir, err := ioutil.TempDir("", "radish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	options := controller.DefaultStoreOptions()
+	options.SyncPolicy = controller.SyncNever
+	options.CollectExpiredInterval = 0
+	options.MergeWalInterval = 0
+
+	s, err := controller.OpenStore(dataDir, options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+	defer s.Close()
+
+	startId, _, err := s.WalIssuedId()
+	if err != nil {
+		t.Fatalf("WalIssuedId(): %s", err)
+	}
+
+	// pipelined requests are written into WAL in background, the id covers them anyway
+	for i := 0; i < 10; i++ {
+		request := message.NewRequest("SET", [][]byte{[]byte("key"), []byte("value")})
+		request.Unreliable = true
+		s.Process(request)
+	}
+	issuedId, failures, err := s.WalIssuedId()
+	if err != nil || issuedId != startId+10 || failures != 0 {
+		t.Fatalf("WalIssuedId() after 10 writes: got %d, %d failures, %v, want %d", issuedId, failures, err, startId+10)
+	}
+	// SyncNever doesn't fsync WAL by itself
+	if syncedId := s.WalSyncedId(); syncedId >= issuedId {
+		t.Errorf("WalSyncedId() before sync: got %d, want less than %d", syncedId, issuedId)
+	}
+
+	if err := s.SyncWal(); err != nil {
+		t.Fatalf("SyncWal(): %s", err)
+	}
+	if syncedId := s.WalSyncedId(); syncedId < issuedId {
+		t.Errorf("WalSyncedId() after sync: got %d, want at least %d", syncedId, issuedId)
+	}
+
+	memory, err := controller.OpenStore("", options)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err)
+	}
+	defer memory.Close()
+
+	memory.Process(message.NewRequest("SET", [][]byte{[]byte("key"), []byte("value")}))
+	if issuedId, _, err := memory.WalIssuedId(); issuedId != 0 || err != nil || memory.WalSyncedId() != 0 {
+		t.Errorf("not persistent store: got issued id %d, %v and synced id %d, want zeros", issuedId, err, memory.WalSyncedId())
+	}
+}
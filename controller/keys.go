@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"github.com/mshaverdo/radish/message"
+)
+
+// handleKeys processes KEYS pattern requests.
+// Unlike the Keys() core command, matching keys are collected directly from the storage,
+// to avoid building a slice of the whole keyspace on huge databases. The storage is locked for modifications
+// only while keys are collected, not while the reply is written into the connection.
+// Inside a transaction or a script the storage is already locked by the run
+func (c *Controller) handleKeys(request *message.Request, run *atomicRun) message.Response {
+	if len(request.Args) != 1 {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+
+	// KEYS scans the whole keyspace regardless of pattern, so the limit is checked before scanning
+	if limit := c.KeysScanLimit(); limit > 0 && c.store.core.DbSize() > limit {
+		return getResponseCommandError(request.Cmd, ErrTooManyKeys)
+	}
+
+	pattern := string(request.Args[0])
+
+	if run == nil {
+		// keep KEYS atomic against transactions, like any other command
+		c.transactionMutex.RLock()
+		defer c.transactionMutex.RUnlock()
+	}
+
+	var keys [][]byte
+	c.store.core.KeysFunc(pattern, func(count int, forEach func(yield func(key string))) {
+		keys = make([][]byte, 0, count)
+		forEach(func(key string) {
+			keys = append(keys, []byte(key))
+		})
+	})
+
+	return getResponseStringSlicePayload(keys)
+}
@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"errors"
+	"github.com/mshaverdo/radish/message"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrUnknownLatencyCmd = errors.New("Unknown LATENCY subcommand")
+
+// latencyHistoryLen is a count of latency spikes, kept for every event, like Redis LATENCY_TS_LEN
+const latencyHistoryLen = 160
+
+// Events of latency monitoring
+const (
+	// latencyEventCommand is processing of a command by Controller
+	latencyEventCommand = "command"
+	// latencyEventWalFsync is fsync of WAL file
+	latencyEventWalFsync = "wal-fsync"
+	// latencyEventSnapshot is merging of WAL into the storage snapshot
+	latencyEventSnapshot = "snapshot"
+)
+
+// latencySample is the max latency of an event within a second
+type latencySample struct {
+	// time is unix time in seconds
+	time int64
+	// latency is in milliseconds
+	latency int64
+}
+
+// latencyEvent is a ring buffer of the latest latency spikes of an event
+type latencyEvent struct {
+	samples [latencyHistoryLen]latencySample
+	// next is an index of the next sample in samples
+	next  int
+	count int
+	// max is the max latency of the event since the last reset
+	max int64
+}
+
+// latencyMonitor records latencies of events, that are equal or over the threshold, like Redis latency monitor.
+// Spikes of the same event within a second are merged into a single sample with the max latency.
+// Zero value is ready to use, monitoring is disabled
+type latencyMonitor struct {
+	// threshold is in milliseconds, zero disables monitoring. Accessed atomically
+	threshold int64
+
+	mu     sync.Mutex
+	events map[string]*latencyEvent
+}
+
+// setThreshold sets minimal latency in milliseconds of recorded events. Zero disables monitoring, recorded events are kept
+func (m *latencyMonitor) setThreshold(milliseconds int) {
+	atomic.StoreInt64(&m.threshold, int64(milliseconds))
+}
+
+// getThreshold returns minimal latency in milliseconds of recorded events, zero if monitoring is disabled
+func (m *latencyMonitor) getThreshold() int {
+	return int(atomic.LoadInt64(&m.threshold))
+}
+
+// isEnabled returns true, if latencies are recorded
+func (m *latencyMonitor) isEnabled() bool {
+	return atomic.LoadInt64(&m.threshold) > 0
+}
+
+// measure records latency of the event, started at start. It's intended to be deferred
+func (m *latencyMonitor) measure(event string, start time.Time) {
+	m.add(event, time.Since(start))
+}
+
+// add records latency of the event, if it's equal or over the threshold
+func (m *latencyMonitor) add(event string, latency time.Duration) {
+	threshold := atomic.LoadInt64(&m.threshold)
+	milliseconds := int64(latency / time.Millisecond)
+	if threshold <= 0 || milliseconds < threshold {
+		return
+	}
+
+	now := time.Now().Unix()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.events == nil {
+		m.events = make(map[string]*latencyEvent)
+	}
+	e, ok := m.events[event]
+	if !ok {
+		e = &latencyEvent{}
+		m.events[event] = e
+	}
+
+	if milliseconds > e.max {
+		e.max = milliseconds
+	}
+
+	if e.count > 0 {
+		last := &e.samples[(e.next+latencyHistoryLen-1)%latencyHistoryLen]
+		if last.time == now {
+			if milliseconds > last.latency {
+				last.latency = milliseconds
+			}
+			return
+		}
+	}
+
+	e.samples[e.next] = latencySample{time: now, latency: milliseconds}
+	e.next = (e.next + 1) % latencyHistoryLen
+	if e.count < latencyHistoryLen {
+		e.count++
+	}
+}
+
+// history returns samples of the event from the oldest to the latest
+func (m *latencyMonitor) history(event string) []latencySample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.events[event]
+	if !ok {
+		return nil
+	}
+
+	result := make([]latencySample, e.count)
+	for i := range result {
+		result[i] = e.samples[(e.next-e.count+i+latencyHistoryLen)%latencyHistoryLen]
+	}
+
+	return result
+}
+
+// latest returns the latest sample and the max latency of every recorded event, ordered by event name
+func (m *latencyMonitor) latest() (events []string, samples []latencySample, maxLatencies []int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for event := range m.events {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+
+	for _, event := range events {
+		e := m.events[event]
+		samples = append(samples, e.samples[(e.next+latencyHistoryLen-1)%latencyHistoryLen])
+		maxLatencies = append(maxLatencies, e.max)
+	}
+
+	return events, samples, maxLatencies
+}
+
+// reset forgets recorded samples of the events, or of all events, if none are provided.
+// Returns count of actually reset events
+func (m *latencyMonitor) reset(events ...string) (count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(events) == 0 {
+		count = len(m.events)
+		m.events = nil
+		return count
+	}
+
+	for _, event := range events {
+		if _, ok := m.events[event]; ok {
+			delete(m.events, event)
+			count++
+		}
+	}
+
+	return count
+}
+
+// handleLatency processes LATENCY LATEST|HISTORY event|RESET [event ...] requests
+func (c *Controller) handleLatency(request *message.Request) message.Response {
+	if len(request.Args) == 0 {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+
+	latency := c.store.latency
+	subcommand := strings.ToUpper(string(request.Args[0]))
+	args := request.Args[1:]
+
+	switch subcommand {
+	case "LATEST":
+		if len(args) != 0 {
+			return getResponseInvalidArguments(request.Cmd+"|"+subcommand, ErrWrongArgumentsCount)
+		}
+
+		events, samples, maxLatencies := latency.latest()
+		result := make([]message.Response, len(events))
+		for i, event := range events {
+			result[i] = getResponseArrayPayload([]message.Response{
+				getResponseStringPayload([]byte(event)),
+				getResponseIntPayload(samples[i].time),
+				getResponseIntPayload(samples[i].latency),
+				getResponseIntPayload(maxLatencies[i]),
+			})
+		}
+
+		return getResponseArrayPayload(result)
+	case "HISTORY":
+		if len(args) != 1 {
+			return getResponseInvalidArguments(request.Cmd+"|"+subcommand, ErrWrongArgumentsCount)
+		}
+
+		samples := latency.history(string(args[0]))
+		result := make([]message.Response, len(samples))
+		for i, sample := range samples {
+			result[i] = getResponseIntSlicePayload([]int64{sample.time, sample.latency})
+		}
+
+		return getResponseArrayPayload(result)
+	case "RESET":
+		events := make([]string, len(args))
+		for i, arg := range args {
+			events[i] = string(arg)
+		}
+
+		return getResponseIntPayload(int64(latency.reset(events...)))
+	default:
+		return getResponseInvalidArguments(request.Cmd, ErrUnknownLatencyCmd)
+	}
+}
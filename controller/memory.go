@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"errors"
+	"github.com/mshaverdo/radish/log"
+	"github.com/mshaverdo/radish/message"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+var ErrUnknownMemoryCmd = errors.New("Unknown MEMORY subcommand")
+
+// handleMemory processes MEMORY PURGE requests
+func (c *Controller) handleMemory(request *message.Request) message.Response {
+	if len(request.Args) != 1 {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+
+	switch strings.ToUpper(string(request.Args[0])) {
+	case "PURGE":
+		return getResponseIntPayload(c.store.PurgeMemory())
+	default:
+		return getResponseInvalidArguments(request.Cmd, ErrUnknownMemoryCmd)
+	}
+}
+
+// PurgeMemory rebuilds storage structures, that never shrink, like Go maps, to fit the current count of keys,
+// and returns unused memory to the OS. Returns count of bytes, released to the OS
+func (s *Store) PurgeMemory() int64 {
+	before := retainedMemory()
+	s.core.Compact()
+	debug.FreeOSMemory()
+
+	released := before - retainedMemory()
+	if released < 0 {
+		// memory, allocated by concurrent requests meanwhile
+		released = 0
+	}
+
+	return released
+}
+
+// retainedMemory returns count of bytes of heap memory, obtained from the OS and not released back yet
+func retainedMemory() int64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	return int64(stats.HeapSys - stats.HeapReleased)
+}
+
+func (s *Store) runMemoryPurger() {
+	defer s.serviceWg.Done()
+
+	tick := time.Tick(s.memoryPurgeInterval)
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-tick:
+			released := s.PurgeMemory()
+			log.Debugf("Memory purge released %d bytes", released)
+		}
+	}
+}
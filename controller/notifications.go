@@ -0,0 +1,264 @@
+package controller
+
+import (
+	"errors"
+	"github.com/mshaverdo/radish/message"
+	"strings"
+	"sync/atomic"
+)
+
+// NotifyFlags is a set of keyspace notification classes, in Redis notify-keyspace-events format
+type NotifyFlags uint32
+
+const (
+	NotifyKeyspace NotifyFlags = 1 << iota // K: publish into __keyspace@0__:<key> channels
+	NotifyKeyevent                         // E: publish into __keyevent@0__:<event> channels
+	NotifyGeneric                          // g: generic commands like DEL, EXPIRE, PERSIST
+	NotifyString                           // $: string commands
+	NotifyList                             // l: list commands
+	NotifyHash                             // h: hash commands
+	NotifyZset                             // z: sorted set commands
+	NotifyExpired                          // x: expired events, generated by expired items collector
+
+	NotifyAll = NotifyGeneric | NotifyString | NotifyList | NotifyHash | NotifyZset | NotifyExpired // A: alias for "g$lhzx"
+)
+
+var ErrInvalidNotifyFlags = errors.New("invalid keyspace notification flags")
+
+// String returns flags in notify-keyspace-events format
+func (f NotifyFlags) String() string {
+	var result string
+	if f&NotifyKeyspace != 0 {
+		result += "K"
+	}
+	if f&NotifyKeyevent != 0 {
+		result += "E"
+	}
+	if f&NotifyAll == NotifyAll {
+		return result + "A"
+	}
+
+	for _, class := range []struct {
+		flag NotifyFlags
+		name string
+	}{
+		{NotifyGeneric, "g"},
+		{NotifyString, "$"},
+		{NotifyList, "l"},
+		{NotifyHash, "h"},
+		{NotifyZset, "z"},
+		{NotifyExpired, "x"},
+	} {
+		if f&class.flag != 0 {
+			result += class.name
+		}
+	}
+
+	return result
+}
+
+// keyspaceEvent describes notification, generated by successful modifying command
+type keyspaceEvent struct {
+	class NotifyFlags
+	name  string
+	// if true, zero int response means that nothing changed and no event should be generated
+	zeroIsNoop bool
+}
+
+// keyspaceEvents maps modifying commands to generated events
+var keyspaceEvents = map[string]keyspaceEvent{
+	"SET":          {NotifyString, "set", false},
+	"SETEX":        {NotifyString, "set", false},
+	"CAS":          {NotifyString, "set", true},
+	"INCRBYFLOAT":  {NotifyString, "incrbyfloat", false},
+	"DEL":          {NotifyGeneric, "del", false},
+	"HSET":         {NotifyHash, "hset", false},
+	"HSETEX":       {NotifyHash, "hset", false},
+	"HDEL":         {NotifyHash, "hdel", true},
+	"HINCRBYFLOAT": {NotifyHash, "hincrbyfloat", false},
+	"LSET":         {NotifyList, "lset", false},
+	"LPUSH":        {NotifyList, "lpush", false},
+	"LPUSHEX":      {NotifyList, "lpush", false},
+	"LPUSHCAP":     {NotifyList, "lpush", false},
+	"LPUSHCAPEX":   {NotifyList, "lpush", false},
+	"LPOP":         {NotifyList, "lpop", false},
+	"EXPIRE":       {NotifyGeneric, "expire", true},
+	"PERSIST":      {NotifyGeneric, "persist", true},
+	"SETBIT":       {NotifyString, "setbit", false},
+	"BITFIELD":     {NotifyString, "setbit", false},
+	"SETRANGE":     {NotifyString, "setrange", false},
+	"RESTORE":      {NotifyGeneric, "restore", false},
+	"BITOP":        {NotifyString, "set", true},
+	"SORT":         {NotifyGeneric, "sortstore", true},
+	"ZADD":         {NotifyZset, "zadd", false},
+	"ZINCRBY":      {NotifyZset, "zincr", false},
+	"ZREM":         {NotifyZset, "zrem", true},
+}
+
+// ParseNotifyFlags parses Redis-like notify-keyspace-events string, e.g. "KEA" or "Kx"
+func ParseNotifyFlags(flags string) (NotifyFlags, error) {
+	var result NotifyFlags
+	for _, f := range flags {
+		switch f {
+		case 'K':
+			result |= NotifyKeyspace
+		case 'E':
+			result |= NotifyKeyevent
+		case 'g':
+			result |= NotifyGeneric
+		case '$':
+			result |= NotifyString
+		case 'l':
+			result |= NotifyList
+		case 'h':
+			result |= NotifyHash
+		case 'z':
+			result |= NotifyZset
+		case 'x':
+			result |= NotifyExpired
+		case 'A':
+			result |= NotifyAll
+		default:
+			return 0, ErrInvalidNotifyFlags
+		}
+	}
+
+	// at least one of K or E should be set to actually publish something
+	if result&(NotifyKeyspace|NotifyKeyevent) == 0 {
+		return 0, nil
+	}
+
+	return result, nil
+}
+
+// SetNotifyKeyspaceEvents enables keyspace notifications of provided classes. Empty string disables notifications.
+// Notifications are delivered via RESP pub/sub, so they are unavailable with HTTP API
+func (c *Controller) SetNotifyKeyspaceEvents(flags string) error {
+	notifyFlags, err := ParseNotifyFlags(flags)
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreUint32(&c.notifyFlags, uint32(notifyFlags))
+	return nil
+}
+
+func (c *Controller) getNotifyFlags() NotifyFlags {
+	if c.publisher == nil {
+		return 0
+	}
+
+	return NotifyFlags(atomic.LoadUint32(&c.notifyFlags))
+}
+
+// keysToNotify returns keys, affected by the request, that should be notified if request succeeds.
+// It should be invoked BEFORE the request processing
+func (c *Controller) keysToNotify(request *message.Request) []string {
+	event, ok := keyspaceEvents[request.Cmd]
+	if !ok || c.getNotifyFlags()&event.class == 0 {
+		return nil
+	}
+
+	keys := affectedKeys(request)
+	if request.Cmd != "DEL" {
+		return keys
+	}
+
+	// notify only about actually existing keys
+	var existingKeys []string
+	for _, key := range keys {
+		if c.store.core.Version(key) != 0 {
+			existingKeys = append(existingKeys, key)
+		}
+	}
+
+	return existingKeys
+}
+
+// affectedKeys returns keys, that could be changed by the modifying request
+func affectedKeys(request *message.Request) []string {
+	if len(request.Args) == 0 {
+		return nil
+	}
+
+	switch request.Cmd {
+	case "DEL":
+		keys := make([]string, len(request.Args))
+		for i, key := range request.Args {
+			keys[i] = string(key)
+		}
+		return keys
+	case "BITOP":
+		// destination key follows the operation
+		if len(request.Args) < 2 {
+			return nil
+		}
+		return []string{string(request.Args[1])}
+	case "BITFIELD":
+		// only SET and INCRBY operations change the key
+		for _, arg := range request.Args[1:] {
+			if op := strings.ToUpper(string(arg)); op == "SET" || op == "INCRBY" {
+				return []string{string(request.Args[0])}
+			}
+		}
+		return nil
+	case "SORT":
+		// only destination of STORE option is changed
+		if key, ok := storeOptionKey(request, 1); ok {
+			return []string{key}
+		}
+		return nil
+	default:
+		return []string{string(request.Args[0])}
+	}
+}
+
+// notifyRequest publishes events for keys, affected by the successfully processed request
+func (c *Controller) notifyRequest(request *message.Request, response message.Response, keys []string) {
+	if len(keys) == 0 || response.Status() != message.StatusOk {
+		return
+	}
+
+	event := keyspaceEvents[request.Cmd]
+	if r, ok := response.(*message.ResponseInt); ok && event.zeroIsNoop && r.Payload() == 0 {
+		return
+	}
+
+	for _, key := range keys {
+		c.notifyKeyspaceEvent(event.class, event.name, key)
+	}
+}
+
+// pendingNotification is a processed request, which notifications are postponed until transaction is finished
+type pendingNotification struct {
+	request  *message.Request
+	response message.Response
+	keys     []string
+}
+
+// notifyPending publishes postponed notifications.
+// It takes pointer to slice to be deferred before the slice is filled
+func (c *Controller) notifyPending(notifications *[]pendingNotification) {
+	for _, n := range *notifications {
+		c.notifyRequest(n.request, n.response, n.keys)
+	}
+}
+
+// notifyExpired publishes expired event for the key, removed by expired items collector
+func (c *Controller) notifyExpired(key string) {
+	c.notifyKeyspaceEvent(NotifyExpired, "expired", key)
+}
+
+func (c *Controller) notifyKeyspaceEvent(class NotifyFlags, event, key string) {
+	flags := c.getNotifyFlags()
+	if flags&class == 0 {
+		return
+	}
+
+	if flags&NotifyKeyspace != 0 {
+		c.publisher.Publish("__keyspace@0__:"+key, []byte(event))
+	}
+	if flags&NotifyKeyevent != 0 {
+		c.publisher.Publish("__keyevent@0__:"+event, []byte(key))
+	}
+}
@@ -0,0 +1,44 @@
+package controller_test
+
+import (
+	"github.com/mshaverdo/radish/controller"
+	"testing"
+)
+
+func TestParseNotifyFlags(t *testing.T) {
+	tests := []struct {
+		flags   string
+		want    controller.NotifyFlags
+		wantErr error
+	}{
+		{"", 0, nil},
+		{"A", 0, nil},
+		{"K$", controller.NotifyKeyspace | controller.NotifyString, nil},
+		{"Elh", controller.NotifyKeyevent | controller.NotifyList | controller.NotifyHash, nil},
+		{"KEA", controller.NotifyKeyspace | controller.NotifyKeyevent | controller.NotifyAll, nil},
+		{"Kgx", controller.NotifyKeyspace | controller.NotifyGeneric | controller.NotifyExpired, nil},
+		{"KZ", 0, controller.ErrInvalidNotifyFlags},
+	}
+
+	for _, tst := range tests {
+		got, err := controller.ParseNotifyFlags(tst.flags)
+		if err != tst.wantErr {
+			t.Errorf("ParseNotifyFlags(%q) err: %v, want: %v", tst.flags, err, tst.wantErr)
+		}
+		if got != tst.want {
+			t.Errorf("ParseNotifyFlags(%q): %b, want: %b", tst.flags, got, tst.want)
+		}
+	}
+}
+
+func TestNotifyFlags_String(t *testing.T) {
+	for _, flags := range []string{"", "K$", "Elh", "KEA", "Kgx"} {
+		parsed, err := controller.ParseNotifyFlags(flags)
+		if err != nil {
+			t.Fatalf("ParseNotifyFlags(%q): %s", flags, err)
+		}
+		if got := parsed.String(); got != flags {
+			t.Errorf("NotifyFlags(%q).String(): %q", flags, got)
+		}
+	}
+}
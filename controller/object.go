@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"errors"
+	"github.com/mshaverdo/radish/message"
+	"strings"
+)
+
+var ErrUnknownObjectCmd = errors.New("Unknown OBJECT subcommand")
+
+// handleObject processes OBJECT ENCODING|REFCOUNT|IDLETIME key requests
+func (c *Controller) handleObject(request *message.Request) message.Response {
+	if len(request.Args) != 2 {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+
+	key := string(request.Args[1])
+
+	switch strings.ToUpper(string(request.Args[0])) {
+	case "ENCODING":
+		encoding, err := c.store.core.ObjectEncoding(key)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload([]byte(encoding))
+	case "REFCOUNT":
+		count, err := c.store.core.ObjectRefcount(key)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(int64(count))
+	case "IDLETIME":
+		seconds, err := c.store.core.ObjectIdletime(key)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(int64(seconds))
+	default:
+		return getResponseInvalidArguments(request.Cmd, ErrUnknownObjectCmd)
+	}
+}
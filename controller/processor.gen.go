@@ -6,10 +6,8 @@
 package controller
 
 import (
-	"fmt"
+	"github.com/mshaverdo/radish/core"
 	"github.com/mshaverdo/radish/message"
-	"strconv"
-	"time"
 )
 
 type Processor struct {
@@ -26,7 +24,7 @@ func (p *Processor) Process(request *message.Request) message.Response {
 
 	case "KEYS":
 		if request.ArgumentsLen() != 1 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -39,7 +37,7 @@ func (p *Processor) Process(request *message.Request) message.Response {
 		return getResponseStringSlicePayload(stringsSliceToBytesSlise(result))
 	case "GET":
 		if request.ArgumentsLen() != 1 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -54,8 +52,8 @@ func (p *Processor) Process(request *message.Request) message.Response {
 
 		return getResponseStringPayload(result)
 	case "SET":
-		if request.ArgumentsLen() != 2 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		if request.ArgumentsLen() < 2 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -66,13 +64,48 @@ func (p *Processor) Process(request *message.Request) message.Response {
 		if err != nil {
 			return getResponseInvalidArguments(request.Cmd, err)
 		}
+		arg2, err := request.GetArgumentOptionalVariadicString(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
 
-		p.core.Set(arg0, arg1)
+		err = p.core.SetWithOptions(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
 
 		return getResponseStatusOkPayload()
+	case "CAS":
+		if request.ArgumentsLen() < 3 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentBytes(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentBytes(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg3, err := request.GetArgumentOptionalVariadicString(3)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.CompareAndSwap(arg0, arg1, arg2, arg3)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(int64(result))
 	case "SETEX":
 		if request.ArgumentsLen() != 3 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -87,11 +120,37 @@ func (p *Processor) Process(request *message.Request) message.Response {
 		if err != nil {
 			return getResponseInvalidArguments(request.Cmd, err)
 		}
+		if arg1 <= 0 {
+			return getResponseInvalidArguments(request.Cmd, core.ErrExpireTime)
+		}
 
 		p.core.SetEx(arg0, arg1, arg2)
 
 		return getResponseStatusOkPayload()
+	case "INCRBYFLOAT":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.IncrByFloat(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
 	case "DEL":
+		if request.ArgumentsLen() < 1 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
 
 		arg0, err := request.GetArgumentVariadicString(0)
 		if err != nil {
@@ -102,24 +161,47 @@ func (p *Processor) Process(request *message.Request) message.Response {
 
 		return getResponseIntPayload(result)
 	case "HSET":
-		if request.ArgumentsLen() != 3 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		if request.ArgumentsLen() < 3 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
 		if err != nil {
 			return getResponseInvalidArguments(request.Cmd, err)
 		}
-		arg1, err := request.GetArgumentString(1)
+		arg1, err := request.GetArgumentVariadicBytes(1)
 		if err != nil {
 			return getResponseInvalidArguments(request.Cmd, err)
 		}
-		arg2, err := request.GetArgumentBytes(2)
+
+		result, err := p.core.DSetMany(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "HSETEX":
+		if request.ArgumentsLen() < 4 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentVariadicBytes(2)
 		if err != nil {
 			return getResponseInvalidArguments(request.Cmd, err)
 		}
+		if arg1 <= 0 {
+			return getResponseInvalidArguments(request.Cmd, core.ErrExpireTime)
+		}
 
-		result, err := p.core.DSet(arg0, arg1, arg2)
+		result, err := p.core.DSetManyEx(arg0, arg1, arg2)
 		if err != nil {
 			return getResponseCommandError(request.Cmd, err)
 		}
@@ -127,7 +209,7 @@ func (p *Processor) Process(request *message.Request) message.Response {
 		return getResponseIntPayload(result)
 	case "HGET":
 		if request.ArgumentsLen() != 2 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -147,7 +229,7 @@ func (p *Processor) Process(request *message.Request) message.Response {
 		return getResponseStringPayload(result)
 	case "HKEYS":
 		if request.ArgumentsLen() != 1 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -163,7 +245,7 @@ func (p *Processor) Process(request *message.Request) message.Response {
 		return getResponseStringSlicePayload(stringsSliceToBytesSlise(result))
 	case "HGETALL":
 		if request.ArgumentsLen() != 1 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -176,8 +258,11 @@ func (p *Processor) Process(request *message.Request) message.Response {
 			return getResponseCommandError(request.Cmd, err)
 		}
 
-		return getResponseStringSlicePayload(result)
+		return getResponseStringMapPayload(result)
 	case "HDEL":
+		if request.ArgumentsLen() < 2 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
 
 		arg0, err := request.GetArgumentString(0)
 		if err != nil {
@@ -194,9 +279,33 @@ func (p *Processor) Process(request *message.Request) message.Response {
 		}
 
 		return getResponseIntPayload(result)
+	case "HINCRBYFLOAT":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentString(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.DIncrByFloat(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
 	case "LLEN":
 		if request.ArgumentsLen() != 1 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -212,7 +321,7 @@ func (p *Processor) Process(request *message.Request) message.Response {
 		return getResponseIntPayload(result)
 	case "LRANGE":
 		if request.ArgumentsLen() != 3 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -236,7 +345,7 @@ func (p *Processor) Process(request *message.Request) message.Response {
 		return getResponseStringSlicePayload(result)
 	case "LINDEX":
 		if request.ArgumentsLen() != 2 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -254,9 +363,36 @@ func (p *Processor) Process(request *message.Request) message.Response {
 		}
 
 		return getResponseStringPayload(result)
+	case "LPOS":
+		if request.ArgumentsLen() < 2 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentBytes(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentOptionalVariadicString(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.LPos(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		if hasCountOption(request, 2) {
+			return getResponseIntSlicePayload(intsToInt64Slice(result))
+		}
+		return getResponseIntPayload(int64(result[0]))
 	case "LSET":
 		if request.ArgumentsLen() != 3 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -279,6 +415,9 @@ func (p *Processor) Process(request *message.Request) message.Response {
 
 		return getResponseStatusOkPayload()
 	case "LPUSH":
+		if request.ArgumentsLen() < 2 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
 
 		arg0, err := request.GetArgumentString(0)
 		if err != nil {
@@ -294,10 +433,100 @@ func (p *Processor) Process(request *message.Request) message.Response {
 			return getResponseCommandError(request.Cmd, err)
 		}
 
+		return getResponseIntPayload(result)
+	case "LPUSHEX":
+		if request.ArgumentsLen() < 3 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentVariadicBytes(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		if arg1 <= 0 {
+			return getResponseInvalidArguments(request.Cmd, core.ErrExpireTime)
+		}
+
+		result, err := p.core.LPushEx(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "LPUSHCAP":
+		if request.ArgumentsLen() < 4 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentString(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg3, err := request.GetArgumentVariadicBytes(3)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.LPushCapped(arg0, arg1, arg2, arg3)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "LPUSHCAPEX":
+		if request.ArgumentsLen() < 5 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentInt(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg3, err := request.GetArgumentString(3)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg4, err := request.GetArgumentVariadicBytes(4)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		if arg1 <= 0 {
+			return getResponseInvalidArguments(request.Cmd, core.ErrExpireTime)
+		}
+
+		result, err := p.core.LPushCappedEx(arg0, arg1, arg2, arg3, arg4)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
 		return getResponseIntPayload(result)
 	case "LPOP":
 		if request.ArgumentsLen() != 1 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -311,9 +540,32 @@ func (p *Processor) Process(request *message.Request) message.Response {
 		}
 
 		return getResponseStringPayload(result)
+	case "SORT":
+		if request.ArgumentsLen() < 1 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentOptionalVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.Sort(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		if _, ok := storeOptionKey(request, 1); ok {
+			return getResponseIntPayload(int64(len(result)))
+		}
+		return getResponseStringSlicePayload(result)
 	case "TTL":
 		if request.ArgumentsLen() != 1 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -326,10 +578,42 @@ func (p *Processor) Process(request *message.Request) message.Response {
 			return getResponseCommandError(request.Cmd, err)
 		}
 
+		return getResponseIntPayload(int64(result))
+	case "EXPIRETIME":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ExpireTime(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "PEXPIRETIME":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.PExpireTime(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
 		return getResponseIntPayload(result)
 	case "EXPIRE":
 		if request.ArgumentsLen() != 2 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -343,10 +627,10 @@ func (p *Processor) Process(request *message.Request) message.Response {
 
 		result := p.core.Expire(arg0, arg1)
 
-		return getResponseIntPayload(result)
-	case "PERSIST":
+		return getResponseIntPayload(int64(result))
+	case "TYPE":
 		if request.ArgumentsLen() != 1 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
 		arg0, err := request.GetArgumentString(0)
@@ -354,44 +638,495 @@ func (p *Processor) Process(request *message.Request) message.Response {
 			return getResponseInvalidArguments(request.Cmd, err)
 		}
 
-		result := p.core.Persist(arg0)
+		result := p.core.Type(arg0)
 
-		return getResponseIntPayload(result)
+		return getResponseStatusPayload(result)
+	case "PERSIST":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
 
-	default:
-		return message.NewResponseStatus(message.StatusInvalidCommand, "unknown command: "+request.Cmd)
-	}
-}
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
 
-// IsModifyingRequest returns true, if request modifies a storage
-func (p *Processor) IsModifyingRequest(request *message.Request) bool {
-	switch request.Cmd {
-	case "SET", "SETEX", "DEL", "HSET", "HDEL", "LSET", "LPUSH", "LPOP", "EXPIRE", "PERSIST":
-		return true
-	default:
-		return false
-	}
-}
+		result := p.core.Persist(arg0)
 
-// FixWalRequestTtl Correct TTL value for TTL-related requests due to ttl is time.Now() -related value
-func (p *Processor) FixRequestTtl(request *message.Request) error {
-	switch request.Cmd {
-	case "SETEX":
-		seconds, err := request.GetArgumentInt(1)
-		if err != nil {
-			return err
+		return getResponseIntPayload(int64(result))
+	case "GETRANGE":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
 		}
 
-		seconds -= int(time.Now().Unix() - request.Timestamp)
-		request.Args[1] = []byte(strconv.Itoa(seconds))
-	case "EXPIRE":
-		seconds, err := request.GetArgumentInt(1)
+		arg0, err := request.GetArgumentString(0)
 		if err != nil {
-			return err
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentInt(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.GetRange(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
+	case "SETRANGE":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentBytes(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SetRange(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "SETBIT":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentInt(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SetBit(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(int64(result))
+	case "GETBIT":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.GetBit(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(int64(result))
+	case "BITCOUNT":
+		if request.ArgumentsLen() < 1 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.BitCount(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "BITFIELD":
+		if request.ArgumentsLen() < 1 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentOptionalVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.BitField(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseNullableIntSlicePayload(result)
+	case "BITOP":
+		if request.ArgumentsLen() < 3 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentVariadicString(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.BitOp(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "DUMP":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.Dump(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
+	case "RESTORE":
+		if request.ArgumentsLen() < 3 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentBytes(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg3, err := request.GetArgumentOptionalVariadicString(3)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		err = p.core.Restore(arg0, arg1, arg2, arg3)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStatusOkPayload()
+	case "ZADD":
+		if request.ArgumentsLen() < 3 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZAdd(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "ZSCORE":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZScore(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
+	case "ZCARD":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZCard(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "ZRANK":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZRank(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(int64(result))
+	case "ZRANGE":
+		if request.ArgumentsLen() < 3 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentInt(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg3, err := request.GetArgumentOptionalVariadicString(3)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZRange(arg0, arg1, arg2, arg3)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringSlicePayload(result)
+	case "ZINCRBY":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentString(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZIncrBy(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
+	case "ZRANGEBYSCORE":
+		if request.ArgumentsLen() < 3 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentString(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg3, err := request.GetArgumentOptionalVariadicString(3)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZRangeByScore(arg0, arg1, arg2, arg3)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringSlicePayload(result)
+	case "ZREM":
+		if request.ArgumentsLen() < 2 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZRem(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "META":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.Meta(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringMapPayload(result)
+
+	default:
+		return message.NewResponseStatus(message.StatusInvalidCommand, "unknown command: "+request.Cmd)
+	}
+}
+
+// coreCommands describes commands, processed by Processor, for COMMAND introspection
+var coreCommands = []commandInfo{
+	{name: "KEYS", arity: 2, isModifying: false, firstKey: 0, lastKey: 0, keyStep: 0, summary: "Returns all keys matching glob pattern", complexity: "O(N) where N is the number of keys in the database", isDangerous: true},
+	{name: "GET", arity: 2, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Get the value of key", complexity: "O(1)"},
+	{name: "SET", arity: -3, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Set key to hold the string value, like Set, but accepts options", complexity: "O(1)"},
+	{name: "CAS", arity: -4, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Sets key to hold the string value, only if the current value equals to expected", complexity: "O(1)"},
+	{name: "SETEX", arity: 4, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Set key to hold the string value and set key to timeout after a given number of seconds", complexity: "O(1)"},
+	{name: "INCRBYFLOAT", arity: 3, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Increments the floating point number stored at key by the specified increment", complexity: "O(1)"},
+	{name: "DEL", arity: -2, isModifying: true, firstKey: 1, lastKey: -1, keyStep: 1, summary: "Removes the specified keys, ignoring not existing and returns count of actually removed values", complexity: "O(N) where N is the number of keys"},
+	{name: "HSET", arity: -4, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Sets fields in the hash stored at key to their values atomically", complexity: "O(N) where N is the number of field/value pairs"},
+	{name: "HSETEX", arity: -5, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Sets fields in the hash stored at key to their values and sets key to timeout after a given number of seconds", complexity: "O(N) where N is the number of field/value pairs"},
+	{name: "HGET", arity: 3, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the value associated with field in the dict stored at key", complexity: "O(1)"},
+	{name: "HKEYS", arity: 2, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns all field names in the dict stored at key", complexity: "O(N) where N is the size of the hash"},
+	{name: "HGETALL", arity: 2, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns all fields and values of the hash stored at key", complexity: "O(N) where N is the size of the hash"},
+	{name: "HDEL", arity: -3, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Removes the specified fields from the hash stored at key", complexity: "O(N) where N is the number of fields"},
+	{name: "HINCRBYFLOAT", arity: 4, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Increments the floating point number stored at field in the dict stored at key by the specified increment", complexity: "O(1)"},
+	{name: "LLEN", arity: 2, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the length of the list stored at key", complexity: "O(1)"},
+	{name: "LRANGE", arity: 4, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the specified elements of the list stored at key", complexity: "O(N) where N is the number of returned elements"},
+	{name: "LINDEX", arity: 3, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the element at index index in the list stored at key", complexity: "O(1)"},
+	{name: "LPOS", arity: -3, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the index of the first element equal to element in the list stored at key", complexity: "O(N) where N is the length of the list"},
+	{name: "LSET", arity: 4, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Sets the list element at index to value", complexity: "O(1)"},
+	{name: "LPUSH", arity: -3, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Insert all the specified values at the head of the list stored at key", complexity: "O(N) where N is the number of pushed values"},
+	{name: "LPUSHEX", arity: -4, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Inserts all the specified values at the head of the list stored at key and sets key to timeout after a given number of seconds", complexity: "O(N) where N is the number of pushed values"},
+	{name: "LPUSHCAP", arity: -5, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Inserts all the specified values at the head of the list stored at key, keeping length of the list within maxLen", complexity: "O(N) where N is the number of pushed values, O(M) with M max length when the list is trimmed"},
+	{name: "LPUSHCAPEX", arity: -6, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Inserts all the specified values at the head of the list stored at key, keeping length of the list within maxLen, and sets key to timeout after a given number of seconds", complexity: "O(N) where N is the number of pushed values, O(M) with M max length when the list is trimmed"},
+	{name: "LPOP", arity: 2, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Removes and returns the first element of the list stored at key", complexity: "O(1)"},
+	{name: "SORT", arity: -2, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the elements of the list stored at key, sorted as numbers in ascending order", complexity: "O(N+M*log(M)) where N is the length of the list and M is the number of returned elements"},
+	{name: "TTL", arity: 2, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the remaining time to live of a key that has a timeout", complexity: "O(1)"},
+	{name: "EXPIRETIME", arity: 2, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the absolute Unix time in seconds, at which the key will expire", complexity: "O(1)"},
+	{name: "PEXPIRETIME", arity: 2, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the absolute Unix time in milliseconds, at which the key will expire", complexity: "O(1)"},
+	{name: "EXPIRE", arity: 3, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Sets a timeout on key", complexity: "O(1)"},
+	{name: "TYPE", arity: 2, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the string representation of the type of the value stored at key", complexity: "O(1)"},
+	{name: "PERSIST", arity: 2, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Removes the existing timeout on key", complexity: "O(1)"},
+	{name: "GETRANGE", arity: 4, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the substring of the string value stored at key, determined by the offsets start and end (both are inclusive)", complexity: "O(N) where N is the length of the returned string"},
+	{name: "SETRANGE", arity: 4, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Overwrites part of the string stored at key, starting at the specified offset, for the entire length of value", complexity: "O(1), not counting the time taken to copy the new string in place"},
+	{name: "SETBIT", arity: 4, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Sets or clears the bit at offset in the string value stored at key and returns the original bit value", complexity: "O(1)"},
+	{name: "GETBIT", arity: 3, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the bit value at offset in the string value stored at key", complexity: "O(1)"},
+	{name: "BITCOUNT", arity: -2, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Counts the number of set bits in the string value stored at key", complexity: "O(N) where N is the length of the counted range"},
+	{name: "BITFIELD", arity: -2, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Performs GET, SET and INCRBY operations over integers of arbitrary width, stored in the string at key", complexity: "O(1) for each subcommand"},
+	{name: "BITOP", arity: -4, isModifying: true, firstKey: 2, lastKey: -1, keyStep: 1, summary: "Performs a bitwise operation AND, OR, XOR or NOT between strings stored at keys and stores the result in destKey", complexity: "O(N) where N is the length of the longest string"},
+	{name: "DUMP", arity: 2, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Serializes the value stored at key in a Radish-specific format, that could be restored by RESTORE", complexity: "O(N) where N is the size of the value"},
+	{name: "RESTORE", arity: -4, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Creates a key associated with a value, obtained by deserializing the serialized value, produced by DUMP", complexity: "O(N) where N is the size of the value"},
+	{name: "ZADD", arity: -4, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Adds all the specified members with the specified scores to the sorted set stored at key", complexity: "O(M*N) where M is the number of added members and N is the size of the sorted set"},
+	{name: "ZSCORE", arity: 3, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the score of member in the sorted set at key", complexity: "O(1)"},
+	{name: "ZCARD", arity: 2, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the number of elements of the sorted set stored at key", complexity: "O(1)"},
+	{name: "ZRANK", arity: 3, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the zero-based rank of member in the sorted set stored at key, with the scores ordered from low to high", complexity: "O(log(N)) where N is the size of the sorted set"},
+	{name: "ZRANGE", arity: -4, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns the specified range of elements in the sorted set stored at key, ordered from the lowest to the highest score", complexity: "O(M) where M is the number of returned members"},
+	{name: "ZINCRBY", arity: 4, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Increments the score of member in the sorted set stored at key by increment", complexity: "O(N) where N is the size of the sorted set"},
+	{name: "ZRANGEBYSCORE", arity: -4, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns all the elements in the sorted set at key with a score between min and max inclusive, ordered from the lowest to the highest score", complexity: "O(log(N)+M) where N is the size of the sorted set and M is the number of returned members"},
+	{name: "ZREM", arity: -3, isModifying: true, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Removes the specified members from the sorted set stored at key", complexity: "O(M*N) where M is the number of removed members and N is the size of the sorted set"},
+	{name: "META", arity: 2, isModifying: false, firstKey: 1, lastKey: 1, keyStep: 1, summary: "Returns metadata of the value stored at key", complexity: "O(1)"},
+}
+
+// IsModifyingRequest returns true, if request modifies a storage
+func (p *Processor) IsModifyingRequest(request *message.Request) bool {
+	switch request.Cmd {
+	case "SET", "CAS", "SETEX", "INCRBYFLOAT", "DEL", "HSET", "HSETEX", "HDEL", "HINCRBYFLOAT", "LSET", "LPUSH", "LPUSHEX", "LPUSHCAP", "LPUSHCAPEX", "LPOP", "EXPIRE", "PERSIST", "SETRANGE", "SETBIT", "BITFIELD", "BITOP", "RESTORE", "ZADD", "ZINCRBY", "ZREM":
+		return true
+	case "SORT":
+		// modifies a storage only with STORE option
+		_, ok := storeOptionKey(request, 1)
+		return ok
+	default:
+		return false
+	}
+}
+
+// FixRequestTtl replaces relative TTL options of the request from WAL with absolute ones, counted from the request timestamp.
+// Relative TTL arguments are left as is: they are counted from the moment of the request by the core on replay
+func (p *Processor) FixRequestTtl(request *message.Request) error {
+	switch request.Cmd {
+	case "SET":
+		if err := fixRequestTtlOptions(request, 2); err != nil {
+			return err
 		}
-
-		seconds -= int(time.Now().Unix() - request.Timestamp)
-		request.Args[1] = []byte(strconv.Itoa(seconds))
 	default:
 		//do nothing. Just a placeholder to save correct syntax w/o ttl-related commands
 	}
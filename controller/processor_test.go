@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/mshaverdo/radish/controller"
 	"github.com/mshaverdo/radish/message"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -21,7 +23,7 @@ func TestProcessor_FixRequestTtl(t *testing.T) {
 				Cmd:       "EXPIRE",
 				Args:      [][]byte{[]byte("KEY"), []byte("15")},
 			},
-			[]string{"KEY", "10"},
+			[]string{"KEY", "15"},
 		},
 		{
 			&message.Request{
@@ -29,7 +31,79 @@ func TestProcessor_FixRequestTtl(t *testing.T) {
 				Cmd:       "SETEX",
 				Args:      [][]byte{[]byte("KEY"), []byte("15"), []byte("DATA")},
 			},
-			[]string{"KEY", "10", "DATA"},
+			[]string{"KEY", "15", "DATA"},
+		},
+		{
+			&message.Request{
+				Timestamp: nowMinus5.Unix(),
+				Cmd:       "LPUSHEX",
+				Args:      [][]byte{[]byte("KEY"), []byte("15"), []byte("A"), []byte("B")},
+			},
+			[]string{"KEY", "15", "A", "B"},
+		},
+		{
+			&message.Request{
+				Timestamp: nowMinus5.Unix(),
+				Cmd:       "HSETEX",
+				Args:      [][]byte{[]byte("KEY"), []byte("15"), []byte("FIELD"), []byte("DATA")},
+			},
+			[]string{"KEY", "15", "FIELD", "DATA"},
+		},
+		{
+			&message.Request{
+				Timestamp: nowMinus5.Unix(),
+				Cmd:       "RESTORE",
+				Args:      [][]byte{[]byte("KEY"), []byte("15000"), []byte("DATA")},
+			},
+			[]string{"KEY", "15000", "DATA"},
+		},
+		{
+			&message.Request{
+				Timestamp: nowMinus5.Unix(),
+				Cmd:       "RESTORE",
+				Args:      [][]byte{[]byte("KEY"), []byte("3000"), []byte("DATA")},
+			},
+			[]string{"KEY", "3000", "DATA"},
+		},
+		{
+			&message.Request{
+				Timestamp: nowMinus5.Unix(),
+				Cmd:       "RESTORE",
+				Args:      [][]byte{[]byte("KEY"), []byte("0"), []byte("DATA"), []byte("REPLACE")},
+			},
+			[]string{"KEY", "0", "DATA", "REPLACE"},
+		},
+		{
+			&message.Request{
+				Timestamp: nowMinus5.Unix(),
+				Cmd:       "SET",
+				Args:      [][]byte{[]byte("KEY"), []byte("DATA"), []byte("ex"), []byte("15"), []byte("NX")},
+			},
+			[]string{"KEY", "DATA", "PXAT", strconv.FormatInt((nowMinus5.Unix()+15)*1000, 10)},
+		},
+		{
+			&message.Request{
+				Timestamp: nowMinus5.Unix(),
+				Cmd:       "SET",
+				Args:      [][]byte{[]byte("KEY"), []byte("DATA"), []byte("XX"), []byte("PX"), []byte("1500")},
+			},
+			[]string{"KEY", "DATA", "PXAT", strconv.FormatInt(nowMinus5.Unix()*1000+1500, 10)},
+		},
+		{
+			&message.Request{
+				Timestamp: nowMinus5.Unix(),
+				Cmd:       "SET",
+				Args:      [][]byte{[]byte("KEY"), []byte("DATA"), []byte("EXAT"), []byte("15"), []byte("KEEPTTL")},
+			},
+			[]string{"KEY", "DATA", "EXAT", "15", "KEEPTTL"},
+		},
+		{
+			&message.Request{
+				Timestamp: nowMinus5.Unix(),
+				Cmd:       "SET",
+				Args:      [][]byte{[]byte("KEY"), []byte("DATA")},
+			},
+			[]string{"KEY", "DATA"},
 		},
 		{
 			&message.Request{
@@ -52,3 +126,78 @@ func TestProcessor_FixRequestTtl(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessor_ProcessSetExInvalidTtl(t *testing.T) {
+	for _, ttl := range []string{"0", "-1"} {
+		request := message.NewRequest("SETEX", [][]byte{[]byte("KEY"), []byte(ttl), []byte("DATA")})
+
+		// core must not be invoked with invalid TTL
+		p := controller.NewProcessor(nil)
+		response := p.Process(request)
+
+		if response.Status() != message.StatusInvalidArguments {
+			t.Errorf("Process(SETEX KEY %s): got status %s, want %s", ttl, response.Status(), message.StatusInvalidArguments)
+		}
+		if got, want := string(response.Bytes()[0]), "invalid expire time in 'setex' command"; got != want {
+			t.Errorf("Process(SETEX KEY %s): got message %q, want %q", ttl, got, want)
+		}
+	}
+}
+
+func TestProcessor_ProcessWrongArgumentsCount(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		args []string
+	}{
+		{"DEL", nil},
+		{"HDEL", []string{"KEY"}},
+		{"LPUSH", []string{"KEY"}},
+		{"BITCOUNT", nil},
+		{"BITOP", []string{"AND", "DEST"}},
+		{"ZADD", []string{"KEY", "1"}},
+		{"RESTORE", []string{"KEY", "0"}},
+	}
+
+	for _, tst := range tests {
+		request := message.NewRequest(tst.cmd, nil)
+		for _, v := range tst.args {
+			request.Args = append(request.Args, []byte(v))
+		}
+
+		// core must not be invoked with wrong arguments count
+		p := controller.NewProcessor(nil)
+		response := p.Process(request)
+
+		if response.Status() != message.StatusInvalidArguments {
+			t.Errorf("Process(%s %q): got status %s, want %s", tst.cmd, tst.args, response.Status(), message.StatusInvalidArguments)
+		}
+		want := fmt.Sprintf("wrong number of arguments for '%s' command", strings.ToLower(tst.cmd))
+		if got := string(response.Bytes()[0]); got != want {
+			t.Errorf("Process(%s %q): got message %q, want %q", tst.cmd, tst.args, got, want)
+		}
+	}
+}
+
+func TestProcessor_IsModifyingRequestStoreOption(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"KEY"}, false},
+		{[]string{"KEY", "ALPHA", "DESC", "LIMIT", "0", "10"}, false},
+		{[]string{"KEY", "STORE"}, false},
+		{[]string{"KEY", "ALPHA", "store", "DEST"}, true},
+	}
+
+	p := controller.NewProcessor(nil)
+	for _, tst := range tests {
+		request := message.NewRequest("SORT", nil)
+		for _, v := range tst.args {
+			request.Args = append(request.Args, []byte(v))
+		}
+
+		if got := p.IsModifyingRequest(request); got != tst.want {
+			t.Errorf("IsModifyingRequest(SORT %q): %t != %t", tst.args, got, tst.want)
+		}
+	}
+}
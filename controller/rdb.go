@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/mshaverdo/radish/core"
+	"github.com/mshaverdo/radish/log"
+	"github.com/mshaverdo/radish/message"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// rdbFileName is a name of RDB file, written by EXPORTRDB into the data dir. It's the default dbfilename of Redis
+const rdbFileName = "dump.rdb"
+
+var ErrRdbNotPersistent = errors.New("can't export RDB: persistence disabled")
+
+// ExportRDB writes all not expired keys into w in Redis RDB format, so data could be loaded into Redis.
+// Transactions are blocked while exporting to be written atomically
+func (c *Controller) ExportRDB(w io.Writer) error {
+	c.transactionMutex.RLock()
+	defer c.transactionMutex.RUnlock()
+
+	return c.store.core.ExportRDB(w)
+}
+
+// handleExportRdb processes EXPORTRDB request: writes dump.rdb into the data dir
+func (c *Controller) handleExportRdb(request *message.Request) message.Response {
+	if len(request.Args) != 0 {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+	if !c.store.isPersistent {
+		return getResponseCommandError(request.Cmd, ErrRdbNotPersistent)
+	}
+
+	if err := c.exportRdbFile(path.Join(c.store.keeper.dataDir, rdbFileName)); err != nil {
+		return getResponseCommandError(request.Cmd, err)
+	}
+
+	return getResponseStatusOkPayload()
+}
+
+// exportRdbFile writes RDB into temporary file, and then atomically renames it to filename
+func (c *Controller) exportRdbFile(filename string) error {
+	file, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	err = c.ExportRDB(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), filename)
+}
+
+// ImportRDB loads keys from Redis RDB into the store. Every key is restored by RESTORE request,
+// so imported keys are persisted by WAL like any other modification. Keys of unsupported types are logged and skipped
+func (s *Store) ImportRDB(r io.Reader) (imported int, err error) {
+	restore := func(key string, item *core.Item) error {
+		ttl := 0
+		if item.HasTtl() {
+			ttl = int(item.ExpireAt().Sub(time.Now()) / time.Millisecond)
+			if ttl <= 0 {
+				// expired while reading
+				return nil
+			}
+		}
+
+		dump, err := item.Dump()
+		if err != nil {
+			return err
+		}
+
+		request := message.NewRequest("RESTORE", [][]byte{[]byte(key), []byte(strconv.Itoa(ttl)), dump})
+		if response := s.Process(request); response.Status() != message.StatusOk {
+			return fmt.Errorf("can't import key %q: %s", key, response)
+		}
+
+		imported++
+		return nil
+	}
+	skip := func(key string, reason string) {
+		log.Warningf("RDB import: key %q skipped, %s", key, reason)
+	}
+
+	err = core.ReadRDB(bufio.NewReader(r), restore, skip)
+	return imported, err
+}
+
+// importRdbFile imports RDB file into the store, if the store is empty. So the file is imported only on the first start,
+// and later restarts with the same options just restore persisted data
+func (c *Controller) importRdbFile(filename string) error {
+	if len(c.store.core.Keys("*")) != 0 {
+		log.Warningf("RDB import: storage isn't empty, %s isn't imported", filename)
+		return nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	imported, err := c.store.ImportRDB(file)
+	if err != nil {
+		return fmt.Errorf("can't import %s: %s", filename, err)
+	}
+
+	log.Noticef("RDB import: %d keys imported from %s", imported, filename)
+	return nil
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"github.com/OneOfOne/xxhash"
+	"github.com/mshaverdo/radish/message"
+	"sync"
+)
+
+// replayBatchSize is a count of requests, sent to a replay worker at once, to reduce channel overhead
+const replayBatchSize = 256
+
+// walReplayer applies WAL requests to the storage of the keeper by several workers.
+// Requests, affecting a single key, are partitioned between workers by the key, so requests to the same key
+// are applied in the WAL order. Other requests, like transactions or BITOP, are applied by the caller
+// after all previous requests are applied and before any next one is started
+type walReplayer struct {
+	keeper  *Keeper
+	workers []chan []*message.Request
+	// batches are requests, collected for workers, but not sent yet
+	batches [][]*message.Request
+	// dirtyKeys are keys, changed by every worker, merged into keeper dirtyKeys on close
+	dirtyKeys []map[string]struct{}
+
+	// pending is a count of sent, but not applied batches
+	pending sync.WaitGroup
+	// workersWg waits for exit of workers on close
+	workersWg sync.WaitGroup
+
+	errMutex sync.Mutex
+	err      error
+}
+
+// newWalReplayer starts count workers. With less than two workers, all requests are applied by the caller
+func newWalReplayer(k *Keeper, count int) *walReplayer {
+	r := &walReplayer{keeper: k}
+	if count < 2 {
+		return r
+	}
+
+	r.workers = make([]chan []*message.Request, count)
+	r.batches = make([][]*message.Request, count)
+	r.dirtyKeys = make([]map[string]struct{}, count)
+	for i := range r.workers {
+		r.workers[i] = make(chan []*message.Request, 1)
+		if k.dirtyKeys != nil {
+			r.dirtyKeys[i] = make(map[string]struct{})
+		}
+
+		r.workersWg.Add(1)
+		go r.runWorker(r.workers[i], r.dirtyKeys[i])
+	}
+
+	return r
+}
+
+// runWorker applies batches of requests until the channel is closed. After the first error, requests are skipped
+func (r *walReplayer) runWorker(batches chan []*message.Request, dirtyKeys map[string]struct{}) {
+	defer r.workersWg.Done()
+
+	for batch := range batches {
+		for _, req := range batch {
+			if r.getErr() != nil {
+				break
+			}
+
+			if err := r.keeper.replayRequest(req, dirtyKeys); err != nil {
+				r.setErr(err)
+			}
+		}
+		r.pending.Done()
+	}
+}
+
+// replay applies the request or schedules it to a worker.
+// Returned error could be caused by any previously scheduled request
+func (r *walReplayer) replay(req *message.Request) error {
+	key, ok := replayKey(req)
+	if len(r.workers) == 0 || !ok {
+		if err := r.wait(); err != nil {
+			return err
+		}
+		return r.keeper.replayRequest(req, r.keeper.dirtyKeys)
+	}
+
+	i := int(xxhash.ChecksumString64(key) % uint64(len(r.workers)))
+	r.batches[i] = append(r.batches[i], req)
+	if len(r.batches[i]) == replayBatchSize {
+		r.send(i)
+	}
+
+	return r.getErr()
+}
+
+// send passes collected batch to the worker i
+func (r *walReplayer) send(i int) {
+	r.pending.Add(1)
+	r.workers[i] <- r.batches[i]
+	r.batches[i] = make([]*message.Request, 0, replayBatchSize)
+}
+
+// wait returns after all scheduled requests are applied
+func (r *walReplayer) wait() error {
+	for i, batch := range r.batches {
+		if len(batch) > 0 {
+			r.send(i)
+		}
+	}
+	r.pending.Wait()
+
+	return r.getErr()
+}
+
+// close applies all scheduled requests, stops workers and merges keys, changed by them, into keeper dirtyKeys.
+// Next calls are no-op
+func (r *walReplayer) close() error {
+	err := r.wait()
+
+	for _, worker := range r.workers {
+		close(worker)
+	}
+	r.workersWg.Wait()
+
+	for _, keys := range r.dirtyKeys {
+		for key := range keys {
+			r.keeper.dirtyKeys[key] = struct{}{}
+		}
+	}
+	r.workers, r.batches, r.dirtyKeys = nil, nil, nil
+
+	return err
+}
+
+func (r *walReplayer) getErr() error {
+	r.errMutex.Lock()
+	defer r.errMutex.Unlock()
+
+	return r.err
+}
+
+// setErr remembers the first error of workers
+func (r *walReplayer) setErr(err error) {
+	r.errMutex.Lock()
+	defer r.errMutex.Unlock()
+
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// replayKey returns the key, if the request reads and changes this key only
+func replayKey(req *message.Request) (key string, ok bool) {
+	// transactions and commands without keys have no key positions
+	for _, k := range commandTable[req.Cmd].keys(req.Args) {
+		if ok && k != key {
+			return "", false
+		}
+		key, ok = k, true
+	}
+
+	// destination of STORE option isn't described by key positions
+	for _, k := range affectedKeys(req) {
+		if k != key {
+			return "", false
+		}
+	}
+
+	return key, ok
+}
@@ -1,26 +1,69 @@
 package controller
 
 import (
+	"fmt"
 	"github.com/mshaverdo/radish/core"
 	"github.com/mshaverdo/radish/log"
 	"github.com/mshaverdo/radish/message"
+	"strings"
 )
 
+// getResponseInvalidArguments returns error of invalid arguments of cmd, without the command name, like Redis does.
+// Subcommands are passed as "CONFIG|GET"
 func getResponseInvalidArguments(cmd string, err error) message.Response {
 	return message.NewResponseStatus(
 		message.StatusInvalidArguments,
-		cmd+": "+err.Error(),
+		errorPayload(cmd, err),
 	)
 }
 
+// errorPayload returns text of the error. Errors, that Redis replies with the command name, like
+// "wrong number of arguments for 'get' command", are replied in exact Redis format, because clients match the text
+func errorPayload(cmd string, err error) string {
+	switch err {
+	case ErrWrongArgumentsCount:
+		return fmt.Sprintf("wrong number of arguments for '%s' command", strings.ToLower(cmd))
+	case core.ErrExpireTime:
+		return fmt.Sprintf("invalid expire time in '%s' command", strings.ToLower(cmd))
+	default:
+		return err.Error()
+	}
+}
+
 func getResponseCommandError(cmd string, err error) message.Response {
 	statusMap := map[error]message.Status{
 		//nil: message.StatusOk,
-		core.ErrInvalidIndex: message.StatusInvalidArguments,
-		core.ErrWrongType:    message.StatusTypeMismatch,
-		core.ErrNotFound:     message.StatusNotFound,
-		core.ErrNoSuchKey:    message.StatusInvalidArguments,
-		ErrServerShutdown:    message.StatusError,
+		core.ErrInvalidIndex:  message.StatusInvalidArguments,
+		core.ErrWrongType:     message.StatusTypeMismatch,
+		core.ErrNotFound:      message.StatusNotFound,
+		core.ErrNoSuchKey:     message.StatusInvalidArguments,
+		core.ErrSyntax:        message.StatusInvalidArguments,
+		core.ErrBitOffset:     message.StatusInvalidArguments,
+		core.ErrBitValue:      message.StatusInvalidArguments,
+		core.ErrBitOpNot:      message.StatusInvalidArguments,
+		core.ErrBitFieldType:  message.StatusInvalidArguments,
+		core.ErrOverflowType:  message.StatusInvalidArguments,
+		core.ErrOffsetRange:   message.StatusInvalidArguments,
+		core.ErrTooLong:       message.StatusInvalidArguments,
+		core.ErrBadDump:       message.StatusInvalidArguments,
+		core.ErrBusyKey:       message.StatusBusyKey,
+		core.ErrNotFloat:      message.StatusInvalidArguments,
+		core.ErrMinMaxFloat:   message.StatusInvalidArguments,
+		core.ErrScoreNaN:      message.StatusInvalidArguments,
+		core.ErrIncrNaN:       message.StatusInvalidArguments,
+		core.ErrHashNotFloat:  message.StatusInvalidArguments,
+		core.ErrNotInt:        message.StatusInvalidArguments,
+		core.ErrExpireTime:    message.StatusInvalidArguments,
+		core.ErrSortNotFloat:  message.StatusInvalidArguments,
+		core.ErrRankZero:      message.StatusInvalidArguments,
+		core.ErrNegCount:      message.StatusInvalidArguments,
+		core.ErrListFull:      message.StatusInvalidArguments,
+		ErrServerShutdown:     message.StatusError,
+		ErrTransactionAborted: message.StatusNotFound,
+		ErrInvalidWatchedKeys: message.StatusInvalidArguments,
+		ErrNoScript:           message.StatusNoScript,
+		ErrReadOnly:           message.StatusReadOnly,
+		ErrPersistence:        message.StatusMisconf,
 	}
 
 	status, ok := statusMap[err]
@@ -31,7 +74,7 @@ func getResponseCommandError(cmd string, err error) message.Response {
 
 	return message.NewResponseStatus(
 		status,
-		err.Error(),
+		errorPayload(cmd, err),
 	)
 }
 
@@ -42,7 +85,7 @@ func getResponseStringPayload(payload []byte) message.Response {
 	)
 }
 
-func getResponseIntPayload(value int) message.Response {
+func getResponseIntPayload(value int64) message.Response {
 	return message.NewResponseInt(
 		message.StatusOk,
 		value,
@@ -56,6 +99,51 @@ func getResponseStringSlicePayload(payloads [][]byte) message.Response {
 	)
 }
 
+func getResponseIntSlicePayload(payloads []int64) message.Response {
+	return message.NewResponseIntSlice(
+		message.StatusOk,
+		payloads,
+	)
+}
+
+func getResponseNullableIntSlicePayload(payloads []*int64) message.Response {
+	return message.NewResponseNullableIntSlice(
+		message.StatusOk,
+		payloads,
+	)
+}
+
+// getResponseNullableStringSlicePayload returns slice response, where nil elements are nulls, not empty strings
+func getResponseNullableStringSlicePayload(payloads [][]byte) message.Response {
+	return message.NewResponseNullableStringSlice(
+		message.StatusOk,
+		payloads,
+	)
+}
+
+func getResponseArrayPayload(payloads []message.Response) message.Response {
+	return message.NewResponseArray(
+		message.StatusOk,
+		payloads,
+	)
+}
+
+// getResponseStatusPayload returns successful status reply with non-OK payload, e.g. TYPE result
+func getResponseStatusPayload(payload string) message.Response {
+	return message.NewResponseStatus(
+		message.StatusOk,
+		payload,
+	)
+}
+
+// getResponseStringMapPayload returns map reply, represented as flat slice of key/value pairs
+func getResponseStringMapPayload(payloads [][]byte) message.Response {
+	return message.NewResponseStringMap(
+		message.StatusOk,
+		payloads,
+	)
+}
+
 func getResponseStatusOkPayload() message.Response {
 	return message.NewResponseStatus(
 		message.StatusOk,
@@ -63,6 +151,22 @@ func getResponseStatusOkPayload() message.Response {
 	)
 }
 
+func getResponseNotFound() message.Response {
+	return message.NewResponseStatus(
+		message.StatusNotFound,
+		core.ErrNotFound.Error(),
+	)
+}
+
+func intsToInt64Slice(s []int) []int64 {
+	result := make([]int64, len(s))
+	for i, v := range s {
+		result[i] = int64(v)
+	}
+
+	return result
+}
+
 func stringsSliceToBytesSlise(s []string) [][]byte {
 	result := make([][]byte, len(s))
 	for i, v := range s {
@@ -0,0 +1,306 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mshaverdo/radish/message"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WalFormat is an encoding of requests in WAL files
+type WalFormat int
+
+const (
+	// WalGencode is a compact and fast binary format, readable by Radish only
+	WalGencode WalFormat = iota
+
+	// WalResp is a text format like Redis AOF: every request is a RESP array, preceded by annotation line
+	// with request id and timestamp. Writing is as fast as gencode, but short requests take about 1.5 times
+	// more space and replay is about 5 times slower. In return, it could be inspected and edited by standard tools
+	WalResp
+)
+
+// respWalHeader starts every WAL file in RESP format, gencode WAL files have no header
+const respWalHeader = "#RADISH-WAL:RESP\r\n"
+
+var errRespWalSyntax = errors.New("RESP WAL syntax error")
+
+// ParseWalFormat parses WAL format name: gencode or resp
+func ParseWalFormat(format string) (WalFormat, error) {
+	switch strings.ToLower(format) {
+	case "gencode":
+		return WalGencode, nil
+	case "resp":
+		return WalResp, nil
+	default:
+		return 0, fmt.Errorf("unknown WAL format: %q", format)
+	}
+}
+
+// String returns WAL format name
+func (f WalFormat) String() string {
+	if f == WalResp {
+		return "resp"
+	}
+	return "gencode"
+}
+
+// RespEncoder writes requests as RESP arrays. Transactions are written as MULTI ... EXEC sequence, like in Redis AOF
+type RespEncoder struct {
+	writer io.Writer
+	buf    []byte
+}
+
+func NewRespEncoder(writer io.Writer) *RespEncoder {
+	return &RespEncoder{writer: writer}
+}
+
+func (re *RespEncoder) Encode(request *message.Request) error {
+	re.buf = re.appendAnnotation(re.buf[:0], request, true)
+
+	if request.Cmd == message.CmdExec {
+		requests, err := request.TransactionRequests()
+		if err != nil {
+			return err
+		}
+
+		re.buf = re.appendCommand(re.buf, "MULTI", nil)
+		for _, r := range requests {
+			re.buf = re.appendAnnotation(re.buf, r, false)
+			re.buf = re.appendCommand(re.buf, r.Cmd, r.Args)
+		}
+		re.buf = re.appendCommand(re.buf, message.CmdExec, nil)
+	} else {
+		re.buf = re.appendCommand(re.buf, request.Cmd, request.Args)
+	}
+
+	_, err := re.writer.Write(re.buf)
+	return err
+}
+
+// appendAnnotation appends annotation line with request timestamp and, if withId, with request id
+func (re *RespEncoder) appendAnnotation(buf []byte, request *message.Request, withId bool) []byte {
+	buf = append(buf, '#')
+	if withId {
+		buf = append(buf, "ID:"...)
+		buf = strconv.AppendInt(buf, request.Id, 10)
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "TS:"...)
+	buf = strconv.AppendInt(buf, request.Timestamp, 10)
+	return append(buf, '\r', '\n')
+}
+
+func (re *RespEncoder) appendCommand(buf []byte, cmd string, args [][]byte) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)+1), 10)
+	buf = append(buf, '\r', '\n')
+
+	buf = re.appendBulk(buf, []byte(cmd))
+	for _, arg := range args {
+		buf = re.appendBulk(buf, arg)
+	}
+
+	return buf
+}
+
+func (re *RespEncoder) appendBulk(buf []byte, bulk []byte) []byte {
+	buf = append(buf, '$')
+	buf = strconv.AppendInt(buf, int64(len(bulk)), 10)
+	buf = append(buf, '\r', '\n')
+	buf = append(buf, bulk...)
+	return append(buf, '\r', '\n')
+}
+
+// RespDecoder reads requests, written by RespEncoder. Every request must be preceded by annotation line
+// with ID and TS fields, requests of transaction inherit timestamp of EXEC, if they have no own annotation
+type RespDecoder struct {
+	reader *bufio.Reader
+}
+
+func NewRespDecoder(reader io.Reader) *RespDecoder {
+	return &RespDecoder{reader: bufio.NewReader(reader)}
+}
+
+func (rd *RespDecoder) Decode(request *message.Request) error {
+	err := rd.decode(request)
+	if err == io.ErrUnexpectedEOF {
+		// incomplete request at the end of WAL was written partially before crash, skip it like gencode decoder does
+		return io.EOF
+	}
+
+	return err
+}
+
+func (rd *RespDecoder) decode(request *message.Request) error {
+	id, timestamp, err := rd.readAnnotation()
+	if err != nil {
+		return err
+	}
+	if id <= 0 || timestamp == 0 {
+		return fmt.Errorf("%s: request without ID or TS annotation", errRespWalSyntax)
+	}
+
+	cmd, args, err := rd.readCommand()
+	if err != nil {
+		return unexpectedEof(err)
+	}
+
+	if cmd != "MULTI" {
+		*request = message.Request{Id: id, Timestamp: timestamp, Cmd: cmd, Args: args}
+		return nil
+	}
+
+	var requests []*message.Request
+	for {
+		_, requestTimestamp, err := rd.readAnnotation()
+		if err != nil {
+			return unexpectedEof(err)
+		}
+		if requestTimestamp == 0 {
+			requestTimestamp = timestamp
+		}
+
+		cmd, args, err := rd.readCommand()
+		if err != nil {
+			return unexpectedEof(err)
+		}
+		if cmd == message.CmdExec {
+			break
+		}
+
+		requests = append(requests, &message.Request{Timestamp: requestTimestamp, Cmd: cmd, Args: args})
+	}
+
+	transaction, err := message.NewRequestTransaction(requests)
+	if err != nil {
+		return err
+	}
+
+	*request = *transaction
+	request.Id = id
+	request.Timestamp = timestamp
+
+	return nil
+}
+
+// readAnnotation reads optional annotation line. Missing fields are returned as zeros
+func (rd *RespDecoder) readAnnotation() (id, timestamp int64, err error) {
+	b, err := rd.reader.Peek(1)
+	if err != nil || b[0] != '#' {
+		return 0, 0, err
+	}
+
+	line, err := rd.readLine()
+	if err != nil {
+		return 0, 0, unexpectedEof(err)
+	}
+
+	for _, field := range strings.Fields(string(line[1:])) {
+		var target *int64
+		switch {
+		case strings.HasPrefix(field, "ID:"):
+			target = &id
+		case strings.HasPrefix(field, "TS:"):
+			target = &timestamp
+		default:
+			continue
+		}
+
+		if *target, err = strconv.ParseInt(field[3:], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("%s: invalid annotation %q", errRespWalSyntax, line)
+		}
+	}
+
+	return id, timestamp, nil
+}
+
+// readCommand reads RESP array of bulk strings
+func (rd *RespDecoder) readCommand() (cmd string, args [][]byte, err error) {
+	count, err := rd.readLength('*')
+	if err != nil {
+		return "", nil, err
+	}
+	if count < 1 {
+		return "", nil, fmt.Errorf("%s: empty command", errRespWalSyntax)
+	}
+
+	name, err := rd.readBulk()
+	if err != nil {
+		return "", nil, unexpectedEof(err)
+	}
+
+	args = make([][]byte, count-1)
+	for i := range args {
+		if args[i], err = rd.readBulk(); err != nil {
+			return "", nil, unexpectedEof(err)
+		}
+	}
+
+	return strings.ToUpper(string(name)), args, nil
+}
+
+func (rd *RespDecoder) readBulk() ([]byte, error) {
+	length, err := rd.readLength('$')
+	if err != nil {
+		return nil, err
+	}
+
+	bulk := make([]byte, length+2)
+	if _, err := io.ReadFull(rd.reader, bulk); err != nil {
+		return nil, err
+	}
+	if !bytes.HasSuffix(bulk, []byte("\r\n")) {
+		return nil, fmt.Errorf("%s: bulk string isn't terminated by CRLF", errRespWalSyntax)
+	}
+
+	return bulk[:length], nil
+}
+
+// readLength reads line with type prefix and non-negative length
+func (rd *RespDecoder) readLength(prefix byte) (int, error) {
+	line, err := rd.readLine()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(line) < 2 || line[0] != prefix {
+		return 0, fmt.Errorf("%s: expected '%c', got %q", errRespWalSyntax, prefix, line)
+	}
+
+	length, err := strconv.Atoi(string(line[1:]))
+	if err != nil || length < 0 {
+		return 0, fmt.Errorf("%s: invalid length %q", errRespWalSyntax, line)
+	}
+
+	return length, nil
+}
+
+// readLine reads CRLF-terminated line without CRLF
+func (rd *RespDecoder) readLine() ([]byte, error) {
+	line, err := rd.reader.ReadBytes('\n')
+	if err == io.EOF && len(line) != 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%s: line isn't terminated by CRLF", errRespWalSyntax)
+	}
+
+	return line[:len(line)-2], nil
+}
+
+// unexpectedEof converts EOF in the middle of the request into io.ErrUnexpectedEOF
+func unexpectedEof(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+package controller_test
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/go-test/deep"
+	"github.com/mshaverdo/radish/controller"
+	"github.com/mshaverdo/radish/message"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func BenchmarkRespEncoder_Encode(b *testing.B) {
+	w := bufio.NewWriter(ioutil.Discard)
+	encoder := controller.NewRespEncoder(w)
+	request := message.NewRequest("SET", [][]byte{[]byte("000000000001"), []byte("XXX")})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		encoder.Encode(request)
+	}
+	w.Flush()
+	b.StopTimer()
+}
+
+func BenchmarkRespDecoder_Decode(b *testing.B) {
+	buf := bytes.NewBuffer(nil)
+	encoder := controller.NewRespEncoder(buf)
+	request := message.NewRequest("SET", [][]byte{[]byte("000000000001"), []byte("XXX")})
+
+	for i := 0; i < b.N; i++ {
+		request.Id = int64(i + 1)
+		encoder.Encode(request)
+	}
+
+	decoder := controller.NewRespDecoder(buf)
+
+	b.ResetTimer()
+	request = new(message.Request)
+	for i := 0; i < b.N; i++ {
+		decoder.Decode(request)
+	}
+
+	b.StopTimer()
+}
+
+func TestRespEncoder_EncodeDecode(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	encoder := controller.NewRespEncoder(buf)
+
+	srcRequests := []*message.Request{
+		{Id: 1, Timestamp: 1000, Cmd: "SET", Args: [][]byte{[]byte("key"), []byte("multi\r\nline")}},
+		{Id: 2, Timestamp: 1001, Cmd: "DEL", Args: [][]byte{}},
+		{Id: 3, Timestamp: 1002, Cmd: "LPUSH", Args: [][]byte{[]byte("list"), {}, []byte("#not an annotation")}},
+	}
+	transaction, err := message.NewRequestTransaction([]*message.Request{
+		{Timestamp: 1003, Cmd: "SET", Args: [][]byte{[]byte("a"), []byte("1")}},
+		{Timestamp: 1004, Cmd: "EXPIRE", Args: [][]byte{[]byte("a"), []byte("10")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transaction.Id = 4
+	transaction.Timestamp = 1005
+	srcRequests = append(srcRequests, transaction)
+
+	for _, r := range srcRequests {
+		if err := encoder.Encode(r); err != nil {
+			t.Fatalf("Encode(%s): %s", r, err)
+		}
+	}
+	// write partial request to the end to check it's skipped
+	buf.WriteString("#ID:5 TS:1006\r\n*2\r\n$3\r\nDEL\r\n")
+
+	decoder := controller.NewRespDecoder(buf)
+	requests := make([]*message.Request, 0)
+	request := new(message.Request)
+	for err = decoder.Decode(request); err != io.EOF; err = decoder.Decode(request) {
+		if err != nil {
+			t.Fatalf("failed to decode: %s", err)
+		}
+		requests = append(requests, request)
+		request = new(message.Request)
+	}
+
+	if diff := deep.Equal(requests, srcRequests); diff != nil {
+		t.Errorf("requests != srcRequests: %s", diff)
+	}
+}
+
+func TestRespDecoder_Decode(t *testing.T) {
+	tests := []struct {
+		wal     string
+		want    *message.Request
+		wantErr bool
+	}{
+		{"#ID:1 TS:10\r\n*2\r\n$3\r\nget\r\n$1\r\nk\r\n", &message.Request{Id: 1, Timestamp: 10, Cmd: "GET", Args: [][]byte{[]byte("k")}}, false},
+		{"#TS:10 ID:1 X:y\r\n*1\r\n$4\r\nPING\r\n", &message.Request{Id: 1, Timestamp: 10, Cmd: "PING", Args: [][]byte{}}, false},
+		{"*1\r\n$4\r\nPING\r\n", nil, true},
+		{"#ID:1\r\n*1\r\n$4\r\nPING\r\n", nil, true},
+		{"#ID:x TS:10\r\n*1\r\n$4\r\nPING\r\n", nil, true},
+		{"#ID:1 TS:10\r\n*1\r\n+PING\r\n", nil, true},
+		{"#ID:1 TS:10\r\n*0\r\n", nil, true},
+		{"#ID:1 TS:10\r\n*1\r\n$4\r\nPINGXX", nil, true},
+		{"#ID:1 TS:10\n*1\n$4\nPING\n", nil, true},
+	}
+
+	for _, tst := range tests {
+		request := new(message.Request)
+		err := controller.NewRespDecoder(bytes.NewBufferString(tst.wal)).Decode(request)
+		if (err != nil) != tst.wantErr {
+			t.Errorf("Decode(%q): got error %v, want error %t", tst.wal, err, tst.wantErr)
+			continue
+		}
+		if tst.want != nil {
+			if diff := deep.Equal(request, tst.want); diff != nil {
+				t.Errorf("Decode(%q): %s", tst.wal, diff)
+			}
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package controller
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/mshaverdo/radish/message"
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"strings"
+	"sync"
+)
+
+/*
+  Lua scripting: EVAL, EVALSHA, SCRIPT LOAD|EXISTS|FLUSH
+
+  Scripts are executed atomically: no other commands interleave with a running script.
+  Script calls Radish commands via redis.call() and redis.pcall(). Instead of the script itself,
+  effects of the script, i.e. successful modifying commands, are logged into WAL as a single transaction record,
+  so replay from WAL is deterministic and doesn't depend on the script.
+
+  Determinism constraints: os, io, package and debug libraries aren't available, as well as dofile/loadfile/load.
+  Scripts should depend only on KEYS, ARGV and data, returned by redis.call().
+  There is no script timeout, so long-running script blocks the whole server.
+*/
+
+var (
+	ErrNoScript         = errors.New("No matching script. Please use EVAL.")
+	ErrInvalidNumkeys   = errors.New("Number of keys can't be greater than number of args")
+	ErrUnknownScriptCmd = errors.New("Unknown SCRIPT subcommand")
+)
+
+// scriptCache stores compiled scripts by SHA1 of script source
+type scriptCache struct {
+	mu      sync.RWMutex
+	scripts map[string]*lua.FunctionProto
+}
+
+func newScriptCache() *scriptCache {
+	return &scriptCache{scripts: make(map[string]*lua.FunctionProto)}
+}
+
+// load compiles the script, stores it into cache and returns it's SHA1
+func (sc *scriptCache) load(source string) (sha string, proto *lua.FunctionProto, err error) {
+	sha = scriptSha(source)
+	if proto := sc.get(sha); proto != nil {
+		return sha, proto, nil
+	}
+
+	chunk, err := parse.Parse(strings.NewReader(source), "@user_script")
+	if err != nil {
+		return "", nil, err
+	}
+	proto, err = lua.Compile(chunk, "@user_script")
+	if err != nil {
+		return "", nil, err
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.scripts[sha] = proto
+
+	return sha, proto, nil
+}
+
+// get returns compiled script by SHA1 or nil if script isn't loaded
+func (sc *scriptCache) get(sha string) *lua.FunctionProto {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	return sc.scripts[strings.ToLower(sha)]
+}
+
+func (sc *scriptCache) flush() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.scripts = make(map[string]*lua.FunctionProto)
+}
+
+// scriptSha returns SHA1 of the script as a hex string
+func scriptSha(source string) string {
+	hash := sha1.Sum([]byte(source))
+	return hex.EncodeToString(hash[:])
+}
+
+// handleEval processes EVAL and EVALSHA requests. Inside a transaction the script is a part of the transaction run
+func (c *Controller) handleEval(request *message.Request, run *atomicRun) message.Response {
+	if len(request.Args) < 2 {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+
+	var proto *lua.FunctionProto
+	if request.Cmd == "EVALSHA" {
+		proto = c.scripts.get(string(request.Args[0]))
+		if proto == nil {
+			return getResponseCommandError(request.Cmd, ErrNoScript)
+		}
+	} else {
+		var err error
+		if _, proto, err = c.scripts.load(string(request.Args[0])); err != nil {
+			return getResponseCommandError(request.Cmd, fmt.Errorf("Error compiling script: %s", err))
+		}
+	}
+
+	numkeys, err := request.GetArgumentInt(1)
+	if err != nil {
+		return getResponseInvalidArguments(request.Cmd, err)
+	}
+	if numkeys < 0 || numkeys > len(request.Args)-2 {
+		return getResponseInvalidArguments(request.Cmd, ErrInvalidNumkeys)
+	}
+	keys := request.Args[2 : 2+numkeys]
+	argv := request.Args[2+numkeys:]
+
+	script := &atomicRun{controller: c, timestamp: request.Timestamp, isScript: true}
+	if run != nil {
+		response := script.exec(proto, keys, argv)
+		run.merge(script)
+		return response
+	}
+
+	// publish notifications after unlocking, to not block other requests by slow subscribers
+	defer c.notifyPending(&script.notifications)
+
+	c.transactionMutex.Lock()
+	defer c.transactionMutex.Unlock()
+
+	response := script.exec(proto, keys, argv)
+	if err := script.writeToWal(request); err != nil {
+		return getResponseCommandError(request.Cmd, err)
+	}
+
+	return response
+}
+
+// handleScript processes SCRIPT LOAD|EXISTS|FLUSH requests
+func (c *Controller) handleScript(request *message.Request) message.Response {
+	if len(request.Args) == 0 {
+		return getResponseInvalidArguments(request.Cmd, ErrUnknownScriptCmd)
+	}
+
+	switch strings.ToUpper(string(request.Args[0])) {
+	case "LOAD":
+		if len(request.Args) != 2 {
+			return getResponseInvalidArguments(request.Cmd+"|LOAD", ErrWrongArgumentsCount)
+		}
+
+		sha, _, err := c.scripts.load(string(request.Args[1]))
+		if err != nil {
+			return getResponseCommandError(request.Cmd, fmt.Errorf("Error compiling script: %s", err))
+		}
+
+		return getResponseStringPayload([]byte(sha))
+	case "EXISTS":
+		responses := make([]message.Response, len(request.Args)-1)
+		for i, sha := range request.Args[1:] {
+			exists := int64(0)
+			if c.scripts.get(string(sha)) != nil {
+				exists = 1
+			}
+			responses[i] = getResponseIntPayload(exists)
+		}
+
+		return getResponseArrayPayload(responses)
+	case "FLUSH":
+		c.scripts.flush()
+		return getResponseStatusOkPayload()
+	default:
+		return getResponseInvalidArguments(request.Cmd, ErrUnknownScriptCmd)
+	}
+}
+
+// exec runs the script and converts it's result into Response
+func (r *atomicRun) exec(proto *lua.FunctionProto, keys, argv [][]byte) message.Response {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	defer L.Close()
+
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	// avoid access to filesystem
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	redis := L.NewTable()
+	L.SetField(redis, "call", L.NewFunction(r.luaCall))
+	L.SetField(redis, "pcall", L.NewFunction(r.luaPCall))
+	L.SetField(redis, "status_reply", L.NewFunction(luaStatusReply))
+	L.SetField(redis, "error_reply", L.NewFunction(luaErrorReply))
+	L.SetGlobal("redis", redis)
+	L.SetGlobal("KEYS", bytesSliceToLuaTable(L, keys))
+	L.SetGlobal("ARGV", bytesSliceToLuaTable(L, argv))
+
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, 1, nil); err != nil {
+		return message.NewResponseStatus(message.StatusError, "Error running script: "+err.Error())
+	}
+
+	return luaToResponse(L.Get(-1))
+}
+
+// luaCall implements redis.call(): runs command and raises error, if command failed
+func (r *atomicRun) luaCall(L *lua.LState) int {
+	response := r.call(L)
+	if response.Status() != message.StatusOk && response.Status() != message.StatusNotFound {
+		L.RaiseError("%s", response.Bytes()[0])
+		return 0
+	}
+
+	L.Push(responseToLua(L, response))
+	return 1
+}
+
+// luaPCall implements redis.pcall(): runs command and returns error table, if command failed
+func (r *atomicRun) luaPCall(L *lua.LState) int {
+	L.Push(responseToLua(L, r.call(L)))
+	return 1
+}
+
+// call builds request from Lua function arguments and dispatches it like a request of the client
+func (r *atomicRun) call(L *lua.LState) message.Response {
+	if L.GetTop() == 0 {
+		L.RaiseError("Please specify at least one argument for redis.call()")
+	}
+
+	args := make([][]byte, L.GetTop())
+	for i := range args {
+		switch v := L.Get(i + 1).(type) {
+		case lua.LString:
+			args[i] = []byte(v)
+		case lua.LNumber:
+			args[i] = []byte(v.String())
+		default:
+			L.RaiseError("Lua redis() command arguments must be strings or integers")
+		}
+	}
+
+	return r.controller.dispatch(message.NewRequest(strings.ToUpper(string(args[0])), args[1:]), r)
+}
+
+func luaStatusReply(L *lua.LState) int {
+	t := L.NewTable()
+	L.SetField(t, "ok", lua.LString(L.CheckString(1)))
+	L.Push(t)
+	return 1
+}
+
+func luaErrorReply(L *lua.LState) int {
+	t := L.NewTable()
+	L.SetField(t, "err", lua.LString(L.CheckString(1)))
+	L.Push(t)
+	return 1
+}
+
+func bytesSliceToLuaTable(L *lua.LState, values [][]byte) *lua.LTable {
+	t := L.CreateTable(len(values), 0)
+	for _, v := range values {
+		t.Append(lua.LString(v))
+	}
+
+	return t
+}
+
+// responseToLua converts command response into Lua value using Redis conventions
+func responseToLua(L *lua.LState, response message.Response) lua.LValue {
+	switch r := response.(type) {
+	case *message.ResponseStatus:
+		t := L.NewTable()
+		switch r.Status() {
+		case message.StatusOk:
+			ok := r.Payload()
+			if ok == "" {
+				ok = "OK"
+			}
+			L.SetField(t, "ok", lua.LString(ok))
+		case message.StatusNotFound:
+			return lua.LFalse
+		default:
+			L.SetField(t, "err", lua.LString(r.Payload()))
+		}
+		return t
+	case *message.ResponseInt:
+		return lua.LNumber(r.Payload())
+	case *message.ResponseString:
+		return lua.LString(r.Payload())
+	case *message.ResponseStringSlice:
+		return bytesSliceToLuaTable(L, r.Payload())
+	case *message.ResponseNullableStringSlice:
+		// like in Redis, null elements are false in scripts
+		t := L.CreateTable(len(r.Payload()), 0)
+		for i, v := range r.Payload() {
+			if r.IsNull(i) {
+				t.Append(lua.LFalse)
+			} else {
+				t.Append(lua.LString(v))
+			}
+		}
+		return t
+	case *message.ResponseIntSlice:
+		t := L.CreateTable(len(r.Payload()), 0)
+		for i, v := range r.Payload() {
+			if r.IsNull(i) {
+				t.Append(lua.LFalse)
+			} else {
+				t.Append(lua.LNumber(v))
+			}
+		}
+		return t
+	case *message.ResponseStringMap:
+		// like in Redis, maps are flat arrays in scripts
+		return bytesSliceToLuaTable(L, r.Payload())
+	case *message.ResponseStringStream:
+		return bytesSliceToLuaTable(L, r.Bytes())
+	case *message.ResponseArray:
+		t := L.CreateTable(len(r.Payload()), 0)
+		for _, v := range r.Payload() {
+			t.Append(responseToLua(L, v))
+		}
+		return t
+	default:
+		L.RaiseError("unknown response type: %T", response)
+		return lua.LNil
+	}
+}
+
+// luaToResponse converts script result into Response using Redis conventions
+func luaToResponse(value lua.LValue) message.Response {
+	switch v := value.(type) {
+	case lua.LNumber:
+		// Lua numbers are converted into integers, like in Redis
+		return getResponseIntPayload(int64(v))
+	case lua.LString:
+		return getResponseStringPayload([]byte(v))
+	case lua.LBool:
+		if v {
+			return getResponseIntPayload(1)
+		}
+		return getResponseNotFound()
+	case *lua.LTable:
+		if ok, isString := v.RawGetString("ok").(lua.LString); isString {
+			return message.NewResponseStatus(message.StatusOk, string(ok))
+		}
+		if err, isString := v.RawGetString("err").(lua.LString); isString {
+			return message.NewResponseStatus(message.StatusError, string(err))
+		}
+
+		// like in Redis, array ends at the first nil
+		var responses []message.Response
+		for i := 1; v.RawGetInt(i) != lua.LNil; i++ {
+			responses = append(responses, luaToResponse(v.RawGetInt(i)))
+		}
+		return getResponseArrayPayload(responses)
+	default:
+		return getResponseNotFound()
+	}
+}
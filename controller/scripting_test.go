@@ -0,0 +1,54 @@
+package controller_test
+
+import (
+	"fmt"
+	"github.com/mshaverdo/radish/controller"
+	"github.com/mshaverdo/radish/message"
+	"testing"
+)
+
+func TestScriptRoundTrip(t *testing.T) {
+	one, two := int64(1), int64(2)
+
+	tests := []struct {
+		name     string
+		response message.Response
+		want     []string
+	}{
+		{
+			"int slice",
+			message.NewResponseIntSlice(message.StatusOk, []int64{0, 2}),
+			[]string{`StatusOk ["0"]`, `StatusOk ["2"]`},
+		},
+		{
+			"nullable int slice",
+			message.NewResponseNullableIntSlice(message.StatusOk, []*int64{&one, nil, &two}),
+			[]string{`StatusOk ["1"]`, `StatusNotFound`, `StatusOk ["2"]`},
+		},
+		{
+			"nullable string slice",
+			message.NewResponseNullableStringSlice(message.StatusOk, [][]byte{[]byte("a"), nil, {}}),
+			[]string{`StatusOk ["a"]`, `StatusNotFound`, `StatusOk [""]`},
+		},
+	}
+
+	for _, tst := range tests {
+		response, ok := controller.ScriptRoundTrip(tst.response).(*message.ResponseArray)
+		if !ok {
+			t.Errorf("%s: got %T, want array", tst.name, response)
+			continue
+		}
+
+		got := make([]string, len(response.Payload()))
+		for i, r := range response.Payload() {
+			// false element of Lua table is a null reply
+			got[i] = r.Status().String()
+			if r.Status() == message.StatusOk {
+				got[i] += fmt.Sprintf(" %q", r.Bytes())
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tst.want) {
+			t.Errorf("%s: got %q, want %q", tst.name, got, tst.want)
+		}
+	}
+}
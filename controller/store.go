@@ -0,0 +1,428 @@
+package controller
+
+import (
+	"github.com/mshaverdo/radish/core"
+	"github.com/mshaverdo/radish/log"
+	"github.com/mshaverdo/radish/message"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxWalDelKeys limits count of keys in a single DEL record of WAL, so DEL of a huge key list
+// doesn't produce a huge WAL record, that is slow to write and replay
+const maxWalDelKeys = 10000
+
+// StoreOptions configures persistence and background maintenance of Store
+type StoreOptions struct {
+	// SyncPolicy defines, how often WAL is synced to disk
+	SyncPolicy SyncPolicy
+	// WalFormat is an encoding of new WAL files. WAL files of any format are replayed
+	WalFormat WalFormat
+	// CollectExpiredInterval is an interval of expired items collection. Zero disables collection
+	CollectExpiredInterval time.Duration
+	// MergeWalInterval is an interval of merging WAL into snapshot
+	MergeWalInterval time.Duration
+	// FileNames configures names of snapshot and WAL files in the data dir
+	FileNames FileNames
+	// TtlJitter is a percent, within which relative TTL of SET, SETEX and EXPIRE is randomized. Zero disables jitter
+	TtlJitter int
+	// ReplayWorkers is a count of goroutines, replaying WAL requests to different keys in parallel on start and merge.
+	// Less than two replays WAL serially
+	ReplayWorkers int
+	// RefuseWalGaps makes Start fail, if message ids in WAL aren't contiguous, e.g. a WAL file was removed.
+	// By default such gap is logged as a warning
+	RefuseWalGaps bool
+	// MemoryPurgeInterval is an interval of releasing memory, held by the storage after removal of keys,
+	// like by MEMORY PURGE. Zero disables periodic purge
+	MemoryPurgeInterval time.Duration
+}
+
+// DefaultStoreOptions returns options, used by radish-server by default
+func DefaultStoreOptions() StoreOptions {
+	return StoreOptions{
+		SyncPolicy:             SyncSometimes,
+		CollectExpiredInterval: 100 * time.Second,
+		MergeWalInterval:       600 * time.Second,
+		FileNames:              DefaultFileNames(),
+		ReplayWorkers:          runtime.NumCPU(),
+	}
+}
+
+// Store is a Core with optional persistence by Keeper and expired items collection.
+// It doesn't depend on any network API, so it could be embedded into an application
+type Store struct {
+	isPersistent           bool //if true, persists data on disk
+	collectExpiredInterval time.Duration
+	memoryPurgeInterval    time.Duration
+
+	// activeExpireDisabled is 1, if expired items collection disabled by DEBUG SET-ACTIVE-EXPIRE, accessed atomically
+	activeExpireDisabled uint32
+
+	// ttlJitter is a percent of TTL jitter, accessed atomically
+	ttlJitter int64
+	// listMaxLength limits length of lists, grown by LPUSH, zero means unlimited. Accessed atomically
+	listMaxLength int64
+	// listOverflowTrim is 1, if LPUSH over listMaxLength trims the list instead of an error. Accessed atomically
+	listOverflowTrim uint32
+
+	core      Core
+	keeper    *Keeper
+	processor *Processor
+	// latency records latency spikes of commands, WAL fsyncs and snapshot updates
+	latency *latencyMonitor
+
+	// wg to wait for service storage-updating goroutines (CollectExpired(), etc)
+	serviceWg sync.WaitGroup
+	stopChan  chan struct{}
+}
+
+// NewStore constructs new Store. If dataDir is empty, data isn't persisted.
+// Store should be started by Start() before usage
+func NewStore(dataDir string, options StoreOptions) *Store {
+	s := Store{
+		isPersistent:           dataDir != "",
+		collectExpiredInterval: options.CollectExpiredInterval,
+		memoryPurgeInterval:    options.MemoryPurgeInterval,
+		core:                   core.New(storageFactory()),
+		latency:                &latencyMonitor{},
+		stopChan:               make(chan struct{}),
+	}
+
+	// out of range jitter is ignored, NewStore could not fail
+	s.SetTtlJitter(options.TtlJitter)
+	s.processor = NewProcessor(s.core)
+
+	if s.isPersistent {
+		s.keeper = NewKeeper(
+			s.core,
+			dataDir,
+			options.FileNames,
+			options.SyncPolicy,
+			options.WalFormat,
+			options.MergeWalInterval,
+			storageFactory,
+		)
+		s.keeper.replayWorkers = options.ReplayWorkers
+		s.keeper.refuseWalGaps = options.RefuseWalGaps
+		s.keeper.latency = s.latency
+	}
+
+	return &s
+}
+
+// OpenStore constructs and starts new Store
+func OpenStore(dataDir string, options StoreOptions) (*Store, error) {
+	s := NewStore(dataDir, options)
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SetFileNames configures names of snapshot and WAL files in the data dir. It must be invoked before Start()
+func (s *Store) SetFileNames(names FileNames) error {
+	if err := names.Validate(); err != nil {
+		return err
+	}
+
+	if s.isPersistent {
+		s.keeper.fileNames = names.withDefaults()
+	}
+
+	return nil
+}
+
+// SetWalFormat sets encoding of new WAL files. It must be invoked before Start()
+func (s *Store) SetWalFormat(format WalFormat) {
+	if s.isPersistent {
+		s.keeper.walFormat = format
+	}
+}
+
+// SetReplayWorkers sets a count of goroutines, replaying WAL requests in parallel. It must be invoked before Start()
+func (s *Store) SetReplayWorkers(count int) {
+	if s.isPersistent {
+		s.keeper.replayWorkers = count
+	}
+}
+
+// SetRefuseWalGaps makes missing messages in WAL an error instead of a warning. It must be invoked before Start()
+func (s *Store) SetRefuseWalGaps(refuse bool) {
+	if s.isPersistent {
+		s.keeper.refuseWalGaps = refuse
+	}
+}
+
+// SetMemoryPurgeInterval sets an interval of periodic memory purge, zero disables it. It must be invoked before Start()
+func (s *Store) SetMemoryPurgeInterval(interval time.Duration) {
+	s.memoryPurgeInterval = interval
+}
+
+// SetTtlJitter enables randomization of relative TTL of SET, SETEX and EXPIRE within ±percent of the requested TTL
+// to avoid simultaneous expiration of keys, set with the same TTL. Zero disables jitter
+func (s *Store) SetTtlJitter(percent int) error {
+	if percent < 0 || percent > 100 {
+		return ErrInvalidTtlJitter
+	}
+
+	atomic.StoreInt64(&s.ttlJitter, int64(percent))
+	return nil
+}
+
+// TtlJitter returns percent of TTL jitter, zero if disabled
+func (s *Store) TtlJitter() int {
+	return int(atomic.LoadInt64(&s.ttlJitter))
+}
+
+// SetListMaxLength limits length of lists, grown by LPUSH: if the list would be longer, LPUSH trims its tail
+// or fails, depending on SetListOverflowTrim. Zero disables the limit
+func (s *Store) SetListMaxLength(length int) {
+	atomic.StoreInt64(&s.listMaxLength, int64(length))
+}
+
+// ListMaxLength returns limit of list length, zero if unlimited
+func (s *Store) ListMaxLength() int {
+	return int(atomic.LoadInt64(&s.listMaxLength))
+}
+
+// SetListOverflowTrim makes LPUSH over the list length limit trim the tail of the list, like a circular buffer.
+// Otherwise such LPUSH is rejected with an error, that is the default
+func (s *Store) SetListOverflowTrim(trim bool) {
+	var flag uint32
+	if trim {
+		flag = 1
+	}
+
+	atomic.StoreUint32(&s.listOverflowTrim, flag)
+}
+
+// IsListOverflowTrim returns true, if LPUSH over the list length limit trims the list
+func (s *Store) IsListOverflowTrim() bool {
+	return atomic.LoadUint32(&s.listOverflowTrim) == 1
+}
+
+// rewriteRequest applies TTL jitter and the list length limit to the request, so WAL gets their effective values.
+// It must be invoked before processing of the request, that is written into WAL after that
+func (s *Store) rewriteRequest(request *message.Request) {
+	jitterRequestTtl(request, s.TtlJitter())
+	s.applyListMaxLength(request)
+}
+
+// applyListMaxLength rewrites LPUSH into LPUSHCAP and LPUSHEX into LPUSHCAPEX with the current list length limit, if it's enabled.
+// So the limit, effective at the moment of the push, is written into WAL and WAL replay doesn't depend on configuration
+func (s *Store) applyListMaxLength(request *message.Request) {
+	maxLength := s.ListMaxLength()
+	if maxLength <= 0 {
+		return
+	}
+
+	// fixedArgs is a count of arguments, preceding values. LPUSH without values is left to fail with its own error
+	var (
+		cappedCmd string
+		fixedArgs int
+	)
+	switch request.Cmd {
+	case "LPUSH":
+		cappedCmd, fixedArgs = "LPUSHCAP", 1
+	case "LPUSHEX":
+		cappedCmd, fixedArgs = "LPUSHCAPEX", 2
+	default:
+		return
+	}
+	if len(request.Args) <= fixedArgs {
+		return
+	}
+
+	policy := "ERROR"
+	if s.IsListOverflowTrim() {
+		policy = "TRIM"
+	}
+
+	args := make([][]byte, 0, len(request.Args)+2)
+	args = append(args, request.Args[:fixedArgs]...)
+	args = append(args, []byte(strconv.Itoa(maxLength)), []byte(policy))
+	request.Cmd = cappedCmd
+	request.Args = append(args, request.Args[fixedArgs:]...)
+}
+
+// Start restores persisted data and starts background processes
+func (s *Store) Start() error {
+	if s.isPersistent {
+		if err := s.keeper.Start(); err != nil {
+			return err
+		}
+	}
+
+	// Don't forget to add all background service processes to wg!
+	if s.collectExpiredInterval > 0 {
+		s.serviceWg.Add(1)
+		go s.runCollector()
+	}
+	if s.memoryPurgeInterval > 0 {
+		s.serviceWg.Add(1)
+		go s.runMemoryPurger()
+	}
+
+	return nil
+}
+
+// Close stops background processes and persists data.
+// Caller must ensure, that there is no concurrent requests to the store
+func (s *Store) Close() error {
+	return s.close(true)
+}
+
+// CloseNoSave stops background processes without persisting snapshot: changes are kept in WAL only
+// Caller must ensure, that there is no concurrent requests to the store
+func (s *Store) CloseNoSave() error {
+	return s.close(false)
+}
+
+func (s *Store) close(save bool) error {
+	close(s.stopChan)
+
+	//wait other goroutines that may interact with storage
+	s.serviceWg.Wait()
+
+	//OK, no more concurrent threads working with storage
+	if !s.isPersistent {
+		return nil
+	}
+
+	if save {
+		return s.keeper.Shutdown()
+	}
+	return s.keeper.ShutdownNoSave()
+}
+
+// CheckHealth returns nil, if the store persists data successfully or isn't persistent
+func (s *Store) CheckHealth() error {
+	if !s.isPersistent {
+		return nil
+	}
+
+	return s.keeper.CheckHealth()
+}
+
+// PersistenceError returns error, if the last background WAL write or snapshot update failed,
+// so the store couldn't persist new writes. It returns nil, if the store isn't persistent
+func (s *Store) PersistenceError() error {
+	if !s.isPersistent {
+		return nil
+	}
+
+	return s.keeper.PersistenceError()
+}
+
+// Core returns underlying Core
+func (s *Store) Core() Core {
+	return s.core
+}
+
+// Process processes request and writes it into WAL, if it succeeds and modifies the storage
+func (s *Store) Process(request *message.Request) message.Response {
+	s.rewriteRequest(request)
+	response := s.processor.Process(request)
+
+	if response.Status() == message.StatusOk && s.processor.IsModifyingRequest(request) {
+		for _, walRequest := range splitWalRequest(request) {
+			if err := s.WriteToWal(walRequest); err != nil {
+				return getResponseCommandError(request.Cmd, err)
+			}
+		}
+	}
+
+	return response
+}
+
+// splitWalRequest splits DEL of a huge key list into WAL requests with at most maxWalDelKeys keys.
+// DEL is applied to the storage at once, but after a crash only the first chunks could be replayed.
+// Transactions and scripts aren't split to keep them atomic
+func splitWalRequest(request *message.Request) []*message.Request {
+	if request.Cmd != "DEL" || len(request.Args) <= maxWalDelKeys {
+		return []*message.Request{request}
+	}
+
+	requests := make([]*message.Request, 0, (len(request.Args)+maxWalDelKeys-1)/maxWalDelKeys)
+	for start := 0; start < len(request.Args); start += maxWalDelKeys {
+		end := start + maxWalDelKeys
+		if end > len(request.Args) {
+			end = len(request.Args)
+		}
+
+		chunk := *request
+		chunk.Args = request.Args[start:end]
+		requests = append(requests, &chunk)
+	}
+
+	return requests
+}
+
+// WriteToWal writes modifying request into WAL, if the store is persistent
+func (s *Store) WriteToWal(request *message.Request) error {
+	if !s.isPersistent {
+		return nil
+	}
+
+	return s.keeper.WriteToWal(request)
+}
+
+// SyncWal blocks until all previously written requests are durable in WAL, if the store is persistent
+func (s *Store) SyncWal() error {
+	if !s.isPersistent {
+		return nil
+	}
+
+	return s.keeper.Sync()
+}
+
+// WalIssuedId returns id of the last WAL message, written after all previously written requests,
+// and count of failed pipelined writes before it, or zeros, if the store isn't persistent
+func (s *Store) WalIssuedId() (id, failures int64, err error) {
+	if !s.isPersistent {
+		return 0, 0, nil
+	}
+
+	return s.keeper.IssuedId()
+}
+
+// AsyncWalFailures returns count of failed background writes of pipelined requests since start,
+// or 0, if the store isn't persistent
+func (s *Store) AsyncWalFailures() int64 {
+	if !s.isPersistent {
+		return 0
+	}
+
+	return s.keeper.AsyncFailures()
+}
+
+// WalSyncedId returns id of the last durable WAL message, or 0, if the store isn't persistent
+func (s *Store) WalSyncedId() int64 {
+	if !s.isPersistent {
+		return 0
+	}
+
+	return s.keeper.SyncedId()
+}
+
+func (s *Store) runCollector() {
+	defer s.serviceWg.Done()
+
+	tick := time.Tick(s.collectExpiredInterval)
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-tick:
+			if !s.isActiveExpire() {
+				continue
+			}
+			count := s.core.CollectExpired()
+			log.Debugf("Collected %d expired items", count)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package controller
+
+import (
+	"github.com/mshaverdo/radish/message"
+	"strings"
+)
+
+// storeOptionKey returns destination key of `STORE destination` option of the request,
+// if the option presents in variadic options, starting from optionsIndex position
+func storeOptionKey(request *message.Request, optionsIndex int) (key string, ok bool) {
+	for i := optionsIndex; i+1 < len(request.Args); i++ {
+		if strings.ToUpper(string(request.Args[i])) == "STORE" {
+			return string(request.Args[i+1]), true
+		}
+	}
+
+	return "", false
+}
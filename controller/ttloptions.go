@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/mshaverdo/radish/message"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fixRequestTtlOptions replaces relative TTL options `EX seconds` and `PX milliseconds` of the request,
+// starting from optionsIndex position, with absolute `PXAT milliseconds-timestamp`, calculated from the request timestamp.
+// Also it removes NX and XX options: only successful requests are written into WAL,
+// but on restore the condition could be violated due to expiration of other items
+func fixRequestTtlOptions(request *message.Request, optionsIndex int) error {
+	if optionsIndex > len(request.Args) {
+		return fmt.Errorf("Trying to get not existing argument: %d > %d", optionsIndex, len(request.Args))
+	}
+
+	args := make([][]byte, optionsIndex, len(request.Args))
+	copy(args, request.Args)
+
+	for i := optionsIndex; i < len(request.Args); i++ {
+		option := strings.ToUpper(string(request.Args[i]))
+		switch option {
+		case "NX", "XX":
+			continue
+		case "KEEPTTL":
+			args = append(args, request.Args[i])
+			continue
+		}
+
+		if i+1 == len(request.Args) {
+			return fmt.Errorf("%s option without value", option)
+		}
+
+		value := request.Args[i+1]
+		i++
+
+		unit := time.Second
+		switch option {
+		case "PX":
+			unit = time.Millisecond
+			fallthrough
+		case "EX":
+			ttl, err := strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return err
+			}
+
+			expireAt := time.Unix(request.Timestamp, 0).Add(time.Duration(ttl) * unit)
+			option = "PXAT"
+			value = []byte(strconv.FormatInt(expireAt.UnixNano()/int64(time.Millisecond), 10))
+		}
+
+		args = append(args, []byte(option), value)
+	}
+
+	request.Args = args
+
+	return nil
+}
+
+// jitterRequestTtl randomizes relative TTL of SET EX|PX, SETEX and EXPIRE requests within ±percent of the requested TTL.
+// Jittered TTL is written into the request, so WAL contains the concrete value and replay doesn't randomize it again.
+// Invalid TTL values are left as is to be rejected by the processor
+func jitterRequestTtl(request *message.Request, percent int) {
+	if percent <= 0 {
+		return
+	}
+
+	switch request.Cmd {
+	case "SETEX", "EXPIRE", "HSETEX", "LPUSHEX", "LPUSHCAPEX":
+		jitterTtlArgument(request.Args, 1, percent)
+	case "SET":
+		for i := 2; i+1 < len(request.Args); i++ {
+			switch strings.ToUpper(string(request.Args[i])) {
+			case "EX", "PX":
+				i++
+				jitterTtlArgument(request.Args, i, percent)
+			}
+		}
+	}
+}
+
+// jitterTtlArgument replaces positive TTL in args[index] with random one within ±percent. Jittered TTL stays positive
+func jitterTtlArgument(args [][]byte, index, percent int) {
+	if index >= len(args) {
+		return
+	}
+
+	ttl, err := strconv.ParseInt(string(args[index]), 10, 64)
+	if err != nil || ttl <= 0 {
+		return
+	}
+
+	// avoid overflow of ttl * percent
+	span := ttl/100*int64(percent) + ttl%100*int64(percent)/100
+	if span == 0 {
+		return
+	}
+
+	ttl += rand.Int63n(2*span+1) - span
+	if ttl < 1 {
+		ttl = 1
+	}
+
+	args[index] = []byte(strconv.FormatInt(ttl, 10))
+}
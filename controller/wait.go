@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"errors"
+	"github.com/mshaverdo/radish/message"
+	"time"
+)
+
+var ErrNegativeTimeout = errors.New("timeout is negative")
+
+// handleWait processes WAIT numreplicas timeout request. Radish has no replicas, so WAIT just blocks,
+// until all previous writes are synced to WAL, or timeout in milliseconds expires. Zero timeout means forever.
+// It always returns 0 acknowledged replicas
+func (c *Controller) handleWait(request *message.Request) message.Response {
+	if len(request.Args) != 2 {
+		return getResponseInvalidArguments(request.Cmd, ErrWrongArgumentsCount)
+	}
+
+	if _, err := request.GetArgumentInt(0); err != nil {
+		return getResponseInvalidArguments(request.Cmd, err)
+	}
+	timeout, err := request.GetArgumentInt(1)
+	if err != nil {
+		return getResponseInvalidArguments(request.Cmd, err)
+	}
+	if timeout < 0 {
+		return getResponseInvalidArguments(request.Cmd, ErrNegativeTimeout)
+	}
+
+	if !c.store.isPersistent {
+		return getResponseIntPayload(0)
+	}
+
+	if err := c.syncWalWithTimeout(time.Duration(timeout) * time.Millisecond); err != nil {
+		return getResponseCommandError(request.Cmd, err)
+	}
+
+	return getResponseIntPayload(0)
+}
+
+// syncWalWithTimeout syncs WAL in background and waits for it, until timeout expires. Zero timeout means forever.
+// Expired timeout isn't an error, like in Redis WAIT. MUST be invoked only by handlers, counted by c.handlerWg
+func (c *Controller) syncWalWithTimeout(timeout time.Duration) error {
+	// sync may outlive the request on timeout, so shutdown should wait for it too
+	done := make(chan error, 1)
+	c.handlerWg.Add(1)
+	go func() {
+		done <- c.store.SyncWal()
+		c.handlerWg.Done()
+	}()
+
+	var timeoutChan <-chan time.Time
+	if timeout > 0 {
+		timeoutChan = time.After(timeout)
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-timeoutChan:
+		//just return, like Redis does
+		return nil
+	}
+}
+
+// IsModifyingRequest returns true, if the request could be written into WAL.
+// Transactions and scripts are modifying, because they're written into WAL, if any of their commands modifies the storage
+func (c *Controller) IsModifyingRequest(request *message.Request) bool {
+	return message.IsModifyingCommand(request.Cmd) || c.store.processor.IsModifyingRequest(request)
+}
+
+// WalIssuedId returns id of the last WAL message, that covers all requests, handled before the call,
+// and count of failed pipelined writes before it. It returns zeros, if the controller isn't persistent
+func (c *Controller) WalIssuedId() (id, failures int64, err error) {
+	if !c.enterHandler() {
+		return 0, 0, ErrServerShutdown
+	}
+	defer c.handlerWg.Done()
+
+	return c.store.WalIssuedId()
+}
+
+// WalFailures returns count of failed pipelined writes since start
+func (c *Controller) WalFailures() int64 {
+	return c.store.AsyncWalFailures()
+}
+
+// WaitWalSynced blocks until WAL is durable up to the message with id, or timeout expires. Zero timeout means forever.
+// It returns id of the last durable WAL message, that is less than id, if timeout expired.
+// It doesn't block, if the messages are already durable or the controller isn't persistent
+func (c *Controller) WaitWalSynced(id int64, timeout time.Duration) (int64, error) {
+	if synced := c.store.WalSyncedId(); synced >= id {
+		return synced, nil
+	}
+
+	if !c.enterHandler() {
+		return 0, ErrServerShutdown
+	}
+	defer c.handlerWg.Done()
+
+	if err := c.syncWalWithTimeout(timeout); err != nil {
+		return 0, err
+	}
+
+	return c.store.WalSyncedId(), nil
+}
+
+// enterHandler counts a caller, that uses the store out of HandleMessage, by c.handlerWg, so shutdown waits for it.
+// It returns false, if the controller is stopped. Otherwise the caller MUST invoke c.handlerWg.Done()
+func (c *Controller) enterHandler() bool {
+	select {
+	case <-c.stopChan:
+		return false
+	default:
+		// It's OK to do wg.Add() here, due to c.stop() invoked BEFORE c.handlerWg.Wait(), like in handleMessage()
+		c.handlerWg.Add(1)
+		return true
+	}
+}
@@ -1,9 +1,19 @@
 package core
 
 import (
+	"bytes"
 	"errors"
-	"github.com/ryanuber/go-glob"
+	"fmt"
+	"github.com/mshaverdo/radish/glob"
 	"math"
+	"math/bits"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // configuration
@@ -11,16 +21,44 @@ var (
 	// CollectExpiredBatchSize items processed by CollectExpired()  at once, in single mutex lock to reduce mutex lock overhead
 	CollectExpiredBatchSize = 100
 
-	// If true, Core.Keys() will check every element to isExpire() end exlude expired keys from return
-	KeysCheckTtl = true
+	// MaxBytesLength limits length of Bytes value, that could be grown by SETBIT or SETRANGE, to avoid OOM on absurd offsets
+	MaxBytesLength = 512 * 1024 * 1024
+
+	// MaxRandFieldCount limits count of repeated fields, returned by DRandField with negative count, to avoid OOM on absurd counts
+	MaxRandFieldCount = 1024 * 1024
 )
 
+// keysCheckTtl is 1, if Core.Keys() checks every key and excludes expired ones from result. Accessed atomically
+var keysCheckTtl uint32 = 1
+
 var (
 	// ErrNotFound returned by Core API methods when requested key not found
 	ErrNotFound     = errors.New("item not found")
 	ErrNoSuchKey    = errors.New("no such key")
 	ErrWrongType    = errors.New("operation against a key holding the wrong kind of value")
 	ErrInvalidIndex = errors.New("index out of range")
+	ErrSyntax       = errors.New("syntax error")
+	ErrBitOffset    = errors.New("bit offset is not an integer or out of range")
+	ErrBitValue     = errors.New("bit is not an integer or out of range")
+	ErrBitOpNot     = errors.New("BITOP NOT must be called with a single source key")
+	ErrBitFieldType = errors.New("Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	ErrOverflowType = errors.New("Invalid OVERFLOW type specified")
+	ErrOffsetRange  = errors.New("offset is out of range")
+	ErrTooLong      = errors.New("string exceeds maximum allowed size")
+	ErrBadDump      = errors.New("DUMP payload version or checksum are wrong")
+	ErrBusyKey      = errors.New("Target key name already exists.")
+	ErrNotFloat     = errors.New("value is not a valid float")
+	ErrMinMaxFloat  = errors.New("min or max is not a float")
+	ErrScoreNaN     = errors.New("resulting score is not a number (NaN)")
+	ErrIncrNaN      = errors.New("increment would produce NaN or Infinity")
+	ErrHashNotFloat = errors.New("hash value is not a float")
+	ErrNotInt       = errors.New("value is not an integer or out of range")
+	ErrExpireTime   = errors.New("invalid expire time")
+	ErrSortNotFloat = errors.New("One or more scores can't be converted into double")
+	ErrRankZero     = errors.New("RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+	ErrNegCount     = errors.New("COUNT can't be negative")
+	ErrListFull     = errors.New("list would exceed max length")
+	ErrOutOfRange   = errors.New("value is out of range")
 )
 
 // Storage encapsulates concrete concurrency-safe storage engine  -- Btree, hashmap, etc
@@ -34,23 +72,49 @@ type Storage interface {
 	// AddOrReplaceOne adds new or replaces one existing Item in the storage. It much faster than AddOrReplace with single items
 	AddOrReplaceOne(key string, item *Item)
 
+	// CompareAndReplace adds or replaces Item only if the current Item of the key is old, nil old means absent key.
+	// Returns true, if the item was stored
+	CompareAndReplace(key string, old, item *Item) (replaced bool)
+
 	// Del removes Items from storage and returns count of actually removed values
 	// if key not found in the storage, just skip it
 	Del(keys []string) (count int)
 
 	// DelSubmap removes Items only if existing *Item equals to provided submap[key]
-	// if key not found in the storage, just skip it and returns count of actually deleted items
-	DelSubmap(submap map[string]*Item) (count int)
+	// if key not found in the storage, just skip it and returns keys of actually deleted items
+	DelSubmap(submap map[string]*Item) (removed []string)
 
 	// Keys returns all keys existing in the
 	Keys() (keys []string)
+
+	// ViewKeys invokes view with iterator over all keys existing in the Storage.
+	// Storage is locked for modifications until view returns, so iterator yields the same keys on every call
+	ViewKeys(view func(forEach KeyIterator))
+
+	// Len returns count of keys existing in the Storage
+	Len() int
+}
+
+// Compactor is a Storage, that could release memory, held by internal structures after removal of items
+type Compactor interface {
+	// Compact rebuilds internal structures of the storage to fit the current count of items
+	Compact()
 }
 
+// KeyIterator invokes yield for every key of the keyspace and corresponding Item
+type KeyIterator func(yield func(key string, item *Item))
+
 var _ Storage = (*StorageHash)(nil)
+var _ Compactor = (*StorageHash)(nil)
 
 // Core provides domain operations on the storage -- get, set, keys, hset, hdel, etc
 type Core struct {
-	storage Storage
+	storage        Storage
+	expiredHandler func(key string)
+	// sortHashFields is 1, if HKEYS and HGETALL return fields in lexicographical order
+	sortHashFields uint32
+	// replayTime is a moment of the replayed request, see At(). Zero time means the current time
+	replayTime time.Time
 }
 
 // New constructs new core instance
@@ -78,18 +142,82 @@ func (c *Core) CollectExpired() (count int) {
 		}
 
 		if len(expiredItems) > CollectExpiredBatchSize {
-			deleted := c.storage.DelSubmap(expiredItems)
+			deleted := c.delExpired(expiredItems)
 			//log.Debugf("%d KEYS deleted", deleted)
 			count += deleted
 			expiredItems = map[string]*Item{}
 		}
 	}
 
-	count += c.storage.DelSubmap(expiredItems)
+	count += c.delExpired(expiredItems)
 
 	return count
 }
 
+// SetKeysCheckTtl enables checking of TTL of every key, matched by KEYS, to exclude expired ones.
+// It costs a lock of every key, without it KEYS may return expired keys, that aren't collected yet
+func SetKeysCheckTtl(enabled bool) {
+	var flag uint32
+	if enabled {
+		flag = 1
+	}
+
+	atomic.StoreUint32(&keysCheckTtl, flag)
+}
+
+// IsKeysCheckTtl returns true, if KEYS excludes expired keys
+func IsKeysCheckTtl() bool {
+	return atomic.LoadUint32(&keysCheckTtl) == 1
+}
+
+// SetSortHashFields enables lexicographical order of fields, returned by HKEYS and HGETALL.
+// It makes output reproducible at the cost of sorting, Redis itself doesn't guarantee any order
+func (c *Core) SetSortHashFields(enabled bool) {
+	var flag uint32
+	if enabled {
+		flag = 1
+	}
+
+	atomic.StoreUint32(&c.sortHashFields, flag)
+}
+
+// IsSortHashFields returns true, if HKEYS and HGETALL return fields in lexicographical order
+func (c *Core) IsSortHashFields() bool {
+	return atomic.LoadUint32(&c.sortHashFields) == 1
+}
+
+// At returns the core, that processes a request at the moment, when it was done, e.g. while WAL is replayed.
+// Expiration is checked and relative TTL is counted from this moment, so a write, done before expiration of the key,
+// is applied to the key, and a write, done after expiration, creates a new one, like it was originally.
+// Both cores share the storage
+func (c *Core) At(now time.Time) *Core {
+	return &Core{
+		storage:        c.storage,
+		expiredHandler: c.expiredHandler,
+		sortHashFields: atomic.LoadUint32(&c.sortHashFields),
+		replayTime:     now,
+	}
+}
+
+// SetExpiredHandler sets handler, invoked for every item removed by CollectExpired().
+// It should be set before CollectExpired() usage
+func (c *Core) SetExpiredHandler(handler func(key string)) {
+	c.expiredHandler = handler
+}
+
+// delExpired removes expired items and invokes expiredHandler for them.
+// Items, replaced before removal, aren't expired anymore, so they are neither removed nor reported
+func (c *Core) delExpired(expiredItems map[string]*Item) (count int) {
+	removed := c.storage.DelSubmap(expiredItems)
+	if c.expiredHandler != nil {
+		for _, key := range removed {
+			c.expiredHandler(key)
+		}
+	}
+
+	return len(removed)
+}
+
 /*
   Public methods could be featured as API Commands, available via HTTP, RESP, etc external API using @tags, one per line
   This tags used by tools/gen-processor to generate message-to-core bindings
@@ -98,7 +226,22 @@ func (c *Core) CollectExpired() (count int) {
   @modifying				- command modifies storage and should be logged into WAL
   @ttl <ARGUMENT_INDEX>		- command has int TTL argument in seconds, in  ARGUMENT_INDEX zero-based position.
 							E.g. Expire(key, seconds) has tag `@ttl 1` due to <seconds> in position 1
-							It used to fix TTL-argument during restore from WAL
+							It used to validate TTL-argument of @positivettl commands
+  @pttl <ARGUMENT_INDEX>	- the same as @ttl, but TTL is in milliseconds and zero TTL means no expiration
+  @optional				- variadic argument of the command could be empty
+  @ttloptions <ARGUMENT_INDEX>	- command has variadic options argument in ARGUMENT_INDEX position, that could contain
+							relative TTL options: `EX seconds` or `PX milliseconds`.
+							On restore from WAL, they are replaced with absolute `PXAT` option
+  @map					- [][]byte result of the command is a flat slice of key/value pairs, sent as a map in RESP3
+  @status				- string result of the command is a status reply, e.g. TYPE result
+  @minargs <COUNT>		- minimal count of arguments of variadic command. By default it's count of fixed arguments
+							plus one element of variadic argument, or just count of fixed arguments for @optional command
+  @storeoption <ARGUMENT_INDEX>	- command has variadic options argument in ARGUMENT_INDEX position, that could contain
+							`STORE destination` option. Command modifies storage only with this option,
+							and replies with count of elements of [][]byte result instead of the result itself
+  @countoption <ARGUMENT_INDEX>	- command has variadic options argument in ARGUMENT_INDEX position, that could contain
+							`COUNT num` option. Command replies with []int result as an array only with this option,
+							otherwise with its single element
 */
 
 // About performance:
@@ -110,11 +253,13 @@ func (c *Core) CollectExpired() (count int) {
 // Warning: consider KEYS as a command that should only be used in production environments with extreme care.
 // It may ruin performance when it is executed against large databases.
 // @command KEYS
+// @complexity O(N) where N is the number of keys in the database
+// @dangerous
 func (c *Core) Keys(pattern string) (result []string) {
 	allKeys := c.storage.Keys()
 
 	isFresh := func(key string) bool {
-		if !KeysCheckTtl {
+		if !IsKeysCheckTtl() {
 			return true
 		}
 
@@ -132,7 +277,7 @@ func (c *Core) Keys(pattern string) (result []string) {
 	// pre-allocate slice to avoid reallocation
 	filteredKeys := make([]string, 0, len(allKeys))
 	for _, key := range allKeys {
-		if glob.Glob(pattern, key) && isFresh(key) {
+		if glob.Match(pattern, key) && isFresh(key) {
 			filteredKeys = append(filteredKeys, key)
 		}
 	}
@@ -140,9 +285,48 @@ func (c *Core) Keys(pattern string) (result []string) {
 	return filteredKeys
 }
 
+// DbSize returns count of keys in the storage, including expired, but not collected yet.
+// Unlike KEYS, it doesn't iterate over keys
+func (c *Core) DbSize() int {
+	return c.storage.Len()
+}
+
+// KeysFunc is a streaming version of Keys: instead of building slice of matching keys,
+// it invokes write with count of keys matching glob pattern and iterator over them.
+// Storage is locked for modifications until write returns, so write should be fast, e.g. just collect the keys
+func (c *Core) KeysFunc(pattern string, write func(count int, forEach func(yield func(key string)))) {
+	c.storage.ViewKeys(func(forEachKey KeyIterator) {
+		// expiration is checked at the same moment to yield exactly count keys
+		now := time.Now()
+		isFresh := func(item *Item) bool {
+			if !IsKeysCheckTtl() {
+				return true
+			}
+
+			item.RLock()
+			defer item.RUnlock()
+			return !item.IsExpiredAt(now)
+		}
+
+		forEach := func(yield func(key string)) {
+			forEachKey(func(key string, item *Item) {
+				if glob.Match(pattern, key) && isFresh(item) {
+					yield(key)
+				}
+			})
+		}
+
+		count := 0
+		forEach(func(string) { count++ })
+
+		write(count, forEach)
+	})
+}
+
 // Get the value of key. If the key does not exist the special value nil is returned.
 // An error is returned if the value stored at key is not a string, because GET only handles string values.
 // @command GET
+// @complexity O(1)
 func (c *Core) Get(key string) (result []byte, err error) {
 	item := c.getItem(key)
 	if item == nil {
@@ -166,19 +350,158 @@ func (c *Core) Get(key string) (result []byte, err error) {
 // Set key to hold the string value.
 // If key already holds a value, it is overwritten, regardless of its type.
 // Any previous time to live associated with the key is discarded on successful SET operation.
+func (c *Core) Set(key string, value []byte) {
+	item := c.created(NewItemBytes(value))
+	c.storage.AddOrReplaceOne(key, item)
+}
+
+// SetWithOptions Set key to hold the string value, like Set, but accepts options:
+// EX seconds -- set the specified expire time, in seconds
+// PX milliseconds -- set the specified expire time, in milliseconds
+// EXAT timestamp -- set the specified Unix time at which the key will expire, in seconds
+// PXAT milliseconds-timestamp -- set the specified Unix time at which the key will expire, in milliseconds
+// NX -- only set the key if it does not already exist
+// XX -- only set the key if it already exist
+// KEEPTTL -- retain the time to live associated with the key
+// Returns ErrNotFound, if the key wasn't set due to NX or XX condition.
+// Expire time in the past leads to deleting the key.
 // @command SET
+// @complexity O(1)
 // @modifying
-func (c *Core) Set(key string, value []byte) {
-	item := NewItemBytes(value)
+// @optional
+// @ttloptions 2
+func (c *Core) SetWithOptions(key string, value []byte, options []string) (err error) {
+	var (
+		expireAt                   time.Time
+		hasExpire, nx, xx, keepTtl bool
+	)
+	for i := 0; i < len(options); i++ {
+		switch option := strings.ToUpper(options[i]); option {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTtl = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasExpire || i+1 == len(options) {
+				return ErrSyntax
+			}
+			i++
+			if expireAt, err = parseExpireOption(option, options[i], c.now()); err != nil {
+				return err
+			}
+			hasExpire = true
+		default:
+			return ErrSyntax
+		}
+	}
+
+	if nx && xx || hasExpire && keepTtl {
+		return ErrSyntax
+	}
+
+	var existing *Item
+	if nx || xx || keepTtl {
+		existing = c.getItem(key)
+	}
+	if nx && existing != nil || xx && existing == nil {
+		return ErrNotFound
+	}
+
+	if hasExpire && !expireAt.After(c.now()) {
+		//item expired before set, just remove it
+		c.Del([]string{key})
+		return nil
+	}
+
+	item := c.created(NewItemBytes(value))
+	if hasExpire {
+		item.SetExpireAt(expireAt)
+	}
+	if keepTtl && existing != nil {
+		// concurrent EXPIRE and PERSIST wait for the new item instead of changing TTL of the replaced one
+		existing.Lock()
+		item.SetExpireAt(existing.ExpireAt())
+		existing.replaced = true
+		existing.Unlock()
+	}
+
 	c.storage.AddOrReplaceOne(key, item)
+
+	return nil
+}
+
+// CompareAndSwap Sets key to hold the string value, only if the current value equals to expected.
+// Returns 1, if the value was set, and 0 otherwise. TTL of the key is retained.
+// Not existing key doesn't match any expected value, but with CREATE option it matches empty expected value
+// and the key is created.
+// @command CAS
+// @complexity O(1)
+// @modifying
+// @optional
+func (c *Core) CompareAndSwap(key string, expected, value []byte, options []string) (result int, err error) {
+	create := false
+	for _, option := range options {
+		if strings.ToUpper(option) != "CREATE" {
+			return 0, ErrSyntax
+		}
+		create = true
+	}
+
+	for {
+		item := c.getItem(key)
+		if item == nil {
+			if !create || len(expected) != 0 {
+				return 0, nil
+			}
+
+			// the key could be created concurrently, so it's added only if the storage still holds
+			// the same expired item or nothing, otherwise the new item is compared
+			old := c.storage.Get(key)
+			if old != nil && c.peekItem(key) == old {
+				continue
+			}
+			if c.storage.CompareAndReplace(key, old, c.created(NewItemBytes(value))) {
+				return 1, nil
+			}
+			continue
+		}
+
+		item.Lock()
+		if item.kind != Bytes {
+			item.Unlock()
+			return 0, ErrWrongType
+		}
+		if c.isExpired(item) || item.replaced {
+			// item is being removed or replaced, compare the new one
+			item.Unlock()
+			runtime.Gosched()
+			continue
+		}
+
+		if !bytes.Equal(item.Bytes(), expected) {
+			item.Unlock()
+			return 0, nil
+		}
+
+		item.SetBytes(value)
+		c.touch(item)
+		item.Unlock()
+
+		return 1, nil
+	}
 }
 
 // Set key to hold the string value and set key to timeout after a given number of seconds.
 // If key already holds a value, it is overwritten, regardless of its type.
-// ttl <= 0 leads to deleting record
+// Like in Redis, SETEX requests with ttl <= 0 are rejected. On WAL replay, TTL is counted from the moment of the request.
+// Direct call with ttl <= 0 leads to deleting record
 // @command SETEX
+// @complexity O(1)
 // @modifying
 // @ttl 1
+// @positivettl
 func (c *Core) SetEx(key string, seconds int, value []byte) {
 	if seconds <= 0 {
 		//item expired before set, just remove it
@@ -186,19 +509,61 @@ func (c *Core) SetEx(key string, seconds int, value []byte) {
 		return
 	}
 
-	item := NewItemBytes(value)
-	item.SetTtl(seconds)
+	item := c.created(NewItemBytes(value))
+	item.SetExpireAt(c.now().Add(time.Duration(seconds) * time.Second))
 	c.storage.AddOrReplaceOne(key, item)
 }
 
+// IncrByFloat Increments the floating point number stored at key by the specified increment.
+// If the key does not exist, it is set to 0 before performing the operation.
+// Returns the value of key after the increment, that is stored as a string without trailing zeroes.
+// @command INCRBYFLOAT
+// @complexity O(1)
+// @modifying
+func (c *Core) IncrByFloat(key, increment string) (result []byte, err error) {
+	incr, err := parseFloat(increment)
+	if err != nil {
+		return nil, err
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		item = c.created(NewItemBytes([]byte("0")))
+		defer func() {
+			if err == nil {
+				c.storage.AddOrReplaceOne(key, item)
+			}
+		}()
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != Bytes {
+		return nil, ErrWrongType
+	}
+
+	result, err = incrFloatValue(item.Bytes(), incr)
+	if err != nil {
+		return nil, err
+	}
+
+	item.SetBytes(result)
+	c.touch(item)
+
+	// don't return stored value itself to avoid its modification outside
+	return []byte(string(result)), nil
+}
+
 // Del Removes the specified keys, ignoring not existing and returns count of actually removed values.
 // Due to the system isn't supports replications/slaves,
 // we don't need conflict resolution, so we could simplify deletion:
 // just remove link to Item from Storage, instead marking 'deleted' and then collect garbage in background, etc
 // @command DEL
+// @complexity O(N) where N is the number of keys
 // @modifying
-func (c *Core) Del(keys []string) (count int) {
-	return c.storage.Del(keys)
+func (c *Core) Del(keys []string) (count int64) {
+	return int64(c.storage.Del(keys))
 }
 
 // DSet Sets field in the hash stored at key to value.
@@ -206,12 +571,54 @@ func (c *Core) Del(keys []string) (count int) {
 // If field already exists in the dict, it is overwritten.
 // returns 1 if f field is a new field in the hash and value was set.
 // returns 0 if field already exists in the hash and the value was updated.
+func (c *Core) DSet(key, field string, value []byte) (count int64, err error) {
+	return c.DSetMany(key, [][]byte{[]byte(field), value})
+}
+
+// DSetMany Sets fields in the hash stored at key to their values atomically.
+// Arguments are pairs of field and value. If key does not exist, a new key holding a hash is created.
+// If a field already exists in the dict, it is overwritten.
+// Returns the number of fields that were added, not including fields already existing, which value was updated.
 // @command HSET
+// @complexity O(N) where N is the number of field/value pairs
+// @modifying
+// @minargs 3
+func (c *Core) DSetMany(key string, fieldsValues [][]byte) (count int64, err error) {
+	return c.dSetMany(key, fieldsValues, 0)
+}
+
+// DSetManyEx Sets fields in the hash stored at key to their values and sets key to timeout after a given number of seconds.
+// Fields are set like by DSetMany, so a volatile hash is created by a single command. TTL is set on every call, like SETEX does.
+// Like SETEX, requests with ttl <= 0 are rejected. On WAL replay, TTL is counted from the moment of the request.
+// Direct call with ttl <= 0 leads to deleting the key
+// @command HSETEX
+// @complexity O(N) where N is the number of field/value pairs
 // @modifying
-func (c *Core) DSet(key, field string, value []byte) (count int, err error) {
+// @minargs 4
+// @ttl 1
+// @positivettl
+func (c *Core) DSetManyEx(key string, seconds int, fieldsValues [][]byte) (count int64, err error) {
+	if len(fieldsValues) == 0 || len(fieldsValues)%2 != 0 {
+		return 0, ErrSyntax
+	}
+	if seconds <= 0 {
+		//item expired before set, just remove it
+		c.Del([]string{key})
+		return 0, nil
+	}
+
+	return c.dSetMany(key, fieldsValues, seconds)
+}
+
+// dSetMany sets fields in the hash stored at key to their values. Positive seconds sets TTL of the key
+func (c *Core) dSetMany(key string, fieldsValues [][]byte, seconds int) (count int64, err error) {
+	if len(fieldsValues) == 0 || len(fieldsValues)%2 != 0 {
+		return 0, ErrSyntax
+	}
+
 	item := c.getItem(key)
 	if item == nil {
-		item = NewItemDict(map[string][]byte{})
+		item = c.created(NewItemDict(make(map[string][]byte, len(fieldsValues)/2)))
 		defer func() {
 			c.storage.AddOrReplaceOne(key, item)
 		}()
@@ -225,17 +632,24 @@ func (c *Core) DSet(key, field string, value []byte) (count int, err error) {
 	}
 
 	dict := item.Dict()
-	count = 1
-	if _, ok := dict[field]; ok {
-		count = 0
+	for i := 0; i < len(fieldsValues); i += 2 {
+		field := string(fieldsValues[i])
+		if _, ok := dict[field]; !ok {
+			count++
+		}
+		dict[field] = fieldsValues[i+1]
+	}
+	if seconds > 0 {
+		item.SetExpireAt(c.now().Add(time.Duration(seconds) * time.Second))
 	}
-	dict[field] = value
+	c.touch(item)
 
 	return count, nil
 }
 
 // DGet Returns the value associated with field in the dict stored at key.
 // @command HGET
+// @complexity O(1)
 func (c *Core) DGet(key, field string) (result []byte, err error) {
 	item := c.getItem(key)
 	if item == nil {
@@ -262,7 +676,9 @@ func (c *Core) DGet(key, field string) (result []byte, err error) {
 }
 
 // Returns all field names in the dict stored at key.
+// Order of fields is undefined, unless sorting of hash fields is enabled.
 // @command HKEYS
+// @complexity O(N) where N is the size of the hash
 func (c *Core) DKeys(key string) (result []string, err error) {
 	pattern := "*"
 	item := c.getItem(key)
@@ -283,18 +699,25 @@ func (c *Core) DKeys(key string) (result []string, err error) {
 	// pre-allocate slice to avoid reallocation
 	filteredKeys := make([]string, 0, len(dict))
 	for key := range dict {
-		if glob.Glob(pattern, key) {
+		if glob.Match(pattern, key) {
 			filteredKeys = append(filteredKeys, key)
 		}
 	}
 
+	if c.IsSortHashFields() {
+		sort.Strings(filteredKeys)
+	}
+
 	return filteredKeys, nil
 }
 
 // DGetAll Returns all fields and values of the hash stored at key.
 // In the returned value, every field name is followed by its value,
 // so the length of the reply is twice the size of the hash.
+// Order of fields is undefined, unless sorting of hash fields is enabled.
 // @command HGETALL
+// @complexity O(N) where N is the size of the hash
+// @map
 func (c *Core) DGetAll(key string) (result [][]byte, err error) {
 	item := c.getItem(key)
 	if item == nil {
@@ -311,22 +734,82 @@ func (c *Core) DGetAll(key string) (result [][]byte, err error) {
 
 	dict := item.Dict()
 	result = make([][]byte, 0, 2*len(dict))
-	for k, v := range dict {
+	appendField := func(k string, v []byte) {
 		keyBytes := []byte(k)
 		value := make([]byte, len(v))
 		copy(value, v)
 		result = append(result, keyBytes, value)
 	}
 
+	if !c.IsSortHashFields() {
+		for k, v := range dict {
+			appendField(k, v)
+		}
+
+		return result, nil
+	}
+
+	fields := make([]string, 0, len(dict))
+	for k := range dict {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	for _, k := range fields {
+		appendField(k, dict[k])
+	}
+
 	return result, nil
 }
 
+// DGetAllFunc is a streaming version of DGetAll: instead of copying fields and values,
+// it invokes write with count of fields of the hash stored at key and iterator over fields and values.
+// Values aren't copied, so they are valid only until write returns.
+// The item is locked for modifications until write returns, so write should be fast, e.g. write into a buffer.
+// If key does not exist, write is invoked with zero count. If key holds not a hash, write isn't invoked
+func (c *Core) DGetAllFunc(key string, write func(count int, forEach func(yield func(field string, value []byte)))) error {
+	item := c.getItem(key)
+	if item == nil {
+		write(0, func(yield func(field string, value []byte)) {})
+		return nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != Dict {
+		return ErrWrongType
+	}
+
+	dict := item.Dict()
+	forEach := func(yield func(field string, value []byte)) {
+		if !c.IsSortHashFields() {
+			for k, v := range dict {
+				yield(k, v)
+			}
+			return
+		}
+
+		fields := make([]string, 0, len(dict))
+		for k := range dict {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+		for _, k := range fields {
+			yield(k, dict[k])
+		}
+	}
+
+	write(len(dict), forEach)
+	return nil
+}
+
 // DDel Removes the specified fields from the hash stored at key.
 // Specified fields that do not exist within this hash are ignored.
 // If key does not exist, it is treated as an empty hash and this command returns 0.
 // @command HDEL
+// @complexity O(N) where N is the number of fields
 // @modifying
-func (c *Core) DDel(key string, fields []string) (count int, err error) {
+func (c *Core) DDel(key string, fields []string) (count int64, err error) {
 	item := c.getItem(key)
 	if item == nil {
 		return 0, nil
@@ -347,14 +830,131 @@ func (c *Core) DDel(key string, fields []string) (count int, err error) {
 		}
 	}
 
+	if count > 0 {
+		c.touch(item)
+	}
+
 	return count, nil
 }
 
+// DIncrByFloat Increments the floating point number stored at field in the dict stored at key by the specified increment.
+// If the field or key does not exist, it is set to 0 before performing the operation.
+// Returns the value of field after the increment.
+// @command HINCRBYFLOAT
+// @complexity O(1)
+// @modifying
+func (c *Core) DIncrByFloat(key, field, increment string) (result []byte, err error) {
+	incr, err := parseFloat(increment)
+	if err != nil {
+		return nil, err
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		item = c.created(NewItemDict(map[string][]byte{}))
+		defer func() {
+			if err == nil {
+				c.storage.AddOrReplaceOne(key, item)
+			}
+		}()
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != Dict {
+		return nil, ErrWrongType
+	}
+
+	dict := item.Dict()
+	value, ok := dict[field]
+	if !ok {
+		value = []byte("0")
+	}
+
+	result, err = incrFloatValue(value, incr)
+	if err == ErrNotFloat {
+		return nil, ErrHashNotFloat
+	} else if err != nil {
+		return nil, err
+	}
+
+	dict[field] = result
+	c.touch(item)
+
+	// don't return stored value itself to avoid its modification outside
+	return []byte(string(result)), nil
+}
+
+// DRandField Returns random fields from the dict stored at key.
+// If count is positive, returns up to count distinct fields. If count is negative,
+// returns exactly -count fields, that could be repeated. If withValues is true, every field is followed by its value.
+// If key does not exist, empty result returned. Negative count below -MaxRandFieldCount is rejected with ErrOutOfRange.
+// Isn't featured as command directly, due to reply of HRANDFIELD without count is a single field, not an array
+func (c *Core) DRandField(key string, count int, withValues bool) (result [][]byte, err error) {
+	// compared before negation, so math.MinInt64 doesn't overflow
+	if count < -MaxRandFieldCount {
+		return nil, ErrOutOfRange
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		return [][]byte{}, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != Dict {
+		return nil, ErrWrongType
+	}
+
+	dict := item.Dict()
+	fields := make([]string, 0, len(dict))
+	for field := range dict {
+		fields = append(fields, field)
+	}
+
+	var picked []string
+	switch {
+	case len(fields) == 0 || count == 0:
+		// nothing to pick
+	case count > 0:
+		if count > len(fields) {
+			count = len(fields)
+		}
+		// partial Fisher-Yates shuffle: first count elements are distinct random fields
+		for i := 0; i < count; i++ {
+			j := i + rand.Intn(len(fields)-i)
+			fields[i], fields[j] = fields[j], fields[i]
+		}
+		picked = fields[:count]
+	default:
+		picked = make([]string, -count)
+		for i := range picked {
+			picked[i] = fields[rand.Intn(len(fields))]
+		}
+	}
+
+	result = make([][]byte, 0, 2*len(picked))
+	for _, field := range picked {
+		result = append(result, []byte(field))
+		if withValues {
+			value := make([]byte, len(dict[field]))
+			copy(value, dict[field])
+			result = append(result, value)
+		}
+	}
+
+	return result, nil
+}
+
 // LLen Returns the length of the list stored at key.
 // If key does not exist, it is interpreted as an empty list and 0 is returned.
 // An error is returned when the value stored at key is not a list.
 // @command LLEN
-func (c *Core) LLen(key string) (count int, err error) {
+// @complexity O(1)
+func (c *Core) LLen(key string) (count int64, err error) {
 	item := c.getItem(key)
 	if item == nil {
 		// In Redis, LRange on non-exists key returns empty list, not <nil> aka NotFound
@@ -368,7 +968,7 @@ func (c *Core) LLen(key string) (count int, err error) {
 		return 0, ErrWrongType
 	}
 
-	return len(item.List()), nil
+	return int64(len(item.List())), nil
 }
 
 // LRange returns the specified elements of the list stored at key.
@@ -376,6 +976,7 @@ func (c *Core) LLen(key string) (count int, err error) {
 // These offsets can also be negative numbers indicating offsets starting at the end of the list.
 // For example, -1 is the last element of the list, -2 the penultimate, and so on.
 // @command LRANGE
+// @complexity O(N) where N is the number of returned elements
 func (c *Core) LRange(key string, start, stop int) (result [][]byte, err error) {
 	item := c.getItem(key)
 	if item == nil {
@@ -393,23 +994,8 @@ func (c *Core) LRange(key string, start, stop int) (result [][]byte, err error)
 	list := item.List()
 	lLen := len(list)
 
-	// just return on empty list to avoid further index checks
-	if lLen == 0 {
-		return [][]byte{}, nil
-	}
-
-	if start < 0 {
-		start += lLen
-	}
-	if stop < 0 {
-		stop += lLen
-	}
-
-	start = int(math.Max(float64(start), 0.0))
-	stop = int(math.Min(float64(stop), float64(lLen-1)))
-
-	// after normalizing, next check  also covers start > len(), stop < 0
-	if start > stop {
+	start, stop, ok := normalizeRange(start, stop, lLen)
+	if !ok {
 		return [][]byte{}, nil
 	}
 
@@ -442,6 +1028,7 @@ func (c *Core) LRange(key string, start, stop int) (result [][]byte, err error)
 // Here, -1 means the last element, -2 means the penultimate and so forth.
 // When the value at key is not a list, an error is returned.
 // @command LINDEX
+// @complexity O(1)
 func (c *Core) LIndex(key string, index int) (result []byte, err error) {
 	item := c.getItem(key)
 	if item == nil {
@@ -478,29 +1065,133 @@ func (c *Core) LIndex(key string, index int) (result []byte, err error) {
 	return result, nil
 }
 
-// LSet Sets the list element at index to value.
-// The index is zero-based, 0 points to HEAD of the list.
-// Negative indices can be used to designate elements starting at the tail of the list.
-// Here, -1 means the last element, -2 means the penultimate and so forth.
-// An error is returned for out of range indexes.
-// @command LSET
-// @modifying
-func (c *Core) LSet(key string, index int, value []byte) (err error) {
-	item := c.getItem(key)
-	if item == nil {
-		// LSet replaces only existing element, but we can't sent ErrNotFound due to it returns <nil> instead Err No such Key
-		return ErrNoSuchKey
+// LPos Returns the index of the first element equal to element in the list stored at key.
+// RANK rank option returns the rank-th match, negative rank searches from the tail: -1 is the last match and so forth.
+// COUNT num option returns indices of num matches, in order of search, or of all matches if num is 0.
+// Indices are zero-based, 0 points to HEAD of the list, regardless of the search direction.
+// Without COUNT option the result is a single index or ErrNotFound, if there are no matches.
+// @command LPOS
+// @complexity O(N) where N is the length of the list
+// @optional
+// @countoption 2
+func (c *Core) LPos(key string, element []byte, options []string) (positions []int, err error) {
+	var (
+		rank  = 1
+		count = -1
+	)
+
+	for i := 0; i < len(options); i++ {
+		switch strings.ToUpper(options[i]) {
+		case "RANK":
+			if i+1 >= len(options) {
+				return nil, ErrSyntax
+			}
+			if rank, err = strconv.Atoi(options[i+1]); err != nil {
+				return nil, ErrNotInt
+			}
+			if rank == 0 {
+				return nil, ErrRankZero
+			}
+			i++
+		case "COUNT":
+			if i+1 >= len(options) {
+				return nil, ErrSyntax
+			}
+			if count, err = strconv.Atoi(options[i+1]); err != nil {
+				return nil, ErrNotInt
+			}
+			if count < 0 {
+				return nil, ErrNegCount
+			}
+			i++
+		default:
+			return nil, ErrSyntax
+		}
 	}
 
-	item.Lock()
-	defer item.Unlock()
+	positions, err = c.listPositions(key, element, rank, count)
+	if err != nil {
+		return nil, err
+	}
 
-	if item.kind != List {
-		return ErrWrongType
+	if count < 0 {
+		if len(positions) == 0 {
+			return nil, ErrNotFound
+		}
+		return positions[:1], nil
 	}
 
-	list := item.List()
-	lLen := len(list)
+	return positions, nil
+}
+
+// listPositions returns indices of count elements equal to element, skipping first |rank|-1 matches.
+// Negative count means a single match, zero count means all of them.
+func (c *Core) listPositions(key string, element []byte, rank, count int) (positions []int, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return []int{}, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != List {
+		return nil, ErrWrongType
+	}
+
+	list := item.List()
+	lLen := len(list)
+
+	//IMPORTANT: by proto, HEAD of the list has index 0, but in the slice storage it is the LAST element of the slice,
+	// so search from the HEAD walks the slice backwards
+	sliceIndex, step := lLen-1, -1
+	if rank < 0 {
+		sliceIndex, step, rank = 0, 1, -rank
+	}
+
+	positions = []int{}
+	for ; 0 <= sliceIndex && sliceIndex < lLen; sliceIndex += step {
+		if !bytes.Equal(list[sliceIndex], element) {
+			continue
+		}
+
+		if rank--; rank > 0 {
+			continue
+		}
+
+		positions = append(positions, lLen-1-sliceIndex)
+		if count < 0 || count > 0 && len(positions) == count {
+			break
+		}
+	}
+
+	return positions, nil
+}
+
+// LSet Sets the list element at index to value.
+// The index is zero-based, 0 points to HEAD of the list.
+// Negative indices can be used to designate elements starting at the tail of the list.
+// Here, -1 means the last element, -2 means the penultimate and so forth.
+// An error is returned for out of range indexes.
+// @command LSET
+// @complexity O(1)
+// @modifying
+func (c *Core) LSet(key string, index int, value []byte) (err error) {
+	item := c.getItem(key)
+	if item == nil {
+		// LSet replaces only existing element, but we can't sent ErrNotFound due to it returns <nil> instead Err No such Key
+		return ErrNoSuchKey
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != List {
+		return ErrWrongType
+	}
+
+	list := item.List()
+	lLen := len(list)
 
 	if index < 0 {
 		index += lLen
@@ -515,6 +1206,7 @@ func (c *Core) LSet(key string, index int, value []byte) (err error) {
 	sliceIndex := lLen - 1 - index
 
 	list[sliceIndex] = value
+	c.touch(item)
 
 	return nil
 }
@@ -526,11 +1218,95 @@ func (c *Core) LSet(key string, index int, value []byte) (err error) {
 // from the leftmost element to the rightmost element.
 // So for instance the command LPush("mylist",  []byte[a b c]) will result into a list containing [c, b, a]
 // @command LPUSH
+// @complexity O(N) where N is the number of pushed values
+// @modifying
+func (c *Core) LPush(key string, values [][]byte) (count int64, err error) {
+	return c.lPush(key, values, 0, false, 0)
+}
+
+// LPushEx Inserts all the specified values at the head of the list stored at key and sets key to timeout after a given number of seconds.
+// Values are inserted like by LPush, so a volatile list is created by a single command. TTL is set on every call, like SETEX does.
+// Like SETEX, requests with ttl <= 0 are rejected. On WAL replay, TTL is counted from the moment of the request.
+// Direct call with ttl <= 0 leads to deleting the key
+// @command LPUSHEX
+// @complexity O(N) where N is the number of pushed values
+// @modifying
+// @ttl 1
+// @positivettl
+func (c *Core) LPushEx(key string, seconds int, values [][]byte) (count int64, err error) {
+	if seconds <= 0 {
+		//item expired before set, just remove it
+		c.Del([]string{key})
+		return 0, nil
+	}
+
+	return c.lPush(key, values, 0, false, seconds)
+}
+
+// LPushCapped Inserts all the specified values at the head of the list stored at key, keeping length of the list within maxLen.
+// Values are inserted like by LPush. If the list would grow over maxLen, policy TRIM removes elements from the tail, like a circular buffer,
+// and policy ERROR rejects the whole push with ErrListFull. Zero maxLen disables the limit.
+// Returns the length of the list after the push
+// @command LPUSHCAP
+// @complexity O(N) where N is the number of pushed values, O(M) with M max length when the list is trimmed
+// @modifying
+// @minargs 4
+func (c *Core) LPushCapped(key string, maxLen int, policy string, values [][]byte) (count int64, err error) {
+	trim, err := parseListCapPolicy(maxLen, policy)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.lPush(key, values, maxLen, trim, 0)
+}
+
+// LPushCappedEx Inserts all the specified values at the head of the list stored at key, keeping length of the list within maxLen,
+// and sets key to timeout after a given number of seconds. It's LPushCapped with TTL like LPushEx
+// @command LPUSHCAPEX
+// @complexity O(N) where N is the number of pushed values, O(M) with M max length when the list is trimmed
 // @modifying
-func (c *Core) LPush(key string, values [][]byte) (count int, err error) {
+// @minargs 5
+// @ttl 1
+// @positivettl
+func (c *Core) LPushCappedEx(key string, seconds int, maxLen int, policy string, values [][]byte) (count int64, err error) {
+	trim, err := parseListCapPolicy(maxLen, policy)
+	if err != nil {
+		return 0, err
+	}
+	if seconds <= 0 {
+		//item expired before set, just remove it
+		c.Del([]string{key})
+		return 0, nil
+	}
+
+	return c.lPush(key, values, maxLen, trim, seconds)
+}
+
+// parseListCapPolicy validates list length limit and returns true, if policy is TRIM
+func parseListCapPolicy(maxLen int, policy string) (trim bool, err error) {
+	if maxLen < 0 {
+		return false, ErrSyntax
+	}
+
+	switch strings.ToUpper(policy) {
+	case "TRIM":
+		return true, nil
+	case "ERROR":
+		return false, nil
+	default:
+		return false, ErrSyntax
+	}
+}
+
+// lPush inserts values at the head of the list stored at key. Non-zero maxLen limits length of the list:
+// the tail is trimmed, if trim is true, otherwise the push is rejected with ErrListFull. Positive seconds sets TTL of the key
+func (c *Core) lPush(key string, values [][]byte, maxLen int, trim bool, seconds int) (count int64, err error) {
 	item := c.getItem(key)
 	if item == nil {
-		item = NewItemList([][]byte{})
+		if maxLen > 0 && len(values) > maxLen && !trim {
+			return 0, ErrListFull
+		}
+		item = c.created(NewItemList([][]byte{}))
 		defer func() {
 			c.storage.AddOrReplaceOne(key, item)
 		}()
@@ -544,15 +1320,27 @@ func (c *Core) LPush(key string, values [][]byte) (count int, err error) {
 	}
 
 	list := item.List()
+	if maxLen > 0 && len(list)+len(values) > maxLen && !trim {
+		return 0, ErrListFull
+	}
 
 	list = append(list, values...)
+	if maxLen > 0 && len(list) > maxLen {
+		// tail of the list is the beginning of the slice
+		list = append(list[:0:0], list[len(list)-maxLen:]...)
+	}
 	item.SetList(list)
+	if seconds > 0 {
+		item.SetExpireAt(c.now().Add(time.Duration(seconds) * time.Second))
+	}
+	c.touch(item)
 
-	return len(list), nil
+	return int64(len(list)), nil
 }
 
 // LPop Removes and returns the first element of the list stored at key.
 // @command LPOP
+// @complexity O(1)
 // @modifying
 func (c *Core) LPop(key string) (result []byte, err error) {
 	item := c.getItem(key)
@@ -577,13 +1365,174 @@ func (c *Core) LPop(key string) (result []byte, err error) {
 	result = list[len(list)-1]
 	list = list[:len(list)-1]
 	item.SetList(list)
+	c.touch(item)
+
+	return result, nil
+}
+
+// Sort Returns the elements of the list stored at key, sorted as numbers in ascending order.
+// ALPHA option sorts elements lexicographically, DESC option sorts them in descending order.
+// LIMIT offset count option returns count elements, starting from offset, like LRANGE does; negative count means all of them.
+// STORE destination option replaces the destination with the list of sorted elements,
+// or removes it, if the result is empty. In this case the reply is the count of stored elements.
+// The stored list isn't changed by SORT.
+// @command SORT
+// @complexity O(N+M*log(M)) where N is the length of the list and M is the number of returned elements
+// @optional
+// @storeoption 1
+func (c *Core) Sort(key string, options []string) (result [][]byte, err error) {
+	var (
+		alpha, desc    bool
+		offset         = 0
+		count          = -1
+		destKey, store = "", false
+	)
+
+	for i := 0; i < len(options); i++ {
+		switch strings.ToUpper(options[i]) {
+		case "ALPHA":
+			alpha = true
+		case "ASC":
+			desc = false
+		case "DESC":
+			desc = true
+		case "LIMIT":
+			if i+2 >= len(options) {
+				return nil, ErrSyntax
+			}
+			if offset, err = strconv.Atoi(options[i+1]); err != nil {
+				return nil, ErrNotInt
+			}
+			if count, err = strconv.Atoi(options[i+2]); err != nil {
+				return nil, ErrNotInt
+			}
+			i += 2
+		case "STORE":
+			if i+1 >= len(options) {
+				return nil, ErrSyntax
+			}
+			destKey, store = options[i+1], true
+			i++
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	result, err = c.listCopy(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = sortList(result, alpha, desc); err != nil {
+		return nil, err
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(result) {
+		offset = len(result)
+	}
+	result = result[offset:]
+	if count >= 0 && count < len(result) {
+		result = result[:count]
+	}
+
+	if !store {
+		return result, nil
+	}
+
+	if len(result) == 0 {
+		c.storage.Del([]string{destKey})
+		return result, nil
+	}
+
+	// IMPORTANT: HEAD of the list is the LAST element of the slice
+	list := make([][]byte, len(result))
+	for i, v := range result {
+		list[len(result)-1-i] = v
+	}
+	c.storage.AddOrReplaceOne(destKey, c.created(NewItemList(list)))
+
+	return result, nil
+}
+
+// listCopy returns a copy of elements of the list stored at key, starting from HEAD.
+// Not existing key is interpreted as an empty list
+func (c *Core) listCopy(key string) (result [][]byte, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return [][]byte{}, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != List {
+		return nil, ErrWrongType
+	}
+
+	list := item.List()
+	result = make([][]byte, len(list))
+	for i, v := range list {
+		resultI := len(list) - 1 - i
+		result[resultI] = make([]byte, len(v))
+		copy(result[resultI], v)
+	}
 
 	return result, nil
 }
 
+// sortList sorts elements in place as numbers or, if alpha is true, lexicographically.
+// Elements with equal numeric values are ordered lexicographically to make the order deterministic
+func sortList(elements [][]byte, alpha, desc bool) error {
+	if alpha {
+		sort.Slice(elements, func(i, j int) bool { return bytes.Compare(elements[i], elements[j]) < 0 })
+	} else {
+		scores := make([]float64, len(elements))
+		for i, v := range elements {
+			score, err := parseFloat(string(v))
+			if err != nil {
+				return ErrSortNotFloat
+			}
+			scores[i] = score
+		}
+		sort.Sort(scoredElements{elements: elements, scores: scores})
+	}
+
+	if desc {
+		for i, j := 0, len(elements)-1; i < j; i, j = i+1, j-1 {
+			elements[i], elements[j] = elements[j], elements[i]
+		}
+	}
+
+	return nil
+}
+
+// scoredElements sorts elements by their numeric values
+type scoredElements struct {
+	elements [][]byte
+	scores   []float64
+}
+
+func (s scoredElements) Len() int { return len(s.elements) }
+
+func (s scoredElements) Less(i, j int) bool {
+	if s.scores[i] != s.scores[j] {
+		return s.scores[i] < s.scores[j]
+	}
+	return bytes.Compare(s.elements[i], s.elements[j]) < 0
+}
+
+func (s scoredElements) Swap(i, j int) {
+	s.elements[i], s.elements[j] = s.elements[j], s.elements[i]
+	s.scores[i], s.scores[j] = s.scores[j], s.scores[i]
+}
+
 // Ttl Returns the remaining time to live of a key that has a timeout.
 // If key not found, return error, if key found, but has no setted TTL, return -1
 // @command TTL
+// @complexity O(1)
 func (c *Core) Ttl(key string) (ttl int, err error) {
 	item := c.getItem(key)
 	if item == nil {
@@ -601,51 +1550,107 @@ func (c *Core) Ttl(key string) (ttl int, err error) {
 	return item.Ttl(), nil
 }
 
+// ExpireTime Returns the absolute Unix time in seconds, at which the key will expire.
+// If key not found, return -2, if key found, but has no setted TTL, return -1
+// @command EXPIRETIME
+// @complexity O(1)
+func (c *Core) ExpireTime(key string) (timestamp int64, err error) {
+	milliseconds := c.expireTime(key)
+	if milliseconds < 0 {
+		return milliseconds, nil
+	}
+
+	// round value, like Redis does
+	return (milliseconds + 500) / 1000, nil
+}
+
+// PExpireTime Returns the absolute Unix time in milliseconds, at which the key will expire.
+// If key not found, return -2, if key found, but has no setted TTL, return -1
+// @command PEXPIRETIME
+// @complexity O(1)
+func (c *Core) PExpireTime(key string) (timestamp int64, err error) {
+	return c.expireTime(key), nil
+}
+
+// expireTime returns Unix time in milliseconds, at which the key will expire, -1 if it has no TTL or -2 if it's not found
+func (c *Core) expireTime(key string) int64 {
+	item := c.getItem(key)
+	if item == nil {
+		return -2
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if !item.HasTtl() {
+		return -1
+	}
+
+	return item.ExpireAt().UnixNano() / int64(time.Millisecond)
+}
+
 // Expire sets a timeout on key. After the timeout has expired, the key will automatically be deleted.
 // Note that calling EXPIRE with a non-positive timeout will result in the key being deleted rather than expired
 // @command EXPIRE
+// @complexity O(1)
 // @modifying
 // @ttl 1
 func (c *Core) Expire(key string, seconds int) (result int) {
-	item := c.getItem(key)
-	if item == nil {
-		return 0
-	}
-
 	if seconds <= 0 {
+		if c.getItem(key) == nil {
+			return 0
+		}
 		c.Del([]string{key})
 		return 1
 	}
 
-	item.Lock()
+	item := c.lockItemTtl(key)
+	if item == nil {
+		return 0
+	}
 	defer item.Unlock()
 
 	// check IsExpired() one more time inside the critical section, to avoid updating TTL
 	// for item, that already prepared to removal by CollectExpired()
-	if item.IsExpired() {
+	if c.isExpired(item) {
 		return 0
 	}
 
-	item.SetTtl(seconds)
+	item.SetExpireAt(c.now().Add(time.Duration(seconds) * time.Second))
+	c.touch(item)
 
 	return 1
 }
 
+// Type Returns the string representation of the type of the value stored at key:
+// string, list, hash or zset. If key does not exist, none is returned.
+// @command TYPE
+// @complexity O(1)
+// @status
+func (c *Core) Type(key string) (result string) {
+	item := c.getItem(key)
+	if item == nil {
+		return "none"
+	}
+
+	return item.TypeName()
+}
+
 // Persist Removes the existing timeout on key.
+// Returns 1, if the timeout was removed, and 0, if the key doesn't exist or has no timeout
 // @command PERSIST
+// @complexity O(1)
 // @modifying
 func (c *Core) Persist(key string) (result int) {
-	item := c.getItem(key)
+	item := c.lockItemTtl(key)
 	if item == nil {
 		return 0
 	}
-
-	item.Lock()
 	defer item.Unlock()
 
 	// check IsExpired() one more time inside the critical section, to avoid updating TTL
 	// for item, that already prepared to removal by CollectExpired()
-	if item.IsExpired() {
+	if c.isExpired(item) {
 		return 0
 	}
 
@@ -654,25 +1659,1233 @@ func (c *Core) Persist(key string) (result int) {
 	}
 
 	item.RemoveTtl()
+	c.touch(item)
 
 	return 1
 }
 
-// Storage returns reference to underlying storage to persisting
-// Except Storage, Core is stateless by design, so it's enough to persist Storage to save all Core state
-func (c *Core) Storage() Storage {
-	return c.storage
+// GetRange Returns the substring of the string value stored at key, determined by the offsets start and end (both are inclusive).
+// Negative offsets can be used in order to provide an offset starting from the end of the string.
+// So -1 means the last character, -2 the penultimate and so forth.
+// If key does not exist, it is interpreted as an empty string.
+// @command GETRANGE
+// @complexity O(N) where N is the length of the returned string
+func (c *Core) GetRange(key string, start, end int) (result []byte, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return []byte{}, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != Bytes {
+		return nil, ErrWrongType
+	}
+
+	bytes := item.Bytes()
+	start, end, ok := normalizeRange(start, end, len(bytes))
+	if !ok {
+		return []byte{}, nil
+	}
+
+	result = make([]byte, end-start+1)
+	copy(result, bytes[start:end+1])
+
+	return result, nil
 }
 
-// SetStorage sets storage storage after loading
-// Except Storage, Core is stateless by design, so it's enough to persist Storage to save all Core state
-func (c *Core) SetStorage(storage Storage) {
-	c.storage = storage
+// SetRange Overwrites part of the string stored at key, starting at the specified offset, for the entire length of value.
+// If the offset is larger than the current length of the string, the string is padded with zero-bytes to make offset fit.
+// If key does not exist, it is interpreted as an empty string.
+// Returns the length of the string after it was modified.
+// @command SETRANGE
+// @complexity O(1), not counting the time taken to copy the new string in place
+// @modifying
+func (c *Core) SetRange(key string, offset int, value []byte) (length int64, err error) {
+	if offset < 0 {
+		return 0, ErrOffsetRange
+	}
+	if offset+len(value) > MaxBytesLength {
+		return 0, ErrTooLong
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		if len(value) == 0 {
+			// like in Redis, don't create empty string
+			return 0, nil
+		}
+
+		item = c.created(NewItemBytes([]byte{}))
+		defer func() {
+			c.storage.AddOrReplaceOne(key, item)
+		}()
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != Bytes {
+		return 0, ErrWrongType
+	}
+
+	if len(value) == 0 {
+		return int64(len(item.Bytes())), nil
+	}
+
+	bytes := item.mutableBytes(offset + len(value))
+	copy(bytes[offset:], value)
+	c.touch(item)
+
+	return int64(len(bytes)), nil
 }
 
-// warning: it could affect performance due to extra mutex lock.
-// if it makes perf. penalty, move  IsExpired() check inside existing Lock() in every API func
-func (c *Core) getItem(key string) *Item {
+// SetBit Sets or clears the bit at offset in the string value stored at key and returns the original bit value.
+// Bits are numbered from the most significant bit of the first byte.
+// The string is grown to make sure it can hold a bit at offset, new bytes are zero-padded.
+// If key does not exist, a new string value is created.
+// @command SETBIT
+// @complexity O(1)
+// @modifying
+func (c *Core) SetBit(key string, offset, value int) (result int, err error) {
+	if offset < 0 || offset/8 >= MaxBytesLength {
+		return 0, ErrBitOffset
+	}
+	if value != 0 && value != 1 {
+		return 0, ErrBitValue
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		item = c.created(NewItemBytes([]byte{}))
+		defer func() {
+			c.storage.AddOrReplaceOne(key, item)
+		}()
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != Bytes {
+		return 0, ErrWrongType
+	}
+
+	byteIndex := offset / 8
+	bytes := item.mutableBytes(byteIndex + 1)
+
+	mask := byte(0x80) >> uint(offset%8)
+	if bytes[byteIndex]&mask != 0 {
+		result = 1
+	}
+
+	if value == 1 {
+		bytes[byteIndex] |= mask
+	} else {
+		bytes[byteIndex] &^= mask
+	}
+	c.touch(item)
+
+	return result, nil
+}
+
+// GetBit Returns the bit value at offset in the string value stored at key.
+// When offset is beyond the string length or key does not exist, 0 returned.
+// @command GETBIT
+// @complexity O(1)
+func (c *Core) GetBit(key string, offset int) (result int, err error) {
+	if offset < 0 || offset/8 >= MaxBytesLength {
+		return 0, ErrBitOffset
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != Bytes {
+		return 0, ErrWrongType
+	}
+
+	bytes := item.Bytes()
+	byteIndex := offset / 8
+	if byteIndex >= len(bytes) {
+		return 0, nil
+	}
+
+	if bytes[byteIndex]&(byte(0x80)>>uint(offset%8)) != 0 {
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// BitCount Counts the number of set bits in the string value stored at key.
+// Optional bounds are start and end bytes of the range, that could be negative like in LRANGE.
+// If key does not exist, it is interpreted as an empty string and 0 is returned.
+// @command BITCOUNT
+// @complexity O(N) where N is the length of the counted range
+// @optional
+func (c *Core) BitCount(key string, bounds []int) (count int64, err error) {
+	if len(bounds) != 0 && len(bounds) != 2 {
+		return 0, ErrSyntax
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != Bytes {
+		return 0, ErrWrongType
+	}
+
+	bytes := item.Bytes()
+	if len(bounds) == 2 {
+		start, stop, ok := normalizeRange(bounds[0], bounds[1], len(bytes))
+		if !ok {
+			return 0, nil
+		}
+		bytes = bytes[start : stop+1]
+	}
+
+	for _, b := range bytes {
+		count += int64(bits.OnesCount8(b))
+	}
+
+	return count, nil
+}
+
+// BitField Performs GET, SET and INCRBY operations over integers of arbitrary width, stored in the string at key.
+// GET type offset reads, SET type offset value writes and INCRBY type offset increment increments the integer.
+// Type is i1..i64 for signed or u1..u63 for unsigned integers, offset is a bit offset or #N for N-th integer of the type.
+// OVERFLOW WRAP|SAT|FAIL changes overflow handling of following SET and INCRBY: wrap around, saturate to min or max value,
+// or skip the operation, that is replied by nil. WRAP is the default.
+// Returns value of GET, old value of SET and new value of INCRBY for every operation.
+// The string is grown to hold all bits, written by SET and INCRBY, new bytes are zero-padded.
+// GET of not existing key reads zeroes and doesn't create the key.
+// @command BITFIELD
+// @complexity O(1) for each subcommand
+// @modifying
+// @optional
+func (c *Core) BitField(key string, operations []string) (result []*int64, err error) {
+	ops, err := parseBitFieldOps(operations)
+	if err != nil {
+		return nil, err
+	}
+
+	// like in Redis, the string is grown before execution, even if writes fail by overflow
+	writeLength := int64(0)
+	for _, op := range ops {
+		if op.name != "GET" && op.end() > writeLength {
+			writeLength = op.end()
+		}
+	}
+
+	result = make([]*int64, len(ops))
+
+	item := c.getItem(key)
+	if item == nil {
+		if writeLength == 0 {
+			for i := range result {
+				result[i] = new(int64)
+			}
+			return result, nil
+		}
+
+		item = c.created(NewItemBytes([]byte{}))
+		defer func() {
+			c.storage.AddOrReplaceOne(key, item)
+		}()
+	}
+
+	if writeLength == 0 {
+		item.RLock()
+		defer item.RUnlock()
+	} else {
+		item.Lock()
+		defer item.Unlock()
+	}
+
+	if item.kind != Bytes {
+		return nil, ErrWrongType
+	}
+
+	bytes := item.Bytes()
+	if writeLength > 0 {
+		bytes = item.mutableBytes(int(writeLength))
+	}
+
+	for i, op := range ops {
+		value := op.get(bytes)
+		switch op.name {
+		case "GET":
+			result[i] = &value
+		case "SET":
+			newValue, ok := op.limit(op.value, 0)
+			if !ok {
+				continue
+			}
+			op.set(bytes, newValue)
+			result[i] = &value
+		case "INCRBY":
+			newValue, ok := op.limit(value, op.value)
+			if !ok {
+				continue
+			}
+			op.set(bytes, newValue)
+			result[i] = &newValue
+		}
+	}
+
+	if writeLength > 0 {
+		c.touch(item)
+	}
+
+	return result, nil
+}
+
+// bitFieldOp is a single GET, SET or INCRBY operation of BITFIELD
+type bitFieldOp struct {
+	name   string
+	signed bool
+	width  uint
+	offset int64
+	// value is a value of SET or an increment of INCRBY
+	value int64
+	// overflow is WRAP, SAT or FAIL
+	overflow string
+}
+
+// parseBitFieldOps parses all BITFIELD operations before execution, so invalid request changes nothing
+func parseBitFieldOps(args []string) (ops []bitFieldOp, err error) {
+	overflow := "WRAP"
+	for i := 0; i < len(args); {
+		name := strings.ToUpper(args[i])
+
+		argsCount := 0
+		switch name {
+		case "OVERFLOW":
+			argsCount = 1
+		case "GET":
+			argsCount = 2
+		case "SET", "INCRBY":
+			argsCount = 3
+		default:
+			return nil, ErrSyntax
+		}
+		if i+argsCount >= len(args) {
+			return nil, ErrSyntax
+		}
+
+		if name == "OVERFLOW" {
+			overflow = strings.ToUpper(args[i+1])
+			if overflow != "WRAP" && overflow != "SAT" && overflow != "FAIL" {
+				return nil, ErrOverflowType
+			}
+			i += 2
+			continue
+		}
+
+		op := bitFieldOp{name: name, overflow: overflow}
+		if err := op.parseType(args[i+1]); err != nil {
+			return nil, err
+		}
+		if err := op.parseOffset(args[i+2]); err != nil {
+			return nil, err
+		}
+		if name != "GET" {
+			if op.value, err = strconv.ParseInt(args[i+3], 10, 64); err != nil {
+				return nil, ErrNotInt
+			}
+		}
+
+		ops = append(ops, op)
+		i += argsCount + 1
+	}
+
+	return ops, nil
+}
+
+// parseType parses type like i8 or u16
+func (op *bitFieldOp) parseType(t string) error {
+	if len(t) < 2 || (t[0] != 'i' && t[0] != 'I' && t[0] != 'u' && t[0] != 'U') {
+		return ErrBitFieldType
+	}
+
+	width, err := strconv.Atoi(t[1:])
+	op.signed = t[0] == 'i' || t[0] == 'I'
+	if err != nil || width < 1 || width > 64 || !op.signed && width > 63 {
+		return ErrBitFieldType
+	}
+	op.width = uint(width)
+
+	return nil
+}
+
+// parseOffset parses bit offset or #N offset, that is multiplied by width of the type
+func (op *bitFieldOp) parseOffset(offset string) (err error) {
+	multiplier := int64(1)
+	if strings.HasPrefix(offset, "#") {
+		multiplier = int64(op.width)
+		offset = offset[1:]
+	}
+
+	op.offset, err = strconv.ParseInt(offset, 10, 64)
+	if err != nil || op.offset < 0 || op.offset > int64(MaxBytesLength)*8/multiplier {
+		return ErrBitOffset
+	}
+	op.offset *= multiplier
+	if op.end() > int64(MaxBytesLength) {
+		return ErrBitOffset
+	}
+
+	return nil
+}
+
+// end returns length of the string in bytes, that holds the integer
+func (op bitFieldOp) end() int64 {
+	return (op.offset + int64(op.width) + 7) / 8
+}
+
+// get reads the integer. Bits beyond the string are zeroes
+func (op bitFieldOp) get(bytes []byte) int64 {
+	var value uint64
+	for bit := op.offset; bit < op.offset+int64(op.width); bit++ {
+		value <<= 1
+		if byteIndex := bit / 8; byteIndex < int64(len(bytes)) && bytes[byteIndex]&(byte(0x80)>>uint(bit%8)) != 0 {
+			value |= 1
+		}
+	}
+
+	return op.wrap(int64(value))
+}
+
+// set writes the lowest width bits of the value. The string must be long enough
+func (op bitFieldOp) set(bytes []byte, value int64) {
+	for i := uint(0); i < op.width; i++ {
+		bit := op.offset + int64(i)
+		mask := byte(0x80) >> uint(bit%8)
+		if uint64(value)&(1<<(op.width-1-i)) != 0 {
+			bytes[bit/8] |= mask
+		} else {
+			bytes[bit/8] &^= mask
+		}
+	}
+}
+
+// wrap truncates the value to width bits and sign-extends it for signed type
+func (op bitFieldOp) wrap(value int64) int64 {
+	if op.width == 64 {
+		return value
+	}
+
+	wrapped := uint64(value) & (1<<op.width - 1)
+	if op.signed && wrapped&(1<<(op.width-1)) != 0 {
+		wrapped |= math.MaxUint64 << op.width
+	}
+
+	return int64(wrapped)
+}
+
+// limit returns value+increment, handled by overflow policy of the operation, or false, if the operation fails.
+// Like in Redis, negative SET value of unsigned type is an overflow, not an underflow
+func (op bitFieldOp) limit(value, increment int64) (result int64, ok bool) {
+	var min, max int64
+	if op.signed {
+		max = math.MaxInt64 >> (64 - op.width)
+		min = -max - 1
+	} else {
+		max = math.MaxInt64 >> (63 - op.width)
+	}
+
+	sum := value + increment
+	switch {
+	case increment > 0 && sum < value, sum > max, !op.signed && increment == 0 && sum < 0:
+		result = max
+	case increment < 0 && sum > value, sum < min:
+		result = min
+	default:
+		return sum, true
+	}
+
+	switch op.overflow {
+	case "WRAP":
+		return op.wrap(sum), true
+	case "SAT":
+		return result, true
+	default:
+		return 0, false
+	}
+}
+
+// BitOp Performs a bitwise operation AND, OR, XOR or NOT between strings stored at keys and stores the result in destKey.
+// NOT takes exactly one source key. Shorter strings and not existing keys are treated as zero-padded strings.
+// Returns length of the result, that is equal to the length of the longest source string.
+// If the result is empty, destKey is removed.
+// @command BITOP
+// @complexity O(N) where N is the length of the longest string
+// @modifying
+func (c *Core) BitOp(operation, destKey string, keys []string) (length int64, err error) {
+	operation = strings.ToUpper(operation)
+	switch operation {
+	case "AND", "OR", "XOR":
+		//ok
+	case "NOT":
+		if len(keys) != 1 {
+			return 0, ErrBitOpNot
+		}
+	default:
+		return 0, ErrSyntax
+	}
+
+	result, err := c.bitOp(operation, keys)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(result) == 0 {
+		c.storage.Del([]string{destKey})
+		return 0, nil
+	}
+
+	c.storage.AddOrReplaceOne(destKey, c.created(NewItemBytes(result)))
+
+	return int64(len(result)), nil
+}
+
+// bitOp applies bitwise operation to Bytes values stored at keys and returns the result as a new slice
+func (c *Core) bitOp(operation string, keys []string) (result []byte, err error) {
+	submap := c.storage.GetSubmap(keys)
+
+	// lock items in the sorted keys order to avoid deadlocks with other multi-key operations
+	sortedKeys := make([]string, 0, len(submap))
+	for key := range submap {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	values := make(map[string][]byte, len(submap))
+	maxLen := 0
+	for _, key := range sortedKeys {
+		item := submap[key]
+		item.RLock()
+		defer item.RUnlock()
+
+		if c.isExpired(item) {
+			continue
+		}
+		if item.kind != Bytes {
+			return nil, ErrWrongType
+		}
+
+		item.Access()
+		values[key] = item.Bytes()
+		maxLen = int(math.Max(float64(maxLen), float64(len(item.Bytes()))))
+	}
+
+	result = make([]byte, maxLen)
+	for i, key := range keys {
+		value := values[key]
+		for j := range result {
+			var b byte
+			if j < len(value) {
+				b = value[j]
+			}
+
+			switch {
+			case operation == "NOT":
+				result[j] = ^b
+			case i == 0:
+				result[j] = b
+			case operation == "AND":
+				result[j] &= b
+			case operation == "OR":
+				result[j] |= b
+			case operation == "XOR":
+				result[j] ^= b
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Dump Serializes the value stored at key in a Radish-specific format, that could be restored by RESTORE.
+// Serialized value doesn't contain TTL.
+// @command DUMP
+// @complexity O(N) where N is the size of the value
+func (c *Core) Dump(key string) (result []byte, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return nil, ErrNotFound
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	return item.Dump()
+}
+
+// Restore Creates a key associated with a value, obtained by deserializing the serialized value, produced by DUMP.
+// If milliseconds is 0, the key is created without any expire, otherwise the specified expire time is set.
+// Negative milliseconds means, that key already expired, so it just removed.
+// Fails with ErrBusyKey, if the key already exists, unless REPLACE option is given.
+// @command RESTORE
+// @complexity O(N) where N is the size of the value
+// @modifying
+// @pttl 1
+// @optional
+func (c *Core) Restore(key string, milliseconds int, value []byte, options []string) (err error) {
+	replace := false
+	for _, option := range options {
+		if strings.ToUpper(option) != "REPLACE" {
+			return ErrSyntax
+		}
+		replace = true
+	}
+
+	item, err := NewItemFromDump(value)
+	if err != nil {
+		return err
+	}
+	c.created(item)
+
+	if !replace && c.getItem(key) != nil {
+		return ErrBusyKey
+	}
+
+	if milliseconds < 0 {
+		c.Del([]string{key})
+		return nil
+	}
+	if milliseconds > 0 {
+		item.SetExpireAt(c.now().Add(time.Duration(milliseconds) * time.Millisecond))
+	}
+
+	c.storage.AddOrReplaceOne(key, item)
+
+	return nil
+}
+
+// ZAdd Adds all the specified members with the specified scores to the sorted set stored at key.
+// Arguments are pairs of score and member. If a specified member is already a member of the sorted set,
+// the score is updated and the element reinserted at the right position to ensure the correct ordering.
+// Returns the number of elements added to the sorted set, not including elements already existing for which the score was updated.
+// @command ZADD
+// @complexity O(M*N) where M is the number of added members and N is the size of the sorted set
+// @modifying
+// @minargs 3
+func (c *Core) ZAdd(key string, scoreMembers []string) (count int64, err error) {
+	if len(scoreMembers) == 0 || len(scoreMembers)%2 != 0 {
+		return 0, ErrSyntax
+	}
+
+	// parse all scores before modification to add all members or nothing
+	scores := make([]float64, len(scoreMembers)/2)
+	for i := range scores {
+		if scores[i], err = parseFloat(scoreMembers[2*i]); err != nil {
+			return 0, err
+		}
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		item = c.created(NewItemSortedSet(map[string]float64{}))
+		defer func() {
+			c.storage.AddOrReplaceOne(key, item)
+		}()
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != SortedSet {
+		return 0, ErrWrongType
+	}
+
+	for i, score := range scores {
+		if item.zset.Add(scoreMembers[2*i+1], score) {
+			count++
+		}
+	}
+	c.touch(item)
+
+	return count, nil
+}
+
+// ZScore Returns the score of member in the sorted set at key.
+// If member does not exist in the sorted set, or key does not exist, ErrNotFound returned.
+// @command ZSCORE
+// @complexity O(1)
+func (c *Core) ZScore(key, member string) (result []byte, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return nil, ErrNotFound
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != SortedSet {
+		return nil, ErrWrongType
+	}
+
+	score, ok := item.zset.Score(member)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return formatScore(score), nil
+}
+
+// ZCard Returns the number of elements of the sorted set stored at key.
+// If key does not exist, it is interpreted as an empty sorted set and 0 is returned.
+// @command ZCARD
+// @complexity O(1)
+func (c *Core) ZCard(key string) (count int64, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != SortedSet {
+		return 0, ErrWrongType
+	}
+
+	return int64(item.zset.Len()), nil
+}
+
+// ZRank Returns the zero-based rank of member in the sorted set stored at key, with the scores ordered from low to high.
+// If member does not exist in the sorted set, or key does not exist, ErrNotFound returned.
+// @command ZRANK
+// @complexity O(log(N)) where N is the size of the sorted set
+func (c *Core) ZRank(key, member string) (rank int, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return 0, ErrNotFound
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != SortedSet {
+		return 0, ErrWrongType
+	}
+
+	rank, ok := item.zset.Rank(member)
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	return rank, nil
+}
+
+// ZRange Returns the specified range of elements in the sorted set stored at key,
+// ordered from the lowest to the highest score. Members with equal score are ordered lexicographically.
+// Start and stop offsets could be negative to designate elements starting at the end of the sorted set.
+// WITHSCORES option makes every member in the reply to be followed by its score.
+// @command ZRANGE
+// @complexity O(M) where M is the number of returned members
+// @optional
+func (c *Core) ZRange(key string, start, stop int, options []string) (result [][]byte, err error) {
+	withScores := false
+	for _, option := range options {
+		if strings.ToUpper(option) != "WITHSCORES" {
+			return nil, ErrSyntax
+		}
+		withScores = true
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		// In Redis, ZRange on non-exists key returns empty list, not <nil> aka NotFound
+		return nil, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != SortedSet {
+		return nil, ErrWrongType
+	}
+
+	start, stop, ok := normalizeRange(start, stop, item.zset.Len())
+	if !ok {
+		return [][]byte{}, nil
+	}
+
+	return formatSortedSetEntries(item.zset.Range(start, stop), withScores), nil
+}
+
+// ZIncrBy Increments the score of member in the sorted set stored at key by increment.
+// If member does not exist in the sorted set, it is added with increment as its score.
+// If key does not exist, a new sorted set with the specified member as its sole member is created.
+// Returns the new score of member.
+// @command ZINCRBY
+// @complexity O(N) where N is the size of the sorted set
+// @modifying
+func (c *Core) ZIncrBy(key, increment, member string) (result []byte, err error) {
+	incr, err := parseFloat(increment)
+	if err != nil {
+		return nil, err
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		item = c.created(NewItemSortedSet(map[string]float64{}))
+		defer func() {
+			c.storage.AddOrReplaceOne(key, item)
+		}()
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != SortedSet {
+		return nil, ErrWrongType
+	}
+
+	score, _ := item.zset.Score(member)
+	score += incr
+	if math.IsNaN(score) {
+		// e.g. +inf and -inf sum
+		return nil, ErrScoreNaN
+	}
+
+	item.zset.Add(member, score)
+	c.touch(item)
+
+	return formatScore(score), nil
+}
+
+// ZRangeByScore Returns all the elements in the sorted set at key with a score between min and max inclusive,
+// ordered from the lowest to the highest score. Members with equal score are ordered lexicographically.
+// min and max could be -inf and +inf, and prefixed with ( to make the interval exclusive.
+// WITHSCORES option makes every member in the reply to be followed by its score,
+// LIMIT offset count option returns only count elements, starting from offset. Negative count returns all elements from offset.
+// @command ZRANGEBYSCORE
+// @complexity O(log(N)+M) where N is the size of the sorted set and M is the number of returned members
+// @optional
+func (c *Core) ZRangeByScore(key, min, max string, options []string) (result [][]byte, err error) {
+	minScore, minExclusive, err := parseScoreBound(min)
+	if err != nil {
+		return nil, err
+	}
+	maxScore, maxExclusive, err := parseScoreBound(max)
+	if err != nil {
+		return nil, err
+	}
+
+	withScores := false
+	offset, count := 0, -1
+	for i := 0; i < len(options); i++ {
+		switch strings.ToUpper(options[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(options) {
+				return nil, ErrSyntax
+			}
+			if offset, err = strconv.Atoi(options[i+1]); err != nil {
+				return nil, ErrSyntax
+			}
+			if count, err = strconv.Atoi(options[i+2]); err != nil {
+				return nil, ErrSyntax
+			}
+			i += 2
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		// In Redis, ZRangeByScore on non-exists key returns empty list, not <nil> aka NotFound
+		return nil, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != SortedSet {
+		return nil, ErrWrongType
+	}
+
+	entries := item.zset.RangeByScore(minScore, minExclusive, maxScore, maxExclusive)
+	if offset < 0 || offset >= len(entries) {
+		return [][]byte{}, nil
+	}
+	entries = entries[offset:]
+	if count >= 0 && count < len(entries) {
+		entries = entries[:count]
+	}
+
+	return formatSortedSetEntries(entries, withScores), nil
+}
+
+// ZRem Removes the specified members from the sorted set stored at key. Non existing members are ignored.
+// Returns the number of members removed from the sorted set, not including non existing members.
+// @command ZREM
+// @complexity O(M*N) where M is the number of removed members and N is the size of the sorted set
+// @modifying
+func (c *Core) ZRem(key string, members []string) (count int64, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != SortedSet {
+		return 0, ErrWrongType
+	}
+
+	for _, member := range members {
+		if item.zset.Remove(member) {
+			count++
+		}
+	}
+
+	if count > 0 {
+		c.touch(item)
+	}
+
+	return count, nil
+}
+
+// Version returns version of the item stored at key. Version changes on every modification of the item.
+// If key does not exist, 0 returned
+func (c *Core) Version(key string) (version uint64) {
+	item := c.peekItem(key)
+	if item == nil {
+		return 0
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	return item.Version()
+}
+
+// ObjectEncoding returns name of internal representation of the value stored at key
+func (c *Core) ObjectEncoding(key string) (encoding string, err error) {
+	item := c.peekItem(key)
+	if item == nil {
+		return "", ErrNotFound
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	return item.Encoding(), nil
+}
+
+// DebugObject returns description of the value stored at key like Redis DEBUG OBJECT does:
+// refcount, encoding, size of the value as serialized length, idle time and length of the list
+func (c *Core) DebugObject(key string) (result string, err error) {
+	item := c.peekItem(key)
+	if item == nil {
+		return "", ErrNotFound
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	result = fmt.Sprintf(
+		"Value at:%p refcount:%d encoding:%s serializedlength:%d lru_seconds_idle:%d",
+		item,
+		item.Refcount(),
+		item.Encoding(),
+		item.MemSize(),
+		int(item.IdleTime()/time.Second),
+	)
+	if item.kind == List {
+		result += fmt.Sprintf(" list_length:%d", len(item.List()))
+	}
+
+	return result, nil
+}
+
+// ObjectRefcount returns count of references to the value stored at key: SharedRefcount for shared small integers
+// and 1 for other values
+func (c *Core) ObjectRefcount(key string) (count int, err error) {
+	item := c.peekItem(key)
+	if item == nil {
+		return 0, ErrNotFound
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	return item.Refcount(), nil
+}
+
+// ObjectIdletime returns number of seconds since the last access to the value stored at key
+func (c *Core) ObjectIdletime(key string) (seconds int, err error) {
+	item := c.peekItem(key)
+	if item == nil {
+		return 0, ErrNotFound
+	}
+
+	return int(item.IdleTime() / time.Second), nil
+}
+
+// Meta Returns metadata of the value stored at key: unix times in milliseconds of its creation and the last modification,
+// and the remaining time to live in seconds, or -1, if the key has no TTL.
+// Times are -1, if the value is created while timestamps tracking disabled. Overwriting of the key, e.g. by SET, creates a new value.
+// @command META
+// @complexity O(1)
+// @map
+func (c *Core) Meta(key string) (result [][]byte, err error) {
+	item := c.peekItem(key)
+	if item == nil {
+		return nil, ErrNotFound
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	ttl := -1
+	if item.HasTtl() {
+		ttl = item.Ttl()
+	}
+
+	return [][]byte{
+		[]byte("created"), []byte(strconv.FormatInt(unixMilli(item.CreatedAt()), 10)),
+		[]byte("modified"), []byte(strconv.FormatInt(unixMilli(item.ModifiedAt()), 10)),
+		[]byte("ttl"), []byte(strconv.Itoa(ttl)),
+	}, nil
+}
+
+// unixMilli returns unix time in milliseconds, or -1 for zero time
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return -1
+	}
+
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// Storage returns reference to underlying storage to persisting
+// Except Storage, Core is stateless by design, so it's enough to persist Storage to save all Core state
+func (c *Core) Storage() Storage {
+	return c.storage
+}
+
+// Compact releases memory, held by the storage after removal of items, if the storage supports it.
+// Returns false, if it isn't supported
+func (c *Core) Compact() bool {
+	compactor, ok := c.storage.(Compactor)
+	if !ok {
+		return false
+	}
+
+	compactor.Compact()
+	return true
+}
+
+// SetStorage sets storage storage after loading
+// Except Storage, Core is stateless by design, so it's enough to persist Storage to save all Core state
+func (c *Core) SetStorage(storage Storage) {
+	c.storage = storage
+}
+
+// normalizeRange converts start and stop offsets, that could be negative to designate elements starting at the end,
+// into indexes of [0, length-1] range. Returns false, if the range is empty
+func normalizeRange(start, stop, length int) (normStart, normStop int, ok bool) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+
+	// compare as ints: conversion of huge offsets into float64 and back overflows
+	if start < 0 {
+		start = 0
+	}
+	if stop > length-1 {
+		stop = length - 1
+	}
+
+	// after normalizing, next check  also covers start > length, stop < 0 and empty range
+	return start, stop, start <= stop
+}
+
+// parseFloat parses float argument or value. Infinite values are allowed, but NaN isn't
+func parseFloat(value string) (result float64, err error) {
+	result, err = strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(result) {
+		return 0, ErrNotFloat
+	}
+
+	return result, nil
+}
+
+// incrFloatValue adds increment to the float number stored as a string value and returns the new value
+func incrFloatValue(value []byte, increment float64) (result []byte, err error) {
+	current, err := parseFloat(string(value))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := current + increment
+	if math.IsNaN(sum) || math.IsInf(sum, 0) {
+		return nil, ErrIncrNaN
+	}
+
+	// the shortest representation, that parses back to the same value, without exponent and trailing zeroes
+	return []byte(strconv.FormatFloat(sum, 'f', -1, 64)), nil
+}
+
+// parseScoreBound parses min or max bound of score range, e.g. 1.5, (1.5, -inf or +inf.
+// Returns true, if the bound is exclusive
+func parseScoreBound(value string) (score float64, exclusive bool, err error) {
+	if strings.HasPrefix(value, "(") {
+		exclusive = true
+		value = value[1:]
+	}
+
+	score, err = strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false, ErrMinMaxFloat
+	}
+
+	return score, exclusive, nil
+}
+
+// formatScore formats score of sorted set member in the same way as Redis does
+func formatScore(score float64) []byte {
+	switch {
+	case math.IsInf(score, 1):
+		return []byte("inf")
+	case math.IsInf(score, -1):
+		return []byte("-inf")
+	default:
+		return []byte(strconv.FormatFloat(score, 'f', -1, 64))
+	}
+}
+
+// formatSortedSetEntries converts sorted set entries to list of members, optionally followed by their scores
+func formatSortedSetEntries(entries []sortedSetEntry, withScores bool) (result [][]byte) {
+	if withScores {
+		result = make([][]byte, 0, 2*len(entries))
+	} else {
+		result = make([][]byte, 0, len(entries))
+	}
+
+	for _, e := range entries {
+		result = append(result, []byte(e.member))
+		if withScores {
+			result = append(result, formatScore(e.score))
+		}
+	}
+
+	return result
+}
+
+// warning: it could affect performance due to extra mutex lock.
+// if it makes perf. penalty, move  IsExpired() check inside existing Lock() in every API func
+// parseExpireOption returns the moment of expiration, specified by EX, PX, EXAT or PXAT option of SET command.
+// Relative EX and PX options are counted from now
+func parseExpireOption(option, value string, now time.Time) (expireAt time.Time, err error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return expireAt, ErrNotInt
+	}
+
+	unit := time.Second
+	if option == "PX" || option == "PXAT" {
+		unit = time.Millisecond
+	}
+	if n <= 0 || n > math.MaxInt64/int64(unit) {
+		return expireAt, ErrExpireTime
+	}
+
+	if option == "EX" || option == "PX" {
+		return now.Add(time.Duration(n) * unit), nil
+	}
+
+	return time.Unix(0, n*int64(unit)), nil
+}
+
+// now returns the moment of the processed request: the current time or the time of the replayed one
+func (c *Core) now() time.Time {
+	if c.replayTime.IsZero() {
+		return time.Now()
+	}
+
+	return c.replayTime
+}
+
+// created records the moment of the processed request as creation time of the new item, if it differs from
+// the current time on WAL replay, so META of replayed items doesn't show time of the replay. Returns the item
+func (c *Core) created(item *Item) *Item {
+	if !c.replayTime.IsZero() {
+		item.setCreatedAt(c.replayTime)
+	}
+
+	return item
+}
+
+// touch updates version of the modified item and records the moment of the processed request as its modification time
+func (c *Core) touch(item *Item) {
+	if c.replayTime.IsZero() {
+		item.Touch()
+		return
+	}
+
+	item.TouchAt(c.replayTime)
+}
+
+// isExpired returns true, if the item is expired at the moment of the processed request
+func (c *Core) isExpired(item *Item) bool {
+	return item.IsExpiredAt(c.now())
+}
+
+// getItem returns not expired item by key and updates it's last access time
+func (c *Core) getItem(key string) *Item {
+	item := c.peekItem(key)
+	if item != nil {
+		item.Access()
+	}
+
+	return item
+}
+
+// lockItemTtl returns write-locked not expired item by key to change its TTL, or nil if the key doesn't exist.
+// If the item is replaced by SET KEEPTTL, it waits for the new item, otherwise TTL change could be lost
+func (c *Core) lockItemTtl(key string) *Item {
+	for {
+		item := c.getItem(key)
+		if item == nil {
+			return nil
+		}
+
+		item.Lock()
+		if !item.replaced {
+			return item
+		}
+		item.Unlock()
+
+		// the new item is being added into the storage right now
+		runtime.Gosched()
+	}
+}
+
+// peekItem returns not expired item by key without updating it's last access time
+func (c *Core) peekItem(key string) *Item {
 	item := c.storage.Get(key)
 	if item == nil {
 		return nil
@@ -680,7 +2893,7 @@ func (c *Core) getItem(key string) *Item {
 
 	item.RLock()
 
-	if item.IsExpired() {
+	if c.isExpired(item) {
 		item.RUnlock()
 		return nil
 	}
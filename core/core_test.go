@@ -1,12 +1,19 @@
 package core_test
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/go-test/deep"
 	. "github.com/mshaverdo/radish/core"
+	"math"
 	"math/rand"
+	"reflect"
+	"runtime"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -37,6 +44,16 @@ func getSampleDataCore() map[string]*Item {
 		}),
 		"測":       NewItemBytes([]byte("幽霊はヨーロッパを追いかけています - 共産主義の幽霊")),
 		"expired": expiredItem,
+		"zset": NewItemSortedSet(map[string]float64{
+			"Abba":      1972,
+			"Rammstein": 1994,
+			"KMFDM":     1984,
+			"Kraftwerk": 1970,
+			"Ramones":   1974,
+			"Deftones":  1988,
+			"Tool":      1990,
+			"Slayer":    1981,
+		}),
 	}
 }
 
@@ -57,10 +74,31 @@ func (e *MockStorage) Keys() (keys []string) {
 	return keys
 }
 
+func (e *MockStorage) ViewKeys(view func(forEach KeyIterator)) {
+	view(func(yield func(key string, item *Item)) {
+		for k, item := range e.data {
+			yield(k, item)
+		}
+	})
+}
+
+func (e *MockStorage) Len() int {
+	return len(e.data)
+}
+
 func (e *MockStorage) AddOrReplaceOne(key string, item *Item) {
 	e.data[key] = item
 }
 
+func (e *MockStorage) CompareAndReplace(key string, old, item *Item) (replaced bool) {
+	if e.data[key] != old {
+		return false
+	}
+
+	e.data[key] = item
+	return true
+}
+
 func (e *MockStorage) Del(keys []string) (count int) {
 	for _, k := range keys {
 		if _, ok := e.data[k]; ok {
@@ -85,15 +123,15 @@ func (e *MockStorage) GetSubmap(keys []string) (submap map[string]*Item) {
 	return submap
 }
 
-func (e *MockStorage) DelSubmap(submap map[string]*Item) (count int) {
+func (e *MockStorage) DelSubmap(submap map[string]*Item) (removed []string) {
 	for key, item := range submap {
 		if existingItem, ok := e.data[key]; ok && existingItem == item {
-			count++
+			removed = append(removed, key)
 			delete(e.data, key)
 		}
 	}
 
-	return count
+	return removed
 }
 
 /////////////////////  Tests  ///////////////////////////
@@ -103,9 +141,12 @@ func TestCore_Keys(t *testing.T) {
 		pattern string
 		want    []string
 	}{
-		{"*", []string{"bytes", "dict", "list", "測"}},
+		{"*", []string{"bytes", "dict", "list", "zset", "測"}},
 		{"bytes", []string{"bytes"}},
 		{"*i*", []string{"dict", "list"}},
+		{"?i*", []string{"dict", "list"}},
+		{"[bz]*", []string{"bytes", "zset"}},
+		{"[^a-k]*", []string{"list", "zset", "測"}},
 	}
 
 	c := New(NewMockStorage())
@@ -121,6 +162,67 @@ func TestCore_Keys(t *testing.T) {
 	}
 }
 
+func TestCore_KeysFunc(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*", []string{"bytes", "dict", "list", "zset", "測"}},
+		{"bytes", []string{"bytes"}},
+		{"*i*", []string{"dict", "list"}},
+		{"404", []string{}},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		var gotCount int
+		got := []string{}
+		c.KeysFunc(tst.pattern, func(count int, forEach func(yield func(key string))) {
+			gotCount = count
+			forEach(func(key string) {
+				got = append(got, key)
+			})
+		})
+		sort.Strings(got)
+		sort.Strings(tst.want)
+
+		if gotCount != len(tst.want) {
+			t.Errorf("KeysFunc(%q): count got %d want %d", tst.pattern, gotCount, len(tst.want))
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("KeysFunc(%q): %s\n\ngot:%v\n\nwant:%v", tst.pattern, diff, got, tst.want)
+		}
+	}
+}
+
+func TestCore_KeysCheckTtl(t *testing.T) {
+	c := New(NewMockStorage())
+
+	SetKeysCheckTtl(false)
+	defer SetKeysCheckTtl(true)
+
+	got := c.Keys("ex*")
+	if diff := deep.Equal(got, []string{"expired"}); diff != nil {
+		t.Errorf("Keys() without TTL check: %s\n\ngot:%v\n\nwant:%v", diff, got, []string{"expired"})
+	}
+
+	got = []string{}
+	c.KeysFunc("ex*", func(count int, forEach func(yield func(key string))) {
+		forEach(func(key string) {
+			got = append(got, key)
+		})
+	})
+	if diff := deep.Equal(got, []string{"expired"}); diff != nil {
+		t.Errorf("KeysFunc() without TTL check: %s\n\ngot:%v\n\nwant:%v", diff, got, []string{"expired"})
+	}
+
+	SetKeysCheckTtl(true)
+	if got := c.Keys("ex*"); len(got) != 0 {
+		t.Errorf("Keys() with TTL check: got %v, want no keys", got)
+	}
+}
+
 func TestCore_Get(t *testing.T) {
 	tests := []struct {
 		key  string
@@ -176,8 +278,8 @@ func TestCore_Del(t *testing.T) {
 		keys []string
 		want []string
 	}{
-		{[]string{"bytes", "list", "404"}, []string{"dict", "測"}},
-		{[]string{"dict", "測", "expired"}, []string{}},
+		{[]string{"bytes", "list", "404"}, []string{"dict", "zset", "測"}},
+		{[]string{"dict", "zset", "測", "expired"}, []string{}},
 	}
 
 	c := New(NewMockStorage())
@@ -253,7 +355,7 @@ func TestCore_DSet(t *testing.T) {
 	tests := []struct {
 		key, field, value string
 		err               error
-		count             int
+		count             int64
 	}{
 		{"bytes", "", "", ErrWrongType, 0},
 		{"404", "共", "共産主義の幽霊", nil, 1},
@@ -282,6 +384,85 @@ func TestCore_DSet(t *testing.T) {
 	}
 }
 
+func TestCore_DSetMany(t *testing.T) {
+	tests := []struct {
+		key          string
+		fieldsValues []string
+		err          error
+		count        int64
+		want         map[string]string
+	}{
+		{"bytes", []string{"f", "v"}, ErrWrongType, 0, nil},
+		{"dict", []string{"f"}, ErrSyntax, 0, nil},
+		{"dict", nil, ErrSyntax, 0, nil},
+		{"404", []string{"f1", "v1", "f2", "v2", "f1", "v3"}, nil, 2, map[string]string{"f1": "v3", "f2": "v2"}},
+		{"dict", []string{"banana", "kiwi", "new", "v", "", "empty"}, nil, 2, map[string]string{"banana": "kiwi", "new": "v", "": "empty"}},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		fieldsValues := make([][]byte, len(tst.fieldsValues))
+		for i, v := range tst.fieldsValues {
+			fieldsValues[i] = []byte(v)
+		}
+
+		count, err := c.DSetMany(tst.key, fieldsValues)
+		if err != tst.err || count != tst.count {
+			t.Errorf("DSetMany(%q, %q): got %d, %v, want %d, %v", tst.key, tst.fieldsValues, count, err, tst.count, tst.err)
+		}
+		for field, value := range tst.want {
+			if got, err := c.DGet(tst.key, field); string(got) != value || err != nil {
+				t.Errorf("DSetMany(%q, %q): field %q got %q, %v, want %q", tst.key, tst.fieldsValues, field, got, err, value)
+			}
+		}
+	}
+
+	if _, err := c.Get("404"); err != ErrWrongType {
+		t.Errorf("DSetMany() must create a dict, Get(): got err %v, want %v", err, ErrWrongType)
+	}
+}
+
+func TestCore_DSetManyEx(t *testing.T) {
+	tests := []struct {
+		key          string
+		seconds      int
+		fieldsValues []string
+		err          error
+		count        int64
+		wantTtl      int
+	}{
+		{"bytes", 10, []string{"f", "v"}, ErrWrongType, 0, 1000},
+		{"dict", 10, []string{"f"}, ErrSyntax, 0, -1},
+		{"404", 10, []string{"f1", "v1", "f2", "v2"}, nil, 2, 10},
+		{"dict", 20, []string{"banana", "kiwi", "new", "v"}, nil, 1, 20},
+		{"expired", 30, []string{"f", "v"}, nil, 1, 30},
+		{"dict", 0, []string{"f", "v"}, nil, 0, -2},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		fieldsValues := make([][]byte, len(tst.fieldsValues))
+		for i, v := range tst.fieldsValues {
+			fieldsValues[i] = []byte(v)
+		}
+
+		count, err := c.DSetManyEx(tst.key, tst.seconds, fieldsValues)
+		if err != tst.err || count != tst.count {
+			t.Errorf("DSetManyEx(%q, %d, %q): got %d, %v, want %d, %v", tst.key, tst.seconds, tst.fieldsValues, count, err, tst.count, tst.err)
+		}
+		if ttl, _ := c.Ttl(tst.key); ttl != tst.wantTtl {
+			t.Errorf("DSetManyEx(%q, %d, %q): got TTL %d, want %d", tst.key, tst.seconds, tst.fieldsValues, ttl, tst.wantTtl)
+		}
+		if err == nil && tst.seconds > 0 {
+			if got, err := c.DGet(tst.key, tst.fieldsValues[0]); string(got) != tst.fieldsValues[1] || err != nil {
+				t.Errorf("DSetManyEx(%q, %d, %q): got %q, %v, want %q", tst.key, tst.seconds, tst.fieldsValues, got, err, tst.fieldsValues[1])
+			}
+		}
+	}
+}
+
 func TestCore_DGetAll(t *testing.T) {
 	tests := []struct {
 		key  string
@@ -315,13 +496,116 @@ func TestCore_DGetAll(t *testing.T) {
 	}
 }
 
+func TestCore_DGetAllFunc(t *testing.T) {
+	tests := []struct {
+		key  string
+		want map[string]string
+		err  error
+	}{
+		{"bytes", nil, ErrWrongType},
+		{"404", map[string]string{}, nil},
+		{"expired", map[string]string{}, nil},
+		{"dict", map[string]string{"banana": "mama", "測試": "別れ、比類のない"}, nil},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		var got map[string]string
+		gotCount := -1
+		err := c.DGetAllFunc(tst.key, func(count int, forEach func(yield func(field string, value []byte))) {
+			gotCount = count
+			got = map[string]string{}
+			forEach(func(field string, value []byte) {
+				got[field] = string(value)
+			})
+		})
+		if err != tst.err {
+			t.Errorf("DGetAllFunc(%q) err: %q != %q", tst.key, err, tst.err)
+		}
+		if err != nil {
+			if gotCount != -1 {
+				t.Errorf("DGetAllFunc(%q): write invoked on error", tst.key)
+			}
+			continue
+		}
+
+		if gotCount != len(tst.want) {
+			t.Errorf("DGetAllFunc(%q): count got %d want %d", tst.key, gotCount, len(tst.want))
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("DGetAllFunc(%q): %s\n\ngot:%v\n\nwant:%v", tst.key, diff, got, tst.want)
+		}
+	}
+}
+
+func BenchmarkCore_DGetAll10k(b *testing.B) {
+	c := New(NewMockStorage())
+	value := []byte(strings.Repeat("v", 1024))
+	for i := 0; i < 10000; i++ {
+		c.DSet("hash", strconv.Itoa(i), value)
+	}
+
+	// both variants write fields and values into a buffer, like the RESP server does
+	buf := make([]byte, 0, 11*1024*1024)
+
+	b.Run("copy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			result, _ := c.DGetAll("hash")
+			buf = buf[:0]
+			for _, v := range result {
+				buf = append(buf, v...)
+			}
+		}
+	})
+	b.Run("func", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf = buf[:0]
+			c.DGetAllFunc("hash", func(count int, forEach func(yield func(field string, value []byte))) {
+				forEach(func(field string, value []byte) {
+					buf = append(buf, field...)
+					buf = append(buf, value...)
+				})
+			})
+		}
+	})
+}
+
+func TestCore_SortHashFields(t *testing.T) {
+	c := New(NewMockStorage())
+	for _, field := range []string{"b", "測", "a", "", "c"} {
+		c.DSet("sorted", field, []byte("v"+field))
+	}
+	c.SetSortHashFields(true)
+
+	keys, err := c.DKeys("sorted")
+	if err != nil {
+		t.Errorf("DKeys() err: %q", err)
+	}
+	if diff := deep.Equal(keys, []string{"", "a", "b", "c", "測"}); diff != nil {
+		t.Errorf("DKeys(): %s\n\ngot:%v", diff, keys)
+	}
+
+	result, err := c.DGetAll("sorted")
+	if err != nil {
+		t.Errorf("DGetAll() err: %q", err)
+	}
+	got := fmt.Sprintf("%q", result)
+	want := `["" "v" "a" "va" "b" "vb" "c" "vc" "測" "v測"]`
+	if got != want {
+		t.Errorf("DGetAll(): got %s, want %s", got, want)
+	}
+}
+
 func TestCore_DDel(t *testing.T) {
 	tests := []struct {
 		key       string
 		fields    []string
 		err       error
 		wantKeys  []string
-		wantCount int
+		wantCount int64
 	}{
 		{"bytes", nil, ErrWrongType, nil, 0},
 		{"404", []string{"banana", "nothing"}, nil, nil, 0},
@@ -353,7 +637,7 @@ func TestCore_LLen(t *testing.T) {
 	tests := []struct {
 		key  string
 		err  error
-		want int
+		want int64
 	}{
 		{"bytes", ErrWrongType, 0},
 		{"404", nil, 0},
@@ -417,6 +701,102 @@ func TestCore_LRange(t *testing.T) {
 	}
 }
 
+// TestCore_ListIndicesProperty compares LRANGE, LINDEX and LSET on random lists and indices with a straightforward
+// implementation over a head-to-tail slice, to check translation of indices into the reversed storage slice
+func TestCore_ListIndicesProperty(t *testing.T) {
+	// refRange returns elements from start to stop inclusive, like Redis LRANGE does
+	refRange := func(list []string, start, stop int) []string {
+		length := len(list)
+		if start < 0 {
+			start += length
+		}
+		if stop < 0 {
+			stop += length
+		}
+		if start < 0 {
+			start = 0
+		}
+		if stop >= length {
+			stop = length - 1
+		}
+
+		result := []string{}
+		for i := start; i <= stop; i++ {
+			result = append(result, list[i])
+		}
+		return result
+	}
+	// refIndex returns position of index in head-to-tail slice, or -1 for out of range index
+	refIndex := func(list []string, index int) int {
+		if index < 0 {
+			index += len(list)
+		}
+		if index < 0 || index >= len(list) {
+			return -1
+		}
+		return index
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	// indices around list bounds and extreme values, which could overflow
+	randomIndex := func(length int) int {
+		switch rnd.Intn(10) {
+		case 0:
+			return math.MaxInt64
+		case 1:
+			return math.MinInt64
+		default:
+			return rnd.Intn(4*length+5) - 2*length - 2
+		}
+	}
+
+	c := New(NewMockStorage())
+	for n := 0; n < 300; n++ {
+		length := rnd.Intn(12)
+		// head-to-tail order
+		list := make([]string, length)
+		values := make([][]byte, length)
+		for i := range list {
+			list[i] = strconv.Itoa(rnd.Intn(1000))
+			// LPUSH inserts values at the head one by one, so the last value becomes the head
+			values[length-1-i] = []byte(list[i])
+		}
+		key := "list_" + strconv.Itoa(n)
+		if length > 0 {
+			c.LPush(key, values)
+		}
+
+		for i := 0; i < 50; i++ {
+			start, stop := randomIndex(length), randomIndex(length)
+
+			result, err := c.LRange(key, start, stop)
+			got := make([]string, len(result))
+			for i, v := range result {
+				got[i] = string(v)
+			}
+			if want := refRange(list, start, stop); err != nil || !reflect.DeepEqual(got, want) {
+				t.Fatalf("LRange(%v, %d, %d): got %q, %v, want %q", list, start, stop, got, err, want)
+			}
+
+			value, err := c.LIndex(key, start)
+			if pos := refIndex(list, start); pos < 0 && err != ErrNotFound || pos >= 0 && (err != nil || string(value) != list[pos]) {
+				t.Fatalf("LIndex(%v, %d): got %q, %v, want position %d", list, start, value, err, pos)
+			}
+
+			if length == 0 {
+				continue
+			}
+			newValue := strconv.Itoa(1000 + rnd.Intn(1000))
+			err = c.LSet(key, stop, []byte(newValue))
+			if pos := refIndex(list, stop); pos < 0 && err != ErrInvalidIndex || pos >= 0 && err != nil {
+				t.Fatalf("LSet(%v, %d): got %v, want position %d", list, stop, err, pos)
+			} else if pos >= 0 {
+				list[pos] = newValue
+			}
+		}
+	}
+}
+
 func TestCore_LIndex(t *testing.T) {
 	tests := []struct {
 		key   string
@@ -451,6 +831,57 @@ func TestCore_LIndex(t *testing.T) {
 	}
 }
 
+func TestCore_LPos(t *testing.T) {
+	tests := []struct {
+		key     string
+		element string
+		options []string
+		err     error
+		want    []int
+	}{
+		{"bytes", "a", nil, ErrWrongType, nil},
+		{"404", "a", nil, ErrNotFound, nil},
+		{"404", "a", []string{"COUNT", "1"}, nil, []int{}},
+		{"expired", "a", nil, ErrNotFound, nil},
+		{"list", "Abba", nil, nil, []int{2}},
+		//IMPORTANT: by proto, HEAD of the list has index 0
+		{"dups", "a", nil, nil, []int{0}},
+		{"dups", "c", nil, nil, []int{2}},
+		{"dups", "z", nil, ErrNotFound, nil},
+		{"dups", "z", []string{"COUNT", "0"}, nil, []int{}},
+		{"dups", "a", []string{"rank", "2"}, nil, []int{3}},
+		{"dups", "a", []string{"RANK", "-1"}, nil, []int{5}},
+		{"dups", "a", []string{"RANK", "-2"}, nil, []int{3}},
+		{"dups", "a", []string{"RANK", "4"}, ErrNotFound, nil},
+		{"dups", "a", []string{"RANK", "-4"}, ErrNotFound, nil},
+		{"dups", "a", []string{"COUNT", "0"}, nil, []int{0, 3, 5}},
+		{"dups", "a", []string{"COUNT", "2"}, nil, []int{0, 3}},
+		{"dups", "a", []string{"COUNT", "10"}, nil, []int{0, 3, 5}},
+		{"dups", "a", []string{"RANK", "2", "COUNT", "0"}, nil, []int{3, 5}},
+		{"dups", "a", []string{"count", "0", "rank", "-1"}, nil, []int{5, 3, 0}},
+		{"dups", "b", []string{"RANK", "-1", "COUNT", "1"}, nil, []int{4}},
+		{"dups", "a", []string{"RANK", "0"}, ErrRankZero, nil},
+		{"dups", "a", []string{"COUNT", "-1"}, ErrNegCount, nil},
+		{"dups", "a", []string{"RANK", "x"}, ErrNotInt, nil},
+		{"dups", "a", []string{"RANK"}, ErrSyntax, nil},
+		{"dups", "a", []string{"MAXLEN", "1"}, ErrSyntax, nil},
+	}
+
+	c := New(NewMockStorage())
+	c.LPush("dups", [][]byte{[]byte("a"), []byte("b"), []byte("a"), []byte("c"), []byte("b"), []byte("a")})
+
+	for _, tst := range tests {
+		got, err := c.LPos(tst.key, []byte(tst.element), tst.options)
+
+		if err != tst.err {
+			t.Errorf("LPos(%q, %q, %q) err: %q != %q", tst.key, tst.element, tst.options, err, tst.err)
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("LPos(%q, %q, %q): %s\n\ngot:%v\n\nwant:%v", tst.key, tst.element, tst.options, diff, got, tst.want)
+		}
+	}
+}
+
 func TestCore_LSet(t *testing.T) {
 	tests := []struct {
 		key   string
@@ -515,7 +946,7 @@ func TestCore_LPush(t *testing.T) {
 		if err != tst.err {
 			t.Errorf("LPush(%q, %q) err: %q != %q", tst.key, tst.values, err, tst.err)
 		}
-		if err == nil && count != len(tst.want) {
+		if err == nil && count != int64(len(tst.want)) {
 			t.Errorf("LPush(%q, %q) count: %d != %d", tst.key, tst.values, count, len(tst.want))
 		}
 		if diff := deep.Equal(got, tst.want); err == nil && diff != nil {
@@ -524,6 +955,105 @@ func TestCore_LPush(t *testing.T) {
 	}
 }
 
+func TestCore_LPushEx(t *testing.T) {
+	tests := []struct {
+		key     string
+		seconds int
+		values  []string
+		err     error
+		count   int64
+		wantTtl int
+	}{
+		{"bytes", 10, []string{"a"}, ErrWrongType, 0, 1000},
+		{"404", 10, []string{"a", "b"}, nil, 2, 10},
+		{"list", 20, []string{"a"}, nil, 4, 20},
+		{"expired", 30, []string{"a"}, nil, 1, 30},
+		{"list", 0, []string{"a"}, nil, 0, -2},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		values := make([][]byte, len(tst.values))
+		for i, value := range tst.values {
+			values[i] = []byte(value)
+		}
+
+		count, err := c.LPushEx(tst.key, tst.seconds, values)
+		if err != tst.err || count != tst.count {
+			t.Errorf("LPushEx(%q, %d, %q): got %d, %v, want %d, %v", tst.key, tst.seconds, tst.values, count, err, tst.count, tst.err)
+		}
+		if ttl, _ := c.Ttl(tst.key); ttl != tst.wantTtl {
+			t.Errorf("LPushEx(%q, %d, %q): got TTL %d, want %d", tst.key, tst.seconds, tst.values, ttl, tst.wantTtl)
+		}
+	}
+
+	// capped push keeps the limit and sets TTL as well
+	values := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	if count, err := c.LPushCappedEx("capped", 10, 2, "ERROR", values); count != 0 || err != ErrListFull {
+		t.Errorf("LPushCappedEx(capped, 10, 2, ERROR): got %d, %v, want 0, %v", count, err, ErrListFull)
+	}
+	if count, err := c.LPushCappedEx("capped", 10, 2, "TRIM", values); count != 2 || err != nil {
+		t.Errorf("LPushCappedEx(capped, 10, 2, TRIM): got %d, %v, want 2, nil", count, err)
+	}
+	if ttl, _ := c.Ttl("capped"); ttl != 10 {
+		t.Errorf("LPushCappedEx(capped, 10, 2, TRIM): got TTL %d, want 10", ttl)
+	}
+	if _, err := c.LPushCappedEx("capped", 10, 2, "DROP", values); err != ErrSyntax {
+		t.Errorf("LPushCappedEx(capped, 10, 2, DROP): got err %v, want %v", err, ErrSyntax)
+	}
+}
+
+func TestCore_LPushCapped(t *testing.T) {
+	tests := []struct {
+		key          string
+		maxLen       int
+		policy       string
+		err          error
+		values, want []string
+	}{
+		{"bytes", 5, "TRIM", ErrWrongType, []string{"a"}, nil},
+		{"list", 5, "DROP", ErrSyntax, []string{"a"}, nil},
+		{"list", -1, "TRIM", ErrSyntax, []string{"a"}, nil},
+		{"list", 4, "ERROR", ErrListFull, []string{"a", "b"}, []string{"KMFDM", "Rammstein", "Abba"}},
+		{"list", 4, "error", nil, []string{"a"}, []string{"a", "KMFDM", "Rammstein", "Abba"}},
+		{"list", 4, "trim", nil, []string{"b", "c"}, []string{"c", "b", "a", "KMFDM"}},
+		{"list", 2, "TRIM", nil, []string{"d", "e", "f"}, []string{"f", "e"}},
+		{"list", 0, "ERROR", nil, []string{"g"}, []string{"g", "f", "e"}},
+		{"404", 2, "ERROR", ErrListFull, []string{"a", "b", "c"}, []string{}},
+		{"404", 2, "TRIM", nil, []string{"a", "b", "c"}, []string{"c", "b"}},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		values := make([][]byte, len(tst.values))
+		for i, value := range tst.values {
+			values[i] = []byte(value)
+		}
+
+		count, err := c.LPushCapped(tst.key, tst.maxLen, tst.policy, values)
+		if err != tst.err {
+			t.Errorf("LPushCapped(%q, %d, %q, %q) err: %v != %v", tst.key, tst.maxLen, tst.policy, tst.values, err, tst.err)
+		}
+		if tst.want == nil {
+			continue
+		}
+
+		result, _ := c.LRange(tst.key, 0, -1)
+		got := make([]string, len(result))
+		for i, value := range result {
+			got[i] = string(value)
+		}
+		if err == nil && count != int64(len(tst.want)) {
+			t.Errorf("LPushCapped(%q, %d, %q, %q) count: %d != %d", tst.key, tst.maxLen, tst.policy, tst.values, count, len(tst.want))
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("LPushCapped(%q, %d, %q, %q): %s\n\ngot:%v\n\nwant:%v", tst.key, tst.maxLen, tst.policy, tst.values, diff, got, tst.want)
+		}
+	}
+}
+
 func TestCore_LPop(t *testing.T) {
 	tests := []struct {
 		key        string
@@ -563,29 +1093,114 @@ func TestCore_LPop(t *testing.T) {
 	}
 }
 
-type TestCoreConcurrencyTestCase struct {
-	bytes      []string
-	list       []string
-	dict       []string
-	dictFields []string
-	listLen    int
-}
-
-func TestCore_concurrency(t *testing.T) {
-	if testing.Short() {
-		t.Skip()
+func TestCore_Sort(t *testing.T) {
+	tests := []struct {
+		key     string
+		options []string
+		err     error
+		want    []string
+	}{
+		{"bytes", nil, ErrWrongType, nil},
+		{"404", nil, nil, []string{}},
+		{"expired", nil, nil, []string{}},
+		{"list", nil, ErrSortNotFloat, nil},
+		{"list", []string{"alpha"}, nil, []string{"Abba", "KMFDM", "Rammstein"}},
+		{"list", []string{"ALPHA", "DESC"}, nil, []string{"Rammstein", "KMFDM", "Abba"}},
+		{"nums", nil, nil, []string{"-1.5", "02", "2", "10", "inf"}},
+		{"nums", []string{"DESC"}, nil, []string{"inf", "10", "2", "02", "-1.5"}},
+		{"nums", []string{"ALPHA"}, nil, []string{"-1.5", "02", "10", "2", "inf"}},
+		{"nums", []string{"LIMIT", "1", "2"}, nil, []string{"02", "2"}},
+		{"nums", []string{"LIMIT", "3", "-1", "ASC"}, nil, []string{"10", "inf"}},
+		{"nums", []string{"LIMIT", "10", "2"}, nil, []string{}},
+		{"nums", []string{"LIMIT", "-1", "1"}, nil, []string{"-1.5"}},
+		{"nums", []string{"LIMIT", "1"}, ErrSyntax, nil},
+		{"nums", []string{"LIMIT", "a", "1"}, ErrNotInt, nil},
+		{"nums", []string{"BY", "weight_*"}, ErrSyntax, nil},
+		{"nums", []string{"STORE"}, ErrSyntax, nil},
 	}
 
-	tests := []TestCoreConcurrencyTestCase{
-		{
-			[]string{"b_a", "b_b", "b_c"},
-			[]string{"l_a", "l_b", "l_c"},
-			[]string{"d_a", "d_b", "d_c"},
-			[]string{"f1", "f2", "f3", "f4"},
-			10,
-		},
-		{
-			[]string{"b_1", "b_2", "b_3"},
+	c := New(NewMockStorage())
+	c.LPush("nums", [][]byte{[]byte("10"), []byte("2"), []byte("inf"), []byte("-1.5"), []byte("02")})
+
+	for _, tst := range tests {
+		result, err := c.Sort(tst.key, tst.options)
+		if err != tst.err {
+			t.Errorf("Sort(%q, %q) err: %q != %q", tst.key, tst.options, err, tst.err)
+		}
+		if err != nil {
+			continue
+		}
+
+		got := make([]string, len(result))
+		for i, b := range result {
+			got[i] = string(b)
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("Sort(%q, %q): %s\n\ngot:%v\n\nwant:%v", tst.key, tst.options, diff, got, tst.want)
+		}
+	}
+
+	// source list isn't changed
+	list, _ := c.LRange("list", 0, -1)
+	if diff := deep.Equal(list, [][]byte{[]byte("KMFDM"), []byte("Rammstein"), []byte("Abba")}); diff != nil {
+		t.Errorf("Sort() changed the source list: %s", diff)
+	}
+}
+
+func TestCore_SortStore(t *testing.T) {
+	c := New(NewMockStorage())
+
+	result, err := c.Sort("list", []string{"ALPHA", "STORE", "dst", "LIMIT", "0", "2"})
+	if err != nil || len(result) != 2 {
+		t.Fatalf("Sort() STORE: %q, %v", result, err)
+	}
+
+	got, err := c.LRange("dst", 0, -1)
+	if diff := deep.Equal(got, [][]byte{[]byte("Abba"), []byte("KMFDM")}); err != nil || diff != nil {
+		t.Errorf("Sort() STORE result: %q, %v", got, err)
+	}
+
+	// sorting in place replaces the source
+	if _, err := c.Sort("list", []string{"ALPHA", "DESC", "STORE", "list"}); err != nil {
+		t.Fatalf("Sort() STORE into the source: %v", err)
+	}
+	got, _ = c.LRange("list", 0, -1)
+	if diff := deep.Equal(got, [][]byte{[]byte("Rammstein"), []byte("KMFDM"), []byte("Abba")}); diff != nil {
+		t.Errorf("Sort() STORE into the source result: %q", got)
+	}
+
+	// empty result removes the destination
+	if result, err := c.Sort("404", []string{"STORE", "dst"}); err != nil || len(result) != 0 {
+		t.Fatalf("Sort() STORE of empty list: %q, %v", result, err)
+	}
+	if c.Type("dst") != "none" {
+		t.Errorf("Sort() STORE of empty list doesn't remove the destination: %s", c.Type("dst"))
+	}
+}
+
+type TestCoreConcurrencyTestCase struct {
+	bytes      []string
+	list       []string
+	dict       []string
+	dictFields []string
+	listLen    int
+}
+
+func TestCore_concurrency(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	tests := []TestCoreConcurrencyTestCase{
+		{
+			[]string{"b_a", "b_b", "b_c"},
+			[]string{"l_a", "l_b", "l_c"},
+			[]string{"d_a", "d_b", "d_c"},
+			[]string{"f1", "f2", "f3", "f4"},
+			10,
+		},
+		{
+			[]string{"b_1", "b_2", "b_3"},
 			[]string{"l_1", "l_2", "l_3"},
 			[]string{"d_1", "d_2", "d_3"},
 			[]string{"f1", "f2", "f3", "f4"},
@@ -854,6 +1469,178 @@ func TestCore_SetEx(t *testing.T) {
 		}
 	}
 }
+
+func TestCore_SetWithOptions(t *testing.T) {
+	future := strconv.FormatInt(time.Now().Add(100*time.Second).UnixNano()/int64(time.Millisecond), 10)
+	past := strconv.FormatInt(time.Now().Add(-100*time.Second).Unix(), 10)
+
+	tests := []struct {
+		key       string
+		options   []string
+		err       error
+		wantValue string
+		wantTtl   int
+	}{
+		{"bytes", nil, nil, "new", -1},
+		{"dict", []string{"ex", "10"}, nil, "new", 10},
+		{"list", []string{"PX", "11000"}, nil, "new", 11},
+		{"zset", []string{"PXAT", future}, nil, "new", 100},
+		{"測", []string{"EXAT", past}, nil, "", -2},
+		{"bytes", []string{"NX"}, ErrNotFound, "Призрак бродит по Европе - призрак коммунизма.", 1000},
+		{"expired", []string{"NX", "EX", "12"}, nil, "new", 12},
+		{"404", []string{"XX"}, ErrNotFound, "", -2},
+		{"bytes", []string{"XX", "KEEPTTL"}, nil, "new", 1000},
+		{"bytes", []string{"EX"}, ErrSyntax, "Призрак бродит по Европе - призрак коммунизма.", 1000},
+		{"bytes", []string{"EX", "1", "PX", "1000"}, ErrSyntax, "Призрак бродит по Европе - призрак коммунизма.", 1000},
+		{"bytes", []string{"NX", "XX"}, ErrSyntax, "Призрак бродит по Европе - призрак коммунизма.", 1000},
+		{"bytes", []string{"EX", "1", "KEEPTTL"}, ErrSyntax, "Призрак бродит по Европе - призрак коммунизма.", 1000},
+		{"bytes", []string{"GET"}, ErrSyntax, "Призрак бродит по Европе - призрак коммунизма.", 1000},
+		{"bytes", []string{"EX", "one"}, ErrNotInt, "Призрак бродит по Европе - призрак коммунизма.", 1000},
+		{"bytes", []string{"EX", "0"}, ErrExpireTime, "Призрак бродит по Европе - призрак коммунизма.", 1000},
+		{"bytes", []string{"PX", "-1"}, ErrExpireTime, "Призрак бродит по Европе - призрак коммунизма.", 1000},
+	}
+
+	for _, tst := range tests {
+		c := New(NewMockStorage())
+
+		err := c.SetWithOptions(tst.key, []byte("new"), tst.options)
+		if err != tst.err {
+			t.Errorf("SetWithOptions(%q, %q) err: %v != %v", tst.key, tst.options, err, tst.err)
+		}
+
+		got, _ := c.Get(tst.key)
+		if string(got) != tst.wantValue {
+			t.Errorf("SetWithOptions(%q, %q) got: %q != %q", tst.key, tst.options, string(got), tst.wantValue)
+		}
+		if ttl, _ := c.Ttl(tst.key); ttl != tst.wantTtl {
+			t.Errorf("SetWithOptions(%q, %q) ttl: %d != %d", tst.key, tst.options, ttl, tst.wantTtl)
+		}
+	}
+}
+
+func TestCore_CompareAndSwap(t *testing.T) {
+	const bytesValue = "Призрак бродит по Европе - призрак коммунизма."
+	tests := []struct {
+		key        string
+		expected   string
+		options    []string
+		wantResult int
+		wantErr    error
+		wantValue  string
+		wantTtl    int
+	}{
+		{"bytes", bytesValue, nil, 1, nil, "new", 1000},
+		{"bytes", "wrong", nil, 0, nil, bytesValue, 1000},
+		{"bytes", bytesValue, []string{"create"}, 1, nil, "new", 1000},
+		{"bytes", bytesValue, []string{"NX"}, 0, ErrSyntax, bytesValue, 1000},
+		{"dict", "", nil, 0, ErrWrongType, "", -1},
+		{"404", "", nil, 0, nil, "", -2},
+		{"404", "", []string{"CREATE"}, 1, nil, "new", -1},
+		{"404", "old", []string{"CREATE"}, 0, nil, "", -2},
+		{"expired", "Expired", nil, 0, nil, "", -2},
+		{"expired", "", []string{"CREATE"}, 1, nil, "new", -1},
+	}
+
+	for _, tst := range tests {
+		c := New(NewMockStorage())
+
+		result, err := c.CompareAndSwap(tst.key, []byte(tst.expected), []byte("new"), tst.options)
+		if result != tst.wantResult || err != tst.wantErr {
+			t.Errorf("CompareAndSwap(%q, %q, %q): got %d, %v, want %d, %v", tst.key, tst.expected, tst.options, result, err, tst.wantResult, tst.wantErr)
+		}
+		if got, _ := c.Get(tst.key); tst.wantErr == nil && string(got) != tst.wantValue {
+			t.Errorf("CompareAndSwap(%q, %q, %q): got value %q, want %q", tst.key, tst.expected, tst.options, got, tst.wantValue)
+		}
+		if ttl, _ := c.Ttl(tst.key); ttl != tst.wantTtl {
+			t.Errorf("CompareAndSwap(%q, %q, %q): got TTL %d, want %d", tst.key, tst.expected, tst.options, ttl, tst.wantTtl)
+		}
+	}
+}
+
+func TestCore_CompareAndSwapConcurrent(t *testing.T) {
+	const racers = 50
+
+	for _, existing := range []bool{true, false} {
+		c := New(NewStorageHash())
+		expected := ""
+		if existing {
+			expected = "old"
+			c.Set("key", []byte(expected))
+		}
+
+		var (
+			wg        sync.WaitGroup
+			succeeded int64
+		)
+		start := make(chan struct{})
+		for i := 0; i < racers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				result, err := c.CompareAndSwap("key", []byte(expected), []byte(strconv.Itoa(i)), []string{"CREATE"})
+				if err != nil {
+					t.Errorf("CompareAndSwap(): got err %v", err)
+				}
+				atomic.AddInt64(&succeeded, int64(result))
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+
+		if succeeded != 1 {
+			t.Errorf("existing key %t: got %d successful CompareAndSwap, want exactly 1", existing, succeeded)
+		}
+	}
+}
+
+func TestCore_SetKeepTtlConcurrentExpire(t *testing.T) {
+	c := New(NewStorageHash())
+
+	// EXPIRE, concurrent with SET KEEPTTL, must not be lost regardless of the order
+	for i := 0; i < 1000; i++ {
+		c.SetEx("key", 1000, []byte("old"))
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			c.SetWithOptions("key", []byte("new"), []string{"KEEPTTL"})
+		}()
+		go func() {
+			defer wg.Done()
+			c.Expire("key", 5000)
+		}()
+		wg.Wait()
+
+		if ttl, _ := c.Ttl("key"); ttl != 5000 {
+			t.Fatalf("iteration %d: got TTL %d, want 5000", i, ttl)
+		}
+	}
+}
+
+func TestCore_Type(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"bytes", "string"},
+		{"dict", "hash"},
+		{"list", "list"},
+		{"zset", "zset"},
+		{"expired", "none"},
+		{"404", "none"},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		if got := c.Type(tst.key); got != tst.want {
+			t.Errorf("Type(%q): got %q, want %q", tst.key, got, tst.want)
+		}
+	}
+}
+
 func TestCore_Persist(t *testing.T) {
 	tests := []struct {
 		key        string
@@ -931,3 +1718,1138 @@ func TestCore_Ttl(t *testing.T) {
 		}
 	}
 }
+
+func TestCore_ExpireTime(t *testing.T) {
+	c := New(NewMockStorage())
+	wantMs := time.Now().Add(1000*time.Second).UnixNano() / int64(time.Millisecond)
+
+	if got, _ := c.PExpireTime("bytes"); got < wantMs-1000 || got > wantMs {
+		t.Errorf("PExpireTime(%q): got %d, want about %d", "bytes", got, wantMs)
+	}
+	if got, _ := c.ExpireTime("bytes"); got < wantMs/1000-1 || got > wantMs/1000+1 {
+		t.Errorf("ExpireTime(%q): got %d, want about %d", "bytes", got, wantMs/1000)
+	}
+
+	tests := []struct {
+		key  string
+		want int64
+	}{
+		{"dict", -1},
+		{"404", -2},
+		{"expired", -2},
+	}
+	for _, tst := range tests {
+		if got, err := c.ExpireTime(tst.key); got != tst.want || err != nil {
+			t.Errorf("ExpireTime(%q): got %d, %v, want %d", tst.key, got, err, tst.want)
+		}
+		if got, err := c.PExpireTime(tst.key); got != tst.want || err != nil {
+			t.Errorf("PExpireTime(%q): got %d, %v, want %d", tst.key, got, err, tst.want)
+		}
+	}
+}
+
+func TestCore_Version(t *testing.T) {
+	tests := []struct {
+		key         string
+		modify      func(c *Core)
+		wantChanged bool
+	}{
+		{"bytes", func(c *Core) { c.Get("bytes") }, false},
+		{"bytes", func(c *Core) { c.Set("bytes", []byte("new")) }, true},
+		{"dict", func(c *Core) { c.DSet("dict", "banana", []byte("papa")) }, true},
+		{"dict", func(c *Core) { c.DDel("dict", []string{"404"}) }, false},
+		{"dict", func(c *Core) { c.DDel("dict", []string{"banana"}) }, true},
+		{"list", func(c *Core) { c.LPush("list", [][]byte{[]byte("Accept")}) }, true},
+		{"list", func(c *Core) { c.LSet("list", 0, []byte("Accept")) }, true},
+		{"list", func(c *Core) { c.LPop("list") }, true},
+		{"list", func(c *Core) { c.Expire("list", 100) }, true},
+		{"list", func(c *Core) { c.Persist("list") }, true},
+		{"list", func(c *Core) { c.Del([]string{"list"}) }, true},
+	}
+
+	c := New(NewMockStorage())
+
+	if v := c.Version("404"); v != 0 {
+		t.Errorf("Version(%q): got %d, want 0", "404", v)
+	}
+	if v := c.Version("expired"); v != 0 {
+		t.Errorf("Version(%q): got %d, want 0", "expired", v)
+	}
+
+	for i, tst := range tests {
+		before := c.Version(tst.key)
+		tst.modify(c)
+		after := c.Version(tst.key)
+
+		if (before != after) != tst.wantChanged {
+			t.Errorf("testcase %d: Version(%q) changed: %t, want %t", i, tst.key, before != after, tst.wantChanged)
+		}
+	}
+}
+
+func TestCore_SetExpiredHandler(t *testing.T) {
+	expired := NewItemBytes([]byte("expired"))
+	expired.SetMilliTtl(1)
+	fresh := NewItemBytes([]byte("fresh"))
+	fresh.SetTtl(100)
+
+	e := NewStorageHash()
+	e.SetData(map[string]*Item{"expired": expired, "fresh": fresh, "persistent": NewItemBytes([]byte("persistent"))})
+	c := New(e)
+
+	var got []string
+	c.SetExpiredHandler(func(key string) {
+		got = append(got, key)
+	})
+
+	time.Sleep(2 * time.Millisecond)
+	c.CollectExpired()
+
+	if diff := deep.Equal(got, []string{"expired"}); diff != nil {
+		t.Error(diff)
+	}
+
+	// item, replaced after it was found expired, isn't removed and reported
+	replaced := NewItemBytes([]byte("replaced"))
+	replaced.SetMilliTtl(1)
+	e.AddOrReplaceOne("replaced", NewItemBytes([]byte("new")))
+	got = nil
+	if count := c.DelExpired(map[string]*Item{"replaced": replaced}); count != 0 || got != nil {
+		t.Errorf("DelExpired() of replaced item: got count %d and expired %q, want nothing", count, got)
+	}
+}
+
+func TestCore_At(t *testing.T) {
+	c := New(NewStorageHash())
+	start := time.Now().Add(-time.Minute)
+	at := func(seconds int) *Core {
+		return c.At(start.Add(time.Duration(seconds) * time.Second))
+	}
+
+	// writes, done before expiration, are applied to the volatile key, so it's expired now
+	if _, err := at(0).DSetManyEx("before", 10, [][]byte{[]byte("f1"), []byte("v1")}); err != nil {
+		t.Fatalf("DSetManyEx(): %s", err)
+	}
+	if _, err := at(5).DSetMany("before", [][]byte{[]byte("f2"), []byte("v2")}); err != nil {
+		t.Fatalf("DSetMany(): %s", err)
+	}
+	if got := c.Type("before"); got != "none" {
+		t.Errorf("write before expiration: got %s key, want expired one", got)
+	}
+
+	// writes, done after expiration, create a new persistent key
+	if _, err := at(0).LPush("after", [][]byte{[]byte("a")}); err != nil {
+		t.Fatalf("LPush(): %s", err)
+	}
+	if got := at(0).Expire("after", 10); got != 1 {
+		t.Errorf("Expire(): got %d, want 1", got)
+	}
+	if _, err := at(30).LPush("after", [][]byte{[]byte("b")}); err != nil {
+		t.Fatalf("LPush(): %s", err)
+	}
+	if got, err := c.LRange("after", 0, -1); err != nil || fmt.Sprintf("%q", got) != `["b"]` {
+		t.Errorf("write after expiration: got %q, %v, want [\"b\"]", got, err)
+	}
+	if got, _ := c.Ttl("after"); got != -1 {
+		t.Errorf("write after expiration: got TTL %d, want -1", got)
+	}
+
+	// relative TTL is counted from the moment of the request
+	if err := at(50).SetWithOptions("px", []byte("a"), []string{"PX", "20000"}); err != nil {
+		t.Fatalf("SetWithOptions(): %s", err)
+	}
+	if got, _ := c.Ttl("px"); got < 9 || got > 11 {
+		t.Errorf("SET PX 20000 done 10s ago: got TTL %d, want 10", got)
+	}
+}
+
+func TestCore_Object(t *testing.T) {
+	tests := []struct {
+		key          string
+		wantEncoding string
+		wantErr      error
+	}{
+		{"bytes", "raw", nil},
+		{"list", "linkedlist", nil},
+		{"dict", "hashtable", nil},
+		{"expired", "", ErrNotFound},
+		{"404", "", ErrNotFound},
+	}
+
+	c := New(NewMockStorage())
+	for _, tst := range tests {
+		encoding, err := c.ObjectEncoding(tst.key)
+		if encoding != tst.wantEncoding || err != tst.wantErr {
+			t.Errorf("ObjectEncoding(%q): got %q, %v, want %q, %v", tst.key, encoding, err, tst.wantEncoding, tst.wantErr)
+		}
+
+		_, err = c.ObjectIdletime(tst.key)
+		if err != tst.wantErr {
+			t.Errorf("ObjectIdletime(%q) err: got %v, want %v", tst.key, err, tst.wantErr)
+		}
+	}
+}
+
+func TestCore_ObjectRefcount(t *testing.T) {
+	tests := []struct {
+		key     string
+		value   string
+		want    int
+		wantErr error
+	}{
+		{"zero", "0", SharedRefcount, nil},
+		{"small", "42", SharedRefcount, nil},
+		{"max", "9999", SharedRefcount, nil},
+		{"big", "10000", 1, nil},
+		{"padded", "042", 1, nil},
+		{"negative", "-1", 1, nil},
+		{"empty", "", 1, nil},
+		{"string", "val", 1, nil},
+		{"list", "", 1, nil},
+		{"expired", "", 0, ErrNotFound},
+		{"404", "", 0, ErrNotFound},
+	}
+
+	c := New(NewMockStorage())
+	for _, tst := range tests {
+		if tst.wantErr == nil && tst.key != "list" {
+			c.Set(tst.key, []byte(tst.value))
+		}
+
+		count, err := c.ObjectRefcount(tst.key)
+		if count != tst.want || err != tst.wantErr {
+			t.Errorf("ObjectRefcount(%q): got %d, %v, want %d, %v", tst.key, count, err, tst.want, tst.wantErr)
+		}
+	}
+
+	c.IncrByFloat("counter", "7")
+	if count, _ := c.ObjectRefcount("counter"); count != SharedRefcount {
+		t.Errorf("ObjectRefcount(counter) after INCRBYFLOAT: got %d, want %d", count, SharedRefcount)
+	}
+}
+
+func TestCore_SharedIntegersCopyOnWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Core, key string)
+		want   string
+	}{
+		{"SetBit", func(c *Core, key string) { c.SetBit(key, 6, 1) }, "7"},
+		{"SetRange", func(c *Core, key string) { c.SetRange(key, 0, []byte("8")) }, "8"},
+		{"BitField", func(c *Core, key string) { c.BitField(key, []string{"INCRBY", "u8", "0", "4"}) }, "9"},
+	}
+
+	for _, tst := range tests {
+		c := New(NewMockStorage())
+		c.Set("changed", []byte("5"))
+		c.Set("other", []byte("5"))
+
+		tst.change(c, "changed")
+		if got, _ := c.Get("changed"); string(got) != tst.want {
+			t.Errorf("%s: got %q, want %q", tst.name, got, tst.want)
+		}
+		if got, _ := c.Get("other"); string(got) != "5" {
+			t.Errorf("%s changed the shared value: got %q, want %q", tst.name, got, "5")
+		}
+		if count, _ := c.ObjectRefcount("changed"); count != 1 {
+			t.Errorf("%s: ObjectRefcount() of the changed value %d, want 1", tst.name, count)
+		}
+	}
+}
+
+// BenchmarkCore_SetSmallIntegers measures live heap per key of 1M keys with values 0..9999, that are shared,
+// compared to 5-digit values, that aren't
+func BenchmarkCore_SetSmallIntegers(b *testing.B) {
+	keys := make([]string, 1000000)
+	for i := range keys {
+		keys[i] = "counter:" + strconv.Itoa(i)
+	}
+
+	for _, bench := range []struct {
+		name string
+		base int
+	}{
+		{"shared", 0},
+		{"private", SharedIntegersCount},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			var before, after runtime.MemStats
+			for i := 0; i < b.N; i++ {
+				c := New(NewStorageHash())
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				for n, key := range keys {
+					c.Set(key, []byte(strconv.Itoa(bench.base+n%SharedIntegersCount)))
+				}
+
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/float64(len(keys)), "heap-B/key")
+				runtime.KeepAlive(c)
+			}
+		})
+	}
+}
+
+func TestCore_Meta(t *testing.T) {
+	SetTrackTimestamps(true)
+	defer SetTrackTimestamps(false)
+
+	storage := NewStorageHash()
+	c := New(storage)
+	meta := func(key string) (fields map[string]int64) {
+		result, err := c.Meta(key)
+		if err != nil {
+			t.Fatalf("Meta(%q): %s", key, err)
+		}
+		fields = map[string]int64{}
+		for i := 0; i < len(result); i += 2 {
+			fields[string(result[i])], _ = strconv.ParseInt(string(result[i+1]), 10, 64)
+		}
+		return fields
+	}
+	nowMilli := func() int64 { return time.Now().UnixNano() / int64(time.Millisecond) }
+
+	before := nowMilli()
+	c.LPush("list", [][]byte{[]byte("a")})
+	created := meta("list")
+	if created["created"] < before || created["created"] > nowMilli() || created["modified"] != created["created"] || created["ttl"] != -1 {
+		t.Errorf("Meta(list) after creation: got %v", created)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	c.LPush("list", [][]byte{[]byte("b")})
+	c.Expire("list", 100)
+	modified := meta("list")
+	if modified["created"] != created["created"] || modified["modified"] <= created["modified"] || modified["ttl"] != 100 {
+		t.Errorf("Meta(list) after modification: got %v, created %v", modified, created)
+	}
+
+	// reads don't change modification time
+	c.LRange("list", 0, -1)
+	if got := meta("list"); got["modified"] != modified["modified"] {
+		t.Errorf("Meta(list) after read: got %v, want modified %d", got, modified["modified"])
+	}
+
+	// timestamps are persisted
+	buf := bytes.NewBuffer(nil)
+	if err := storage.Persist(buf, 0); err != nil {
+		t.Fatalf("Persist(): %s", err)
+	}
+	c = New(NewStorageHash())
+	if _, err := c.Storage().(*StorageHash).Load(buf); err != nil {
+		t.Fatalf("Load(): %s", err)
+	}
+	if got := meta("list"); got["created"] != modified["created"] || got["modified"] != modified["modified"] {
+		t.Errorf("Meta(list) after load: got %v, want %v", got, modified)
+	}
+
+	SetTrackTimestamps(false)
+	c.Set("untracked", []byte("value"))
+	if got := meta("untracked"); got["created"] != -1 || got["modified"] != -1 {
+		t.Errorf("Meta(untracked): got %v, want -1 times", got)
+	}
+	c.LPush("list", [][]byte{[]byte("c")})
+	if got := meta("list"); got["modified"] != modified["modified"] {
+		t.Errorf("Meta(list) after untracked modification: got %v, want modified %d", got, modified["modified"])
+	}
+
+	if _, err := c.Meta("404"); err != ErrNotFound {
+		t.Errorf("Meta(404): got err %v, want %v", err, ErrNotFound)
+	}
+
+	// requests, replayed from WAL, are recorded at their time instead of time of the replay
+	SetTrackTimestamps(true)
+	replayedAt := time.Unix(1500000000, 0)
+	c.At(replayedAt).LPush("replayed", [][]byte{[]byte("a")})
+	c.At(replayedAt.Add(time.Second)).LPush("replayed", [][]byte{[]byte("b")})
+	if got := meta("replayed"); got["created"] != 1500000000000 || got["modified"] != 1500000001000 {
+		t.Errorf("Meta(replayed): got %v, want times of the requests", got)
+	}
+}
+
+func TestCore_DebugObject(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    []string
+		wantErr error
+	}{
+		{"list", []string{"refcount:1", "encoding:linkedlist", "serializedlength:18", "list_length:3"}, nil},
+		{"dict", []string{"encoding:hashtable", "serializedlength:40"}, nil},
+		{"zset", []string{"encoding:skiplist", "serializedlength:116"}, nil},
+		{"expired", nil, ErrNotFound},
+		{"404", nil, ErrNotFound},
+	}
+
+	c := New(NewMockStorage())
+	for _, tst := range tests {
+		got, err := c.DebugObject(tst.key)
+		if err != tst.wantErr {
+			t.Errorf("DebugObject(%q) err: got %v, want %v", tst.key, err, tst.wantErr)
+		}
+		for _, field := range tst.want {
+			if !strings.Contains(" "+got+" ", " "+field+" ") {
+				t.Errorf("DebugObject(%q): got %q, want %s", tst.key, got, field)
+			}
+		}
+	}
+
+	if got, _ := c.DebugObject("dict"); strings.Contains(got, "list_length") {
+		t.Errorf("DebugObject(dict): got %q, want no list_length", got)
+	}
+}
+
+func TestCore_SetBit(t *testing.T) {
+	tests := []struct {
+		key           string
+		offset, value int
+		err           error
+		wantResult    int
+		wantBytes     string
+	}{
+		{"404", 7, 1, nil, 0, "\x01"},
+		{"404", 0, 1, nil, 0, "\x81"},
+		{"404", 7, 0, nil, 1, "\x80"},
+		{"404", 7, 0, nil, 0, "\x80"},
+		{"404", 17, 1, nil, 0, "\x80\x00\x40"},
+		{"expired", 1, 1, nil, 0, "\x40"},
+		{"404", -1, 1, ErrBitOffset, 0, "\x80\x00\x40"},
+		{"404", MaxBytesLength * 8, 1, ErrBitOffset, 0, "\x80\x00\x40"},
+		{"404", 1, 2, ErrBitValue, 0, "\x80\x00\x40"},
+		{"new", 1, 2, ErrBitValue, 0, ""},
+		{"list", 1, 1, ErrWrongType, 0, ""},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		result, err := c.SetBit(tst.key, tst.offset, tst.value)
+		if err != tst.err {
+			t.Errorf("SetBit(%q, %d, %d) err: %q != %q", tst.key, tst.offset, tst.value, err, tst.err)
+		}
+		if result != tst.wantResult {
+			t.Errorf("SetBit(%q, %d, %d): %d != %d", tst.key, tst.offset, tst.value, result, tst.wantResult)
+		}
+
+		if tst.err == ErrWrongType {
+			continue
+		}
+		if got, _ := c.Get(tst.key); string(got) != tst.wantBytes {
+			t.Errorf("SetBit(%q, %d, %d) bytes: %q != %q", tst.key, tst.offset, tst.value, got, tst.wantBytes)
+		}
+	}
+}
+
+func TestCore_GetBit(t *testing.T) {
+	tests := []struct {
+		key    string
+		offset int
+		err    error
+		want   int
+	}{
+		{"bits", 0, nil, 0},
+		{"bits", 1, nil, 1},
+		{"bits", 2, nil, 0},
+		{"bits", 15, nil, 1},
+		{"bits", 100, nil, 0},
+		{"bits", -1, ErrBitOffset, 0},
+		{"404", 1, nil, 0},
+		{"expired", 1, nil, 0},
+		{"dict", 1, ErrWrongType, 0},
+	}
+
+	c := New(NewMockStorage())
+	c.Set("bits", []byte("AC"))
+
+	for _, tst := range tests {
+		result, err := c.GetBit(tst.key, tst.offset)
+		if err != tst.err {
+			t.Errorf("GetBit(%q, %d) err: %q != %q", tst.key, tst.offset, err, tst.err)
+		}
+		if result != tst.want {
+			t.Errorf("GetBit(%q, %d): %d != %d", tst.key, tst.offset, result, tst.want)
+		}
+	}
+}
+
+func TestCore_BitCount(t *testing.T) {
+	tests := []struct {
+		key    string
+		bounds []int
+		err    error
+		want   int64
+	}{
+		{"bits", nil, nil, 26},
+		{"bits", []int{0, 0}, nil, 4},
+		{"bits", []int{1, 1}, nil, 6},
+		{"bits", []int{-2, -1}, nil, 7},
+		{"bits", []int{5, 100}, nil, 4},
+		{"bits", []int{100, 200}, nil, 0},
+		{"bits", []int{3, 1}, nil, 0},
+		{"bits", []int{1}, ErrSyntax, 0},
+		{"404", nil, nil, 0},
+		{"expired", nil, nil, 0},
+		{"list", nil, ErrWrongType, 0},
+	}
+
+	c := New(NewMockStorage())
+	c.Set("bits", []byte("foobar"))
+
+	for _, tst := range tests {
+		count, err := c.BitCount(tst.key, tst.bounds)
+		if err != tst.err {
+			t.Errorf("BitCount(%q, %v) err: %q != %q", tst.key, tst.bounds, err, tst.err)
+		}
+		if count != tst.want {
+			t.Errorf("BitCount(%q, %v): %d != %d", tst.key, tst.bounds, count, tst.want)
+		}
+	}
+}
+
+func TestCore_BitField(t *testing.T) {
+	tests := []struct {
+		key       string
+		ops       string
+		err       error
+		want      string
+		wantBytes string
+	}{
+		{"404", "SET i8 0 100", nil, "[0]", "\x64"},
+		{"404", "INCRBY i8 0 100", nil, "[-56]", "\xc8"},
+		{"404", "OVERFLOW SAT INCRBY i8 0 -100 GET u8 0", nil, "[-128 128]", "\x80"},
+		{"404", "OVERFLOW FAIL INCRBY i8 0 -1 INCRBY u8 0 127", nil, "[<nil> 255]", "\xff"},
+		{"404", "overflow wrap incrby u8 0 1 get i8 0", nil, "[0 0]", "\x00"},
+		{"404", "SET u4 #1 15 GET i4 4 GET u4 0", nil, "[0 -1 0]", "\x0f"},
+		{"404", "OVERFLOW SAT SET u4 0 -1 SET i4 4 8", nil, "[0 -1]", "\xf7"},
+		{"404", "OVERFLOW FAIL SET u2 14 4 SET u1 16 1", nil, "[<nil> 0]", "\xf7\x00\x80"},
+		{"404", "GET u8 100 GET i16 4", nil, "[0 28680]", "\xf7\x00\x80"},
+		{"i64", "SET i64 0 9223372036854775807 INCRBY i64 0 1", nil, "[0 -9223372036854775808]", "\x80\x00\x00\x00\x00\x00\x00\x00"},
+		{"i64", "OVERFLOW SAT INCRBY i64 0 -1 SET u63 0 -1", nil, "[-9223372036854775808 4611686018427387904]", "\xff\xff\xff\xff\xff\xff\xff\xfe"},
+		{"new", "GET u8 0 GET i64 #100", nil, "[0 0]", ""},
+		{"grown", "OVERFLOW FAIL SET u2 #4 4", nil, "[<nil>]", "\x00\x00"},
+		{"new", "GET u64 0", ErrBitFieldType, "[]", ""},
+		{"new", "SET i0 0 1", ErrBitFieldType, "[]", ""},
+		{"new", "SET x8 0 1", ErrBitFieldType, "[]", ""},
+		{"new", "SET i65 0 1", ErrBitFieldType, "[]", ""},
+		{"new", "OVERFLOW NONE SET i8 0 1", ErrOverflowType, "[]", ""},
+		{"new", "SET i8 0 1 GET i8", ErrSyntax, "[]", ""},
+		{"new", "SET i8 0 1 DEL", ErrSyntax, "[]", ""},
+		{"new", "SET i8 0 1 OVERFLOW", ErrSyntax, "[]", ""},
+		{"new", "SET i8 -1 1", ErrBitOffset, "[]", ""},
+		{"new", "SET i8 #-1 1", ErrBitOffset, "[]", ""},
+		{"new", fmt.Sprintf("SET i8 %d 1", MaxBytesLength*8-7), ErrBitOffset, "[]", ""},
+		{"new", fmt.Sprintf("GET i8 #%d", MaxBytesLength), ErrBitOffset, "[]", ""},
+		{"new", "SET i8 0 foo", ErrNotInt, "[]", ""},
+		{"list", "GET i8 0", ErrWrongType, "[]", ""},
+		{"list", "SET i8 0 1", ErrWrongType, "[]", ""},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		result, err := c.BitField(tst.key, strings.Fields(tst.ops))
+		if err != tst.err {
+			t.Errorf("BitField(%q, %q) err: %q != %q", tst.key, tst.ops, err, tst.err)
+		}
+
+		got := make([]string, len(result))
+		for i, v := range result {
+			if v == nil {
+				got[i] = "<nil>"
+			} else {
+				got[i] = strconv.FormatInt(*v, 10)
+			}
+		}
+		if gotString := fmt.Sprintf("%v", got); gotString != tst.want {
+			t.Errorf("BitField(%q, %q): %s != %s", tst.key, tst.ops, gotString, tst.want)
+		}
+
+		if tst.err == ErrWrongType {
+			continue
+		}
+		if got, _ := c.Get(tst.key); string(got) != tst.wantBytes {
+			t.Errorf("BitField(%q, %q) bytes: %q != %q", tst.key, tst.ops, got, tst.wantBytes)
+		}
+	}
+
+	if c.Version("new") != 0 {
+		t.Errorf("BitField() created key by GET or invalid request")
+	}
+}
+
+func TestCore_BitOp(t *testing.T) {
+	tests := []struct {
+		operation, destKey string
+		keys               []string
+		err                error
+		wantLength         int64
+		wantErrGet         error
+		want               string
+	}{
+		{"and", "dst", []string{"a", "b"}, nil, 3, nil, "\x01\x00\x00"},
+		{"OR", "dst", []string{"a", "b"}, nil, 3, nil, "\x0f\xf0\x02"},
+		{"XOR", "dst", []string{"a", "b", "a"}, nil, 3, nil, "\x0f\xf0\x02"},
+		{"NOT", "dst", []string{"a"}, nil, 1, nil, "\xfe"},
+		{"NOT", "a", []string{"a"}, nil, 1, nil, "\xfe"},
+		{"AND", "bytes", []string{"404", "expired"}, nil, 0, ErrNotFound, ""},
+		{"NOT", "dst", []string{"a", "b"}, ErrBitOpNot, 0, nil, "\xfe"},
+		{"NAND", "dst", []string{"a", "b"}, ErrSyntax, 0, nil, "\xfe"},
+		{"AND", "dst", []string{"a", "list"}, ErrWrongType, 0, nil, "\xfe"},
+	}
+
+	c := New(NewMockStorage())
+	c.Set("a", []byte("\x01"))
+	c.Set("b", []byte("\x0f\xf0\x02"))
+
+	for _, tst := range tests {
+		length, err := c.BitOp(tst.operation, tst.destKey, tst.keys)
+		if err != tst.err {
+			t.Errorf("BitOp(%q, %q, %q) err: %q != %q", tst.operation, tst.destKey, tst.keys, err, tst.err)
+		}
+		if length != tst.wantLength {
+			t.Errorf("BitOp(%q, %q, %q): %d != %d", tst.operation, tst.destKey, tst.keys, length, tst.wantLength)
+		}
+
+		got, err := c.Get(tst.destKey)
+		if err != tst.wantErrGet || string(got) != tst.want {
+			t.Errorf("BitOp(%q, %q, %q) result: %q, %v != %q, %v", tst.operation, tst.destKey, tst.keys, got, err, tst.want, tst.wantErrGet)
+		}
+	}
+}
+
+func TestCore_GetRange(t *testing.T) {
+	tests := []struct {
+		key        string
+		start, end int
+		err        error
+		want       string
+	}{
+		{"str", 0, 3, nil, "This"},
+		{"str", -3, -1, nil, "ing"},
+		{"str", 0, -1, nil, "This is a string"},
+		{"str", 10, 100, nil, "string"},
+		{"str", 100, 200, nil, ""},
+		{"str", 5, 2, nil, ""},
+		{"str", -100, 1, nil, "Th"},
+		{"404", 0, -1, nil, ""},
+		{"expired", 0, -1, nil, ""},
+		{"list", 0, -1, ErrWrongType, ""},
+	}
+
+	c := New(NewMockStorage())
+	c.Set("str", []byte("This is a string"))
+
+	for _, tst := range tests {
+		result, err := c.GetRange(tst.key, tst.start, tst.end)
+		if err != tst.err {
+			t.Errorf("GetRange(%q, %d, %d) err: %q != %q", tst.key, tst.start, tst.end, err, tst.err)
+		}
+		if string(result) != tst.want {
+			t.Errorf("GetRange(%q, %d, %d): %q != %q", tst.key, tst.start, tst.end, result, tst.want)
+		}
+	}
+}
+
+func TestCore_SetRange(t *testing.T) {
+	tests := []struct {
+		key        string
+		offset     int
+		value      string
+		err        error
+		wantLength int64
+		wantErrGet error
+		want       string
+	}{
+		{"str", 6, "Redis", nil, 11, nil, "Hello Redis"},
+		{"str", 11, "!", nil, 12, nil, "Hello Redis!"},
+		{"str", 14, "?", nil, 15, nil, "Hello Redis!\x00\x00?"},
+		{"str", 0, "", nil, 15, nil, "Hello Redis!\x00\x00?"},
+		{"404", 2, "ab", nil, 4, nil, "\x00\x00ab"},
+		{"empty", 2, "", nil, 0, ErrNotFound, ""},
+		{"expired", 0, "new", nil, 3, nil, "new"},
+		{"str", -1, "ab", ErrOffsetRange, 0, nil, "Hello Redis!\x00\x00?"},
+		{"str", MaxBytesLength, "ab", ErrTooLong, 0, nil, "Hello Redis!\x00\x00?"},
+		{"dict", 0, "ab", ErrWrongType, 0, ErrWrongType, ""},
+	}
+
+	c := New(NewMockStorage())
+	c.Set("str", []byte("Hello World"))
+
+	for _, tst := range tests {
+		length, err := c.SetRange(tst.key, tst.offset, []byte(tst.value))
+		if err != tst.err {
+			t.Errorf("SetRange(%q, %d, %q) err: %q != %q", tst.key, tst.offset, tst.value, err, tst.err)
+		}
+		if length != tst.wantLength {
+			t.Errorf("SetRange(%q, %d, %q): %d != %d", tst.key, tst.offset, tst.value, length, tst.wantLength)
+		}
+
+		got, err := c.Get(tst.key)
+		if err != tst.wantErrGet || string(got) != tst.want {
+			t.Errorf("SetRange(%q, %d, %q) value: %q, %v != %q, %v", tst.key, tst.offset, tst.value, got, err, tst.want, tst.wantErrGet)
+		}
+	}
+}
+
+func TestCore_DumpRestore(t *testing.T) {
+	tests := []struct {
+		key          string
+		restoreKey   string
+		milliseconds int
+		options      []string
+		wantErr      error
+		wantExists   bool
+	}{
+		{"bytes", "bytes_copy", 0, nil, nil, true},
+		{"list", "list_copy", 0, nil, nil, true},
+		{"dict", "dict_copy", 10000, nil, nil, true},
+		{"測", "bytes", 0, nil, ErrBusyKey, true},
+		{"測", "bytes", 0, []string{"REPLACE"}, nil, true},
+		{"list", "expired", 0, nil, nil, true},
+		{"dict", "dict", -1, []string{"REPLACE"}, nil, false},
+		{"list", "404", 0, []string{"FOO"}, ErrSyntax, false},
+	}
+
+	storage := NewMockStorage()
+	c := New(storage)
+
+	for _, tst := range tests {
+		dump, err := c.Dump(tst.key)
+		if err != nil {
+			t.Fatalf("Dump(%q) err: %q", tst.key, err)
+		}
+		want := storage.data[tst.key].String()
+
+		err = c.Restore(tst.restoreKey, tst.milliseconds, dump, tst.options)
+		if err != tst.wantErr {
+			t.Errorf("Restore(%q, %d, %q) err: %q != %q", tst.restoreKey, tst.milliseconds, tst.options, err, tst.wantErr)
+		}
+
+		item, exists := storage.data[tst.restoreKey]
+		if exists != tst.wantExists {
+			t.Errorf("Restore(%q, %d, %q) exists: %t != %t", tst.restoreKey, tst.milliseconds, tst.options, exists, tst.wantExists)
+		}
+		if err != nil || !exists {
+			continue
+		}
+		if got := item.String(); got != want {
+			t.Errorf("Restore(%q, %d, %q): %q != %q", tst.restoreKey, tst.milliseconds, tst.options, got, want)
+		}
+		if item.HasTtl() != (tst.milliseconds > 0) {
+			t.Errorf("Restore(%q, %d, %q) HasTtl: %t", tst.restoreKey, tst.milliseconds, tst.options, item.HasTtl())
+		}
+	}
+
+	if _, err := c.Dump("404"); err != ErrNotFound {
+		t.Errorf("Dump(%q) err: %q != %q", "404", err, ErrNotFound)
+	}
+
+	dump, _ := c.Dump("list")
+	dump[0]++
+	if err := c.Restore("corrupted", 0, dump, nil); err != ErrBadDump {
+		t.Errorf("Restore(%q) corrupted dump err: %q != %q", "corrupted", err, ErrBadDump)
+	}
+}
+
+func TestCore_ZAdd(t *testing.T) {
+	tests := []struct {
+		key          string
+		scoreMembers []string
+		err          error
+		wantCount    int64
+		want         string
+	}{
+		{"zset", []string{"1999", "Slipknot", "1990", "Tool"}, nil, 1, "[Kraftwerk Abba Ramones Slayer KMFDM Deftones Tool Rammstein Slipknot]"},
+		{"zset", []string{"1", "Tool", "1", "Abba"}, nil, 0, "[Abba Tool Kraftwerk Ramones Slayer KMFDM Deftones Rammstein Slipknot]"},
+		{"zset", []string{"-inf", "Rammstein", "+inf", "Abba"}, nil, 0, "[Rammstein Tool Kraftwerk Ramones Slayer KMFDM Deftones Slipknot Abba]"},
+		{"zset", []string{"1", "Ramones", "abc", "KMFDM"}, ErrNotFloat, 0, "[Rammstein Tool Kraftwerk Ramones Slayer KMFDM Deftones Slipknot Abba]"},
+		{"zset", []string{"nan", "KMFDM"}, ErrNotFloat, 0, "[Rammstein Tool Kraftwerk Ramones Slayer KMFDM Deftones Slipknot Abba]"},
+		{"zset", []string{"1", "Ramones", "2"}, ErrSyntax, 0, "[Rammstein Tool Kraftwerk Ramones Slayer KMFDM Deftones Slipknot Abba]"},
+		{"404", []string{"2", "b", "1", "c", "1", "a"}, nil, 3, "[a c b]"},
+		{"expired", []string{"2.5", "b"}, nil, 1, "[b]"},
+		{"list", []string{"1", "a"}, ErrWrongType, 0, ""},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		count, err := c.ZAdd(tst.key, tst.scoreMembers)
+		if err != tst.err {
+			t.Errorf("ZAdd(%q, %q) err: %q != %q", tst.key, tst.scoreMembers, err, tst.err)
+		}
+		if count != tst.wantCount {
+			t.Errorf("ZAdd(%q, %q): %d != %d", tst.key, tst.scoreMembers, count, tst.wantCount)
+		}
+		if tst.want == "" {
+			continue
+		}
+
+		members, _ := c.ZRange(tst.key, 0, -1, nil)
+		if got := fmt.Sprintf("%s", members); got != tst.want {
+			t.Errorf("ZAdd(%q, %q) members: %s != %s", tst.key, tst.scoreMembers, got, tst.want)
+		}
+	}
+}
+
+func TestCore_ZScore(t *testing.T) {
+	tests := []struct {
+		key, member string
+		err         error
+		want        string
+	}{
+		{"zset", "Abba", nil, "1972"},
+		{"zset", "Metallica", ErrNotFound, ""},
+		{"404", "Abba", ErrNotFound, ""},
+		{"expired", "Abba", ErrNotFound, ""},
+		{"dict", "banana", ErrWrongType, ""},
+		{"float", "a", nil, "-0.25"},
+		{"float", "b", nil, "inf"},
+	}
+
+	c := New(NewMockStorage())
+	c.ZAdd("float", []string{"-0.25", "a", "inf", "b"})
+
+	for _, tst := range tests {
+		result, err := c.ZScore(tst.key, tst.member)
+		if err != tst.err {
+			t.Errorf("ZScore(%q, %q) err: %q != %q", tst.key, tst.member, err, tst.err)
+		}
+		if string(result) != tst.want {
+			t.Errorf("ZScore(%q, %q): %q != %q", tst.key, tst.member, result, tst.want)
+		}
+	}
+}
+
+func TestCore_ZCard(t *testing.T) {
+	tests := []struct {
+		key  string
+		err  error
+		want int64
+	}{
+		{"zset", nil, 8},
+		{"404", nil, 0},
+		{"expired", nil, 0},
+		{"bytes", ErrWrongType, 0},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		count, err := c.ZCard(tst.key)
+		if err != tst.err {
+			t.Errorf("ZCard(%q) err: %q != %q", tst.key, err, tst.err)
+		}
+		if count != tst.want {
+			t.Errorf("ZCard(%q): %d != %d", tst.key, count, tst.want)
+		}
+	}
+}
+
+func TestCore_ZRank(t *testing.T) {
+	tests := []struct {
+		key, member string
+		err         error
+		want        int
+	}{
+		{"zset", "Kraftwerk", nil, 0},
+		{"zset", "Slayer", nil, 3},
+		{"zset", "Rammstein", nil, 7},
+		{"zset", "Metallica", ErrNotFound, 0},
+		{"404", "Abba", ErrNotFound, 0},
+		{"list", "Abba", ErrWrongType, 0},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		rank, err := c.ZRank(tst.key, tst.member)
+		if err != tst.err {
+			t.Errorf("ZRank(%q, %q) err: %q != %q", tst.key, tst.member, err, tst.err)
+		}
+		if rank != tst.want {
+			t.Errorf("ZRank(%q, %q): %d != %d", tst.key, tst.member, rank, tst.want)
+		}
+	}
+}
+
+func TestCore_ZRange(t *testing.T) {
+	tests := []struct {
+		key         string
+		start, stop int
+		options     []string
+		err         error
+		want        string
+	}{
+		{"zset", 0, -1, nil, nil, "[Kraftwerk Abba Ramones Slayer KMFDM Deftones Tool Rammstein]"},
+		{"zset", 1, 2, []string{"WITHSCORES"}, nil, "[Abba 1972 Ramones 1974]"},
+		{"zset", -2, 100, []string{"withscores"}, nil, "[Tool 1990 Rammstein 1994]"},
+		{"zset", 5, 2, nil, nil, "[]"},
+		{"zset", 100, 200, nil, nil, "[]"},
+		{"zset", 0, 1, []string{"LIMIT"}, ErrSyntax, "[]"},
+		{"404", 0, -1, nil, nil, "[]"},
+		{"expired", 0, -1, nil, nil, "[]"},
+		{"dict", 0, -1, nil, ErrWrongType, "[]"},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		result, err := c.ZRange(tst.key, tst.start, tst.stop, tst.options)
+		if err != tst.err {
+			t.Errorf("ZRange(%q, %d, %d, %q) err: %q != %q", tst.key, tst.start, tst.stop, tst.options, err, tst.err)
+		}
+		if got := fmt.Sprintf("%s", result); got != tst.want {
+			t.Errorf("ZRange(%q, %d, %d, %q): %s != %s", tst.key, tst.start, tst.stop, tst.options, got, tst.want)
+		}
+	}
+}
+
+func TestCore_ZRem(t *testing.T) {
+	tests := []struct {
+		key       string
+		members   []string
+		err       error
+		wantCount int64
+		want      string
+	}{
+		{"zset", []string{"Abba", "Metallica", "Tool"}, nil, 2, "[Kraftwerk Ramones Slayer KMFDM Deftones Rammstein]"},
+		{"zset", []string{"Abba"}, nil, 0, "[Kraftwerk Ramones Slayer KMFDM Deftones Rammstein]"},
+		{"zset", []string{"Kraftwerk", "Rammstein"}, nil, 2, "[Ramones Slayer KMFDM Deftones]"},
+		{"404", []string{"Abba"}, nil, 0, "[]"},
+		{"bytes", []string{"Abba"}, ErrWrongType, 0, "[]"},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		count, err := c.ZRem(tst.key, tst.members)
+		if err != tst.err {
+			t.Errorf("ZRem(%q, %q) err: %q != %q", tst.key, tst.members, err, tst.err)
+		}
+		if count != tst.wantCount {
+			t.Errorf("ZRem(%q, %q): %d != %d", tst.key, tst.members, count, tst.wantCount)
+		}
+
+		members, _ := c.ZRange(tst.key, 0, -1, nil)
+		if got := fmt.Sprintf("%s", members); got != tst.want {
+			t.Errorf("ZRem(%q, %q) members: %s != %s", tst.key, tst.members, got, tst.want)
+		}
+	}
+}
+
+func TestCore_ZIncrBy(t *testing.T) {
+	tests := []struct {
+		key, increment, member string
+		err                    error
+		want                   string
+		wantRank               int
+	}{
+		{"zset", "25", "Abba", nil, "1997", 7},
+		{"zset", "-2.5", "Abba", nil, "1994.5", 7},
+		{"zset", "-1", "Abba", nil, "1993.5", 6},
+		{"zset", "1", "Metallica", nil, "1", 0},
+		{"zset", "+inf", "Tool", nil, "inf", 8},
+		{"zset", "-inf", "Tool", ErrScoreNaN, "", 8},
+		{"zset", "abc", "Tool", ErrNotFloat, "", 8},
+		{"404", "2.5", "a", nil, "2.5", 0},
+		{"expired", "-3", "a", nil, "-3", 0},
+		{"list", "1", "a", ErrWrongType, "", 0},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		result, err := c.ZIncrBy(tst.key, tst.increment, tst.member)
+		if err != tst.err {
+			t.Errorf("ZIncrBy(%q, %q, %q) err: %q != %q", tst.key, tst.increment, tst.member, err, tst.err)
+		}
+		if string(result) != tst.want {
+			t.Errorf("ZIncrBy(%q, %q, %q): %q != %q", tst.key, tst.increment, tst.member, result, tst.want)
+		}
+		if tst.err == ErrWrongType {
+			continue
+		}
+
+		rank, _ := c.ZRank(tst.key, tst.member)
+		if rank != tst.wantRank {
+			t.Errorf("ZIncrBy(%q, %q, %q) rank: %d != %d", tst.key, tst.increment, tst.member, rank, tst.wantRank)
+		}
+	}
+}
+
+func TestCore_ZRangeByScore(t *testing.T) {
+	tests := []struct {
+		key, min, max string
+		options       []string
+		err           error
+		want          string
+	}{
+		{"zset", "-inf", "+inf", nil, nil, "[Kraftwerk Abba Ramones Slayer KMFDM Deftones Tool Rammstein]"},
+		{"zset", "1972", "1984", nil, nil, "[Abba Ramones Slayer KMFDM]"},
+		{"zset", "(1972", "1984", nil, nil, "[Ramones Slayer KMFDM]"},
+		{"zset", "1972", "(1984", nil, nil, "[Abba Ramones Slayer]"},
+		{"zset", "(1972", "(1974", nil, nil, "[]"},
+		{"zset", "1972.5", "1975", []string{"WITHSCORES"}, nil, "[Ramones 1974]"},
+		{"zset", "1990", "inf", []string{"withscores"}, nil, "[Tool 1990 Rammstein 1994]"},
+		{"zset", "1984", "1972", nil, nil, "[]"},
+		{"zset", "-inf", "+inf", []string{"LIMIT", "2", "3"}, nil, "[Ramones Slayer KMFDM]"},
+		{"zset", "-inf", "+inf", []string{"LIMIT", "6", "-1", "WITHSCORES"}, nil, "[Tool 1990 Rammstein 1994]"},
+		{"zset", "-inf", "+inf", []string{"LIMIT", "100", "1"}, nil, "[]"},
+		{"zset", "-inf", "+inf", []string{"LIMIT", "-1", "1"}, nil, "[]"},
+		{"zset", "-inf", "+inf", []string{"LIMIT", "1"}, ErrSyntax, "[]"},
+		{"zset", "-inf", "+inf", []string{"LIMIT", "a", "1"}, ErrSyntax, "[]"},
+		{"zset", "-inf", "+inf", []string{"FOO"}, ErrSyntax, "[]"},
+		{"zset", "abc", "+inf", nil, ErrMinMaxFloat, "[]"},
+		{"zset", "0", "((1", nil, ErrMinMaxFloat, "[]"},
+		{"404", "-inf", "+inf", nil, nil, "[]"},
+		{"bytes", "-inf", "+inf", nil, ErrWrongType, "[]"},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		result, err := c.ZRangeByScore(tst.key, tst.min, tst.max, tst.options)
+		if err != tst.err {
+			t.Errorf("ZRangeByScore(%q, %q, %q, %q) err: %q != %q", tst.key, tst.min, tst.max, tst.options, err, tst.err)
+		}
+		if got := fmt.Sprintf("%s", result); got != tst.want {
+			t.Errorf("ZRangeByScore(%q, %q, %q, %q): %s != %s", tst.key, tst.min, tst.max, tst.options, got, tst.want)
+		}
+	}
+}
+
+func TestCore_DRandField(t *testing.T) {
+	tests := []struct {
+		key        string
+		count      int
+		withValues bool
+		err        error
+		wantLen    int
+		wantUnique bool
+	}{
+		{"dict", 1, false, nil, 1, true},
+		{"dict", 2, true, nil, 4, true},
+		{"dict", 100, false, nil, 2, true},
+		{"dict", -5, false, nil, 5, false},
+		{"dict", -3, true, nil, 6, false},
+		{"dict", 0, false, nil, 0, true},
+		{"404", 3, false, nil, 0, true},
+		{"expired", -3, false, nil, 0, true},
+		{"list", 1, false, ErrWrongType, 0, true},
+		{"dict", -MaxRandFieldCount - 1, false, ErrOutOfRange, 0, true},
+		{"dict", -2000000000000, true, ErrOutOfRange, 0, true},
+		{"dict", math.MinInt64, false, ErrOutOfRange, 0, true},
+		{"404", math.MinInt64, false, ErrOutOfRange, 0, true},
+		{"dict", math.MaxInt64, false, nil, 2, true},
+	}
+
+	storage := NewMockStorage()
+	c := New(storage)
+
+	for _, tst := range tests {
+		result, err := c.DRandField(tst.key, tst.count, tst.withValues)
+		if err != tst.err {
+			t.Errorf("DRandField(%q, %d, %t) err: %q != %q", tst.key, tst.count, tst.withValues, err, tst.err)
+		}
+		if len(result) != tst.wantLen {
+			t.Errorf("DRandField(%q, %d, %t): len(%q) != %d", tst.key, tst.count, tst.withValues, result, tst.wantLen)
+			continue
+		}
+
+		step := 1
+		if tst.withValues {
+			step = 2
+		}
+		seen := map[string]bool{}
+		for i := 0; i < len(result); i += step {
+			field := string(result[i])
+			value, ok := storage.data[tst.key].Dict()[field]
+			if !ok {
+				t.Errorf("DRandField(%q, %d, %t): unknown field %q", tst.key, tst.count, tst.withValues, field)
+			}
+			if tst.withValues && string(result[i+1]) != string(value) {
+				t.Errorf("DRandField(%q, %d, %t): value of %q: %q != %q", tst.key, tst.count, tst.withValues, field, result[i+1], value)
+			}
+			if tst.wantUnique && seen[field] {
+				t.Errorf("DRandField(%q, %d, %t): duplicated field %q", tst.key, tst.count, tst.withValues, field)
+			}
+			seen[field] = true
+		}
+	}
+}
+
+func TestCore_IncrByFloat(t *testing.T) {
+	tests := []struct {
+		key, increment string
+		err            error
+		want           string
+		wantErrGet     error
+		wantValue      string
+	}{
+		{"float", "0.1", nil, "10.6", nil, "10.6"},
+		{"float", "-5", nil, "5.6", nil, "5.6"},
+		{"float", "5.0e3", nil, "5005.6", nil, "5005.6"},
+		{"float", "abc", ErrNotFloat, "", nil, "5005.6"},
+		{"float", "inf", ErrIncrNaN, "", nil, "5005.6"},
+		{"404", "3", nil, "3", nil, "3"},
+		{"new", "+inf", ErrIncrNaN, "", ErrNotFound, ""},
+		{"expired", "1.5", nil, "1.5", nil, "1.5"},
+		{"bytes", "1", ErrNotFloat, "", nil, "Призрак бродит по Европе - призрак коммунизма."},
+		{"list", "1", ErrWrongType, "", ErrWrongType, ""},
+	}
+
+	c := New(NewMockStorage())
+	c.Set("float", []byte("10.5"))
+
+	for _, tst := range tests {
+		result, err := c.IncrByFloat(tst.key, tst.increment)
+		if err != tst.err {
+			t.Errorf("IncrByFloat(%q, %q) err: %q != %q", tst.key, tst.increment, err, tst.err)
+		}
+		if string(result) != tst.want {
+			t.Errorf("IncrByFloat(%q, %q): %q != %q", tst.key, tst.increment, result, tst.want)
+		}
+
+		value, err := c.Get(tst.key)
+		if err != tst.wantErrGet || string(value) != tst.wantValue {
+			t.Errorf("IncrByFloat(%q, %q) value: %q, %v != %q, %v", tst.key, tst.increment, value, err, tst.wantValue, tst.wantErrGet)
+		}
+	}
+}
+
+func TestCore_DIncrByFloat(t *testing.T) {
+	tests := []struct {
+		key, field, increment string
+		err                   error
+		want                  string
+		wantErrGet            error
+		wantValue             string
+	}{
+		{"dict", "float", "1.25", nil, "1.25", nil, "1.25"},
+		{"dict", "float", "-0.5", nil, "0.75", nil, "0.75"},
+		{"dict", "float", "x", ErrNotFloat, "", nil, "0.75"},
+		{"dict", "float", "-inf", ErrIncrNaN, "", nil, "0.75"},
+		{"dict", "banana", "1", ErrHashNotFloat, "", nil, "mama"},
+		{"404", "f", "2", nil, "2", nil, "2"},
+		{"new", "f", "inf", ErrIncrNaN, "", ErrNotFound, ""},
+		{"bytes", "f", "1", ErrWrongType, "", ErrWrongType, ""},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		result, err := c.DIncrByFloat(tst.key, tst.field, tst.increment)
+		if err != tst.err {
+			t.Errorf("DIncrByFloat(%q, %q, %q) err: %q != %q", tst.key, tst.field, tst.increment, err, tst.err)
+		}
+		if string(result) != tst.want {
+			t.Errorf("DIncrByFloat(%q, %q, %q): %q != %q", tst.key, tst.field, tst.increment, result, tst.want)
+		}
+
+		value, err := c.DGet(tst.key, tst.field)
+		if err != tst.wantErrGet || string(value) != tst.wantValue {
+			t.Errorf("DIncrByFloat(%q, %q, %q) value: %q, %v != %q, %v", tst.key, tst.field, tst.increment, value, err, tst.wantValue, tst.wantErrGet)
+		}
+	}
+}
@@ -16,3 +16,15 @@ func (e *StorageHash) Data() map[string]*Item {
 
 	return result
 }
+
+var RdbCrcUpdate = rdbCrcUpdate
+
+// SetKind replaces kind of the item, e.g. to emulate an item of a kind, unknown to this binary
+func (i *Item) SetKind(kind ItemKind) {
+	i.kind = kind
+}
+
+// DelExpired removes expired items, collected by CollectExpired before, and invokes expired handler for them
+func (c *Core) DelExpired(expiredItems map[string]*Item) int {
+	return c.delExpired(expiredItems)
+}
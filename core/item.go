@@ -1,10 +1,17 @@
 package core
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
 	"fmt"
 	"github.com/mshaverdo/assert"
+	"hash/crc32"
+	"math"
 	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,25 +22,62 @@ const (
 	Bytes ItemKind = iota
 	List
 	Dict
+	SortedSet
 )
 
+// lastVersion is a global counter of item versions, so every modification of every item gets unique version
+var lastVersion uint64
+
+// trackTimestamps is 1, if items keep time of creation and the last modification. Accessed atomically
+var trackTimestamps uint32
+
+// SharedIntegersCount is a count of shared integers 0..9999, like Redis OBJ_SHARED_INTEGERS
+const SharedIntegersCount = 10000
+
+// SharedRefcount is a refcount of shared values, like Redis OBJ_SHARED_REFCOUNT
+const SharedRefcount = math.MaxInt32
+
+// sharedIntegers are immutable decimal representations of integers 0..SharedIntegersCount-1, shared by all string items
+// with such values, so millions of small counters don't allocate a byte slice each
+var sharedIntegers = func() (result [SharedIntegersCount][]byte) {
+	for n := range result {
+		result[n] = []byte(strconv.Itoa(n))
+	}
+	return result
+}()
+
 type Item struct {
 	sync.RWMutex
 
 	expireAt time.Time
+	// version changes on every item modification. Used by WATCH to detect changes
+	version uint64
+	// accessedAt is an unix time in nanoseconds of the last access to the item. Accessed atomically
+	accessedAt int64
+	// createdAt and modifiedAt are unix times in nanoseconds of the item creation and the last modification,
+	// set only while timestamps tracking enabled. Zero modifiedAt means, that the item isn't modified since creation
+	createdAt  int64
+	modifiedAt int64
+	// replaced is true, if TTL of the item is copied to a new item by SET KEEPTTL, so TTL of this item
+	// mustn't be changed anymore
+	replaced bool
 
 	kind  ItemKind
 	bytes []byte
 	list  [][]byte
 	dict  map[string][]byte
+	zset  *sortedSet
 }
 
 func NewItemBytes(value []byte) *Item {
 	return &Item{
-		kind:  Bytes,
-		bytes: value,
-		list:  nil,
-		dict:  nil,
+		kind:       Bytes,
+		bytes:      sharedInteger(value),
+		list:       nil,
+		dict:       nil,
+		version:    nextVersion(),
+		accessedAt: time.Now().UnixNano(),
+		createdAt:  trackedNow(),
 	}
 }
 
@@ -44,19 +88,149 @@ func NewItemString(value string) *Item {
 
 func NewItemList(value [][]byte) *Item {
 	return &Item{
-		kind:  List,
-		bytes: nil,
-		list:  value,
-		dict:  nil,
+		kind:       List,
+		bytes:      nil,
+		list:       value,
+		dict:       nil,
+		version:    nextVersion(),
+		accessedAt: time.Now().UnixNano(),
+		createdAt:  trackedNow(),
 	}
 }
 
 func NewItemDict(value map[string][]byte) *Item {
 	return &Item{
-		kind:  Dict,
-		bytes: nil,
-		list:  nil,
-		dict:  value,
+		kind:       Dict,
+		bytes:      nil,
+		list:       nil,
+		dict:       value,
+		version:    nextVersion(),
+		accessedAt: time.Now().UnixNano(),
+		createdAt:  trackedNow(),
+	}
+}
+
+// NewItemSortedSet constructs SortedSet Item from member -> score map
+func NewItemSortedSet(value map[string]float64) *Item {
+	return &Item{
+		kind:       SortedSet,
+		zset:       newSortedSet(value),
+		version:    nextVersion(),
+		accessedAt: time.Now().UnixNano(),
+		createdAt:  trackedNow(),
+	}
+}
+
+// Version returns current version of the item
+func (i *Item) Version() uint64 {
+	return i.version
+}
+
+// Touch updates version of the item. Must be invoked on every modification
+func (i *Item) Touch() {
+	i.version = nextVersion()
+	if now := trackedNow(); now != 0 {
+		i.modifiedAt = now
+	}
+}
+
+// TouchAt updates version of the item, like Touch, but records the modification at the given moment,
+// e.g. at time of the request, replayed from WAL
+func (i *Item) TouchAt(now time.Time) {
+	i.version = nextVersion()
+	if IsTrackTimestamps() {
+		i.modifiedAt = now.UnixNano()
+	}
+}
+
+// setCreatedAt replaces creation time of the new item, if timestamps tracking was enabled on its creation
+func (i *Item) setCreatedAt(now time.Time) {
+	if i.createdAt != 0 {
+		i.createdAt = now.UnixNano()
+	}
+}
+
+// CreatedAt returns time of the item creation, or zero time, if the item is created while timestamps tracking disabled
+func (i *Item) CreatedAt() time.Time {
+	return unixNanoTime(i.createdAt)
+}
+
+// ModifiedAt returns time of the last modification of the item, or its creation time, if it isn't modified since creation.
+// Zero time means, that the item is created and modified while timestamps tracking disabled
+func (i *Item) ModifiedAt() time.Time {
+	if i.modifiedAt == 0 {
+		return i.CreatedAt()
+	}
+
+	return unixNanoTime(i.modifiedAt)
+}
+
+// Access updates last access time of the item. It's safe to invoke it while item is locked for read only
+func (i *Item) Access() {
+	atomic.StoreInt64(&i.accessedAt, time.Now().UnixNano())
+}
+
+// IdleTime returns time passed since the last access to the item
+func (i *Item) IdleTime() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&i.accessedAt)))
+}
+
+// Encoding returns name of internal representation of the item, like Redis OBJECT ENCODING does
+func (i *Item) Encoding() string {
+	switch i.kind {
+	case Bytes:
+		return "raw"
+	case List:
+		return "linkedlist"
+	case Dict:
+		return "hashtable"
+	case SortedSet:
+		return "skiplist"
+	default:
+		assert.True(false, "unknown Item.kind: "+i.kind.String())
+		return ""
+	}
+}
+
+// MemSize returns size of the item value in bytes: length of the string, total length of list elements,
+// hash fields and values, or sorted set members with 8-byte scores. Overhead of Go data structures isn't counted
+func (i *Item) MemSize() (size int) {
+	switch i.kind {
+	case Bytes:
+		return len(i.bytes)
+	case List:
+		for _, v := range i.list {
+			size += len(v)
+		}
+	case Dict:
+		for field, v := range i.dict {
+			size += len(field) + len(v)
+		}
+	case SortedSet:
+		for member := range i.zset.Scores() {
+			size += len(member) + 8
+		}
+	default:
+		assert.True(false, "unknown Item.kind: "+i.kind.String())
+	}
+
+	return size
+}
+
+// TypeName returns name of the item type, like Redis TYPE does
+func (i *Item) TypeName() string {
+	switch i.kind {
+	case Bytes:
+		return "string"
+	case List:
+		return "list"
+	case Dict:
+		return "hash"
+	case SortedSet:
+		return "zset"
+	default:
+		assert.True(false, "unknown Item.kind: "+i.kind.String())
+		return ""
 	}
 }
 
@@ -69,7 +243,32 @@ func (i *Item) Bytes() []byte {
 }
 
 func (i *Item) SetBytes(v []byte) {
-	i.bytes = v
+	i.bytes = sharedInteger(v)
+}
+
+// mutableBytes returns string value, that could be changed in place, grown to at least length bytes with zero padding.
+// Shared integers are copied before changes
+func (i *Item) mutableBytes(length int) []byte {
+	if len(i.bytes) < length || isSharedInteger(i.bytes) {
+		if length < len(i.bytes) {
+			length = len(i.bytes)
+		}
+		grown := make([]byte, length)
+		copy(grown, i.bytes)
+		i.bytes = grown
+	}
+
+	return i.bytes
+}
+
+// Refcount returns count of references to the value, like Redis OBJECT REFCOUNT does:
+// SharedRefcount for shared integers and 1 for other values, that are never shared
+func (i *Item) Refcount() int {
+	if i.kind == Bytes && isSharedInteger(i.bytes) {
+		return SharedRefcount
+	}
+
+	return 1
 }
 
 func (i *Item) List() [][]byte {
@@ -109,6 +308,8 @@ func (i *Item) String() string {
 		result += "]"
 
 		return result
+	case SortedSet:
+		return fmt.Sprintf("%v", i.zset.index)
 	default:
 		assert.True(false, "unknown Item.kind: "+i.kind.String())
 		return ""
@@ -123,6 +324,16 @@ func (i *Item) SetMilliTtl(milliseconds int) {
 	i.expireAt = time.Now().Add(time.Duration(milliseconds) * time.Millisecond)
 }
 
+// SetExpireAt sets the moment of item expiration. Zero time means no expiration
+func (i *Item) SetExpireAt(expireAt time.Time) {
+	i.expireAt = expireAt
+}
+
+// ExpireAt returns the moment of item expiration. Zero time means no expiration
+func (i *Item) ExpireAt() time.Time {
+	return i.expireAt
+}
+
 func (i *Item) RemoveTtl() {
 	i.expireAt = time.Time{}
 }
@@ -137,19 +348,266 @@ func (i *Item) Ttl() (seconds int) {
 }
 
 func (i *Item) IsExpired() bool {
-	return i.HasTtl() && i.expireAt.Before(time.Now())
+	return i.IsExpiredAt(time.Now())
+}
+
+// IsExpiredAt returns true, if the item is expired at provided moment
+func (i *Item) IsExpiredAt(now time.Time) bool {
+	return i.HasTtl() && i.expireAt.Before(now)
 }
 
 func (i *Item) HasTtl() bool {
 	return i.expireAt != time.Time{}
 }
 
+// Equal returns true, if the items have the same kind, value, expiration and version, so one could replace another
+// unnoticed by clients, including WATCH. Empty and nil values are equal. Items must be locked by caller
+func (i *Item) Equal(other *Item) bool {
+	if i.kind != other.kind || i.version != other.version || !i.expireAt.Equal(other.expireAt) {
+		return false
+	}
+
+	switch i.kind {
+	case Bytes:
+		return bytes.Equal(i.bytes, other.bytes)
+	case List:
+		if len(i.list) != len(other.list) {
+			return false
+		}
+		for n := range i.list {
+			if !bytes.Equal(i.list[n], other.list[n]) {
+				return false
+			}
+		}
+		return true
+	case Dict:
+		if len(i.dict) != len(other.dict) {
+			return false
+		}
+		for field, value := range i.dict {
+			otherValue, ok := other.dict[field]
+			if !ok || !bytes.Equal(value, otherValue) {
+				return false
+			}
+		}
+		return true
+	case SortedSet:
+		scores, otherScores := i.zset.Scores(), other.zset.Scores()
+		if len(scores) != len(otherScores) {
+			return false
+		}
+		for member, score := range scores {
+			otherScore, ok := otherScores[member]
+			if !ok || score != otherScore {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// SetTrackTimestamps enables tracking of creation and modification time of items, returned by META command.
+// It costs a clock reading on every modification, and two numbers per item in snapshots
+func SetTrackTimestamps(enabled bool) {
+	var flag uint32
+	if enabled {
+		flag = 1
+	}
+
+	atomic.StoreUint32(&trackTimestamps, flag)
+}
+
+// IsTrackTimestamps returns true, if creation and modification time of items is tracked
+func IsTrackTimestamps() bool {
+	return atomic.LoadUint32(&trackTimestamps) == 1
+}
+
+// sharedIntegerIndex returns integer, represented by value, if it's canonical decimal representation of a shared integer
+func sharedIntegerIndex(value []byte) (n int, ok bool) {
+	if len(value) == 0 || len(value) > 4 || len(value) > 1 && value[0] == '0' {
+		return 0, false
+	}
+
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+
+	return n, true
+}
+
+// sharedInteger returns shared representation of value, if it's a small integer, or value itself.
+// Shared values must never be changed in place
+func sharedInteger(value []byte) []byte {
+	if n, ok := sharedIntegerIndex(value); ok {
+		return sharedIntegers[n]
+	}
+
+	return value
+}
+
+// isSharedInteger returns true, if value is a shared integer, rather than an equal private slice
+func isSharedInteger(value []byte) bool {
+	n, ok := sharedIntegerIndex(value)
+	return ok && &value[0] == &sharedIntegers[n][0]
+}
+
+// trackedNow returns current unix time in nanoseconds, if timestamps tracking enabled, or zero otherwise
+func trackedNow() int64 {
+	if !IsTrackTimestamps() {
+		return 0
+	}
+
+	return time.Now().UnixNano()
+}
+
+// unixNanoTime converts unix time in nanoseconds into time.Time, keeping zero value as zero time
+func unixNanoTime(nsec int64) time.Time {
+	if nsec == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nsec)
+}
+
+func nextVersion() uint64 {
+	return atomic.AddUint64(&lastVersion, 1)
+}
+
+// restoreVersion ensures, that versions generated later will be greater than restored one
+func restoreVersion(version uint64) {
+	for {
+		current := atomic.LoadUint64(&lastVersion)
+		if current >= version || atomic.CompareAndSwapUint64(&lastVersion, current, version) {
+			return
+		}
+	}
+}
+
+// dumpVersion is a version of DUMP format, stored in every dump
+const dumpVersion byte = 1
+
+// Dump serializes value of the item without TTL. Dump format: gob-encoded item | version byte | CRC32 of preceding bytes
+func (i *Item) Dump() ([]byte, error) {
+	var buf bytes.Buffer
+	exp := gobExportItem{
+		Kind:  i.kind,
+		Bytes: i.bytes,
+		List:  i.list,
+		Dict:  i.dict,
+	}
+	if i.kind == SortedSet {
+		exp.SortedSet = i.zset.Scores()
+	}
+	if err := gob.NewEncoder(&buf).Encode(&exp); err != nil {
+		return nil, fmt.Errorf("Item.Dump(): can't encode item: %s", err)
+	}
+
+	buf.WriteByte(dumpVersion)
+	crc := make([]byte, crc32.Size)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(crc)
+
+	return buf.Bytes(), nil
+}
+
+// NewItemFromDump constructs Item from value, serialized by Item.Dump()
+func NewItemFromDump(dump []byte) (*Item, error) {
+	if len(dump) < 1+crc32.Size {
+		return nil, ErrBadDump
+	}
+
+	payloadLen := len(dump) - crc32.Size
+	if crc32.ChecksumIEEE(dump[:payloadLen]) != binary.BigEndian.Uint32(dump[payloadLen:]) {
+		return nil, ErrBadDump
+	}
+	if dump[payloadLen-1] != dumpVersion {
+		return nil, ErrBadDump
+	}
+
+	exp := gobExportItem{}
+	if err := gob.NewDecoder(bytes.NewReader(dump[:payloadLen-1])).Decode(&exp); err != nil {
+		return nil, ErrBadDump
+	}
+
+	switch exp.Kind {
+	case Bytes:
+		if exp.Bytes == nil {
+			// gob doesn't distinguish nil and empty slices
+			exp.Bytes = []byte{}
+		}
+		return NewItemBytes(exp.Bytes), nil
+	case List:
+		return NewItemList(exp.List), nil
+	case Dict:
+		if exp.Dict == nil {
+			exp.Dict = map[string][]byte{}
+		}
+		return NewItemDict(exp.Dict), nil
+	case SortedSet:
+		return NewItemSortedSet(exp.SortedSet), nil
+	default:
+		return nil, ErrBadDump
+	}
+}
+
 type gobExportItem struct {
 	Key string
 
-	ExpireAt time.Time
-	Kind     ItemKind
-	Bytes    []byte
-	List     [][]byte
-	Dict     map[string][]byte
+	ExpireAt   time.Time
+	Version    uint64
+	AccessedAt int64
+	CreatedAt  int64
+	ModifiedAt int64
+	Kind       ItemKind
+	Bytes      []byte
+	List       [][]byte
+	Dict       map[string][]byte
+	SortedSet  map[string]float64
+}
+
+// fill fills exp with the item data. Item must be locked by caller
+func (exp *gobExportItem) fill(key string, i *Item) {
+	exp.Key = key
+	exp.ExpireAt = i.expireAt
+	exp.Version = i.version
+	exp.AccessedAt = i.accessedAt
+	exp.CreatedAt = i.createdAt
+	exp.ModifiedAt = i.modifiedAt
+	exp.Kind = i.kind
+	exp.Bytes = i.bytes
+	exp.List = i.list
+	exp.Dict = i.dict
+	exp.SortedSet = nil
+	if i.kind == SortedSet {
+		exp.SortedSet = i.zset.Scores()
+	}
+}
+
+// item constructs Item from the exported data
+func (exp *gobExportItem) item() (*Item, error) {
+	if exp.Kind < Bytes || exp.Kind > SortedSet {
+		return nil, fmt.Errorf("unknown item kind %d", exp.Kind)
+	}
+
+	i := &Item{
+		version:    exp.Version,
+		accessedAt: exp.AccessedAt,
+		createdAt:  exp.CreatedAt,
+		modifiedAt: exp.ModifiedAt,
+		expireAt:   exp.ExpireAt,
+		kind:       exp.Kind,
+		bytes:      exp.Bytes,
+		list:       exp.List,
+		dict:       exp.Dict,
+	}
+	if exp.Kind == SortedSet {
+		i.zset = newSortedSet(exp.SortedSet)
+	}
+
+	return i, nil
 }
@@ -0,0 +1,1114 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Redis RDB format constants. See https://github.com/sripathikrishnan/redis-rdb-tools/wiki/Redis-RDB-Dump-File-Format
+const (
+	rdbVersion = 9
+
+	rdbTypeString = 0
+	rdbTypeList   = 1
+	rdbTypeHash   = 4
+	rdbTypeZset2  = 5
+
+	rdbOpcodeExpireTimeMs = 0xFC
+	rdbOpcodeSelectDb     = 0xFE
+	rdbOpcodeEof          = 0xFF
+
+	rdbLen6Bit  = 0x00
+	rdbLen14Bit = 0x40
+	rdbLen32Bit = 0x80
+	rdbLen64Bit = 0x81
+)
+
+// rdbCrcTable is a table of CRC-64-Jones, used by Redis, in reversed representation
+var rdbCrcTable = crc64.MakeTable(0x95AC9329AC4BC9B5)
+
+// rdbCrcUpdate returns Redis CRC64 of p, continued from crc. Unlike hash/crc64, Redis doesn't invert crc
+func rdbCrcUpdate(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, rdbCrcTable, p)
+}
+
+// ExportRDB writes all not expired items into w in Redis RDB format, so data could be loaded into Redis.
+// Keys couldn't be added or removed while exporting, but values of existing keys could be modified concurrently
+func (c *Core) ExportRDB(w io.Writer) error {
+	rw := &rdbWriter{w: w}
+
+	rw.write([]byte(fmt.Sprintf("REDIS%04d", rdbVersion)))
+	rw.write([]byte{rdbOpcodeSelectDb})
+	rw.writeLength(0)
+
+	c.storage.ViewKeys(func(forEachKey KeyIterator) {
+		now := time.Now()
+		forEachKey(func(key string, item *Item) {
+			item.RLock()
+			defer item.RUnlock()
+
+			if !item.IsExpiredAt(now) {
+				rw.writeItem(key, item)
+			}
+		})
+	})
+
+	rw.write([]byte{rdbOpcodeEof})
+	crc := make([]byte, 8)
+	binary.LittleEndian.PutUint64(crc, rw.crc)
+	rw.write(crc)
+
+	return rw.err
+}
+
+// rdbWriter writes RDB primitives and calculates checksum. After the first error all writes are skipped
+type rdbWriter struct {
+	w   io.Writer
+	crc uint64
+	err error
+	buf [9]byte
+}
+
+func (rw *rdbWriter) write(p []byte) {
+	if rw.err != nil {
+		return
+	}
+
+	rw.crc = rdbCrcUpdate(rw.crc, p)
+	_, rw.err = rw.w.Write(p)
+}
+
+// writeItem writes item with key and expire time. Item must be locked by caller
+func (rw *rdbWriter) writeItem(key string, item *Item) {
+	if item.HasTtl() {
+		rw.write([]byte{rdbOpcodeExpireTimeMs})
+		binary.LittleEndian.PutUint64(rw.buf[:8], uint64(item.expireAt.UnixNano()/int64(time.Millisecond)))
+		rw.write(rw.buf[:8])
+	}
+
+	switch item.kind {
+	case Bytes:
+		rw.write([]byte{rdbTypeString})
+		rw.writeString([]byte(key))
+		rw.writeString(item.bytes)
+	case List:
+		rw.write([]byte{rdbTypeList})
+		rw.writeString([]byte(key))
+		rw.writeLength(uint64(len(item.list)))
+		// head of the list is the last element of the slice
+		for i := len(item.list) - 1; i >= 0; i-- {
+			rw.writeString(item.list[i])
+		}
+	case Dict:
+		rw.write([]byte{rdbTypeHash})
+		rw.writeString([]byte(key))
+		rw.writeLength(uint64(len(item.dict)))
+		for field, value := range item.dict {
+			rw.writeString([]byte(field))
+			rw.writeString(value)
+		}
+	case SortedSet:
+		rw.write([]byte{rdbTypeZset2})
+		rw.writeString([]byte(key))
+		rw.writeLength(uint64(item.zset.Len()))
+		for _, entry := range item.zset.Range(0, item.zset.Len()-1) {
+			rw.writeString([]byte(entry.member))
+			binary.LittleEndian.PutUint64(rw.buf[:8], math.Float64bits(entry.score))
+			rw.write(rw.buf[:8])
+		}
+	}
+}
+
+// writeString writes length-prefixed string without compression and integer encoding
+func (rw *rdbWriter) writeString(s []byte) {
+	rw.writeLength(uint64(len(s)))
+	rw.write(s)
+}
+
+func (rw *rdbWriter) writeLength(length uint64) {
+	switch {
+	case length < 1<<6:
+		rw.buf[0] = rdbLen6Bit | byte(length)
+		rw.write(rw.buf[:1])
+	case length < 1<<14:
+		rw.buf[0] = rdbLen14Bit | byte(length>>8)
+		rw.buf[1] = byte(length)
+		rw.write(rw.buf[:2])
+	case length <= math.MaxUint32:
+		rw.buf[0] = rdbLen32Bit
+		binary.BigEndian.PutUint32(rw.buf[1:5], uint32(length))
+		rw.write(rw.buf[:5])
+	default:
+		rw.buf[0] = rdbLen64Bit
+		binary.BigEndian.PutUint64(rw.buf[1:9], length)
+		rw.write(rw.buf[:9])
+	}
+}
+
+// RDB value types and opcodes, that could be read, but aren't written
+const (
+	rdbMaxVersion = 12
+
+	rdbTypeSet              = 2
+	rdbTypeZset             = 3
+	rdbTypeModule           = 6
+	rdbTypeModule2          = 7
+	rdbTypeHashZipmap       = 9
+	rdbTypeListZiplist      = 10
+	rdbTypeSetIntset        = 11
+	rdbTypeZsetZiplist      = 12
+	rdbTypeHashZiplist      = 13
+	rdbTypeListQuicklist    = 14
+	rdbTypeStreamListpacks  = 15
+	rdbTypeHashListpack     = 16
+	rdbTypeZsetListpack     = 17
+	rdbTypeListQuicklist2   = 18
+	rdbTypeStreamListpacks2 = 19
+	rdbTypeSetListpack      = 20
+	rdbTypeStreamListpacks3 = 21
+
+	rdbOpcodeSlotInfo      = 0xF4
+	rdbOpcodeFunction2     = 0xF5
+	rdbOpcodeModuleAux     = 0xF7
+	rdbOpcodeIdle          = 0xF8
+	rdbOpcodeFreq          = 0xF9
+	rdbOpcodeAux           = 0xFA
+	rdbOpcodeResizeDb      = 0xFB
+	rdbOpcodeExpireTimeSec = 0xFD
+
+	rdbEncInt8  = 0
+	rdbEncInt16 = 1
+	rdbEncInt32 = 2
+	rdbEncLzf   = 3
+
+	rdbModuleOpcodeEof    = 0
+	rdbModuleOpcodeSint   = 1
+	rdbModuleOpcodeUint   = 2
+	rdbModuleOpcodeFloat  = 3
+	rdbModuleOpcodeDouble = 4
+	rdbModuleOpcodeString = 5
+
+	rdbQuicklistNodePlain = 1
+)
+
+var (
+	ErrRdbFormat   = errors.New("invalid RDB file")
+	ErrRdbChecksum = errors.New("RDB checksum mismatch")
+)
+
+// ReadRDB reads Redis RDB file and invokes handle for every not expired key of database 0, error of handle aborts reading.
+// Sets, streams and module values aren't supported by Radish, so they are passed to skip with the reason,
+// as well as keys of other databases
+func ReadRDB(r io.Reader, handle func(key string, item *Item) error, skip func(key string, reason string)) error {
+	rr := &rdbReader{r: bufio.NewReader(r)}
+
+	header, err := rr.read(9)
+	if err != nil {
+		return err
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if string(header[:5]) != "REDIS" || err != nil || version < 1 || version > rdbMaxVersion {
+		return fmt.Errorf("%s: unsupported header %q", ErrRdbFormat, header)
+	}
+
+	var expireAt time.Time
+	var db uint64
+	now := time.Now()
+	for {
+		opcode, err := rr.readByte()
+		if err != nil {
+			return err
+		}
+
+		switch opcode {
+		case rdbOpcodeExpireTimeSec:
+			b, err := rr.read(4)
+			if err != nil {
+				return err
+			}
+			expireAt = time.Unix(int64(binary.LittleEndian.Uint32(b)), 0)
+		case rdbOpcodeExpireTimeMs:
+			b, err := rr.read(8)
+			if err != nil {
+				return err
+			}
+			expireAt = time.Unix(0, int64(binary.LittleEndian.Uint64(b))*int64(time.Millisecond))
+		case rdbOpcodeSelectDb:
+			if db, err = rr.readLength(); err != nil {
+				return err
+			}
+		case rdbOpcodeIdle:
+			if _, err := rr.readLength(); err != nil {
+				return err
+			}
+		case rdbOpcodeFreq:
+			if _, err := rr.readByte(); err != nil {
+				return err
+			}
+		case rdbOpcodeAux:
+			if err := rr.skipStrings(2); err != nil {
+				return err
+			}
+		case rdbOpcodeResizeDb:
+			if err := rr.skipLengths(2); err != nil {
+				return err
+			}
+		case rdbOpcodeSlotInfo:
+			if err := rr.skipLengths(3); err != nil {
+				return err
+			}
+		case rdbOpcodeFunction2:
+			if err := rr.skipStrings(1); err != nil {
+				return err
+			}
+		case rdbOpcodeModuleAux:
+			// module id, when opcode and when
+			if err := rr.skipLengths(3); err != nil {
+				return err
+			}
+			if err := rr.skipModuleValue(); err != nil {
+				return err
+			}
+		case rdbOpcodeEof:
+			return rr.checkChecksum(version)
+		default:
+			key, err := rr.readString()
+			if err != nil {
+				return err
+			}
+
+			item, err := rr.readValue(opcode)
+			switch {
+			case err != nil:
+				return fmt.Errorf("%s, key %q", err, key)
+			case item == nil:
+				skip(string(key), fmt.Sprintf("unsupported value type: %s", rdbTypeName(opcode)))
+			case db != 0:
+				skip(string(key), fmt.Sprintf("unsupported database %d", db))
+			case expireAt.IsZero():
+				err = handle(string(key), item)
+			case expireAt.After(now):
+				item.SetExpireAt(expireAt)
+				err = handle(string(key), item)
+			}
+			if err != nil {
+				return err
+			}
+
+			expireAt = time.Time{}
+		}
+	}
+}
+
+// rdbTypeName returns name of the value type, unsupported by Radish
+func rdbTypeName(valueType byte) string {
+	switch valueType {
+	case rdbTypeSet, rdbTypeSetIntset, rdbTypeSetListpack:
+		return "set"
+	case rdbTypeStreamListpacks, rdbTypeStreamListpacks2, rdbTypeStreamListpacks3:
+		return "stream"
+	case rdbTypeModule2:
+		return "module"
+	default:
+		return strconv.Itoa(int(valueType))
+	}
+}
+
+// rdbReader reads RDB primitives and calculates checksum
+type rdbReader struct {
+	r   *bufio.Reader
+	crc uint64
+}
+
+func (rr *rdbReader) read(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rr.r, b); err != nil {
+		return nil, fmt.Errorf("%s: %s", ErrRdbFormat, err)
+	}
+	rr.crc = rdbCrcUpdate(rr.crc, b)
+
+	return b, nil
+}
+
+func (rr *rdbReader) readByte() (byte, error) {
+	b, err := rr.read(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return b[0], nil
+}
+
+// readLengthOrEncoding reads length. If isEncoded, length is a type of special string encoding
+func (rr *rdbReader) readLengthOrEncoding() (length uint64, isEncoded bool, err error) {
+	first, err := rr.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch first >> 6 {
+	case rdbLen6Bit >> 6:
+		return uint64(first & 0x3F), false, nil
+	case rdbLen14Bit >> 6:
+		second, err := rr.readByte()
+		return uint64(first&0x3F)<<8 | uint64(second), false, err
+	case rdbLen32Bit >> 6:
+		switch first {
+		case rdbLen32Bit:
+			b, err := rr.read(4)
+			if err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(b)), false, nil
+		case rdbLen64Bit:
+			b, err := rr.read(8)
+			if err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(b), false, nil
+		default:
+			return 0, false, fmt.Errorf("%s: invalid length 0x%x", ErrRdbFormat, first)
+		}
+	default:
+		return uint64(first & 0x3F), true, nil
+	}
+}
+
+func (rr *rdbReader) readLength() (uint64, error) {
+	length, isEncoded, err := rr.readLengthOrEncoding()
+	if err == nil && isEncoded {
+		err = fmt.Errorf("%s: unexpected string encoding instead of length", ErrRdbFormat)
+	}
+
+	return length, err
+}
+
+// readCount reads length of collection and checks, that it isn't absurd for the rest of file
+func (rr *rdbReader) readCount() (int, error) {
+	count, err := rr.readLength()
+	if err == nil && count > math.MaxInt32 {
+		err = fmt.Errorf("%s: too long collection: %d", ErrRdbFormat, count)
+	}
+
+	return int(count), err
+}
+
+// readString reads string in any encoding: plain, integer or LZF-compressed
+func (rr *rdbReader) readString() ([]byte, error) {
+	length, isEncoded, err := rr.readLengthOrEncoding()
+	if err != nil {
+		return nil, err
+	}
+
+	if !isEncoded {
+		if length > math.MaxInt32 {
+			return nil, fmt.Errorf("%s: too long string: %d", ErrRdbFormat, length)
+		}
+		return rr.read(int(length))
+	}
+
+	switch length {
+	case rdbEncInt8, rdbEncInt16, rdbEncInt32:
+		b, err := rr.read(1 << length)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatInt(rdbLittleEndianInt(b), 10)), nil
+	case rdbEncLzf:
+		compressedLen, err := rr.readCount()
+		if err != nil {
+			return nil, err
+		}
+		len, err := rr.readCount()
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := rr.read(compressedLen)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, len)
+	default:
+		return nil, fmt.Errorf("%s: unknown string encoding %d", ErrRdbFormat, length)
+	}
+}
+
+// readDoubleString reads zset score in string representation of RDB_TYPE_ZSET
+func (rr *rdbReader) readDoubleString() (float64, error) {
+	length, err := rr.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch length {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+
+	b, err := rr.read(int(length))
+	if err != nil {
+		return 0, err
+	}
+
+	return rdbParseFloat(b)
+}
+
+func (rr *rdbReader) skipStrings(count int) error {
+	for i := 0; i < count; i++ {
+		if _, err := rr.readString(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rr *rdbReader) skipLengths(count int) error {
+	for i := 0; i < count; i++ {
+		if _, err := rr.readLength(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// skipModuleValue skips module data, serialized as sequence of typed values, terminated by EOF opcode
+func (rr *rdbReader) skipModuleValue() error {
+	for {
+		opcode, err := rr.readLength()
+		if err != nil {
+			return err
+		}
+
+		switch opcode {
+		case rdbModuleOpcodeEof:
+			return nil
+		case rdbModuleOpcodeSint, rdbModuleOpcodeUint:
+			_, err = rr.readLength()
+		case rdbModuleOpcodeFloat:
+			_, err = rr.read(4)
+		case rdbModuleOpcodeDouble:
+			_, err = rr.read(8)
+		case rdbModuleOpcodeString:
+			_, err = rr.readString()
+		default:
+			err = fmt.Errorf("%s: unknown module opcode %d", ErrRdbFormat, opcode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// skipStream skips stream of any version: entries, consumer groups and their pending entries
+func (rr *rdbReader) skipStream(valueType byte) error {
+	nodes, err := rr.readCount()
+	if err != nil {
+		return err
+	}
+	// every node is a master id and a listpack
+	if err := rr.skipStrings(2 * nodes); err != nil {
+		return err
+	}
+
+	// length and last id, for version 2+: first id, max deleted id and entries added
+	meta := 3
+	if valueType >= rdbTypeStreamListpacks2 {
+		meta += 5
+	}
+	if err := rr.skipLengths(meta); err != nil {
+		return err
+	}
+
+	groups, err := rr.readCount()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < groups; i++ {
+		if err := rr.skipStreamGroup(valueType); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rr *rdbReader) skipStreamGroup(valueType byte) error {
+	if err := rr.skipStrings(1); err != nil {
+		return err
+	}
+
+	// last id, for version 2+: entries read
+	meta := 2
+	if valueType >= rdbTypeStreamListpacks2 {
+		meta++
+	}
+	if err := rr.skipLengths(meta); err != nil {
+		return err
+	}
+
+	// pending entries: raw id, delivery time and delivery count
+	pending, err := rr.readCount()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < pending; i++ {
+		if _, err := rr.read(16 + 8); err != nil {
+			return err
+		}
+		if _, err := rr.readLength(); err != nil {
+			return err
+		}
+	}
+
+	consumers, err := rr.readCount()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < consumers; i++ {
+		if err := rr.skipStrings(1); err != nil {
+			return err
+		}
+
+		// seen time, for version 3: active time
+		times := 8
+		if valueType >= rdbTypeStreamListpacks3 {
+			times += 8
+		}
+		if _, err := rr.read(times); err != nil {
+			return err
+		}
+
+		// raw ids of consumer pending entries
+		pending, err := rr.readCount()
+		if err != nil {
+			return err
+		}
+		if _, err := rr.read(16 * pending); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkChecksum reads checksum after EOF opcode and compares it with calculated one.
+// Zero checksum means, that checksum is disabled
+func (rr *rdbReader) checkChecksum(version int) error {
+	if version < 5 {
+		return nil
+	}
+
+	crc := rr.crc
+	b, err := rr.read(8)
+	if err != nil {
+		return err
+	}
+
+	if stored := binary.LittleEndian.Uint64(b); stored != 0 && stored != crc {
+		return ErrRdbChecksum
+	}
+
+	return nil
+}
+
+// readValue reads value of provided type. For types, unsupported by Radish, value is skipped and nil item returned
+func (rr *rdbReader) readValue(valueType byte) (*Item, error) {
+	switch valueType {
+	case rdbTypeString:
+		value, err := rr.readString()
+		if err != nil {
+			return nil, err
+		}
+		return NewItemBytes(value), nil
+	case rdbTypeList:
+		values, err := rr.readStrings()
+		if err != nil {
+			return nil, err
+		}
+		return newItemListFromHead(values), nil
+	case rdbTypeHash:
+		values, err := rr.readStrings2x()
+		if err != nil {
+			return nil, err
+		}
+		return newItemDictFromPairs(values), nil
+	case rdbTypeZset, rdbTypeZset2:
+		return rr.readZset(valueType)
+	case rdbTypeHashZipmap, rdbTypeListZiplist, rdbTypeZsetZiplist, rdbTypeHashZiplist,
+		rdbTypeHashListpack, rdbTypeZsetListpack:
+		blob, err := rr.readString()
+		if err != nil {
+			return nil, err
+		}
+		return newItemFromBlob(valueType, blob)
+	case rdbTypeListQuicklist, rdbTypeListQuicklist2:
+		return rr.readQuicklist(valueType)
+	case rdbTypeSet:
+		_, err := rr.readStrings()
+		return nil, err
+	case rdbTypeSetIntset, rdbTypeSetListpack:
+		return nil, rr.skipStrings(1)
+	case rdbTypeModule2:
+		if _, err := rr.readLength(); err != nil {
+			return nil, err
+		}
+		return nil, rr.skipModuleValue()
+	case rdbTypeStreamListpacks, rdbTypeStreamListpacks2, rdbTypeStreamListpacks3:
+		return nil, rr.skipStream(valueType)
+	default:
+		// e.g. modules of RDB version 1 couldn't be skipped without the module itself
+		return nil, fmt.Errorf("%s: unknown value type %d", ErrRdbFormat, valueType)
+	}
+}
+
+// readStrings reads length-prefixed sequence of strings
+func (rr *rdbReader) readStrings() ([][]byte, error) {
+	count, err := rr.readCount()
+	if err != nil {
+		return nil, err
+	}
+
+	return rr.readStringsN(count)
+}
+
+// readStrings2x reads sequence of pairs of strings, prefixed by count of pairs
+func (rr *rdbReader) readStrings2x() ([][]byte, error) {
+	count, err := rr.readCount()
+	if err != nil {
+		return nil, err
+	}
+
+	return rr.readStringsN(2 * count)
+}
+
+func (rr *rdbReader) readStringsN(count int) ([][]byte, error) {
+	var values [][]byte
+	for i := 0; i < count; i++ {
+		value, err := rr.readString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func (rr *rdbReader) readZset(valueType byte) (*Item, error) {
+	count, err := rr.readCount()
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[string]float64)
+	for i := 0; i < count; i++ {
+		member, err := rr.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		var score float64
+		if valueType == rdbTypeZset2 {
+			b, err := rr.read(8)
+			if err != nil {
+				return nil, err
+			}
+			score = math.Float64frombits(binary.LittleEndian.Uint64(b))
+		} else if score, err = rr.readDoubleString(); err != nil {
+			return nil, err
+		}
+
+		scores[string(member)] = score
+	}
+
+	return NewItemSortedSet(scores), nil
+}
+
+// readQuicklist reads list, stored as sequence of ziplists or, since version 2, as sequence of listpacks or plain values
+func (rr *rdbReader) readQuicklist(valueType byte) (*Item, error) {
+	count, err := rr.readCount()
+	if err != nil {
+		return nil, err
+	}
+
+	var values [][]byte
+	for i := 0; i < count; i++ {
+		container := uint64(0)
+		if valueType == rdbTypeListQuicklist2 {
+			if container, err = rr.readLength(); err != nil {
+				return nil, err
+			}
+		}
+
+		blob, err := rr.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		var nodeValues [][]byte
+		switch {
+		case container == rdbQuicklistNodePlain:
+			nodeValues = [][]byte{blob}
+		case valueType == rdbTypeListQuicklist2:
+			nodeValues, err = parseListpack(blob)
+		default:
+			nodeValues, err = parseZiplist(blob)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, nodeValues...)
+	}
+
+	return newItemListFromHead(values), nil
+}
+
+// newItemFromBlob constructs item from value, serialized into a single string by zipmap, ziplist or listpack
+func newItemFromBlob(valueType byte, blob []byte) (*Item, error) {
+	var values [][]byte
+	var err error
+	switch valueType {
+	case rdbTypeHashZipmap:
+		values, err = parseZipmap(blob)
+	case rdbTypeListZiplist, rdbTypeZsetZiplist, rdbTypeHashZiplist:
+		values, err = parseZiplist(blob)
+	default:
+		values, err = parseListpack(blob)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch valueType {
+	case rdbTypeListZiplist:
+		return newItemListFromHead(values), nil
+	case rdbTypeZsetZiplist, rdbTypeZsetListpack:
+		if len(values)%2 != 0 {
+			return nil, fmt.Errorf("%s: odd count of zset elements", ErrRdbFormat)
+		}
+		scores := make(map[string]float64, len(values)/2)
+		for i := 0; i < len(values); i += 2 {
+			score, err := rdbParseFloat(values[i+1])
+			if err != nil {
+				return nil, err
+			}
+			scores[string(values[i])] = score
+		}
+		return NewItemSortedSet(scores), nil
+	default:
+		if len(values)%2 != 0 {
+			return nil, fmt.Errorf("%s: odd count of hash elements", ErrRdbFormat)
+		}
+		return newItemDictFromPairs(values), nil
+	}
+}
+
+// newItemListFromHead constructs List item from values, ordered from head to tail
+func newItemListFromHead(values [][]byte) *Item {
+	// head of the list is the last element of the slice
+	list := make([][]byte, len(values))
+	for i, v := range values {
+		list[len(values)-1-i] = v
+	}
+
+	return NewItemList(list)
+}
+
+// newItemDictFromPairs constructs Dict item from field, value, field, value... sequence
+func newItemDictFromPairs(values [][]byte) *Item {
+	dict := make(map[string][]byte, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		dict[string(values[i])] = values[i+1]
+	}
+
+	return NewItemDict(dict)
+}
+
+// parseZipmap parses hash in zipmap encoding into field, value, field, value... sequence
+func parseZipmap(b []byte) ([][]byte, error) {
+	c := rdbCursor{b: b}
+	c.next(1) // zipmap length, could be wrong if greater than 253
+
+	var values [][]byte
+	for c.err == nil {
+		length := c.zipmapLength()
+		if length < 0 {
+			break
+		}
+		field := c.next(length)
+
+		length = c.zipmapLength()
+		free := c.next(1)
+		value := c.next(length)
+		if c.err == nil {
+			c.next(int(free[0]))
+		}
+
+		values = append(values, field, value)
+	}
+
+	return values, c.err
+}
+
+// parseZiplist parses all entries of ziplist, integers are formatted as decimal strings
+func parseZiplist(b []byte) ([][]byte, error) {
+	c := rdbCursor{b: b}
+	c.next(4 + 4 + 2) // bytes, tail offset and length
+
+	var values [][]byte
+	for c.err == nil {
+		prevLen := c.next(1)
+		if c.err != nil || prevLen[0] == 0xFF {
+			break
+		}
+		if prevLen[0] == 0xFE {
+			c.next(4)
+		}
+
+		encoding := c.next(1)
+		if c.err != nil {
+			break
+		}
+
+		enc := encoding[0]
+		switch {
+		case enc>>6 == 0:
+			values = append(values, c.next(int(enc&0x3F)))
+		case enc>>6 == 1:
+			second := c.next(1)
+			if c.err == nil {
+				values = append(values, c.next(int(enc&0x3F)<<8|int(second[0])))
+			}
+		case enc>>6 == 2:
+			length := c.next(4)
+			if c.err == nil {
+				values = append(values, c.next(int(binary.BigEndian.Uint32(length))))
+			}
+		case enc == 0xC0:
+			values = append(values, c.nextInt(2))
+		case enc == 0xD0:
+			values = append(values, c.nextInt(4))
+		case enc == 0xE0:
+			values = append(values, c.nextInt(8))
+		case enc == 0xF0:
+			values = append(values, c.nextInt(3))
+		case enc == 0xFE:
+			values = append(values, c.nextInt(1))
+		case enc >= 0xF1 && enc <= 0xFD:
+			values = append(values, []byte(strconv.Itoa(int(enc&0x0F)-1)))
+		default:
+			c.err = fmt.Errorf("%s: unknown ziplist encoding 0x%x", ErrRdbFormat, enc)
+		}
+	}
+
+	return values, c.err
+}
+
+// parseListpack parses all entries of listpack, integers are formatted as decimal strings
+func parseListpack(b []byte) ([][]byte, error) {
+	c := rdbCursor{b: b}
+	c.next(4 + 2) // bytes and length
+
+	var values [][]byte
+	for c.err == nil {
+		encoding := c.next(1)
+		if c.err != nil || encoding[0] == 0xFF {
+			break
+		}
+
+		var value []byte
+		enc := encoding[0]
+		switch {
+		case enc&0x80 == 0:
+			value = []byte(strconv.Itoa(int(enc)))
+		case enc&0xC0 == 0x80:
+			value = c.next(int(enc & 0x3F))
+		case enc&0xE0 == 0xC0:
+			second := c.next(1)
+			if c.err == nil {
+				// 13 bit signed integer
+				v := int(enc&0x1F)<<8 | int(second[0])
+				if v >= 1<<12 {
+					v -= 1 << 13
+				}
+				value = []byte(strconv.Itoa(v))
+			}
+		case enc&0xF0 == 0xE0:
+			second := c.next(1)
+			if c.err == nil {
+				value = c.next(int(enc&0x0F)<<8 | int(second[0]))
+			}
+		case enc == 0xF0:
+			length := c.next(4)
+			if c.err == nil {
+				value = c.next(int(binary.LittleEndian.Uint32(length)))
+			}
+		case enc == 0xF1:
+			value = c.nextInt(2)
+		case enc == 0xF2:
+			value = c.nextInt(3)
+		case enc == 0xF3:
+			value = c.nextInt(4)
+		case enc == 0xF4:
+			value = c.nextInt(8)
+		default:
+			c.err = fmt.Errorf("%s: unknown listpack encoding 0x%x", ErrRdbFormat, enc)
+		}
+
+		// skip backlen, that encodes length of the entry
+		c.next(listpackBacklenSize(len(encoding) + c.pos - c.entryStart - 1))
+		c.entryStart = c.pos
+		values = append(values, value)
+	}
+
+	return values, c.err
+}
+
+// listpackBacklenSize returns size of backlen of the listpack entry with provided length
+func listpackBacklenSize(entryLength int) int {
+	switch {
+	case entryLength <= 127:
+		return 1
+	case entryLength < 16383:
+		return 2
+	case entryLength < 2097151:
+		return 3
+	case entryLength < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// rdbCursor reads ziplist, listpack and zipmap blobs. After the first error all reads return nil
+type rdbCursor struct {
+	b   []byte
+	pos int
+	err error
+	// entryStart is a position of the current listpack entry
+	entryStart int
+}
+
+func (c *rdbCursor) next(n int) []byte {
+	if c.err != nil {
+		return nil
+	}
+	if n < 0 || c.pos+n > len(c.b) {
+		c.err = fmt.Errorf("%s: unexpected end of encoded value", ErrRdbFormat)
+		return nil
+	}
+
+	c.pos += n
+	return c.b[c.pos-n : c.pos]
+}
+
+// nextInt reads little endian signed integer of n bytes and formats it as decimal string
+func (c *rdbCursor) nextInt(n int) []byte {
+	b := c.next(n)
+	if c.err != nil {
+		return nil
+	}
+
+	return []byte(strconv.FormatInt(rdbLittleEndianInt(b), 10))
+}
+
+// zipmapLength reads length of zipmap field or value. Returns -1 on the end of zipmap
+func (c *rdbCursor) zipmapLength() int {
+	first := c.next(1)
+	switch {
+	case c.err != nil:
+		return 0
+	case first[0] < 254:
+		return int(first[0])
+	case first[0] == 254:
+		b := c.next(4)
+		if c.err != nil {
+			return 0
+		}
+		return int(binary.LittleEndian.Uint32(b))
+	default:
+		return -1
+	}
+}
+
+// rdbLittleEndianInt decodes little endian signed integer of len(b) bytes
+func rdbLittleEndianInt(b []byte) int64 {
+	var u uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		u = u<<8 | uint64(b[i])
+	}
+
+	shift := uint(64 - 8*len(b))
+	return int64(u<<shift) >> shift
+}
+
+func rdbParseFloat(b []byte) (float64, error) {
+	score, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid score %q", ErrRdbFormat, b)
+	}
+
+	return score, nil
+}
+
+// lzfDecompress decompresses data, compressed by LZF algorithm, used by Redis to compress strings
+func lzfDecompress(in []byte, length int) ([]byte, error) {
+	out := make([]byte, 0, length)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		if ctrl < 1<<5 {
+			// literal run of ctrl + 1 bytes
+			if i+ctrl+1 > len(in) {
+				return nil, fmt.Errorf("%s: invalid LZF literal", ErrRdbFormat)
+			}
+			out = append(out, in[i:i+ctrl+1]...)
+			i += ctrl + 1
+			continue
+		}
+
+		// back reference
+		refLength := ctrl >> 5
+		if refLength == 7 {
+			if i >= len(in) {
+				return nil, fmt.Errorf("%s: invalid LZF back reference", ErrRdbFormat)
+			}
+			refLength += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, fmt.Errorf("%s: invalid LZF back reference", ErrRdbFormat)
+		}
+		ref := len(out) - (ctrl&0x1F)<<8 - 1 - int(in[i])
+		i++
+		if ref < 0 {
+			return nil, fmt.Errorf("%s: invalid LZF back reference", ErrRdbFormat)
+		}
+
+		// reference could overlap the output, so copy byte by byte
+		for j := 0; j < refLength+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+
+	if len(out) != length {
+		return nil, fmt.Errorf("%s: LZF decompressed length mismatch", ErrRdbFormat)
+	}
+
+	return out, nil
+}
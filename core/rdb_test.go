@@ -0,0 +1,250 @@
+package core_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/go-test/deep"
+	. "github.com/mshaverdo/radish/core"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRdbCrcUpdate(t *testing.T) {
+	// test vector from Redis crc64.c
+	if got, want := RdbCrcUpdate(0, []byte("123456789")), uint64(0xe9c6d914c4b8d9ca); got != want {
+		t.Errorf("RdbCrcUpdate(): got %x, want %x", got, want)
+	}
+
+	if got, want := RdbCrcUpdate(RdbCrcUpdate(0, []byte("1234")), []byte("56789")), uint64(0xe9c6d914c4b8d9ca); got != want {
+		t.Errorf("RdbCrcUpdate() continued: got %x, want %x", got, want)
+	}
+}
+
+func TestCore_ExportRDB(t *testing.T) {
+	withTtl := NewItemBytes([]byte("v"))
+	withTtl.SetExpireAt(time.Unix(4102444800, 0))
+	expired := NewItemBytes([]byte("v"))
+	expired.SetExpireAt(time.Unix(1, 0))
+
+	tests := []struct {
+		key  string
+		item *Item
+		want string
+	}{
+		{"s", NewItemBytes([]byte("value")), "\x00\x01s\x05value"},
+		{"s", withTtl, "\xfc\x00\xd8\xc3\x2c\xbb\x03\x00\x00\x00\x01s\x01v"},
+		{"s", expired, ""},
+		{"s", NewItemBytes(bytes.Repeat([]byte("x"), 100)), "\x00\x01s\x40\x64" + string(bytes.Repeat([]byte("x"), 100))},
+		{"l", NewItemList([][]byte{[]byte("tail"), []byte("head")}), "\x01\x01l\x02\x04head\x04tail"},
+		{"h", NewItemDict(map[string][]byte{"f": []byte("v")}), "\x04\x01h\x01\x01f\x01v"},
+		{"z", NewItemSortedSet(map[string]float64{"b": 2, "a": 1.5}), "\x05\x01z\x02\x01a\x00\x00\x00\x00\x00\x00\xf8\x3f\x01b\x00\x00\x00\x00\x00\x00\x00\x40"},
+	}
+
+	for _, tst := range tests {
+		storage := NewStorageHash()
+		storage.SetData(map[string]*Item{tst.key: tst.item})
+
+		want := []byte("REDIS0009\xfe\x00" + tst.want + "\xff")
+		crc := make([]byte, 8)
+		binary.LittleEndian.PutUint64(crc, RdbCrcUpdate(0, want))
+		want = append(want, crc...)
+
+		buf := bytes.NewBuffer(nil)
+		if err := New(storage).ExportRDB(buf); err != nil {
+			t.Errorf("ExportRDB(%q): %s", tst.key, err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("ExportRDB(%q): \ngot: %q\nwant:%q", tst.key, buf.Bytes(), want)
+		}
+	}
+}
+
+func TestReadRDB(t *testing.T) {
+	expireAt := time.Unix(4102444800, 0)
+	withTtl := NewItemBytes([]byte("v"))
+	withTtl.SetExpireAt(expireAt)
+
+	tests := []struct {
+		name string
+		body string
+		want *Item
+	}{
+		{"int8", "\x00\x01k\xc0\x7b", NewItemString("123")},
+		{"int16", "\x00\x01k\xc1\x39\x30", NewItemString("12345")},
+		{"int32", "\x00\x01k\xc2\xff\xff\xff\xff", NewItemString("-1")},
+		{"lzf", "\x00\x01k\xc3\x05\x0a\x00a\xe0\x00\x00", NewItemString("aaaaaaaaaa")},
+		{"14 bit length", "\x00\x01k\x40\x64" + strings.Repeat("x", 100), NewItemString(strings.Repeat("x", 100))},
+		{"aux and resizedb", "\xfa\x09redis-ver\x057.2.0\xfb\x01\x00\x00\x01k\x01v", NewItemString("v")},
+		{"expire seconds", "\xfd\x00\x57\x86\xf4\x00\x01k\x01v", withTtl},
+		{"expired", "\xfc\xe8\x03\x00\x00\x00\x00\x00\x00\x00\x01k\x01v", nil},
+		{"list", "\x01\x01k\x02\x04head\x04tail", NewItemList([][]byte{[]byte("tail"), []byte("head")})},
+		{
+			"list ziplist",
+			"\x0a\x01k\x14" + strings.Repeat("\x00", 10) + "\x00\x01a\x03\xf6\x02\xc0\x2c\x01\xff",
+			NewItemList([][]byte{[]byte("300"), []byte("5"), []byte("a")}),
+		},
+		{
+			"list quicklist",
+			"\x0e\x01k\x01\x0e" + strings.Repeat("\x00", 10) + "\x00\x01x\xff",
+			NewItemList([][]byte{[]byte("x")}),
+		},
+		{
+			"list quicklist2",
+			"\x12\x01k\x02\x02\x0d" + strings.Repeat("\x00", 6) + "\x81a\x02\x81b\x02\xff\x01\x01c",
+			NewItemList([][]byte{[]byte("c"), []byte("b"), []byte("a")}),
+		},
+		{"hash", "\x04\x01k\x01\x01f\x01v", NewItemDict(map[string][]byte{"f": []byte("v")})},
+		{"hash zipmap", "\x09\x01k\x07\x01\x01f\x01\x00v\xff", NewItemDict(map[string][]byte{"f": []byte("v")})},
+		{
+			"hash listpack",
+			"\x10\x01k\x12" + strings.Repeat("\x00", 6) + "\x81f\x02\x07\x01\x81g\x02\xdf\xfe\x02\xff",
+			NewItemDict(map[string][]byte{"f": []byte("7"), "g": []byte("-2")}),
+		},
+		{"zset", "\x03\x01k\x02\x01a\x031.5\x01b\xfe", NewItemSortedSet(map[string]float64{"a": 1.5, "b": math.Inf(1)})},
+		{
+			"zset listpack",
+			"\x11\x01k\x14" + strings.Repeat("\x00", 6) + "\x81m\x02\x831.5\x04\x81n\x02\x03\x01\xff",
+			NewItemSortedSet(map[string]float64{"m": 1.5, "n": 3}),
+		},
+	}
+
+	for _, tst := range tests {
+		var got *Item
+		handle := func(key string, item *Item) error {
+			if key != "k" {
+				t.Errorf("%s: got key %q, want %q", tst.name, key, "k")
+			}
+			got = item
+			return nil
+		}
+		skip := func(key string, reason string) {
+			t.Errorf("%s: key %q skipped: %s", tst.name, key, reason)
+		}
+
+		// zero checksum means, that checksum is disabled
+		rdb := "REDIS0011" + tst.body + "\xff" + strings.Repeat("\x00", 8)
+		if err := ReadRDB(bytes.NewBufferString(rdb), handle, skip); err != nil {
+			t.Errorf("%s: ReadRDB(): %s", tst.name, err)
+			continue
+		}
+
+		switch {
+		case tst.want == nil && got != nil:
+			t.Errorf("%s: got %s, want nothing", tst.name, got)
+		case tst.want == nil:
+		case got == nil:
+			t.Errorf("%s: got nothing, want %s", tst.name, tst.want)
+		case got.Kind() != tst.want.Kind() || got.String() != tst.want.String() || !got.ExpireAt().Equal(tst.want.ExpireAt()):
+			t.Errorf("%s: got %s %s %s, want %s %s %s", tst.name, got.Kind(), got, got.ExpireAt(), tst.want.Kind(), tst.want, tst.want.ExpireAt())
+		}
+	}
+}
+
+func TestReadRDB_Skip(t *testing.T) {
+	body := "\x02\x01a\x02\x01x\x01y" + // set
+		"\x0f\x01b\x01\x10" + strings.Repeat("\x00", 16) + "\x01x\x00\x00\x00\x00" + // stream without groups
+		"\x14\x01c\x01x" + // set listpack
+		"\x00\x01s\x01v" +
+		"\xfe\x01\x00\x01d\x01v" // key of db 1
+
+	var handled, skipped []string
+	handle := func(key string, item *Item) error {
+		handled = append(handled, key)
+		return nil
+	}
+	skip := func(key string, reason string) {
+		skipped = append(skipped, key+": "+reason)
+	}
+
+	if err := ReadRDB(bytes.NewBufferString("REDIS0010"+body+"\xff"+strings.Repeat("\x00", 8)), handle, skip); err != nil {
+		t.Fatalf("ReadRDB(): %s", err)
+	}
+
+	wantSkipped := []string{
+		"a: unsupported value type: set",
+		"b: unsupported value type: stream",
+		"c: unsupported value type: set",
+		"d: unsupported database 1",
+	}
+	if diff := deep.Equal(handled, []string{"s"}); diff != nil {
+		t.Errorf("handled keys: %s", diff)
+	}
+	if diff := deep.Equal(skipped, wantSkipped); diff != nil {
+		t.Errorf("skipped keys: %s", diff)
+	}
+}
+
+func TestReadRDB_Errors(t *testing.T) {
+	valid := []byte("REDIS0009\x00\x01k\x01v\xff")
+	crc := make([]byte, 8)
+	binary.LittleEndian.PutUint64(crc, RdbCrcUpdate(0, valid))
+
+	tests := []struct {
+		name string
+		rdb  string
+		want error
+	}{
+		{"valid", string(valid) + string(crc), nil},
+		{"checksum", string(valid) + "\x01\x02\x03\x04\x05\x06\x07\x08", ErrRdbChecksum},
+		{"header", "RADISH009\xff", ErrRdbFormat},
+		{"version", "REDIS0099\xff", ErrRdbFormat},
+		{"truncated", "REDIS0009\x00\x01k\x05v", ErrRdbFormat},
+		{"no EOF", "REDIS0009\x00\x01k\x01v", ErrRdbFormat},
+		{"unknown type", "REDIS0009\x30\x01k\x01v\xff", ErrRdbFormat},
+		{"broken ziplist", "REDIS0009\x0a\x01k\x03\x00\x00\x00\xff", ErrRdbFormat},
+		{"broken lzf", "REDIS0009\x00\x01k\xc3\x02\x0a\x00a\xff", ErrRdbFormat},
+	}
+
+	for _, tst := range tests {
+		handle := func(key string, item *Item) error { return nil }
+		skip := func(key string, reason string) {}
+
+		err := ReadRDB(bytes.NewBufferString(tst.rdb), handle, skip)
+		if (err == nil) != (tst.want == nil) || err != nil && !strings.HasPrefix(err.Error(), tst.want.Error()) {
+			t.Errorf("%s: ReadRDB(): got error %v, want %v", tst.name, err, tst.want)
+		}
+	}
+}
+
+func TestReadRDB_ExportRDB(t *testing.T) {
+	withTtl := NewItemList([][]byte{[]byte("tail"), []byte("head")})
+	withTtl.SetExpireAt(time.Unix(4102444800, 0))
+	items := map[string]*Item{
+		"string":    NewItemBytes([]byte("value")),
+		"long":      NewItemBytes(bytes.Repeat([]byte("long"), 100000)),
+		"list":      withTtl,
+		"dict":      NewItemDict(map[string][]byte{"a": []byte("1"), "b": []byte("2")}),
+		"sortedset": NewItemSortedSet(map[string]float64{"a": 1.5, "b": -2}),
+	}
+
+	storage := NewStorageHash()
+	storage.SetData(items)
+	buf := bytes.NewBuffer(nil)
+	if err := New(storage).ExportRDB(buf); err != nil {
+		t.Fatalf("ExportRDB(): %s", err)
+	}
+
+	got := make(map[string]*Item)
+	handle := func(key string, item *Item) error {
+		got[key] = item
+		return nil
+	}
+	skip := func(key string, reason string) {
+		t.Errorf("key %q skipped: %s", key, reason)
+	}
+	if err := ReadRDB(buf, handle, skip); err != nil {
+		t.Fatalf("ReadRDB(): %s", err)
+	}
+
+	if len(got) != len(items) {
+		t.Errorf("got %d keys, want %d", len(got), len(items))
+	}
+	for key, want := range items {
+		item := got[key]
+		if item == nil || item.String() != want.String() || !item.ExpireAt().Equal(want.ExpireAt()) {
+			t.Errorf("%s: got %v, want %s", key, item, want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"sort"
+)
+
+// sortedSetEntry is a member of sorted set with its score
+type sortedSetEntry struct {
+	member string
+	score  float64
+}
+
+// less returns true, if entry e precedes entry with provided score and member.
+// Entries are ordered by score, entries with equal score are ordered lexicographically by member
+func (e sortedSetEntry) less(score float64, member string) bool {
+	return e.score < score || e.score == score && e.member < member
+}
+
+// sortedSet is a set of unique members, ordered by score. It isn't concurrency-safe,
+// so it must be accessed under the lock of the owning Item
+type sortedSet struct {
+	scores map[string]float64
+	// index contains all members of the set ordered by score and member
+	index []sortedSetEntry
+}
+
+// newSortedSet constructs sorted set from member -> score map
+func newSortedSet(scores map[string]float64) *sortedSet {
+	if scores == nil {
+		// gob doesn't distinguish nil and empty maps
+		scores = map[string]float64{}
+	}
+
+	s := &sortedSet{
+		scores: scores,
+		index:  make([]sortedSetEntry, 0, len(scores)),
+	}
+
+	for member, score := range scores {
+		s.index = append(s.index, sortedSetEntry{member: member, score: score})
+	}
+	sort.Slice(s.index, func(i, j int) bool {
+		return s.index[i].less(s.index[j].score, s.index[j].member)
+	})
+
+	return s
+}
+
+// Len returns count of members in the set
+func (s *sortedSet) Len() int {
+	return len(s.index)
+}
+
+// Score returns score of the member. Returns false if member not exists
+func (s *sortedSet) Score(member string) (score float64, ok bool) {
+	score, ok = s.scores[member]
+	return score, ok
+}
+
+// Add adds member with score to the set or updates score of existing member. Returns true, if member is new
+func (s *sortedSet) Add(member string, score float64) (isNew bool) {
+	oldScore, exists := s.scores[member]
+	if exists {
+		if oldScore == score {
+			return false
+		}
+		s.removeFromIndex(member, oldScore)
+	}
+
+	s.scores[member] = score
+
+	pos := s.search(score, member)
+	s.index = append(s.index, sortedSetEntry{})
+	copy(s.index[pos+1:], s.index[pos:])
+	s.index[pos] = sortedSetEntry{member: member, score: score}
+
+	return !exists
+}
+
+// Remove removes member from the set. Returns false if member not exists
+func (s *sortedSet) Remove(member string) bool {
+	score, ok := s.scores[member]
+	if !ok {
+		return false
+	}
+
+	delete(s.scores, member)
+	s.removeFromIndex(member, score)
+
+	return true
+}
+
+// Rank returns zero-based position of the member in the set, ordered by score. Returns false if member not exists
+func (s *sortedSet) Rank(member string) (rank int, ok bool) {
+	score, ok := s.scores[member]
+	if !ok {
+		return 0, false
+	}
+
+	return s.search(score, member), true
+}
+
+// Range returns members from start to stop positions inclusive. Positions must be normalized
+func (s *sortedSet) Range(start, stop int) []sortedSetEntry {
+	return s.index[start : stop+1]
+}
+
+// RangeByScore returns members with scores between min and max. If minExclusive or maxExclusive is true,
+// members with score equal to corresponding bound are excluded
+func (s *sortedSet) RangeByScore(min float64, minExclusive bool, max float64, maxExclusive bool) []sortedSetEntry {
+	start := sort.Search(len(s.index), func(i int) bool {
+		return s.index[i].score > min || !minExclusive && s.index[i].score == min
+	})
+	stop := sort.Search(len(s.index), func(i int) bool {
+		return s.index[i].score > max || maxExclusive && s.index[i].score == max
+	})
+
+	if start >= stop {
+		return nil
+	}
+
+	return s.index[start:stop]
+}
+
+// Scores returns member -> score map of the set
+func (s *sortedSet) Scores() map[string]float64 {
+	return s.scores
+}
+
+// search returns position of entry with provided score and member in the index, or position to insert it
+func (s *sortedSet) search(score float64, member string) int {
+	return sort.Search(len(s.index), func(i int) bool {
+		return !s.index[i].less(score, member)
+	})
+}
+
+// removeFromIndex removes member with score from the index
+func (s *sortedSet) removeFromIndex(member string, score float64) {
+	pos := s.search(score, member)
+	s.index = append(s.index[:pos], s.index[pos+1:]...)
+}
@@ -1,6 +1,9 @@
 package core
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
 	"encoding/gob"
 	"errors"
 	"fmt"
@@ -13,6 +16,29 @@ const (
 	bucketsCount = 1024
 )
 
+// snapshotMagic starts every snapshot and diff, written by Persist() and PersistKeys(), and is followed by
+// big-endian uint16 format version. Snapshots of version 1 have no header and start directly with gob-encoded messageId.
+// Binaries, that don't know about the header, fail to decode messageId instead of mis-decoding unknown item kinds
+const snapshotMagic = "RADISH-SNAPSHOT"
+
+// Snapshot format compatibility policy:
+//   - fields of gobExportItem could be added without a version bump: gob skips fields, unknown to the decoder,
+//     and leaves missing ones zero, so older and newer binaries read such snapshots both ways.
+//     Fields are never renamed, retyped or reused with a different meaning
+//   - changes, that older binaries would mis-decode, like a new item kind, bump SnapshotVersion.
+//     Snapshots of a newer version are refused with ErrSnapshotVersion
+//   - snapshots of all versions from minSnapshotVersion up to SnapshotVersion are loaded, and snapshots are always
+//     written in SnapshotVersion, so an old snapshot is upgraded, when the storage is persisted the next time
+const (
+	// SnapshotVersion is a version of the snapshot format, written by this binary.
+	// Version 2 adds the header, items of all kinds up to SortedSet
+	SnapshotVersion = 2
+	// minSnapshotVersion is the earliest snapshot format version, that could be loaded
+	minSnapshotVersion = 1
+)
+
+var ErrSnapshotVersion = errors.New("unsupported snapshot format version")
+
 //For in-memory storage (not on disc) hashmap should be faster thar b-tree
 // hashmap sharding gives significant performance boost on wide keyspace
 // (up to 10x SET on 1M keys & 1k concurrent connects at octa-core cpu)
@@ -88,6 +114,32 @@ func (e *StorageHash) Keys() (keys []string) {
 	return keys
 }
 
+// Len returns count of keys existing in the Storage
+func (e *StorageHash) Len() (count int) {
+	for b := range e.data {
+		e.mu[b].RLock()
+		count += len(e.data[b])
+		e.mu[b].RUnlock()
+	}
+
+	return count
+}
+
+// ViewKeys invokes view with iterator over all keys existing in the Storage.
+// Storage is locked for modifications until view returns, so iterator yields the same keys on every call
+func (e *StorageHash) ViewKeys(view func(forEach KeyIterator)) {
+	e.bucketsRLock()
+	defer e.bucketsRUnlock()
+
+	view(func(yield func(key string, item *Item)) {
+		for b := range e.data {
+			for k, item := range e.data[b] {
+				yield(k, item)
+			}
+		}
+	})
+}
+
 // AddOrReplaceOne adds new or replaces one existing Item in the storage. It much faster than AddOrReplace with single items
 func (e *StorageHash) AddOrReplaceOne(key string, item *Item) {
 	b := getBucket(key)
@@ -96,6 +148,21 @@ func (e *StorageHash) AddOrReplaceOne(key string, item *Item) {
 	e.mu[b].Unlock()
 }
 
+// CompareAndReplace adds or replaces Item only if the current Item of the key is old, nil old means absent key.
+// Returns true, if the item was stored
+func (e *StorageHash) CompareAndReplace(key string, old, item *Item) (replaced bool) {
+	b := getBucket(key)
+	e.mu[b].Lock()
+	defer e.mu[b].Unlock()
+
+	if e.data[b][key] != old {
+		return false
+	}
+
+	e.data[b][key] = item
+	return true
+}
+
 // Del removes values from storage and returns count of actually removed values
 // if key not found in the storage, just skip it
 func (e *StorageHash) Del(keys []string) (count int) {
@@ -124,8 +191,8 @@ func (e *StorageHash) Del(keys []string) (count int) {
 }
 
 // DelSubmap removes Items only if existing *Item equals to provided submap[key]
-// if key not found in the storage, just skip it and returns count of actually deleted items
-func (e *StorageHash) DelSubmap(submap map[string]*Item) (count int) {
+// if key not found in the storage, just skip it and returns keys of actually deleted items
+func (e *StorageHash) DelSubmap(submap map[string]*Item) (removed []string) {
 	var keysByBucket [bucketsCount][]string
 	for key := range submap {
 		b := getBucket(key)
@@ -140,20 +207,40 @@ func (e *StorageHash) DelSubmap(submap map[string]*Item) (count int) {
 		e.mu[b].Lock()
 		for _, key := range bucketKeys {
 			if existingItem, ok := e.data[b][key]; ok && existingItem == submap[key] {
-				count++
+				removed = append(removed, key)
 				delete(e.data[b], key)
 			}
 		}
 		e.mu[b].Unlock()
 	}
 
-	return count
+	return removed
 }
 
-// Persist dumps storage storage data into provided Writer
+// Compact rebuilds bucket maps into fresh ones of the actual size: Go maps never shrink,
+// so memory of removed keys is held by a map until it's rebuilt.
+// Buckets are rebuilt one by one, so concurrent requests are stalled for the time of copying a single bucket
+func (e *StorageHash) Compact() {
+	for b := range e.data {
+		e.mu[b].Lock()
+		data := make(map[string]*Item, len(e.data[b]))
+		for k, v := range e.data[b] {
+			data[k] = v
+		}
+		e.data[b] = data
+		e.mu[b].Unlock()
+	}
+}
+
+// Persist dumps storage storage data into provided Writer.
+// Storage is locked bucket by bucket: only one bucket and its items are locked at once,
+// so concurrent requests are stalled for the time of encoding a single bucket instead of the whole storage.
+// Due to that, the dump is consistent only if there are no concurrent modifications: it's true for storage,
+// used to merge WALs into a snapshot, and for storage of stopped Keeper
 func (e *StorageHash) Persist(w io.Writer, lastMessageId int64) error {
-	e.fullLock()
-	defer e.fullUnlock()
+	if err := writeSnapshotHeader(w); err != nil {
+		return fmt.Errorf("StorageHash.Persist(): can't write header: %s", err)
+	}
 
 	encoder := gob.NewEncoder(w)
 
@@ -162,19 +249,67 @@ func (e *StorageHash) Persist(w io.Writer, lastMessageId int64) error {
 	}
 
 	exp := &gobExportItem{}
-	for _, bucketData := range e.data {
-		for k, v := range bucketData {
-			exp.Key = k
-			exp.ExpireAt = v.expireAt
-			exp.Kind = v.kind
-			exp.Bytes = v.bytes
-			exp.List = v.list
-			exp.Dict = v.dict
-
-			if err := encoder.Encode(exp); err != nil {
-				return fmt.Errorf("StorageHash.Persist(): can't encode item: %s", err)
-				return err
-			}
+	for b := range e.data {
+		if err := e.persistBucket(encoder, b, exp); err != nil {
+			return fmt.Errorf("StorageHash.Persist(): can't encode item: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// persistBucket encodes all items of the bucket b, using exp as a buffer
+func (e *StorageHash) persistBucket(encoder *gob.Encoder, b int, exp *gobExportItem) error {
+	e.mu[b].RLock()
+	defer e.mu[b].RUnlock()
+
+	for k, v := range e.data[b] {
+		v.RLock()
+		exp.fill(k, v)
+
+		err := encoder.Encode(exp)
+		v.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PersistKeys dumps provided keys into Writer as a diff, to be applied by LoadDiff() on top of previous dump.
+// Keys, missing in the storage, are recorded as deleted
+func (e *StorageHash) PersistKeys(w io.Writer, lastMessageId int64, keys []string) error {
+	if err := writeSnapshotHeader(w); err != nil {
+		return fmt.Errorf("StorageHash.PersistKeys(): can't write header: %s", err)
+	}
+
+	encoder := gob.NewEncoder(w)
+
+	if err := encoder.Encode(lastMessageId); err != nil {
+		return fmt.Errorf("StorageHash.PersistKeys(): can't encode messageId: %s", err)
+	}
+
+	items := e.GetSubmap(keys)
+	deleted := make([]string, 0, len(keys)-len(items))
+	for _, key := range keys {
+		if _, ok := items[key]; !ok {
+			deleted = append(deleted, key)
+		}
+	}
+
+	if err := encoder.Encode(deleted); err != nil {
+		return fmt.Errorf("StorageHash.PersistKeys(): can't encode deleted keys: %s", err)
+	}
+
+	exp := &gobExportItem{}
+	for k, v := range items {
+		v.RLock()
+		exp.fill(k, v)
+		err := encoder.Encode(exp)
+		v.RUnlock()
+		if err != nil {
+			return fmt.Errorf("StorageHash.PersistKeys(): can't encode item: %s", err)
 		}
 	}
 
@@ -194,6 +329,11 @@ func (e *StorageHash) Load(r io.Reader) (lastMessageId int64, err error) {
 		e.data[b] = make(map[string]*Item)
 	}
 
+	r, err = readSnapshotHeader(r)
+	if err != nil {
+		return 0, fmt.Errorf("StorageHash.Load(): %s", err)
+	}
+
 	decoder := gob.NewDecoder(r)
 
 	if err := decoder.Decode(&lastMessageId); err != nil {
@@ -206,13 +346,13 @@ func (e *StorageHash) Load(r io.Reader) (lastMessageId int64, err error) {
 			return 0, fmt.Errorf("StorageHash.Load(): can't decode item: %s", err)
 		}
 
-		bucket := e.data[getBucket(exp.Key)]
-		bucket[exp.Key] = new(Item)
-		bucket[exp.Key].expireAt = exp.ExpireAt
-		bucket[exp.Key].kind = exp.Kind
-		bucket[exp.Key].bytes = exp.Bytes
-		bucket[exp.Key].list = exp.List
-		bucket[exp.Key].dict = exp.Dict
+		item, err := exp.item()
+		if err != nil {
+			return 0, fmt.Errorf("StorageHash.Load(): can't restore item %q: %s", exp.Key, err)
+		}
+
+		e.data[getBucket(exp.Key)][exp.Key] = item
+		restoreVersion(exp.Version)
 
 		exp = new(gobExportItem)
 	}
@@ -220,23 +360,88 @@ func (e *StorageHash) Load(r io.Reader) (lastMessageId int64, err error) {
 	return lastMessageId, nil
 }
 
-// FullLock locks storage and all items to ensure exclusive access to its content
-func (e *StorageHash) fullLock() {
-	for b := range e.data {
-		e.mu[b].Lock()
-		for _, v := range e.data[b] {
-			v.Lock()
+// LoadDiff applies diff, dumped by PersistKeys(), to the storage: removes deleted keys and replaces changed ones
+func (e *StorageHash) LoadDiff(r io.Reader) (lastMessageId int64, err error) {
+	r, err = readSnapshotHeader(r)
+	if err != nil {
+		return 0, fmt.Errorf("StorageHash.LoadDiff(): %s", err)
+	}
+
+	decoder := gob.NewDecoder(r)
+
+	if err := decoder.Decode(&lastMessageId); err != nil {
+		return 0, fmt.Errorf("StorageHash.LoadDiff(): can't decode messageId: %s", err)
+	}
+
+	var deleted []string
+	if err := decoder.Decode(&deleted); err != nil {
+		return 0, fmt.Errorf("StorageHash.LoadDiff(): can't decode deleted keys: %s", err)
+	}
+	e.Del(deleted)
+
+	exp := new(gobExportItem)
+	for err := decoder.Decode(exp); err != io.EOF; err = decoder.Decode(exp) {
+		if err != nil {
+			return 0, fmt.Errorf("StorageHash.LoadDiff(): can't decode item: %s", err)
+		}
+
+		item, err := exp.item()
+		if err != nil {
+			return 0, fmt.Errorf("StorageHash.LoadDiff(): can't restore item %q: %s", exp.Key, err)
 		}
+
+		e.AddOrReplaceOne(exp.Key, item)
+		restoreVersion(exp.Version)
+
+		exp = new(gobExportItem)
+	}
+
+	return lastMessageId, nil
+}
+
+// writeSnapshotHeader writes snapshotMagic and SnapshotVersion
+func writeSnapshotHeader(w io.Writer) error {
+	header := make([]byte, len(snapshotMagic)+2)
+	copy(header, snapshotMagic)
+	binary.BigEndian.PutUint16(header[len(snapshotMagic):], SnapshotVersion)
+
+	_, err := w.Write(header)
+	return err
+}
+
+// readSnapshotHeader skips the snapshot header, if any, and returns reader of the rest of the snapshot.
+// Snapshots of newer format versions are rejected with ErrSnapshotVersion
+func readSnapshotHeader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(snapshotMagic))
+	if !bytes.Equal(magic, []byte(snapshotMagic)) {
+		// version 1, without header
+		return br, nil
+	}
+
+	header := make([]byte, len(snapshotMagic)+2)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("can't read header: %s", err)
 	}
+
+	if version := binary.BigEndian.Uint16(header[len(snapshotMagic):]); version < minSnapshotVersion || version > SnapshotVersion {
+		return nil, fmt.Errorf("%s: %d, supported %d..%d", ErrSnapshotVersion, version, minSnapshotVersion, SnapshotVersion)
+	}
+
+	return br, nil
 }
 
-// FullUnlock unlocks storage and all items
-func (e *StorageHash) fullUnlock() {
+// bucketsRLock locks all buckets of the storage for reading
+func (e *StorageHash) bucketsRLock() {
 	for b := range e.data {
-		for _, v := range e.data[b] {
-			v.Unlock()
-		}
-		e.mu[b].Unlock()
+		e.mu[b].RLock()
+	}
+}
+
+// bucketsRUnlock unlocks all buckets of the storage locked by bucketsRLock
+func (e *StorageHash) bucketsRUnlock() {
+	for b := range e.data {
+		e.mu[b].RUnlock()
 	}
 }
 
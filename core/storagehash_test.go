@@ -3,6 +3,7 @@ package core_test
 import (
 	"bufio"
 	"bytes"
+	"encoding/gob"
 	"fmt"
 	"github.com/go-test/deep"
 	. "github.com/mshaverdo/radish/core"
@@ -11,7 +12,9 @@ import (
 	"math/rand"
 	"os"
 	"reflect"
+	"runtime"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -30,6 +33,16 @@ func getSampleDataStorageHash() map[string]*Item {
 			[]byte("KMFDM"),
 		}),
 		"測": NewItemBytes([]byte("幽霊はヨーロッパを追いかけています - 共産主義の幽霊")),
+		"zset": NewItemSortedSet(map[string]float64{
+			"Abba":      1972,
+			"Rammstein": 1994,
+			"KMFDM":     1984,
+			"Kraftwerk": 1970,
+			"Ramones":   1974,
+			"Deftones":  1988,
+			"Tool":      1990,
+			"Slayer":    1981,
+		}),
 	}
 }
 
@@ -106,12 +119,39 @@ func TestStorageHash_Keys(t *testing.T) {
 	}
 }
 
+func TestStorageHash_ViewKeys(t *testing.T) {
+	data := getSampleDataStorageHash()
+	e := NewStorageHash()
+	e.SetData(data)
+
+	var want []string
+	for key := range data {
+		want = append(want, key)
+	}
+
+	var got []string
+	e.ViewKeys(func(forEach KeyIterator) {
+		forEach(func(key string, item *Item) {
+			if item != data[key] {
+				t.Errorf("ViewKeys(): unexpected item for %q", key)
+			}
+			got = append(got, key)
+		})
+	})
+	sort.Strings(got)
+	sort.Strings(want)
+
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Errorf("ViewKeys(): %s\n\ngot:%v\n\nwant:%v", diff, got, want)
+	}
+}
+
 func TestStorageHash_Del(t *testing.T) {
 	tests := []struct {
 		keys, want []string
 	}{
-		{[]string{"404", "測"}, []string{"bytes", "dict", "list"}},
-		{[]string{"bytes", "dict"}, []string{"list"}},
+		{[]string{"404", "測"}, []string{"bytes", "dict", "list", "zset"}},
+		{[]string{"bytes", "dict"}, []string{"list", "zset"}},
 	}
 
 	data := getSampleDataStorageHash()
@@ -141,12 +181,12 @@ func TestStorageHash_DelSubmap(t *testing.T) {
 		{
 			map[string]*Item{"404": nil, "測": data["bytes"], "list": data["list"]},
 			1,
-			[]string{"bytes", "dict", "測"},
+			[]string{"bytes", "dict", "zset", "測"},
 		},
 		{
 			map[string]*Item{"測": nil, "dict": data["dict"], "bytes": data["bytes"]},
 			2,
-			[]string{"測"},
+			[]string{"zset", "測"},
 		},
 	}
 
@@ -154,7 +194,7 @@ func TestStorageHash_DelSubmap(t *testing.T) {
 	e.SetData(data)
 
 	for _, tst := range tests {
-		count := e.DelSubmap(tst.submap)
+		count := len(e.DelSubmap(tst.submap))
 		got := e.Keys()
 
 		sort.Strings(got)
@@ -252,6 +292,36 @@ func GetFilledStorageHash(n int) *StorageHash {
 	return s
 }
 
+func TestStorageHash_Compact(t *testing.T) {
+	e := NewStorageHash()
+	e.SetData(getSampleDataStorageHash())
+	for i := 0; i < 200000; i++ {
+		e.AddOrReplaceOne(fmt.Sprintf("temp%d", i), NewItemBytes(nil))
+	}
+	e.Del(e.Keys())
+	e.SetData(getSampleDataStorageHash())
+	want := e.Data()
+
+	heapInuse := func() uint64 {
+		var stats runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&stats)
+		return stats.HeapInuse
+	}
+
+	before := heapInuse()
+	e.Compact()
+	after := heapInuse()
+
+	if !reflect.DeepEqual(e.Data(), want) {
+		t.Errorf("Compact(): data mismatch: \ngot:%q\n\nwant:%q", e.Data(), want)
+	}
+	// 200k map entries take about 7MB
+	if before < after+1<<20 {
+		t.Errorf("Compact(): heap in use %d -> %d, want at least 1MB released", before, after)
+	}
+}
+
 func TestStorageHash_PersistLoad(t *testing.T) {
 	persisting := NewStorageHash()
 	persisting.SetData(getSampleDataStorageHash())
@@ -278,6 +348,163 @@ func TestStorageHash_PersistLoad(t *testing.T) {
 	}
 }
 
+func TestStorageHash_LoadSnapshotVersion(t *testing.T) {
+	persisting := NewStorageHash()
+	persisting.SetData(getSampleDataStorageHash())
+	buf := bytes.NewBuffer(nil)
+	if err := persisting.Persist(buf, 1); err != nil {
+		t.Fatalf("Failed to persist: %s", err)
+	}
+
+	header := []byte("RADISH-SNAPSHOT\x00\x02")
+	if !bytes.HasPrefix(buf.Bytes(), header) {
+		t.Fatalf("Persist(): got header %q, want %q", buf.Bytes()[:len(header)], header)
+	}
+
+	// snapshot of the next format version
+	newer := append([]byte("RADISH-SNAPSHOT\x00\x03"), buf.Bytes()[len(header):]...)
+	if _, err := NewStorageHash().Load(bytes.NewReader(append([]byte("RADISH-SNAPSHOT\x00\x00"), buf.Bytes()[len(header):]...))); err == nil {
+		t.Errorf("Load() of version 0: got nil err, want %s", ErrSnapshotVersion)
+	}
+	if _, err := NewStorageHash().Load(bytes.NewReader(newer)); err == nil || !strings.Contains(err.Error(), ErrSnapshotVersion.Error()) {
+		t.Errorf("Load() of version 3: got err %v, want %s", err, ErrSnapshotVersion)
+	}
+	if _, err := NewStorageHash().LoadDiff(bytes.NewReader(newer)); err == nil || !strings.Contains(err.Error(), ErrSnapshotVersion.Error()) {
+		t.Errorf("LoadDiff() of version 3: got err %v, want %s", err, ErrSnapshotVersion)
+	}
+}
+
+func TestStorageHash_LoadSnapshotV1(t *testing.T) {
+	// written by Persist() of snapshot format version 1, without header
+	file, err := os.Open("testdata/storage_v1.gob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	loading := NewStorageHash()
+	messageId, err := loading.Load(file)
+	if err != nil {
+		t.Fatalf("Failed to load: %s", err)
+	}
+	if messageId != 42 {
+		t.Errorf("Invalid messageId: %d != %d", messageId, 42)
+	}
+
+	data := loading.Data()
+	if len(data) != 5 {
+		t.Errorf("Load(): got %d keys, want 5", len(data))
+	}
+	if got := data["bytes"]; got == nil || string(got.Bytes()) != "Призрак бродит по Европе" {
+		t.Errorf("Load(): got bytes %v", got)
+	}
+	if got := data["list"]; got == nil || len(got.List()) != 2 || string(got.List()[1]) != "Rammstein" {
+		t.Errorf("Load(): got list %v", got)
+	}
+	if got := data["dict"]; got == nil || string(got.Dict()["banana"]) != "mama" {
+		t.Errorf("Load(): got dict %v", got)
+	}
+	if got := data["zset"]; got == nil || got.Kind() != SortedSet || got.String() != NewItemSortedSet(map[string]float64{"Kraftwerk": 1970, "Ramones": 1974}).String() {
+		t.Errorf("Load(): got zset %v", got)
+	}
+	if got := data["expiring"]; got == nil || !got.ExpireAt().Equal(time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Load(): got expiring %v", got)
+	}
+
+	// an old snapshot is upgraded to the current format, when persisted
+	buf := bytes.NewBuffer(nil)
+	if err := loading.Persist(buf, messageId); err != nil {
+		t.Fatalf("Failed to persist: %s", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("RADISH-SNAPSHOT\x00\x02")) {
+		t.Errorf("Persist(): got %q, want header of version 2", buf.Bytes())
+	}
+	upgraded := NewStorageHash()
+	if _, err := upgraded.Load(buf); err != nil {
+		t.Fatalf("Failed to load upgraded snapshot: %s", err)
+	}
+	if !reflect.DeepEqual(upgraded.Data(), data) {
+		t.Errorf("Upgraded snapshot data mismatch: \ngot:%q\n\nwant:%q", upgraded.Data(), data)
+	}
+}
+
+func TestStorageHash_LoadAddedFields(t *testing.T) {
+	// item of a newer binary with an additional field, added without a version bump
+	type gobExportItem struct {
+		Key       string
+		Kind      ItemKind
+		Bytes     []byte
+		Frequency int
+	}
+
+	buf := bytes.NewBuffer([]byte("RADISH-SNAPSHOT\x00\x02"))
+	encoder := gob.NewEncoder(buf)
+	if err := encoder.Encode(int64(7)); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.Encode(gobExportItem{Key: "key", Kind: Bytes, Bytes: []byte("value"), Frequency: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	loading := NewStorageHash()
+	if messageId, err := loading.Load(buf); messageId != 7 || err != nil {
+		t.Fatalf("Load(): got %d, %v, want 7, nil", messageId, err)
+	}
+	if got := loading.Get("key"); got == nil || string(got.Bytes()) != "value" {
+		t.Errorf("Load(): got %v, want value", got)
+	}
+}
+
+func TestStorageHash_LoadUnknownKind(t *testing.T) {
+	item := NewItemBytes([]byte("value"))
+	item.SetKind(SortedSet + 1)
+	persisting := NewStorageHash()
+	persisting.SetData(map[string]*Item{"future": item})
+	buf := bytes.NewBuffer(nil)
+	if err := persisting.Persist(buf, 1); err != nil {
+		t.Fatalf("Failed to persist: %s", err)
+	}
+
+	if _, err := NewStorageHash().Load(buf); err == nil || !strings.Contains(err.Error(), "unknown item kind") {
+		t.Errorf("Load() of unknown kind: got err %v, want unknown item kind", err)
+	}
+}
+
+func TestStorageHash_PersistKeysLoadDiff(t *testing.T) {
+	persisting := NewStorageHash()
+	persisting.SetData(getSampleDataStorageHash())
+	base := bytes.NewBuffer(nil)
+	if err := persisting.Persist(base, 10); err != nil {
+		t.Fatalf("Failed to persist: %s", err)
+	}
+
+	persisting.AddOrReplaceOne("list", NewItemBytes([]byte("replaced")))
+	persisting.AddOrReplaceOne("new", NewItemList([][]byte{[]byte("added")}))
+	persisting.AddOrReplaceOne("zset", NewItemSortedSet(map[string]float64{"Kraftwerk": 1970, "Laibach": 1980}))
+	persisting.Del([]string{"dict"})
+	diff := bytes.NewBuffer(nil)
+	if err := persisting.PersistKeys(diff, 20, []string{"list", "new", "zset", "dict", "not_existing"}); err != nil {
+		t.Fatalf("Failed to persist keys: %s", err)
+	}
+
+	loading := NewStorageHash()
+	if _, err := loading.Load(base); err != nil {
+		t.Fatalf("Failed to load: %s", err)
+	}
+	messageId, err := loading.LoadDiff(diff)
+	if err != nil {
+		t.Fatalf("Failed to load diff: %s", err)
+	}
+
+	if messageId != 20 {
+		t.Errorf("Invalid messageId: %d != %d", messageId, 20)
+	}
+
+	if !reflect.DeepEqual(loading.Data(), persisting.Data()) {
+		t.Errorf("PersistKeys/LoadDiff data mismatch: \ngot:%q\n\nwant:%q", loading.Data(), persisting.Data())
+	}
+}
+
 func BenchmarkStorageHash_Persist(b *testing.B) {
 	file, err := ioutil.TempFile("", "storage")
 	w := bufio.NewWriter(file)
@@ -299,6 +526,37 @@ func BenchmarkStorageHash_Persist(b *testing.B) {
 	w.Flush()
 }
 
+// BenchmarkStorageHash_GetDuringPersist measures the worst latency of Get, while storage is persisted
+func BenchmarkStorageHash_GetDuringPersist(b *testing.B) {
+	s := GetFilledStorageHash(300000)
+	keys := s.Keys()
+
+	var maxLatency time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		done := make(chan struct{})
+		go func() {
+			s.Persist(ioutil.Discard, 0)
+			close(done)
+		}()
+
+		for j, persisting := 0, true; persisting; j++ {
+			select {
+			case <-done:
+				persisting = false
+			default:
+				start := time.Now()
+				s.Get(keys[j%len(keys)])
+				if latency := time.Since(start); latency > maxLatency {
+					maxLatency = latency
+				}
+			}
+		}
+	}
+
+	b.ReportMetric(float64(maxLatency.Nanoseconds()), "max-get-ns")
+}
+
 func BenchmarkStorageHash_Load(b *testing.B) {
 	file, err := ioutil.TempFile("", "storage")
 	w := bufio.NewWriter(file)
@@ -0,0 +1,101 @@
+// Package glob implements Redis-compatible glob-style pattern matching, used by KEYS, HKEYS, PSUBSCRIBE, etc.
+package glob
+
+// Match returns true, if s matches pattern. Like in Redis, matching is byte-wise and supports:
+//   - `*` matches any sequence of bytes, including empty one
+//   - `?` matches any single byte
+//   - `[abc]` matches one of listed bytes, `[^abc]` matches any other byte, `[a-z]` matches a range of bytes
+//   - `\` escapes the next byte, both outside and inside of `[...]`
+//
+// Unterminated `[` class ends at the end of pattern and trailing `\` matches itself, as Redis does.
+// Unlike recursive matching of Redis, it backtracks only to the last `*`, so the time is O(len(pattern)*len(s)) at most
+func Match(pattern, s string) bool {
+	p, i := 0, 0
+	// position of the last `*` in the pattern and of the string byte it's currently expanded to
+	starP, starI := -1, 0
+
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starI = p, i
+				p++
+				continue
+			case '?':
+				p++
+				i++
+				continue
+			case '[':
+				if matched, next := matchClass(pattern, p, s[i]); matched {
+					p = next
+					i++
+					continue
+				}
+			case '\\':
+				escaped := p
+				if p+1 < len(pattern) {
+					escaped = p + 1
+				}
+				if pattern[escaped] == s[i] {
+					p = escaped + 1
+					i++
+					continue
+				}
+			default:
+				if pattern[p] == s[i] {
+					p++
+					i++
+					continue
+				}
+			}
+		}
+
+		// mismatch: let the last star consume one more byte
+		if starP < 0 {
+			return false
+		}
+		starI++
+		p, i = starP+1, starI
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// matchClass matches c against `[...]` class, starting at pattern[start],
+// and returns the position in the pattern after the class
+func matchClass(pattern string, start int, c byte) (matched bool, next int) {
+	p := start + 1
+	negate := p < len(pattern) && pattern[p] == '^'
+	if negate {
+		p++
+	}
+
+	for ; p < len(pattern); p++ {
+		switch {
+		case pattern[p] == '\\' && p+1 < len(pattern):
+			p++
+			if pattern[p] == c {
+				matched = true
+			}
+		case pattern[p] == ']':
+			return matched != negate, p + 1
+		case p+2 < len(pattern) && pattern[p+1] == '-':
+			from, to := pattern[p], pattern[p+2]
+			if from > to {
+				from, to = to, from
+			}
+			if c >= from && c <= to {
+				matched = true
+			}
+			p += 2
+		case pattern[p] == c:
+			matched = true
+		}
+	}
+
+	return matched != negate, len(pattern)
+}
@@ -0,0 +1,100 @@
+package glob_test
+
+import (
+	"github.com/mshaverdo/radish/glob"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		// examples of Redis KEYS documentation
+		{"h?llo", "hello", true},
+		{"h?llo", "hallo", true},
+		{"h?llo", "hxllo", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "hllo", true},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hbllo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hallo", true},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+
+		// stars
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"**", "", true},
+		{"a*", "a", true},
+		{"*a", "ba", true},
+		{"*a", "ab", false},
+		{"*a*b", "xaxxbyb", true},
+		{"*a*b", "xaxxby", false},
+		{"a*b*c", "abbbbc", true},
+		{"user:[0-9]*", "user:42", true},
+		{"user:[0-9]*", "user:", false},
+		{"user:[0-9]*", "user:x42", false},
+
+		// classes
+		{"[z-a]", "m", true},
+		{"[a-]", "-", false},
+		{"[a-]", "]", true},
+		{"[]a]", "]", false},
+		{"[]a]", "a", false},
+		{"[]", "a", false},
+		{"[^]", "a", true},
+		{`[\]]`, "]", true},
+		{`[\-a]`, "-", true},
+		{`[a\-z]`, "b", false},
+		{"[abc", "b", true},
+		{"[abc", "d", false},
+		{"[a-c]x", "bx", true},
+		{"a[^a-c]", "ad", true},
+		{"a[^a-c]", "ab", false},
+
+		// escapes
+		{`\?`, "?", true},
+		{`\?`, "a", false},
+		{`\[a]`, "[a]", true},
+		{`a\`, `a\`, true},
+		{`\\`, `\`, true},
+
+		// bytes
+		{"?", "\xff", true},
+		{"?", "ф", false},
+		{"??", "ф", true},
+		{"a\x00*", "a\x00b", true},
+		{"[\x00-\x1f]", "\n", true},
+	}
+
+	for _, tst := range tests {
+		if got := glob.Match(tst.pattern, tst.s); got != tst.want {
+			t.Errorf("Match(%q, %q): got %v, want %v", tst.pattern, tst.s, got, tst.want)
+		}
+	}
+}
+
+func TestMatch_Backtracking(t *testing.T) {
+	// exponential for naive recursive matching
+	pattern := strings.Repeat("a*", 30) + "b"
+	s := strings.Repeat("a", 1000)
+
+	if glob.Match(pattern, s) {
+		t.Errorf("Match(%q, %q): got true, want false", pattern, s)
+	}
+	if !glob.Match(pattern, s+"b") {
+		t.Errorf("Match(%q, %q): got false, want true", pattern, s+"b")
+	}
+}
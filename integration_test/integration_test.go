@@ -3,15 +3,22 @@
 package integration_test
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"github.com/go-redis/redis"
 	"github.com/mshaverdo/radish/controller"
+	"github.com/mshaverdo/radish/core"
 	"github.com/mshaverdo/radish/log"
 	"github.com/mshaverdo/radish/radish-client"
+	"io"
+	"math"
+	"net"
 	"os"
 	"reflect"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -205,6 +212,8 @@ func TestMain(m *testing.M) {
 	//Radish RESP client
 	go func() {
 		controllerResp := controller.New("", radishRespPort, "", 0, 0, 0, false)
+		controllerResp.SetNotifyKeyspaceEvents("KEA")
+		controllerResp.SetDebugEnabled(true)
 		err := controllerResp.ListenAndServe()
 		if err != nil {
 			panic("HTTP controller failed to start:" + err.Error())
@@ -236,6 +245,138 @@ func Test_Set(t *testing.T) {
 	}
 }
 
+func Test_SetExpiration(t *testing.T) {
+	tests := []TestCase{
+		{[]interface{}{"key1", "new1", 5 * time.Second}, `OK`, `5s`},
+		{[]interface{}{"404", "new", 3000 * time.Millisecond}, `OK`, `3s`},
+		{[]interface{}{"key3", "new3", 0 * time.Second}, `OK`, `-1s`},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.Test("Set", tester.getDataTtl, tests)
+		tester.Teardown()
+	}
+}
+
+func Test_SetExInvalidTtl(t *testing.T) {
+	tests := []struct {
+		args []interface{}
+		want string
+	}{
+		{[]interface{}{"SETEX", "key1", 0, "new1"}, `ERROR: ERR invalid expire time in 'setex' command`},
+		{[]interface{}{"SETEX", "key1", -5, "new1"}, `ERROR: ERR invalid expire time in 'setex' command`},
+		{[]interface{}{"SETEX", "404", 0, "new"}, `ERROR: ERR invalid expire time in 'setex' command`},
+		{[]interface{}{"SET", "key1", "new1", "EX", 0}, `ERROR: ERR invalid expire time in 'set' command`},
+		{[]interface{}{"SETEX", "key2", 10, "new2"}, `OK`},
+	}
+
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			// typed HTTP client methods never send non-positive TTL
+			continue
+		}
+
+		tester.Setup(t)
+
+		for _, tst := range tests {
+			cmd := redis.NewStatusCmd(tst.args...)
+			client.Process(cmd)
+			if got := tester.formatCommandResult("Process", cmd.Val(), cmd.Err(), nil); got != tst.want {
+				t.Errorf("%s> %v \n got: %s \n want: %s", tester.name, tst.args, got, tst.want)
+			}
+		}
+
+		// rejected requests don't change or remove the keys
+		if got := client.Get("key1").Val(); got != "val1" {
+			t.Errorf("%s> GET key1 after rejected SETEX: got %q, want %q", tester.name, got, "val1")
+		}
+		if err := client.Get("404").Err(); err != redis.Nil {
+			t.Errorf("%s> GET 404 after rejected SETEX: got err %v, want %v", tester.name, err, redis.Nil)
+		}
+		if got := client.TTL("key2").Val(); got != 10*time.Second {
+			t.Errorf("%s> TTL key2: got %s, want %s", tester.name, got, 10*time.Second)
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_SetNX(t *testing.T) {
+	tests := []TestCase{
+		{[]interface{}{"key1", "new1", 5 * time.Second}, `false`, `val1`},
+		{[]interface{}{"404", "new", 5 * time.Second}, `true`, `new`},
+		{[]interface{}{"404", "newer", 5 * time.Second}, `false`, `new`},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.Test("SetNX", tester.GetDataVal, tests)
+		tester.Teardown()
+	}
+}
+
+func Test_SetKeepTTL(t *testing.T) {
+	for _, tester := range testers {
+		tester.Setup(t)
+
+		switch client := tester.client.(type) {
+		case *radish.Client:
+			client.Set("key1", "old", 100*time.Second)
+			if err := client.Set("key1", "new", radish.KeepTTL).Err(); err != nil {
+				t.Errorf("%s> Set(KeepTTL): got err %v", tester.name, err)
+			}
+			if err := client.Set("404", "new", radish.KeepTTL).Err(); err != nil {
+				t.Errorf("%s> Set(KeepTTL) of not existing key: got err %v", tester.name, err)
+			}
+		case *redis.Client:
+			// go-redis of this version doesn't support KEEPTTL
+			client.Set("key1", "old", 100*time.Second)
+			for _, key := range []string{"key1", "404"} {
+				cmd := redis.NewStatusCmd("SET", key, "new", "KEEPTTL")
+				client.Process(cmd)
+				if err := cmd.Err(); err != nil {
+					t.Errorf("%s> SET %s KEEPTTL: got err %v", tester.name, key, err)
+				}
+			}
+		}
+
+		if got, _ := tester.callCommand("Get", "key1"); got != "new" {
+			t.Errorf("%s> Get(key1): got %v, want new", tester.name, got)
+		}
+		if ttl, _ := tester.callCommand("TTL", "key1"); ttl != 100*time.Second {
+			t.Errorf("%s> TTL(key1): got %v, want 100s", tester.name, ttl)
+		}
+		if ttl, _ := tester.callCommand("TTL", "404"); ttl != -1*time.Second {
+			t.Errorf("%s> TTL(404): got %v, want no expiration", tester.name, ttl)
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_SetXX(t *testing.T) {
+	tests := []TestCase{
+		{[]interface{}{"key1", "new1", 0 * time.Second}, `true`, `new1`},
+		{[]interface{}{"key3", "new3", 5 * time.Second}, `true`, `new3`},
+		{[]interface{}{"404", "new", 0 * time.Second}, `false`, `ERROR: redis: nil`},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.Test("SetXX", tester.GetDataVal, tests)
+		tester.Teardown()
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.callCommand("SetXX", "key1", "new1", 5*time.Second)
+		tester.Test("TTL", nil, []TestCase{{[]interface{}{"key1"}, `5s`, ``}})
+		tester.Teardown()
+	}
+}
+
 func Test_LPush(t *testing.T) {
 	tests := []TestCase{
 		{[]interface{}{"list", "!", "!!", ""}, `8`, `[  ! !! lv0 lv1 lv2 lv3]`},
@@ -252,6 +393,160 @@ func Test_LPush(t *testing.T) {
 	}
 }
 
+func Test_PushEx(t *testing.T) {
+	for _, tester := range testers {
+		if tester.name == "Redis" {
+			// LPUSHEX and HSETEX with a key TTL are Radish-specific
+			continue
+		}
+
+		tester.Setup(t)
+
+		pushEx := func(cmd, key string, expiration time.Duration, values ...interface{}) (int64, error) {
+			switch client := tester.client.(type) {
+			case *radish.Client:
+				var result *radish.IntResult
+				if cmd == "LPUSHEX" {
+					result = client.LPushEx(key, expiration, values...)
+				} else {
+					result = client.HSetEx(key, expiration, values...)
+				}
+				return result.Int64(), result.Err()
+			case *redis.Client:
+				c := redis.NewIntCmd(append([]interface{}{cmd, key, int(expiration.Seconds())}, values...)...)
+				client.Process(c)
+				return c.Result()
+			}
+			return 0, nil
+		}
+
+		tests := []struct {
+			cmd        string
+			key        string
+			expiration time.Duration
+			values     []interface{}
+			want       string
+			wantTtl    string
+		}{
+			{"LPUSHEX", "newlist", 5 * time.Second, []interface{}{"a", "b"}, `2`, `5s`},
+			{"LPUSHEX", "list", 7 * time.Second, []interface{}{"c"}, `6`, `7s`},
+			{"LPUSHEX", "newlist", 0, []interface{}{"c"}, `ERROR: ERR invalid expire time in 'lpushex' command`, `5s`},
+			{"LPUSHEX", "dict", 5 * time.Second, []interface{}{"a"}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, `-1s`},
+			{"HSETEX", "newdict", 5 * time.Second, []interface{}{"f1", "v1", "f2", "v2"}, `2`, `5s`},
+			{"HSETEX", "dict", 7 * time.Second, []interface{}{"f1", "v1", "f9", "v9"}, `1`, `7s`},
+			{"HSETEX", "newdict", 5 * time.Second, []interface{}{"f1", "v1", "f2"}, `ERROR: ERR syntax error`, `5s`},
+			{"HSETEX", "list", 5 * time.Second, []interface{}{"f1", "v1"}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, `7s`},
+		}
+		for _, tst := range tests {
+			count, err := pushEx(tst.cmd, tst.key, tst.expiration, tst.values...)
+			got := fmt.Sprint(count)
+			if err != nil {
+				got = "ERROR: " + err.Error()
+			}
+			if got != tst.want {
+				t.Errorf("%s> %s(%q, %s, %q): got %s, want %s", tester.name, tst.cmd, tst.key, tst.expiration, tst.values, got, tst.want)
+			}
+			val, err := tester.callCommand("TTL", tst.key)
+			if ttl := tester.formatCommandResult("TTL", val, err, nil); ttl != tst.wantTtl {
+				t.Errorf("%s> TTL after %s(%q, %s, %q): got %s, want %s", tester.name, tst.cmd, tst.key, tst.expiration, tst.values, ttl, tst.wantTtl)
+			}
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_LPushCapped(t *testing.T) {
+	for _, tester := range testers {
+		if tester.name == "Redis" {
+			// LPUSHCAP is Radish-specific
+			continue
+		}
+
+		tester.Setup(t)
+
+		lpushCapped := func(key string, maxLen int, policy string, values ...interface{}) (int64, error) {
+			switch client := tester.client.(type) {
+			case *radish.Client:
+				result := client.LPushCapped(key, maxLen, policy, values...)
+				return result.Int64(), result.Err()
+			case *redis.Client:
+				cmd := redis.NewIntCmd(append([]interface{}{"LPUSHCAP", key, maxLen, policy}, values...)...)
+				client.Process(cmd)
+				return cmd.Result()
+			}
+			return 0, nil
+		}
+
+		tests := []struct {
+			key      string
+			maxLen   int
+			policy   string
+			values   []interface{}
+			want     string
+			wantList string
+		}{
+			{"list", 6, "ERROR", []interface{}{"a", "b"}, `ERROR: ERR list would exceed max length`, `[ lv0 lv1 lv2 lv3]`},
+			{"list", 6, "ERROR", []interface{}{"a"}, `6`, `[ a lv0 lv1 lv2 lv3]`},
+			{"list", 3, "TRIM", []interface{}{"c"}, `3`, `[a c lv0]`},
+			{"404", 2, "TRIM", []interface{}{"a", "b", "c"}, `2`, `[b c]`},
+			{"dict", 2, "TRIM", []interface{}{"a"}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`},
+		}
+		for _, tst := range tests {
+			count, err := lpushCapped(tst.key, tst.maxLen, tst.policy, tst.values...)
+			got := fmt.Sprint(count)
+			if err != nil {
+				got = "ERROR: " + err.Error()
+			}
+			if got != tst.want {
+				t.Errorf("%s> LPushCapped(%q, %d, %q, %q): got %s, want %s", tester.name, tst.key, tst.maxLen, tst.policy, tst.values, got, tst.want)
+			}
+			val, err := tester.callCommand("LRange", tst.key, int64(0), int64(-1))
+			if list := tester.formatCommandResult("LRange", val, err, nil); list != tst.wantList {
+				t.Errorf("%s> LRange after LPushCapped(%q, %d, %q, %q): got %s, want %s", tester.name, tst.key, tst.maxLen, tst.policy, tst.values, list, tst.wantList)
+			}
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_ListMaxLength(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok || tester.name == "Redis" {
+			// list-max-length is Radish-specific
+			continue
+		}
+
+		tester.Setup(t)
+
+		if err := client.ConfigSet("list-max-length", "5").Err(); err != nil {
+			t.Fatalf("%s> ConfigSet(): got err %v", tester.name, err)
+		}
+		if err := client.LPush("list", "a", "b").Err(); err == nil || err.Error() != "ERR list would exceed max length" {
+			t.Errorf("%s> LPush() over the limit: got err %v, want list would exceed max length", tester.name, err)
+		}
+
+		if err := client.ConfigSet("list-overflow", "trim").Err(); err != nil {
+			t.Fatalf("%s> ConfigSet(): got err %v", tester.name, err)
+		}
+		if got, err := client.LPush("list", "a", "b").Result(); got != 5 || err != nil {
+			t.Errorf("%s> LPush() with trim: got %d, %v, want 5", tester.name, got, err)
+		}
+		if got := client.LRange("list", 0, -1).Val(); fmt.Sprintf("%q", got) != `["b" "a" "lv0" "" "lv1"]` {
+			t.Errorf("%s> LRange() after trim: got %q, want [b a lv0  lv1]", tester.name, got)
+		}
+		if err := client.ConfigSet("list-overflow", "drop").Err(); err == nil {
+			t.Errorf("%s> ConfigSet(list-overflow, drop): got no error", tester.name)
+		}
+
+		client.ConfigSet("list-max-length", "0")
+		client.ConfigSet("list-overflow", "error")
+		tester.Teardown()
+	}
+}
+
 func Test_HSet(t *testing.T) {
 	tests := []TestCase{
 		{[]interface{}{"dict", "f1", "val1"}, `false`, `map[: dv000 f1: val1 f2: dv2 f3: dv3 f__: ]`},
@@ -271,10 +566,62 @@ func Test_HSet(t *testing.T) {
 	}
 }
 
+func Test_HSetMulti(t *testing.T) {
+	for _, tester := range testers {
+		tester.Setup(t)
+
+		hset := func(key string, fieldsValues ...interface{}) (int64, error) {
+			switch client := tester.client.(type) {
+			case *radish.Client:
+				result := client.HSetPairs(key, fieldsValues...)
+				return result.Int64(), result.Err()
+			case *redis.Client:
+				cmd := redis.NewIntCmd(append([]interface{}{"HSET", key}, fieldsValues...)...)
+				client.Process(cmd)
+				return cmd.Result()
+			}
+			return 0, nil
+		}
+
+		tests := []struct {
+			key          string
+			fieldsValues []interface{}
+			want         string
+			wantDict     string
+		}{
+			{"dict", []interface{}{"f1", "val1", "f5", "!!!", "f6", ""}, `2`, `map[: dv000 f1: val1 f2: dv2 f3: dv3 f5: !!! f6:  f__: ]`},
+			{"404", []interface{}{"a", "1", "b", "2", "a", "3"}, `2`, `map[a: 3 b: 2]`},
+			{"404", []interface{}{"c", "1", "d"}, `ERROR: ERR `, `map[a: 3 b: 2]`}, // Redis and Radish error texts differ
+			{"list", []interface{}{"a", "1", "b", "2"}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`},
+		}
+		for _, tst := range tests {
+			count, err := hset(tst.key, tst.fieldsValues...)
+			got := fmt.Sprint(count)
+			if err != nil {
+				got = "ERROR: " + err.Error()
+			}
+			if !strings.HasPrefix(got, tst.want) {
+				t.Errorf("%s> HSet(%q, %q): got %s, want %s", tester.name, tst.key, tst.fieldsValues, got, tst.want)
+			}
+			val, err := tester.callCommand("HGetAll", tst.key)
+			if dict := tester.formatCommandResult("HGetAll", val, err, nil); dict != tst.wantDict {
+				t.Errorf("%s> HGetAll after HSet(%q, %q): got %s, want %s", tester.name, tst.key, tst.fieldsValues, dict, tst.wantDict)
+			}
+		}
+
+		tester.Teardown()
+	}
+}
+
 func Test_Keys(t *testing.T) {
 	tests := []TestCase{
 		{[]interface{}{"*"}, `[ dict key1 key2 key3 list]`, ``},
 		{[]interface{}{"key*"}, `[key1 key2 key3]`, ``},
+		{[]interface{}{"key[12]"}, `[key1 key2]`, ``},
+		{[]interface{}{"key[^1]"}, `[key2 key3]`, ``},
+		{[]interface{}{"k?y?"}, `[key1 key2 key3]`, ``},
+		{[]interface{}{"[a-d]*"}, `[dict]`, ``},
+		{[]interface{}{`key\*`}, `[]`, ``},
 		{[]interface{}{"\x00"}, `[]`, ``},
 		{[]interface{}{""}, `[]`, ``},
 	}
@@ -301,6 +648,40 @@ func Test_Get(t *testing.T) {
 	}
 }
 
+func Test_EmptyValue(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		args []interface{}
+		want string
+	}{
+		{"Get", []interface{}{"key2"}, `"", <nil>`},
+		{"Get", []interface{}{"404"}, `"", redis: nil`},
+		{"HGet", []interface{}{"dict", "f__"}, `"", <nil>`},
+		{"HGet", []interface{}{"dict", "404"}, `"", redis: nil`},
+		{"LIndex", []interface{}{"list", int64(1)}, `"", <nil>`},
+		{"LIndex", []interface{}{"list", int64(10)}, `"", redis: nil`},
+		{"LRange", []interface{}{"list", int64(1), int64(1)}, `[""], <nil>`},
+		{"LRange", []interface{}{"empty", int64(0), int64(-1)}, `[""], <nil>`},
+		{"LRange", []interface{}{"404", int64(0), int64(-1)}, `[], <nil>`},
+		{"LPop", []interface{}{"empty"}, `"", <nil>`},
+		{"LPop", []interface{}{"404"}, `"", redis: nil`},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.callCommand("Set", "key2", "", 0*time.Second)
+		tester.callCommand("LPush", "empty", "")
+
+		for _, tst := range tests {
+			value, err := tester.callCommand(tst.cmd, tst.args...)
+			if got := fmt.Sprintf("%q, %v", value, err); got != tst.want {
+				t.Errorf("%s> %s(%v): got %s, want %s", tester.name, tst.cmd, tst.args, got, tst.want)
+			}
+		}
+		tester.Teardown()
+	}
+}
+
 func Test_Del(t *testing.T) {
 	tests := []TestCase{
 		{[]interface{}{"404", "key1", ""}, `2`, `[dict key2 key3 list]`},
@@ -346,6 +727,129 @@ func Test_HGetAll(t *testing.T) {
 	}
 }
 
+func Test_HGetAllPairing(t *testing.T) {
+	want := map[string]string{}
+	for i := 0; i < 100; i++ {
+		want[fmt.Sprintf("f%d", i)] = fmt.Sprintf("v%d", i)
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		for field, value := range want {
+			tester.callCommand("HSet", "big", field, value)
+		}
+
+		// order of fields is undefined, but every field must be followed by its value
+		got, err := tester.callCommand("HGetAll", "big")
+		if err != nil {
+			t.Errorf("%s> HGetAll(): got err %v", tester.name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s> HGetAll(): got %v, want %v", tester.name, got, want)
+		}
+		tester.Teardown()
+	}
+}
+
+func Test_HGetAllResp3(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			// RESP3 is supported by RESP only
+			continue
+		}
+
+		tester.Setup(t)
+
+		conn, err := net.Dial("tcp", client.Options().Addr)
+		if err != nil {
+			t.Fatalf("%s> Dial(): %v", tester.name, err)
+		}
+		reader := bufio.NewReader(conn)
+
+		hello := readResp3Reply(t, conn, reader, "HELLO", "3")
+		if _, ok := hello.(map[string]interface{}); !ok {
+			t.Errorf("%s> HELLO 3: got %#v, want map", tester.name, hello)
+		}
+
+		got := readResp3Reply(t, conn, reader, "HGETALL", "dict")
+		want := map[string]interface{}{"f1": "dv1", "f2": "dv2", "f3": "dv3", "f__": "", "": "dv000"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s> HGETALL in RESP3: got %#v, want %#v", tester.name, got, want)
+		}
+
+		// RESP2 array of pairs after switching back
+		readResp3Reply(t, conn, reader, "HELLO", "2")
+		got = readResp3Reply(t, conn, reader, "HGETALL", "dict")
+		if pairs, ok := got.([]interface{}); !ok || len(pairs) != 2*len(want) {
+			t.Errorf("%s> HGETALL in RESP2: got %#v, want flat array", tester.name, got)
+		}
+
+		conn.Close()
+		tester.Teardown()
+	}
+}
+
+// readResp3Reply sends command into raw connection and reads a reply: maps, arrays, strings, integers and nulls
+func readResp3Reply(t *testing.T, conn net.Conn, reader *bufio.Reader, args ...string) interface{} {
+	command := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		command += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := conn.Write([]byte(command)); err != nil {
+		t.Fatalf("%s: write failed: %v", args[0], err)
+	}
+
+	var read func() interface{}
+	read = func() interface{} {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%s: read failed: %v", args[0], err)
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+
+		switch line[0] {
+		case '+', '-':
+			return line[1:]
+		case ':':
+			n, _ := strconv.Atoi(line[1:])
+			return n
+		case '_':
+			return nil
+		case '$':
+			n, _ := strconv.Atoi(line[1:])
+			if n < 0 {
+				return nil
+			}
+			buf := make([]byte, n+2)
+			if _, err := io.ReadFull(reader, buf); err != nil {
+				t.Fatalf("%s: read failed: %v", args[0], err)
+			}
+			return string(buf[:n])
+		case '*':
+			n, _ := strconv.Atoi(line[1:])
+			result := make([]interface{}, n)
+			for i := range result {
+				result[i] = read()
+			}
+			return result
+		case '%':
+			n, _ := strconv.Atoi(line[1:])
+			result := make(map[string]interface{}, n)
+			for i := 0; i < n; i++ {
+				key := read()
+				result[fmt.Sprint(key)] = read()
+			}
+			return result
+		default:
+			t.Fatalf("%s: unexpected reply %q", args[0], line)
+			return nil
+		}
+	}
+
+	return read()
+}
+
 func Test_HDel(t *testing.T) {
 	tests := []TestCase{
 		{[]interface{}{"dict", "f1", "f404"}, `1`, `map[: dv000 f2: dv2 f3: dv3 f__: ]`},
@@ -433,6 +937,97 @@ func Test_LIndex(t *testing.T) {
 	}
 }
 
+func Test_LPos(t *testing.T) {
+	tests := []struct {
+		key, element string
+		rank         int64
+		want         string
+	}{
+		{"dups", "a", 0, `0`},
+		{"dups", "a", 2, `2`},
+		{"dups", "a", -1, `2`},
+		{"dups", "b", -1, `1`},
+		{"dups", "a", 3, `ERROR: redis: nil`},
+		{"dups", "z", 0, `ERROR: redis: nil`},
+		{"list", "", 0, `1`},
+		{"404", "a", 0, `ERROR: redis: nil`},
+		{"dict", "a", 0, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.callCommand("LPush", "dups", "a", "b", "a")
+
+		for _, tst := range tests {
+			var (
+				pos int64
+				err error
+			)
+			switch client := tester.client.(type) {
+			case *redis.Client:
+				args := []interface{}{"LPOS", tst.key, tst.element}
+				if tst.rank != 0 {
+					args = append(args, "RANK", tst.rank)
+				}
+				cmd := redis.NewIntCmd(args...)
+				client.Process(cmd)
+				pos, err = cmd.Result()
+			case *radish.Client:
+				var intPos int
+				intPos, err = client.LPos(tst.key, tst.element, radish.LPosArgs{Rank: tst.rank}).Result()
+				pos = int64(intPos)
+			}
+
+			if got := tester.formatCommandResult("LPos", pos, err, nil); got != tst.want {
+				t.Errorf("%s> LPos(%q, %q, %d) \n got: %s \n want: %s", tester.name, tst.key, tst.element, tst.rank, got, tst.want)
+			}
+		}
+
+		countTests := []struct {
+			key, element string
+			rank, count  int64
+			want         string
+		}{
+			{"dups", "a", -1, 0, `[2 0]`},
+			{"dups", "a", 1, 1, `[0]`},
+			{"dups", "z", 1, 0, `[]`},
+			{"404", "a", 1, 0, `[]`},
+		}
+		for _, tst := range countTests {
+			var (
+				positions []int64
+				err       error
+			)
+			switch client := tester.client.(type) {
+			case *redis.Client:
+				// go-redis SliceCmd keeps reply types, so bulk strings would fail the test
+				cmd := redis.NewSliceCmd("LPOS", tst.key, tst.element, "RANK", tst.rank, "COUNT", tst.count)
+				client.Process(cmd)
+				err = cmd.Err()
+				for _, v := range cmd.Val() {
+					pos, ok := v.(int64)
+					if !ok {
+						err = fmt.Errorf("not an integer: %#v", v)
+						break
+					}
+					positions = append(positions, pos)
+				}
+			case *radish.Client:
+				positions, err = client.LPosCount(tst.key, tst.element, tst.count, radish.LPosArgs{Rank: tst.rank}).Result()
+			}
+
+			if got := tester.formatCommandResult("LPos", positions, err, nil); got != tst.want {
+				t.Errorf(
+					"%s> LPOS %s %s RANK %d COUNT %d \n got: %s \n want: %s",
+					tester.name, tst.key, tst.element, tst.rank, tst.count, got, tst.want,
+				)
+			}
+		}
+
+		tester.Teardown()
+	}
+}
+
 func Test_LSet(t *testing.T) {
 	tests := []TestCase{
 		{[]interface{}{"list", int64(0), "val1"}, `OK`, `[ lv1 lv2 lv3 val1]`},
@@ -473,6 +1068,54 @@ func Test_LPop(t *testing.T) {
 	}
 }
 
+func Test_Meta(t *testing.T) {
+	// both Radish servers run in this process, so the flag is shared
+	core.SetTrackTimestamps(true)
+	defer core.SetTrackTimestamps(false)
+
+	for _, tester := range testers {
+		if tester.name == "Redis" {
+			// META is a Radish extension
+			continue
+		}
+
+		tester.Setup(t)
+		before := time.Now().UnixNano() / int64(time.Millisecond)
+		tester.callCommand("Set", "tracked", "value", time.Hour)
+
+		var (
+			meta map[string]string
+			err  error
+		)
+		switch client := tester.client.(type) {
+		case *redis.Client:
+			cmd := redis.NewStringStringMapCmd("META", "tracked")
+			client.Process(cmd)
+			meta, err = cmd.Result()
+		case *radish.Client:
+			meta, err = client.Meta("tracked").Result()
+		}
+
+		created, _ := strconv.ParseInt(meta["created"], 10, 64)
+		if err != nil || created < before || meta["modified"] != meta["created"] || meta["ttl"] != "3600" {
+			t.Errorf("%s> Meta(tracked): got %v, %v, want created after %d and ttl 3600", tester.name, meta, err, before)
+		}
+
+		switch client := tester.client.(type) {
+		case *redis.Client:
+			cmd := redis.NewStringStringMapCmd("META", "404")
+			client.Process(cmd)
+			err = cmd.Err()
+		case *radish.Client:
+			err = client.Meta("404").Err()
+		}
+		if got := tester.formatCommandResult("Meta", nil, err, nil); got != `ERROR: redis: nil` {
+			t.Errorf("%s> Meta(404): got %s", tester.name, got)
+		}
+		tester.Teardown()
+	}
+}
+
 func Test_TTL(t *testing.T) {
 	tests := []TestCase{
 		{[]interface{}{"key1"}, `-1s`, ``},
@@ -505,6 +1148,79 @@ func Test_Expire(t *testing.T) {
 	}
 }
 
+func Test_ExpireTime(t *testing.T) {
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.callCommand("Expire", "key1", 100*time.Second)
+		deadline := time.Now().Add(100 * time.Second)
+
+		// expireTime returns reply of EXPIRETIME or PEXPIRETIME, radish client result is converted back to Unix time
+		expireTime := func(cmd, key string) (int64, error) {
+			switch client := tester.client.(type) {
+			case *redis.Client:
+				intCmd := redis.NewIntCmd(cmd, key)
+				client.Process(intCmd)
+				return intCmd.Result()
+			case *radish.Client:
+				result := client.ExpireTime(key)
+				if cmd == "PEXPIRETIME" {
+					result = client.PExpireTime(key)
+				}
+				switch val, err := result.Result(); {
+				case err == radish.ErrNotFound:
+					return -2, nil
+				case err != nil:
+					return 0, err
+				case val.IsZero():
+					return -1, nil
+				case cmd == "PEXPIRETIME":
+					return val.UnixNano() / int64(time.Millisecond), nil
+				default:
+					return val.Unix(), nil
+				}
+			}
+			return 0, nil
+		}
+
+		if got, err := expireTime("EXPIRETIME", "key1"); err != nil || got < deadline.Unix()-1 || got > deadline.Unix()+1 {
+			t.Errorf("%s> EXPIRETIME key1: got %d, %v, want about %d", tester.name, got, err, deadline.Unix())
+		}
+		wantMs := deadline.UnixNano() / int64(time.Millisecond)
+		if got, err := expireTime("PEXPIRETIME", "key1"); err != nil || got < wantMs-1000 || got > wantMs {
+			t.Errorf("%s> PEXPIRETIME key1: got %d, %v, want about %d", tester.name, got, err, wantMs)
+		}
+
+		for _, cmd := range []string{"EXPIRETIME", "PEXPIRETIME"} {
+			if got, err := expireTime(cmd, ""); got != -1 || err != nil {
+				t.Errorf("%s> %s of key without TTL: got %d, %v, want -1", tester.name, cmd, got, err)
+			}
+			if got, err := expireTime(cmd, "404"); got != -2 || err != nil {
+				t.Errorf("%s> %s of missing key: got %d, %v, want -2", tester.name, cmd, got, err)
+			}
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_Type(t *testing.T) {
+	tests := []TestCase{
+		{[]interface{}{"key1"}, `string`, ``},
+		{[]interface{}{""}, `string`, ``},
+		{[]interface{}{"list"}, `list`, ``},
+		{[]interface{}{"dict"}, `hash`, ``},
+		{[]interface{}{"zset"}, `zset`, ``},
+		{[]interface{}{"404"}, `none`, ``},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.zAdd("zset", 1.0, "one")
+		tester.Test("Type", nil, tests)
+		tester.Teardown()
+	}
+}
+
 func Test_Persist(t *testing.T) {
 	tests := []TestCase{
 		{[]interface{}{""}, `false`, `-1s`},
@@ -519,3 +1235,2095 @@ func Test_Persist(t *testing.T) {
 		tester.Teardown()
 	}
 }
+
+func Test_MultiExec(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			// transactions are supported by RESP only
+			continue
+		}
+
+		tester.Setup(t)
+
+		var get *redis.StringCmd
+		var lpop *redis.StringCmd
+		_, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.Set("key1", "tx_val1", 0)
+			get = pipe.Get("key1")
+			lpop = pipe.LPop("key1")
+			pipe.LPush("list", "tx_lv")
+			return nil
+		})
+
+		if err == nil || err.Error() != "WRONGTYPE Operation against a key holding the wrong kind of value" {
+			t.Errorf("%s> TxPipelined() err: got %v, want WRONGTYPE", tester.name, err)
+		}
+		if get.Val() != "tx_val1" {
+			t.Errorf("%s> GET inside transaction: got %q, want %q", tester.name, get.Val(), "tx_val1")
+		}
+		if lpop.Err() == nil {
+			t.Errorf("%s> LPOP inside transaction: got nil error, want WRONGTYPE", tester.name)
+		}
+		if got := client.LIndex("list", 0).Val(); got != "tx_lv" {
+			t.Errorf("%s> LINDEX after transaction: got %q, want %q", tester.name, got, "tx_lv")
+		}
+
+		if err := client.Process(redis.NewStatusCmd("EXEC")); err == nil {
+			t.Errorf("%s> EXEC without MULTI: got nil error", tester.name)
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_MultiExecServiceCommands(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			// transactions are supported by RESP only
+			continue
+		}
+
+		tester.Setup(t)
+
+		// commands, handled by the controller itself, work inside a transaction like outside it
+		hRandField := redis.NewStringCmd("HRANDFIELD", "tx_dict")
+		delPattern := redis.NewIntCmd("DELPATTERN", "tx_*")
+		var encoding *redis.StringCmd
+		var eval *redis.Cmd
+		var keys *redis.StringSliceCmd
+		var info *redis.StringCmd
+		_, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.HSet("tx_dict", "field", "value")
+			pipe.Process(hRandField)
+			encoding = pipe.ObjectEncoding("tx_dict")
+			eval = pipe.Eval(`return redis.call("HGET", KEYS[1], "field")`, []string{"tx_dict"})
+			keys = pipe.Keys("tx_*")
+			pipe.Process(delPattern)
+			info = pipe.Info("server")
+			return nil
+		})
+
+		if err != nil {
+			t.Errorf("%s> TxPipelined(): got err %v", tester.name, err)
+		}
+		if got := hRandField.Val(); got != "field" {
+			t.Errorf("%s> HRANDFIELD inside transaction: got %q, want %q", tester.name, got, "field")
+		}
+		if err := encoding.Err(); err != nil {
+			t.Errorf("%s> OBJECT ENCODING inside transaction: got err %v", tester.name, err)
+		}
+		if got := eval.Val(); got != "value" {
+			t.Errorf("%s> EVAL inside transaction: got %v, want %q", tester.name, got, "value")
+		}
+		if got := keys.Val(); !reflect.DeepEqual(got, []string{"tx_dict"}) {
+			t.Errorf("%s> KEYS inside transaction: got %q, want %q", tester.name, got, []string{"tx_dict"})
+		}
+		if got := delPattern.Val(); got != 1 {
+			t.Errorf("%s> DELPATTERN inside transaction: got %d, want %d", tester.name, got, 1)
+		}
+		if err := info.Err(); err != nil {
+			t.Errorf("%s> INFO inside transaction: got err %v", tester.name, err)
+		}
+		if got := client.Exists("tx_dict").Val(); got != 0 {
+			t.Errorf("%s> EXISTS after DELPATTERN inside transaction: got %d, want %d", tester.name, got, 0)
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_MultiExecAbort(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  []interface{}
+	}{
+		{"unknown command", []interface{}{"NOSUCHCOMMAND", "key"}},
+		{"wrong arguments count", []interface{}{"GET"}},
+		{"not allowed inside transaction", []interface{}{"WAIT", "0", "0"}},
+	}
+
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			// transactions are supported by RESP only
+			continue
+		}
+
+		tester.Setup(t)
+
+		for _, tst := range tests {
+			queued := redis.NewCmd(tst.cmd...)
+			_, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+				pipe.Set("tx_key", "value", 0)
+				pipe.Process(queued)
+				return nil
+			})
+
+			if err == nil || !strings.HasPrefix(err.Error(), "EXECABORT") {
+				t.Errorf("%s> %s: got err %v, want EXECABORT", tester.name, tst.name, err)
+			}
+			if got := client.Exists("tx_key").Val(); got != 0 {
+				t.Errorf("%s> %s: discarded transaction applied", tester.name, tst.name)
+			}
+		}
+
+		// the connection isn't left in MULTI mode after EXECABORT
+		if got := client.Set("tx_key", "value", 0).Val(); got != "OK" {
+			t.Errorf("%s> SET after EXECABORT: got %q, want %q", tester.name, got, "OK")
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_Watch(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			// transactions are supported by RESP only
+			continue
+		}
+
+		tester.Setup(t)
+
+		// unchanged watched key: transaction succeeded
+		err := client.Watch(func(tx *redis.Tx) error {
+			_, err := tx.Pipelined(func(pipe redis.Pipeliner) error {
+				pipe.Set("key1", "tx_val1", 0)
+				return nil
+			})
+			return err
+		}, "key1", "404")
+		if err != nil {
+			t.Errorf("%s> Watch() on unchanged keys: got err %v", tester.name, err)
+		}
+
+		// watched key modified concurrently: transaction aborted
+		err = client.Watch(func(tx *redis.Tx) error {
+			// use separate connection to simulate concurrent client
+			client.LPush("list", "concurrent")
+
+			_, err := tx.Pipelined(func(pipe redis.Pipeliner) error {
+				pipe.Set("key1", "tx_val2", 0)
+				return nil
+			})
+			return err
+		}, "key1", "list")
+		if err != redis.TxFailedErr {
+			t.Errorf("%s> Watch() on changed keys: got err %v, want %v", tester.name, err, redis.TxFailedErr)
+		}
+		if got := client.Get("key1").Val(); got != "tx_val1" {
+			t.Errorf("%s> aborted transaction applied: got %q, want %q", tester.name, got, "tx_val1")
+		}
+
+		// watched key created concurrently: transaction aborted
+		err = client.Watch(func(tx *redis.Tx) error {
+			client.Set("404", "created", 0)
+
+			_, err := tx.Pipelined(func(pipe redis.Pipeliner) error {
+				pipe.Set("key1", "tx_val3", 0)
+				return nil
+			})
+			return err
+		}, "404")
+		if err != redis.TxFailedErr {
+			t.Errorf("%s> Watch() on created key: got err %v, want %v", tester.name, err, redis.TxFailedErr)
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_WaitWal(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok || tester.name == "Redis" {
+			// WAITWAL is Radish-specific and tracks writes of a connection, that exists in RESP only
+			continue
+		}
+
+		tester.Setup(t)
+
+		client.Set("key1", "waitwal", 0)
+		// the server isn't persistent, so WAITWAL doesn't block
+		cmd := redis.NewSliceCmd("WAITWAL", 0)
+		client.Process(cmd)
+		if got, err := cmd.Result(); err != nil || fmt.Sprint(got) != "[0 0]" {
+			t.Errorf("%s> WAITWAL 0: got %v, %v, want [0 0]", tester.name, got, err)
+		}
+
+		for _, args := range [][]interface{}{{"WAITWAL"}, {"WAITWAL", "a"}, {"WAITWAL", -1}, {"WAITWAL", 0, 0}} {
+			cmd := redis.NewSliceCmd(args...)
+			client.Process(cmd)
+			if cmd.Err() == nil {
+				t.Errorf("%s> %v: got %v, want error", tester.name, args, cmd.Val())
+			}
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_Reset(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			// connection state exists in RESP only
+			continue
+		}
+
+		tester.Setup(t)
+
+		conn, err := net.Dial("tcp", client.Options().Addr)
+		if err != nil {
+			t.Fatalf("%s> Dial(): %v", tester.name, err)
+		}
+		reader := bufio.NewReader(conn)
+
+		readResp3Reply(t, conn, reader, "HELLO", "3")
+		readResp3Reply(t, conn, reader, "WATCH", "key2")
+		readResp3Reply(t, conn, reader, "MULTI")
+		readResp3Reply(t, conn, reader, "SET", "key1", "reset_val")
+		if got := readResp3Reply(t, conn, reader, "RESET"); got != "RESET" {
+			t.Errorf("%s> RESET inside MULTI: got %#v, want RESET", tester.name, got)
+		}
+		if got := readResp3Reply(t, conn, reader, "EXEC"); got != "ERR EXEC without MULTI" {
+			t.Errorf("%s> EXEC after RESET: got %#v, want error", tester.name, got)
+		}
+		if got := client.Get("key1").Val(); got != "val1" {
+			t.Errorf("%s> GET of key, queued before RESET: got %q, want %q", tester.name, got, "val1")
+		}
+		if got := readResp3Reply(t, conn, reader, "HGETALL", "dict"); reflect.TypeOf(got) != reflect.TypeOf([]interface{}{}) {
+			t.Errorf("%s> HGETALL after RESET: got %#v, want RESP2 flat array", tester.name, got)
+		}
+
+		readResp3Reply(t, conn, reader, "SUBSCRIBE", "reset_channel")
+		if got := readResp3Reply(t, conn, reader, "RESET"); got != "RESET" {
+			t.Errorf("%s> RESET of subscriber: got %#v, want RESET", tester.name, got)
+		}
+		if got := client.Publish("reset_channel", "hello").Val(); got != 0 {
+			t.Errorf("%s> PUBLISH after RESET: got %d receivers, want 0", tester.name, got)
+		}
+		if got := readResp3Reply(t, conn, reader, "GET", "key2"); got != "val2" {
+			t.Errorf("%s> GET after RESET of subscriber: got %#v, want %q", tester.name, got, "val2")
+		}
+
+		if got := readResp3Reply(t, conn, reader, "RESET", "extra"); got != "ERR wrong number of arguments for 'reset' command" {
+			t.Errorf("%s> RESET extra: got %#v, want error", tester.name, got)
+		}
+
+		conn.Close()
+		tester.Teardown()
+	}
+}
+
+func Test_Select(t *testing.T) {
+	tests := []struct {
+		args       []interface{}
+		want       string
+		radishOnly bool
+	}{
+		{[]interface{}{"SELECT", 0}, `OK`, false},
+		{[]interface{}{"SELECT", 16}, `ERROR: ERR DB index is out of range`, false},
+		{[]interface{}{"SELECT", "zero"}, `ERROR: ERR value is not an integer or out of range`, false},
+		{[]interface{}{"SELECT"}, `ERROR: ERR wrong number of arguments for 'select' command`, false},
+		{[]interface{}{"SELECT", 1}, `ERROR: ERR DB index is out of range`, true},
+	}
+
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			// SELECT is supported by RESP only
+			continue
+		}
+
+		tester.Setup(t)
+
+		for _, tst := range tests {
+			if tst.radishOnly && tester.name == "Redis" {
+				continue
+			}
+
+			cmd := redis.NewStatusCmd(tst.args...)
+			client.Process(cmd)
+			if got := tester.formatCommandResult("Select", cmd.Val(), cmd.Err(), nil); got != tst.want {
+				t.Errorf("%s> %v \n got: %s \n want: %s", tester.name, tst.args, got, tst.want)
+			}
+		}
+
+		if got := client.Get("key1").Val(); got != "val1" {
+			t.Errorf("%s> GET after SELECT 0: got %q, want %q", tester.name, got, "val1")
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_WrongArgumentsCount(t *testing.T) {
+	tests := []struct {
+		args       []interface{}
+		want       string
+		radishOnly bool
+	}{
+		{[]interface{}{"GET"}, `ERROR: ERR wrong number of arguments for 'get' command`, false},
+		{[]interface{}{"GET", "key1", "key2"}, `ERROR: ERR wrong number of arguments for 'get' command`, false},
+		{[]interface{}{"HSET", "dict", "f1"}, `ERROR: ERR wrong number of arguments for 'hset' command`, false},
+		{[]interface{}{"LPUSH", "list"}, `ERROR: ERR wrong number of arguments for 'lpush' command`, false},
+		{[]interface{}{"HGETALL"}, `ERROR: ERR wrong number of arguments for 'hgetall' command`, false},
+		// subcommands are named like in Redis 7
+		{[]interface{}{"CONFIG", "GET"}, `ERROR: ERR wrong number of arguments for 'config|get' command`, true},
+	}
+
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			// typed HTTP client methods never send wrong arguments count
+			continue
+		}
+
+		tester.Setup(t)
+
+		for _, tst := range tests {
+			if tst.radishOnly && tester.name == "Redis" {
+				continue
+			}
+
+			cmd := redis.NewCmd(tst.args...)
+			client.Process(cmd)
+			if got := tester.formatCommandResult("Process", cmd.Val(), cmd.Err(), nil); got != tst.want {
+				t.Errorf("%s> %v \n got: %s \n want: %s", tester.name, tst.args, got, tst.want)
+			}
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_PubSub(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			// pub/sub is supported by RESP only
+			continue
+		}
+
+		tester.Setup(t)
+
+		pubsub := client.Subscribe("channel1", "channel2")
+
+		for _, channel := range []string{"channel1", "channel2"} {
+			reply, err := pubsub.ReceiveTimeout(time.Second)
+			if err != nil {
+				t.Fatalf("%s> Subscribe(): got err %v", tester.name, err)
+			}
+			if subscription, ok := reply.(*redis.Subscription); !ok || subscription.Channel != channel {
+				t.Errorf("%s> Subscribe(): got %v, want subscription to %q", tester.name, reply, channel)
+			}
+		}
+
+		if got := client.Publish("channel2", "hello").Val(); got != 1 {
+			t.Errorf("%s> Publish(): got %d receivers, want 1", tester.name, got)
+		}
+		if got := client.Publish("404", "hello").Val(); got != 0 {
+			t.Errorf("%s> Publish() to channel without subscribers: got %d receivers, want 0", tester.name, got)
+		}
+
+		reply, err := pubsub.ReceiveTimeout(time.Second)
+		if err != nil {
+			t.Fatalf("%s> Receive(): got err %v", tester.name, err)
+		}
+		msg, ok := reply.(*redis.Message)
+		if !ok || msg.Channel != "channel2" || msg.Payload != "hello" {
+			t.Errorf("%s> Receive(): got %v, want message %q from %q", tester.name, reply, "hello", "channel2")
+		}
+
+		pubsub.Close()
+		tester.Teardown()
+	}
+}
+
+func Test_PSubscribe(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			// pub/sub is supported by RESP only
+			continue
+		}
+
+		tester.Setup(t)
+
+		exact := client.Subscribe("news.tech")
+		pattern := client.PSubscribe("news.*")
+		for _, pubsub := range []*redis.PubSub{exact, pattern} {
+			if _, err := pubsub.ReceiveTimeout(time.Second); err != nil {
+				t.Fatalf("%s> subscription: got err %v", tester.name, err)
+			}
+		}
+
+		if got := client.Publish("news.tech", "hello").Val(); got != 2 {
+			t.Errorf("%s> Publish(): got %d receivers, want 2", tester.name, got)
+		}
+		if got := client.Publish("weather", "hello").Val(); got != 0 {
+			t.Errorf("%s> Publish() to unmatched channel: got %d receivers, want 0", tester.name, got)
+		}
+
+		want := map[*redis.PubSub]redis.Message{
+			exact:   {Channel: "news.tech", Payload: "hello"},
+			pattern: {Channel: "news.tech", Pattern: "news.*", Payload: "hello"},
+		}
+		for pubsub, wantMsg := range want {
+			reply, err := pubsub.ReceiveTimeout(time.Second)
+			if err != nil {
+				t.Fatalf("%s> Receive(): got err %v", tester.name, err)
+			}
+			if msg, ok := reply.(*redis.Message); !ok || *msg != wantMsg {
+				t.Errorf("%s> Receive(): got %v, want %v", tester.name, reply, wantMsg)
+			}
+		}
+
+		exact.Close()
+		pattern.Close()
+		tester.Teardown()
+	}
+}
+
+func Test_KeyspaceNotifications(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok || tester.name == "Redis" {
+			// notifications are supported by RESP only and enabled explicitly for Radish
+			continue
+		}
+
+		tester.Setup(t)
+
+		pubsub := client.PSubscribe("__key*@0__:*")
+		if _, err := pubsub.ReceiveTimeout(time.Second); err != nil {
+			t.Fatalf("%s> PSubscribe(): got err %v", tester.name, err)
+		}
+
+		client.Set("nkey", "val", 0)
+		client.Del("nkey", "404")
+
+		want := []redis.Message{
+			{Pattern: "__key*@0__:*", Channel: "__keyspace@0__:nkey", Payload: "set"},
+			{Pattern: "__key*@0__:*", Channel: "__keyevent@0__:set", Payload: "nkey"},
+			{Pattern: "__key*@0__:*", Channel: "__keyspace@0__:nkey", Payload: "del"},
+			{Pattern: "__key*@0__:*", Channel: "__keyevent@0__:del", Payload: "nkey"},
+		}
+		for _, wantMsg := range want {
+			reply, err := pubsub.ReceiveTimeout(time.Second)
+			if err != nil {
+				t.Fatalf("%s> Receive(): got err %v", tester.name, err)
+			}
+			if msg, ok := reply.(*redis.Message); !ok || *msg != wantMsg {
+				t.Errorf("%s> Receive(): got %v, want %v", tester.name, reply, wantMsg)
+			}
+		}
+
+		pubsub.Close()
+		tester.Teardown()
+	}
+}
+
+func Test_Eval(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			// scripting is supported by RESP only
+			continue
+		}
+
+		tester.Setup(t)
+
+		script := `redis.call("SET", KEYS[1], ARGV[1]); return {redis.call("GET", KEYS[1]), redis.call("LLEN", "404"), false}`
+		got, err := client.Eval(script, []string{"skey"}, "sval").Result()
+		if err != nil {
+			t.Errorf("%s> Eval(): got err %v", tester.name, err)
+		}
+		if want := []interface{}{"sval", int64(0), nil}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s> Eval(): got %v, want %v", tester.name, got, want)
+		}
+
+		// integer slices are Lua tables of numbers
+		script = `redis.call("LPUSH", KEYS[1], "a", "b", "a"); return redis.call("LPOS", KEYS[1], "a", "COUNT", 0)`
+		if got, err := client.Eval(script, []string{"slist"}).Result(); err != nil || !reflect.DeepEqual(got, []interface{}{int64(0), int64(2)}) {
+			t.Errorf("%s> Eval() with LPOS COUNT: got %v, %v, want [0 2]", tester.name, got, err)
+		}
+
+		// failed BITFIELD operations are false in Lua and null in the reply
+		script = `return redis.call("BITFIELD", KEYS[1], "SET", "u8", 0, 200, "GET", "u8", 0, "OVERFLOW", "FAIL", "INCRBY", "u8", 0, 100)`
+		if got, err := client.Eval(script, []string{"sbits"}).Result(); err != nil || !reflect.DeepEqual(got, []interface{}{int64(0), int64(200), nil}) {
+			t.Errorf("%s> Eval() with BITFIELD: got %v, %v, want [0 200 <nil>]", tester.name, got, err)
+		}
+
+		// status reply is sent as is, TYPE result is a status
+		if got := client.Eval(`return redis.status_reply("PONG")`, nil).Val(); got != "PONG" {
+			t.Errorf("%s> Eval() with status reply: got %v, want %q", tester.name, got, "PONG")
+		}
+		if got := client.Eval(`return redis.call("TYPE", KEYS[1])["ok"]`, []string{"skey"}).Val(); got != "string" {
+			t.Errorf("%s> Eval() with TYPE: got %v, want %q", tester.name, got, "string")
+		}
+
+		// redis.call() raises error on command failure
+		if err := client.Eval(`return redis.call("LLEN", KEYS[1])`, []string{"skey"}).Err(); err == nil {
+			t.Errorf("%s> Eval() with failed command: got no error", tester.name)
+		}
+		// redis.pcall() returns error as a reply
+		if err := client.Eval(`return redis.pcall("LLEN", KEYS[1])`, []string{"skey"}).Err(); err == nil {
+			t.Errorf("%s> Eval() with failed pcall: got no error", tester.name)
+		}
+
+		sha, err := client.ScriptLoad(`return redis.call("GET", KEYS[1])`).Result()
+		if err != nil {
+			t.Errorf("%s> ScriptLoad(): got err %v", tester.name, err)
+		}
+		if got := client.ScriptExists(sha, "0000000000000000000000000000000000000000").Val(); !reflect.DeepEqual(got, []bool{true, false}) {
+			t.Errorf("%s> ScriptExists(): got %v, want %v", tester.name, got, []bool{true, false})
+		}
+		if got := client.EvalSha(sha, []string{"skey"}).Val(); got != "sval" {
+			t.Errorf("%s> EvalSha(): got %v, want %q", tester.name, got, "sval")
+		}
+		if err := client.EvalSha("0000000000000000000000000000000000000000", nil).Err(); err == nil || !strings.HasPrefix(err.Error(), "NOSCRIPT") {
+			t.Errorf("%s> EvalSha() of unknown script: got err %v, want NOSCRIPT", tester.name, err)
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_EvalServiceCommands(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok || tester.name == "Redis" {
+			// DELPATTERN is Radish-specific
+			continue
+		}
+
+		tester.Setup(t)
+
+		// commands, handled by the controller itself, are called from scripts like from clients
+		script := `redis.call("SET", "skey1", "v"); redis.call("SET", "skey2", "v");
+			return {redis.call("DELPATTERN", "skey*"), #redis.call("HRANDFIELD", KEYS[1], -5), #redis.call("KEYS", "skey*")}`
+		got, err := client.Eval(script, []string{"dict"}).Result()
+		if err != nil {
+			t.Errorf("%s> Eval(): got err %v", tester.name, err)
+		}
+		if want := []interface{}{int64(2), int64(5), int64(0)}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s> Eval(): got %v, want %v", tester.name, got, want)
+		}
+
+		err = client.Eval(`return redis.call("SHUTDOWN")`, nil).Err()
+		if err == nil || !strings.Contains(err.Error(), "not allowed from script") {
+			t.Errorf("%s> Eval() with SHUTDOWN: got err %v, want not allowed", tester.name, err)
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_ReadOnly(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok || tester.name == "Redis" {
+			// CONFIG SET read-only is Radish-specific
+			continue
+		}
+
+		tester.Setup(t)
+
+		if err := client.ConfigSet("read-only", "yes").Err(); err != nil {
+			t.Fatalf("%s> ConfigSet(): got err %v", tester.name, err)
+		}
+		if got := client.ConfigGet("read-only").Val(); !reflect.DeepEqual(got, []interface{}{"read-only", "yes"}) {
+			t.Errorf("%s> ConfigGet(): got %v", tester.name, got)
+		}
+		if got := client.Info("server").Val(); !strings.Contains(got, "read_only:1") {
+			t.Errorf("%s> Info(): got %q, want read_only:1", tester.name, got)
+		}
+
+		if err := client.Set("key1", "new", 0).Err(); err == nil || !strings.HasPrefix(err.Error(), "READONLY") {
+			t.Errorf("%s> Set() in read-only mode: got err %v, want READONLY", tester.name, err)
+		}
+		if got := client.Get("key1").Val(); got != "val1" {
+			t.Errorf("%s> Get() in read-only mode: got %q, want %q", tester.name, got, "val1")
+		}
+
+		if err := client.ConfigSet("read-only", "no").Err(); err != nil {
+			t.Fatalf("%s> ConfigSet(): got err %v", tester.name, err)
+		}
+		if err := client.Set("key1", "new", 0).Err(); err != nil {
+			t.Errorf("%s> Set() after read-only mode: got err %v", tester.name, err)
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_ObjectEncoding(t *testing.T) {
+	tests := []TestCase{
+		{[]interface{}{"key1"}, `raw`, ``},
+		{[]interface{}{"list"}, `linkedlist`, ``},
+		{[]interface{}{"dict"}, `hashtable`, ``},
+		{[]interface{}{"404"}, `ERROR: redis: nil`, ``},
+	}
+
+	for _, tester := range testers {
+		if tester.name == "Redis" {
+			// Redis uses compact encodings for small values
+			continue
+		}
+
+		tester.Setup(t)
+		tester.Test("ObjectEncoding", nil, tests)
+		tester.Teardown()
+	}
+}
+
+func Test_ObjectRefCount(t *testing.T) {
+	tests := []TestCase{
+		{[]interface{}{"key1"}, `1`, ``},
+		{[]interface{}{"counter"}, `2147483647`, ``},
+		{[]interface{}{"big"}, `1`, ``},
+		{[]interface{}{"list"}, `1`, ``},
+		{[]interface{}{"404"}, `ERROR: redis: nil`, ``},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.callCommand("Set", "counter", 42, time.Duration(0))
+		tester.callCommand("Set", "big", 100000, time.Duration(0))
+		tester.Test("ObjectRefCount", nil, tests)
+		tester.Teardown()
+	}
+}
+
+func Test_Debug(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok || tester.name == "Redis" {
+			// DEBUG is disabled in Redis by default
+			continue
+		}
+
+		debug := func(args ...interface{}) error {
+			return client.Process(redis.NewStatusCmd(append([]interface{}{"DEBUG"}, args...)...))
+		}
+
+		start := time.Now()
+		if err := debug("SLEEP", "0.2"); err != nil {
+			t.Errorf("%s> DEBUG SLEEP: got err %v", tester.name, err)
+		}
+		if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+			t.Errorf("%s> DEBUG SLEEP: returned after %s, want at least 200ms", tester.name, elapsed)
+		}
+
+		for _, arg := range []string{"0", "1"} {
+			if err := debug("SET-ACTIVE-EXPIRE", arg); err != nil {
+				t.Errorf("%s> DEBUG SET-ACTIVE-EXPIRE %s: got err %v", tester.name, arg, err)
+			}
+		}
+
+		if err := debug("SET-ACTIVE-EXPIRE", "2"); err == nil {
+			t.Errorf("%s> DEBUG SET-ACTIVE-EXPIRE 2: got nil err", tester.name)
+		}
+
+		tester.Setup(t)
+		object := redis.NewStatusCmd("DEBUG", "OBJECT", "list")
+		client.Process(object)
+		for _, field := range []string{"encoding:linkedlist", "serializedlength:12", "list_length:5"} {
+			if !strings.Contains(object.Val(), " "+field) || object.Err() != nil {
+				t.Errorf("%s> DEBUG OBJECT list: got %q, %v, want %s", tester.name, object.Val(), object.Err(), field)
+			}
+		}
+		if err := debug("OBJECT", "404"); err != redis.Nil {
+			t.Errorf("%s> DEBUG OBJECT 404: got err %v, want %v", tester.name, err, redis.Nil)
+		}
+
+		if err := debug("RELOAD"); err != nil {
+			t.Errorf("%s> DEBUG RELOAD: got err %v", tester.name, err)
+		}
+		if got := client.Get("key1"); got.Val() != "val1" || got.Err() != nil {
+			t.Errorf("%s> GET key1 after DEBUG RELOAD: got %q, %v, want val1", tester.name, got.Val(), got.Err())
+		}
+		if got := client.HGetAll("dict"); len(got.Val()) != 5 || got.Err() != nil {
+			t.Errorf("%s> HGETALL dict after DEBUG RELOAD: got %v, %v, want 5 fields", tester.name, got.Val(), got.Err())
+		}
+		tester.Teardown()
+	}
+}
+
+func Test_Latency(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			continue
+		}
+
+		latency := func(args ...interface{}) *redis.Cmd {
+			cmd := redis.NewCmd(append([]interface{}{"LATENCY"}, args...)...)
+			client.Process(cmd)
+			return cmd
+		}
+
+		client.ConfigSet("latency-monitor-threshold", "20")
+		latency("RESET")
+
+		if tester.name != "Redis" {
+			// DEBUG is disabled in Redis by default
+			client.Process(redis.NewStatusCmd("DEBUG", "SLEEP", "0.05"))
+			latest := latency("LATEST")
+			events, ok := latest.Val().([]interface{})
+			if !ok || len(events) != 1 || latest.Err() != nil {
+				t.Fatalf("%s> LATENCY LATEST: got %v, %v, want a single event", tester.name, latest.Val(), latest.Err())
+			}
+			if event := events[0].([]interface{}); len(event) != 4 || event[0] != "command" || event[2].(int64) < 50 {
+				t.Errorf("%s> LATENCY LATEST: got %v, want command event of at least 50ms", tester.name, event)
+			}
+			if history, ok := latency("HISTORY", "command").Val().([]interface{}); !ok || len(history) != 1 {
+				t.Errorf("%s> LATENCY HISTORY command: got %v, want a single sample", tester.name, history)
+			}
+		}
+
+		latency("RESET")
+		if got := latency("LATEST"); len(got.Val().([]interface{})) != 0 || got.Err() != nil {
+			t.Errorf("%s> LATENCY LATEST after RESET: got %v, %v, want empty array", tester.name, got.Val(), got.Err())
+		}
+		client.ConfigSet("latency-monitor-threshold", "0")
+	}
+}
+
+func Test_SetBit(t *testing.T) {
+	tests := []TestCase{
+		{[]interface{}{"key1", int64(7), 1}, `0`, `wal1`},
+		{[]interface{}{"key1", int64(1), 0}, `1`, `6al1`},
+		{[]interface{}{"404", int64(9), 1}, `0`, "\x00@"},
+		{[]interface{}{"key1", int64(-1), 1}, `ERROR: ERR bit offset is not an integer or out of range`, `val1`},
+		{[]interface{}{"key1", int64(1), 2}, `ERROR: ERR bit is not an integer or out of range`, `val1`},
+		{[]interface{}{"list", int64(1), 1}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`},
+	}
+
+	for _, tester := range testers {
+		for _, tst := range tests {
+			// every case starts with fresh data, to check data independently
+			tester.Setup(t)
+			tester.Test("SetBit", tester.GetDataVal, []TestCase{tst})
+			tester.Teardown()
+		}
+	}
+}
+
+func Test_GetBit(t *testing.T) {
+	tests := []TestCase{
+		{[]interface{}{"key1", int64(1)}, `1`, ``},
+		{[]interface{}{"key1", int64(7)}, `0`, ``},
+		{[]interface{}{"key1", int64(100)}, `0`, ``},
+		{[]interface{}{"404", int64(1)}, `0`, ``},
+		{[]interface{}{"dict", int64(1)}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, ``},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.Test("GetBit", nil, tests)
+		tester.Teardown()
+	}
+}
+
+func Test_BitCount(t *testing.T) {
+	tests := []struct {
+		key        string
+		start, end int64
+		isRange    bool
+		want       string
+	}{
+		{"key1", 0, 0, false, `15`},
+		{"key1", 1, 1, true, `3`},
+		{"key1", -2, -1, true, `7`},
+		{"key1", 10, 20, true, `0`},
+		{"404", 0, 0, false, `0`},
+		{"list", 0, 0, false, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+
+		for _, tst := range tests {
+			var (
+				count int64
+				err   error
+			)
+			switch client := tester.client.(type) {
+			case *redis.Client:
+				var bitCount *redis.BitCount
+				if tst.isRange {
+					bitCount = &redis.BitCount{Start: tst.start, End: tst.end}
+				}
+				count, err = client.BitCount(tst.key, bitCount).Result()
+			case *radish.Client:
+				var bitCount *radish.BitCount
+				if tst.isRange {
+					bitCount = &radish.BitCount{Start: tst.start, End: tst.end}
+				}
+				var intCount int
+				intCount, err = client.BitCount(tst.key, bitCount).Result()
+				count = int64(intCount)
+			}
+
+			if got := tester.formatCommandResult("BitCount", count, err, nil); got != tst.want {
+				t.Errorf("%s> BitCount(%q, %d, %d, %t) \n got: %s \n want: %s", tester.name, tst.key, tst.start, tst.end, tst.isRange, got, tst.want)
+			}
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_BitField(t *testing.T) {
+	tests := []struct {
+		key       string
+		args      []interface{}
+		want      string
+		wantValue string
+	}{
+		{"404", []interface{}{"SET", "i8", 0, 100, "INCRBY", "i8", 0, 100}, `[0 -56]`, "\xc8"},
+		{"404", []interface{}{"OVERFLOW", "SAT", "INCRBY", "i8", 0, -100, "OVERFLOW", "FAIL", "INCRBY", "u8", 0, 128}, `[-128 <nil>]`, "\x80"},
+		{"404", []interface{}{"SET", "u4", "#1", 15, "GET", "i4", 4, "GET", "u8", 100}, `[0 -1 0]`, "\x8f"},
+		{"key1", []interface{}{"GET", "u8", 0, "INCRBY", "u8", "#3", 1}, `[118 50]`, `val2`},
+		{"new", []interface{}{"GET", "u8", 0}, `[0]`, `ERROR: redis: nil`},
+		{"new", []interface{}{"OVERFLOW", "FAIL", "SET", "u2", 14, 4}, `[<nil>]`, "\x00\x00"},
+		{"invalid", []interface{}{"SET", "u64", 0, 1}, `ERROR: ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.`, `ERROR: redis: nil`},
+		{"invalid", []interface{}{"OVERFLOW", "NONE", "SET", "i8", 0, 1}, `ERROR: ERR Invalid OVERFLOW type specified`, `ERROR: redis: nil`},
+		{"invalid", []interface{}{"SET", "i8", -1, 1}, `ERROR: ERR bit offset is not an integer or out of range`, `ERROR: redis: nil`},
+		{"invalid", []interface{}{"SET", "i8", 0}, `ERROR: ERR syntax error`, `ERROR: redis: nil`},
+		{"list", []interface{}{"GET", "i8", 0}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+
+		for _, tst := range tests {
+			var (
+				result []string
+				err    error
+			)
+			switch client := tester.client.(type) {
+			case *redis.Client:
+				// go-redis SliceCmd keeps reply types, so nulls and integers are distinguishable
+				cmd := redis.NewSliceCmd(append([]interface{}{"BITFIELD", tst.key}, tst.args...)...)
+				client.Process(cmd)
+				err = cmd.Err()
+				for _, v := range cmd.Val() {
+					if v == nil {
+						result = append(result, "<nil>")
+					} else if value, ok := v.(int64); ok {
+						result = append(result, strconv.FormatInt(value, 10))
+					} else {
+						err = fmt.Errorf("not an integer: %#v", v)
+						break
+					}
+				}
+			case *radish.Client:
+				var cmd = client.BitField(tst.key, tst.args...)
+				err = cmd.Err()
+				for i, v := range cmd.Val() {
+					if cmd.IsNull(i) {
+						result = append(result, "<nil>")
+					} else {
+						result = append(result, strconv.FormatInt(v, 10))
+					}
+				}
+			}
+
+			if got := tester.formatCommandResult("BitField", fmt.Sprintf("%v", result), err, nil); got != tst.want {
+				t.Errorf("%s> BITFIELD %s %v \n got: %s \n want: %s", tester.name, tst.key, tst.args, got, tst.want)
+			}
+			value, err := tester.GetDataVal(TestCase{args: []interface{}{tst.key}})
+			if got := tester.formatCommandResult("Get", value, err, nil); got != tst.wantValue {
+				t.Errorf("%s> BITFIELD %s %v value \n got: %q \n want: %q", tester.name, tst.key, tst.args, got, tst.wantValue)
+			}
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_BitOp(t *testing.T) {
+	tests := []struct {
+		cmd string
+		TestCase
+	}{
+		{"BitOpAnd", TestCase{[]interface{}{"dst", "key1", "key2"}, `4`, `val0`}},
+		{"BitOpOr", TestCase{[]interface{}{"dst", "key1", "key2"}, `4`, `val3`}},
+		{"BitOpXor", TestCase{[]interface{}{"dst", "key1", "key2"}, `4`, "\x00\x00\x00\x03"}},
+		{"BitOpAnd", TestCase{[]interface{}{"dst", "key1", "404"}, `4`, "\x00\x00\x00\x00"}},
+		{"BitOpNot", TestCase{[]interface{}{"dst", "key1"}, `4`, "\x89\x9e\x93\xce"}},
+		{"BitOpNot", TestCase{[]interface{}{"key1", "404"}, `0`, `ERROR: redis: nil`}},
+		{"BitOpOr", TestCase{[]interface{}{"dst", "key1", "list"}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, `ERROR: redis: nil`}},
+	}
+
+	for _, tester := range testers {
+		for _, tst := range tests {
+			tester.Setup(t)
+			tester.Test(tst.cmd, tester.GetDataVal, []TestCase{tst.TestCase})
+			tester.Teardown()
+		}
+	}
+}
+
+func Test_GetRange(t *testing.T) {
+	tests := []TestCase{
+		{[]interface{}{"key1", int64(0), int64(2)}, `val`, ``},
+		{[]interface{}{"key1", int64(-2), int64(-1)}, `l1`, ``},
+		{[]interface{}{"key1", int64(2), int64(100)}, `l1`, ``},
+		{[]interface{}{"key1", int64(10), int64(100)}, ``, ``},
+		{[]interface{}{"key1", int64(3), int64(1)}, ``, ``},
+		{[]interface{}{"404", int64(0), int64(-1)}, ``, ``},
+		{[]interface{}{"list", int64(0), int64(-1)}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, ``},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.Test("GetRange", nil, tests)
+		tester.Teardown()
+	}
+}
+
+func Test_SetRange(t *testing.T) {
+	tests := []TestCase{
+		{[]interface{}{"key1", int64(1), "AL"}, `4`, `vAL1`},
+		{[]interface{}{"key1", int64(3), "ue1"}, `6`, `value1`},
+		{[]interface{}{"key1", int64(6), "!"}, `7`, "val1\x00\x00!"},
+		{[]interface{}{"key1", int64(0), ""}, `4`, `val1`},
+		{[]interface{}{"404", int64(1), "ab"}, `3`, "\x00ab"},
+		{[]interface{}{"404", int64(1), ""}, `0`, `ERROR: redis: nil`},
+		{[]interface{}{"key1", int64(-1), "ab"}, `ERROR: ERR offset is out of range`, `val1`},
+		{[]interface{}{"list", int64(0), "ab"}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`},
+	}
+
+	for _, tester := range testers {
+		for _, tst := range tests {
+			tester.Setup(t)
+			tester.Test("SetRange", tester.GetDataVal, []TestCase{tst})
+			tester.Teardown()
+		}
+	}
+}
+
+func Test_DumpRestore(t *testing.T) {
+	for _, tester := range testers {
+		tester.Setup(t)
+
+		for _, key := range []string{"key1", "list", "dict"} {
+			dump, err := tester.callCommand("Dump", key)
+			if err != nil {
+				t.Errorf("%s> Dump(%q): got err %v", tester.name, key, err)
+				continue
+			}
+
+			restoreKey := key + "_restored"
+			if _, err := tester.callCommand("Restore", restoreKey, 10*time.Second, dump); err != nil {
+				t.Errorf("%s> Restore(%q): got err %v", tester.name, restoreKey, err)
+			}
+			if _, err := tester.callCommand("Restore", restoreKey, 0*time.Second, dump); err == nil {
+				t.Errorf("%s> Restore(%q) existing key: got no error", tester.name, restoreKey)
+			}
+			if _, err := tester.callCommand("RestoreReplace", restoreKey, 0*time.Second, dump); err != nil {
+				t.Errorf("%s> RestoreReplace(%q): got err %v", tester.name, restoreKey, err)
+			}
+		}
+
+		checks := []TestCase{
+			{[]interface{}{"key1_restored"}, `val1`, ``},
+			{[]interface{}{"list_restored"}, `[ lv0 lv1 lv2 lv3]`, ``},
+			{[]interface{}{"dict_restored"}, `map[: dv000 f1: dv1 f2: dv2 f3: dv3 f__: ]`, ``},
+		}
+		for i, cmd := range []string{"Get", "LRange", "HGetAll"} {
+			args := checks[i].args
+			if cmd == "LRange" {
+				args = append(args, int64(0), int64(-1))
+			}
+			val, err := tester.callCommand(cmd, args...)
+			if got := tester.formatCommandResult(cmd, val, err, args); got != checks[i].want {
+				t.Errorf("%s> %s(%q): %q != %q", tester.name, cmd, args[0], got, checks[i].want)
+			}
+		}
+
+		if _, err := tester.callCommand("Dump", "404"); err == nil {
+			t.Errorf("%s> Dump(%q): got no error", tester.name, "404")
+		}
+		if _, err := tester.callCommand("Restore", "new", 0*time.Second, "garbage"); err == nil {
+			t.Errorf("%s> Restore(%q) with bad payload: got no error", tester.name, "new")
+		}
+
+		tester.Teardown()
+	}
+}
+
+// zAdd adds members with scores to the sorted set using client-specific member type
+func (ct *ClientTester) zAdd(key string, scoreMembers ...interface{}) (count int64, err error) {
+	switch client := ct.client.(type) {
+	case *redis.Client:
+		var members []redis.Z
+		for i := 0; i < len(scoreMembers); i += 2 {
+			members = append(members, redis.Z{Score: scoreMembers[i].(float64), Member: scoreMembers[i+1]})
+		}
+		return client.ZAdd(key, members...).Result()
+	case *radish.Client:
+		var members []radish.Z
+		for i := 0; i < len(scoreMembers); i += 2 {
+			members = append(members, radish.Z{Score: scoreMembers[i].(float64), Member: scoreMembers[i+1].(string)})
+		}
+		intCount, err := client.ZAdd(key, members...).Result()
+		return int64(intCount), err
+	default:
+		panic(fmt.Sprintf("Unknown client %T", ct.client))
+	}
+}
+
+// getDataZRange returns whole sorted set in score order, unlike formatCommandResult, which sorts []string lexicographically
+func (ct *ClientTester) getDataZRange(tst TestCase) (value interface{}, err error) {
+	return ct.callCommand("ZRangeWithScores", tst.args[0], int64(0), int64(-1))
+}
+
+func Test_ZAdd(t *testing.T) {
+	tests := []struct {
+		scoreMembers []interface{}
+		want         string
+		wantData     string
+	}{
+		{[]interface{}{2.0, "b", 1.0, "a"}, `2`, `[{1 a} {2 b}]`},
+		{[]interface{}{3.0, "a", 0.5, "c"}, `1`, `[{0.5 c} {2 b} {3 a}]`},
+		{[]interface{}{2.0, "bb", -1.5, "b"}, `1`, `[{-1.5 b} {0.5 c} {2 bb} {3 a}]`},
+		{[]interface{}{math.Inf(1), "c", math.Inf(-1), "a"}, `0`, `[{-Inf a} {-1.5 b} {2 bb} {+Inf c}]`},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+
+		for _, tst := range tests {
+			count, err := tester.zAdd("zset", tst.scoreMembers...)
+			if got := tester.formatCommandResult("ZAdd", count, err, nil); got != tst.want {
+				t.Errorf("%s> ZAdd(%v) \n got: %s \n want: %s", tester.name, tst.scoreMembers, got, tst.want)
+			}
+
+			data, err := tester.getDataZRange(TestCase{args: []interface{}{"zset"}})
+			if got := tester.formatCommandResult("ZAdd", data, err, nil); got != tst.wantData {
+				t.Errorf("%s> ZAdd(%v) \n data got: %s \n data want: %s", tester.name, tst.scoreMembers, got, tst.wantData)
+			}
+		}
+
+		count, err := tester.zAdd("key1", 1.0, "a")
+		if got, want := tester.formatCommandResult("ZAdd", count, err, nil), `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`; got != want {
+			t.Errorf("%s> ZAdd(key1) \n got: %s \n want: %s", tester.name, got, want)
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_SortedSet(t *testing.T) {
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.zAdd("zset", 3.0, "c", 1.0, "a", 2.0, "b", 2.0, "ab", 4.5, "d")
+
+		tester.Test("ZScore", nil, []TestCase{
+			{[]interface{}{"zset", "d"}, `4.5`, ``},
+			{[]interface{}{"zset", "404"}, `ERROR: redis: nil`, ``},
+			{[]interface{}{"404", "a"}, `ERROR: redis: nil`, ``},
+			{[]interface{}{"key1", "a"}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, ``},
+		})
+		tester.Test("ZCard", nil, []TestCase{
+			{[]interface{}{"zset"}, `5`, ``},
+			{[]interface{}{"404"}, `0`, ``},
+			{[]interface{}{"list"}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, ``},
+		})
+		tester.Test("ZRank", nil, []TestCase{
+			{[]interface{}{"zset", "a"}, `0`, ``},
+			{[]interface{}{"zset", "b"}, `2`, ``},
+			{[]interface{}{"zset", "ab"}, `1`, ``},
+			{[]interface{}{"zset", "404"}, `ERROR: redis: nil`, ``},
+			{[]interface{}{"404", "a"}, `ERROR: redis: nil`, ``},
+		})
+		tester.Test("ZRangeWithScores", nil, []TestCase{
+			{[]interface{}{"zset", int64(0), int64(-1)}, `[{1 a} {2 ab} {2 b} {3 c} {4.5 d}]`, ``},
+			{[]interface{}{"zset", int64(1), int64(2)}, `[{2 ab} {2 b}]`, ``},
+			{[]interface{}{"zset", int64(-2), int64(100)}, `[{3 c} {4.5 d}]`, ``},
+			{[]interface{}{"zset", int64(3), int64(1)}, `[]`, ``},
+			{[]interface{}{"404", int64(0), int64(-1)}, `[]`, ``},
+			{[]interface{}{"dict", int64(0), int64(-1)}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, ``},
+		})
+		tester.Test("ZRange", nil, []TestCase{
+			{[]interface{}{"zset", int64(1), int64(3)}, `[ab b c]`, ``},
+			{[]interface{}{"404", int64(0), int64(-1)}, `[]`, ``},
+		})
+		tester.Test("ZRem", tester.getDataZRange, []TestCase{
+			{[]interface{}{"zset", "a", "404", "c"}, `2`, `[{2 ab} {2 b} {4.5 d}]`},
+			{[]interface{}{"zset", "a"}, `0`, `[{2 ab} {2 b} {4.5 d}]`},
+			{[]interface{}{"key1", "a"}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`},
+		})
+
+		tester.Teardown()
+	}
+}
+
+func Test_ZIncrBy(t *testing.T) {
+	tests := []TestCase{
+		{[]interface{}{"zset", 2.5, "a"}, `3.5`, `[{2 b} {3.5 a}]`},
+		{[]interface{}{"zset", -3.0, "a"}, `0.5`, `[{0.5 a} {2 b}]`},
+		{[]interface{}{"zset", 1.5, "c"}, `1.5`, `[{0.5 a} {1.5 c} {2 b}]`},
+		{[]interface{}{"404", 1.0, "a"}, `1`, `[{1 a}]`},
+		{[]interface{}{"key1", 1.0, "a"}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.zAdd("zset", 1.0, "a", 2.0, "b")
+		tester.Test("ZIncrBy", tester.getDataZRange, tests)
+		tester.Teardown()
+	}
+}
+
+func Test_ZRangeByScore(t *testing.T) {
+	tests := []struct {
+		opt      [4]interface{}
+		want     string
+		wantWith string
+	}{
+		{[4]interface{}{"-inf", "+inf", int64(0), int64(0)}, `[a ab b c d]`, `[{1 a} {2 ab} {2 b} {3 c} {4.5 d}]`},
+		{[4]interface{}{"2", "3", int64(0), int64(0)}, `[ab b c]`, `[{2 ab} {2 b} {3 c}]`},
+		{[4]interface{}{"(2", "3", int64(0), int64(0)}, `[c]`, `[{3 c}]`},
+		{[4]interface{}{"1", "(2", int64(0), int64(0)}, `[a]`, `[{1 a}]`},
+		{[4]interface{}{"(1", "(2", int64(0), int64(0)}, `[]`, `[]`},
+		{[4]interface{}{"2.5", "+inf", int64(0), int64(0)}, `[c d]`, `[{3 c} {4.5 d}]`},
+		{[4]interface{}{"-inf", "+inf", int64(1), int64(2)}, `[ab b]`, `[{2 ab} {2 b}]`},
+		{[4]interface{}{"-inf", "+inf", int64(3), int64(-1)}, `[c d]`, `[{3 c} {4.5 d}]`},
+		{[4]interface{}{"abc", "+inf", int64(0), int64(0)}, `ERROR: ERR min or max is not a float`, `ERROR: ERR min or max is not a float`},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.zAdd("zset", 3.0, "c", 1.0, "a", 2.0, "b", 2.0, "ab", 4.5, "d")
+
+		for _, tst := range tests {
+			var (
+				val, valWith interface{}
+				err, errWith error
+			)
+			switch client := tester.client.(type) {
+			case *redis.Client:
+				opt := redis.ZRangeBy{Min: tst.opt[0].(string), Max: tst.opt[1].(string), Offset: tst.opt[2].(int64), Count: tst.opt[3].(int64)}
+				val, err = client.ZRangeByScore("zset", opt).Result()
+				valWith, errWith = client.ZRangeByScoreWithScores("zset", opt).Result()
+			case *radish.Client:
+				opt := radish.ZRangeBy{Min: tst.opt[0].(string), Max: tst.opt[1].(string), Offset: tst.opt[2].(int64), Count: tst.opt[3].(int64)}
+				val, err = client.ZRangeByScore("zset", opt).Result()
+				valWith, errWith = client.ZRangeByScoreWithScores("zset", opt).Result()
+			}
+
+			if got := tester.formatCommandResult("ZRangeByScore", val, err, nil); got != tst.want {
+				t.Errorf("%s> ZRangeByScore(%v) \n got: %s \n want: %s", tester.name, tst.opt, got, tst.want)
+			}
+			if got := tester.formatCommandResult("ZRangeByScoreWithScores", valWith, errWith, nil); got != tst.wantWith {
+				t.Errorf("%s> ZRangeByScoreWithScores(%v) \n got: %s \n want: %s", tester.name, tst.opt, got, tst.wantWith)
+			}
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_Sort(t *testing.T) {
+	tests := []struct {
+		key   string
+		sort  [4]interface{}
+		want  string
+		store string
+	}{
+		{"nums", [4]interface{}{int64(0), int64(0), "", false}, `[-1.5 02 2 10]`, `[-1.5 02 2 10]`},
+		{"nums", [4]interface{}{int64(1), int64(2), "DESC", false}, `[2 02]`, `[2 02]`},
+		{"nums", [4]interface{}{int64(0), int64(0), "", true}, `[-1.5 02 10 2]`, `[-1.5 02 10 2]`},
+		{"list", [4]interface{}{int64(0), int64(0), "", false}, `ERROR: ERR One or more scores can't be converted into double`, `[]`},
+		{"list", [4]interface{}{int64(0), int64(0), "DESC", true}, `[lv3 lv2 lv1 lv0 ]`, `[lv3 lv2 lv1 lv0 ]`},
+		{"404", [4]interface{}{int64(0), int64(0), "", false}, `[]`, `[]`},
+		{"key1", [4]interface{}{int64(0), int64(0), "", false}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, `[]`},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.callCommand("LPush", "nums", "10", "2", "-1.5", "02")
+
+		for _, tst := range tests {
+			var (
+				val   interface{}
+				err   error
+				count int64
+			)
+			switch client := tester.client.(type) {
+			case *redis.Client:
+				opt := &redis.Sort{Offset: tst.sort[0].(int64), Count: tst.sort[1].(int64), Order: tst.sort[2].(string), Alpha: tst.sort[3].(bool)}
+				val, err = client.Sort(tst.key, opt).Result()
+				if err == nil {
+					count, err = client.SortStore(tst.key, "dst", opt).Result()
+				}
+			case *radish.Client:
+				opt := &radish.Sort{Offset: tst.sort[0].(int64), Count: tst.sort[1].(int64), Order: tst.sort[2].(string), Alpha: tst.sort[3].(bool)}
+				val, err = client.Sort(tst.key, opt).Result()
+				if err == nil {
+					var intCount int
+					intCount, err = client.SortStore(tst.key, "dst", opt).Result()
+					count = int64(intCount)
+				}
+			}
+
+			// order matters, so result isn't formatted by formatCommandResult()
+			got := fmt.Sprintf("%v", val)
+			if err != nil {
+				got = fmt.Sprintf("ERROR: %s", err)
+			}
+			if got != tst.want {
+				t.Errorf("%s> Sort(%q, %v) \n got: %s \n want: %s", tester.name, tst.key, tst.sort, got, tst.want)
+			}
+			if err != nil {
+				continue
+			}
+
+			stored, _ := tester.callCommand("LRange", "dst", int64(0), int64(-1))
+			if got := fmt.Sprintf("%v", stored); got != tst.store || count != int64(len(stored.([]string))) {
+				t.Errorf("%s> SortStore(%q, %v) \n got: %d, %s \n want: %s", tester.name, tst.key, tst.sort, count, got, tst.store)
+			}
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_HRandField(t *testing.T) {
+	dict := map[string]string{"f1": "dv1", "f2": "dv2", "f3": "dv3", "f__": "", "": "dv000"}
+
+	tests := []struct {
+		key        string
+		count      int
+		withValues bool
+		wantLen    int
+		wantUnique bool
+		wantErr    string
+	}{
+		{"dict", 3, false, 3, true, ``},
+		{"dict", 10, true, 10, true, ``},
+		{"dict", -8, false, 8, false, ``},
+		{"dict", -2, true, 4, false, ``},
+		{"404", 3, false, 0, true, ``},
+		{"key1", 3, false, 0, true, `WRONGTYPE Operation against a key holding the wrong kind of value`},
+		{"dict", math.MinInt64, true, 0, true, `ERR value is out of range`},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+
+		for _, tst := range tests {
+			var (
+				fields []string
+				err    error
+			)
+			switch client := tester.client.(type) {
+			case *redis.Client:
+				args := []interface{}{"HRANDFIELD", tst.key, tst.count}
+				if tst.withValues {
+					args = append(args, "WITHVALUES")
+				}
+				cmd := redis.NewStringSliceCmd(args...)
+				client.Process(cmd)
+				fields, err = cmd.Result()
+			case *radish.Client:
+				fields, err = client.HRandField(tst.key, tst.count, tst.withValues).Result()
+			}
+
+			if tst.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tst.wantErr) {
+					t.Errorf("%s> HRandField(%q, %d): got err %v, want %q", tester.name, tst.key, tst.count, err, tst.wantErr)
+				}
+				continue
+			}
+			if err != nil || len(fields) != tst.wantLen {
+				t.Errorf("%s> HRandField(%q, %d, %t): got %q, %v, want %d elements", tester.name, tst.key, tst.count, tst.withValues, fields, err, tst.wantLen)
+				continue
+			}
+
+			step := 1
+			if tst.withValues {
+				step = 2
+			}
+			seen := map[string]bool{}
+			for i := 0; i < len(fields); i += step {
+				value, ok := dict[fields[i]]
+				if !ok || tst.withValues && fields[i+1] != value || tst.wantUnique && seen[fields[i]] {
+					t.Errorf("%s> HRandField(%q, %d, %t): unexpected result %q", tester.name, tst.key, tst.count, tst.withValues, fields)
+					break
+				}
+				seen[fields[i]] = true
+			}
+		}
+
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			tester.Teardown()
+			continue
+		}
+
+		// without count, a single field returned
+		cmd := redis.NewStringCmd("HRANDFIELD", "dict")
+		client.Process(cmd)
+		if field, err := cmd.Result(); err != nil {
+			t.Errorf("%s> HRandField(dict): got err %v", tester.name, err)
+		} else if _, ok := dict[field]; !ok {
+			t.Errorf("%s> HRandField(dict): unknown field %q", tester.name, field)
+		}
+
+		cmd = redis.NewStringCmd("HRANDFIELD", "404")
+		client.Process(cmd)
+		if err := cmd.Err(); err != redis.Nil {
+			t.Errorf("%s> HRandField(404): got err %v, want %v", tester.name, err, redis.Nil)
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_IncrByFloat(t *testing.T) {
+	tests := []TestCase{
+		{[]interface{}{"float", 0.1}, `10.6`, `10.6`},
+		{[]interface{}{"float", -5.0}, `5.6`, `5.6`},
+		{[]interface{}{"float", 5e3}, `5005.6`, `5005.6`},
+		{[]interface{}{"404", 3.5}, `3.5`, `3.5`},
+		{[]interface{}{"key1", 1.0}, `ERROR: ERR value is not a valid float`, `val1`},
+		{[]interface{}{"list", 1.0}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`},
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.callCommand("Set", "float", "10.5", 0*time.Second)
+		tester.Test("IncrByFloat", tester.GetDataVal, tests)
+		tester.Teardown()
+	}
+}
+
+func Test_HIncrByFloat(t *testing.T) {
+	tests := []TestCase{
+		{[]interface{}{"dict", "float", 1.25}, `1.25`, `1.25`},
+		{[]interface{}{"dict", "float", -0.5}, `0.75`, `0.75`},
+		{[]interface{}{"404", "f", 2.0}, `2`, `2`},
+		{[]interface{}{"dict", "f1", 1.0}, `ERROR: ERR hash value is not a float`, `dv1`},
+		{[]interface{}{"key1", "f", 1.0}, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`, `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`},
+	}
+
+	getData := func(tester *ClientTester) func(TestCase) (interface{}, error) {
+		return func(tst TestCase) (interface{}, error) {
+			return tester.callCommand("HGet", tst.args[0], tst.args[1])
+		}
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.Test("HIncrByFloat", getData(tester), tests)
+		tester.Teardown()
+	}
+}
+
+func Test_Command(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			continue
+		}
+
+		commands, err := client.Command().Result()
+		if err != nil {
+			t.Fatalf("%s> Command(): got err %v", tester.name, err)
+		}
+
+		get, ok := commands["get"]
+		if !ok {
+			t.Fatalf("%s> Command(): get not found in %d commands", tester.name, len(commands))
+		}
+		if get.Arity != 2 || get.FirstKeyPos != 1 || get.LastKeyPos != 1 || get.StepCount != 1 || !get.ReadOnly {
+			t.Errorf("%s> Command(): got %+v", tester.name, get)
+		}
+		if del := commands["del"]; del == nil || del.Arity != -2 || del.LastKeyPos != -1 || del.ReadOnly {
+			t.Errorf("%s> Command(): got %+v", tester.name, del)
+		}
+
+		if tester.name == "Redis" {
+			continue
+		}
+		count := redis.NewIntCmd("COMMAND", "COUNT")
+		client.Process(count)
+		if count.Val() != int64(len(commands)) || count.Err() != nil {
+			t.Errorf("%s> COMMAND COUNT: got %d, %v, want %d", tester.name, count.Val(), count.Err(), len(commands))
+		}
+	}
+}
+
+func Test_Client(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			continue
+		}
+
+		// client name is a connection property, so every client must use a single connection
+		newClient := func() *redis.Client {
+			return redis.NewClient(&redis.Options{Addr: client.Options().Addr, PoolSize: 1})
+		}
+		named, killer := newClient(), newClient()
+		defer named.Close()
+		defer killer.Close()
+
+		setName := redis.NewStatusCmd("CLIENT", "SETNAME", "named-client")
+		named.Process(setName)
+		if setName.Err() != nil {
+			t.Fatalf("%s> CLIENT SETNAME: got err %v", tester.name, setName.Err())
+		}
+		if name, err := named.ClientGetName().Result(); name != "named-client" || err != nil {
+			t.Errorf("%s> ClientGetName(): got %q, %v, want %q", tester.name, name, err, "named-client")
+		}
+		if name, err := killer.ClientGetName().Result(); err != redis.Nil {
+			t.Errorf("%s> ClientGetName(): got %q, %v, want %v", tester.name, name, err, redis.Nil)
+		}
+
+		list, err := killer.ClientList().Result()
+		if err != nil {
+			t.Fatalf("%s> ClientList(): got err %v", tester.name, err)
+		}
+		addr := ""
+		for _, line := range strings.Split(list, "\n") {
+			if !strings.Contains(line, " name=named-client ") {
+				continue
+			}
+			for _, field := range strings.Fields(line) {
+				if strings.HasPrefix(field, "addr=") {
+					addr = strings.TrimPrefix(field, "addr=")
+				}
+			}
+		}
+		if addr == "" {
+			t.Fatalf("%s> ClientList(): named client not found in %q", tester.name, list)
+		}
+
+		if err := killer.ClientKill(addr).Err(); err != nil {
+			t.Errorf("%s> ClientKill(%q): got err %v", tester.name, addr, err)
+		}
+		if err := named.Ping().Err(); err == nil {
+			t.Errorf("%s> Ping() after ClientKill(): got no error", tester.name)
+		}
+		if err := killer.ClientKill(addr).Err(); err == nil {
+			t.Errorf("%s> second ClientKill(%q): got no error", tester.name, addr)
+		}
+	}
+}
+
+func Test_HandshakeProbes(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			continue
+		}
+
+		// library info is a connection property, so the client must use a single connection
+		conn := redis.NewClient(&redis.Options{Addr: client.Options().Addr, PoolSize: 1})
+		defer conn.Close()
+
+		// CLIENT SETINFO appeared in Redis 7.2
+		if tester.name != "Redis" {
+			for _, args := range [][]interface{}{
+				{"CLIENT", "SETINFO", "LIB-NAME", "go-redis"},
+				{"CLIENT", "SETINFO", "lib-ver", "9.0.5"},
+			} {
+				cmd := redis.NewStatusCmd(args...)
+				conn.Process(cmd)
+				if got, err := cmd.Result(); got != "OK" || err != nil {
+					t.Errorf("%s> %v: got %q, %v, want OK", tester.name, args, got, err)
+				}
+			}
+
+			cmd := redis.NewStatusCmd("CLIENT", "SETINFO", "lib-os", "linux")
+			conn.Process(cmd)
+			if err := cmd.Err(); err == nil || err.Error() != "ERR Unrecognized option 'lib-os'" {
+				t.Errorf("%s> CLIENT SETINFO lib-os: got %v, want error", tester.name, err)
+			}
+
+			info := redis.NewStringCmd("CLIENT", "INFO")
+			conn.Process(info)
+			if got := info.Val(); !strings.Contains(got, " lib-name=go-redis lib-ver=9.0.5") || strings.Count(got, "\n") != 1 {
+				t.Errorf("%s> CLIENT INFO: got %q, want a single line with library info", tester.name, got)
+			}
+		}
+
+		id := redis.NewIntCmd("CLIENT", "ID")
+		conn.Process(id)
+		if id.Err() != nil || id.Val() <= 0 {
+			t.Errorf("%s> CLIENT ID: got %d, %v, want positive id", tester.name, id.Val(), id.Err())
+		}
+		info := redis.NewStringCmd("CLIENT", "INFO")
+		conn.Process(info)
+		if want := fmt.Sprintf("id=%d ", id.Val()); !strings.HasPrefix(info.Val(), want) {
+			t.Errorf("%s> CLIENT INFO: got %q, want prefix %q", tester.name, info.Val(), want)
+		}
+
+		for _, param := range []string{"save", "appendonly"} {
+			if got, err := conn.ConfigGet(param).Result(); len(got) != 2 || got[0] != param || err != nil {
+				t.Errorf("%s> CONFIG GET %s: got %v, %v, want name and value", tester.name, param, got, err)
+			}
+		}
+
+		docs := redis.NewSliceCmd("COMMAND", "DOCS", "get")
+		conn.Process(docs)
+		if got, err := docs.Result(); len(got) != 2 || got[0] != "get" || err != nil {
+			t.Errorf("%s> COMMAND DOCS get: got %v, %v, want name and docs", tester.name, got, err)
+		}
+	}
+}
+
+func Test_InfoStats(t *testing.T) {
+	infoField := func(info, name string) int {
+		for _, line := range strings.Split(info, "\r\n") {
+			if strings.HasPrefix(line, name+":") {
+				value, _ := strconv.Atoi(strings.TrimPrefix(line, name+":"))
+				return value
+			}
+		}
+		return -1
+	}
+
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			continue
+		}
+
+		before := client.Info("stats").Val()
+		other := redis.NewClient(&redis.Options{Addr: client.Options().Addr, PoolSize: 1})
+		other.Get("key1")
+
+		if got := infoField(client.Info("clients").Val(), "connected_clients"); got < 2 {
+			t.Errorf("%s> Info(clients): got connected_clients %d, want at least 2", tester.name, got)
+		}
+		after := client.Info("stats").Val()
+		if got, was := infoField(after, "total_connections_received"), infoField(before, "total_connections_received"); got <= was {
+			t.Errorf("%s> Info(stats): got total_connections_received %d, want more than %d", tester.name, got, was)
+		}
+		if got, was := infoField(after, "total_commands_processed"), infoField(before, "total_commands_processed"); got <= was {
+			t.Errorf("%s> Info(stats): got total_commands_processed %d, want more than %d", tester.name, got, was)
+		}
+		if got := client.Info("commandstats").Val(); !strings.Contains(got, "cmdstat_get:calls=") {
+			t.Errorf("%s> Info(commandstats): got %q, want cmdstat_get", tester.name, got)
+		}
+
+		other.Close()
+	}
+}
+
+func Test_MaxClients(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			continue
+		}
+
+		maxClients := client.ConfigGet("maxclients").Val()
+		if len(maxClients) != 2 {
+			t.Fatalf("%s> ConfigGet(): got %v", tester.name, maxClients)
+		}
+		info := client.Info("clients").Val()
+		if !strings.Contains(info, "maxclients:"+maxClients[1].(string)) {
+			t.Errorf("%s> Info(clients): got %q, want maxclients:%s", tester.name, info, maxClients[1])
+		}
+
+		// the shared client holds at least one connection, so any new one is over the limit
+		if err := client.ConfigSet("maxclients", "1").Err(); err != nil {
+			t.Fatalf("%s> ConfigSet(): got err %v", tester.name, err)
+		}
+		other := redis.NewClient(&redis.Options{Addr: client.Options().Addr, PoolSize: 1})
+		if err := other.Ping().Err(); err == nil || err.Error() != "ERR max number of clients reached" {
+			t.Errorf("%s> Ping() over the limit: got err %v, want max number of clients reached", tester.name, err)
+		}
+		other.Close()
+
+		// already connected clients aren't closed
+		if err := client.ConfigSet("maxclients", maxClients[1].(string)).Err(); err != nil {
+			t.Fatalf("%s> ConfigSet(): got err %v", tester.name, err)
+		}
+	}
+}
+
+func Test_MaxRequestSize(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok || tester.name == "Redis" {
+			// max-request-size is Radish-specific
+			continue
+		}
+
+		size := client.ConfigGet("max-request-size").Val()
+		if err := client.ConfigSet("max-request-size", "40").Err(); err != nil {
+			t.Fatalf("%s> ConfigSet(): got err %v", tester.name, err)
+		}
+
+		other := redis.NewClient(&redis.Options{Addr: client.Options().Addr, PoolSize: 1})
+		if err := other.Set("key", strings.Repeat("v", 40), 0).Err(); err == nil || !strings.Contains(err.Error(), "max-request-size") {
+			t.Errorf("%s> Set() of oversized request: got err %v, want max-request-size error", tester.name, err)
+		}
+		// connection is closed after oversized request, the pool reconnects on the next one
+		if err := other.Ping().Err(); err == nil {
+			t.Errorf("%s> Ping() after oversized request: got no error, want closed connection", tester.name)
+		}
+		if err := other.Set("key", "value", 0).Err(); err != nil {
+			t.Errorf("%s> Set() after reconnect: got err %v", tester.name, err)
+		}
+		other.Close()
+
+		if len(size) != 2 {
+			t.Fatalf("%s> ConfigGet(): got %v", tester.name, size)
+		}
+		if err := client.ConfigSet("max-request-size", size[1].(string)).Err(); err != nil {
+			t.Fatalf("%s> ConfigSet(): got err %v", tester.name, err)
+		}
+	}
+}
+
+func Test_ClientRateLimit(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok || tester.name == "Redis" {
+			// client-rate-limit is Radish-specific
+			continue
+		}
+
+		if err := client.ConfigSet("client-rate-limit", "5").Err(); err != nil {
+			t.Fatalf("%s> ConfigSet(): got err %v", tester.name, err)
+		}
+
+		limited := redis.NewClient(&redis.Options{Addr: client.Options().Addr, PoolSize: 1})
+		var rejected int
+		for i := 0; i < 10; i++ {
+			if err := limited.Ping().Err(); err != nil {
+				if err.Error() != "ERR rate limit exceeded" {
+					t.Errorf("%s> Ping(): got err %v, want rate limit exceeded", tester.name, err)
+				}
+				rejected++
+			}
+		}
+		// the bucket holds 5 commands, and it's refilled by 1 command per 200ms
+		if rejected < 4 || rejected > 5 {
+			t.Errorf("%s> Ping() burst of 10: got %d rejected, want 5", tester.name, rejected)
+		}
+		limited.Close()
+
+		// the limit is per connection, so the admin connection isn't limited by commands of another one
+		if err := client.ConfigSet("client-rate-limit", "0").Err(); err != nil {
+			t.Fatalf("%s> ConfigSet(): got err %v", tester.name, err)
+		}
+		if got := client.ConfigGet("client-rate-limit").Val(); len(got) != 2 || got[1] != "0" {
+			t.Errorf("%s> ConfigGet(): got %v, want 0", tester.name, got)
+		}
+	}
+}
+
+func Test_ClientTimeout(t *testing.T) {
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok {
+			continue
+		}
+
+		// admin connection is closed by timeout too, so it reconnects by retry
+		admin := redis.NewClient(&redis.Options{Addr: client.Options().Addr, PoolSize: 1, MaxRetries: 1})
+		defer admin.Close()
+		idle := redis.NewClient(&redis.Options{Addr: client.Options().Addr, PoolSize: 1})
+		defer idle.Close()
+
+		if err := admin.ConfigSet("timeout", "1").Err(); err != nil {
+			t.Fatalf("%s> ConfigSet(): got err %v", tester.name, err)
+		}
+		if err := idle.Ping().Err(); err != nil {
+			t.Fatalf("%s> Ping(): got err %v", tester.name, err)
+		}
+		sub := admin.Subscribe("timeout-channel")
+		if _, err := sub.ReceiveTimeout(time.Second); err != nil {
+			t.Fatalf("%s> Subscribe(): got err %v", tester.name, err)
+		}
+
+		time.Sleep(3 * time.Second)
+
+		if err := idle.Ping().Err(); err == nil {
+			t.Errorf("%s> Ping() after timeout: got no error, want closed connection", tester.name)
+		}
+		// subscribers aren't closed by timeout
+		if count, err := admin.Publish("timeout-channel", "message").Result(); count != 1 || err != nil {
+			t.Errorf("%s> Publish() after timeout: got %d, %v, want 1", tester.name, count, err)
+		}
+		sub.Close()
+
+		if err := admin.ConfigSet("timeout", "0").Err(); err != nil {
+			t.Fatalf("%s> ConfigSet(): got err %v", tester.name, err)
+		}
+
+		// pooled connections of the shared client are closed too: every failed Ping removes one of them from the pool
+		for i := uint32(0); i <= client.PoolStats().TotalConns; i++ {
+			if client.Ping().Err() == nil {
+				break
+			}
+		}
+	}
+}
+
+func Test_InvalidCommandName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr string
+	}{
+		{"GET\x00", "ERR command name contains control characters"},
+		{"GET\r\nDEL", "ERR command name contains control characters"},
+		{"", "ERR empty command name"},
+	}
+
+	for _, tester := range testers {
+		client, ok := tester.client.(*redis.Client)
+		if !ok || tester.name == "Redis" {
+			// Redis replies unknown command
+			continue
+		}
+
+		for _, tst := range tests {
+			cmd := redis.NewStringCmd(tst.name, "key")
+			client.Process(cmd)
+			if err := cmd.Err(); err == nil || err.Error() != tst.wantErr {
+				t.Errorf("%s> %q: got err %v, want %q", tester.name, tst.name, err, tst.wantErr)
+			}
+		}
+
+		// the connection must stay usable
+		if err := client.Ping().Err(); err != nil {
+			t.Errorf("%s> Ping(): got err %v", tester.name, err)
+		}
+	}
+}
+
+func Test_CAS(t *testing.T) {
+	for _, tester := range testers {
+		if tester.name == "Redis" {
+			// CAS is Radish-specific
+			continue
+		}
+
+		tester.Setup(t)
+
+		cas := func(key, expected, value string, create bool) (bool, error) {
+			switch client := tester.client.(type) {
+			case *radish.Client:
+				return client.CAS(key, expected, value, create).Result()
+			case *redis.Client:
+				args := []interface{}{"CAS", key, expected, value}
+				if create {
+					args = append(args, "CREATE")
+				}
+				cmd := redis.NewIntCmd(args...)
+				client.Process(cmd)
+				return cmd.Val() == 1, cmd.Err()
+			}
+			return false, nil
+		}
+
+		tests := []struct {
+			key, expected string
+			create        bool
+			want          bool
+			wantValue     string
+		}{
+			{"key1", "val1", false, true, "new"},
+			{"key1", "val1", false, false, "new"},
+			{"404", "", false, false, ""},
+			{"404", "", true, true, "new"},
+		}
+		for _, tst := range tests {
+			got, err := cas(tst.key, tst.expected, "new", tst.create)
+			if got != tst.want || err != nil {
+				t.Errorf("%s> CAS(%q, %q, %t): got %t, %v, want %t", tester.name, tst.key, tst.expected, tst.create, got, err, tst.want)
+			}
+			if value, _ := tester.callCommand("Get", tst.key); tst.wantValue != "" && value != tst.wantValue {
+				t.Errorf("%s> CAS(%q, %q, %t): got value %v, want %q", tester.name, tst.key, tst.expected, tst.create, value, tst.wantValue)
+			}
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_DelPattern(t *testing.T) {
+	for _, tester := range testers {
+		if tester.name == "Redis" {
+			// DELPATTERN is Radish-specific
+			continue
+		}
+
+		tester.Setup(t)
+
+		delPattern := func(pattern string) (int64, error) {
+			switch client := tester.client.(type) {
+			case *radish.Client:
+				result := client.DelPattern(pattern)
+				return result.Int64(), result.Err()
+			case *redis.Client:
+				cmd := redis.NewIntCmd("DELPATTERN", pattern)
+				client.Process(cmd)
+				return cmd.Result()
+			}
+			return 0, nil
+		}
+
+		tests := []struct {
+			pattern  string
+			want     int64
+			wantKeys string
+		}{
+			{"key[12]", 2, `[ dict key3 list]`},
+			{"key*", 1, `[ dict list]`},
+			{"404*", 0, `[ dict list]`},
+		}
+		for _, tst := range tests {
+			got, err := delPattern(tst.pattern)
+			if got != tst.want || err != nil {
+				t.Errorf("%s> DelPattern(%q): got %d, %v, want %d", tester.name, tst.pattern, got, err, tst.want)
+			}
+			val, err := tester.callCommand("Keys", "*")
+			if keys := tester.formatCommandResult("Keys", val, err, nil); keys != tst.wantKeys {
+				t.Errorf("%s> Keys after DelPattern(%q): got %s, want %s", tester.name, tst.pattern, keys, tst.wantKeys)
+			}
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_Explain(t *testing.T) {
+	for _, tester := range testers {
+		if tester.name == "Redis" {
+			// EXPLAIN is Radish-specific
+			continue
+		}
+
+		tester.Setup(t)
+
+		explain := func(args ...string) (string, error) {
+			switch client := tester.client.(type) {
+			case *radish.Client:
+				result := client.Explain(args[0], args[1:]...)
+				return result.Val(), result.Err()
+			case *redis.Client:
+				cmdArgs := []interface{}{"EXPLAIN"}
+				for _, arg := range args {
+					cmdArgs = append(cmdArgs, arg)
+				}
+				cmd := redis.NewStringCmd(cmdArgs...)
+				client.Process(cmd)
+				return cmd.Result()
+			}
+			return "", nil
+		}
+
+		tests := []struct {
+			args []string
+			want []string
+		}{
+			{[]string{"LPOP", "list"}, []string{"command:lpop\r\n", "modifying:yes\r\n", "keys:list\r\n", "complexity:O(1)\r\n"}},
+			{[]string{"HGET", "dict", "f1"}, []string{"modifying:no\r\n", "keys:dict\r\n", "dangerous:no\r\n"}},
+			{[]string{"KEYS", "*"}, []string{"modifying:no\r\n", "dangerous:yes\r\n"}},
+		}
+		for _, tst := range tests {
+			got, err := explain(tst.args...)
+			for _, want := range tst.want {
+				if !strings.Contains(got, want) || err != nil {
+					t.Errorf("%s> Explain(%q): got %q, %v, want %q", tester.name, tst.args, got, err, want)
+				}
+			}
+		}
+
+		// the explained command isn't executed
+		val, err := tester.callCommand("LLen", "list")
+		if got := tester.formatCommandResult("LLen", val, err, nil); got != `5` {
+			t.Errorf("%s> LLen after Explain(LPOP): got %s, want 5", tester.name, got)
+		}
+
+		if _, err := explain("GET"); err == nil || !strings.Contains(err.Error(), "wrong number of arguments for 'get' command") {
+			t.Errorf("%s> Explain(GET): got err %v, want wrong number of arguments", tester.name, err)
+		}
+		if _, err := explain("NOSUCHCMD"); err == nil {
+			t.Errorf("%s> Explain(NOSUCHCMD): got nil err", tester.name)
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_MemoryPurge(t *testing.T) {
+	for _, tester := range testers {
+		if tester.name == "Redis" {
+			// Redis replies OK to MEMORY PURGE
+			continue
+		}
+
+		tester.Setup(t)
+
+		var released int64
+		var err error
+		switch client := tester.client.(type) {
+		case *radish.Client:
+			result := client.MemoryPurge()
+			released, err = result.Int64(), result.Err()
+		case *redis.Client:
+			cmd := redis.NewIntCmd("MEMORY", "PURGE")
+			client.Process(cmd)
+			released, err = cmd.Result()
+		}
+		if released < 0 || err != nil {
+			t.Errorf("%s> MemoryPurge(): got %d, %v, want count of released bytes", tester.name, released, err)
+		}
+
+		val, err := tester.callCommand("Get", "key1")
+		if got := tester.formatCommandResult("Get", val, err, nil); got != `val1` {
+			t.Errorf("%s> Get(key1) after MemoryPurge(): got %s, want val1", tester.name, got)
+		}
+
+		tester.Teardown()
+	}
+}
+
+func Test_BulkSet(t *testing.T) {
+	values := map[string]string{"key1": "new", "list": "was list", "": "empty key", "bin\x00key": "bin\r\nvalue\x00"}
+	for i := 0; i < 2500; i++ {
+		values[fmt.Sprintf("bulk_%d", i)] = fmt.Sprintf("value_%d", i)
+	}
+
+	for _, tester := range testers {
+		client, ok := tester.client.(*radish.Client)
+		if !ok {
+			// BulkSet is a radish-client helper
+			continue
+		}
+		tester.Setup(t)
+
+		if count, err := client.BulkSet(values).Result(); count != len(values) || err != nil {
+			t.Errorf("%s> BulkSet(): got %d, %v, want %d", tester.name, count, err, len(values))
+		}
+		for key, want := range values {
+			if got, err := client.Get(key).Result(); got != want || err != nil {
+				t.Errorf("%s> Get(%q) after BulkSet(): got %q, %v, want %q", tester.name, key, got, err, want)
+			}
+		}
+		if count, err := client.BulkSet(nil).Result(); count != 0 || err != nil {
+			t.Errorf("%s> BulkSet(nil): got %d, %v, want 0", tester.name, count, err)
+		}
+
+		tester.Teardown()
+	}
+}
+
+// Test_WrongType ensures, that every read command reports WRONGTYPE for keys of all other types the same way over both transports
+func Test_WrongType(t *testing.T) {
+	const wrongType = `ERROR: WRONGTYPE Operation against a key holding the wrong kind of value`
+
+	tests := []struct {
+		cmd      string
+		keyType  string
+		restArgs []interface{}
+	}{
+		{"Get", "string", nil},
+		{"GetRange", "string", []interface{}{int64(0), int64(-1)}},
+		{"GetBit", "string", []interface{}{int64(1)}},
+		{"LLen", "list", nil},
+		{"LIndex", "list", []interface{}{int64(0)}},
+		{"LRange", "list", []interface{}{int64(0), int64(-1)}},
+		{"HGet", "dict", []interface{}{"f1"}},
+		{"HKeys", "dict", nil},
+		{"HGetAll", "dict", nil},
+		{"ZScore", "zset", []interface{}{"a"}},
+		{"ZCard", "zset", nil},
+		{"ZRank", "zset", []interface{}{"a"}},
+		{"ZRange", "zset", []interface{}{int64(0), int64(-1)}},
+		{"ZRangeWithScores", "zset", []interface{}{int64(0), int64(-1)}},
+	}
+	keys := map[string]string{"string": "key1", "list": "list", "dict": "dict", "zset": "zset"}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+		tester.zAdd("zset", 1.0, "a")
+
+		for _, tst := range tests {
+			for keyType, key := range keys {
+				if keyType == tst.keyType {
+					continue
+				}
+
+				args := append([]interface{}{key}, tst.restArgs...)
+				val, err := tester.callCommand(tst.cmd, args...)
+				if got := tester.formatCommandResult(tst.cmd, val, err, args); got != wrongType {
+					t.Errorf("%s> %s(%v) \n got: %s \n want: %s", tester.name, tst.cmd, args, got, wrongType)
+				}
+				// HTTP client must return the exported error to let callers compare it
+				if _, ok := tester.client.(*radish.Client); ok && err != radish.ErrTypeMismatch {
+					t.Errorf("%s> %s(%v) \n got error: %#v \n want: radish.ErrTypeMismatch", tester.name, tst.cmd, args, err)
+				}
+			}
+		}
+
+		tester.Teardown()
+	}
+}
+
+// Test_BinaryKeys ensures, that keys, fields and values with URL delimiters, escapes and control characters
+// survive a round trip over both transports
+func Test_BinaryKeys(t *testing.T) {
+	keys := []string{
+		"a/b", "/", "//", "/a/", "%2F", "%", "%%", "%zz", "\x00", "a\x00b", "\n", "\r\n", ".", "..", "../..",
+		"?x=1", "#fragment", "a b", "+", ";", "\\", "\xff\xfe", "ключ", "health",
+	}
+
+	for _, tester := range testers {
+		tester.Setup(t)
+
+		for _, key := range keys {
+			if _, err := tester.callCommand("Set", key, key, 0*time.Second); err != nil {
+				t.Errorf("%s> Set(%q): %s", tester.name, key, err)
+			}
+			if val, err := tester.callCommand("Get", key); val != key || err != nil {
+				t.Errorf("%s> Get(%q): got %q, %v", tester.name, key, val, err)
+			}
+
+			if _, err := tester.callCommand("HSet", "binary_dict", key, key); err != nil {
+				t.Errorf("%s> HSet(binary_dict, %q): %s", tester.name, key, err)
+			}
+			if val, err := tester.callCommand("HGet", "binary_dict", key); val != key || err != nil {
+				t.Errorf("%s> HGet(binary_dict, %q): got %q, %v", tester.name, key, val, err)
+			}
+		}
+
+		val, err := tester.callCommand("Keys", "*")
+		found := map[string]bool{}
+		for _, key := range val.([]string) {
+			found[key] = true
+		}
+		for _, key := range keys {
+			if !found[key] {
+				t.Errorf("%s> Keys(*): %q not found, err %v", tester.name, key, err)
+			}
+		}
+
+		val, err = tester.callCommand("Del", "a/b", "\x00", "..")
+		if got := tester.formatCommandResult("Del", val, err, nil); got != `3` {
+			t.Errorf("%s> Del(a/b, \\x00, ..): got %s, want 3", tester.name, got)
+		}
+
+		tester.Teardown()
+	}
+}
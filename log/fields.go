@@ -0,0 +1,132 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/op/go-logging"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Fields are contextual key-value pairs of a log entry, like command name or client address.
+// FormatJSON writes them as separate JSON keys, other formats append them to the message as ` key=value`
+type Fields map[string]interface{}
+
+// Entry is a log entry with attached Fields
+type Entry struct {
+	fields fieldsArg
+}
+
+// WithFields returns Entry, that logs messages with fields attached
+func WithFields(fields Fields) *Entry {
+	return &Entry{fields: fieldsArg(fields)}
+}
+
+// Criticalf logs a message with fields using CRITICAL as log level.
+func (e *Entry) Criticalf(format string, args ...interface{}) {
+	logger.Critical(format+"%v", append(args, e.fields)...)
+}
+
+// Errorf logs a message with fields using ERROR as log level.
+func (e *Entry) Errorf(format string, args ...interface{}) {
+	logger.Errorf(format+"%v", append(args, e.fields)...)
+}
+
+// Warningf logs a message with fields using WARNING as log level.
+func (e *Entry) Warningf(format string, args ...interface{}) {
+	logger.Warningf(format+"%v", append(args, e.fields)...)
+}
+
+// Noticef logs a message with fields using NOTICE as log level.
+func (e *Entry) Noticef(format string, args ...interface{}) {
+	logger.Noticef(format+"%v", append(args, e.fields)...)
+}
+
+// Infof logs a message with fields using INFO as log level.
+func (e *Entry) Infof(format string, args ...interface{}) {
+	logger.Infof(format+"%v", append(args, e.fields)...)
+}
+
+// Debugf logs a message with fields using DEBUG as log level.
+func (e *Entry) Debugf(format string, args ...interface{}) {
+	logger.Debugf(format+"%v", append(args, e.fields)...)
+}
+
+// fieldsArg is passed to go-logging as the last argument of the message, so text formats get fields
+// by plain formatting and jsonFormatter finds them in the record arguments
+type fieldsArg Fields
+
+// String returns fields as ` key=value` pairs, sorted by keys
+func (f fieldsArg) String() string {
+	var buf bytes.Buffer
+	for _, k := range f.keys() {
+		v := fmt.Sprint(f[k])
+		if v == "" || strings.ContainsAny(v, " \t\r\n\"=") {
+			v = fmt.Sprintf("%q", v)
+		}
+		fmt.Fprintf(&buf, " %s=%s", k, v)
+	}
+
+	return buf.String()
+}
+
+func (f fieldsArg) keys() []string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// jsonFormatter formats a record as a single-line JSON object: time, level, id, msg and fields.
+// Fields, named like the standard keys, are prefixed by `_`
+type jsonFormatter struct{}
+
+func (jsonFormatter) Format(calldepth int, r *logging.Record, output io.Writer) error {
+	msg := r.Message()
+	var fields fieldsArg
+	if len(r.Args) > 0 {
+		if f, ok := r.Args[len(r.Args)-1].(fieldsArg); ok {
+			fields = f
+			msg = strings.TrimSuffix(msg, f.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeJsonValue(&buf, r.Time.Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJsonValue(&buf, r.Level.String())
+	fmt.Fprintf(&buf, `,"id":%d,"msg":`, r.Id)
+	writeJsonValue(&buf, msg)
+
+	for _, k := range fields.keys() {
+		name := k
+		switch name {
+		case "time", "level", "id", "msg":
+			name = "_" + name
+		}
+		buf.WriteByte(',')
+		writeJsonValue(&buf, name)
+		buf.WriteByte(':')
+		writeJsonValue(&buf, fields[k])
+	}
+	buf.WriteByte('}')
+
+	_, err := output.Write(buf.Bytes())
+	return err
+}
+
+// writeJsonValue writes v as JSON, or as a JSON string of its default format, if v couldn't be marshaled
+func writeJsonValue(buf *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(data)
+}
@@ -0,0 +1,64 @@
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mshaverdo/radish/log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWithFields(t *testing.T) {
+	defer log.SetOutput(os.Stderr, "")
+
+	fields := log.Fields{"cmd": "GET", "client": "127.0.0.1:1234", "id": 42, "args": "a b"}
+
+	var buf bytes.Buffer
+	if err := log.SetOutput(&buf, log.FormatText); err != nil {
+		t.Fatalf("SetOutput(): %s", err)
+	}
+	log.WithFields(fields).Errorf("failed: %s", "oops")
+
+	want := `failed: oops args="a b" client=127.0.0.1:1234 cmd=GET id=42` + "\n"
+	if got := buf.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("text: got %q, want suffix %q", got, want)
+	}
+
+	buf.Reset()
+	if err := log.SetOutput(&buf, log.FormatJSON); err != nil {
+		t.Fatalf("SetOutput(): %s", err)
+	}
+	log.WithFields(fields).Errorf("failed: %s", "oops")
+	log.Infof("plain %d%%", 100)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("json: got %d lines, want 2: %q", len(lines), buf.String())
+	}
+
+	wants := []map[string]interface{}{
+		{"level": "ERROR", "msg": "failed: oops", "cmd": "GET", "client": "127.0.0.1:1234", "_id": 42.0, "args": "a b"},
+		{"level": "INFO", "msg": "plain 100%"},
+	}
+	for i, line := range lines {
+		var got map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("json: invalid line %q: %s", line, err)
+		}
+		if got["time"] == nil || got["id"] == nil {
+			t.Errorf("json: line %q has no time or id", line)
+		}
+		for k, v := range wants[i] {
+			if got[k] != v {
+				t.Errorf("json: line %q: %s got %v, want %v", line, k, got[k], v)
+			}
+		}
+	}
+}
+
+func TestSetOutput_UnknownFormat(t *testing.T) {
+	if err := log.SetOutput(os.Stderr, "xml"); err == nil {
+		t.Errorf("SetOutput(xml): got nil error")
+	}
+}
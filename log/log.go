@@ -1,7 +1,9 @@
 package log
 
 import (
+	"fmt"
 	"github.com/op/go-logging"
+	"io"
 	"os"
 )
 
@@ -16,28 +18,73 @@ const (
 	DEBUG    = logging.DEBUG
 )
 
-var logger = logging.MustGetLogger(moduleName)
-var format = logging.MustStringFormatter(
-	`%{color}%{time:15:04:05.000} ▶ %{level:.4s} %{id:03x}%{color:reset} %{message}`,
+// Log formats, accepted by SetOutput
+const (
+	// FormatColor is a colorized human-readable format, intended for terminals
+	FormatColor = "color"
+	// FormatText is the same format without colors and with date, intended for files
+	FormatText = "text"
+	// FormatJSON writes every message as a single-line JSON object, intended for log collectors
+	FormatJSON = "json"
 )
 
+var logger = logging.MustGetLogger(moduleName)
+var formats = map[string]logging.Formatter{
+	FormatColor: logging.MustStringFormatter(
+		`%{color}%{time:15:04:05.000} ▶ %{level:.4s} %{id:03x}%{color:reset} %{message}`,
+	),
+	FormatText: logging.MustStringFormatter(
+		`%{time:2006-01-02 15:04:05.000} ▶ %{level:.4s} %{id:03x} %{message}`,
+	),
+	FormatJSON: jsonFormatter{},
+}
+
+// level is kept to restore it after the backend replacement. DEBUG is the go-logging default
+var level = logging.DEBUG
+
 func init() {
-	backend := logging.NewLogBackend(os.Stderr, "", 0)
+	SetOutput(os.Stderr, FormatColor)
+}
+
+// SetOutput directs the log to w, formatted by format. Empty format means FormatColor for os.Stderr and FormatText otherwise
+func SetOutput(w io.Writer, format string) error {
+	if format == "" {
+		format = FormatText
+		if w == os.Stderr {
+			format = FormatColor
+		}
+	}
+	formatter, ok := formats[format]
+	if !ok {
+		return fmt.Errorf("unknown log format: %q", format)
+	}
+
+	backend := logging.NewLogBackend(w, "", 0)
 
 	// For messages written to backend we want to add some additional
 	// information to the output, including the used log level and the name of
 	// the function.
-	backendFormatter := logging.NewBackendFormatter(backend, format)
+	backendFormatter := logging.NewBackendFormatter(backend, formatter)
 
-	// Set the backend to be used.
+	// Set the backend to be used. It resets levels, so restore the current one
 	logging.SetBackend(backendFormatter)
+	logging.SetLevel(level, moduleName)
+
+	return nil
 }
 
 // SetLevel sets current global log level for the logger
-func SetLevel(level logging.Level) {
+func SetLevel(l logging.Level) {
+	level = l
 	logging.SetLevel(level, moduleName)
 }
 
+// IsEnabledFor returns true, if messages of the level are logged.
+// Use it to skip preparing of costly arguments on hot paths
+func IsEnabledFor(l logging.Level) bool {
+	return logger.IsEnabledFor(l)
+}
+
 // Criticalf logs a message using CRITICAL as log level.
 func Criticalf(format string, args ...interface{}) {
 	logger.Critical(format, args...)
@@ -0,0 +1,148 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedSuffixLayout is a time layout of the suffix, appended to the name of rotated file.
+// It's sortable, so the oldest rotated files go first
+const rotatedSuffixLayout = "20060102-150405.000000"
+
+// RotatingFile is an io.Writer to a log file, that renames the file and starts a new one,
+// when the file grows over maxSize bytes or becomes older than maxAge.
+// Only maxBackups of the most recent rotated files are kept
+type RotatingFile struct {
+	mu         sync.Mutex
+	name       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// NewRotatingFile opens or creates the log file name for appending.
+// Zero maxSize or maxAge disables the corresponding rotation, zero maxBackups keeps all rotated files
+func NewRotatingFile(name string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{
+		name:       name,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Write writes p into the current file, rotating it before, if necessary
+func (f *RotatingFile) Write(p []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.needRotation(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = f.file.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the current file
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+// needRotation returns true, if the current file is too old, or writing of size bytes makes it too large.
+// Non-empty file is never rotated, so a large message is written into a file even if it's larger than maxSize
+func (f *RotatingFile) needRotation(size int64) bool {
+	if f.size == 0 {
+		return false
+	}
+
+	return (f.maxSize > 0 && f.size+size > f.maxSize) || (f.maxAge > 0 && time.Since(f.openedAt) >= f.maxAge)
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.name, f.name+"."+time.Now().Format(rotatedSuffixLayout)); err != nil {
+		return err
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	return f.removeOldBackups()
+}
+
+func (f *RotatingFile) removeOldBackups() error {
+	if f.maxBackups <= 0 {
+		return nil
+	}
+
+	dir, base := filepath.Split(f.name)
+	infos, err := ioutil.ReadDir(filepath.Join(dir, "."))
+	if err != nil {
+		return err
+	}
+
+	// ReadDir returns files sorted by name, so the oldest backups go first
+	var backups []string
+	for _, info := range infos {
+		suffix := strings.TrimPrefix(info.Name(), base+".")
+		if _, err := time.Parse(rotatedSuffixLayout, suffix); err == nil && suffix != info.Name() {
+			backups = append(backups, filepath.Join(dir, info.Name()))
+		}
+	}
+	if len(backups) <= f.maxBackups {
+		return nil
+	}
+
+	for _, name := range backups[:len(backups)-f.maxBackups] {
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
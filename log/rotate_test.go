@@ -0,0 +1,99 @@
+package log_test
+
+import (
+	"github.com/mshaverdo/radish/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readLogs(t *testing.T, dir string) (current string, rotated []string) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir(): %s", err)
+	}
+
+	for _, info := range infos {
+		data, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			t.Fatalf("ReadFile(): %s", err)
+		}
+		switch {
+		case info.Name() == "radish.log":
+			current = string(data)
+		case strings.HasPrefix(info.Name(), "radish.log."):
+			rotated = append(rotated, string(data))
+		default:
+			t.Errorf("unexpected file: %s", info.Name())
+		}
+	}
+
+	return current, rotated
+}
+
+func TestRotatingFile_Size(t *testing.T) {
+	dir, err := ioutil.TempDir("", "radish_log")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "radish.log")
+	if err := ioutil.WriteFile(name, []byte("old\n"), 0644); err != nil {
+		t.Fatalf("WriteFile(): %s", err)
+	}
+
+	f, err := log.NewRotatingFile(name, 10, 0, 2)
+	if err != nil {
+		t.Fatalf("NewRotatingFile(): %s", err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"1234\n", "5\n", "6789\n", "too long line\n", "x\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write(%q): %s", line, err)
+		}
+		// rotated file names have microsecond resolution
+		time.Sleep(time.Millisecond)
+	}
+
+	current, rotated := readLogs(t, dir)
+	if want := "x\n"; current != want {
+		t.Errorf("current log: got %q, want %q", current, want)
+	}
+	// "old\n1234\n" is the oldest backup, removed by maxBackups
+	wantRotated := []string{"5\n6789\n", "too long line\n"}
+	if strings.Join(rotated, "|") != strings.Join(wantRotated, "|") {
+		t.Errorf("rotated logs: got %q, want %q", rotated, wantRotated)
+	}
+}
+
+func TestRotatingFile_Age(t *testing.T) {
+	dir, err := ioutil.TempDir("", "radish_log")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := log.NewRotatingFile(filepath.Join(dir, "radish.log"), 0, 50*time.Millisecond, 0)
+	if err != nil {
+		t.Fatalf("NewRotatingFile(): %s", err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("first\n"))
+	f.Write([]byte("second\n"))
+	time.Sleep(60 * time.Millisecond)
+	f.Write([]byte("third\n"))
+
+	current, rotated := readLogs(t, dir)
+	if want := "third\n"; current != want {
+		t.Errorf("current log: got %q, want %q", current, want)
+	}
+	if want := []string{"first\nsecond\n"}; strings.Join(rotated, "|") != strings.Join(want, "|") {
+		t.Errorf("rotated logs: got %q, want %q", rotated, want)
+	}
+}
@@ -0,0 +1,36 @@
+/*
+ * CODE GENERATED AUTOMATICALLY WITH github.com/mshaverdo/radish/codegen/processor
+ * THIS FILE SHOULD NOT BE EDITED BY HAND!
+ */
+
+package message
+
+// coreModifyingCommands are core commands, that modify the storage at least with some arguments, like SORT with STORE
+var coreModifyingCommands = []string{
+	"SET",
+	"CAS",
+	"SETEX",
+	"INCRBYFLOAT",
+	"DEL",
+	"HSET",
+	"HSETEX",
+	"HDEL",
+	"HINCRBYFLOAT",
+	"LSET",
+	"LPUSH",
+	"LPUSHEX",
+	"LPUSHCAP",
+	"LPUSHCAPEX",
+	"LPOP",
+	"SORT",
+	"EXPIRE",
+	"PERSIST",
+	"SETRANGE",
+	"SETBIT",
+	"BITFIELD",
+	"BITOP",
+	"RESTORE",
+	"ZADD",
+	"ZINCRBY",
+	"ZREM",
+}
@@ -0,0 +1,40 @@
+package message
+
+import "sort"
+
+//go:generate go run ../tools/gen-processor/main.go -tmpl commands.tmpl -out commands.gen.go -pkg message
+
+// serviceModifyingCommands are commands, handled out of the core, that modify the storage or could run modifying commands
+var serviceModifyingCommands = []string{CmdExec, "DELPATTERN", "EVAL", "EVALSHA"}
+
+// modifyingCommands is a set of all modifying commands
+var modifyingCommands = newModifyingCommands()
+
+func newModifyingCommands() map[string]bool {
+	commands := make(map[string]bool)
+	for _, list := range [][]string{coreModifyingCommands, serviceModifyingCommands} {
+		for _, cmd := range list {
+			commands[cmd] = true
+		}
+	}
+
+	return commands
+}
+
+// ModifyingCommands returns sorted names of commands, that modify the storage at least with some arguments,
+// like SORT with STORE, or could run modifying commands, like EVAL. Clients use it to not repeat non-idempotent requests
+func ModifyingCommands() []string {
+	names := make([]string, 0, len(modifyingCommands))
+	for cmd := range modifyingCommands {
+		names = append(names, cmd)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// IsModifyingCommand returns true, if the command modifies the storage at least with some arguments.
+// Transactions and scripts are modifying, because they could run any command
+func IsModifyingCommand(cmd string) bool {
+	return modifyingCommands[cmd]
+}
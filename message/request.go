@@ -1,6 +1,7 @@
 package message
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"strconv"
@@ -12,11 +13,103 @@ import (
 
 // Unfortunately, sync.Pool in Request/Response constructors gives only about 5% perf boost, but significantly increase code complexity
 
+const (
+	// CmdExec is a command, carrying a transaction: batch of requests, that should be processed and logged atomically
+	CmdExec = "EXEC"
+
+	// CmdWatch returns versions of keys. Being the first request of transaction, it carries key/version pairs,
+	// and aborts the transaction if any of the keys was changed
+	CmdWatch = "WATCH"
+)
+
+// ErrMalformedRequest means, that a buffer doesn't contain a marshalled Request
+var ErrMalformedRequest = errors.New("malformed request")
+
 // NewRequest constructs new Request object
 func NewRequest(cmd string, args [][]byte) *Request {
 	return &Request{Timestamp: time.Now().Unix(), Cmd: cmd, Args: args}
 }
 
+// NewRequestTransaction packs requests into a single EXEC request. Every argument is a marshalled Request
+func NewRequestTransaction(requests []*Request) (*Request, error) {
+	args := make([][]byte, len(requests))
+	for i, r := range requests {
+		arg, err := r.Marshal(nil)
+		if err != nil {
+			return nil, fmt.Errorf("NewRequestTransaction(): can't marshal request %d: %s", i, err)
+		}
+		args[i] = arg
+	}
+
+	return NewRequest(CmdExec, args), nil
+}
+
+// TransactionRequests unpacks requests from the EXEC request
+func (r *Request) TransactionRequests() (requests []*Request, err error) {
+	requests = make([]*Request, len(r.Args))
+	for i, arg := range r.Args {
+		requests[i] = new(Request)
+		if _, err := requests[i].UnmarshalChecked(arg); err != nil {
+			return nil, fmt.Errorf("Args[%d] isn't a request: %s", i, err)
+		}
+	}
+
+	return requests, nil
+}
+
+// UnmarshalChecked decodes the request like Unmarshal, but checks the buffer before: generated Unmarshal doesn't check
+// bounds, so it panics on a truncated buffer and allocates memory by lengths from the buffer, that could be garbage
+func (r *Request) UnmarshalChecked(buf []byte) (uint64, error) {
+	if err := checkMarshalledRequest(buf); err != nil {
+		return 0, err
+	}
+
+	return r.Unmarshal(buf)
+}
+
+// checkMarshalledRequest returns ErrMalformedRequest, if buf is shorter, than the marshalled Request layout requires
+func checkMarshalledRequest(buf []byte) (err error) {
+	// Timestamp and Id
+	if len(buf) < 16 {
+		return ErrMalformedRequest
+	}
+	buf = buf[16:]
+
+	// Cmd
+	if buf, err = skipMarshalledBytes(buf); err != nil {
+		return err
+	}
+
+	// Args: every argument takes at least one byte of its length
+	count, n := binary.Uvarint(buf)
+	if n <= 0 || count > uint64(len(buf)-n) {
+		return ErrMalformedRequest
+	}
+	buf = buf[n:]
+	for i := uint64(0); i < count; i++ {
+		if buf, err = skipMarshalledBytes(buf); err != nil {
+			return err
+		}
+	}
+
+	// Unreliable
+	if len(buf) < 1 {
+		return ErrMalformedRequest
+	}
+
+	return nil
+}
+
+// skipMarshalledBytes returns the rest of buf after a length-prefixed byte slice at the beginning
+func skipMarshalledBytes(buf []byte) ([]byte, error) {
+	l, n := binary.Uvarint(buf)
+	if n <= 0 || l > uint64(len(buf)-n) {
+		return nil, ErrMalformedRequest
+	}
+
+	return buf[n+int(l):], nil
+}
+
 // GetArgumentInt returns int argument by index i. Return error if unable to parse int, or requested index too big
 func (r *Request) GetArgumentInt(i int) (result int, err error) {
 	if i > len(r.Args)-1 {
@@ -52,6 +145,15 @@ func (r *Request) GetArgumentVariadicString(i int) (result []string, err error)
 	return result, nil
 }
 
+// GetArgumentOptionalVariadicString returns rest of string args beginning from i index, that could be empty
+func (r *Request) GetArgumentOptionalVariadicString(i int) (result []string, err error) {
+	if i == len(r.Args) {
+		return []string{}, nil
+	}
+
+	return r.GetArgumentVariadicString(i)
+}
+
 // GetArgumentVariadicBytes rest of returns bytes args beginning from i index
 func (r *Request) GetArgumentVariadicBytes(i int) (result [][]byte, err error) {
 	if i > len(r.Args)-1 {
@@ -60,6 +162,22 @@ func (r *Request) GetArgumentVariadicBytes(i int) (result [][]byte, err error) {
 	return r.Args[i:], nil
 }
 
+// GetArgumentVariadicInt returns rest of int args beginning from i index. Rest of args could be empty,
+// so it fits optional int arguments. Return error if unable to parse int
+func (r *Request) GetArgumentVariadicInt(i int) (result []int, err error) {
+	if i > len(r.Args) {
+		return nil, errors.New(fmt.Sprintf("Trying to get not existing argument: %d > %d", i, len(r.Args)))
+	}
+	restArgs := r.Args[i:]
+	result = make([]int, len(restArgs))
+	for j, v := range restArgs {
+		if result[j], err = strconv.Atoi(string(v)); err != nil {
+			return nil, errors.New(fmt.Sprintf("Args[%d] isn't int: %q", i+j, err.Error()))
+		}
+	}
+	return result, nil
+}
+
 // GetArgumentBytes returns bytes argument by index i. Return error if requested index too big
 func (r *Request) GetArgumentBytes(i int) (result []byte, err error) {
 	if i > len(r.Args)-1 {
@@ -15,6 +15,10 @@ const (
 	StatusInvalidCommand
 	StatusInvalidArguments
 	StatusTypeMismatch
+	StatusNoScript
+	StatusReadOnly
+	StatusBusyKey
+	StatusMisconf
 )
 
 // Response is a container, represents a Response to Request Command
@@ -59,16 +63,16 @@ func (r *ResponseStatus) String() string {
 ///////////////////////// ResponseInt ///////////////////////////////////
 type ResponseInt struct {
 	status  Status
-	payload int
+	payload int64
 }
 
 var _ Response = (*ResponseInt)(nil)
 
-func NewResponseInt(status Status, payload int) *ResponseInt {
+func NewResponseInt(status Status, payload int64) *ResponseInt {
 	return &ResponseInt{status: status, payload: payload}
 }
 
-func (r *ResponseInt) Payload() int {
+func (r *ResponseInt) Payload() int64 {
 	return r.payload
 }
 
@@ -77,7 +81,7 @@ func (r *ResponseInt) Status() Status {
 }
 
 func (r *ResponseInt) Bytes() [][]byte {
-	return [][]byte{[]byte(strconv.Itoa(r.payload))}
+	return [][]byte{[]byte(strconv.FormatInt(r.payload, 10))}
 }
 
 func (r *ResponseInt) String() string {
@@ -155,3 +159,298 @@ func (r *ResponseStringSlice) String() string {
 		strPayload,
 	)
 }
+
+///////////////////////// ResponseStringMap ///////////////////////////////////
+// ResponseStringMap is a map of strings, represented as flat slice of key/value pairs, e.g. HGETALL result.
+// Order of pairs is undefined, clients must not rely on it.
+// The map could be streamed from the source, like ResponseStringStream, instead of being built in memory
+type ResponseStringMap struct {
+	status  Status
+	payload [][]byte
+	// stream invokes write with count of pairs and iterator over keys and values, nil if payload is built
+	stream func(write func(count int, forEach func(yield func(value []byte))))
+}
+
+var _ Response = (*ResponseStringMap)(nil)
+
+func NewResponseStringMap(status Status, payload [][]byte) *ResponseStringMap {
+	return &ResponseStringMap{status: status, payload: payload}
+}
+
+// NewResponseStringMapStream returns map, streamed from the source: stream invokes write with count of key/value pairs
+// and iterator, that yields every key followed by its value. Yielded values may be valid only until write returns
+func NewResponseStringMapStream(
+	status Status,
+	stream func(write func(count int, forEach func(yield func(value []byte)))),
+) *ResponseStringMap {
+	return &ResponseStringMap{status: status, stream: stream}
+}
+
+// Stream invokes write with count of key/value pairs and iterator over keys and values
+func (r *ResponseStringMap) Stream(write func(count int, forEach func(yield func(value []byte)))) {
+	if r.stream != nil && r.payload == nil {
+		r.stream(write)
+		return
+	}
+
+	write(len(r.payload)/2, func(yield func(value []byte)) {
+		for _, v := range r.payload {
+			yield(v)
+		}
+	})
+}
+
+// Payload returns flat slice of key/value pairs. Streamed map is materialized by copying
+func (r *ResponseStringMap) Payload() [][]byte {
+	if r.payload == nil && r.stream != nil {
+		r.stream(func(count int, forEach func(yield func(value []byte))) {
+			r.payload = make([][]byte, 0, 2*count)
+			forEach(func(value []byte) {
+				r.payload = append(r.payload, append([]byte{}, value...))
+			})
+		})
+	}
+
+	return r.payload
+}
+
+// Len returns count of key/value pairs
+func (r *ResponseStringMap) Len() int {
+	return len(r.Payload()) / 2
+}
+
+func (r *ResponseStringMap) Status() Status {
+	return r.status
+}
+
+func (r *ResponseStringMap) Bytes() [][]byte {
+	return r.Payload()
+}
+
+func (r *ResponseStringMap) String() string {
+	strPayload := make([]string, len(r.payload))
+	for i, v := range r.payload {
+		strPayload[i] = string(v)
+	}
+	return fmt.Sprintf(
+		"ResponseStatus{\n\tStatus: %q \n\tPayload: %q \n}",
+		r.status,
+		strPayload,
+	)
+}
+
+///////////////////////// ResponseNullableStringSlice ///////////////////////////////////
+// ResponseNullableStringSlice is a slice of strings, that could contain null elements, e.g. missing fields.
+// Null element is represented by nil []byte, so empty string must be represented by non-nil empty []byte
+type ResponseNullableStringSlice struct {
+	status  Status
+	payload [][]byte
+}
+
+var _ Response = (*ResponseNullableStringSlice)(nil)
+
+func NewResponseNullableStringSlice(status Status, payload [][]byte) *ResponseNullableStringSlice {
+	return &ResponseNullableStringSlice{status: status, payload: payload}
+}
+
+func (r *ResponseNullableStringSlice) Payload() [][]byte {
+	return r.payload
+}
+
+func (r *ResponseNullableStringSlice) Status() Status {
+	return r.status
+}
+
+func (r *ResponseNullableStringSlice) Bytes() [][]byte {
+	return r.payload
+}
+
+// IsNull returns true, if i-th element of the payload is null
+func (r *ResponseNullableStringSlice) IsNull(i int) bool {
+	return r.payload[i] == nil
+}
+
+func (r *ResponseNullableStringSlice) String() string {
+	strPayload := make([]string, len(r.payload))
+	for i, v := range r.payload {
+		if v == nil {
+			strPayload[i] = "<nil>"
+		} else {
+			strPayload[i] = strconv.Quote(string(v))
+		}
+	}
+	return fmt.Sprintf(
+		"ResponseStatus{\n\tStatus: %q \n\tPayload: %s \n}",
+		r.status,
+		strPayload,
+	)
+}
+
+///////////////////////// ResponseIntSlice ///////////////////////////////////
+// ResponseIntSlice is a slice of integers, e.g. LPOS with COUNT result.
+// It could contain null elements, e.g. failed BITFIELD operations
+type ResponseIntSlice struct {
+	status  Status
+	payload []int64
+	// nulls marks null elements of the payload, nil if there are no nulls
+	nulls []bool
+}
+
+var _ Response = (*ResponseIntSlice)(nil)
+
+func NewResponseIntSlice(status Status, payload []int64) *ResponseIntSlice {
+	return &ResponseIntSlice{status: status, payload: payload}
+}
+
+// NewResponseNullableIntSlice returns slice of integers, where nil elements are nulls
+func NewResponseNullableIntSlice(status Status, payload []*int64) *ResponseIntSlice {
+	r := &ResponseIntSlice{status: status, payload: make([]int64, len(payload))}
+	for i, v := range payload {
+		if v != nil {
+			r.payload[i] = *v
+			continue
+		}
+		if r.nulls == nil {
+			r.nulls = make([]bool, len(payload))
+		}
+		r.nulls[i] = true
+	}
+	return r
+}
+
+// Payload returns the integers, null elements are zeroes
+func (r *ResponseIntSlice) Payload() []int64 {
+	return r.payload
+}
+
+func (r *ResponseIntSlice) Status() Status {
+	return r.status
+}
+
+// IsNull returns true, if i-th element of the payload is null
+func (r *ResponseIntSlice) IsNull(i int) bool {
+	return r.nulls != nil && r.nulls[i]
+}
+
+// Bytes returns decimal representation of every element, null elements are nil
+func (r *ResponseIntSlice) Bytes() [][]byte {
+	result := make([][]byte, len(r.payload))
+	for i, v := range r.payload {
+		if !r.IsNull(i) {
+			result[i] = []byte(strconv.FormatInt(v, 10))
+		}
+	}
+	return result
+}
+
+func (r *ResponseIntSlice) String() string {
+	strPayload := make([]string, len(r.payload))
+	for i, v := range r.payload {
+		if r.IsNull(i) {
+			strPayload[i] = "<nil>"
+		} else {
+			strPayload[i] = strconv.FormatInt(v, 10)
+		}
+	}
+	return fmt.Sprintf(
+		"ResponseStatus{\n\tStatus: %q \n\tPayload: %s \n}",
+		r.status,
+		strPayload,
+	)
+}
+
+///////////////////////// ResponseStringStream ///////////////////////////////////
+// ResponseStringStream is a slice of strings, that isn't built in memory, but streamed from the source:
+// stream invokes write with count of elements and iterator over them.
+// The source might be locked until write returns, so write should be fast, e.g. write into a buffer
+type ResponseStringStream struct {
+	status Status
+	stream func(write func(count int, forEach func(yield func(value []byte))))
+	// payload is materialized stream, built by the first call of Bytes()
+	payload [][]byte
+}
+
+var _ Response = (*ResponseStringStream)(nil)
+
+func NewResponseStringStream(
+	status Status,
+	stream func(write func(count int, forEach func(yield func(value []byte)))),
+) *ResponseStringStream {
+	return &ResponseStringStream{status: status, stream: stream}
+}
+
+// Stream invokes write with count of elements and iterator over them
+func (r *ResponseStringStream) Stream(write func(count int, forEach func(yield func(value []byte)))) {
+	r.stream(write)
+}
+
+func (r *ResponseStringStream) Status() Status {
+	return r.status
+}
+
+// Bytes materializes the stream. Use Stream() to avoid building whole payload in memory
+func (r *ResponseStringStream) Bytes() [][]byte {
+	if r.payload == nil {
+		r.Stream(func(count int, forEach func(yield func(value []byte))) {
+			r.payload = make([][]byte, 0, count)
+			forEach(func(value []byte) {
+				r.payload = append(r.payload, value)
+			})
+		})
+	}
+
+	return r.payload
+}
+
+func (r *ResponseStringStream) String() string {
+	strPayload := make([]string, 0)
+	for _, v := range r.Bytes() {
+		strPayload = append(strPayload, string(v))
+	}
+	return fmt.Sprintf(
+		"ResponseStatus{\n\tStatus: %q \n\tPayload: %q \n}",
+		r.status,
+		strPayload,
+	)
+}
+
+///////////////////////// ResponseArray ///////////////////////////////////
+type ResponseArray struct {
+	status  Status
+	payload []Response
+}
+
+var _ Response = (*ResponseArray)(nil)
+
+func NewResponseArray(status Status, payload []Response) *ResponseArray {
+	return &ResponseArray{status: status, payload: payload}
+}
+
+func (r *ResponseArray) Payload() []Response {
+	return r.payload
+}
+
+func (r *ResponseArray) Status() Status {
+	return r.status
+}
+
+// Bytes returns flattened payloads of all nested responses
+func (r *ResponseArray) Bytes() [][]byte {
+	var result [][]byte
+	for _, v := range r.payload {
+		result = append(result, v.Bytes()...)
+	}
+	return result
+}
+
+func (r *ResponseArray) String() string {
+	strPayload := make([]string, len(r.payload))
+	for i, v := range r.payload {
+		strPayload[i] = v.String()
+	}
+	return fmt.Sprintf(
+		"ResponseArray{\n\tStatus: %q \n\tPayload: %s \n}",
+		r.status,
+		strPayload,
+	)
+}
@@ -4,9 +4,9 @@ package message
 
 import "strconv"
 
-const _Status_name = "StatusOkStatusErrorStatusNotFoundStatusInvalidCommandStatusInvalidArgumentsStatusTypeMismatch"
+const _Status_name = "StatusOkStatusErrorStatusNotFoundStatusInvalidCommandStatusInvalidArgumentsStatusTypeMismatchStatusNoScriptStatusReadOnlyStatusBusyKeyStatusMisconf"
 
-var _Status_index = [...]uint8{0, 8, 19, 33, 53, 75, 93}
+var _Status_index = [...]uint8{0, 8, 19, 33, 53, 75, 93, 107, 121, 134, 147}
 
 func (i Status) String() string {
 	if i < 0 || i >= Status(len(_Status_index)-1) {
@@ -9,10 +9,12 @@ import (
 	"net/http"
 	netUrl "net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
 const statusHeader = "X-Radish-Status"
+const nullPartHeader = "X-Radish-Null" // marks null element of multipart response
 
 const ErrNotFound = RadishError("redis: nil")                                                            // use this text to be compatible with redis client
 const ErrTypeMismatch = RadishError("WRONGTYPE Operation against a key holding the wrong kind of value") // use this text to be compatible with redis client
@@ -21,20 +23,68 @@ var (
 	RequestTimeout = time.Second * 10
 )
 
+// bulkSetBatchSize is a max count of keys, set by a single request of BulkSet
+const bulkSetBatchSize = 1000
+
+// bulkSetScript sets KEYS to ARGV pairwise and returns count of set keys
+const bulkSetScript = "for i = 1, #KEYS do redis.call('SET', KEYS[i], ARGV[i]) end return #KEYS"
+
+// KeepTTL is a special expiration of Set, SetXX and SetNX, that retains the existing time to live of the key,
+// like KEEPTTL option of Redis SET. It's compatible with go-redis KeepTTL
+const KeepTTL = -1
+
 type RadishError string
 
 func (e RadishError) Error() string { return string(e) }
 
+// ClientOptions configures Client behavior
+type ClientOptions struct {
+	// RequestTimeout limits time of a single HTTP request attempt
+	RequestTimeout time.Duration
+
+	// MaxRetries is a maximum count of retries on transient errors (connection refused, timeout, 5xx w/o status).
+	// Zero disables retries
+	MaxRetries int
+
+	// MinRetryBackoff is a delay before the first retry. Every next retry doubles the delay
+	MinRetryBackoff time.Duration
+
+	// MaxRetryBackoff limits the delay between retries
+	MaxRetryBackoff time.Duration
+
+	// RetryModifying enables retries for modifying commands.
+	// It's unsafe: if server processed the request, but the response was lost, command will be applied twice
+	RetryModifying bool
+}
+
+// DefaultClientOptions returns options used by NewClient(): no retries
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		RequestTimeout:  RequestTimeout,
+		MaxRetries:      0,
+		MinRetryBackoff: 8 * time.Millisecond,
+		MaxRetryBackoff: 512 * time.Millisecond,
+		RetryModifying:  false,
+	}
+}
+
 type Client struct {
 	// host:port
 	host       string
 	httpClient *http.Client
+	options    ClientOptions
 }
 
 func NewClient(host string, port int) *Client {
+	return NewClientWithOptions(host, port, DefaultClientOptions())
+}
+
+// NewClientWithOptions constructs Client with custom timeout & retry policy
+func NewClientWithOptions(host string, port int, options ClientOptions) *Client {
 	return &Client{
 		host:       fmt.Sprintf("%s:%d", host, port),
-		httpClient: &http.Client{Timeout: RequestTimeout},
+		httpClient: &http.Client{Timeout: options.RequestTimeout},
+		options:    options,
 	}
 }
 
@@ -52,45 +102,174 @@ func (c *Client) Get(key string) *StringResult {
 	return newStringResult(payload, err)
 }
 
-// Set key to hold the string value and set key to timeout after a given number of seconds.
+// Set key to hold the string value and set key to timeout after a given expiration.
 // If key already holds a value, it is overwritten, regardless of its type.
-// Zero expiration means the key has no expiration time.
+// Zero expiration means the key has no expiration time, KeepTTL retains the existing expiration time.
 func (c *Client) Set(key string, value interface{}, expiration time.Duration) *StatusResult {
-	url := c.getUrl("SET", key)
-	if expiration != 0 {
-		url = c.getUrl("SETEX", key, strconv.Itoa(int(expiration.Seconds())))
-	}
+	return newStatusResult(c.set(key, value, expiration))
+}
 
+// SetNX Set key to hold the value, only if the key does not already exist. Returns true, if the key was set
+func (c *Client) SetNX(key string, value interface{}, expiration time.Duration) *BoolResult {
+	return newSetIfResult(c.set(key, value, expiration, "NX"))
+}
+
+// SetXX Set key to hold the value, only if the key already exists. Returns true, if the key was set
+func (c *Client) SetXX(key string, value interface{}, expiration time.Duration) *BoolResult {
+	return newSetIfResult(c.set(key, value, expiration, "XX"))
+}
+
+func (c *Client) set(key string, value interface{}, expiration time.Duration, options ...string) error {
 	bytesValue, err := convertToBytes(value)
 	if err != nil {
-		newStatusResult(err)
+		return err
 	}
 
-	_, err = c.requestSingleSingle(true, url, bytesValue)
-	return newStatusResult(err)
+	url := c.getUrl("SET", key)
+	if expiration <= 0 && expiration != KeepTTL && len(options) == 0 {
+		_, err = c.requestSingleSingle(true, url, bytesValue)
+		return err
+	}
 
+	// binary value and options are passed in the multipart body, to keep the value before options
+	payloads := [][]byte{bytesValue}
+	if expiration > 0 {
+		payloads = append(payloads, []byte("PX"), []byte(formatMs(expiration)))
+	} else if expiration == KeepTTL {
+		payloads = append(payloads, []byte("KEEPTTL"))
+	}
+	for _, option := range options {
+		payloads = append(payloads, []byte(option))
+	}
+
+	_, err = c.requestMultiSingle(url, payloads)
+	return err
+}
+
+// newSetIfResult converts result of conditional SET into BoolResult: not found means, that the key wasn't set
+func newSetIfResult(err error) *BoolResult {
+	switch err {
+	case nil:
+		return newBoolResult([]byte("1"), nil)
+	case ErrNotFound:
+		return newBoolResult([]byte("0"), nil)
+	default:
+		return newBoolResult(nil, err)
+	}
+}
+
+// IncrByFloat Increments the floating point number stored at key by increment and returns the new value
+func (c *Client) IncrByFloat(key string, value float64) *FloatResult {
+	url := c.getUrl("INCRBYFLOAT", key, strconv.FormatFloat(value, 'f', -1, 64))
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newFloatResult(payload, err)
+}
+
+// BulkSet Sets many keys to hold the values and returns count of set keys. Existing keys are overwritten and their TTL discarded.
+// Keys are sent by batches of 1000 per request, every batch is set atomically by a single script,
+// so loading is much faster, than Set of each key. If a request fails, keys of previous batches remain set
+func (c *Client) BulkSet(values map[string]string) *IntResult {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	total := 0
+	for start := 0; start < len(keys); start += bulkSetBatchSize {
+		batch := keys[start:]
+		if len(batch) > bulkSetBatchSize {
+			batch = batch[:bulkSetBatchSize]
+		}
+
+		// EVAL script numkeys key... value..., keys and values are sent as multipart body to keep binary data intact
+		url := c.getUrl("EVAL", bulkSetScript, strconv.Itoa(len(batch)))
+		args := make([][]byte, 0, 2*len(batch))
+		for _, key := range batch {
+			args = append(args, []byte(key))
+		}
+		for _, key := range batch {
+			args = append(args, []byte(values[key]))
+		}
+
+		payload, err := c.requestMultiSingle(url, args)
+		if err != nil {
+			return newIntResult(nil, err)
+		}
+		count, err := strconv.Atoi(string(payload))
+		if err != nil {
+			return newIntResult(nil, err)
+		}
+		total += count
+	}
+
+	return newIntResult([]byte(strconv.Itoa(total)), nil)
 }
 
 // Del Removes the specified keys, ignoring not existing and returns count of actually removed values.
 func (c *Client) Del(keys ...string) *IntResult {
 	url := c.getUrl("DEL", keys...)
-	payload, err := c.requestSingleSingle(true, url, nil)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newIntResult(payload, err)
+}
+
+// DelPattern Removes all keys matching glob pattern and returns count of removed keys. Radish-specific.
+func (c *Client) DelPattern(pattern string) *IntResult {
+	url := c.getUrl("DELPATTERN", pattern)
+	payload, err := c.requestSingleSingle(false, url, nil)
 	return newIntResult(payload, err)
 }
 
 // HSet Sets field in the hash stored at key to value.
+// Like go-redis, returns true, if field is a new field in the hash, or false, if the value of existing field was updated.
 func (c *Client) HSet(key, field string, value interface{}) *BoolResult {
 	url := c.getUrl("HSET", key, field)
 
 	bytesValue, err := convertToBytes(value)
 	if err != nil {
-		newStatusResult(err)
+		return newBoolResult(nil, err)
 	}
 
 	payload, err := c.requestSingleSingle(true, url, bytesValue)
 	return newBoolResult(payload, err)
 }
 
+// HSetPairs Sets fields in the hash stored at key to their values atomically.
+// fieldsValues is a flat list of field, value pairs. Returns the number of fields that were added.
+func (c *Client) HSetPairs(key string, fieldsValues ...interface{}) *IntResult {
+	url := c.getUrl("HSET", key)
+
+	var err error
+	bytesValues := make([][]byte, len(fieldsValues))
+	for i, v := range fieldsValues {
+		bytesValues[i], err = convertToBytes(v)
+		if err != nil {
+			return newIntResult(nil, err)
+		}
+	}
+
+	payload, err := c.requestMultiSingle(url, bytesValues)
+	return newIntResult(payload, err)
+}
+
+// HSetEx Sets fields in the hash stored at key to their values atomically, like HSetPairs,
+// and sets key to timeout after a given expiration, so a volatile hash is created without a separate Expire.
+// Expiration is set on every call and must be at least a second. Returns the number of fields that were added.
+func (c *Client) HSetEx(key string, expiration time.Duration, fieldsValues ...interface{}) *IntResult {
+	url := c.getUrl("HSETEX", key, strconv.Itoa(int(expiration.Seconds())))
+
+	var err error
+	bytesValues := make([][]byte, len(fieldsValues))
+	for i, v := range fieldsValues {
+		bytesValues[i], err = convertToBytes(v)
+		if err != nil {
+			return newIntResult(nil, err)
+		}
+	}
+
+	payload, err := c.requestMultiSingle(url, bytesValues)
+	return newIntResult(payload, err)
+}
+
 // HGetAll Returns all fields and values of the hash stored at key.
 func (c *Client) HGetAll(key string) *StringStringMapResult {
 	url := c.getUrl("HGETALL", key)
@@ -123,6 +302,26 @@ func (c *Client) HGet(key, field string) *StringResult {
 
 }
 
+// HIncrByFloat Increments the floating point number stored at field in the dict stored at key by increment and returns the new value
+func (c *Client) HIncrByFloat(key, field string, incr float64) *FloatResult {
+	url := c.getUrl("HINCRBYFLOAT", key, field, strconv.FormatFloat(incr, 'f', -1, 64))
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newFloatResult(payload, err)
+}
+
+// HRandField Returns count random fields from the dict stored at key. If count is negative, fields could be repeated.
+// If withValues is true, every field is followed by its value
+func (c *Client) HRandField(key string, count int, withValues bool) *StringSliceResult {
+	args := []string{key, strconv.Itoa(count)}
+	if withValues {
+		args = append(args, "WITHVALUES")
+	}
+
+	url := c.getUrl("HRANDFIELD", args...)
+	payload, err := c.requestSingleMulti(false, url, nil)
+	return newStringSliceResult(payload, err)
+}
+
 // LRange returns the specified elements of the list stored at key.
 func (c *Client) LRange(key string, start, stop int64) *StringSliceResult {
 	url := c.getUrl("LRANGE", key, strconv.Itoa(int(start)), strconv.Itoa(int(stop)))
@@ -139,7 +338,44 @@ func (c *Client) LPush(key string, values ...interface{}) *IntResult {
 	for i, v := range values {
 		bytesValues[i], err = convertToBytes(v)
 		if err != nil {
-			newStatusResult(err)
+			return newIntResult(nil, err)
+		}
+	}
+
+	payload, err := c.requestMultiSingle(url, bytesValues)
+	return newIntResult(payload, err)
+}
+
+// LPushCapped Inserts all the specified values at the head of the list stored at key, keeping length of the list within maxLen.
+// Policy "TRIM" removes elements from the tail of the list, "ERROR" rejects the push, if the list would be longer.
+func (c *Client) LPushCapped(key string, maxLen int, policy string, values ...interface{}) *IntResult {
+	url := c.getUrl("LPUSHCAP", key, strconv.Itoa(maxLen), policy)
+
+	var err error
+	bytesValues := make([][]byte, len(values))
+	for i, v := range values {
+		bytesValues[i], err = convertToBytes(v)
+		if err != nil {
+			return newIntResult(nil, err)
+		}
+	}
+
+	payload, err := c.requestMultiSingle(url, bytesValues)
+	return newIntResult(payload, err)
+}
+
+// LPushEx Inserts all the specified values at the head of the list stored at key, like LPush,
+// and sets key to timeout after a given expiration, so a volatile list is created without a separate Expire.
+// Expiration is set on every call and must be at least a second.
+func (c *Client) LPushEx(key string, expiration time.Duration, values ...interface{}) *IntResult {
+	url := c.getUrl("LPUSHEX", key, strconv.Itoa(int(expiration.Seconds())))
+
+	var err error
+	bytesValues := make([][]byte, len(values))
+	for i, v := range values {
+		bytesValues[i], err = convertToBytes(v)
+		if err != nil {
+			return newIntResult(nil, err)
 		}
 	}
 
@@ -161,13 +397,43 @@ func (c *Client) LIndex(key string, index int64) *StringResult {
 	return newStringResult(payload, err)
 }
 
+// LPosArgs is a set of LPOS options. If Rank isn't zero, the Rank-th match is returned, negative Rank searches from the tail
+type LPosArgs struct {
+	Rank int64
+}
+
+// LPos Returns the index of the first element equal to element in the list stored at key.
+func (c *Client) LPos(key, element string, args LPosArgs) *IntResult {
+	params := []string{key, element}
+	if args.Rank != 0 {
+		params = append(params, "RANK", strconv.Itoa(int(args.Rank)))
+	}
+
+	url := c.getUrl("LPOS", params...)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newIntResult(payload, err)
+}
+
+// LPosCount Returns indices of up to count elements equal to element in the list stored at key, zero count means all matches.
+func (c *Client) LPosCount(key, element string, count int64, args LPosArgs) *IntSliceResult {
+	params := []string{key, element}
+	if args.Rank != 0 {
+		params = append(params, "RANK", strconv.Itoa(int(args.Rank)))
+	}
+	params = append(params, "COUNT", strconv.Itoa(int(count)))
+
+	url := c.getUrl("LPOS", params...)
+	payload, err := c.requestSingleMulti(false, url, nil)
+	return newIntSliceResult(payload, err)
+}
+
 // LSet Sets the list element at index to value.
 func (c *Client) LSet(key string, index int64, value interface{}) *StatusResult {
 	url := c.getUrl("LSET", key, strconv.Itoa(int(index)))
 
 	bytesValue, err := convertToBytes(value)
 	if err != nil {
-		newStatusResult(err)
+		return newStatusResult(err)
 	}
 
 	_, err = c.requestSingleSingle(true, url, bytesValue)
@@ -181,6 +447,43 @@ func (c *Client) LPop(key string) *StringResult {
 	return newStringResult(payload, err)
 }
 
+// Sort is a set of SORT options. Elements are sorted as numbers, or lexicographically, if Alpha is true.
+// Order is ASC or DESC. If Offset or Count isn't zero, LIMIT option is used
+type Sort struct {
+	Offset, Count int64
+	Order         string
+	Alpha         bool
+}
+
+// Sort Returns the elements of the list stored at key in sorted order. The list itself isn't changed.
+func (c *Client) Sort(key string, sort *Sort) *StringSliceResult {
+	url := c.getUrl("SORT", sortArgs(key, sort)...)
+	payload, err := c.requestSingleMulti(false, url, nil)
+	return newStringSliceResult(payload, err)
+}
+
+// SortStore Stores sorted elements of the list stored at key into the list at store and returns count of elements.
+func (c *Client) SortStore(key, store string, sort *Sort) *IntResult {
+	url := c.getUrl("SORT", append(sortArgs(key, sort), "STORE", store)...)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newIntResult(payload, err)
+}
+
+func sortArgs(key string, sort *Sort) []string {
+	args := []string{key}
+	if sort.Offset != 0 || sort.Count != 0 {
+		args = append(args, "LIMIT", strconv.Itoa(int(sort.Offset)), strconv.Itoa(int(sort.Count)))
+	}
+	if sort.Order != "" {
+		args = append(args, sort.Order)
+	}
+	if sort.Alpha {
+		args = append(args, "ALPHA")
+	}
+
+	return args
+}
+
 // TTL Returns the remaining time to live of a key that has a timeout.
 func (c *Client) TTL(key string) *DurationResult {
 	url := c.getUrl("TTL", key)
@@ -189,6 +492,24 @@ func (c *Client) TTL(key string) *DurationResult {
 	return newDurationResult(payload, err)
 }
 
+// ExpireTime Returns the absolute time in seconds resolution, at which the key will expire.
+// Zero time is returned, if the key has no TTL, and ErrNotFound, if the key doesn't exist
+func (c *Client) ExpireTime(key string) *TimeResult {
+	url := c.getUrl("EXPIRETIME", key)
+	payload, err := c.requestSingleSingle(false, url, nil)
+
+	return newTimeResult(payload, time.Second, err)
+}
+
+// PExpireTime Returns the absolute time in milliseconds resolution, at which the key will expire.
+// Zero time is returned, if the key has no TTL, and ErrNotFound, if the key doesn't exist
+func (c *Client) PExpireTime(key string) *TimeResult {
+	url := c.getUrl("PEXPIRETIME", key)
+	payload, err := c.requestSingleSingle(false, url, nil)
+
+	return newTimeResult(payload, time.Millisecond, err)
+}
+
 // Expire sets a timeout on key. After the timeout has expired, the key will automatically be deleted.
 func (c *Client) Expire(key string, expiration time.Duration) *BoolResult {
 	url := c.getUrl("EXPIRE", key, strconv.Itoa(int(expiration.Seconds())))
@@ -203,6 +524,299 @@ func (c *Client) Persist(key string) *BoolResult {
 	return newBoolResult(val, err)
 }
 
+// Meta Returns metadata of the value stored at key: unix times in milliseconds of its creation and the last modification
+// as "created" and "modified", and TTL in seconds as "ttl". Times are -1, unless the server tracks timestamps.
+func (c *Client) Meta(key string) *StringStringMapResult {
+	url := c.getUrl("META", key)
+	payload, err := c.requestSingleMulti(false, url, nil)
+	return newStringStringMapResult(payload, err)
+}
+
+// Type Returns the string representation of the type of the value stored at key: string, list, hash, zset or none
+func (c *Client) Type(key string) *StatusResult {
+	url := c.getUrl("TYPE", key)
+	val, err := c.requestSingleSingle(false, url, nil)
+	return newStatusPayloadResult(val, err)
+}
+
+// GetRange Returns the substring of the string value stored at key, determined by the offsets start and end (both are inclusive).
+func (c *Client) GetRange(key string, start, end int64) *StringResult {
+	url := c.getUrl("GETRANGE", key, strconv.Itoa(int(start)), strconv.Itoa(int(end)))
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newStringResult(payload, err)
+}
+
+// CAS Sets key to hold the value, only if the current value equals to expected. Returns true, if the value was set.
+// TTL of the key is retained. If create is true, not existing key matches empty expected value and is created
+func (c *Client) CAS(key string, expected, value interface{}, create bool) *BoolResult {
+	bytesExpected, err := convertToBytes(expected)
+	if err != nil {
+		return newBoolResult(nil, err)
+	}
+	bytesValue, err := convertToBytes(value)
+	if err != nil {
+		return newBoolResult(nil, err)
+	}
+
+	payloads := [][]byte{bytesExpected, bytesValue}
+	if create {
+		payloads = append(payloads, []byte("CREATE"))
+	}
+
+	payload, err := c.requestMultiSingle(c.getUrl("CAS", key), payloads)
+	return newBoolResult(payload, err)
+}
+
+// SetRange Overwrites part of the string stored at key, starting at the specified offset, for the entire length of value.
+func (c *Client) SetRange(key string, offset int64, value string) *IntResult {
+	url := c.getUrl("SETRANGE", key, strconv.Itoa(int(offset)))
+	payload, err := c.requestSingleSingle(true, url, []byte(value))
+	return newIntResult(payload, err)
+}
+
+// SetBit Sets or clears the bit at offset in the string value stored at key and returns the original bit value.
+func (c *Client) SetBit(key string, offset int64, value int) *IntResult {
+	url := c.getUrl("SETBIT", key, strconv.Itoa(int(offset)), strconv.Itoa(value))
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newIntResult(payload, err)
+}
+
+// GetBit Returns the bit value at offset in the string value stored at key.
+func (c *Client) GetBit(key string, offset int64) *IntResult {
+	url := c.getUrl("GETBIT", key, strconv.Itoa(int(offset)))
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newIntResult(payload, err)
+}
+
+// BitCount is a range of bytes for BITCOUNT command
+type BitCount struct {
+	Start, End int64
+}
+
+// BitCount Counts the number of set bits in the string value stored at key. If bitCount is nil, whole string counted
+func (c *Client) BitCount(key string, bitCount *BitCount) *IntResult {
+	args := []string{key}
+	if bitCount != nil {
+		args = append(args, strconv.Itoa(int(bitCount.Start)), strconv.Itoa(int(bitCount.End)))
+	}
+
+	url := c.getUrl("BITCOUNT", args...)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newIntResult(payload, err)
+}
+
+// BitField Performs GET, SET, INCRBY and OVERFLOW subcommands, passed as args, over integers of arbitrary width,
+// stored in the string at key, e.g. BitField("key", "SET", "i8", 0, 100, "INCRBY", "u4", "#1", 1).
+// Failed operations of OVERFLOW FAIL are null elements of the result
+func (c *Client) BitField(key string, args ...interface{}) *IntSliceResult {
+	params := make([]string, len(args)+1)
+	params[0] = key
+	for i, v := range args {
+		bytesValue, err := convertToBytes(v)
+		if err != nil {
+			return newIntSliceResult(nil, err)
+		}
+		params[i+1] = string(bytesValue)
+	}
+
+	url := c.getUrl("BITFIELD", params...)
+	payload, err := c.requestSingleMulti(false, url, nil)
+	return newIntSliceResult(payload, err)
+}
+
+// BitOpAnd stores bitwise AND of strings stored at keys in destKey and returns length of the result
+func (c *Client) BitOpAnd(destKey string, keys ...string) *IntResult {
+	return c.bitOp("AND", destKey, keys...)
+}
+
+// BitOpOr stores bitwise OR of strings stored at keys in destKey and returns length of the result
+func (c *Client) BitOpOr(destKey string, keys ...string) *IntResult {
+	return c.bitOp("OR", destKey, keys...)
+}
+
+// BitOpXor stores bitwise XOR of strings stored at keys in destKey and returns length of the result
+func (c *Client) BitOpXor(destKey string, keys ...string) *IntResult {
+	return c.bitOp("XOR", destKey, keys...)
+}
+
+// BitOpNot stores bitwise NOT of string stored at key in destKey and returns length of the result
+func (c *Client) BitOpNot(destKey string, key string) *IntResult {
+	return c.bitOp("NOT", destKey, key)
+}
+
+func (c *Client) bitOp(operation, destKey string, keys ...string) *IntResult {
+	url := c.getUrl("BITOP", append([]string{operation, destKey}, keys...)...)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newIntResult(payload, err)
+}
+
+// Dump Serializes the value stored at key in a Radish-specific format, that could be restored by Restore()
+func (c *Client) Dump(key string) *StringResult {
+	url := c.getUrl("DUMP", key)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newStringResult(payload, err)
+}
+
+// Restore Creates a key associated with a value, obtained by deserializing the value, produced by Dump().
+// Fails, if the key already exists
+func (c *Client) Restore(key string, ttl time.Duration, value string) *StatusResult {
+	return c.restore(key, ttl, value, false)
+}
+
+// RestoreReplace Creates a key associated with a value, obtained by deserializing the value, produced by Dump().
+// Replaces the key, if it already exists
+func (c *Client) RestoreReplace(key string, ttl time.Duration, value string) *StatusResult {
+	return c.restore(key, ttl, value, true)
+}
+
+func (c *Client) restore(key string, ttl time.Duration, value string, replace bool) *StatusResult {
+	url := c.getUrl("RESTORE", key, strconv.Itoa(int(ttl/time.Millisecond)))
+
+	// binary value and options are passed in the multipart body, to not escape the value in the URL
+	payloads := [][]byte{[]byte(value)}
+	if replace {
+		payloads = append(payloads, []byte("REPLACE"))
+	}
+
+	_, err := c.requestMultiSingle(url, payloads)
+	return newStatusResult(err)
+}
+
+// Z is a sorted set member with its score
+type Z struct {
+	Score  float64
+	Member string
+}
+
+// ZAdd Adds all the specified members with the specified scores to the sorted set stored at key.
+// Returns the number of elements added to the sorted set, not including members with updated score
+func (c *Client) ZAdd(key string, members ...Z) *IntResult {
+	args := make([]string, 0, 2*len(members)+1)
+	args = append(args, key)
+	for _, m := range members {
+		args = append(args, strconv.FormatFloat(m.Score, 'f', -1, 64), m.Member)
+	}
+
+	url := c.getUrl("ZADD", args...)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newIntResult(payload, err)
+}
+
+// ZScore Returns the score of member in the sorted set at key.
+func (c *Client) ZScore(key, member string) *FloatResult {
+	url := c.getUrl("ZSCORE", key, member)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newFloatResult(payload, err)
+}
+
+// ZCard Returns the number of elements of the sorted set stored at key.
+func (c *Client) ZCard(key string) *IntResult {
+	url := c.getUrl("ZCARD", key)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newIntResult(payload, err)
+}
+
+// ZRank Returns the rank of member in the sorted set stored at key, with the scores ordered from low to high.
+func (c *Client) ZRank(key, member string) *IntResult {
+	url := c.getUrl("ZRANK", key, member)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newIntResult(payload, err)
+}
+
+// ZRange Returns the specified range of members in the sorted set stored at key, ordered by score.
+func (c *Client) ZRange(key string, start, stop int64) *StringSliceResult {
+	url := c.getUrl("ZRANGE", key, strconv.Itoa(int(start)), strconv.Itoa(int(stop)))
+	payload, err := c.requestSingleMulti(false, url, nil)
+	return newStringSliceResult(payload, err)
+}
+
+// ZRangeWithScores Returns the specified range of members with their scores in the sorted set stored at key, ordered by score.
+func (c *Client) ZRangeWithScores(key string, start, stop int64) *ZSliceResult {
+	url := c.getUrl("ZRANGE", key, strconv.Itoa(int(start)), strconv.Itoa(int(stop)), "WITHSCORES")
+	payload, err := c.requestSingleMulti(false, url, nil)
+	return newZSliceResult(payload, err)
+}
+
+// ZIncrBy Increments the score of member in the sorted set stored at key by increment and returns the new score.
+func (c *Client) ZIncrBy(key string, increment float64, member string) *FloatResult {
+	url := c.getUrl("ZINCRBY", key, strconv.FormatFloat(increment, 'f', -1, 64), member)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newFloatResult(payload, err)
+}
+
+// ZRangeBy is a score range for ZRANGEBYSCORE command. Min and Max could be -inf, +inf or prefixed with ( to be exclusive.
+// If Offset or Count isn't zero, LIMIT option is used
+type ZRangeBy struct {
+	Min, Max      string
+	Offset, Count int64
+}
+
+// ZRangeByScore Returns all the members in the sorted set at key with a score between min and max, ordered by score.
+func (c *Client) ZRangeByScore(key string, opt ZRangeBy) *StringSliceResult {
+	url := c.getUrl("ZRANGEBYSCORE", zRangeByArgs(key, opt, false)...)
+	payload, err := c.requestSingleMulti(false, url, nil)
+	return newStringSliceResult(payload, err)
+}
+
+// ZRangeByScoreWithScores Returns all the members with their scores in the sorted set at key
+// with a score between min and max, ordered by score.
+func (c *Client) ZRangeByScoreWithScores(key string, opt ZRangeBy) *ZSliceResult {
+	url := c.getUrl("ZRANGEBYSCORE", zRangeByArgs(key, opt, true)...)
+	payload, err := c.requestSingleMulti(false, url, nil)
+	return newZSliceResult(payload, err)
+}
+
+func zRangeByArgs(key string, opt ZRangeBy, withScores bool) []string {
+	args := []string{key, opt.Min, opt.Max}
+	if withScores {
+		args = append(args, "WITHSCORES")
+	}
+	if opt.Offset != 0 || opt.Count != 0 {
+		args = append(args, "LIMIT", strconv.Itoa(int(opt.Offset)), strconv.Itoa(int(opt.Count)))
+	}
+
+	return args
+}
+
+// ZRem Removes the specified members from the sorted set stored at key.
+func (c *Client) ZRem(key string, members ...string) *IntResult {
+	args := make([]string, len(members)+1)
+	args[0] = key
+	copy(args[1:], members)
+	url := c.getUrl("ZREM", args...)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newIntResult(payload, err)
+}
+
+// ObjectEncoding returns name of internal representation of the value stored at key
+func (c *Client) ObjectEncoding(key string) *StringResult {
+	url := c.getUrl("OBJECT", "ENCODING", key)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newStringResult(payload, err)
+}
+
+// ObjectRefCount Returns count of references to the value stored at key: 2147483647 for shared small integers, 1 otherwise
+func (c *Client) ObjectRefCount(key string) *IntResult {
+	url := c.getUrl("OBJECT", "REFCOUNT", key)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newIntResult(payload, err)
+}
+
+// Explain Reports what the command would do without executing it: whether it modifies the storage,
+// which keys it touches and its estimated complexity
+func (c *Client) Explain(cmd string, args ...string) *StringResult {
+	url := c.getUrl("EXPLAIN", append([]string{cmd}, args...)...)
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newStringResult(payload, err)
+}
+
+// MemoryPurge Releases memory, held by the storage after removal of keys, and returns count of bytes, released to the OS
+func (c *Client) MemoryPurge() *IntResult {
+	url := c.getUrl("MEMORY", "PURGE")
+	payload, err := c.requestSingleSingle(false, url, nil)
+	return newIntResult(payload, err)
+}
+
 func (c *Client) getUrl(cmd string, args ...string) string {
 	path := fmt.Sprintf("/%s", netUrl.PathEscape(cmd))
 	for _, key := range args {
@@ -263,12 +877,15 @@ func (c *Client) requestMultiSingle(url string, multiPayloads [][]byte) (result
 }
 
 func (c *Client) doRequest(request *http.Request) (*http.Response, error) {
-	response, err := c.httpClient.Do(request)
+	response, err := c.doRequestWithRetries(request)
 	if err != nil {
 		return nil, err
 	}
 
-	if response.StatusCode == http.StatusOK {
+	// radish status is the only source of truth: empty body with StatusOk is an empty value, not a missing one.
+	// HTTP status is checked only for responses without radish status, e.g. from a proxy
+	status := response.Header.Get(statusHeader)
+	if status == message.StatusOk.String() || status == "" && response.StatusCode == http.StatusOK {
 		return response, nil
 	}
 
@@ -279,8 +896,7 @@ func (c *Client) doRequest(request *http.Request) (*http.Response, error) {
 	}()
 
 	// Something wrong happens
-	errorStatus := response.Header.Get(statusHeader)
-	switch errorStatus {
+	switch status {
 	case message.StatusNotFound.String():
 		return nil, ErrNotFound
 	case message.StatusTypeMismatch.String():
@@ -297,3 +913,56 @@ func (c *Client) doRequest(request *http.Request) (*http.Response, error) {
 		return nil, errors.New("ERR " + string(body))
 	}
 }
+
+// doRequestWithRetries sends request and repeats it on transient errors according to c.options
+func (c *Client) doRequestWithRetries(request *http.Request) (response *http.Response, err error) {
+	maxRetries := 0
+	if c.isRetryable(request) {
+		maxRetries = c.options.MaxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, err = c.httpClient.Do(request)
+		if attempt >= maxRetries || !isTransientError(response, err) {
+			return response, err
+		}
+
+		if response != nil {
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		time.Sleep(c.retryBackoff(attempt))
+
+		if request.GetBody != nil {
+			if request.Body, err = request.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// isRetryable returns true, if request could be safely repeated
+func (c *Client) isRetryable(request *http.Request) bool {
+	if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+		// unable to rewind body
+		return false
+	}
+
+	cmd := strings.SplitN(strings.TrimPrefix(request.URL.Path, "/"), "/", 2)[0]
+	return c.options.RetryModifying || !message.IsModifyingCommand(cmd)
+}
+
+// retryBackoff returns exponential delay before retry number attempt (zero-based)
+func (c *Client) retryBackoff(attempt int) time.Duration {
+	backoff := c.options.MinRetryBackoff
+	for i := 0; i < attempt && backoff < c.options.MaxRetryBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > c.options.MaxRetryBackoff {
+		backoff = c.options.MaxRetryBackoff
+	}
+
+	return backoff
+}
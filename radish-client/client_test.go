@@ -0,0 +1,398 @@
+package radish_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/mshaverdo/radish/radish-client"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type unconvertible struct {
+	field int
+}
+
+func newMockServerClient(t *testing.T, hits *int) (*radish.Client, *httptest.Server) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*hits++
+	}))
+
+	u, _ := url.Parse(server.URL)
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatalf("Unable to parse mock server port: %s", err)
+	}
+
+	return radish.NewClient(u.Hostname(), port), server
+}
+
+// newUnavailableServerClient returns a client of a mock server, that replies 503 without radish status,
+// like a proxy while radish-server restarts, so every request fails with a transient error
+func newUnavailableServerClient(t *testing.T, hits *int, options radish.ClientOptions) (*radish.Client, *httptest.Server) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*hits++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	u, _ := url.Parse(server.URL)
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatalf("Unable to parse mock server port: %s", err)
+	}
+
+	return radish.NewClientWithOptions(u.Hostname(), port, options), server
+}
+
+func TestClient_ConversionError(t *testing.T) {
+	hits := 0
+	client, server := newMockServerClient(t, &hits)
+	defer server.Close()
+
+	value := unconvertible{42}
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"Set", client.Set("key", value, 0).Err()},
+		{"SetEx", client.Set("key", value, time.Second).Err()},
+		{"SetNX", client.SetNX("key", value, 0).Err()},
+		{"SetXX", client.SetXX("key", value, time.Second).Err()},
+		{"HSet", client.HSet("key", "field", value).Err()},
+		{"LPush", client.LPush("key", "ok", value).Err()},
+		{"LSet", client.LSet("key", 0, value).Err()},
+	}
+
+	for _, tst := range tests {
+		if tst.err == nil || !strings.Contains(tst.err.Error(), "can't neither stringificate nor marshal") {
+			t.Errorf("%s(): got err %q, want conversion error", tst.name, tst.err)
+		}
+	}
+
+	if hits != 0 {
+		t.Errorf("Requests with unconvertible values must not be sent, got %d requests", hits)
+	}
+}
+
+func TestClient_HSet(t *testing.T) {
+	// mock server replies like HSET of radish-server: 1 for a new field, 0 for an updated one
+	fields := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPost || !strings.HasPrefix(r.URL.Path, "/HSET/") {
+			t.Errorf("got request %s %s, want POST /HSET/...", r.Method, r.URL.Path)
+		}
+
+		if _, ok := fields[r.URL.Path]; ok {
+			w.Write([]byte("0"))
+		} else {
+			w.Write([]byte("1"))
+		}
+		fields[r.URL.Path] = string(body)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	client := radish.NewClient(u.Hostname(), port)
+
+	tests := []struct {
+		key, field, value string
+		want              bool
+	}{
+		{"dict", "f1", "v1", true},
+		{"dict", "f1", "v2", false},
+		{"dict", "f2", "v1", true},
+		{"other", "f1", "v1", true},
+	}
+
+	for _, tst := range tests {
+		got, err := client.HSet(tst.key, tst.field, tst.value).Result()
+		if got != tst.want || err != nil {
+			t.Errorf("HSet(%q, %q, %q): got %t, %v, want %t", tst.key, tst.field, tst.value, got, err, tst.want)
+		}
+	}
+	if got := fields["/HSET/dict/f1"]; got != "v2" {
+		t.Errorf("HSet(): got value %q of updated field, want %q", got, "v2")
+	}
+}
+
+func TestClient_Int64(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strconv.FormatInt(math.MaxInt64, 10)))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	client := radish.NewClient(u.Hostname(), port)
+
+	result := client.Del("key")
+	if got := result.Int64(); got != math.MaxInt64 || result.Err() != nil {
+		t.Errorf("Del().Int64(): got %d, %v, want %d", got, result.Err(), int64(math.MaxInt64))
+	}
+	if got := result.String(); got != "9223372036854775807" {
+		t.Errorf("Del().String(): got %q, want %q", got, "9223372036854775807")
+	}
+}
+
+func TestClient_Status(t *testing.T) {
+	// radish status wins over HTTP status, so a proxy, rewriting HTTP status, doesn't change the result
+	tests := []struct {
+		status     string
+		httpStatus int
+		body       string
+		want       string
+		wantErr    error
+	}{
+		{"StatusOk", http.StatusOK, "", "", nil},
+		{"StatusOk", http.StatusOK, "value", "value", nil},
+		{"StatusNotFound", http.StatusNotFound, "", "", radish.ErrNotFound},
+		{"StatusNotFound", http.StatusOK, "", "", radish.ErrNotFound},
+		{"StatusOk", http.StatusNotFound, "", "", nil},
+		{"", http.StatusOK, "value", "value", nil},
+	}
+
+	for _, tst := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tst.status != "" {
+				w.Header().Set("X-Radish-Status", tst.status)
+			}
+			w.WriteHeader(tst.httpStatus)
+			w.Write([]byte(tst.body))
+		}))
+
+		u, _ := url.Parse(server.URL)
+		port, _ := strconv.Atoi(u.Port())
+		client := radish.NewClient(u.Hostname(), port)
+
+		if got, err := client.Get("key").Result(); got != tst.want || err != tst.wantErr {
+			t.Errorf("%s %d %q: got %q, %v, want %q, %v", tst.status, tst.httpStatus, tst.body, got, err, tst.want, tst.wantErr)
+		}
+		server.Close()
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	options := radish.DefaultClientOptions()
+	options.MaxRetries = 2
+	options.MinRetryBackoff = time.Millisecond
+
+	tests := []struct {
+		name     string
+		call     func(client *radish.Client) error
+		wantHits int
+	}{
+		{"Get", func(client *radish.Client) error { return client.Get("key").Err() }, 3},
+		// STORE makes SORT modifying, so it's never retried
+		{"SortStore", func(client *radish.Client) error { return client.SortStore("src", "dst", &radish.Sort{}).Err() }, 1},
+		{"Set", func(client *radish.Client) error { return client.Set("key", "value", 0).Err() }, 1},
+		{"BulkSet", func(client *radish.Client) error { return client.BulkSet(map[string]string{"key": "value"}).Err() }, 1},
+		{"DelPattern", func(client *radish.Client) error { return client.DelPattern("key*").Err() }, 1},
+	}
+
+	for _, tst := range tests {
+		hits := 0
+		client, server := newUnavailableServerClient(t, &hits, options)
+
+		if err := tst.call(client); err == nil {
+			t.Errorf("%s(): got nil error, want unavailable", tst.name)
+		}
+		if hits != tst.wantHits {
+			t.Errorf("%s(): got %d requests, want %d", tst.name, hits, tst.wantHits)
+		}
+		server.Close()
+	}
+}
+
+func TestClient_RetriesOptions(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxRetries     int
+		retryModifying bool
+		call           func(client *radish.Client) error
+		wantHits       int
+	}{
+		{"Get without retries", 0, false, func(client *radish.Client) error { return client.Get("key").Err() }, 1},
+		{"Set with RetryModifying", 2, true, func(client *radish.Client) error { return client.Set("key", "value", 0).Err() }, 3},
+		// multipart body is rewound before every retry
+		{"LPush with RetryModifying", 2, true, func(client *radish.Client) error { return client.LPush("key", "a", "b").Err() }, 3},
+	}
+
+	for _, tst := range tests {
+		options := radish.DefaultClientOptions()
+		options.MaxRetries = tst.maxRetries
+		options.MinRetryBackoff = time.Millisecond
+		options.RetryModifying = tst.retryModifying
+
+		hits := 0
+		client, server := newUnavailableServerClient(t, &hits, options)
+
+		if err := tst.call(client); err == nil {
+			t.Errorf("%s: got nil error, want unavailable", tst.name)
+		}
+		if hits != tst.wantHits {
+			t.Errorf("%s: got %d requests, want %d", tst.name, hits, tst.wantHits)
+		}
+		server.Close()
+	}
+}
+
+func TestClient_RetriesRecover(t *testing.T) {
+	// mock server is unavailable for the first two requests, e.g. while restarting
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("X-Radish-Status", "StatusOk")
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	options := radish.DefaultClientOptions()
+	options.MaxRetries = 3
+	options.MinRetryBackoff = time.Millisecond
+	options.RetryModifying = true
+	client := radish.NewClientWithOptions(u.Hostname(), port, options)
+
+	if err := client.Set("key", "value", 0).Err(); err != nil {
+		t.Errorf("Set(): got err %v, want recovered after retries", err)
+	}
+	if len(bodies) != 3 {
+		t.Fatalf("Set(): got %d requests, want %d", len(bodies), 3)
+	}
+	for i, body := range bodies {
+		if body != "value" {
+			t.Errorf("Set(): got body %q of attempt %d, want %q", body, i, "value")
+		}
+	}
+}
+
+func TestClient_IsRetryable(t *testing.T) {
+	newRequest := func(method, path string, body []byte) *http.Request {
+		var request *http.Request
+		if body == nil {
+			request, _ = http.NewRequest(method, "http://localhost"+path, nil)
+		} else {
+			// bytes.Reader body could be rewound by http.Request.GetBody
+			request, _ = http.NewRequest(method, "http://localhost"+path, bytes.NewReader(body))
+		}
+		return request
+	}
+	unrewindable := newRequest(http.MethodPost, "/SET/key", []byte("value"))
+	unrewindable.GetBody = nil
+
+	tests := []struct {
+		name           string
+		request        *http.Request
+		retryModifying bool
+		want           bool
+	}{
+		{"GET", newRequest(http.MethodGet, "/GET/key", nil), false, true},
+		{"SORT", newRequest(http.MethodGet, "/SORT/key/ALPHA", nil), false, false},
+		{"SORT STORE", newRequest(http.MethodGet, "/SORT/key/STORE/dst", nil), false, false},
+		{"SET", newRequest(http.MethodPost, "/SET/key", []byte("value")), false, false},
+		{"SET with RetryModifying", newRequest(http.MethodPost, "/SET/key", []byte("value")), true, true},
+		{"EVAL", newRequest(http.MethodPost, "/EVAL/return 1/0", nil), false, false},
+		{"EVALSHA", newRequest(http.MethodPost, "/EVALSHA/sha/0", nil), false, false},
+		{"BITFIELD", newRequest(http.MethodGet, "/BITFIELD/key/GET/u8/0", nil), false, false},
+		{"DELPATTERN", newRequest(http.MethodGet, "/DELPATTERN/key*", nil), false, false},
+		{"LPUSHCAP", newRequest(http.MethodPost, "/LPUSHCAP/key/10/TRIM", []byte("value")), false, false},
+		{"LPUSHCAPEX", newRequest(http.MethodPost, "/LPUSHCAPEX/key/10/10/TRIM", []byte("value")), false, false},
+		{"body can't be rewound", unrewindable, true, false},
+	}
+
+	for _, tst := range tests {
+		options := radish.DefaultClientOptions()
+		options.RetryModifying = tst.retryModifying
+		client := radish.NewClientWithOptions("localhost", 6380, options)
+
+		if got := client.IsRetryable(tst.request); got != tst.want {
+			t.Errorf("%s: got %t, want %t", tst.name, got, tst.want)
+		}
+	}
+}
+
+func TestClient_RetryBackoff(t *testing.T) {
+	options := radish.DefaultClientOptions()
+	options.MinRetryBackoff = 10 * time.Millisecond
+	options.MaxRetryBackoff = 100 * time.Millisecond
+	client := radish.NewClientWithOptions("localhost", 6380, options)
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 10 * time.Millisecond},
+		{1, 20 * time.Millisecond},
+		{3, 80 * time.Millisecond},
+		{4, 100 * time.Millisecond},
+		{1000, 100 * time.Millisecond},
+	}
+
+	for _, tst := range tests {
+		if got := client.RetryBackoff(tst.attempt); got != tst.want {
+			t.Errorf("RetryBackoff(%d): got %s, want %s", tst.attempt, got, tst.want)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransientError(t *testing.T) {
+	// connection to a closed port is refused
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	_, refusedErr := http.Get("http://" + listener.Addr().String() + "/GET/key")
+
+	response := func(statusCode int, radishStatus string) *http.Response {
+		r := &http.Response{StatusCode: statusCode, Header: make(http.Header)}
+		if radishStatus != "" {
+			r.Header.Set("X-Radish-Status", radishStatus)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		response *http.Response
+		err      error
+		want     bool
+	}{
+		{"200", response(http.StatusOK, ""), nil, false},
+		{"404 with radish status", response(http.StatusNotFound, "StatusNotFound"), nil, false},
+		{"500 with radish status", response(http.StatusInternalServerError, "StatusError"), nil, false},
+		{"502 without radish status", response(http.StatusBadGateway, ""), nil, true},
+		{"503 without radish status", response(http.StatusServiceUnavailable, ""), nil, true},
+		{"connection refused", nil, refusedErr, true},
+		{"timeout", nil, &url.Error{Op: "Get", URL: "http://localhost/GET/key", Err: timeoutError{}}, true},
+		{"other error", nil, &url.Error{Op: "Get", URL: "http://localhost/GET/key", Err: errors.New("unsupported protocol scheme")}, false},
+	}
+
+	for _, tst := range tests {
+		if got := radish.IsTransientError(tst.response, tst.err); got != tst.want {
+			t.Errorf("%s: got %t, want %t", tst.name, got, tst.want)
+		}
+	}
+}
@@ -53,6 +53,18 @@ func main() {
 
 	// key1 has gone
 	printStringResult(key, client.Get(key))
+
+	// Load many keys by a few requests instead of Set of each key
+	values := make(map[string]string)
+	for i := 0; i < 10000; i++ {
+		values[fmt.Sprintf("bulk_%d", i)] = fmt.Sprintf("value_%d", i)
+	}
+	count, err := client.BulkSet(values).Result()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%d keys loaded\n", count)
+	printStringResult("bulk_42", client.Get("bulk_42"))
 }
 
 func printStringResult(key string, result *radish.StringResult) {
@@ -0,0 +1,16 @@
+package radish
+
+import (
+	"net/http"
+	"time"
+)
+
+var IsTransientError = isTransientError
+
+func (c *Client) IsRetryable(request *http.Request) bool {
+	return c.isRetryable(request)
+}
+
+func (c *Client) RetryBackoff(attempt int) time.Duration {
+	return c.retryBackoff(attempt)
+}
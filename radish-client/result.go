@@ -93,7 +93,7 @@ func (r *StringSliceResult) String() string {
 
 // Int result representation, inspired by go-redis/redis
 type IntResult struct {
-	val int
+	val int64
 	err error
 }
 
@@ -102,11 +102,16 @@ func newIntResult(val []byte, err error) *IntResult {
 		return &IntResult{val: 0, err: err}
 	}
 	result := &IntResult{}
-	result.val, result.err = strconv.Atoi(string(val))
+	result.val, result.err = strconv.ParseInt(string(val), 10, 64)
 	return result
 }
 
 func (r *IntResult) Val() int {
+	return int(r.val)
+}
+
+// Int64 returns the value as 64-bit integer, like Val() of go-redis IntCmd, to avoid overflow on 32-bit platforms
+func (r *IntResult) Int64() int64 {
 	return r.val
 }
 
@@ -115,25 +120,81 @@ func (r *IntResult) Err() error {
 }
 
 func (r *IntResult) Result() (int, error) {
-	return r.val, r.err
+	return int(r.val), r.err
 }
 
 func (r *IntResult) String() string {
-	return strconv.Itoa(r.val)
+	return strconv.FormatInt(r.val, 10)
+}
+
+// Slice of ints result representation, inspired by go-redis/redis
+type IntSliceResult struct {
+	val []int64
+	// nulls marks null elements, nil if there are no nulls
+	nulls []bool
+	err   error
+}
+
+func newIntSliceResult(val [][]byte, err error) *IntSliceResult {
+	if err != nil {
+		return &IntSliceResult{err: err}
+	}
+	result := &IntSliceResult{val: make([]int64, len(val))}
+	for i, v := range val {
+		if v == nil {
+			if result.nulls == nil {
+				result.nulls = make([]bool, len(val))
+			}
+			result.nulls[i] = true
+			continue
+		}
+		if result.val[i], result.err = strconv.ParseInt(string(v), 10, 64); result.err != nil {
+			return &IntSliceResult{err: result.err}
+		}
+	}
+	return result
+}
+
+// Val returns the integers, null elements are zeroes
+func (r *IntSliceResult) Val() []int64 {
+	return r.val
+}
+
+// IsNull returns true, if i-th element is null, e.g. failed BitField operation
+func (r *IntSliceResult) IsNull(i int) bool {
+	return r.nulls != nil && r.nulls[i]
+}
+
+func (r *IntSliceResult) Err() error {
+	return r.err
+}
+
+func (r *IntSliceResult) Result() ([]int64, error) {
+	return r.val, r.err
+}
+
+func (r *IntSliceResult) String() string {
+	return fmt.Sprintf("%v", r.val)
 }
 
 // Status of command result representation, inspired by go-redis/redis
 type StatusResult struct {
+	val string
 	err error
 }
 
 func newStatusResult(err error) *StatusResult {
-	return &StatusResult{err: err}
+	return &StatusResult{val: "OK", err: err}
+}
+
+// newStatusPayloadResult returns status result with non-OK status, e.g. TYPE result
+func newStatusPayloadResult(val []byte, err error) *StatusResult {
+	return &StatusResult{val: string(val), err: err}
 }
 
 func (r *StatusResult) Val() string {
 	if r.err == nil {
-		return "OK"
+		return r.val
 	} else {
 		return r.err.Error()
 	}
@@ -262,3 +323,149 @@ func (r *DurationResult) Result() (time.Duration, error) {
 func (r *DurationResult) String() string {
 	return r.Val().String()
 }
+
+// Time result representation. Zero time means, that the key has no TTL
+type TimeResult struct {
+	val time.Time
+	err error
+}
+
+// newTimeResult parses Unix time, counted in units, or -1 for key without TTL, or -2 for missing key
+func newTimeResult(val []byte, unit time.Duration, err error) *TimeResult {
+	if err != nil {
+		return &TimeResult{err: err}
+	}
+	timestamp, err := strconv.ParseInt(string(val), 10, 64)
+	switch {
+	case err != nil:
+		return &TimeResult{err: err}
+	case timestamp == -2:
+		return &TimeResult{err: ErrNotFound}
+	case timestamp < 0:
+		return &TimeResult{}
+	default:
+		return &TimeResult{val: time.Unix(0, timestamp*int64(unit))}
+	}
+}
+
+func (r *TimeResult) Val() time.Time {
+	return r.val
+}
+
+func (r *TimeResult) Err() error {
+	return r.err
+}
+
+func (r *TimeResult) Result() (time.Time, error) {
+	return r.val, r.err
+}
+
+func (r *TimeResult) String() string {
+	return r.val.String()
+}
+
+// Float result representation, inspired by go-redis/redis
+type FloatResult struct {
+	val float64
+	err error
+}
+
+func newFloatResult(val []byte, err error) *FloatResult {
+	if err != nil {
+		return &FloatResult{val: 0, err: err}
+	}
+	result := &FloatResult{}
+	result.val, result.err = strconv.ParseFloat(string(val), 64)
+	return result
+}
+
+func (r *FloatResult) Val() float64 {
+	return r.val
+}
+
+func (r *FloatResult) Err() error {
+	return r.err
+}
+
+func (r *FloatResult) Result() (float64, error) {
+	return r.val, r.err
+}
+
+func (r *FloatResult) String() string {
+	return strconv.FormatFloat(r.val, 'f', -1, 64)
+}
+
+// Slice of sorted set members with scores result representation, inspired by go-redis/redis
+type ZSliceResult struct {
+	val []Z
+	err error
+}
+
+func newZSliceResult(val [][]byte, err error) *ZSliceResult {
+	if err != nil {
+		return &ZSliceResult{val: nil, err: err}
+	}
+
+	if len(val)%2 != 0 {
+		return &ZSliceResult{val: nil, err: fmt.Errorf("odd len(val) = %d", len(val))}
+	}
+
+	zVal := make([]Z, len(val)/2)
+	for i := range zVal {
+		zVal[i].Member = string(val[2*i])
+		if zVal[i].Score, err = strconv.ParseFloat(string(val[2*i+1]), 64); err != nil {
+			return &ZSliceResult{val: nil, err: err}
+		}
+	}
+
+	return &ZSliceResult{val: zVal, err: nil}
+}
+
+func (r *ZSliceResult) Val() []Z {
+	return r.val
+}
+
+func (r *ZSliceResult) Err() error {
+	return r.err
+}
+
+func (r *ZSliceResult) Result() ([]Z, error) {
+	return r.val, r.err
+}
+
+func (r *ZSliceResult) String() string {
+	return fmt.Sprintf("%v", r.val)
+}
+
+// Slice of nullable strings result representation, inspired by go-redis/redis SliceCmd.
+// Null elements are represented by nil, others by string
+type SliceResult struct {
+	val [][]byte
+	err error
+}
+
+func newSliceResult(val [][]byte, err error) *SliceResult {
+	return &SliceResult{val: val, err: err}
+}
+
+func (r *SliceResult) Val() []interface{} {
+	result := make([]interface{}, len(r.val))
+	for i, v := range r.val {
+		if v != nil {
+			result[i] = string(v)
+		}
+	}
+	return result
+}
+
+func (r *SliceResult) Err() error {
+	return r.err
+}
+
+func (r *SliceResult) Result() ([]interface{}, error) {
+	return r.Val(), r.err
+}
+
+func (r *SliceResult) String() string {
+	return fmt.Sprintf("%v", r.Val())
+}
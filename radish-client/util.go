@@ -9,9 +9,14 @@ import (
 	"io/ioutil"
 	"mime"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/textproto"
+	"net/url"
+	"os"
 	"strconv"
+	"syscall"
+	"time"
 )
 
 func getRequestSingle(usePost bool, url string, payload []byte) (*http.Request, error) {
@@ -53,19 +58,44 @@ func getRequestMulti(url string, multiPayloads [][]byte) (*http.Request, error)
 	return req, nil
 }
 
+// isTransientError returns true for failures, that may disappear after a while, e.g. during server restart:
+// connection refused, timeout or 5xx response without radish status (e.g. from a proxy)
+func isTransientError(r *http.Response, err error) bool {
+	if err == nil {
+		return r.StatusCode >= 500 && r.Header.Get(statusHeader) == ""
+	}
+
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+
+	if opErr, ok := err.(*net.OpError); ok {
+		if sysErr, ok := opErr.Err.(*os.SyscallError); ok {
+			return sysErr.Err == syscall.ECONNREFUSED || sysErr.Err == syscall.ECONNRESET
+		}
+	}
+
+	return false
+}
+
 func parseResponseSingle(r *http.Response) (result []byte, err error) {
 	return ioutil.ReadAll(r.Body)
 }
 
+// parseResponseMulti parses slice response. Server sends non-empty slices as multipart, even for a single element,
+// so an empty single-part body is an empty slice, rather than a single empty element
 func parseResponseMulti(r *http.Response) (result [][]byte, err error) {
-	if r.Header.Get("Content-Length") == "0" {
-		return nil, nil
-	}
-
 	v := r.Header.Get("Content-Type")
 	d, params, err := mime.ParseMediaType(v)
 	if err != nil || d != "multipart/form-data" {
 		body, err := ioutil.ReadAll(r.Body)
+		if len(body) == 0 {
+			return nil, err
+		}
 		return [][]byte{body}, err
 	}
 
@@ -83,6 +113,12 @@ func parseResponseMulti(r *http.Response) (result [][]byte, err error) {
 			return nil, err
 		}
 
+		if p.Header.Get(nullPartHeader) != "" {
+			payload = nil
+		} else if payload == nil {
+			payload = []byte{}
+		}
+
 		result = append(result, payload)
 	}
 
@@ -140,3 +176,11 @@ func convertToBytes(val interface{}) ([]byte, error) {
 		return nil, fmt.Errorf("radish: can't neither stringificate nor marshal %T (consider implementing encoding.BinaryMarshaler)", val)
 	}
 }
+
+// formatMs formats duration as milliseconds, rounding up durations shorter than a millisecond
+func formatMs(d time.Duration) string {
+	if d > 0 && d < time.Millisecond {
+		return "1"
+	}
+	return strconv.FormatInt(int64(d/time.Millisecond), 10)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mshaverdo/radish/store"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+func main() {
+	dataDir, err := ioutil.TempDir("", "radish-example")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	// Open persistent store: data is restored from dataDir, if any
+	s, err := store.Open(dataDir, store.DefaultOptions())
+	if err != nil {
+		panic(err)
+	}
+
+	// Set string and push some values into a list
+	if err := s.Set("key1", []byte("value")); err != nil {
+		panic(err)
+	}
+	if _, err := s.LPush("list", []byte("a"), []byte("b")); err != nil {
+		panic(err)
+	}
+
+	// Expire key1 after 1 second
+	ok, err := s.Expire("key1", time.Second)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%q became volatile: %t\n", "key1", ok)
+
+	// Close persists data on disk
+	if err := s.Close(); err != nil {
+		panic(err)
+	}
+
+	// Reopen the store and ensure that data survived
+	s, err = store.Open(dataDir, store.DefaultOptions())
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	printValue("key1", s)
+	list, err := s.LRange("list", 0, -1)
+	fmt.Printf("%q: %q, err: %v\n", "list", list, err)
+
+	// key1 has gone
+	time.Sleep(time.Second)
+	printValue("key1", s)
+}
+
+func printValue(key string, s *store.Store) {
+	value, err := s.Get(key)
+	if err == store.ErrNotFound {
+		fmt.Printf("%q: does not exist\n", key)
+	} else if err != nil {
+		fmt.Printf("%q: error: %s\n", key, err)
+	} else {
+		fmt.Printf("%q: %q\n", key, value)
+	}
+}
@@ -0,0 +1,224 @@
+// Package store allows to embed Radish storage into an application without HTTP/RESP API
+package store
+
+import (
+	"errors"
+	"github.com/mshaverdo/radish/controller"
+	"github.com/mshaverdo/radish/core"
+	"github.com/mshaverdo/radish/message"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrNotFound     = core.ErrNotFound
+	ErrWrongType    = core.ErrWrongType
+	ErrInvalidIndex = core.ErrInvalidIndex
+	ErrNoSuchKey    = core.ErrNoSuchKey
+)
+
+// knownErrors are returned by Store methods as is, so they could be compared with ==
+var knownErrors = []error{ErrNotFound, ErrWrongType, ErrInvalidIndex, ErrNoSuchKey}
+
+// Options configures persistence and background maintenance of the Store
+type Options = controller.StoreOptions
+
+// Sync policies of WAL
+const (
+	SyncNever     = controller.SyncNever
+	SyncSometimes = controller.SyncSometimes
+	SyncAlways    = controller.SyncAlways
+)
+
+// DefaultOptions returns options, used by radish-server by default
+func DefaultOptions() Options {
+	return controller.DefaultStoreOptions()
+}
+
+// Store is an embedded Radish storage. It's safe for concurrent use.
+// Modifications are processed like requests of the server: with TTL jitter, list length limit and WAL writing
+type Store struct {
+	store *controller.Store
+	core  controller.Core
+}
+
+// Open restores data from dataDir and starts the Store.
+// If dataDir is empty, Store keeps data in memory only
+func Open(dataDir string, options Options) (*Store, error) {
+	s, err := controller.OpenStore(dataDir, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{store: s, core: s.Core()}, nil
+}
+
+// Close persists data and stops the Store. Store must not be used after Close()
+func (s *Store) Close() error {
+	return s.store.Close()
+}
+
+// Keys returns all keys matching glob pattern
+func (s *Store) Keys(pattern string) []string {
+	return s.core.Keys(pattern)
+}
+
+// Get returns the value of key. If the key does not exist, ErrNotFound returned
+func (s *Store) Get(key string) ([]byte, error) {
+	return s.core.Get(key)
+}
+
+// Set sets key to hold the string value
+func (s *Store) Set(key string, value []byte) error {
+	_, err := s.process("SET", []byte(key), value)
+	return err
+}
+
+// SetEx sets key to hold the string value and set key to timeout after expiration.
+// Expiration is rounded up to whole seconds, non-positive one is rejected
+func (s *Store) SetEx(key string, expiration time.Duration, value []byte) error {
+	_, err := s.process("SETEX", []byte(key), ttlSeconds(expiration), value)
+	return err
+}
+
+// Del removes the specified keys and returns count of actually removed values
+func (s *Store) Del(keys ...string) (int64, error) {
+	return s.processInt("DEL", stringsToBytes(keys)...)
+}
+
+// HSet sets field in the hash stored at key to value.
+// Returns 1 if field is a new field in the hash and 0 if field already existed
+func (s *Store) HSet(key, field string, value []byte) (int64, error) {
+	return s.processInt("HSET", []byte(key), []byte(field), value)
+}
+
+// HGet returns the value associated with field in the hash stored at key
+func (s *Store) HGet(key, field string) ([]byte, error) {
+	return s.core.DGet(key, field)
+}
+
+// HKeys returns all field names in the hash stored at key
+func (s *Store) HKeys(key string) ([]string, error) {
+	return s.core.DKeys(key)
+}
+
+// HGetAll returns all fields and values of the hash stored at key
+func (s *Store) HGetAll(key string) (map[string][]byte, error) {
+	fieldsAndValues, err := s.core.DGetAll(key)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]byte, len(fieldsAndValues)/2)
+	for i := 0; i < len(fieldsAndValues); i += 2 {
+		result[string(fieldsAndValues[i])] = fieldsAndValues[i+1]
+	}
+
+	return result, nil
+}
+
+// HDel removes the specified fields from the hash stored at key and returns count of actually removed fields
+func (s *Store) HDel(key string, fields ...string) (int64, error) {
+	return s.processInt("HDEL", append([][]byte{[]byte(key)}, stringsToBytes(fields)...)...)
+}
+
+// LLen returns the length of the list stored at key
+func (s *Store) LLen(key string) (int64, error) {
+	return s.core.LLen(key)
+}
+
+// LRange returns the specified elements of the list stored at key
+func (s *Store) LRange(key string, start, stop int) ([][]byte, error) {
+	return s.core.LRange(key, start, stop)
+}
+
+// LIndex returns the element at index in the list stored at key
+func (s *Store) LIndex(key string, index int) ([]byte, error) {
+	return s.core.LIndex(key, index)
+}
+
+// LSet sets the list element at index to value
+func (s *Store) LSet(key string, index int, value []byte) error {
+	_, err := s.process("LSET", []byte(key), []byte(strconv.Itoa(index)), value)
+	return err
+}
+
+// LPush inserts all the specified values at the head of the list stored at key and returns length of the list
+func (s *Store) LPush(key string, values ...[]byte) (int64, error) {
+	return s.processInt("LPUSH", append([][]byte{[]byte(key)}, values...)...)
+}
+
+// LPop removes and returns the first element of the list stored at key
+func (s *Store) LPop(key string) ([]byte, error) {
+	response, err := s.process("LPOP", []byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return response.(*message.ResponseString).Payload(), nil
+}
+
+// Ttl returns the remaining time to live of a key that has a timeout
+func (s *Store) Ttl(key string) (time.Duration, error) {
+	seconds, err := s.core.Ttl(key)
+	return time.Duration(seconds) * time.Second, err
+}
+
+// Expire sets a timeout on key. Returns false, if key does not exist.
+// Expiration is rounded up to whole seconds, non-positive one deletes the key
+func (s *Store) Expire(key string, expiration time.Duration) (bool, error) {
+	count, err := s.processInt("EXPIRE", []byte(key), ttlSeconds(expiration))
+	return count == 1, err
+}
+
+// Persist removes the existing timeout on key. Returns false, if key does not exist or has no timeout
+func (s *Store) Persist(key string) (bool, error) {
+	count, err := s.processInt("PERSIST", []byte(key))
+	return count == 1, err
+}
+
+// process processes modifying request, like the server does, and returns error of the failed one
+func (s *Store) process(cmd string, args ...[]byte) (message.Response, error) {
+	response := s.store.Process(message.NewRequest(cmd, args))
+	if response.Status() == message.StatusOk {
+		return response, nil
+	}
+
+	payload := response.(*message.ResponseStatus).Payload()
+	for _, err := range knownErrors {
+		if payload == err.Error() {
+			return nil, err
+		}
+	}
+
+	return nil, errors.New(payload)
+}
+
+// processInt processes modifying request with integer reply
+func (s *Store) processInt(cmd string, args ...[]byte) (int64, error) {
+	response, err := s.process(cmd, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return response.(*message.ResponseInt).Payload(), nil
+}
+
+// ttlSeconds returns TTL argument in whole seconds, rounding sub-second expiration up, so it doesn't delete the key
+func ttlSeconds(expiration time.Duration) []byte {
+	seconds := expiration / time.Second
+	if expiration%time.Second > 0 {
+		seconds++
+	}
+
+	return []byte(strconv.FormatInt(int64(seconds), 10))
+}
+
+func stringsToBytes(s []string) [][]byte {
+	result := make([][]byte, len(s))
+	for i, v := range s {
+		result[i] = []byte(v)
+	}
+
+	return result
+}
@@ -0,0 +1,108 @@
+package store_test
+
+import (
+	"github.com/go-test/deep"
+	"github.com/mshaverdo/radish/store"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStore_Persistence(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "radish-store-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	options := store.DefaultOptions()
+	options.SyncPolicy = store.SyncAlways
+
+	s, err := store.Open(dataDir, options)
+	if err != nil {
+		t.Fatalf("Open(): %s", err)
+	}
+
+	s.Set("str", []byte("value"))
+	s.SetEx("volatile", 100*time.Second, []byte("volatile"))
+	s.Set("removed", []byte("removed"))
+	s.Del("removed", "404")
+	s.HSet("hash", "field", []byte("hvalue"))
+	s.LPush("list", []byte("a"), []byte("b"), []byte("c"))
+	s.LPop("list")
+	s.LSet("list", 0, []byte("B"))
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close(): %s", err)
+	}
+
+	s, err = store.Open(dataDir, options)
+	if err != nil {
+		t.Fatalf("Open() after Close(): %s", err)
+	}
+	defer s.Close()
+
+	if got, err := s.Get("str"); err != nil || string(got) != "value" {
+		t.Errorf("Get(%q): %q, %v", "str", got, err)
+	}
+	if got, err := s.Ttl("volatile"); err != nil || got <= 0 {
+		t.Errorf("Ttl(%q): %v, %v", "volatile", got, err)
+	}
+	if _, err := s.Get("removed"); err != store.ErrNotFound {
+		t.Errorf("Get(%q) err: %v, want %v", "removed", err, store.ErrNotFound)
+	}
+	hash, err := s.HGetAll("hash")
+	if diff := deep.Equal(hash, map[string][]byte{"field": []byte("hvalue")}); err != nil || diff != nil {
+		t.Errorf("HGetAll(%q): %v, %v", "hash", diff, err)
+	}
+	list, err := s.LRange("list", 0, -1)
+	if diff := deep.Equal(list, [][]byte{[]byte("B"), []byte("a")}); err != nil || diff != nil {
+		t.Errorf("LRange(%q): %v, %v", "list", diff, err)
+	}
+}
+
+func TestStore_WrongType(t *testing.T) {
+	s, err := store.Open("", store.DefaultOptions())
+	if err != nil {
+		t.Fatalf("Open(): %s", err)
+	}
+	defer s.Close()
+
+	s.Set("str", []byte("value"))
+	if _, err := s.LPush("str", []byte("a")); err != store.ErrWrongType {
+		t.Errorf("LPush() to string err: %v, want %v", err, store.ErrWrongType)
+	}
+}
+
+func TestStore_Expiration(t *testing.T) {
+	s, err := store.Open("", store.DefaultOptions())
+	if err != nil {
+		t.Fatalf("Open(): %s", err)
+	}
+	defer s.Close()
+
+	// sub-second expiration is rounded up instead of deleting the key
+	if err := s.SetEx("volatile", 500*time.Millisecond, []byte("value")); err != nil {
+		t.Fatalf("SetEx(500ms): %s", err)
+	}
+	if got, err := s.Ttl("volatile"); err != nil || got != time.Second {
+		t.Errorf("Ttl() after SetEx(500ms): %v, %v, want %v", got, err, time.Second)
+	}
+
+	s.Set("str", []byte("value"))
+	if ok, err := s.Expire("str", 1500*time.Millisecond); !ok || err != nil {
+		t.Fatalf("Expire(1500ms): %t, %v", ok, err)
+	}
+	if got, err := s.Ttl("str"); err != nil || got != 2*time.Second {
+		t.Errorf("Ttl() after Expire(1500ms): %v, %v, want %v", got, err, 2*time.Second)
+	}
+
+	// like SETEX of the server, non-positive expiration is rejected
+	if err := s.SetEx("volatile", 0, []byte("new")); err == nil {
+		t.Errorf("SetEx(0): got nil error, want invalid expire time")
+	}
+	if got, err := s.Get("volatile"); err != nil || string(got) != "value" {
+		t.Errorf("Get() after rejected SetEx(0): %q, %v, want %q", got, err, "value")
+	}
+}
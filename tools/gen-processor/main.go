@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"log"
 	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
 )
@@ -23,7 +24,33 @@ type Command struct {
 	Error       string
 	IsModifying bool
 	TtlArgIndex string
+	TtlIsMilli  bool
 	IsVariadic  bool
+	IsOptional  bool
+	// IsStatus is true, if string result should be sent as a status reply
+	IsStatus bool
+	// IsMap is true, if result is a flat slice of key/value pairs
+	IsMap bool
+	// IsPositiveTtl is true, if TTL argument must be positive, like Redis SETEX requires
+	IsPositiveTtl bool
+	// MinArgs is minimal count of arguments of variadic command
+	MinArgs int
+	// TtlOptionsArgIndex is position of variadic options argument, that could contain EX/PX TTL options
+	TtlOptionsArgIndex string
+	// StoreOptionArgIndex is position of variadic options argument, that could contain `STORE destination` option
+	StoreOptionArgIndex string
+	// CountOptionArgIndex is position of variadic options argument, that could contain `COUNT num` option
+	CountOptionArgIndex string
+	// Arity is a count of arguments including command name, like in Redis COMMAND reply: negative means minimal count
+	Arity int
+	// FirstKey, LastKey and KeyStep are positions of keys in arguments, like in Redis COMMAND reply
+	FirstKey, LastKey, KeyStep int
+	// Summary is the first sentence of function doc comment
+	Summary string
+	// Complexity is an estimated time complexity of the command, like in Redis docs
+	Complexity string
+	// IsDangerous is true, if the command may ruin performance on large databases
+	IsDangerous bool
 }
 
 type Data struct {
@@ -99,8 +126,18 @@ func getCommands(f *ast.File) []Command {
 	var commands []Command
 
 	commandRe := regexp.MustCompile("(?i)^//\\s*@command\\s+(\\w+)")
-	ttlRe := regexp.MustCompile("(?i)^//\\s*@Ttl\\s+(\\d+)")
-	isModifyingRe := regexp.MustCompile("(?i)^//\\s*@modifying")
+	ttlRe := regexp.MustCompile("(?i)^//\\s*@(P?)Ttl\\s+(\\d+)")
+	isModifyingRe := regexp.MustCompile("(?i)^//\\s*@modifying\\s*$")
+	isOptionalRe := regexp.MustCompile("(?i)^//\\s*@optional")
+	isStatusRe := regexp.MustCompile("(?i)^//\\s*@status")
+	isMapRe := regexp.MustCompile("(?i)^//\\s*@map")
+	isPositiveTtlRe := regexp.MustCompile("(?i)^//\\s*@positivettl")
+	isDangerousRe := regexp.MustCompile("(?i)^//\\s*@dangerous")
+	complexityRe := regexp.MustCompile("(?i)^//\\s*@complexity\\s+(.+)$")
+	ttlOptionsRe := regexp.MustCompile("(?i)^//\\s*@ttloptions\\s+(\\d+)")
+	minArgsRe := regexp.MustCompile("(?i)^//\\s*@minargs\\s+(\\d+)")
+	storeOptionRe := regexp.MustCompile("(?i)^//\\s*@storeoption\\s+(\\d+)")
+	countOptionRe := regexp.MustCompile("(?i)^//\\s*@countoption\\s+(\\d+)")
 
 	for _, decl := range f.Decls {
 		fn, ok := decl.(*ast.FuncDecl)
@@ -117,23 +154,90 @@ func getCommands(f *ast.File) []Command {
 		}
 
 		isModifying := false
+		isOptional := false
+		isStatus := false
+		isMap := false
+		isPositiveTtl := false
+		isDangerous := false
 		cmd := ""
+		complexity := ""
 		ttlArgIndex := ""
+		ttlIsMilli := false
+		ttlOptionsArgIndex := ""
+		storeOptionArgIndex := ""
+		countOptionArgIndex := ""
+		minArgs := -1
 		for _, docStr := range fn.Doc.List {
 			if isModifyingRe.FindString(docStr.Text) != "" {
 				isModifying = true
 				continue
 			}
 
+			if isOptionalRe.FindString(docStr.Text) != "" {
+				isOptional = true
+				continue
+			}
+
+			if isStatusRe.FindString(docStr.Text) != "" {
+				isStatus = true
+				continue
+			}
+
+			if isMapRe.FindString(docStr.Text) != "" {
+				isMap = true
+				continue
+			}
+
+			if isPositiveTtlRe.FindString(docStr.Text) != "" {
+				isPositiveTtl = true
+				continue
+			}
+
+			if isDangerousRe.FindString(docStr.Text) != "" {
+				isDangerous = true
+				continue
+			}
+
 			matches := commandRe.FindStringSubmatch(docStr.Text)
 			if len(matches) == 2 {
 				cmd = matches[1]
 				continue
 			}
 
+			matches = complexityRe.FindStringSubmatch(docStr.Text)
+			if len(matches) == 2 {
+				complexity = strings.TrimSpace(matches[1])
+				continue
+			}
+
 			matches = ttlRe.FindStringSubmatch(docStr.Text)
+			if len(matches) == 3 {
+				ttlIsMilli = matches[1] != ""
+				ttlArgIndex = matches[2]
+				continue
+			}
+
+			matches = ttlOptionsRe.FindStringSubmatch(docStr.Text)
+			if len(matches) == 2 {
+				ttlOptionsArgIndex = matches[1]
+				continue
+			}
+
+			matches = storeOptionRe.FindStringSubmatch(docStr.Text)
+			if len(matches) == 2 {
+				storeOptionArgIndex = matches[1]
+				continue
+			}
+
+			matches = countOptionRe.FindStringSubmatch(docStr.Text)
 			if len(matches) == 2 {
-				ttlArgIndex = matches[1]
+				countOptionArgIndex = matches[1]
+				continue
+			}
+
+			matches = minArgsRe.FindStringSubmatch(docStr.Text)
+			if len(matches) == 2 {
+				minArgs, _ = strconv.Atoi(matches[1])
 				continue
 			}
 		}
@@ -144,14 +248,53 @@ func getCommands(f *ast.File) []Command {
 
 		args, variadic := getArgs(fn.Type.Params.List)
 		c := Command{
-			Cmd:         cmd,
-			Function:    fn.Name.Name,
-			Args:        args,
-			IsModifying: isModifying,
-			TtlArgIndex: ttlArgIndex,
-			IsVariadic:  variadic,
+			Cmd:                 cmd,
+			Function:            fn.Name.Name,
+			Args:                args,
+			IsModifying:         isModifying,
+			TtlArgIndex:         ttlArgIndex,
+			TtlIsMilli:          ttlIsMilli,
+			IsPositiveTtl:       isPositiveTtl,
+			TtlOptionsArgIndex:  ttlOptionsArgIndex,
+			StoreOptionArgIndex: storeOptionArgIndex,
+			CountOptionArgIndex: countOptionArgIndex,
+			IsVariadic:          variadic,
+			IsOptional:          isOptional,
+			IsStatus:            isStatus,
+			IsMap:               isMap,
+			IsDangerous:         isDangerous,
+			Complexity:          complexity,
 		}
 
+		if complexity == "" {
+			log.Fatalf("%s(): command must have @complexity", fn.Name.Name)
+		}
+
+		if isOptional && !variadic {
+			log.Fatalf("%s(): only variadic argument could be optional", fn.Name.Name)
+		}
+
+		switch {
+		case minArgs >= 0 && !variadic:
+			log.Fatalf("%s(): only variadic command could have minimal count of arguments", fn.Name.Name)
+		case minArgs >= 0:
+			c.MinArgs = minArgs
+		case isOptional:
+			// all fixed arguments
+			c.MinArgs = len(args) - 1
+		default:
+			// all fixed arguments and at least one element of variadic argument
+			c.MinArgs = len(args)
+		}
+
+		if variadic {
+			c.Arity = -(c.MinArgs + 1)
+		} else {
+			c.Arity = len(args) + 1
+		}
+		c.FirstKey, c.LastKey, c.KeyStep = getKeyPositions(fn.Type.Params.List)
+		c.Summary = getSummary(fn)
+
 		fmt.Printf("\n\n=== %s() is a command %s, variadic: %t\n", fn.Name.Name, cmd, variadic)
 
 		var results []string
@@ -175,6 +318,22 @@ func getCommands(f *ast.File) []Command {
 			log.Fatalf("Invalid return type of %s(): %s", c.Function, results)
 		}
 
+		if c.IsStatus && c.Result != "string" {
+			log.Fatalf("%s(): only string result could be sent as status", c.Function)
+		}
+
+		if c.IsMap && c.Result != "[][]byte" {
+			log.Fatalf("%s(): only [][]byte result could be sent as map", c.Function)
+		}
+
+		if c.StoreOptionArgIndex != "" && (c.Result != "[][]byte" || c.IsModifying) {
+			log.Fatalf("%s(): only not modifying command with [][]byte result could have STORE option", c.Function)
+		}
+
+		if c.CountOptionArgIndex != "" && c.Result != "[]int" {
+			log.Fatalf("%s(): only command with []int result could have COUNT option", c.Function)
+		}
+
 		fmt.Printf("Args: %s\n", c.Args)
 		fmt.Printf("Result: %s\n", c.Result)
 		fmt.Printf("Err: %s\n", c.Error)
@@ -184,6 +343,74 @@ func getCommands(f *ast.File) []Command {
 	return commands
 }
 
+// getKeyPositions returns positions of keys in command arguments, counting the command name as 0.
+// Keys are arguments named key and destKey, or variadic argument named keys
+func getKeyPositions(list []*ast.Field) (first, last, step int) {
+	position := 0
+	for _, p := range list {
+		for _, name := range p.Names {
+			position++
+
+			switch name.Name {
+			case "key", "destKey":
+				if first == 0 {
+					first = position
+				}
+				last = position
+			case "keys":
+				if first == 0 {
+					first = position
+				}
+				// variadic keys up to the last argument
+				return first, -1, 1
+			}
+		}
+	}
+
+	if first == 0 {
+		return 0, 0, 0
+	}
+
+	return first, last, 1
+}
+
+// getSummary returns the first sentence of function doc comment without function name and tags
+func getSummary(fn *ast.FuncDecl) string {
+	var lines []string
+	for _, docStr := range fn.Doc.List {
+		line := strings.TrimSpace(strings.TrimPrefix(docStr.Text, "//"))
+		if strings.HasPrefix(line, "@") {
+			break
+		}
+
+		// line without trailing punctuation, followed by capitalized line, ends the sentence
+		if n := len(lines); n > 0 && line != "" && strings.ToUpper(line[:1]) == line[:1] &&
+			!strings.ContainsAny(lines[n-1][len(lines[n-1])-1:], ".,;:(") {
+			lines[n-1] += "."
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	text := strings.Join(lines, " ") + " "
+
+	// doc comment starts with function name, unless function name is a verb itself, like "Get the value of key"
+	words := strings.SplitN(text, " ", 3)
+	if len(words) == 3 && words[0] == fn.Name.Name {
+		if next := words[1]; strings.ToUpper(next[:1]) == next[:1] || strings.HasSuffix(next, "s") {
+			text = strings.ToUpper(next[:1]) + next[1:] + " " + words[2]
+		}
+	}
+
+	for _, end := range []string{". ", ": "} {
+		if i := strings.Index(text, end); i >= 0 {
+			text = text[:i]
+		}
+	}
+
+	return strings.TrimRight(text, ".:, ")
+}
+
 func getArgs(list []*ast.Field) (args []string, isVariadic bool) {
 	for _, p := range list {
 		for range p.Names { // to correctly process args like as "DKeys(key, patternk string)"
@@ -197,6 +424,9 @@ func getArgs(list []*ast.Field) (args []string, isVariadic bool) {
 				if doubleSlice, ok := paramType.Elt.(*ast.ArrayType); ok {
 					is2d = true
 					EltName = doubleSlice.Elt.(*ast.Ident).Name
+				} else if pointer, ok := paramType.Elt.(*ast.StarExpr); ok {
+					// slice of pointers is a nullable slice, e.g. []*int64
+					EltName = "*" + pointer.X.(*ast.Ident).Name
 				} else {
 					EltName = paramType.Elt.(*ast.Ident).Name
 				}
@@ -210,10 +440,14 @@ func getArgs(list []*ast.Field) (args []string, isVariadic bool) {
 					strType += "[]string"
 				case "byte":
 					strType += "[]byte"
+				case "int":
+					strType += "[]int"
+				case "*int64":
+					strType += "[]*int64"
 				default:
-					log.Fatalf("Unknown Elt type: %v", paramType.Elt.(*ast.Ident).Name)
+					log.Fatalf("Unknown Elt type: %v", EltName)
 				}
-				if strType == "[]string" || strType == "[][]byte" {
+				if strType == "[]string" || strType == "[][]byte" || strType == "[]int" {
 					isVariadic = true
 				}
 